@@ -0,0 +1,3 @@
+module pkg/health
+
+go 1.23.7
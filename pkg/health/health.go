@@ -0,0 +1,176 @@
+// Package health serves the liveness and readiness probes of the services in
+// this repository. Readiness runs the service's dependency checks and reports
+// each one with its status and latency, so orchestrators and operators read
+// the same answer.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Statuses of a check and of a report
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFail     = "fail"
+)
+
+// ErrNotConfigured is returned by Configured for an empty setting
+var ErrNotConfigured = errors.New("not configured")
+
+// Check is a dependency probe. A failing critical check makes the service not
+// ready; other checks only degrade it, for dependencies with a fallback.
+type Check struct {
+	Name     string
+	Critical bool
+	Probe    func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of a check
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the body of the probe endpoints
+type Report struct {
+	Status    string        `json:"status"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Checks    []CheckResult `json:"checks,omitempty"`
+}
+
+// Checker runs the readiness checks. Results are kept for cacheFor, so probes
+// from every replica and orchestrator don't turn into upstream traffic.
+type Checker struct {
+	checks   []Check
+	timeout  time.Duration
+	cacheFor time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	last   Report
+	expiry time.Time
+}
+
+// NewChecker runs checks concurrently, each bounded by timeout
+func NewChecker(timeout, cacheFor time.Duration, checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: timeout, cacheFor: cacheFor, now: time.Now}
+}
+
+// Run returns the readiness report, from the cache while it's fresh
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.now().Before(c.expiry) {
+		return c.last
+	}
+
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, CheckedAt: c.now().UTC(), Checks: results}
+	for _, result := range results {
+		switch {
+		case result.Status == StatusOK:
+		case result.Critical:
+			report.Status = StatusFail
+		case report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	c.last, c.expiry = report, c.now().Add(c.cacheFor)
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := c.now()
+	err := check.Probe(ctx)
+	result := CheckResult{
+		Name:      check.Name,
+		Status:    StatusOK,
+		Critical:  check.Critical,
+		LatencyMS: float64(c.now().Sub(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Readiness handles /readyz: 200 while no critical check fails, 503 otherwise
+func (c *Checker) Readiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		status := http.StatusOK
+		if report.Status == StatusFail {
+			status = http.StatusServiceUnavailable
+		}
+		writeReport(w, status, report)
+	}
+}
+
+// Liveness handles /healthz: the process answers, so it's alive. Dependencies
+// are left to readiness, so an upstream outage doesn't restart the service.
+func Liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, http.StatusOK, Report{Status: StatusOK, CheckedAt: time.Now().UTC()})
+	}
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// Reachable probes url with a GET: any answer below 500 means the dependency
+// is up, since probes carry no credentials and may well be refused
+func Reachable(client *http.Client, url string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// Configured checks a required setting, such as an API key, is present
+func Configured(value string) func(ctx context.Context) error {
+	return func(context.Context) error {
+		if value == "" {
+			return ErrNotConfigured
+		}
+		return nil
+	}
+}
@@ -0,0 +1,138 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	t.Parallel()
+
+	ok := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name           string
+		checks         []Check
+		expectedCode   int
+		expectedStatus string
+	}{
+		{"all checks pass", []Check{{Name: "svc-b", Critical: true, Probe: ok}}, http.StatusOK, StatusOK},
+		{"non-critical check fails", []Check{{Name: "viacep", Probe: down}, {Name: "weatherapi", Critical: true, Probe: ok}}, http.StatusOK, StatusDegraded},
+		{"critical check fails", []Check{{Name: "viacep", Probe: down}, {Name: "api_key", Critical: true, Probe: Configured("")}}, http.StatusServiceUnavailable, StatusFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rr := httptest.NewRecorder()
+			NewChecker(time.Second, 0, tt.checks...).Readiness()(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			var report Report
+			if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+				t.Fatalf("failed to decode report: %v", err)
+			}
+			if rr.Code != tt.expectedCode || report.Status != tt.expectedStatus {
+				t.Errorf("got %d %q, want %d %q", rr.Code, report.Status, tt.expectedCode, tt.expectedStatus)
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Fatalf("got %d checks, want %d", len(report.Checks), len(tt.checks))
+			}
+			for i, result := range report.Checks {
+				if result.Name != tt.checks[i].Name {
+					t.Errorf("check %d = %q, want %q", i, result.Name, tt.checks[i].Name)
+				}
+				if (result.Status == StatusFail) != (result.Error != "") {
+					t.Errorf("check %s: status %q with error %q", result.Name, result.Status, result.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckerCachesResults(t *testing.T) {
+	t.Parallel()
+
+	probes := 0
+	checker := NewChecker(time.Second, time.Minute, Check{Name: "svc-b", Probe: func(context.Context) error {
+		probes++
+		return nil
+	}})
+	now := time.Now()
+	checker.now = func() time.Time { return now }
+
+	checker.Run(context.Background())
+	checker.Run(context.Background())
+	if probes != 1 {
+		t.Errorf("got %d probes within the cache lifetime, want 1", probes)
+	}
+
+	now = now.Add(time.Minute)
+	checker.Run(context.Background())
+	if probes != 2 {
+		t.Errorf("got %d probes after the cache expired, want 2", probes)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	t.Parallel()
+
+	checker := NewChecker(10*time.Millisecond, 0, Check{Name: "slow", Critical: true, Probe: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	report := checker.Run(context.Background())
+	if report.Status != StatusFail || report.Checks[0].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("got %q with error %q, want the check to time out", report.Status, report.Checks[0].Error)
+	}
+}
+
+func TestReachable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		status      int
+		expectedErr bool
+	}{
+		{"ok", http.StatusOK, false},
+		{"refused without credentials", http.StatusUnauthorized, false},
+		{"server error", http.StatusBadGateway, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := Reachable(server.Client(), server.URL)(context.Background())
+			if (err != nil) != tt.expectedErr {
+				t.Errorf("Reachable() error = %v, want error %v", err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	t.Parallel()
+
+	rr := httptest.NewRecorder()
+	Liveness()(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	var report Report
+	json.NewDecoder(rr.Body).Decode(&report)
+	if rr.Code != http.StatusOK || report.Status != StatusOK {
+		t.Errorf("got %d %q, want 200 %q", rr.Code, report.Status, StatusOK)
+	}
+}
@@ -0,0 +1,203 @@
+package negotiation
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Content codings served
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// encoder is a compressing writer, gzip or zlib as HTTP's deflate
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Compressors are pooled, as each holds several hundred KiB of state
+var encoderPools = map[string]*sync.Pool{
+	EncodingGzip:    {New: func() any { return gzip.NewWriter(io.Discard) }},
+	EncodingDeflate: {New: func() any { return zlib.NewWriter(io.Discard) }},
+}
+
+// AcceptedEncoding is the content coding served for an Accept-Encoding
+// header, gzip on a tie, or "" for none
+func AcceptedEncoding(acceptEncoding string) string {
+	q := map[string]float64{}
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		quality := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				quality = parsed
+			}
+		}
+		q[coding] = quality
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range []string{EncodingGzip, EncodingDeflate} {
+		quality, listed := q[coding]
+		if !listed {
+			quality = q["*"]
+		}
+		if quality > bestQ {
+			best, bestQ = coding, quality
+		}
+	}
+	return best
+}
+
+// Compress compresses responses of at least minBytes with the coding the
+// client prefers. Smaller responses cost more to compress than they save and
+// are sent as they are, as are responses a handler already encoded.
+func Compress(minBytes int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := AcceptedEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			compressing := &compressWriter{ResponseWriter: w, encoding: encoding, minBytes: minBytes}
+			defer compressing.close()
+			next.ServeHTTP(compressing, r)
+		})
+	}
+}
+
+// compressWriter holds back the start of a response until it's known to reach
+// minBytes, then compresses it from there on
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	minBytes    int
+	status      int
+	wroteHeader bool
+	pending     []byte
+	decided     bool
+	encoder     encoder
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status, w.wroteHeader = code, true
+	if !compressible(code, w.Header()) {
+		w.send()
+	}
+}
+
+// compressible reports whether a response may be compressed: it has a body,
+// isn't already encoded and isn't known to be smaller than worth it
+func compressible(code int, header http.Header) bool {
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch {
+	case mediaType == "text/event-stream", strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "video/"),
+		mediaType == "application/gzip", mediaType == "application/zip":
+		return false
+	}
+	return true
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	if w.decided {
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.pending = append(w.pending, p...)
+	if len(w.pending) >= w.minBytes {
+		if err := w.compress(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// send gives up on compressing, sending what was held back as it is
+func (w *compressWriter) send() error {
+	w.decided = true
+	w.ResponseWriter.WriteHeader(w.status)
+	pending := w.pending
+	w.pending = nil
+	if len(pending) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(pending)
+	return err
+}
+
+// compress starts compressing the response with what was held back
+func (w *compressWriter) compress() error {
+	w.decided = true
+	w.Header().Set("Content-Encoding", w.encoding)
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+
+	w.encoder = encoderPools[w.encoding].Get().(encoder)
+	w.encoder.Reset(w.ResponseWriter)
+	pending := w.pending
+	w.pending = nil
+	_, err := w.encoder.Write(pending)
+	return err
+}
+
+// Flush sends what was written so far. A response flushed before reaching
+// minBytes is sent uncompressed, as its size is then unknown.
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		return
+	}
+	if !w.decided {
+		w.send()
+	}
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets handlers set write deadlines on the connection
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close ends the response, sending a small one as it is
+func (w *compressWriter) close() {
+	if w.wroteHeader && !w.decided {
+		w.send()
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+		encoderPools[w.encoding].Put(w.encoder)
+	}
+}
@@ -0,0 +1,128 @@
+package negotiation
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip, deflate, br", EncodingGzip},
+		{"deflate", EncodingDeflate},
+		{"gzip;q=0.5, deflate", EncodingDeflate},
+		{"*", EncodingGzip},
+		{"*, gzip;q=0", EncodingDeflate},
+		{"GZIP;q=0", ""},
+	}
+
+	for _, tt := range tests {
+		if got := AcceptedEncoding(tt.acceptEncoding); got != tt.expected {
+			t.Errorf("AcceptedEncoding(%q) = %q, want %q", tt.acceptEncoding, got, tt.expected)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	t.Parallel()
+
+	large := bytes.Repeat([]byte(`{"cep":"01001000","status":200},`), 64)
+
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		contentEncoding  string
+		body             []byte
+		chunk            int
+		expectedEncoding string
+	}{
+		{"gzip", "gzip", "", large, len(large), EncodingGzip},
+		{"deflate", "deflate", "", large, len(large), EncodingDeflate},
+		{"flushed in chunks", "gzip", "", large, 1500, EncodingGzip},
+		{"flushed before min size", "gzip", "", large, 100, ""},
+		{"small", "gzip", "", []byte(`{"city":"Rio"}`), 100, ""},
+		{"not accepted", "", "", large, len(large), ""},
+		{"already encoded", "gzip", "br", large, len(large), "br"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := Compress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if tt.contentEncoding != "" {
+					w.Header().Set("Content-Encoding", tt.contentEncoding)
+				}
+				w.WriteHeader(http.StatusOK)
+				for body := tt.body; len(body) > 0; {
+					chunk := body[:min(tt.chunk, len(body))]
+					w.Write(chunk)
+					http.NewResponseController(w).Flush()
+					body = body[len(chunk):]
+				}
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/weather/batch", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("Content-Encoding"); got != tt.expectedEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.expectedEncoding)
+			}
+			var reader io.Reader = rr.Body
+			switch tt.expectedEncoding {
+			case EncodingGzip:
+				reader, _ = gzip.NewReader(rr.Body)
+			case EncodingDeflate:
+				reader, _ = zlib.NewReader(rr.Body)
+			}
+			body, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("failed to decode the body: %v", err)
+			}
+			if !bytes.Equal(body, tt.body) {
+				t.Errorf("got a %d byte body, want the %d bytes written", len(body), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestCompressNegotiatedResponse(t *testing.T) {
+	t.Parallel()
+
+	body := `{"results":[` + string(bytes.Repeat([]byte(`{"cep":"01001000","status":200},`), 64)) + `{}]}`
+	handler := Compress(1024)(Negotiate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	})))
+	req := httptest.NewRequest(http.MethodPost, "/weather/batch", nil)
+	req.Header.Set("Accept", MediaXML)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Type") != MediaXML || rr.Header().Get("Content-Encoding") != EncodingGzip {
+		t.Fatalf("got %q encoded %q, want gzipped XML", rr.Header().Get("Content-Type"), rr.Header().Get("Content-Encoding"))
+	}
+	gz, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("body is not gzipped: %v", err)
+	}
+	xml, _ := io.ReadAll(gz)
+	expected, _ := ToXML([]byte(body))
+	if !bytes.Equal(xml, expected) {
+		t.Errorf("got %.80s..., want the transcoded batch", xml)
+	}
+}
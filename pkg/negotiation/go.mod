@@ -0,0 +1,3 @@
+module pkg/negotiation
+
+go 1.23.7
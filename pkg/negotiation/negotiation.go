@@ -0,0 +1,200 @@
+// Package negotiation serves the responses of the services in this repository
+// the way clients ask for them: as msgpack or XML per Accept, and compressed
+// per Accept-Encoding. Handlers keep writing JSON; the other representations
+// are transcoded from it.
+package negotiation
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Media types of the representations served
+const (
+	MediaJSON    = "application/json"
+	MediaMsgpack = "application/msgpack"
+	MediaXML     = "application/xml"
+)
+
+// representation is a media type served, the media types it's negotiated
+// under and how it's transcoded from JSON
+type representation struct {
+	mediaType string
+	aliases   []string
+	transcode func(data []byte) ([]byte, error)
+}
+
+// representations in order of preference, when the client has none
+var representations = []representation{
+	{mediaType: MediaJSON, aliases: []string{MediaJSON}},
+	{mediaType: MediaMsgpack, aliases: []string{MediaMsgpack, "application/x-msgpack", "application/vnd.msgpack"}, transcode: ToMsgpack},
+	{mediaType: MediaXML, aliases: []string{MediaXML, "text/xml"}, transcode: ToXML},
+}
+
+// Preferred is the media type served for an Accept header. Clients accepting
+// none of them get JSON rather than a 406, as most send Accept by default.
+func Preferred(accept string) string {
+	return preferred(accept).mediaType
+}
+
+func preferred(accept string) representation {
+	if strings.TrimSpace(accept) == "" {
+		return representations[0]
+	}
+	ranges := parseAccept(accept)
+	best, bestQ := representations[0], 0.0
+	for _, candidate := range representations {
+		if q := quality(candidate, ranges); q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+	return best
+}
+
+// mediaRange is an Accept entry, such as text/* or application/xml;q=0.5
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, entry := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// quality is the q the client gives a representation, from the most specific
+// range matching one of its media types
+func quality(candidate representation, ranges []mediaRange) float64 {
+	q, specificity := 0.0, -1
+	for _, alias := range candidate.aliases {
+		for _, r := range ranges {
+			s := matches(r.mediaType, alias)
+			if s >= 0 && (s > specificity || s == specificity && r.q > q) {
+				q, specificity = r.q, s
+			}
+		}
+	}
+	return q
+}
+
+// matches is how specifically a media range matches a media type: 2 for an
+// exact match, 1 for type/* and 0 for */*, or -1 if it doesn't
+func matches(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+	return -1
+}
+
+// contentType is the Content-Type of a JSON response transcoded to target.
+// Structured JSON types keep their name in XML, as with problem+json.
+func (target representation) contentType(jsonType string) string {
+	mediaType, _, _ := mime.ParseMediaType(jsonType)
+	if target.mediaType == MediaXML && strings.HasSuffix(mediaType, "+json") {
+		return strings.TrimSuffix(mediaType, "+json") + "+xml"
+	}
+	return target.mediaType
+}
+
+// isJSON reports whether a Content-Type is JSON, structured types included
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == MediaJSON || strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
+
+// Negotiate transcodes JSON responses to the representation the client
+// prefers. Other responses, such as metrics, pass through as they are.
+func Negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		target := preferred(r.Header.Get("Accept"))
+		if target.transcode == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		transcoding := &transcodingWriter{ResponseWriter: w}
+		next.ServeHTTP(transcoding, r)
+		transcoding.finish(target)
+	})
+}
+
+// transcodingWriter holds back JSON responses, so they can be transcoded whole
+type transcodingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buffering   bool
+	body        bytes.Buffer
+}
+
+func (w *transcodingWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status, w.wroteHeader = code, true
+	w.buffering = isJSON(w.Header().Get("Content-Type"))
+	if !w.buffering {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *transcodingWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buffering {
+		return w.body.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush only reaches the client for responses passed through: a held back
+// response would otherwise go out with its JSON headers
+func (w *transcodingWriter) Flush() {
+	if w.wroteHeader && !w.buffering {
+		http.NewResponseController(w.ResponseWriter).Flush()
+	}
+}
+
+// Unwrap lets handlers set write deadlines on the connection
+func (w *transcodingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes the held back response, transcoded. A body that isn't valid
+// JSON after all is sent as it is.
+func (w *transcodingWriter) finish(target representation) {
+	if !w.buffering {
+		return
+	}
+	body := w.body.Bytes()
+	if transcoded, err := target.transcode(body); err == nil {
+		body = transcoded
+		w.Header().Set("Content-Type", target.contentType(w.Header().Get("Content-Type")))
+	}
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(body)
+}
@@ -0,0 +1,123 @@
+package negotiation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPreferred(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		accept   string
+		expected string
+	}{
+		{"no header", "", MediaJSON},
+		{"anything", "*/*", MediaJSON},
+		{"msgpack", "application/msgpack", MediaMsgpack},
+		{"msgpack alias", "application/x-msgpack", MediaMsgpack},
+		{"xml", "text/xml", MediaXML},
+		{"quality", "application/json;q=0.5, application/xml", MediaXML},
+		{"specific range wins", "application/xml;q=0.1, */*", MediaJSON},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", MediaXML},
+		{"excluded", "application/json;q=0, application/msgpack;q=0.2", MediaMsgpack},
+		{"unsupported", "text/csv", MediaJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := Preferred(tt.accept); got != tt.expected {
+				t.Errorf("Preferred(%q) = %q, want %q", tt.accept, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	t.Parallel()
+
+	weather := `{"city":"São Paulo","temp_C":25.5,"count":2,"tags":["a",null],"ok":true}` + "\n"
+	msgpack := []byte{0x85, 0xa4, 'c', 'i', 't', 'y', 0xaa}
+	msgpack = append(msgpack, "São Paulo"...)
+	msgpack = append(msgpack, 0xa6, 't', 'e', 'm', 'p', '_', 'C', 0xcb)
+	msgpack = binary.BigEndian.AppendUint64(msgpack, math.Float64bits(25.5))
+	msgpack = append(msgpack, 0xa5, 'c', 'o', 'u', 'n', 't', 0x02, 0xa4, 't', 'a', 'g', 's', 0x92, 0xa1, 'a', 0xc0, 0xa2, 'o', 'k', 0xc3)
+
+	tests := []struct {
+		name                string
+		accept              string
+		contentType         string
+		body                string
+		expectedContentType string
+		expectedBody        []byte
+	}{
+		{"json", "", "application/json", weather, "application/json", []byte(weather)},
+		{"msgpack", "application/msgpack", "application/json", weather, MediaMsgpack, msgpack},
+		{"xml", "application/xml", "application/json", weather, MediaXML,
+			[]byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<response><city>São Paulo</city><temp_C>25.5</temp_C><count>2</count><tags><item>a</item><item></item></tags><ok>true</ok></response>`)},
+		{"problem as xml", "application/xml", "application/problem+json", `{"title":"invalid zipcode","trace url":"<1>"}`, "application/problem+xml",
+			[]byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<response><title>invalid zipcode</title><member name="trace url">&lt;1&gt;</member></response>`)},
+		{"not json", "application/msgpack", "text/plain", "# metrics\n", "text/plain", []byte("# metrics\n")},
+		{"invalid json", "application/msgpack", "application/json", `{"city":`, "application/json", []byte(`{"city":`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := Negotiate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte(tt.body))
+				http.NewResponseController(w).Flush()
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil)
+			req.Header.Set("Accept", tt.accept)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusAccepted || rr.Header().Get("Content-Type") != tt.expectedContentType {
+				t.Errorf("got %d %q, want 202 %q", rr.Code, rr.Header().Get("Content-Type"), tt.expectedContentType)
+			}
+			if !bytes.Equal(rr.Body.Bytes(), tt.expectedBody) {
+				t.Errorf("body = %q, want %q", rr.Body.Bytes(), tt.expectedBody)
+			}
+			if rr.Header().Get("Vary") != "Accept" {
+				t.Errorf("Vary = %q, want Accept", rr.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestToMsgpackSizes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		json     string
+		expected []byte
+	}{
+		{"-33", []byte{0xd0, 0xdf}},
+		{"300", []byte{0xd1, 0x01, 0x2c}},
+		{"-70000", []byte{0xd2, 0xff, 0xfe, 0xee, 0x90}},
+		{"5000000000", []byte{0xd3, 0, 0, 0, 0x01, 0x2a, 0x05, 0xf2, 0}},
+		{`"` + string(bytes.Repeat([]byte("a"), 40)) + `"`, append([]byte{0xd9, 40}, bytes.Repeat([]byte("a"), 40)...)},
+		{"[" + string(bytes.Repeat([]byte("0,"), 16)) + "0]", append([]byte{0xdc, 0, 17}, make([]byte, 17)...)},
+	}
+
+	for _, tt := range tests {
+		got, err := ToMsgpack([]byte(tt.json))
+		if err != nil {
+			t.Fatalf("ToMsgpack(%s) failed: %v", tt.json, err)
+		}
+		if !bytes.Equal(got, tt.expected) {
+			t.Errorf("ToMsgpack(%.20s) = % x, want % x", tt.json, got, tt.expected)
+		}
+	}
+}
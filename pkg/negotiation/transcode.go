@@ -0,0 +1,233 @@
+package negotiation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"unicode"
+)
+
+var errTrailingData = errors.New("trailing data after the JSON value")
+
+// member is an object member. Objects are decoded as their members in order,
+// so the other representations list the fields as the JSON does.
+type member struct {
+	key   string
+	value any
+}
+
+type object []member
+
+// decodeJSON decodes a JSON document into objects, []any, strings,
+// json.Number, bools and nil
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	value, err := decodeValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errTrailingData
+	}
+	return value, nil
+}
+
+func decodeValue(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	if delim == '[' {
+		items := []any{}
+		for dec.More() {
+			item, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		_, err := dec.Token()
+		return items, err
+	}
+
+	members := object{}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member{key: key.(string), value: value})
+	}
+	_, err = dec.Token()
+	return members, err
+}
+
+// ToMsgpack transcodes a JSON document to MessagePack. Integers keep an
+// integer encoding; other numbers are float64.
+func ToMsgpack(data []byte) ([]byte, error) {
+	value, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return appendMsgpack(make([]byte, 0, len(data)), value), nil
+}
+
+func appendMsgpack(b []byte, value any) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return appendMsgpackInt(b, n)
+		}
+		f, _ := v.Float64()
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f))
+	case string:
+		if n := len(v); n >= 32 && n <= math.MaxUint8 {
+			b = append(b, 0xd9, byte(n))
+		} else {
+			b = appendMsgpackLength(b, n, 0xa0, 32, 0xda, 0xdb)
+		}
+		return append(b, v...)
+	case []any:
+		b = appendMsgpackLength(b, len(v), 0x90, 16, 0xdc, 0xdd)
+		for _, item := range v {
+			b = appendMsgpack(b, item)
+		}
+		return b
+	case object:
+		b = appendMsgpackLength(b, len(v), 0x80, 16, 0xde, 0xdf)
+		for _, m := range v {
+			b = appendMsgpack(appendMsgpack(b, m.key), m.value)
+		}
+		return b
+	}
+	return b
+}
+
+func appendMsgpackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= -32 && n <= math.MaxInt8:
+		return append(b, byte(n))
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		return append(b, 0xd0, byte(n))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(n))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+}
+
+// appendMsgpackLength appends a string, array or map header: its fix format
+// below fixMax, then its 16 and 32 bit formats
+func appendMsgpackLength(b []byte, n int, fix byte, fixMax int, code16, code32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, code32), uint32(n))
+}
+
+// ToXML transcodes a JSON document to XML under a <response> root. Object
+// members are elements named after their keys, or <member name="..."> for
+// keys that aren't XML names, and array items are <item> elements.
+func ToXML(data []byte) ([]byte, error) {
+	value, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if err := encodeXML(enc, xml.StartElement{Name: xml.Name{Local: "response"}}, value); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeXML(enc *xml.Encoder, start xml.StartElement, value any) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	var err error
+	switch v := value.(type) {
+	case object:
+		for _, m := range v {
+			if err = encodeXML(enc, xmlElement(m.key), m.value); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err = encodeXML(enc, xml.StartElement{Name: xml.Name{Local: "item"}}, item); err != nil {
+				return err
+			}
+		}
+	case string:
+		err = enc.EncodeToken(xml.CharData(v))
+	case json.Number:
+		err = enc.EncodeToken(xml.CharData(v.String()))
+	case bool:
+		err = enc.EncodeToken(xml.CharData(strconv.FormatBool(v)))
+	}
+	if err != nil {
+		return err
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+func xmlElement(key string) xml.StartElement {
+	if isXMLName(key) {
+		return xml.StartElement{Name: xml.Name{Local: key}}
+	}
+	return xml.StartElement{
+		Name: xml.Name{Local: "member"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: key}},
+	}
+}
+
+// isXMLName reports whether a key can name an element as it is. Names starting
+// with "xml" are reserved.
+func isXMLName(key string) bool {
+	if key == "" || len(key) >= 3 && (key[0]|0x20) == 'x' && (key[1]|0x20) == 'm' && (key[2]|0x20) == 'l' {
+		return false
+	}
+	for i, r := range key {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
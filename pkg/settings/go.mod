@@ -0,0 +1,5 @@
+module pkg/settings
+
+go 1.23.7
+
+require gopkg.in/yaml.v3 v3.0.1
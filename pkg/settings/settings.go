@@ -0,0 +1,285 @@
+// Package settings resolves the services' configuration from layers: flags
+// over environment variables over a YAML (or JSON) config file over defaults.
+// Keys are named like environment variables; WEATHER_PROVIDER is set by
+// --weather-provider=openweathermap, by WEATHER_PROVIDER or in the file as
+// weather_provider, or as provider under a weather section.
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileKey names the config file, itself resolved from flags
+// (--config-file) or the environment
+const FileKey = "CONFIG_FILE"
+
+// Source resolves keys from its layers. Values that don't parse and flags or
+// file keys nothing read are collected for Err, so a service can check them
+// all once its configuration is loaded.
+type Source struct {
+	flags  map[string]string
+	getenv func(string) string
+	file   map[string]string
+	path   string
+	read   map[string]bool
+	errs   []error
+}
+
+// Load parses args (without the program name) as flags and reads the config
+// file named by CONFIG_FILE, if any
+func Load(args []string, getenv func(string) string) (*Source, error) {
+	flags, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	s := &Source{flags: flags, getenv: getenv, read: make(map[string]bool)}
+	if path, ok := s.Lookup(FileKey); ok {
+		if s.file, err = readFile(path); err != nil {
+			return nil, err
+		}
+		s.path = path
+	}
+	return s, nil
+}
+
+// FromEnv resolves keys from the environment and defaults alone
+func FromEnv(getenv func(string) string) *Source {
+	return &Source{getenv: getenv, read: make(map[string]bool)}
+}
+
+// File is the config file read, or "" without one
+func (s *Source) File() string {
+	return s.path
+}
+
+// Lookup returns the value of key from the first layer setting it. Empty
+// values count as unset, as they always have for the environment.
+func (s *Source) Lookup(key string) (string, bool) {
+	s.read[key] = true
+	if value := s.flags[key]; value != "" {
+		return value, true
+	}
+	if value := s.getenv(key); value != "" {
+		return value, true
+	}
+	if value := s.file[key]; value != "" {
+		return value, true
+	}
+	return "", false
+}
+
+// String returns key's value or defaultValue
+func (s *Source) String(key, defaultValue string) string {
+	if value, ok := s.Lookup(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// Int returns key's value as an integer or defaultValue
+func (s *Source) Int(key string, defaultValue int) int {
+	value, ok := s.Lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		s.Invalid(key, value, errors.New("want an integer"))
+		return defaultValue
+	}
+	return n
+}
+
+// Float returns key's value as a float or defaultValue
+func (s *Source) Float(key string, defaultValue float64) float64 {
+	value, ok := s.Lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		s.Invalid(key, value, errors.New("want a number"))
+		return defaultValue
+	}
+	return f
+}
+
+// Bool returns key's value as a boolean or defaultValue
+func (s *Source) Bool(key string, defaultValue bool) bool {
+	value, ok := s.Lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		s.Invalid(key, value, errors.New("want true or false"))
+		return defaultValue
+	}
+	return b
+}
+
+// List returns key's comma-separated value, trimmed and without empty items,
+// or defaultValue. The config file may give it as a YAML list.
+func (s *Source) List(key string, defaultValue []string) []string {
+	value, ok := s.Lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Invalid records that key's value doesn't parse, for getters of the
+// service's own formats
+func (s *Source) Invalid(key, value string, reason error) {
+	s.errs = append(s.errs, fmt.Errorf("%s=%q: %w", key, value, reason))
+}
+
+// Err reports every value that didn't parse and every flag or file key that
+// was never read, most likely misspelt, or nil
+func (s *Source) Err() error {
+	errs := slices.Clone(s.errs)
+	for _, key := range s.unread(s.flags) {
+		errs = append(errs, fmt.Errorf("unknown flag --%s", strings.ToLower(strings.ReplaceAll(key, "_", "-"))))
+	}
+	for _, key := range s.unread(s.file) {
+		errs = append(errs, fmt.Errorf("unknown key %s in %s", key, s.path))
+	}
+	return errors.Join(errs...)
+}
+
+// unread lists the keys of layer that were never read, sorted
+func (s *Source) unread(layer map[string]string) []string {
+	var keys []string
+	for key := range layer {
+		if !s.read[key] {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// normalize turns a flag or file key into its environment variable name
+func normalize(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// parseFlags parses --name=value, --name value and bare --name (true)
+// flags; a single leading dash works too. A value starting with a dash needs
+// the = form.
+func parseFlags(args []string) (map[string]string, error) {
+	flags := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if name == arg || name == "" || strings.HasPrefix(name, "-") {
+			return nil, fmt.Errorf("unexpected argument %q, want --name=value", arg)
+		}
+		name, value, ok := strings.Cut(name, "=")
+		if !ok {
+			value = "true"
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				value = args[i]
+			}
+		}
+		flags[normalize(name)] = value
+	}
+	return flags, nil
+}
+
+// readFile reads a YAML or JSON config file, flattening nested sections into
+// their keys
+func readFile(path string) (map[string]string, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format %q, want .yaml, .yml or .json", path, ext)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+	var tree map[string]any
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	values := make(map[string]string)
+	if err := flatten(values, "", tree); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// flatten stores node's values under prefix, joining nested keys with
+// underscores and lists with commas
+func flatten(values map[string]string, prefix string, node any) error {
+	switch node := node.(type) {
+	case map[string]any:
+		for name, child := range node {
+			key := normalize(name)
+			if prefix != "" {
+				key = prefix + "_" + key
+			}
+			if err := flatten(values, key, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []any:
+		items := make([]string, len(node))
+		for i, item := range node {
+			value, err := scalar(prefix, item)
+			if err != nil {
+				return err
+			}
+			items[i] = value
+		}
+		return set(values, prefix, strings.Join(items, ","))
+	default:
+		value, err := scalar(prefix, node)
+		if err != nil {
+			return err
+		}
+		return set(values, prefix, value)
+	}
+}
+
+// set stores a flattened value, rejecting a key given twice
+func set(values map[string]string, key, value string) error {
+	if _, ok := values[key]; ok {
+		return fmt.Errorf("key %s set twice", key)
+	}
+	values[key] = value
+	return nil
+}
+
+// scalar renders a plain YAML value as its environment variable would be
+func scalar(key string, value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case int, bool:
+		return fmt.Sprint(value), nil
+	default:
+		return "", fmt.Errorf("key %s: want a plain value or a list of them", key)
+	}
+}
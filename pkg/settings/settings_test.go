@@ -0,0 +1,168 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// env fakes the environment
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+// writeFile writes a config file to a temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLayers(t *testing.T) {
+	t.Parallel()
+
+	path := writeFile(t, "svc.yaml", "weather:\n  provider: file\nport: 9000\nlog_level: warn\n")
+
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		key      string
+		expected string
+	}{
+		{"Default", nil, nil, "TIMEOUT_SECONDS", "10"},
+		{"File, nested", nil, nil, "WEATHER_PROVIDER", "file"},
+		{"File, flat", nil, nil, "LOG_LEVEL", "warn"},
+		{"Environment over file", nil, map[string]string{"PORT": "8081"}, "PORT", "8081"},
+		{"Empty environment is unset", nil, map[string]string{"PORT": ""}, "PORT", "9000"},
+		{"Flag over environment", []string{"--port=8082"}, map[string]string{"PORT": "8081"}, "PORT", "8082"},
+		{"Flag with a separate value", []string{"--weather-provider", "flag"}, nil, "WEATHER_PROVIDER", "flag"},
+		{"Bare flag", []string{"-sandbox-mode"}, nil, "SANDBOX_MODE", "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := Load(append(tt.args, "--config-file="+path), env(tt.env))
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			defaults := map[string]string{"TIMEOUT_SECONDS": "10"}
+			if got := s.String(tt.key, defaults[tt.key]); got != tt.expected {
+				t.Errorf("String(%s) = %q, want %q", tt.key, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTypedValues(t *testing.T) {
+	t.Parallel()
+
+	path := writeFile(t, "svc.yaml", "ratio: 0.25\nlimit: 1000000\nenabled: true\nproviders: [viacep, brasilapi]\n")
+	s, err := Load(nil, env(map[string]string{"CONFIG_FILE": path}))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := s.Float("RATIO", 0); got != 0.25 {
+		t.Errorf("Float(RATIO) = %v, want 0.25", got)
+	}
+	if got := s.Int("LIMIT", 0); got != 1000000 {
+		t.Errorf("Int(LIMIT) = %v, want 1000000", got)
+	}
+	if got := s.Bool("ENABLED", false); !got {
+		t.Errorf("Bool(ENABLED) = false, want true")
+	}
+	if got := s.List("PROVIDERS", nil); !reflect.DeepEqual(got, []string{"viacep", "brasilapi"}) {
+		t.Errorf("List(PROVIDERS) = %v, want [viacep brasilapi]", got)
+	}
+	if s.File() != path {
+		t.Errorf("File() = %q, want %q", s.File(), path)
+	}
+	if err := s.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestErr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		args     []string
+		file     string
+		env      map[string]string
+		expected string
+	}{
+		{"Malformed integer", nil, "", map[string]string{"PORT": "80a"}, `PORT="80a": want an integer`},
+		{"Malformed boolean", []string{"--sandbox-mode=maybe"}, "", nil, `SANDBOX_MODE="maybe": want true or false`},
+		{"Unknown flag", []string{"--prot=8080"}, "", nil, "unknown flag --prot"},
+		{"Unknown file key", nil, "prot: 8080\n", nil, "unknown key PROT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "--config-file="+writeFile(t, "svc.yaml", tt.file))
+			}
+			s, err := Load(args, env(tt.env))
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			s.Int("PORT", 8080)
+			s.Bool("SANDBOX_MODE", false)
+
+			if err := s.Err(); err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Err() = %v, want it to mention %q", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		args []string
+		file string
+	}{
+		{"Positional argument", []string{"serve"}, ""},
+		{"Unsupported file format", nil, "config.toml"},
+		{"Missing file", nil, "missing.yaml"},
+		{"Key set twice", nil, "twice.yaml"},
+		{"Nested list", nil, "nested.yaml"},
+	}
+	files := map[string]string{
+		"twice.yaml":  "weather_provider: a\nweather:\n  provider: b\n",
+		"nested.yaml": "providers: [[viacep]]\n",
+		"config.toml": "port = 8080\n",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			args := tt.args
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), tt.file)
+				if content, ok := files[tt.file]; ok {
+					path = writeFile(t, tt.file, content)
+				}
+				args = append(args, "--config-file="+path)
+			}
+			if _, err := Load(args, env(nil)); err == nil {
+				t.Errorf("Load(%v) error = nil, want one", args)
+			}
+		})
+	}
+}
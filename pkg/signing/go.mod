@@ -0,0 +1,3 @@
+module pkg/signing
+
+go 1.23.7
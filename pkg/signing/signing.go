@@ -0,0 +1,176 @@
+// Package signing signs svc-b's responses with HMAC so svc-a can detect
+// tampering by intermediaries where mTLS isn't available. The signature covers
+// the request the response answers and when it was sent, so a response can't
+// be passed off as the answer to another request, or replayed later.
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the response signature as sha256=<hex>
+	SignatureHeader = "X-Signature"
+	// KeyIDHeader names the key the response was signed with
+	KeyIDHeader = "X-Signature-Key-Id"
+	// TimestampHeader carries when the response was signed, in Unix seconds
+	TimestampHeader = "X-Signature-Timestamp"
+
+	// MaxSkew is how far a signature's timestamp may be from the verifier's
+	// clock, covering clock drift and time in transit
+	MaxSkew = 5 * time.Minute
+
+	signaturePrefix = "sha256="
+)
+
+var (
+	ErrInvalidKeys      = errors.New("invalid signing keys")
+	ErrUnsigned         = errors.New("response is not signed")
+	ErrUnknownKey       = errors.New("response signed with an unknown key")
+	ErrInvalidSignature = errors.New("invalid response signature")
+	ErrStaleSignature   = errors.New("response signature timestamp out of range")
+)
+
+// Key is a shared HMAC secret identified by ID
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Keyring holds the current key, which signs, and optionally the previous
+// one. Both verify, so keys can be rotated by making the new key current on
+// the verifier, with the old one as previous, before signing with it.
+type Keyring struct {
+	Current  Key
+	Previous Key
+}
+
+// ParseKeys reads a comma-separated list of up to two id:secret pairs, current
+// key first, as injected by the secrets provider. An empty list disables
+// signing.
+func ParseKeys(raw string) (Keyring, error) {
+	var keys []Key
+	for _, pair := range strings.Split(raw, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || secret == "" {
+			return Keyring{}, fmt.Errorf("%w: expected id:secret", ErrInvalidKeys)
+		}
+		keys = append(keys, Key{ID: id, Secret: []byte(secret)})
+	}
+
+	switch len(keys) {
+	case 0:
+		return Keyring{}, nil
+	case 1:
+		return Keyring{Current: keys[0]}, nil
+	case 2:
+		if keys[0].ID == keys[1].ID {
+			return Keyring{}, fmt.Errorf("%w: current and previous keys share the id %q", ErrInvalidKeys, keys[0].ID)
+		}
+		return Keyring{Current: keys[0], Previous: keys[1]}, nil
+	default:
+		return Keyring{}, fmt.Errorf("%w: expected a current and at most one previous key", ErrInvalidKeys)
+	}
+}
+
+// Enabled reports whether the keyring holds a key
+func (k Keyring) Enabled() bool {
+	return k.Current.ID != ""
+}
+
+// IDs lists the key IDs, for reporting without revealing the secrets
+func (k Keyring) IDs() []string {
+	var ids []string
+	for _, key := range []Key{k.Current, k.Previous} {
+		if key.ID != "" {
+			ids = append(ids, key.ID)
+		}
+	}
+	return ids
+}
+
+// Message is a response as signed: the request it answers, by method, path
+// and raw query, and its status code and body. The path is the one svc-b
+// routes, without any prefix a gateway strips in front of it.
+type Message struct {
+	Method string
+	Path   string
+	Query  string
+	Status int
+	Body   []byte
+}
+
+// Sign signs msg at the given time with the current key, returning the
+// headers to send it with
+func (k Keyring) Sign(msg Message, at time.Time) http.Header {
+	header := make(http.Header)
+	if !k.Enabled() {
+		return header
+	}
+	timestamp := at.Unix()
+	header.Set(KeyIDHeader, k.Current.ID)
+	header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	header.Set(SignatureHeader, signaturePrefix+hex.EncodeToString(mac(k.Current.Secret, msg, timestamp)))
+	return header
+}
+
+// Verify checks the signature headers of a response against the key they
+// name, rejecting signatures made more than MaxSkew away from now
+func (k Keyring) Verify(header http.Header, msg Message, now time.Time) error {
+	keyID := header.Get(KeyIDHeader)
+	if keyID == "" {
+		return ErrUnsigned
+	}
+
+	var key Key
+	switch keyID {
+	case k.Current.ID:
+		key = k.Current
+	case k.Previous.ID:
+		key = k.Previous
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed timestamp", ErrInvalidSignature)
+	}
+	if skew := now.Sub(time.Unix(timestamp, 0)); skew > MaxSkew || skew < -MaxSkew {
+		return fmt.Errorf("%w: signed %v away from now", ErrStaleSignature, skew.Truncate(time.Second))
+	}
+
+	signature := header.Get(SignatureHeader)
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if err != nil || !strings.HasPrefix(signature, signaturePrefix) {
+		return fmt.Errorf("%w: malformed signature", ErrInvalidSignature)
+	}
+	if !hmac.Equal(got, mac(key.Secret, msg, timestamp)) {
+		return fmt.Errorf("%w: mismatch for key %q", ErrInvalidSignature, keyID)
+	}
+	return nil
+}
+
+// mac covers the request and the timestamp along with the status code and
+// body, so an error can't be passed off as a success, nor a response as the
+// answer to another request
+func mac(secret []byte, msg Message, timestamp int64) []byte {
+	h := hmac.New(sha256.New, secret)
+	for _, field := range []string{msg.Method, msg.Path, msg.Query, strconv.FormatInt(timestamp, 10), strconv.Itoa(msg.Status)} {
+		h.Write([]byte(field))
+		h.Write([]byte{'\n'})
+	}
+	h.Write(msg.Body)
+	return h.Sum(nil)
+}
@@ -0,0 +1,126 @@
+package signing
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseKeys(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		raw       string
+		expectIDs []string
+		expectErr bool
+	}{
+		{"Empty disables signing", "", nil, false},
+		{"Current key only", "k1:secret", []string{"k1"}, false},
+		{"Current key first", "k2:new-secret, k1:old-secret", []string{"k2", "k1"}, false},
+		{"Secret may contain colons", "k1:a:b", []string{"k1"}, false},
+		{"Missing secret", "k1", nil, true},
+		{"Missing id", ":secret", nil, true},
+		{"More than two keys", "k3:c,k2:b,k1:a", nil, true},
+		{"Same id twice", "k1:a,k1:b", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			keys, err := ParseKeys(tt.raw)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseKeys() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			ids := keys.IDs()
+			if len(ids) != len(tt.expectIDs) {
+				t.Fatalf("IDs() = %v, want %v", ids, tt.expectIDs)
+			}
+			for i := range ids {
+				if ids[i] != tt.expectIDs[i] {
+					t.Errorf("IDs() = %v, want %v", ids, tt.expectIDs)
+				}
+			}
+			if keys.Enabled() != (len(tt.expectIDs) > 0) {
+				t.Errorf("Enabled() = %v with keys %v", keys.Enabled(), ids)
+			}
+		})
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	oldKey := Key{ID: "k1", Secret: []byte("old-secret")}
+	newKey := Key{ID: "k2", Secret: []byte("new-secret")}
+	signer := Keyring{Current: newKey, Previous: oldKey}
+
+	msg := Message{
+		Method: http.MethodPost,
+		Path:   "/weather",
+		Query:  "resolve=city",
+		Status: http.StatusOK,
+		Body:   []byte(`{"city":"Rio de Janeiro","temp_C":25}`),
+	}
+	header := signer.Sign(msg, now)
+	if got := header.Get(KeyIDHeader); got != "k2" {
+		t.Fatalf("signed with %q, want the current key k2", got)
+	}
+
+	with := func(change func(m *Message)) Message {
+		changed := msg
+		change(&changed)
+		return changed
+	}
+
+	tests := []struct {
+		name     string
+		verifier Keyring
+		header   http.Header
+		msg      Message
+		now      time.Time
+		expected error
+	}{
+		{"Valid", signer, header, msg, now, nil},
+		{"Old key dropped after the rotation", Keyring{Current: newKey}, header, msg, now, nil},
+		{"Signed with the previous key", Keyring{Current: newKey, Previous: oldKey}, Keyring{Current: oldKey}.Sign(msg, now), msg, now, nil},
+		{"Within the allowed skew", signer, header, msg, now.Add(MaxSkew), nil},
+		{"Tampered body", signer, header, with(func(m *Message) { m.Body = []byte(`{"city":"Rio de Janeiro","temp_C":35}`) }), now, ErrInvalidSignature},
+		{"Tampered status", signer, header, with(func(m *Message) { m.Status = http.StatusInternalServerError }), now, ErrInvalidSignature},
+		{"Answer to another method", signer, header, with(func(m *Message) { m.Method = http.MethodGet }), now, ErrInvalidSignature},
+		{"Answer to another path", signer, header, with(func(m *Message) { m.Path = "/weather/batch" }), now, ErrInvalidSignature},
+		{"Answer to another query", signer, header, with(func(m *Message) { m.Query = "resolve=cep" }), now, ErrInvalidSignature},
+		{"Replayed later", signer, header, msg, now.Add(MaxSkew + time.Second), ErrStaleSignature},
+		{"Signed in the future", signer, header, msg, now.Add(-MaxSkew - time.Second), ErrStaleSignature},
+		{"Key not yet rolled out", Keyring{Current: oldKey}, header, msg, now, ErrUnknownKey},
+		{"Same id, wrong secret", Keyring{Current: Key{ID: "k2", Secret: []byte("guess")}}, header, msg, now, ErrInvalidSignature},
+		{"Unsigned", signer, http.Header{}, msg, now, ErrUnsigned},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.verifier.Verify(tt.header, tt.msg, tt.now); !errors.Is(err, tt.expected) {
+				t.Errorf("Verify() = %v, want %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsTamperedTimestamp(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	keys := Keyring{Current: Key{ID: "k1", Secret: []byte("secret")}}
+	msg := Message{Method: http.MethodPost, Path: "/weather", Status: http.StatusOK, Body: []byte(`{}`)}
+
+	header := keys.Sign(msg, now.Add(-time.Hour))
+	header.Set(TimestampHeader, "1704110400")
+	if err := keys.Verify(header, msg, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() = %v, want ErrInvalidSignature for a refreshed timestamp", err)
+	}
+}
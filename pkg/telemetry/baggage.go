@@ -0,0 +1,82 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// baggagePrefix prefixes the span attributes and log keys baggage members are
+// recorded under, e.g. baggage.client_id
+const baggagePrefix = "baggage."
+
+// NewBaggageSpanProcessor records the listed baggage members of each span's
+// parent context on the span, as baggage.<key> attributes, so a service's
+// spans can be sliced by values set upstream
+func NewBaggageSpanProcessor(keys []string) sdktrace.SpanProcessor {
+	return baggageSpanProcessor{keys: keys}
+}
+
+type baggageSpanProcessor struct {
+	keys []string
+}
+
+func (p baggageSpanProcessor) OnStart(parent context.Context, span sdktrace.ReadWriteSpan) {
+	span.SetAttributes(baggageAttributes(parent, p.keys)...)
+}
+
+func (baggageSpanProcessor) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (baggageSpanProcessor) Shutdown(context.Context) error   { return nil }
+func (baggageSpanProcessor) ForceFlush(context.Context) error { return nil }
+
+// WithBaggage wraps logger so records logged with a context carry its listed
+// baggage members, as baggage.<key>
+func WithBaggage(logger *slog.Logger, keys []string) *slog.Logger {
+	if len(keys) == 0 {
+		return logger
+	}
+	return slog.New(baggageHandler{Handler: logger.Handler(), keys: keys})
+}
+
+type baggageHandler struct {
+	slog.Handler
+	keys []string
+}
+
+func (h baggageHandler) Handle(ctx context.Context, record slog.Record) error {
+	for _, attr := range baggageAttributes(ctx, h.keys) {
+		record.AddAttrs(slog.String(string(attr.Key), attr.Value.AsString()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h baggageHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return baggageHandler{Handler: h.Handler.WithAttrs(attrs), keys: h.keys}
+}
+
+func (h baggageHandler) WithGroup(name string) slog.Handler {
+	return baggageHandler{Handler: h.Handler.WithGroup(name), keys: h.keys}
+}
+
+// baggageAttributes are the listed members of the context's baggage
+func baggageAttributes(ctx context.Context, keys []string) []attribute.KeyValue {
+	bag := baggage.FromContext(ctx)
+	if bag.Len() == 0 {
+		return nil
+	}
+	var attrs []attribute.KeyValue
+	for _, key := range keys {
+		if member := bag.Member(key); member.Key() != "" {
+			attrs = append(attrs, baggageAttribute(key, member.Value()))
+		}
+	}
+	return attrs
+}
+
+// baggageAttribute records a baggage member as baggage.<key>
+func baggageAttribute(key, value string) attribute.KeyValue {
+	return attribute.String(baggagePrefix+key, value)
+}
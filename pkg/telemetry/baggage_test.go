@@ -0,0 +1,69 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"pkg/telemetry/telemetrytest"
+
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// withTestBaggage sets client_id and secret baggage members on a context
+func withTestBaggage(t *testing.T) context.Context {
+	t.Helper()
+	clientID, _ := baggage.NewMemberRaw("client_id", "mobile-app")
+	secret, _ := baggage.NewMemberRaw("secret", "not-listed")
+	bag, err := baggage.New(clientID, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return baggage.ContextWithBaggage(context.Background(), bag)
+}
+
+func TestBaggageSpanProcessorRecordsListedMembers(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := telemetrytest.NewTracerProvider(t,
+		sdktrace.WithSpanProcessor(NewBaggageSpanProcessor([]string{"client_id", "request_id"})),
+		sdktrace.WithSpanProcessor(recorder),
+	)
+	_, span := provider.Tracer("test").Start(withTestBaggage(t), "GET /weather/{cep}")
+	span.End()
+
+	attrs := make(map[string]string)
+	for _, attr := range recorder.Ended()[0].Attributes() {
+		attrs[string(attr.Key)] = attr.Value.AsString()
+	}
+	expected := map[string]string{"baggage.client_id": "mobile-app"}
+	if len(attrs) != len(expected) || attrs["baggage.client_id"] != "mobile-app" {
+		t.Errorf("span attributes = %v, want %v", attrs, expected)
+	}
+}
+
+func TestWithBaggageLogsListedMembers(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, LogFormatJSON, "info")
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	WithBaggage(logger, []string{"client_id"}).With("service", "test").InfoContext(withTestBaggage(t), "Lookup done")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["baggage.client_id"] != "mobile-app" || record["service"] != "test" {
+		t.Errorf("record = %v, want baggage.client_id and the logger's attributes", record)
+	}
+	if _, ok := record["baggage.secret"]; ok {
+		t.Errorf("record = %v, want unlisted members left out", record)
+	}
+}
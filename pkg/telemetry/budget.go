@@ -0,0 +1,153 @@
+package telemetry
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// truncatedSuffix marks a string attribute value cut to fit the budget
+const truncatedSuffix = "...[truncated]"
+
+// Indicator attributes added to spans whose attributes were cut
+const (
+	AttributesTruncatedKey = attribute.Key("otel.attributes.truncated")
+	AttributesDroppedKey   = attribute.Key("otel.attributes.dropped")
+)
+
+// AttributeBudget bounds the attributes exported per span; zero fields are unlimited
+type AttributeBudget struct {
+	MaxAttributes  int
+	MaxValueLength int
+}
+
+// Apply caps the number of attributes and the length of string values,
+// reporting whether anything was cut. Cut attribute sets carry
+// AttributesTruncatedKey, and AttributesDroppedKey when attributes were
+// dropped; both count towards MaxAttributes.
+func (b AttributeBudget) Apply(attrs []attribute.KeyValue) ([]attribute.KeyValue, bool) {
+	truncated := false
+	bounded := make([]attribute.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		if value, ok := b.truncateValue(kv.Value); ok {
+			kv.Value = value
+			truncated = true
+		}
+		bounded = append(bounded, kv)
+	}
+
+	if !truncated && (b.MaxAttributes <= 0 || len(attrs) <= b.MaxAttributes) {
+		return attrs, false
+	}
+
+	// Once anything is cut the truncation indicator needs a slot. Making room
+	// for it drops an attribute, and dropping needs a second slot for the count.
+	dropped := 0
+	if b.MaxAttributes > 0 && len(bounded)+1 > b.MaxAttributes {
+		keep := max(b.MaxAttributes-2, 0)
+		dropped = len(bounded) - keep
+		bounded = bounded[:keep]
+	}
+
+	bounded = append(bounded, AttributesTruncatedKey.Bool(true))
+	if dropped > 0 && len(bounded) < b.MaxAttributes {
+		bounded = append(bounded, AttributesDroppedKey.Int(dropped))
+	}
+	return bounded, true
+}
+
+func (b AttributeBudget) truncateValue(value attribute.Value) (attribute.Value, bool) {
+	if b.MaxValueLength <= 0 {
+		return value, false
+	}
+
+	switch value.Type() {
+	case attribute.STRING:
+		if s, ok := b.truncateString(value.AsString()); ok {
+			return attribute.StringValue(s), true
+		}
+	case attribute.STRINGSLICE:
+		values := value.AsStringSlice()
+		changed := false
+		for i, v := range values {
+			if s, ok := b.truncateString(v); ok {
+				values[i] = s
+				changed = true
+			}
+		}
+		if changed {
+			return attribute.StringSliceValue(values), true
+		}
+	}
+	return value, false
+}
+
+// truncateString cuts s to MaxValueLength bytes on a rune boundary
+func (b AttributeBudget) truncateString(s string) (string, bool) {
+	if len(s) <= b.MaxValueLength {
+		return s, false
+	}
+
+	cut := b.MaxValueLength
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + truncatedSuffix, true
+}
+
+// budgetExporter enforces an AttributeBudget on spans and their events before
+// handing them to the wrapped exporter
+type budgetExporter struct {
+	next   sdktrace.SpanExporter
+	budget AttributeBudget
+}
+
+// NewBudgetExporter wraps next so exported spans stay within budget
+func NewBudgetExporter(next sdktrace.SpanExporter, budget AttributeBudget) sdktrace.SpanExporter {
+	return &budgetExporter{next: next, budget: budget}
+}
+
+func (e *budgetExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	bounded := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		bounded[i] = e.bound(span)
+	}
+	return e.next.ExportSpans(ctx, bounded)
+}
+
+func (e *budgetExporter) Shutdown(ctx context.Context) error {
+	return e.next.Shutdown(ctx)
+}
+
+// boundedSpan is an exported span with its attributes and events replaced by
+// their bounded copies
+type boundedSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs  []attribute.KeyValue
+	events []sdktrace.Event
+}
+
+func (s boundedSpan) Attributes() []attribute.KeyValue { return s.attrs }
+
+func (s boundedSpan) Events() []sdktrace.Event { return s.events }
+
+// bound returns the span unchanged when it fits the budget, or a bounded copy
+func (e *budgetExporter) bound(span sdktrace.ReadOnlySpan) sdktrace.ReadOnlySpan {
+	attrs, changed := e.budget.Apply(span.Attributes())
+
+	events := span.Events()
+	boundedEvents := make([]sdktrace.Event, len(events))
+	for i, event := range events {
+		eventAttrs, eventChanged := e.budget.Apply(event.Attributes)
+		event.Attributes = eventAttrs
+		boundedEvents[i] = event
+		changed = changed || eventChanged
+	}
+
+	if !changed {
+		return span
+	}
+	return boundedSpan{ReadOnlySpan: span, attrs: attrs, events: boundedEvents}
+}
@@ -0,0 +1,148 @@
+package telemetry
+
+import (
+	"context"
+	"pkg/telemetry/telemetrytest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestAttributeBudgetApply(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		budget   AttributeBudget
+		attrs    []attribute.KeyValue
+		expected []attribute.KeyValue
+		changed  bool
+	}{
+		{
+			name:     "Within budget",
+			budget:   AttributeBudget{MaxAttributes: 2, MaxValueLength: 8},
+			attrs:    []attribute.KeyValue{attribute.String("cep", "22450000"), attribute.Int("attempts", 1)},
+			expected: []attribute.KeyValue{attribute.String("cep", "22450000"), attribute.Int("attempts", 1)},
+		},
+		{
+			name:   "Long value",
+			budget: AttributeBudget{MaxAttributes: 2, MaxValueLength: 8},
+			attrs:  []attribute.KeyValue{attribute.String("body", "0123456789")},
+			expected: []attribute.KeyValue{
+				attribute.String("body", "01234567"+truncatedSuffix),
+				AttributesTruncatedKey.Bool(true),
+			},
+			changed: true,
+		},
+		{
+			name:   "Multibyte value cut on a rune boundary",
+			budget: AttributeBudget{MaxValueLength: 8},
+			attrs:  []attribute.KeyValue{attribute.String("city", "São Paulo!")},
+			expected: []attribute.KeyValue{
+				attribute.String("city", "São Pau"+truncatedSuffix),
+				AttributesTruncatedKey.Bool(true),
+			},
+			changed: true,
+		},
+		{
+			name:   "Too many attributes",
+			budget: AttributeBudget{MaxAttributes: 4},
+			attrs: []attribute.KeyValue{
+				attribute.Int("a", 1), attribute.Int("b", 2), attribute.Int("c", 3), attribute.Int("d", 4), attribute.Int("e", 5),
+			},
+			expected: []attribute.KeyValue{
+				attribute.Int("a", 1), attribute.Int("b", 2),
+				AttributesTruncatedKey.Bool(true), AttributesDroppedKey.Int(3),
+			},
+			changed: true,
+		},
+		{
+			name:   "Long value in a full set drops an attribute for the indicators",
+			budget: AttributeBudget{MaxAttributes: 3, MaxValueLength: 8},
+			attrs: []attribute.KeyValue{
+				attribute.String("body", "0123456789"), attribute.Int("b", 2), attribute.Int("c", 3),
+			},
+			expected: []attribute.KeyValue{
+				attribute.String("body", "01234567"+truncatedSuffix),
+				AttributesTruncatedKey.Bool(true), AttributesDroppedKey.Int(2),
+			},
+			changed: true,
+		},
+		{
+			name:     "Budget of one keeps only the truncation indicator",
+			budget:   AttributeBudget{MaxAttributes: 1},
+			attrs:    []attribute.KeyValue{attribute.Int("a", 1), attribute.Int("b", 2)},
+			expected: []attribute.KeyValue{AttributesTruncatedKey.Bool(true)},
+			changed:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, changed := tt.budget.Apply(tt.attrs)
+			if changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+			if attribute.NewSet(got...) != attribute.NewSet(tt.expected...) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+			if tt.budget.MaxAttributes > 0 && len(got) > tt.budget.MaxAttributes {
+				t.Errorf("got %d attributes, want at most %d", len(got), tt.budget.MaxAttributes)
+			}
+		})
+	}
+}
+
+func TestBudgetExporterBoundsSpans(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := telemetrytest.NewTracerProvider(t, sdktrace.WithSyncer(
+		NewBudgetExporter(exporter, AttributeBudget{MaxAttributes: 3, MaxValueLength: 16}),
+	))
+
+	_, span := tp.Tracer("test").Start(context.Background(), "CallServiceB")
+	span.SetAttributes(
+		attribute.String("response.body", strings.Repeat("x", 1024)),
+		attribute.String("cep", "22450000"),
+		attribute.Int("attempts", 1),
+	)
+	span.AddEvent("retry", trace.WithAttributes(attribute.String("error", strings.Repeat("y", 64))))
+	span.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+
+	if len(spans[0].Attributes) > 3 {
+		t.Errorf("got %d attributes, want the indicators within the budget of 3", len(spans[0].Attributes))
+	}
+	attrs := attribute.NewSet(spans[0].Attributes...)
+	if body, _ := attrs.Value("response.body"); body.AsString() != strings.Repeat("x", 16)+truncatedSuffix {
+		t.Errorf("response.body = %q, want it cut to the budget", body.AsString())
+	}
+	if attrs.HasValue("cep") || attrs.HasValue("attempts") {
+		t.Error("expected attributes beyond the budget to be dropped")
+	}
+	if dropped, _ := attrs.Value(AttributesDroppedKey); dropped.AsInt64() != 2 {
+		t.Errorf("dropped indicator = %d, want 2", dropped.AsInt64())
+	}
+	if truncated, _ := attrs.Value(AttributesTruncatedKey); !truncated.AsBool() {
+		t.Error("expected the truncation indicator on the span")
+	}
+
+	if len(spans[0].Events) != 1 {
+		t.Fatalf("got %d events, want 1", len(spans[0].Events))
+	}
+	event := attribute.NewSet(spans[0].Events[0].Attributes...)
+	if msg, _ := event.Value("error"); msg.AsString() != strings.Repeat("y", 16)+truncatedSuffix {
+		t.Errorf("event error = %q, want it cut to the budget", msg.AsString())
+	}
+}
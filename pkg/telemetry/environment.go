@@ -0,0 +1,53 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// SpanNamePrefix is the prefix of the environment in spec, comma-separated
+// environment=prefix pairs (e.g. "staging=stg:,development=dev:"), or "" for
+// an environment without one
+func SpanNamePrefix(spec, environment string) (string, error) {
+	var prefix string
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		env, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || env == "" || value == "" {
+			return "", fmt.Errorf("invalid span name prefix %q, want environment=prefix", pair)
+		}
+		if env == environment {
+			prefix = value
+		}
+	}
+	return prefix, nil
+}
+
+// prefixExporter prefixes the names of the spans it exports. Spans keep their
+// names in process, where processors and samplers match on them.
+type prefixExporter struct {
+	sdktrace.SpanExporter
+	prefix string
+}
+
+func (e prefixExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	prefixed := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		prefixed[i] = prefixedSpan{ReadOnlySpan: span, name: e.prefix + span.Name()}
+	}
+	return e.SpanExporter.ExportSpans(ctx, prefixed)
+}
+
+type prefixedSpan struct {
+	sdktrace.ReadOnlySpan
+	name string
+}
+
+func (s prefixedSpan) Name() string {
+	return s.name
+}
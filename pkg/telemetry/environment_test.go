@@ -0,0 +1,63 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"pkg/telemetry/telemetrytest"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSpanNamePrefix(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		spec        string
+		environment string
+		expected    string
+		expectErr   bool
+	}{
+		{"No prefixes", "", "staging", "", false},
+		{"Environment with a prefix", "staging=stg:, development=dev:", "staging", "stg:", false},
+		{"Environment without one", "staging=stg:", "production", "", false},
+		{"Malformed pair", "staging", "staging", "", true},
+		{"Empty prefix", "staging=", "staging", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			prefix, err := SpanNamePrefix(tt.spec, tt.environment)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("SpanNamePrefix() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if prefix != tt.expected {
+				t.Errorf("SpanNamePrefix() = %q, want %q", prefix, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPrefixExporterOnlyRenamesExportedSpans(t *testing.T) {
+	t.Parallel()
+
+	exported := tracetest.NewInMemoryExporter()
+	recorder := tracetest.NewSpanRecorder()
+	provider := telemetrytest.NewTracerProvider(t,
+		sdktrace.WithSyncer(prefixExporter{SpanExporter: exported, prefix: "stg:"}),
+		sdktrace.WithSpanProcessor(recorder),
+	)
+	_, span := provider.Tracer("test").Start(context.Background(), "GET /weather")
+	span.End()
+
+	if got := exported.GetSpans()[0].Name; got != "stg:GET /weather" {
+		t.Errorf("exported span name = %q, want stg:GET /weather", got)
+	}
+	if got := recorder.Ended()[0].Name(); got != "GET /weather" {
+		t.Errorf("in-process span name = %q, want GET /weather", got)
+	}
+}
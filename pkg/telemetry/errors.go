@@ -0,0 +1,50 @@
+package telemetry
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxExportErrors is how many SDK errors RecentExportErrors keeps
+const maxExportErrors = 20
+
+// ExportError is an error reported by the OpenTelemetry SDK, typically a span
+// or metric export that didn't reach the collector
+type ExportError struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// errorLog is the SDK error handler installed by Init: it logs each error and
+// keeps the last ones for diagnostics
+type errorLog struct {
+	mu      sync.Mutex
+	entries []ExportError
+}
+
+var exportErrors = &errorLog{}
+
+func (l *errorLog) Handle(err error) {
+	slog.Warn("OpenTelemetry error", "error", err)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, ExportError{Time: time.Now().UTC(), Error: err.Error()})
+	if len(l.entries) > maxExportErrors {
+		l.entries = l.entries[len(l.entries)-maxExportErrors:]
+	}
+}
+
+// RecentExportErrors returns the last errors reported by the SDK since Init,
+// newest first
+func RecentExportErrors() []ExportError {
+	exportErrors.mu.Lock()
+	defer exportErrors.mu.Unlock()
+
+	recent := make([]ExportError, len(exportErrors.entries))
+	for i, entry := range exportErrors.entries {
+		recent[len(recent)-1-i] = entry
+	}
+	return recent
+}
@@ -0,0 +1,30 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+// TestRecentExportErrors swaps the global error handler, so it doesn't run in
+// parallel
+func TestRecentExportErrors(t *testing.T) {
+	otel.SetErrorHandler(exportErrors)
+
+	for i := range maxExportErrors + 5 {
+		otel.Handle(fmt.Errorf("export %d: %w", i, errors.New("connection refused")))
+	}
+
+	recent := RecentExportErrors()
+	if len(recent) != maxExportErrors {
+		t.Fatalf("got %d errors, want the last %d", len(recent), maxExportErrors)
+	}
+	if want := fmt.Sprintf("export %d: connection refused", maxExportErrors+4); recent[0].Error != want {
+		t.Errorf("newest error = %q, want %q", recent[0].Error, want)
+	}
+	if recent[len(recent)-1].Error != "export 5: connection refused" {
+		t.Errorf("oldest error = %q, want export 5", recent[len(recent)-1].Error)
+	}
+}
@@ -0,0 +1,55 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Span exporters selectable through TRACES_EXPORTER
+const (
+	ExporterZipkin   = "zipkin"
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterStdout   = "stdout"
+)
+
+// NewSpanExporter creates the span exporter of the given type. The OTLP
+// exporters take their endpoint, headers and TLS settings from the standard
+// OTEL_EXPORTER_OTLP_* environment variables.
+func NewSpanExporter(ctx context.Context, exporterType, zipkinURL string) (sdktrace.SpanExporter, error) {
+	switch exporterType {
+	case ExporterZipkin:
+		exporter, err := zipkin.New(zipkinURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Zipkin exporter: %w", err)
+		}
+		return exporter, nil
+	case ExporterOTLPGRPC:
+		exporter, err := otlptracegrpc.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP gRPC exporter: %w", err)
+		}
+		return exporter, nil
+	case ExporterOTLPHTTP:
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP HTTP exporter: %w", err)
+		}
+		return exporter, nil
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		return exporter, nil
+	default:
+		return nil, fmt.Errorf("unknown TRACES_EXPORTER %q: want zipkin, otlp-grpc, otlp-http or stdout", exporterType)
+	}
+}
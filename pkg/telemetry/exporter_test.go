@@ -0,0 +1,111 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewSpanExporter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		exporterType string
+		expectErr    bool
+	}{
+		{ExporterZipkin, false},
+		{ExporterOTLPGRPC, false},
+		{ExporterOTLPHTTP, false},
+		{ExporterStdout, false},
+		{"jaeger", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.exporterType, func(t *testing.T) {
+			t.Parallel()
+
+			exporter, err := NewSpanExporter(context.Background(), tt.exporterType, "http://zipkin:9411/api/v2/spans")
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("NewSpanExporter(%q) error = %v, expectErr %v", tt.exporterType, err, tt.expectErr)
+			}
+			if exporter != nil {
+				exporter.Shutdown(context.Background())
+			}
+		})
+	}
+}
+
+func TestInitRejectsUnknownExporter(t *testing.T) {
+	t.Parallel()
+
+	if _, err := Init(context.Background(), Config{ServiceName: "test", ExporterType: "jaeger"}); err == nil {
+		t.Error("Init accepted an unknown exporter type")
+	}
+}
+
+func TestNewMetricReader(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		exporterType string
+		expectReader bool
+		expectErr    bool
+	}{
+		{"", false, false},
+		{ExporterNone, false, false},
+		{ExporterOTLPGRPC, true, false},
+		{ExporterOTLPHTTP, true, false},
+		{ExporterStdout, true, false},
+		{"prometheus", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.exporterType, func(t *testing.T) {
+			t.Parallel()
+
+			reader, err := NewMetricReader(context.Background(), tt.exporterType)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("NewMetricReader(%q) error = %v, expectErr %v", tt.exporterType, err, tt.expectErr)
+			}
+			if (reader != nil) != tt.expectReader {
+				t.Errorf("NewMetricReader(%q) reader = %v, expectReader %v", tt.exporterType, reader, tt.expectReader)
+			}
+			if reader != nil {
+				reader.Shutdown(context.Background())
+			}
+		})
+	}
+}
+
+func TestNewLogExporter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		exporterType   string
+		expectExporter bool
+		expectErr      bool
+	}{
+		{"", false, false},
+		{ExporterNone, false, false},
+		{ExporterOTLPGRPC, true, false},
+		{ExporterOTLPHTTP, true, false},
+		{ExporterStdout, true, false},
+		{"loki", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.exporterType, func(t *testing.T) {
+			t.Parallel()
+
+			exporter, err := NewLogExporter(context.Background(), tt.exporterType)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("NewLogExporter(%q) error = %v, expectErr %v", tt.exporterType, err, tt.expectErr)
+			}
+			if (exporter != nil) != tt.expectExporter {
+				t.Errorf("NewLogExporter(%q) exporter = %v, expectExporter %v", tt.exporterType, exporter, tt.expectExporter)
+			}
+			if exporter != nil {
+				exporter.Shutdown(context.Background())
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand/v2"
+	"sync"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewSeededIDGenerator generates the same sequence of trace and span IDs for
+// the same seed and service, so demo environments and golden trace tests see
+// stable IDs. Services sharing a seed still get different span IDs. IDs only
+// repeat across runs when spans start in the same order, so tests relying on
+// them shouldn't start spans concurrently.
+func NewSeededIDGenerator(seed int64, serviceName string) sdktrace.IDGenerator {
+	h := fnv.New64a()
+	h.Write([]byte(serviceName))
+	return &seededIDGenerator{rand: rand.New(rand.NewPCG(uint64(seed), h.Sum64()))}
+}
+
+type seededIDGenerator struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (g *seededIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var traceID trace.TraceID
+	for !traceID.IsValid() {
+		binary.BigEndian.PutUint64(traceID[:8], g.rand.Uint64())
+		binary.BigEndian.PutUint64(traceID[8:], g.rand.Uint64())
+	}
+	return traceID, g.spanID()
+}
+
+func (g *seededIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.spanID()
+}
+
+// spanID draws the next non-zero span ID, with g.mu held
+func (g *seededIDGenerator) spanID() trace.SpanID {
+	var spanID trace.SpanID
+	for !spanID.IsValid() {
+		binary.BigEndian.PutUint64(spanID[:], g.rand.Uint64())
+	}
+	return spanID
+}
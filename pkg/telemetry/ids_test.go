@@ -0,0 +1,62 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"pkg/telemetry/telemetrytest"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// topology starts a request span with two child spans and returns the
+// parent span ID of each ended span, keyed by its own
+func topology(t *testing.T, generator sdktrace.IDGenerator) map[string]string {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	tracer := telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder), sdktrace.WithIDGenerator(generator)).Tracer("test")
+
+	ctx, span := tracer.Start(context.Background(), "GET /weather/{cep}")
+	for _, name := range []string{"ViaCEP.GetAddressByCEP", "WeatherAPI.GetTemperature"} {
+		_, child := tracer.Start(ctx, name)
+		child.End()
+	}
+	span.End()
+
+	parents := make(map[string]string)
+	for _, ended := range recorder.Ended() {
+		parents[ended.SpanContext().TraceID().String()+"/"+ended.SpanContext().SpanID().String()] = ended.Parent().SpanID().String()
+	}
+	return parents
+}
+
+func TestSeededIDGenerator(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		other      sdktrace.IDGenerator
+		expectSame bool
+	}{
+		{"Same seed and service", NewSeededIDGenerator(42, "svc-b"), true},
+		{"Other seed", NewSeededIDGenerator(43, "svc-b"), false},
+		{"Other service", NewSeededIDGenerator(42, "svc-a"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			expected := topology(t, NewSeededIDGenerator(42, "svc-b"))
+			got := topology(t, tt.other)
+			same := len(got) == len(expected)
+			for id, parent := range expected {
+				same = same && got[id] == parent
+			}
+			if same != tt.expectSame {
+				t.Errorf("IDs %v, want them the same as %v: %v", got, expected, tt.expectSame)
+			}
+		})
+	}
+}
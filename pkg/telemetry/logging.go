@@ -0,0 +1,79 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log formats accepted by NewLogger
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// NewLogger creates a structured logger writing records in format (json or
+// text) at level (debug, info, warn or error) and above. Records logged with
+// a context carry the trace_id and span_id of its span, so log lines can be
+// looked up from a trace and the other way round.
+func NewLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	minLevel, err := ParseLogLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	var levelVar slog.LevelVar
+	levelVar.Set(minLevel)
+	return NewLeveledLogger(w, format, &levelVar)
+}
+
+// NewLeveledLogger is NewLogger at the level held by level, which may be
+// changed while the logger is in use, e.g. on a configuration reload
+func NewLeveledLogger(w io.Writer, format string, level *slog.LevelVar) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(w, options)
+	case LogFormatText:
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return nil, fmt.Errorf("unknown LOG_FORMAT %q: want json or text", format)
+	}
+	return slog.New(traceHandler{handler}), nil
+}
+
+// ParseLogLevel parses a LOG_LEVEL: debug, info, warn or error
+func ParseLogLevel(level string) (slog.Level, error) {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("unknown LOG_LEVEL %q: want debug, info, warn or error", level)
+	}
+	return minLevel, nil
+}
+
+// traceHandler adds the identifiers of the context's span to every record
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h traceHandler) Handle(ctx context.Context, record slog.Record) error {
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{h.Handler.WithGroup(name)}
+}
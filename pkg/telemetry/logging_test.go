@@ -0,0 +1,94 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewLoggerAddsTraceContext(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, LogFormatJSON, "info")
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	logger.With("service", "test").InfoContext(ctx, "Lookup done", "cep", "22450000")
+	logger.DebugContext(ctx, "Below the level")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+	expected := map[string]string{
+		"msg":      "Lookup done",
+		"level":    "INFO",
+		"service":  "test",
+		"cep":      "22450000",
+		"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"span_id":  "00f067aa0ba902b7",
+	}
+	for key, want := range expected {
+		if record[key] != want {
+			t.Errorf("%s = %v, want %q", key, record[key], want)
+		}
+	}
+}
+
+func TestNewLoggerRejectsUnknownSettings(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		format string
+		level  string
+	}{
+		{name: "Unknown format", format: "xml", level: "info"},
+		{name: "Unknown level", format: LogFormatText, level: "verbose"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := NewLogger(&bytes.Buffer{}, tt.format, tt.level); err == nil {
+				t.Errorf("NewLogger(%q, %q) accepted invalid settings", tt.format, tt.level)
+			}
+		})
+	}
+}
+
+func TestNewLeveledLoggerFollowsLevelChanges(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	var level slog.LevelVar
+	level.Set(slog.LevelWarn)
+	logger, err := NewLeveledLogger(&buf, LogFormatJSON, &level)
+	if err != nil {
+		t.Fatalf("NewLeveledLogger() error = %v", err)
+	}
+
+	logger.Info("Below the level")
+	level.Set(slog.LevelInfo)
+	logger.Info("At the level")
+
+	if strings.Contains(buf.String(), "Below the level") || !strings.Contains(buf.String(), "At the level") {
+		t.Errorf("logged %q, want only the record at the changed level", buf.String())
+	}
+}
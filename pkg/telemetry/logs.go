@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+// NewLogExporter creates the log exporter of the given type, or nil for none.
+// The OTLP exporters take their endpoint, headers and TLS settings from the
+// standard OTEL_EXPORTER_OTLP_* environment variables.
+func NewLogExporter(ctx context.Context, exporterType string) (sdklog.Exporter, error) {
+	var (
+		exporter sdklog.Exporter
+		err      error
+	)
+	switch exporterType {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterOTLPGRPC:
+		exporter, err = otlploggrpc.New(ctx)
+	case ExporterOTLPHTTP:
+		exporter, err = otlploghttp.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdoutlog.New(stdoutlog.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown LOGS_EXPORTER %q: want none, otlp-grpc, otlp-http or stdout", exporterType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s log exporter: %w", exporterType, err)
+	}
+	return exporter, nil
+}
+
+// WithOTelLogs wraps logger so its records are also emitted through the
+// OpenTelemetry log bridge, to the logger provider Init installs. The bridge
+// takes the trace and span of each record's context, so the backend links
+// logs and traces without trace_id attributes. Records below logger's level
+// are dropped for both, and the bridge drops all of them unless Init
+// installed a logger provider, so services may wrap their logger before Init.
+func WithOTelLogs(logger *slog.Logger, name string) *slog.Logger {
+	return withBridge(logger, otelslog.NewHandler(name))
+}
+
+func withBridge(logger *slog.Logger, bridge slog.Handler) *slog.Logger {
+	return slog.New(teeHandler{primary: logger.Handler(), bridge: bridge})
+}
+
+// teeHandler hands the records its primary handler takes to the bridge too
+type teeHandler struct {
+	primary slog.Handler
+	bridge  slog.Handler
+}
+
+func (h teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.primary.Enabled(ctx, level)
+}
+
+func (h teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	err := h.primary.Handle(ctx, record.Clone())
+	if h.bridge.Enabled(ctx, record.Level) {
+		err = errors.Join(err, h.bridge.Handle(ctx, record))
+	}
+	return err
+}
+
+func (h teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return teeHandler{primary: h.primary.WithAttrs(attrs), bridge: h.bridge.WithAttrs(attrs)}
+}
+
+func (h teeHandler) WithGroup(name string) slog.Handler {
+	return teeHandler{primary: h.primary.WithGroup(name), bridge: h.bridge.WithGroup(name)}
+}
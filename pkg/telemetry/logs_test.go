@@ -0,0 +1,73 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"pkg/telemetry/telemetrytest"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+// recordingExporter keeps the log records it is handed
+type recordingExporter struct {
+	mu      sync.Mutex
+	records []sdklog.Record
+}
+
+func (e *recordingExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, record := range records {
+		e.records = append(e.records, record.Clone())
+	}
+	return nil
+}
+
+func (e *recordingExporter) Shutdown(context.Context) error   { return nil }
+func (e *recordingExporter) ForceFlush(context.Context) error { return nil }
+
+func TestWithOTelLogsExportsCorrelatedRecords(t *testing.T) {
+	t.Parallel()
+
+	exporter := &recordingExporter{}
+	provider := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(exporter)))
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, LogFormatJSON, "info")
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	logger = withBridge(logger, otelslog.NewHandler("test", otelslog.WithLoggerProvider(provider))).With("service", "test")
+
+	ctx, span := telemetrytest.NewTracerProvider(t).Tracer("test").Start(context.Background(), "GET /weather/{cep}")
+	logger.InfoContext(ctx, "Lookup done", "cep", "01001000")
+	logger.DebugContext(ctx, "Below the level")
+	span.End()
+
+	if !strings.Contains(buf.String(), `"msg":"Lookup done"`) || strings.Contains(buf.String(), "Below the level") {
+		t.Errorf("stderr log = %s, want the info record only", buf.String())
+	}
+	if len(exporter.records) != 1 {
+		t.Fatalf("exported %d records, want 1", len(exporter.records))
+	}
+	record := exporter.records[0]
+	if record.Body().AsString() != "Lookup done" || record.Severity() != log.SeverityInfo {
+		t.Errorf("exported %q at severity %v, want Lookup done at info", record.Body().AsString(), record.Severity())
+	}
+	if record.TraceID() != span.SpanContext().TraceID() || record.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("exported record in trace %s span %s, want the span's", record.TraceID(), record.SpanID())
+	}
+	attrs := make(map[string]string)
+	record.WalkAttributes(func(kv log.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.AsString()
+		return true
+	})
+	if attrs["service"] != "test" || attrs["cep"] != "01001000" {
+		t.Errorf("exported attributes = %v, want the logger's and the record's", attrs)
+	}
+}
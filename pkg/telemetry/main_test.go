@@ -0,0 +1,13 @@
+package telemetry
+
+import (
+	"os"
+	"testing"
+
+	"pkg/telemetry/telemetrytest"
+)
+
+// TestMain exports the spans tests record when run with -otel.export
+func TestMain(m *testing.M) {
+	os.Exit(telemetrytest.Main(m))
+}
@@ -0,0 +1,42 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// ExporterNone disables pushing metrics; readers given in Config still work
+const ExporterNone = "none"
+
+// NewMetricReader creates a periodic reader pushing to the metric exporter of
+// the given type, or nil for none. The OTLP exporters take their endpoint,
+// headers, TLS settings and export interval from the standard OTEL_EXPORTER_OTLP_*
+// and OTEL_METRIC_EXPORT_INTERVAL environment variables.
+func NewMetricReader(ctx context.Context, exporterType string) (sdkmetric.Reader, error) {
+	var (
+		exporter sdkmetric.Exporter
+		err      error
+	)
+	switch exporterType {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterOTLPGRPC:
+		exporter, err = otlpmetricgrpc.New(ctx)
+	case ExporterOTLPHTTP:
+		exporter, err = otlpmetrichttp.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdoutmetric.New(stdoutmetric.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown METRICS_EXPORTER %q: want none, otlp-grpc, otlp-http or stdout", exporterType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s metric exporter: %w", exporterType, err)
+	}
+	return sdkmetric.NewPeriodicReader(exporter), nil
+}
@@ -0,0 +1,70 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// observeScope is the instrumentation scope of the metrics recorded through
+// a Recorder
+const observeScope = "pkg/telemetry/observe"
+
+// Recorder records business metrics by name, creating each instrument on
+// first use, so handlers can add metrics without declaring instruments. A
+// name is either a histogram or a counter, not both.
+type Recorder struct {
+	meter      metric.Meter
+	histograms sync.Map // name -> metric.Float64Histogram
+	counters   sync.Map // name -> metric.Int64Counter
+}
+
+// NewRecorder creates a Recorder on the given meter provider
+func NewRecorder(provider metric.MeterProvider) *Recorder {
+	return &Recorder{meter: provider.Meter(observeScope, MeterOptions()...)}
+}
+
+// Observe records value in the histogram called name. ctx carries the
+// request's span, which the SDK keeps as the measurement's exemplar when it
+// is sampled.
+func (r *Recorder) Observe(ctx context.Context, name string, value float64, attrs ...attribute.KeyValue) {
+	r.histogram(name, "").Record(ctx, value, metric.WithAttributes(attrs...))
+}
+
+// ObserveDuration records d in milliseconds in the histogram called name
+//
+//	recorder.ObserveDuration(ctx, "weather.lookup.duration", time.Since(start), attribute.String("uf", uf))
+func (r *Recorder) ObserveDuration(ctx context.Context, name string, d time.Duration, attrs ...attribute.KeyValue) {
+	r.histogram(name, "ms").Record(ctx, float64(d.Microseconds())/1000, metric.WithAttributes(attrs...))
+}
+
+// Add adds n to the counter called name, e.g. lookups per UF or provider
+// calls saved by a cache
+func (r *Recorder) Add(ctx context.Context, name string, n int64, attrs ...attribute.KeyValue) {
+	counter, ok := r.counters.Load(name)
+	if !ok {
+		created, err := r.meter.Int64Counter(name)
+		if err != nil {
+			slog.Warn("Invalid counter", "name", name, "error", err)
+		}
+		counter, _ = r.counters.LoadOrStore(name, created)
+	}
+	counter.(metric.Int64Counter).Add(ctx, n, metric.WithAttributes(attrs...))
+}
+
+func (r *Recorder) histogram(name, unit string) metric.Float64Histogram {
+	histogram, ok := r.histograms.Load(name)
+	if !ok {
+		created, err := r.meter.Float64Histogram(name, metric.WithUnit(unit))
+		if err != nil {
+			// The SDK still returns a working instrument alongside the error
+			slog.Warn("Invalid histogram", "name", name, "error", err)
+		}
+		histogram, _ = r.histograms.LoadOrStore(name, created)
+	}
+	return histogram.(metric.Float64Histogram)
+}
@@ -0,0 +1,69 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"pkg/telemetry/telemetrytest"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+
+	reader := sdkmetric.NewManualReader()
+	recorder := NewRecorder(sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithExemplarFilter(exemplar.TraceBasedFilter),
+	))
+
+	ctx, span := telemetrytest.NewTracerProvider(t).Tracer("test").Start(context.Background(), "GET /weather/{cep}")
+	recorder.ObserveDuration(ctx, "test.lookup.duration", 1500*time.Microsecond, attribute.String("uf", "SP"))
+	recorder.ObserveDuration(ctx, "test.lookup.duration", 2500*time.Microsecond, attribute.String("uf", "SP"))
+	recorder.Add(ctx, "test.lookups", 2, attribute.String("uf", "PE"))
+	recorder.Observe(ctx, "test.batch.size", 3)
+	span.End()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	metrics := make(map[string]metricdata.Metrics)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+
+	duration, ok := metrics["test.lookup.duration"].Data.(metricdata.Histogram[float64])
+	if !ok || len(duration.DataPoints) != 1 {
+		t.Fatalf("test.lookup.duration = %+v, want one histogram series", metrics["test.lookup.duration"])
+	}
+	point := duration.DataPoints[0]
+	if metrics["test.lookup.duration"].Unit != "ms" || point.Count != 2 || point.Sum != 4 {
+		t.Errorf("test.lookup.duration = %s count %d sum %v, want 2 measurements adding up to 4ms", metrics["test.lookup.duration"].Unit, point.Count, point.Sum)
+	}
+	if uf, _ := point.Attributes.Value("uf"); uf.AsString() != "SP" {
+		t.Errorf("attributes = %v, want uf=SP", point.Attributes)
+	}
+	traceID := span.SpanContext().TraceID()
+	if len(point.Exemplars) == 0 || !bytes.Equal(point.Exemplars[0].TraceID, traceID[:]) {
+		t.Errorf("exemplars = %+v, want the request's span", point.Exemplars)
+	}
+
+	lookups, ok := metrics["test.lookups"].Data.(metricdata.Sum[int64])
+	if !ok || len(lookups.DataPoints) != 1 || lookups.DataPoints[0].Value != 2 {
+		t.Errorf("test.lookups = %+v, want 2", metrics["test.lookups"])
+	}
+
+	size, ok := metrics["test.batch.size"].Data.(metricdata.Histogram[float64])
+	if !ok || len(size.DataPoints) != 1 || size.DataPoints[0].Sum != 3 || metrics["test.batch.size"].Unit != "" {
+		t.Errorf("test.batch.size = %+v, want a unitless 3", metrics["test.batch.size"])
+	}
+}
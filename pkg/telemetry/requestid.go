@@ -0,0 +1,58 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries a request's ID to and from clients
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey is the baggage member a request's ID travels between services
+// in, recorded on spans and logs as baggage.request_id
+const RequestIDKey = "request_id"
+
+// validRequestID keeps the request IDs clients send short and safe to log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// NewRequestID returns a random 128-bit request ID in hex
+func NewRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// RequestIDFromHeader returns the request's X-Request-ID when it is a valid
+// one, or a new ID
+func RequestIDFromHeader(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); validRequestID.MatchString(id) {
+		return id
+	}
+	return NewRequestID()
+}
+
+// RequestID returns the request ID in ctx's baggage, or ""
+func RequestID(ctx context.Context) string {
+	return baggage.FromContext(ctx).Member(RequestIDKey).Value()
+}
+
+// ContextWithRequestID sets id as ctx's request_id baggage member, keeping
+// the other members, and records it on ctx's span
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	trace.SpanFromContext(ctx).SetAttributes(baggageAttribute(RequestIDKey, id))
+	member, err := baggage.NewMemberRaw(RequestIDKey, id)
+	if err != nil {
+		return ctx
+	}
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
@@ -0,0 +1,68 @@
+package telemetry
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pkg/telemetry/telemetrytest"
+
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRequestIDFromHeader(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		header   string
+		expectID string
+	}{
+		{"Client ID is honored", "support-ticket-123", "support-ticket-123"},
+		{"Missing ID is generated", "", ""},
+		{"Unsafe ID is replaced", "abc\ninjected=1", ""},
+		{"Oversized ID is replaced", strings.Repeat("a", 129), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("GET", "/weather/01001000", nil)
+			req.Header.Set(RequestIDHeader, tt.header)
+			got := RequestIDFromHeader(req)
+			if tt.expectID != "" && got != tt.expectID {
+				t.Errorf("RequestIDFromHeader() = %q, want %q", got, tt.expectID)
+			}
+			if tt.expectID == "" && (len(got) != 32 || got == tt.header) {
+				t.Errorf("RequestIDFromHeader() = %q, want a new 32-digit ID", got)
+			}
+		})
+	}
+}
+
+func TestContextWithRequestID(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	ctx, span := telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(withTestBaggage(t), "GET /weather/{cep}")
+	ctx = ContextWithRequestID(ctx, "support-ticket-123")
+	span.End()
+
+	if got := RequestID(ctx); got != "support-ticket-123" {
+		t.Errorf("RequestID() = %q, want support-ticket-123", got)
+	}
+	if got := baggage.FromContext(ctx).Member("client_id").Value(); got != "mobile-app" {
+		t.Errorf("client_id = %q, want the other members kept", got)
+	}
+	attrs := recorder.Ended()[0].Attributes()
+	if len(attrs) != 1 || attrs[0] != baggageAttribute(RequestIDKey, "support-ticket-123") {
+		t.Errorf("span attributes = %v, want baggage.request_id", attrs)
+	}
+	if RequestID(context.Background()) != "" {
+		t.Error("RequestID() without baggage should be empty")
+	}
+}
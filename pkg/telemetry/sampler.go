@@ -0,0 +1,51 @@
+package telemetry
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// RatioSampler samples a ratio of the traces by trace ID, so every service
+// sampling the same ratio keeps the same traces. The ratio may be changed
+// while the tracer provider uses it, e.g. on a configuration reload.
+type RatioSampler struct {
+	current atomic.Pointer[ratioSampling]
+}
+
+type ratioSampling struct {
+	ratio   float64
+	sampler sdktrace.Sampler
+}
+
+// NewRatioSampler samples ratio (0 to 1) of the traces
+func NewRatioSampler(ratio float64) (*RatioSampler, error) {
+	s := &RatioSampler{}
+	if err := s.SetRatio(ratio); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetRatio samples ratio (0 to 1) of the traces started from now on
+func (s *RatioSampler) SetRatio(ratio float64) error {
+	if ratio < 0 || ratio > 1 {
+		return fmt.Errorf("invalid TRACE_SAMPLE_RATIO %v: want 0 to 1", ratio)
+	}
+	s.current.Store(&ratioSampling{ratio: ratio, sampler: sdktrace.TraceIDRatioBased(ratio)})
+	return nil
+}
+
+// Ratio is the ratio sampled
+func (s *RatioSampler) Ratio() float64 {
+	return s.current.Load().ratio
+}
+
+func (s *RatioSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	return s.current.Load().sampler.ShouldSample(p)
+}
+
+func (s *RatioSampler) Description() string {
+	return fmt.Sprintf("RatioSampler{%v}", s.Ratio())
+}
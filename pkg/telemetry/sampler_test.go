@@ -0,0 +1,38 @@
+package telemetry
+
+import (
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRatioSamplerSetRatio(t *testing.T) {
+	t.Parallel()
+
+	sampler, err := NewRatioSampler(1)
+	if err != nil {
+		t.Fatalf("NewRatioSampler() error = %v", err)
+	}
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	params := sdktrace.SamplingParameters{TraceID: traceID, Name: "GET /weather"}
+
+	if got := sampler.ShouldSample(params).Decision; got != sdktrace.RecordAndSample {
+		t.Errorf("decision at ratio 1 = %v, want RecordAndSample", got)
+	}
+	if err := sampler.SetRatio(0); err != nil {
+		t.Fatalf("SetRatio(0) error = %v", err)
+	}
+	if got := sampler.ShouldSample(params).Decision; got != sdktrace.Drop {
+		t.Errorf("decision at ratio 0 = %v, want Drop", got)
+	}
+
+	for _, ratio := range []float64{-0.1, 1.5} {
+		if err := sampler.SetRatio(ratio); err == nil {
+			t.Errorf("SetRatio(%v) accepted an invalid ratio", ratio)
+		}
+	}
+	if sampler.Ratio() != 0 {
+		t.Errorf("Ratio() = %v after invalid ratios, want 0 kept", sampler.Ratio())
+	}
+}
@@ -0,0 +1,58 @@
+package telemetry
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces the secrets SanitizeURL finds
+const Redacted = "REDACTED"
+
+// SecretQueryParams are the query parameters SanitizeURL redacts: the API key
+// parameters of the providers the services call and the common token names
+var SecretQueryParams = []string{"key", "appid", "api_key", "apikey", "token", "access_token"}
+
+// SanitizeURL returns raw fit for logs and spans: any password is masked and
+// the values of SecretQueryParams, compared case-insensitively, are redacted.
+// URLs that don't parse are redacted whole, as their secrets can't be found.
+func SanitizeURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return Redacted
+	}
+
+	query := parsed.Query()
+	redacted := false
+	for param := range query {
+		if isSecretParam(param) {
+			query[param] = []string{Redacted}
+			redacted = true
+		}
+	}
+	if redacted {
+		parsed.RawQuery = query.Encode()
+	}
+	return parsed.Redacted()
+}
+
+func isSecretParam(param string) bool {
+	for _, secret := range SecretQueryParams {
+		if strings.EqualFold(param, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// SanitizeError sanitizes, in place, the URL of the *url.Error in err's
+// chain, which net/http wraps transport errors in and whose message quotes
+// the URL, and returns err. Call it before wrapping err: fmt.Errorf copies
+// the message it wraps.
+func SanitizeError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = SanitizeURL(urlErr.URL)
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+package telemetry
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+
+	// The semantic conventions version is chosen here alone. Upgrading it is
+	// changing this import, then the attribute names schema_test.go pins for
+	// any the new version renamed.
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// SchemaURL identifies the semantic conventions version the resource and the
+// services' instrumentation scopes follow
+const SchemaURL = semconv.SchemaURL
+
+// Semantic convention attributes set by the services. They are declared here
+// rather than taken from semconv at each use, so an upgrade can't rename an
+// attribute unnoticed.
+var (
+	ServiceNameKey           = semconv.ServiceNameKey
+	DeploymentEnvironmentKey = semconv.DeploymentEnvironmentKey
+)
+
+// environmentKey is the environment attribute set before
+// DeploymentEnvironmentKey, kept for the queries filtering on it
+const environmentKey = attribute.Key("environment")
+
+// TracerOptions tags a tracer with SchemaURL, for the services' own spans
+func TracerOptions() []trace.TracerOption {
+	return []trace.TracerOption{trace.WithSchemaURL(SchemaURL)}
+}
+
+// MeterOptions tags a meter with SchemaURL, for the services' own metrics
+func MeterOptions() []metric.MeterOption {
+	return []metric.MeterOption{metric.WithSchemaURL(SchemaURL)}
+}
+
+// newResource describes the service and its environment, following SchemaURL
+func newResource(config Config) *resource.Resource {
+	attrs := []attribute.KeyValue{ServiceNameKey.String(config.ServiceName)}
+	if config.Environment != "" {
+		attrs = append(attrs, DeploymentEnvironmentKey.String(config.Environment), environmentKey.String(config.Environment))
+	}
+	return resource.NewWithAttributes(SchemaURL, append(attrs, config.Attributes...)...)
+}
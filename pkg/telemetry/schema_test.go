@@ -0,0 +1,61 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"pkg/telemetry/telemetrytest"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestSemanticConventionNames pins the names emitted for the semantic
+// convention attributes: dashboards and alerts query them, so a semconv
+// upgrade renaming one must be a deliberate change here
+func TestSemanticConventionNames(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		key      attribute.Key
+		expected string
+	}{
+		{ServiceNameKey, "service.name"},
+		{DeploymentEnvironmentKey, "deployment.environment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			t.Parallel()
+
+			if string(tt.key) != tt.expected {
+				t.Errorf("got %q, want %q", tt.key, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTelemetryFollowsSchema(t *testing.T) {
+	t.Parallel()
+
+	res := newResource(Config{ServiceName: "svc-test", Environment: "staging", Attributes: []attribute.KeyValue{attribute.String("region", "sa-east-1")}})
+	if res.SchemaURL() != SchemaURL {
+		t.Errorf("resource schema = %q, want %q", res.SchemaURL(), SchemaURL)
+	}
+	if name, ok := res.Set().Value("service.name"); !ok || name.AsString() != "svc-test" {
+		t.Errorf("resource service.name = %q, want svc-test", name.AsString())
+	}
+	for _, key := range []attribute.Key{DeploymentEnvironmentKey, environmentKey} {
+		if env, ok := res.Set().Value(key); !ok || env.AsString() != "staging" {
+			t.Errorf("resource %s = %q, want staging", key, env.AsString())
+		}
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	_, span := telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder)).Tracer("test", TracerOptions()...).Start(context.Background(), "test")
+	span.End()
+	if scope := recorder.Ended()[0].InstrumentationScope(); scope.SchemaURL != SchemaURL {
+		t.Errorf("span scope schema = %q, want %q", scope.SchemaURL, SchemaURL)
+	}
+}
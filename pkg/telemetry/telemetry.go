@@ -0,0 +1,154 @@
+// Package telemetry bootstraps OpenTelemetry tracing, metrics and logs for the
+// services in this repository, so a new service onboards with a single Init call
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// shutdownTimeout bounds flushing the pending spans and metrics on shutdown
+const shutdownTimeout = 5 * time.Second
+
+// Config describes a service's tracing and metrics setup
+type Config struct {
+	ServiceName string
+	// Environment is recorded on the resource as deployment.environment, and
+	// as environment for the queries predating it
+	Environment string
+	// SpanNamePrefixes, as environment=prefix pairs, prefixes the exported
+	// span names of the environments sharing a trace backend
+	SpanNamePrefixes string
+	// ExporterType selects the span exporter: zipkin, otlp-grpc, otlp-http or stdout
+	ExporterType string
+	// ZipkinURL is the collector endpoint for the zipkin exporter
+	ZipkinURL string
+	// Attributes are added to the resource next to the service name
+	Attributes []attribute.KeyValue
+	// Sampler decides which traces are recorded; nil samples everything
+	Sampler sdktrace.Sampler
+	// IDSeed, when not 0, makes the trace and span IDs a seeded sequence,
+	// stable across runs, for demos and golden trace tests
+	IDSeed int64
+	// WrapExporter optionally decorates the exporter, e.g. to bound span payloads
+	WrapExporter func(sdktrace.SpanExporter) sdktrace.SpanExporter
+	// SpanProcessors run next to the exporting processor, e.g. to derive
+	// attributes from the spans of a request
+	SpanProcessors []sdktrace.SpanProcessor
+	// MetricsExporter pushes metrics: none, otlp-grpc, otlp-http or stdout
+	MetricsExporter string
+	// MetricReaders are added to the meter provider, e.g. a Prometheus exporter
+	MetricReaders []sdkmetric.Reader
+	// LogsExporter exports the records of the loggers wrapped by WithOTelLogs:
+	// none, otlp-grpc, otlp-http or stdout
+	LogsExporter string
+}
+
+// Init installs a tracer provider, a meter provider and, unless LogsExporter
+// is none, a logger provider built from config as the global providers, along
+// with the W3C trace context and baggage propagators and an error handler
+// keeping the SDK's last errors for RecentExportErrors. The returned shutdown
+// flushes pending spans, metrics and logs.
+func Init(ctx context.Context, config Config) (func(), error) {
+	exporter, err := NewSpanExporter(ctx, config.ExporterType, config.ZipkinURL)
+	if err != nil {
+		return nil, err
+	}
+	if config.WrapExporter != nil {
+		exporter = config.WrapExporter(exporter)
+	}
+	prefix, err := SpanNamePrefix(config.SpanNamePrefixes, config.Environment)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" {
+		exporter = prefixExporter{SpanExporter: exporter, prefix: prefix}
+	}
+
+	readers := config.MetricReaders
+	reader, err := NewMetricReader(ctx, config.MetricsExporter)
+	if err != nil {
+		return nil, err
+	}
+	if reader != nil {
+		readers = append(readers, reader)
+	}
+	logExporter, err := NewLogExporter(ctx, config.LogsExporter)
+	if err != nil {
+		return nil, err
+	}
+
+	sampler := config.Sampler
+	if sampler == nil {
+		sampler = sdktrace.AlwaysSample()
+	}
+
+	res := newResource(config)
+
+	tracerOptions := []sdktrace.TracerProviderOption{
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	}
+	if config.IDSeed != 0 {
+		tracerOptions = append(tracerOptions, sdktrace.WithIDGenerator(NewSeededIDGenerator(config.IDSeed, config.ServiceName)))
+	}
+	for _, processor := range config.SpanProcessors {
+		tracerOptions = append(tracerOptions, sdktrace.WithSpanProcessor(processor))
+	}
+	tracerProvider := sdktrace.NewTracerProvider(tracerOptions...)
+
+	// Measurements taken in a sampled span keep it as their exemplar, linking
+	// metrics to traces
+	meterOptions := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+		sdkmetric.WithExemplarFilter(exemplar.TraceBasedFilter),
+	}
+	for _, reader := range readers {
+		meterOptions = append(meterOptions, sdkmetric.WithReader(reader))
+	}
+	meterProvider := sdkmetric.NewMeterProvider(meterOptions...)
+
+	var loggerProvider *sdklog.LoggerProvider
+	if logExporter != nil {
+		loggerProvider = sdklog.NewLoggerProvider(
+			sdklog.WithResource(res),
+			sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
+		)
+		global.SetLoggerProvider(loggerProvider)
+	}
+
+	otel.SetErrorHandler(exportErrors)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetMeterProvider(meterProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			slog.Error("Error shutting down tracer provider", "error", err)
+		}
+		if err := meterProvider.Shutdown(ctx); err != nil {
+			slog.Error("Error shutting down meter provider", "error", err)
+		}
+		if loggerProvider != nil {
+			if err := loggerProvider.Shutdown(ctx); err != nil {
+				slog.Error("Error shutting down logger provider", "error", err)
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,127 @@
+// Package telemetrytest exports the spans recorded by a package's tests when
+// they run with -otel.export, so new instrumentation can be inspected without
+// wiring an exporter into each test:
+//
+//	go test ./handlers -run TestWeather -otel.export=stdout
+//	go test ./handlers -otel.export=/tmp/spans.json
+//
+// OTEL_TEST_EXPORT sets the same target for every package, e.g. for go test ./...
+package telemetrytest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ExportEnv sets the -otel.export default
+const ExportEnv = "OTEL_TEST_EXPORT"
+
+// TestNameKey is the attribute exported spans carry the name of their test under
+const TestNameKey = attribute.Key("test.name")
+
+var export = flag.String("otel.export", os.Getenv(ExportEnv), "export the spans recorded by tests to stdout or to the given file")
+
+// exporting is the processor spans are exported through, nil unless -otel.export is set
+var exporting sdktrace.SpanProcessor
+
+// Main runs the tests of a package from its TestMain, exporting their spans
+// when -otel.export is set. Spans recorded through the global tracer
+// provider are exported too.
+func Main(m *testing.M) int {
+	flag.Parse()
+	stop, err := start(*export)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "telemetrytest: %v\n", err)
+		return 2
+	}
+	code := m.Run()
+	if err := stop(); err != nil {
+		fmt.Fprintf(os.Stderr, "telemetrytest: %v\n", err)
+	}
+	return code
+}
+
+// start sets up exporting to target: stdout, a file path, or nothing when empty
+func start(target string) (func() error, error) {
+	if target == "" {
+		return func() error { return nil }, nil
+	}
+
+	var w io.Writer = os.Stdout
+	var closeFile func() error
+	if target != "stdout" {
+		file, err := os.Create(target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create span export file: %w", err)
+		}
+		w, closeFile = file, file.Close
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(w), stdouttrace.WithPrettyPrint())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+	}
+
+	// Spans are exported as they end, so a failing or panicking test still
+	// leaves its spans behind
+	exporting = sdktrace.NewSimpleSpanProcessor(exporter)
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(exporting)))
+	return func() error {
+		err := exporting.Shutdown(context.Background())
+		exporting = nil
+		if closeFile != nil {
+			if closeErr := closeFile(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// NewTracerProvider is sdktrace.NewTracerProvider for tests: with -otel.export
+// set, it also exports the spans it records, tagged with the test's name
+func NewTracerProvider(t testing.TB, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	t.Helper()
+	if exporting != nil {
+		opts = append(opts, sdktrace.WithSpanProcessor(testProcessor{name: t.Name(), next: exporting}))
+	}
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+// testProcessor hands a test's ended spans to the shared exporting
+// processor. It leaves shutting that down to Main, as tests shut their own
+// providers down.
+type testProcessor struct {
+	name string
+	next sdktrace.SpanProcessor
+}
+
+func (testProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p testProcessor) OnEnd(span sdktrace.ReadOnlySpan) {
+	p.next.OnEnd(namedSpan{ReadOnlySpan: span, name: p.name})
+}
+
+func (testProcessor) Shutdown(context.Context) error { return nil }
+
+func (p testProcessor) ForceFlush(ctx context.Context) error { return p.next.ForceFlush(ctx) }
+
+// namedSpan adds the test's name to the exported attributes only, so tests
+// asserting on a span's attributes see what they recorded
+type namedSpan struct {
+	sdktrace.ReadOnlySpan
+	name string
+}
+
+func (s namedSpan) Attributes() []attribute.KeyValue {
+	return append(slices.Clip(s.ReadOnlySpan.Attributes()), TestNameKey.String(s.name))
+}
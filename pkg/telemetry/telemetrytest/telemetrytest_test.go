@@ -0,0 +1,55 @@
+package telemetrytest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Not parallel: it sets up the package-wide exporting processor
+func TestNewTracerProviderExportsTaggedSpans(t *testing.T) {
+	if exporting != nil {
+		t.Skip("spans are already being exported with -otel.export")
+	}
+	path := filepath.Join(t.TempDir(), "spans.json")
+	stop, err := start(path)
+	if err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))
+	_, span := provider.Tracer("test").Start(context.Background(), "GET /weather/{cep}")
+	span.End()
+	provider.Shutdown(context.Background())
+
+	if err := stop(); err != nil {
+		t.Fatalf("stop() error = %v", err)
+	}
+	exported, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(exported), `"GET /weather/{cep}"`) || !strings.Contains(string(exported), t.Name()) {
+		t.Errorf("exported spans = %s, want the span tagged with %s", exported, t.Name())
+	}
+	if attrs := recorder.Ended()[0].Attributes(); len(attrs) != 0 {
+		t.Errorf("recorded attributes = %v, want the test name left out", attrs)
+	}
+}
+
+func TestNewTracerProviderWithoutExport(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	_, span := NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "test")
+	span.End()
+	if len(recorder.Ended()) != 1 {
+		t.Errorf("recorded %d spans, want 1", len(recorder.Ended()))
+	}
+}
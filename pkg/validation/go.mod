@@ -0,0 +1,3 @@
+module pkg/validation
+
+go 1.23.7
@@ -0,0 +1,126 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Actions a deployment sets for an enabled CEP rule
+const (
+	ActionReject = "reject"
+	ActionFlag   = "flag"
+)
+
+// Codes of the CEPs Correios reserves, which resolve to an organization or a
+// post office rather than to a street
+const (
+	CodeCEPLargeCustomer = "cep_reserved_large_customer"
+	CodeCEPPromotional   = "cep_reserved_promotional"
+	CodeCEPPostalUnit    = "cep_reserved_postal_unit"
+)
+
+var (
+	ErrUnknownCEPRule   = errors.New("unknown CEP rule")
+	ErrInvalidCEPAction = errors.New("invalid CEP rule action")
+)
+
+// CEPRule checks a normalized CEP, returning the failure of a CEP it objects to
+type CEPRule func(cep string) *Error
+
+// CEPRules are the rules deployments enable by name in ParseCEPRules
+var CEPRules = map[string]CEPRule{
+	"reserved_ranges": ReservedRanges,
+}
+
+// ReservedRanges objects to the CEPs whose suffix (the last three digits)
+// Correios keeps out of street addressing: 900-959 for large customers, such
+// as companies and public bodies receiving much mail, 960-969 for
+// promotional campaigns and 970-999 for post offices and community boxes
+func ReservedRanges(cep string) *Error {
+	suffix, err := strconv.Atoi(cep[len(cep)-3:])
+	if err != nil {
+		return nil
+	}
+	switch {
+	case suffix >= 970:
+		return &Error{Code: CodeCEPPostalUnit, Message: "cep is reserved for a post office"}
+	case suffix >= 960:
+		return &Error{Code: CodeCEPPromotional, Message: "cep is reserved for a promotional campaign"}
+	case suffix >= 900:
+		return &Error{Code: CodeCEPLargeCustomer, Message: "cep is reserved for a large customer"}
+	default:
+		return nil
+	}
+}
+
+// CEPValidator validates CEPs with NormalizeCEP and then the rules a
+// deployment enabled. A nil CEPValidator only normalizes.
+type CEPValidator struct {
+	rules []enabledRule
+}
+
+type enabledRule struct {
+	name   string
+	rule   CEPRule
+	action string
+}
+
+// NewCEPValidator returns a validator without rules
+func NewCEPValidator() *CEPValidator {
+	return &CEPValidator{}
+}
+
+// Register enables rule under name, rejecting or flagging the CEPs it objects to
+func (v *CEPValidator) Register(name string, rule CEPRule, action string) *CEPValidator {
+	v.rules = append(v.rules, enabledRule{name: name, rule: rule, action: action})
+	return v
+}
+
+// ParseCEPRules enables the named CEPRules from comma-separated name=action
+// pairs, e.g. "reserved_ranges=flag". An empty spec enables none and returns
+// nil.
+func ParseCEPRules(spec string) (*CEPValidator, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	v := NewCEPValidator()
+	for _, pair := range strings.Split(spec, ",") {
+		name, action, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		rule, ok := CEPRules[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownCEPRule, name)
+		}
+		if action != ActionReject && action != ActionFlag {
+			return nil, fmt.Errorf("%w for %s: %q, want reject or flag", ErrInvalidCEPAction, name, action)
+		}
+		v.Register(name, rule, action)
+	}
+	return v, nil
+}
+
+// Validate normalizes raw like NormalizeCEP and runs the rules. The first
+// rejecting rule objecting to the CEP fails it; the codes of the flagging
+// ones are returned, sorted.
+func (v *CEPValidator) Validate(raw string) (cep string, flags []string, err error) {
+	cep, err = NormalizeCEP(raw)
+	if err != nil || v == nil {
+		return cep, nil, err
+	}
+
+	for _, rule := range v.rules {
+		failure := rule.rule(cep)
+		if failure == nil {
+			continue
+		}
+		if rule.action == ActionReject {
+			return "", nil, failure
+		}
+		flags = append(flags, failure.Code)
+	}
+	sort.Strings(flags)
+	return cep, flags, nil
+}
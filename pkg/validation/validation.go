@@ -0,0 +1,109 @@
+// Package validation validates the input shared by the services in this
+// repository and reports failures as RFC 7807 problem details, so clients get
+// the same error body whichever service rejected their request
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// ProblemContentType is the media type of problem details (RFC 7807)
+const ProblemContentType = "application/problem+json"
+
+// Error codes carried in Problem.Code, stable for clients to branch on
+const (
+	CodeCEPRequired          = "cep_required"
+	CodeCEPInvalidCharacters = "cep_invalid_characters"
+	CodeCEPInvalidLength     = "cep_invalid_length"
+)
+
+// Error is a validation failure with its error code
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	ErrCEPRequired          = &Error{Code: CodeCEPRequired, Message: "cep is required"}
+	ErrCEPInvalidCharacters = &Error{Code: CodeCEPInvalidCharacters, Message: "cep must only contain digits, optionally as 00000-000"}
+	ErrCEPInvalidLength     = &Error{Code: CodeCEPInvalidLength, Message: "cep must have 8 digits"}
+)
+
+// NormalizeCEP returns the eight digits of a CEP, accepting the forms clients
+// commonly send: 01001000, 01001-000 and 01.001-000, with surrounding or
+// inner whitespace. Letters and other symbols are rejected.
+func NormalizeCEP(raw string) (string, error) {
+	var digits strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '-' || r == '.' || unicode.IsSpace(r):
+		default:
+			return "", ErrCEPInvalidCharacters
+		}
+	}
+
+	switch digits.Len() {
+	case 0:
+		return "", ErrCEPRequired
+	case 8:
+		return digits.String(), nil
+	default:
+		return "", ErrCEPInvalidLength
+	}
+}
+
+// Problem is an RFC 7807 problem details body. Error repeats the short
+// message of the {"error": ...} bodies the services answered before, for the
+// clients still reading it.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+	Error  string `json:"error"`
+	// TraceURL links to the request's trace, like in the services' other
+	// error bodies
+	TraceURL string `json:"trace_url,omitempty"`
+}
+
+// NewProblem describes a failure answered with status. Problems are not
+// documented at a URL of their own, so Type is about:blank and Title the
+// status text, as RFC 7807 prescribes; Code tells them apart.
+func NewProblem(status int, code, summary, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Error:  summary,
+	}
+}
+
+// CEPProblem describes an invalid CEP: a 422 with the failure's code
+func CEPProblem(err error) Problem {
+	code := "cep_invalid"
+	var validationErr *Error
+	if errors.As(err, &validationErr) {
+		code = validationErr.Code
+	}
+	return NewProblem(http.StatusUnprocessableEntity, code, "invalid zipcode", err.Error())
+}
+
+// WriteProblem writes problem as the response
+func WriteProblem(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
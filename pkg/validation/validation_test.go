@@ -0,0 +1,140 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizeCEP(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw         string
+		expected    string
+		expectedErr error
+	}{
+		{"01001000", "01001000", nil},
+		{"01001-000", "01001000", nil},
+		{"01.001-000", "01001000", nil},
+		{" 01001-000\n", "01001000", nil},
+		{"", "", ErrCEPRequired},
+		{" - ", "", ErrCEPRequired},
+		{"123", "", ErrCEPInvalidLength},
+		{"010010001", "", ErrCEPInvalidLength},
+		{"2245000a", "", ErrCEPInvalidCharacters},
+		{"01001/000", "", ErrCEPInvalidCharacters},
+		{"０１００１０００", "", ErrCEPInvalidCharacters},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := NormalizeCEP(tt.raw)
+			if got != tt.expected || !errors.Is(err, tt.expectedErr) {
+				t.Errorf("NormalizeCEP(%q) = %q, %v; want %q, %v", tt.raw, got, err, tt.expected, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	t.Parallel()
+
+	rec := httptest.NewRecorder()
+	WriteProblem(rec, CEPProblem(ErrCEPInvalidLength))
+
+	var problem Problem
+	if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+		t.Fatalf("decoding the problem: %v", err)
+	}
+	expected := Problem{
+		Type:   "about:blank",
+		Title:  "Unprocessable Entity",
+		Status: http.StatusUnprocessableEntity,
+		Detail: "cep must have 8 digits",
+		Code:   CodeCEPInvalidLength,
+		Error:  "invalid zipcode",
+	}
+	if rec.Code != http.StatusUnprocessableEntity || rec.Header().Get("Content-Type") != ProblemContentType || problem != expected {
+		t.Errorf("WriteProblem() = %d %s %+v, want %+v", rec.Code, rec.Header().Get("Content-Type"), problem, expected)
+	}
+}
+
+func TestCEPValidator(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		spec          string
+		raw           string
+		expectedCEP   string
+		expectedFlags []string
+		expectedCode  string
+	}{
+		{"No rules", "", "01310-900", "01310900", nil, ""},
+		{"Street CEP", "reserved_ranges=reject", "01310-100", "01310100", nil, ""},
+		{"Large customer rejected", "reserved_ranges=reject", "01310-900", "", nil, CodeCEPLargeCustomer},
+		{"Promotional flagged", "reserved_ranges=flag", "01310-965", "01310965", []string{CodeCEPPromotional}, ""},
+		{"Post office flagged", "reserved_ranges=flag", "01310-999", "01310999", []string{CodeCEPPostalUnit}, ""},
+		{"Normalization runs first", "reserved_ranges=reject", "0131", "", nil, CodeCEPInvalidLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			validator, err := ParseCEPRules(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseCEPRules(%q) error = %v", tt.spec, err)
+			}
+
+			cep, flags, err := validator.Validate(tt.raw)
+			code := ""
+			var validationErr *Error
+			if errors.As(err, &validationErr) {
+				code = validationErr.Code
+			}
+			if cep != tt.expectedCEP || code != tt.expectedCode || len(flags) != len(tt.expectedFlags) {
+				t.Fatalf("Validate(%q) = %q, %v, %v; want %q, %v, code %q", tt.raw, cep, flags, err, tt.expectedCEP, tt.expectedFlags, tt.expectedCode)
+			}
+			for i := range flags {
+				if flags[i] != tt.expectedFlags[i] {
+					t.Errorf("flags = %v, want %v", flags, tt.expectedFlags)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCEPRulesRejectsInvalidSpecs(t *testing.T) {
+	t.Parallel()
+
+	for spec, expected := range map[string]error{
+		"unknown=flag":         ErrUnknownCEPRule,
+		"reserved_ranges":      ErrInvalidCEPAction,
+		"reserved_ranges=warn": ErrInvalidCEPAction,
+	} {
+		if _, err := ParseCEPRules(spec); !errors.Is(err, expected) {
+			t.Errorf("ParseCEPRules(%q) error = %v, want %v", spec, err, expected)
+		}
+	}
+}
+
+func TestCEPValidatorCustomRule(t *testing.T) {
+	t.Parallel()
+
+	validator := NewCEPValidator().Register("capital", func(cep string) *Error {
+		if cep[0] == '0' {
+			return &Error{Code: "cep_capital", Message: "cep is in São Paulo"}
+		}
+		return nil
+	}, ActionFlag)
+
+	if _, flags, err := validator.Validate("01001-000"); err != nil || len(flags) != 1 || flags[0] != "cep_capital" {
+		t.Errorf("Validate() = %v, %v; want flag cep_capital", flags, err)
+	}
+}
@@ -0,0 +1,229 @@
+// Package capture records sanitized request/response pairs for later replay
+// against a candidate build, and compares response payloads by shape
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCapturedBodyBytes bounds the request and response bodies kept per record
+const maxCapturedBodyBytes = 64 << 10
+
+// droppedHeaders are never written to a capture: credentials, and trace
+// context that would be stale on replay
+var droppedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"X-Api-Key":           true,
+	"Traceparent":         true,
+	"Tracestate":          true,
+	"Baggage":             true,
+}
+
+// Record is one captured request and the response it got
+type Record struct {
+	Time     time.Time         `json:"time"`
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Query    string            `json:"query,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Body     string            `json:"body,omitempty"`
+	Status   int               `json:"status"`
+	Response string            `json:"response,omitempty"`
+}
+
+// Recorder appends captured records to a JSON lines file
+type Recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewRecorder opens the capture file for appending; an empty path disables
+// capturing and returns nil
+func NewRecorder(path string) (*Recorder, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+	return &Recorder{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// Middleware captures every request served by next
+func (c *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Keep a bounded copy of the body while leaving it readable for next
+		var body bytes.Buffer
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, &limitedWriter{buf: &body, limit: maxCapturedBodyBytes}), r.Body}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		rec := redactPII(Record{
+			Time:     time.Now().UTC(),
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Query:    r.URL.RawQuery,
+			Headers:  sanitizeHeaders(r.Header),
+			Body:     body.String(),
+			Status:   recorder.status,
+			Response: recorder.body.String(),
+		})
+		if err := c.Write(rec); err != nil {
+			slog.WarnContext(r.Context(), "Capture record dropped", "path", rec.Path, "error", err)
+		}
+	})
+}
+
+// Write appends a record to the capture file, so a Recorder is also a Sink
+func (c *Recorder) Write(rec Record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.encoder.Encode(rec); err != nil {
+		return fmt.Errorf("failed to write capture record: %w", err)
+	}
+	return nil
+}
+
+// Close closes the capture file
+func (c *Recorder) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.file.Close()
+}
+
+// ReadRecords parses a capture file
+func ReadRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	decoder := json.NewDecoder(r)
+	for {
+		var rec Record
+		if err := decoder.Decode(&rec); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse record %d: %w", len(records)+1, err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func sanitizeHeaders(header http.Header) map[string]string {
+	sanitized := make(map[string]string)
+	for name, values := range header {
+		if droppedHeaders[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		sanitized[name] = strings.Join(values, ", ")
+	}
+	return sanitized
+}
+
+// Shape describes the structure of a JSON payload, ignoring its values, so
+// responses can be compared across builds; fields in ignore are left out.
+// Payloads that aren't JSON are described as "text".
+func Shape(payload []byte, ignore ...string) string {
+	if len(bytes.TrimSpace(payload)) == 0 {
+		return "empty"
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return "text"
+	}
+
+	ignored := make(map[string]bool, len(ignore))
+	for _, field := range ignore {
+		ignored[field] = true
+	}
+	return shapeOf(v, ignored)
+}
+
+func shapeOf(v interface{}, ignored map[string]bool) string {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			if !ignored[key] {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		fields := make([]string, len(keys))
+		for i, key := range keys {
+			fields[i] = fmt.Sprintf("%q:%s", key, shapeOf(value[key], ignored))
+		}
+		return "{" + strings.Join(fields, ",") + "}"
+	case []interface{}:
+		if len(value) == 0 {
+			return "[]"
+		}
+		return "[" + shapeOf(value[0], ignored) + "]"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	default:
+		return "null"
+	}
+}
+
+// responseRecorder keeps a bounded copy of the response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if remaining := maxCapturedBodyBytes - r.body.Len(); remaining > 0 {
+		r.body.Write(p[:min(len(p), remaining)])
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// limitedWriter discards everything past limit bytes
+type limitedWriter struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if remaining := w.limit - w.buf.Len(); remaining > 0 {
+		w.buf.Write(p[:min(len(p), remaining)])
+	}
+	return len(p), nil
+}
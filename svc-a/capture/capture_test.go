@@ -0,0 +1,133 @@
+package capture
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorderCapturesSanitizedTraffic(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+
+	handler := recorder.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"cep":"22450000"}` {
+			t.Errorf("handler read body %q, want the original request body", body)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"city":"Rio de Janeiro","temp_C":25}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/weather?resolve=city", strings.NewReader(`{"cep":"22450000"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "secret-key")
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("failed to close recorder: %v", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read capture: %v", err)
+	}
+	for _, secret := range []string{"secret-key", "secret-token", "203.0.113.7", "22450000"} {
+		if strings.Contains(string(raw), secret) {
+			t.Errorf("capture leaks %q: %s", secret, raw)
+		}
+	}
+
+	records, err := ReadRecords(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("failed to parse capture: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+
+	rec := records[0]
+	if rec.Method != http.MethodPost || rec.Path != "/weather" || rec.Query != "resolve=city" {
+		t.Errorf("unexpected request line in %+v", rec)
+	}
+	if rec.Body != `{"cep":"22450***"}` || rec.Headers["Content-Type"] != "application/json" {
+		t.Errorf("request not captured with the CEP's region prefix: %+v", rec)
+	}
+	if rec.Status != http.StatusOK || rec.Response != `{"city":"Rio de Janeiro","temp_C":25}` {
+		t.Errorf("response not captured faithfully: %+v", rec)
+	}
+}
+
+func TestRecorderReportsWriteErrors(t *testing.T) {
+	t.Parallel()
+
+	recorder, err := NewRecorder(filepath.Join(t.TempDir(), "capture.jsonl"))
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("failed to close recorder: %v", err)
+	}
+
+	if err := recorder.Write(Record{Method: http.MethodGet, Path: "/weather"}); err == nil {
+		t.Error("Write() after Close() = nil, want the encoding error")
+	}
+}
+
+func TestShape(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		payload  string
+		ignore   []string
+		expected string
+	}{
+		{
+			name:     "Object with sorted keys",
+			payload:  `{"temp_C":25,"city":"Rio de Janeiro"}`,
+			expected: `{"city":string,"temp_C":number}`,
+		},
+		{
+			name:     "Ignored fields",
+			payload:  `{"error":"invalid zipcode","meta":{"attempts":2}}`,
+			ignore:   []string{"meta"},
+			expected: `{"error":string}`,
+		},
+		{
+			name:     "Nested arrays",
+			payload:  `{"items":[{"ok":true}],"empty":[],"missing":null}`,
+			expected: `{"empty":[],"items":[{"ok":bool}],"missing":null}`,
+		},
+		{
+			name:     "Not JSON",
+			payload:  "OK",
+			expected: "text",
+		},
+		{
+			name:     "Empty",
+			expected: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := Shape([]byte(tt.payload), tt.ignore...); got != tt.expected {
+				t.Errorf("Shape() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
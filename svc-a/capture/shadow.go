@@ -0,0 +1,272 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shadowQueueSize bounds the records waiting to be posted to an endpoint sink
+const shadowQueueSize = 256
+
+var (
+	ErrInvalidShadowRates = errors.New("invalid shadow sample rates")
+	ErrShadowSinkFull     = errors.New("shadow sink queue full")
+)
+
+// piiHeaders identify the client and are dropped from captures and shadow
+// records on top of droppedHeaders
+var piiHeaders = map[string]bool{
+	"X-Forwarded-For": true,
+	"X-Real-Ip":       true,
+	"Forwarded":       true,
+	"User-Agent":      true,
+}
+
+// Sink receives shadow records
+type Sink interface {
+	Write(rec Record) error
+	Close() error
+}
+
+// NewSink returns the sink target names: an http(s) URL records are posted
+// to, or a JSON lines file. An empty target disables the sink and returns nil.
+func NewSink(target string) (Sink, error) {
+	if target == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		if _, err := url.Parse(target); err != nil {
+			return nil, fmt.Errorf("invalid shadow sink URL: %w", err)
+		}
+		return NewEndpointSink(target, &http.Client{Timeout: 5 * time.Second}), nil
+	}
+	recorder, err := NewRecorder(target)
+	if err != nil {
+		return nil, err
+	}
+	return recorder, nil
+}
+
+// ParseRates parses the per-route sample rates of SHADOW_SAMPLE_RATES, e.g.
+// "/weather=0.01", each a fraction of the route's requests between 0 and 1
+func ParseRates(raw string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	for _, pair := range strings.Split(raw, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(pair, "=")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || !strings.HasPrefix(route, "/") || err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("%w: %q, want /route=fraction", ErrInvalidShadowRates, pair)
+		}
+		rates[strings.TrimSpace(route)] = rate
+	}
+	return rates, nil
+}
+
+// Shadow copies a sample of each route's sanitized requests and responses to
+// a debug sink, so real-world inputs can be analyzed offline. Like replay
+// captures, shadow records are stripped of PII: client address headers are
+// dropped and CEPs are cut to their five-digit region prefix.
+type Shadow struct {
+	rates map[string]float64
+	sink  Sink
+	// sample reports whether a request with the given rate is copied
+	sample func(rate float64) bool
+}
+
+// NewShadow samples the routes in rates, keyed by exact path, to sink
+func NewShadow(rates map[string]float64, sink Sink) *Shadow {
+	return &Shadow{
+		rates:  rates,
+		sink:   sink,
+		sample: func(rate float64) bool { return rand.Float64() < rate },
+	}
+}
+
+// Middleware copies the sampled requests served by next
+func (s *Shadow) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rate, ok := s.rates[r.URL.Path]
+		if !ok || !s.sample(rate) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body bytes.Buffer
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, &limitedWriter{buf: &body, limit: maxCapturedBodyBytes}), r.Body}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		rec := redactPII(Record{
+			Time:     time.Now().UTC(),
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Query:    r.URL.RawQuery,
+			Headers:  sanitizeHeaders(r.Header),
+			Body:     body.String(),
+			Status:   recorder.status,
+			Response: recorder.body.String(),
+		})
+		if err := s.sink.Write(rec); err != nil {
+			slog.WarnContext(r.Context(), "Shadow record dropped", "path", rec.Path, "error", err)
+		}
+	})
+}
+
+// Close flushes and closes the sink
+func (s *Shadow) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.sink.Close()
+}
+
+// redactPII applies the redaction rules shared by captures and shadow records
+// to a sanitized record
+func redactPII(rec Record) Record {
+	for name := range rec.Headers {
+		if piiHeaders[http.CanonicalHeaderKey(name)] {
+			delete(rec.Headers, name)
+		}
+	}
+	return rewriteCEPs(rec, maskCEP)
+}
+
+// Unmask fills the hidden digits of a record's CEPs with zeros, the region's
+// base CEP, so a replayed request passes validation like the captured one did
+func Unmask(rec Record) Record {
+	return rewriteCEPs(rec, func(cep string) string {
+		return strings.ReplaceAll(cep, "*", "0")
+	})
+}
+
+// rewriteCEPs rewrites the CEP in the query and in the request and response bodies
+func rewriteCEPs(rec Record, rewrite func(cep string) string) Record {
+	if query, err := url.ParseQuery(rec.Query); err == nil && query.Has("cep") {
+		query.Set("cep", rewrite(query.Get("cep")))
+		rec.Query = query.Encode()
+	}
+	rec.Body = rewriteJSONCEP(rec.Body, rewrite)
+	rec.Response = rewriteJSONCEP(rec.Response, rewrite)
+	return rec
+}
+
+// rewriteJSONCEP rewrites the top-level "cep" member of a JSON object; other
+// payloads are returned as they are
+func rewriteJSONCEP(payload string, rewrite func(cep string) string) string {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(payload), &object); err != nil {
+		return payload
+	}
+	var cep string
+	if err := json.Unmarshal(object["cep"], &cep); err != nil {
+		return payload
+	}
+	object["cep"], _ = json.Marshal(rewrite(cep))
+	rewritten, _ := json.Marshal(object)
+	return string(rewritten)
+}
+
+// maskCEP keeps the five digits naming a CEP's region and hides the suffix
+// that narrows it down to a street
+func maskCEP(cep string) string {
+	var digits strings.Builder
+	for _, r := range cep {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	if digits.Len() <= 5 {
+		return strings.Repeat("*", digits.Len())
+	}
+	return digits.String()[:5] + strings.Repeat("*", digits.Len()-5)
+}
+
+// EndpointSink posts shadow records as JSON to a debug endpoint from a
+// background goroutine, so a slow endpoint never delays responses; records
+// are dropped while the queue is full
+type EndpointSink struct {
+	url    string
+	client *http.Client
+	queue  chan Record
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewEndpointSink starts posting records to target
+func NewEndpointSink(target string, client *http.Client) *EndpointSink {
+	s := &EndpointSink{
+		url:    target,
+		client: client,
+		queue:  make(chan Record, shadowQueueSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write queues a record
+func (s *EndpointSink) Write(rec Record) error {
+	select {
+	case s.queue <- rec:
+		return nil
+	default:
+		return ErrShadowSinkFull
+	}
+}
+
+// Close posts the queued records and stops the sink
+func (s *EndpointSink) Close() error {
+	s.once.Do(func() { close(s.queue) })
+	<-s.done
+	return nil
+}
+
+func (s *EndpointSink) run() {
+	defer close(s.done)
+	for rec := range s.queue {
+		if err := s.post(rec); err != nil {
+			slog.Warn("Failed to post shadow record", "path", rec.Path, "error", err)
+		}
+	}
+}
+
+func (s *EndpointSink) post(rec Record) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("shadow sink returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package capture
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseRates(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		raw     string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{name: "empty", raw: "", want: map[string]float64{}},
+		{name: "routes", raw: "/weather=0.01, /limits=1", want: map[string]float64{"/weather": 0.01, "/limits": 1}},
+		{name: "missing rate", raw: "/weather", wantErr: true},
+		{name: "rate above one", raw: "/weather=2", wantErr: true},
+		{name: "relative route", raw: "weather=0.5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseRates(tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidShadowRates) {
+					t.Errorf("ParseRates(%q) error = %v, want ErrInvalidShadowRates", tt.raw, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRates(%q) error = %v", tt.raw, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseRates(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+			for route, rate := range tt.want {
+				if got[route] != rate {
+					t.Errorf("ParseRates(%q)[%s] = %v, want %v", tt.raw, route, got[route], rate)
+				}
+			}
+		})
+	}
+}
+
+func TestShadowCopiesSampledRoutesWithoutPII(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "shadow.jsonl")
+	sink, err := NewSink(path)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	shadow := NewShadow(map[string]float64{"/weather": 0.5}, sink)
+	shadow.sample = func(rate float64) bool { return rate > 0 }
+
+	handler := shadow.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Write([]byte(`{"city":"Rio de Janeiro","temp_C":25}`))
+	}))
+
+	for _, target := range []string{"/weather", "/limits"} {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"cep":"22450-000"}`))
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		req.Header.Set("X-API-Key", "secret-key")
+		req.Header.Set("Content-Type", "application/json")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err := shadow.Close(); err != nil {
+		t.Fatalf("failed to close shadow: %v", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read shadow records: %v", err)
+	}
+	for _, pii := range []string{"203.0.113.7", "secret-key", "22450000", "22450-000"} {
+		if strings.Contains(string(raw), pii) {
+			t.Errorf("shadow records leak %q: %s", pii, raw)
+		}
+	}
+
+	records, err := ReadRecords(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("failed to parse shadow records: %v", err)
+	}
+	if len(records) != 1 || records[0].Path != "/weather" {
+		t.Fatalf("records = %+v, want only the sampled /weather request", records)
+	}
+	rec := records[0]
+	if rec.Body != `{"cep":"22450***"}` {
+		t.Errorf("body = %s, want the CEP's region prefix", rec.Body)
+	}
+	if rec.Headers["Content-Type"] != "application/json" || rec.Response != `{"city":"Rio de Janeiro","temp_C":25}` {
+		t.Errorf("record = %+v, want the request's other headers and the response", rec)
+	}
+}
+
+func TestEndpointSinkPostsRecords(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		received []Record
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec Record
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			t.Errorf("failed to decode posted record: %v", err)
+		}
+		mu.Lock()
+		received = append(received, rec)
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	sink, err := NewSink(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	if err := sink.Write(Record{Method: http.MethodPost, Path: "/weather", Status: http.StatusOK}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	// Close waits for the queued records to be posted
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 || received[0].Path != "/weather" {
+		t.Errorf("received = %+v, want the /weather record", received)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"pkg/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Baggage members svc-a sets on its calls to service B, which records them
+// on its spans and logs
+const (
+	baggageClientID  = "client_id"
+	baggageRequestID = telemetry.RequestIDKey
+	baggageCEP       = "cep"
+)
+
+// baggageKeys are the members svc-a logs, as service B does
+var baggageKeys = []string{baggageClientID, baggageRequestID, baggageCEP}
+
+// clientIDHeader names the header clients identify themselves with
+const clientIDHeader = "X-Client-Id"
+
+// anonymousClient is the client_id of requests without a valid X-Client-Id
+const anonymousClient = "anonymous"
+
+// validClientID keeps client IDs short and safe to carry in baggage
+var validClientID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// withRequestBaggage replaces the baggage a client may have sent, which svc-a
+// doesn't trust, with its own members: the client's ID, the request ID set by
+// withRequestID (or a new one) and the CEP when the request is for a single
+// one. They are also recorded on the span of ctx.
+func withRequestBaggage(ctx context.Context, r *http.Request, cep string) context.Context {
+	requestID := telemetry.RequestID(ctx)
+	if requestID == "" {
+		requestID = telemetry.NewRequestID()
+	}
+	values := [][2]string{
+		{baggageClientID, clientID(r)},
+		{baggageRequestID, requestID},
+	}
+	if cep != "" {
+		values = append(values, [2]string{baggageCEP, cep})
+	}
+
+	members := make([]baggage.Member, 0, len(values))
+	for _, value := range values {
+		member, err := baggage.NewMemberRaw(value[0], value[1])
+		if err != nil {
+			continue
+		}
+		members = append(members, member)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("baggage."+value[0], value[1]))
+	}
+	bag, err := baggage.New(members...)
+	if err != nil {
+		return baggage.ContextWithoutBaggage(ctx)
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// clientID is the request's X-Client-Id, or anonymous
+func clientID(r *http.Request) string {
+	if id := r.Header.Get(clientIDHeader); validClientID.MatchString(id) {
+		return id
+	}
+	return anonymousClient
+}
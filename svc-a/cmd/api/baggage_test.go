@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+func TestWeatherRequestSetsBaggage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name             string
+		clientID         string
+		expectedClientID string
+	}{
+		{"Identified client", "mobile-app", "mobile-app"},
+		{"Anonymous client", "", anonymousClient},
+		{"Invalid client ID", "mobile app;secret=1", anonymousClient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			forwarded := make(chan string, 1)
+			serviceB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded <- r.Header.Get("baggage")
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"city":"Rio de Janeiro","temp_C":25,"temp_F":77,"temp_K":298.15}`))
+			}))
+			defer serviceB.Close()
+
+			app := newTestApp(t, testConfig(serviceB.URL+"/weather"))
+			req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"22450-000"}`))
+			req.Header.Set("baggage", "client_id=spoofed,tenant=other")
+			if tt.clientID != "" {
+				req.Header.Set(clientIDHeader, tt.clientID)
+			}
+			rr := httptest.NewRecorder()
+			app.setupRoutes().ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+			}
+			bag, err := baggage.Parse(<-forwarded)
+			if err != nil {
+				t.Fatalf("service B received invalid baggage: %v", err)
+			}
+			if got := bag.Member(baggageClientID).Value(); got != tt.expectedClientID {
+				t.Errorf("client_id = %q, want %q", got, tt.expectedClientID)
+			}
+			if got := bag.Member(baggageCEP).Value(); got != "22450000" {
+				t.Errorf("cep = %q, want the normalized CEP", got)
+			}
+			if got := bag.Member(baggageRequestID).Value(); len(got) != 32 {
+				t.Errorf("request_id = %q, want 32 hex digits", got)
+			}
+			if bag.Member("tenant").Key() != "" {
+				t.Errorf("baggage %q kept a member the client sent", bag.String())
+			}
+		})
+	}
+}
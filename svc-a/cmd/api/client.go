@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"pkg/signing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxServiceBResponseBytes caps how much of service B's response is buffered
+const maxServiceBResponseBytes = 1 << 20
+
+// apiKeyHeader carries the client's API key, forwarded to service B
+const apiKeyHeader = "X-API-Key"
+
+// cepFlagsHeader lists the CEP rules of service B flagging the CEP
+const cepFlagsHeader = "X-CEP-Flags"
+
+// serviceBRetryBaseDelay is multiplied by the attempt number between retries
+const serviceBRetryBaseDelay = 100 * time.Millisecond
+
+var (
+	errServiceBResponseTooLarge = errors.New("service B response exceeds size limit")
+	errServiceBSignatureInvalid = errors.New("service B response signature invalid")
+)
+
+// serviceBRequest holds what is forwarded to service B for a client request
+type serviceBRequest struct {
+	Cep string
+	// CEPs, when set, asks for a batch instead of Cep
+	CEPs    []string
+	Units   string
+	Resolve string
+	// IncludeAddress asks for the CEP's full address, as ?include_address=
+	IncludeAddress string
+	APIKey         string
+}
+
+// serviceBResponse holds the parts of service B's response forwarded to the client
+type serviceBResponse struct {
+	Body         []byte
+	StatusCode   int
+	ServerTiming string
+	// ContentType tells problem details from plain JSON bodies
+	ContentType string
+	// RetryAfter and Maintenance carry service B's answer during maintenance
+	RetryAfter  string
+	Maintenance bool
+	// CEPFlags carries the CEP rules flagging the CEP, forwarded as is
+	CEPFlags string
+}
+
+// ServiceBClient fetches weather data from service B, returning the number of
+// attempts made alongside the result
+type ServiceBClient interface {
+	FetchWeather(ctx context.Context, request serviceBRequest) (*serviceBResponse, int, error)
+}
+
+// httpServiceBClient calls the service B API over instrumented HTTP
+type httpServiceBClient struct {
+	target      serviceBTarget
+	maxAttempts int
+	client      *http.Client
+	tracer      trace.Tracer
+	calls       metric.Int64Counter
+	clock       Clock
+	// verifier, when it holds a key, rejects responses without a valid
+	// signature. Its previous key lets a new key be rolled out here before
+	// service B signs with it.
+	verifier signing.Keyring
+}
+
+// newHTTPServiceBClient creates the service B client from the application config
+func newHTTPServiceBClient(config Config, target serviceBTarget, providers Providers) (*httpServiceBClient, error) {
+	calls, err := providers.Meter(config.ServiceName).Int64Counter("svc_a.service_b.calls",
+		metric.WithDescription("Calls to service B by outcome and number of attempts"),
+		metric.WithUnit("{call}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service B call counter: %w", err)
+	}
+
+	verifier, err := signing.ParseKeys(config.ServiceBSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpServiceBClient{
+		target:      target,
+		maxAttempts: config.ServiceBMaxAttempts,
+		// Shared HTTP client with instrumentation; calls are bounded by the
+		// request context, whose TIMEOUT_SECONDS a reload may change
+		client: &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport,
+				otelhttp.WithTracerProvider(providers.Tracers()),
+				otelhttp.WithMeterProvider(providers.Meters()),
+			),
+		},
+		tracer:   providers.Tracer(config.ServiceName),
+		calls:    calls,
+		clock:    realClock{},
+		verifier: verifier,
+	}, nil
+}
+
+// FetchWeather calls the service B API. The weather lookup has no side effects,
+// so it is retried transparently when the connection fails.
+func (c *httpServiceBClient) FetchWeather(ctx context.Context, request serviceBRequest) (*serviceBResponse, int, error) {
+	ctx, span := c.tracer.Start(ctx, "CallServiceB")
+	defer span.End()
+
+	// Service B signs responses over the path it routes, without the
+	// target's prefix
+	targetURL, routedPath := c.target.endpoint("weather"), "/weather"
+	var reqData any = CepRequest{Cep: request.Cep, Units: request.Units}
+	if request.CEPs != nil {
+		span.SetAttributes(attribute.Int("batch.size", len(request.CEPs)))
+		targetURL, routedPath = c.target.endpoint("weather", "batch"), "/weather/batch"
+		reqData = BatchRequest{CEPs: request.CEPs, Units: request.Units}
+	} else {
+		span.SetAttributes(attribute.String("cep", request.Cep))
+	}
+	query := url.Values{}
+	if request.Resolve != "" {
+		span.SetAttributes(attribute.String("resolve", request.Resolve))
+		query.Set("resolve", request.Resolve)
+	}
+	if request.IncludeAddress != "" {
+		query.Set("include_address", request.IncludeAddress)
+	}
+	rawQuery := query.Encode()
+	if rawQuery != "" {
+		targetURL += "?" + rawQuery
+	}
+
+	reqBody, err := json.Marshal(reqData)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	var resp *http.Response
+	attempt := 0
+	for {
+		attempt++
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, strings.NewReader(string(reqBody)))
+		if err != nil {
+			return nil, attempt, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if request.APIKey != "" {
+			// Lets service B apply the client's response profile
+			req.Header.Set(apiKeyHeader, request.APIKey)
+		}
+
+		resp, err = c.client.Do(req)
+		if err == nil {
+			break
+		}
+
+		if attempt >= c.maxAttempts || !isConnectionError(err) {
+			c.recordCall(ctx, span, attempt, false)
+			return nil, attempt, fmt.Errorf("request failed after %d attempt(s): %w", attempt, err)
+		}
+
+		delay := time.Duration(attempt) * serviceBRetryBaseDelay
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.String("error", err.Error()),
+			attribute.Int64("backoff_ms", delay.Milliseconds()),
+		))
+
+		if err := c.clock.Sleep(ctx, delay); err != nil {
+			c.recordCall(ctx, span, attempt, false)
+			return nil, attempt, fmt.Errorf("request failed after %d attempt(s): %w", attempt, err)
+		}
+	}
+	defer resp.Body.Close()
+
+	// Read one byte past the cap so an oversized body can be told apart
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxServiceBResponseBytes+1))
+	if err != nil {
+		c.recordCall(ctx, span, attempt, false)
+		return nil, attempt, fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(respBody) > maxServiceBResponseBytes {
+		c.recordCall(ctx, span, attempt, false)
+		return nil, attempt, errServiceBResponseTooLarge
+	}
+
+	span.SetAttributes(attribute.Int("status_code", resp.StatusCode))
+	if c.verifier.Enabled() {
+		err := c.verifier.Verify(resp.Header, signing.Message{
+			Method: http.MethodPost,
+			Path:   routedPath,
+			Query:  rawQuery,
+			Status: resp.StatusCode,
+			Body:   respBody,
+		}, c.clock.Now())
+		span.SetAttributes(attribute.Bool("signature.valid", err == nil))
+		if err != nil {
+			c.recordCall(ctx, span, attempt, false)
+			return nil, attempt, fmt.Errorf("%w: %w", errServiceBSignatureInvalid, err)
+		}
+	}
+	c.recordCall(ctx, span, attempt, true)
+
+	return &serviceBResponse{
+		Body:         respBody,
+		StatusCode:   resp.StatusCode,
+		ServerTiming: resp.Header.Get("Server-Timing"),
+		ContentType:  resp.Header.Get("Content-Type"),
+		RetryAfter:   resp.Header.Get("Retry-After"),
+		Maintenance:  resp.Header.Get(maintenanceHeader) == "true",
+		CEPFlags:     resp.Header.Get(cepFlagsHeader),
+	}, attempt, nil
+}
+
+// recordCall counts the call, separating first-try successes from
+// successes that needed retries
+func (c *httpServiceBClient) recordCall(ctx context.Context, span trace.Span, attempts int, success bool) {
+	span.SetAttributes(attribute.Int("attempts", attempts))
+
+	outcome := "failure"
+	switch {
+	case success && attempts == 1:
+		outcome = "first_try_success"
+	case success:
+		outcome = "retried_success"
+	}
+
+	c.calls.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("outcome", outcome),
+		attribute.Int("attempts", attempts),
+	))
+}
+
+// isConnectionError reports whether err comes from the connection to service B
+// rather than from a deadline or cancellation, which must not be retried
+func isConnectionError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var timeoutErr interface{ Timeout() bool }
+	if errors.As(err, &timeoutErr) && timeoutErr.Timeout() {
+		return false
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"pkg/signing"
+)
+
+// fakeClock advances only when slept on, recording each requested duration
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func (c *fakeClock) Sleeps() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.sleeps...)
+}
+
+func TestFetchWeatherRetryBackoff(t *testing.T) {
+	t.Parallel()
+
+	// A closed server refuses connections, which are retried
+	serviceB := httptest.NewServer(http.NotFoundHandler())
+	serviceB.Close()
+
+	config := testConfig(serviceB.URL + "/weather")
+	config.ServiceBMaxAttempts = 3
+	client, err := newHTTPServiceBClient(config, mustParseServiceBTarget(t, config.ServiceBURL), Providers{})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	clock := newFakeClock()
+	client.clock = clock
+
+	_, attempts, err := client.FetchWeather(context.Background(), serviceBRequest{Cep: "22450000"})
+	if err == nil {
+		t.Fatal("expected an error from a refused connection")
+	}
+	if attempts != 3 {
+		t.Errorf("got %d attempts, want 3", attempts)
+	}
+
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}
+	if got := clock.Sleeps(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("backoff schedule = %v, want %v", got, expected)
+	}
+}
+
+func TestFetchWeatherVerifiesSignature(t *testing.T) {
+	t.Parallel()
+
+	const body = `{"city":"Rio de Janeiro","temp_C":25}`
+	current := signing.Keyring{Current: signing.Key{ID: "k2", Secret: []byte("next-secret")}}
+	previous := signing.Keyring{Current: signing.Key{ID: "k1", Secret: []byte("secret")}}
+	unknown := signing.Keyring{Current: signing.Key{ID: "k9", Secret: []byte("secret")}}
+	weather := signing.Message{Method: http.MethodPost, Path: "/weather", Status: http.StatusOK, Body: []byte(body)}
+	with := func(change func(m *signing.Message)) signing.Message {
+		changed := weather
+		change(&changed)
+		return changed
+	}
+
+	tests := []struct {
+		name      string
+		keys      signing.Keyring
+		signed    signing.Message
+		age       time.Duration
+		expectErr bool
+	}{
+		{"Valid signature", current, weather, 0, false},
+		{"Signed with the previous key", previous, weather, 0, false},
+		{"Tampered body", current, with(func(m *signing.Message) { m.Body = []byte(`{"city":"Rio de Janeiro","temp_C":35}`) }), 0, true},
+		{"Tampered status", current, with(func(m *signing.Message) { m.Status = http.StatusNotFound }), 0, true},
+		{"Answer to another request", current, with(func(m *signing.Message) { m.Path = "/weather/batch" }), 0, true},
+		{"Replayed", current, weather, time.Hour, true},
+		{"Unknown key", unknown, weather, 0, true},
+		{"Unsigned", signing.Keyring{}, weather, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			serviceB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for name, values := range tt.keys.Sign(tt.signed, time.Now().Add(-tt.age)) {
+					w.Header()[name] = values
+				}
+				w.Write([]byte(body))
+			}))
+			defer serviceB.Close()
+
+			// Service B behind a gateway that strips the prefix before routing
+			config := testConfig(serviceB.URL + "/api/weather-backend/weather")
+			config.ServiceBSigningKeys = "k2:next-secret,k1:secret"
+			client, err := newHTTPServiceBClient(config, mustParseServiceBTarget(t, config.ServiceBURL), Providers{})
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+
+			_, _, err = client.FetchWeather(context.Background(), serviceBRequest{Cep: "22450000"})
+			if tt.expectErr != errors.Is(err, errServiceBSignatureInvalid) || (!tt.expectErr && err != nil) {
+				t.Errorf("FetchWeather() error = %v, expectErr %v", err, tt.expectErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time for time-dependent code, replaced by a fake in
+// tests so backoff schedules and timestamps are deterministic
+type Clock interface {
+	Now() time.Time
+	// Sleep pauses for d, returning early with ctx.Err() if ctx is done first
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// realClock is the wall clock
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
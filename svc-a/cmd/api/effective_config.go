@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"pkg/telemetry"
+)
+
+// EffectiveConfig is the machine-readable dump of the configuration a service
+// is actually running with, keyed by environment variable name
+type EffectiveConfig struct {
+	Service    string            `json:"service"`
+	StartedAt  time.Time         `json:"started_at"`
+	GoVersion  string            `json:"go_version"`
+	Config     map[string]string `json:"config"`
+	Subsystems map[string]bool   `json:"subsystems"`
+	// LegacyEnv maps the renamed variables to their new names, flagging the
+	// old names this deployment still uses
+	LegacyEnv []LegacyEnvVar `json:"legacy_env"`
+}
+
+// Effective renders the configuration keyed by the environment variables it
+// is loaded from, so it can be diffed against the desired deployment state
+func (c Config) Effective() map[string]string {
+	return map[string]string{
+		"PORT":                       c.Port,
+		"ZIPKIN_URL":                 redactURL(c.ZipkinURL),
+		"ZIPKIN_UI_URL":              redactURL(c.ZipkinUIURL),
+		"SERVICE_B_URL":              redactURL(c.ServiceBURL),
+		"SERVICE_NAME":               c.ServiceName,
+		"ENVIRONMENT":                c.Environment,
+		"SPAN_NAME_PREFIXES":         c.SpanNamePrefixes,
+		"TRACES_EXPORTER":            c.ExporterType,
+		"TRACE_SAMPLE_RATIO":         strconv.FormatFloat(c.TraceSampleRatio, 'g', -1, 64),
+		"TRACE_ID_SEED":              strconv.FormatInt(c.TraceIDSeed, 10),
+		"LOG_LEVEL":                  c.LogLevel,
+		"LOG_FORMAT":                 c.LogFormat,
+		"METRICS_EXPORTER":           c.MetricsExporter,
+		"LOGS_EXPORTER":              c.LogsExporter,
+		"TIMEOUT_SECONDS":            strconv.Itoa(int(c.Timeout / time.Second)),
+		"SLOW_RESPONSE_THRESHOLD_MS": strconv.FormatInt(c.SlowThreshold.Milliseconds(), 10),
+		"SERVICE_B_MAX_ATTEMPTS":     strconv.Itoa(c.ServiceBMaxAttempts),
+		"MAX_BODY_BYTES":             strconv.FormatInt(c.Limits.MaxBodyBytes, 10),
+		"BATCH_MAX_CEPS":             strconv.Itoa(c.Limits.MaxBatchCEPs),
+		"SAMPLING_AUDIT_SIZE":        strconv.Itoa(c.SamplingAudit.Size),
+		"SAMPLING_AUDIT_FILE":        c.SamplingAudit.File,
+		"EFFECTIVE_CONFIG_FILE":      c.EffectiveConfigFile,
+		"CONFIG_FILE":                c.ConfigFile,
+		"SPAN_MAX_ATTRIBUTES":        strconv.Itoa(c.SpanAttributeBudget.MaxAttributes),
+		"SPAN_MAX_ATTRIBUTE_LENGTH":  strconv.Itoa(c.SpanAttributeBudget.MaxValueLength),
+		"CAPTURE_FILE":               c.CaptureFile,
+		"SHADOW_SAMPLE_RATES":        c.ShadowSampleRates,
+		"SHADOW_SINK":                redactURL(c.ShadowSink),
+		"SERVICE_B_SIGNING_KEYS":     redactSecret(c.ServiceBSigningKeys),
+		"MAINTENANCE_MODE":           strconv.FormatBool(c.MaintenanceMode),
+		"MAINTENANCE_MESSAGE":        c.MaintenanceMessage,
+		"MAINTENANCE_RETRY_SECONDS":  strconv.Itoa(c.MaintenanceRetrySeconds),
+		"ADMIN_TOKEN":                redactSecret(c.AdminToken),
+		"SHUTDOWN_TIMEOUT_SECONDS":   strconv.Itoa(int(c.ShutdownTimeout / time.Second)),
+		"HEALTH_TIMEOUT_MS":          strconv.FormatInt(c.HealthTimeout.Milliseconds(), 10),
+		"HEALTH_CACHE_SECONDS":       strconv.Itoa(int(c.HealthCacheFor / time.Second)),
+		"COMPRESSION_MIN_BYTES":      strconv.Itoa(c.CompressionMinBytes),
+		"RATE_LIMIT_GLOBAL_RPS":      strconv.FormatFloat(c.RateLimit.GlobalRPS, 'g', -1, 64),
+		"RATE_LIMIT_GLOBAL_BURST":    strconv.Itoa(c.RateLimit.GlobalBurst),
+		"RATE_LIMIT_PER_IP_RPS":      strconv.FormatFloat(c.RateLimit.PerIPRPS, 'g', -1, 64),
+		"RATE_LIMIT_PER_IP_BURST":    strconv.Itoa(c.RateLimit.PerIPBurst),
+		"RATE_LIMIT_IP_HEADER":       c.RateLimit.ClientIPHeader,
+		"RATE_LIMIT_TRUSTED_PROXIES": formatPrefixes(c.RateLimit.TrustedProxies),
+	}
+}
+
+// redactSecret reports whether a secret is set without revealing it
+func redactSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+// redactURL masks any password embedded in a URL
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "[REDACTED]"
+	}
+	return parsed.Redacted()
+}
+
+// newEffectiveConfig captures the effective configuration and enabled subsystems
+func newEffectiveConfig(config Config) EffectiveConfig {
+	return EffectiveConfig{
+		Service:   config.ServiceName,
+		StartedAt: time.Now().UTC(),
+		GoVersion: runtime.Version(),
+		Config:    config.Effective(),
+		LegacyEnv: config.LegacyEnv,
+		Subsystems: map[string]bool{
+			"tracing":             true,
+			"metrics_export":      config.MetricsExporter != "" && config.MetricsExporter != telemetry.ExporterNone,
+			"logs_export":         config.LogsExporter != "" && config.LogsExporter != telemetry.ExporterNone,
+			"sampling_audit":      config.SamplingAudit.Size > 0,
+			"sampling_audit_file": config.SamplingAudit.Size > 0 && config.SamplingAudit.File != "",
+			"traffic_capture":     config.CaptureFile != "",
+			"shadow_sampling":     config.ShadowSampleRates != "" && config.ShadowSink != "",
+			"response_signatures": config.ServiceBSigningKeys != "",
+			"maintenance":         config.MaintenanceMode,
+			"admin":               config.AdminToken != "",
+			"rate_limit":          config.RateLimit.enabled(),
+			"compression":         config.CompressionMinBytes > 0,
+		},
+	}
+}
+
+// logStartupBanner prints the effective configuration and, if configured,
+// writes it to EffectiveConfigFile
+func logStartupBanner(effective EffectiveConfig, path string) error {
+	dump, err := json.Marshal(effective)
+	if err != nil {
+		return fmt.Errorf("failed to encode effective config: %w", err)
+	}
+
+	slog.Info("Effective configuration", "effective", json.RawMessage(dump))
+
+	if path == "" {
+		return nil
+	}
+	if err := os.WriteFile(path, append(dump, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write effective config: %w", err)
+	}
+	return nil
+}
+
+// handleEffectiveConfig serves the effective configuration for drift detection
+func handleEffectiveConfig(effective func() EffectiveConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(effective())
+	}
+}
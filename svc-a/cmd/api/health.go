@@ -0,0 +1,18 @@
+package main
+
+import (
+	"net/http"
+
+	"pkg/health"
+)
+
+// newHealthChecker checks svc-b is reachable, through its liveness probe: its
+// own dependencies are its readiness' concern, and svc-a can't serve without it
+func newHealthChecker(config Config, target serviceBTarget) *health.Checker {
+	client := &http.Client{Timeout: config.HealthTimeout}
+	return health.NewChecker(config.HealthTimeout, config.HealthCacheFor, health.Check{
+		Name:     "svc-b",
+		Critical: true,
+		Probe:    health.Reachable(client, target.endpoint("healthz")),
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pkg/health"
+)
+
+func TestReadinessProbesServiceB(t *testing.T) {
+	t.Parallel()
+
+	serviceB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			t.Errorf("probed %s, want /healthz", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(serviceB.Close)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name           string
+		serviceBURL    string
+		expectedCode   int
+		expectedStatus string
+	}{
+		{"svc-b reachable", serviceB.URL + "/weather", http.StatusOK, health.StatusOK},
+		{"svc-b down", down.URL + "/weather", http.StatusServiceUnavailable, health.StatusFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			app := newTestApp(t, testConfig(tt.serviceBURL))
+			rr := httptest.NewRecorder()
+			app.setupRoutes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			var report health.Report
+			if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+				t.Fatalf("failed to decode report: %v", err)
+			}
+			if rr.Code != tt.expectedCode || report.Status != tt.expectedStatus {
+				t.Errorf("got %d %q, want %d %q", rr.Code, report.Status, tt.expectedCode, tt.expectedStatus)
+			}
+			if len(report.Checks) != 1 || report.Checks[0].Name != "svc-b" {
+				t.Errorf("got checks %+v, want svc-b", report.Checks)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResponseMeta carries diagnostic information added to error and slow responses
+type ResponseMeta struct {
+	Latency *LatencyBreakdown `json:"latency,omitempty"`
+	// Attempts is how many times service B was called for this request
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// LatencyBreakdown attributes the total response time to each hop, in milliseconds
+type LatencyBreakdown struct {
+	TotalMs    float64 `json:"total_ms"`
+	SvcAMs     float64 `json:"svc_a_ms"`
+	NetworkMs  float64 `json:"network_ms,omitempty"`
+	SvcBMs     float64 `json:"svc_b_ms,omitempty"`
+	ExternalMs float64 `json:"external_ms,omitempty"`
+}
+
+// serviceBStages lists the Server-Timing metrics service B reports for external calls
+var serviceBStages = []string{"cep", "weather"}
+
+// parseServerTiming extracts metric durations (in ms) from a Server-Timing
+// header. A metric reported more than once adds up, as each entry is time
+// spent in that stage; entries without a valid dur are skipped.
+func parseServerTiming(header string) map[string]float64 {
+	timings := make(map[string]float64)
+	for _, entry := range strings.Split(header, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ";")
+		name := strings.TrimSpace(parts[0])
+		if name == "" {
+			continue
+		}
+		for _, param := range parts[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.TrimSpace(key) != "dur" {
+				continue
+			}
+			if dur, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && dur >= 0 {
+				timings[name] += dur
+			}
+			break
+		}
+	}
+	return timings
+}
+
+// buildLatencyBreakdown splits the total time between svc-a, the network hop,
+// svc-b itself and the external providers svc-b called
+func buildLatencyBreakdown(total, roundTrip time.Duration, serverTiming string) *LatencyBreakdown {
+	breakdown := &LatencyBreakdown{
+		TotalMs: toMillis(total),
+		SvcAMs:  toMillis(total - roundTrip),
+	}
+
+	timings := parseServerTiming(serverTiming)
+	svcBTotal, ok := timings["total"]
+	if !ok {
+		// Without service B's own timing the whole round trip is attributed to it
+		breakdown.SvcBMs = toMillis(roundTrip)
+		return breakdown
+	}
+
+	var external float64
+	for _, stage := range serviceBStages {
+		external += timings[stage]
+	}
+
+	breakdown.ExternalMs = roundMillis(external)
+	breakdown.SvcBMs = roundMillis(svcBTotal - external)
+	breakdown.NetworkMs = roundMillis(toMillis(roundTrip) - svcBTotal)
+	return breakdown
+}
+
+// withMeta injects the meta block into a JSON object body, merged into the
+// one service B answered (e.g. its weather_provider), returning the body
+// unchanged if it isn't a JSON object
+func withMeta(body []byte, meta ResponseMeta) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return body
+	}
+
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(fields["meta"], &merged); err != nil || merged == nil {
+		merged = make(map[string]json.RawMessage)
+	}
+	encodedMeta, err := json.Marshal(meta)
+	if err != nil {
+		return body
+	}
+	var own map[string]json.RawMessage
+	if err := json.Unmarshal(encodedMeta, &own); err != nil {
+		return body
+	}
+	for key, value := range own {
+		merged[key] = value
+	}
+	if fields["meta"], err = json.Marshal(merged); err != nil {
+		return body
+	}
+
+	result, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return result
+}
+
+func toMillis(d time.Duration) float64 {
+	return roundMillis(float64(d) / float64(time.Millisecond))
+}
+
+func roundMillis(ms float64) float64 {
+	if ms < 0 {
+		return 0
+	}
+	return float64(int64(ms*100+0.5)) / 100
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseServerTiming(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		header   string
+		expected map[string]float64
+	}{
+		{"Empty", "", map[string]float64{}},
+		{"svc-b stages", "cep;dur=12.50, weather;dur=80.25, total;dur=95.00", map[string]float64{"cep": 12.5, "weather": 80.25, "total": 95}},
+		{"Other params", `cache;desc="Cache Read";dur=23.2`, map[string]float64{"cache": 23.2}},
+		{"Spaces around params", "cep ; dur = 4", map[string]float64{"cep": 4}},
+		{"Duplicate metric adds up", "weather;dur=10, weather;dur=15.5", map[string]float64{"weather": 25.5}},
+		{"First dur of an entry counts", "cep;dur=3;dur=7", map[string]float64{"cep": 3}},
+		{"Missing dur", "cep, weather;desc=miss, total;dur=9", map[string]float64{"total": 9}},
+		{"Malformed dur", "cep;dur=fast, weather;dur=, total;dur=-5", map[string]float64{}},
+		{"Malformed entries", ",;dur=5, ;, =, total;dur=1", map[string]float64{"total": 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := parseServerTiming(tt.header); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("parseServerTiming(%q) = %v, want %v", tt.header, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildLatencyBreakdown(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		total        time.Duration
+		roundTrip    time.Duration
+		serverTiming string
+		expected     LatencyBreakdown
+	}{
+		{
+			name:         "Full breakdown",
+			total:        120 * time.Millisecond,
+			roundTrip:    100 * time.Millisecond,
+			serverTiming: "cep;dur=30, weather;dur=50, total;dur=90",
+			expected:     LatencyBreakdown{TotalMs: 120, SvcAMs: 20, NetworkMs: 10, SvcBMs: 10, ExternalMs: 80},
+		},
+		{
+			name:         "No Server-Timing",
+			total:        120 * time.Millisecond,
+			roundTrip:    100 * time.Millisecond,
+			serverTiming: "",
+			expected:     LatencyBreakdown{TotalMs: 120, SvcAMs: 20, SvcBMs: 100},
+		},
+		{
+			name:         "Total without dur",
+			total:        120 * time.Millisecond,
+			roundTrip:    100 * time.Millisecond,
+			serverTiming: "cep;dur=30, total",
+			expected:     LatencyBreakdown{TotalMs: 120, SvcAMs: 20, SvcBMs: 100},
+		},
+		{
+			name:         "Malformed header",
+			total:        120 * time.Millisecond,
+			roundTrip:    100 * time.Millisecond,
+			serverTiming: "garbage;;;,,",
+			expected:     LatencyBreakdown{TotalMs: 120, SvcAMs: 20, SvcBMs: 100},
+		},
+		{
+			name:         "Duplicate stage",
+			total:        120 * time.Millisecond,
+			roundTrip:    100 * time.Millisecond,
+			serverTiming: "weather;dur=20, weather;dur=30, total;dur=60",
+			expected:     LatencyBreakdown{TotalMs: 120, SvcAMs: 20, NetworkMs: 40, SvcBMs: 10, ExternalMs: 50},
+		},
+		{
+			name:         "svc-b reports more than the round trip",
+			total:        120 * time.Millisecond,
+			roundTrip:    100 * time.Millisecond,
+			serverTiming: "weather;dur=50, total;dur=110",
+			expected:     LatencyBreakdown{TotalMs: 120, SvcAMs: 20, SvcBMs: 60, ExternalMs: 50},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := buildLatencyBreakdown(tt.total, tt.roundTrip, tt.serverTiming); *got != tt.expected {
+				t.Errorf("buildLatencyBreakdown() = %+v, want %+v", *got, tt.expected)
+			}
+		})
+	}
+}
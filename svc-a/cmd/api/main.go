@@ -3,22 +3,32 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"pkg/health"
+	"pkg/negotiation"
+	"pkg/settings"
+	"pkg/telemetry"
+	"pkg/validation"
+	"svc-a/capture"
+
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/zipkin"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/metric"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -28,12 +38,104 @@ type Config struct {
 	ZipkinURL   string
 	ServiceBURL string
 	ServiceName string
-	Timeout     time.Duration
+	Environment string
+	// SpanNamePrefixes, as environment=prefix pairs, prefixes the exported
+	// span names in environments sharing a Zipkin with others
+	SpanNamePrefixes string
+	// ExporterType selects the span exporter: zipkin, otlp-grpc, otlp-http or stdout
+	ExporterType string
+	// TraceSampleRatio is the ratio (0 to 1) of the traces sampled, by trace ID
+	TraceSampleRatio float64
+	// TraceIDSeed, when not 0, makes trace and span IDs repeat across runs
+	TraceIDSeed int64
+	// LogLevel (debug, info, warn, error) and LogFormat (json, text) shape the logs
+	LogLevel  string
+	LogFormat string
+	// MetricsExporter selects the metric exporter: none, otlp-grpc, otlp-http or stdout
+	MetricsExporter string
+	// LogsExporter exports the logs through OpenTelemetry too: none, otlp-grpc, otlp-http or stdout
+	LogsExporter string
+	Timeout      time.Duration
+	// SlowThreshold marks responses slow enough to carry a latency breakdown
+	SlowThreshold time.Duration
+	// ServiceBMaxAttempts bounds how many times a failed connection to service B is tried
+	ServiceBMaxAttempts int
+	Limits              Limits
+	SamplingAudit       SamplingAuditConfig
+	// EffectiveConfigFile optionally receives the effective configuration dump on boot
+	EffectiveConfigFile string
+	// ConfigFile is the YAML or JSON file loaded under the environment, named
+	// by CONFIG_FILE or --config-file
+	ConfigFile string
+	// ZipkinUIURL is the Zipkin UI base used for trace links in the dev profile
+	ZipkinUIURL string
+	// SpanAttributeBudget bounds the attributes exported per span
+	SpanAttributeBudget telemetry.AttributeBudget
+	// CaptureFile optionally receives sanitized /weather traffic for replay
+	CaptureFile string
+	// ShadowSampleRates copies a fraction of each listed route's traffic,
+	// stripped of PII, to ShadowSink: a file or an http(s) endpoint
+	ShadowSampleRates string
+	ShadowSink        string
+	// ServiceBSigningKeys, as id:secret pairs with the current key first and
+	// optionally the previous one, makes service B responses require a valid
+	// signature before they are forwarded
+	ServiceBSigningKeys string
+	// MaintenanceMode starts /weather answering 503, with MaintenanceMessage
+	// and Retry-After MaintenanceRetrySeconds; with AdminToken set it can be
+	// switched at runtime through /admin/maintenance
+	MaintenanceMode         bool
+	MaintenanceMessage      string
+	MaintenanceRetrySeconds int
+	AdminToken              string
+	RateLimit               RateLimitConfig
+	// ShutdownTimeout bounds how long in-flight requests are drained on
+	// SIGINT or SIGTERM before telemetry is flushed
+	ShutdownTimeout time.Duration
+	// HealthTimeout bounds each readiness check and HealthCacheFor how long
+	// their results are reused
+	HealthTimeout  time.Duration
+	HealthCacheFor time.Duration
+	// CompressionMinBytes is the smallest response compressed for clients
+	// accepting gzip or deflate; 0 turns compression off
+	CompressionMinBytes int
+	// LegacyEnv lists the renamed variables and which old names were used
+	LegacyEnv []LegacyEnvVar
+}
+
+// Limits holds the server limits enforced on requests and reported to clients
+type Limits struct {
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+	// MaxBatchCEPs bounds the CEPs of a POST /weather/batch
+	MaxBatchCEPs int `json:"max_batch_ceps"`
+}
+
+// LimitsResponse reports every limit enforced on requests: the configured
+// ones and the rate limits in effect, named like the limit member of the
+// 429 bodies and left out while off
+type LimitsResponse struct {
+	Limits
+	RateLimitGlobal *RateLimit `json:"rate_limit_global,omitempty"`
+	RateLimitPerIP  *RateLimit `json:"rate_limit_per_ip,omitempty"`
+}
+
+// RateLimit is a token bucket's rate, in requests per second, and burst
+type RateLimit struct {
+	RPS   float64 `json:"rps"`
+	Burst int     `json:"burst"`
 }
 
 // CepRequest represents the payload for a zipcode request
 type CepRequest struct {
 	Cep string `json:"cep"`
+	// Units limits the temperatures answered, e.g. celsius,kelvin
+	Units string `json:"units,omitempty"`
+}
+
+// BatchRequest lists the CEPs of a batch, forwarded to service B as is
+type BatchRequest struct {
+	CEPs  []string `json:"ceps"`
+	Units string   `json:"units,omitempty"`
 }
 
 // WeatherResponse represents the weather data response
@@ -47,202 +149,481 @@ type WeatherResponse struct {
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// Limit names the server limit a request exceeded, as reported by /limits
+	Limit string        `json:"limit,omitempty"`
+	Meta  *ResponseMeta `json:"meta,omitempty"`
+	// TraceURL links to the request's trace in the Zipkin UI, in the dev profile only
+	TraceURL string `json:"trace_url,omitempty"`
 }
 
-// LoadConfig loads configuration from environment variables with defaults
-func LoadConfig() Config {
-	return Config{
-		Port:        getEnv("PORT", "8080"),
-		ZipkinURL:   getEnv("ZIPKIN_URL", "http://zipkin:9411/api/v2/spans"),
-		ServiceBURL: getEnv("SERVICE_B_URL", "http://svc-b:8081/weather"),
-		ServiceName: getEnv("SERVICE_NAME", "svc-a"),
-		Timeout:     time.Duration(getEnvAsInt("TIMEOUT_SECONDS", 10)) * time.Second,
+// LoadConfig loads configuration from src (flags, environment variables and
+// the config file, over defaults), after copying the legacy variable names to
+// the new ones. It fails on values that don't parse and on unknown flags or
+// file keys.
+func LoadConfig(src *settings.Source) (Config, error) {
+	legacy := migrateLegacyEnv()
+	config := Config{
+		Port:                src.String("PORT", "8080"),
+		ZipkinURL:           src.String("ZIPKIN_URL", "http://zipkin:9411/api/v2/spans"),
+		ZipkinUIURL:         src.String("ZIPKIN_UI_URL", ""),
+		ServiceBURL:         src.String("SERVICE_B_URL", "http://svc-b:8081/weather"),
+		ServiceName:         src.String("SERVICE_NAME", "svc-a"),
+		ExporterType:        src.String("TRACES_EXPORTER", telemetry.ExporterZipkin),
+		TraceSampleRatio:    src.Float("TRACE_SAMPLE_RATIO", 1),
+		TraceIDSeed:         int64(src.Int("TRACE_ID_SEED", 0)),
+		MetricsExporter:     src.String("METRICS_EXPORTER", telemetry.ExporterNone),
+		LogsExporter:        src.String("LOGS_EXPORTER", telemetry.ExporterNone),
+		LogLevel:            src.String("LOG_LEVEL", "info"),
+		LogFormat:           src.String("LOG_FORMAT", telemetry.LogFormatJSON),
+		Environment:         src.String("ENVIRONMENT", "production"),
+		SpanNamePrefixes:    src.String("SPAN_NAME_PREFIXES", ""),
+		Timeout:             time.Duration(src.Int("TIMEOUT_SECONDS", 10)) * time.Second,
+		SlowThreshold:       time.Duration(src.Int("SLOW_RESPONSE_THRESHOLD_MS", 1000)) * time.Millisecond,
+		ServiceBMaxAttempts: src.Int("SERVICE_B_MAX_ATTEMPTS", 3),
+		Limits: Limits{
+			MaxBodyBytes: int64(src.Int("MAX_BODY_BYTES", 4<<10)),
+			MaxBatchCEPs: src.Int("BATCH_MAX_CEPS", 20),
+		},
+		SamplingAudit: SamplingAuditConfig{
+			Size: src.Int("SAMPLING_AUDIT_SIZE", 0),
+			File: src.String("SAMPLING_AUDIT_FILE", ""),
+		},
+		EffectiveConfigFile: src.String("EFFECTIVE_CONFIG_FILE", ""),
+		SpanAttributeBudget: telemetry.AttributeBudget{
+			MaxAttributes:  src.Int("SPAN_MAX_ATTRIBUTES", 64),
+			MaxValueLength: src.Int("SPAN_MAX_ATTRIBUTE_LENGTH", 1024),
+		},
+		CaptureFile:             src.String("CAPTURE_FILE", ""),
+		ShadowSampleRates:       src.String("SHADOW_SAMPLE_RATES", ""),
+		ShadowSink:              src.String("SHADOW_SINK", ""),
+		ServiceBSigningKeys:     src.String("SERVICE_B_SIGNING_KEYS", ""),
+		MaintenanceMode:         src.Bool("MAINTENANCE_MODE", false),
+		MaintenanceMessage:      src.String("MAINTENANCE_MESSAGE", ""),
+		MaintenanceRetrySeconds: src.Int("MAINTENANCE_RETRY_SECONDS", 300),
+		AdminToken:              src.String("ADMIN_TOKEN", ""),
+		ShutdownTimeout:         time.Duration(src.Int("SHUTDOWN_TIMEOUT_SECONDS", 30)) * time.Second,
+		HealthTimeout:           time.Duration(src.Int("HEALTH_TIMEOUT_MS", 2000)) * time.Millisecond,
+		HealthCacheFor:          time.Duration(src.Int("HEALTH_CACHE_SECONDS", 10)) * time.Second,
+		CompressionMinBytes:     src.Int("COMPRESSION_MIN_BYTES", 1024),
+		RateLimit: RateLimitConfig{
+			GlobalRPS:      src.Float("RATE_LIMIT_GLOBAL_RPS", 0),
+			GlobalBurst:    src.Int("RATE_LIMIT_GLOBAL_BURST", 0),
+			PerIPRPS:       src.Float("RATE_LIMIT_PER_IP_RPS", 0),
+			PerIPBurst:     src.Int("RATE_LIMIT_PER_IP_BURST", 0),
+			ClientIPHeader: src.String("RATE_LIMIT_IP_HEADER", ""),
+			TrustedProxies: trustedProxies(src, "RATE_LIMIT_TRUSTED_PROXIES"),
+		},
+		ConfigFile: src.File(),
+		LegacyEnv:  legacy,
 	}
+	return config, src.Err()
 }
 
-// getEnv retrieves an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// resourceAttributes describe the svc-b the deployment targets, so traces
+// show which backend a request went to. A malformed SERVICE_B_URL is left out
+// here and fails NewApp.
+func resourceAttributes(config Config) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	if target, err := parseServiceBTarget(config.ServiceBURL); err == nil {
+		attrs = append(attrs, attribute.String("service_b.target", target.String()))
 	}
-	return defaultValue
+	return attrs
 }
 
-// getEnvAsInt retrieves an environment variable as integer or returns a default value
-func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intVal, err := getIntFromString(value); err == nil {
-			return intVal
-		}
+// initTelemetry initializes tracing and metrics through the shared telemetry
+// package, sampling with ratio and recording sampling decisions when an audit
+// is given
+func initTelemetry(config Config, ratio *telemetry.RatioSampler, audit *samplingAudit) (func(), error) {
+	var sampler sdktrace.Sampler = ratio
+	if audit != nil {
+		sampler = auditingSampler{next: sampler, audit: audit}
 	}
-	return defaultValue
+
+	return telemetry.Init(context.Background(), telemetry.Config{
+		ServiceName:      config.ServiceName,
+		Environment:      config.Environment,
+		SpanNamePrefixes: config.SpanNamePrefixes,
+		ExporterType:     config.ExporterType,
+		ZipkinURL:        config.ZipkinURL,
+		MetricsExporter:  config.MetricsExporter,
+		LogsExporter:     config.LogsExporter,
+		Attributes:       resourceAttributes(config),
+		Sampler:          sampler,
+		IDSeed:           config.TraceIDSeed,
+		// Keep exported payloads bounded whatever the code adds to spans
+		WrapExporter: func(exporter sdktrace.SpanExporter) sdktrace.SpanExporter {
+			return telemetry.NewBudgetExporter(exporter, config.SpanAttributeBudget)
+		},
+	})
+}
+
+// App represents the application
+type App struct {
+	config        Config
+	providers     Providers
+	tracer        trace.Tracer
+	serviceB      ServiceBClient
+	samplingAudit *samplingAudit
+	traceLinks    traceLinker
+	capture       *capture.Recorder
+	shadow        *capture.Shadow
+	maintenance   *maintenanceMode
+	rateLimiter   *rateLimiter
+	health        *health.Checker
+	requests      metric.Int64Counter
+	durations     metric.Float64Histogram
+	// timeout bounds each call to service B, as a time.Duration a reload may change
+	timeout atomic.Int64
+
+	// configMu guards effective, and the reloader's view of the configuration
+	// it was derived from, so the two change together
+	configMu  sync.RWMutex
+	effective EffectiveConfig
 }
 
-// getIntFromString converts a string to int with error handling
-func getIntFromString(s string) (int, error) {
-	var result int
-	_, err := fmt.Sscanf(s, "%d", &result)
-	return result, err
+// effectiveConfig returns the effective configuration, reloads included
+func (app *App) effectiveConfig() EffectiveConfig {
+	app.configMu.RLock()
+	defer app.configMu.RUnlock()
+	return app.effective
 }
 
-// initTracer initializes the OpenTelemetry tracer provider
-func initTracer(config Config) (*sdktrace.TracerProvider, error) {
-	exporter, err := zipkin.New(config.ZipkinURL)
+// NewApp creates a new application instance
+func NewApp(config Config, audit *samplingAudit, providers Providers) (*App, error) {
+	target, err := parseServiceBTarget(config.ServiceBURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Zipkin exporter: %w", err)
+		return nil, fmt.Errorf("invalid SERVICE_B_URL: %w", err)
+	}
+	serviceB, err := newHTTPServiceBClient(config, target, providers)
+	if err != nil {
+		return nil, err
 	}
 
-	tracerProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String(config.ServiceName),
-			attribute.String("environment", getEnv("ENVIRONMENT", "production")),
-		)),
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	meter := providers.Meter(config.ServiceName)
+	requests, err := meter.Int64Counter("svc_a.requests",
+		metric.WithDescription("Requests handled by route, status code and outcome"),
+		metric.WithUnit("{request}"),
 	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request counter: %w", err)
+	}
+
+	durations, err := meter.Float64Histogram("svc_a.request.duration",
+		metric.WithDescription("Duration of requests handled by route, status code and outcome"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request duration histogram: %w", err)
+	}
 
-	otel.SetTracerProvider(tracerProvider)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-		propagation.TraceContext{},
-		propagation.Baggage{},
-	))
+	recorder, err := capture.NewRecorder(config.CaptureFile)
+	if err != nil {
+		return nil, err
+	}
+
+	shadow, err := newShadow(config)
+	if err != nil {
+		return nil, err
+	}
 
-	return tracerProvider, nil
+	limiter, err := newRateLimiter(config.RateLimit, meter, realClock{})
+	if err != nil {
+		return nil, err
+	}
+
+	app := &App{
+		config:        config,
+		providers:     providers,
+		tracer:        providers.Tracer(config.ServiceName),
+		serviceB:      serviceB,
+		samplingAudit: audit,
+		effective:     newEffectiveConfig(config),
+		traceLinks:    newTraceLinker(config),
+		capture:       recorder,
+		shadow:        shadow,
+		maintenance:   newMaintenanceMode(config),
+		rateLimiter:   limiter,
+		health:        newHealthChecker(config, target),
+		requests:      requests,
+		durations:     durations,
+	}
+	app.timeout.Store(int64(config.Timeout))
+	return app, nil
 }
 
-// App represents the application
-type App struct {
-	config Config
-	tracer trace.Tracer
+// Close releases the resources held by the application
+func (app *App) Close() error {
+	return errors.Join(app.capture.Close(), app.shadow.Close())
 }
 
-// NewApp creates a new application instance
-func NewApp(config Config) *App {
-	return &App{
-		config: config,
-		tracer: otel.Tracer(config.ServiceName),
+// newShadow samples the routes of ShadowSampleRates to ShadowSink; it returns
+// nil when either is unset
+func newShadow(config Config) (*capture.Shadow, error) {
+	rates, err := capture.ParseRates(config.ShadowSampleRates)
+	if err != nil {
+		return nil, err
+	}
+	if len(rates) == 0 || config.ShadowSink == "" {
+		return nil, nil
 	}
+	sink, err := capture.NewSink(config.ShadowSink)
+	if err != nil {
+		return nil, err
+	}
+	return capture.NewShadow(rates, sink), nil
 }
 
 // respondWithError sends a JSON error response
-func respondWithError(w http.ResponseWriter, code int, message string) {
+func (app *App) respondWithError(ctx context.Context, w http.ResponseWriter, code int, message string) {
+	app.respondWithJSONError(ctx, w, code, ErrorResponse{Error: message})
+}
+
+// respondWithLimitError reports a request rejected for exceeding a named server limit
+func (app *App) respondWithLimitError(ctx context.Context, w http.ResponseWriter, code int, message, limit string) {
+	app.respondWithJSONError(ctx, w, code, ErrorResponse{Error: message, Limit: limit})
+}
+
+// respondWithErrorMeta sends a JSON error response carrying a meta block
+func (app *App) respondWithErrorMeta(ctx context.Context, w http.ResponseWriter, code int, message string, meta *ResponseMeta) {
+	app.respondWithJSONError(ctx, w, code, ErrorResponse{Error: message, Meta: meta})
+}
+
+// respondWithJSONError writes an error response, linking to its trace in the dev profile
+func (app *App) respondWithJSONError(ctx context.Context, w http.ResponseWriter, code int, response ErrorResponse) {
+	if response.TraceURL = app.traceLinks.url(ctx); response.TraceURL != "" {
+		slog.InfoContext(ctx, "Error response", "status", code, "error", response.Error, "trace_url", response.TraceURL)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+	json.NewEncoder(w).Encode(response)
+}
+
+// respondWithProblem writes an RFC 7807 problem, linking to its trace in the
+// dev profile
+func (app *App) respondWithProblem(ctx context.Context, w http.ResponseWriter, problem validation.Problem) {
+	if problem.TraceURL = app.traceLinks.url(ctx); problem.TraceURL != "" {
+		slog.InfoContext(ctx, "Error response", "status", problem.Status, "error", problem.Detail, "trace_url", problem.TraceURL)
+	}
+	validation.WriteProblem(w, problem)
 }
 
 // HandleWeatherRequest handles the weather endpoint requests
 func (app *App) HandleWeatherRequest(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	ctx := r.Context()
 	ctx, span := app.tracer.Start(ctx, "HandleWeatherRequest")
 	defer span.End()
 
 	if r.Method != http.MethodPost {
-		respondWithError(w, http.StatusMethodNotAllowed, "only POST method is allowed")
+		app.respondWithError(ctx, w, http.StatusMethodNotAllowed, "only POST method is allowed")
 		span.SetAttributes(attribute.String("error", "method_not_allowed"))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 
-	body, err := io.ReadAll(r.Body)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, app.config.Limits.MaxBodyBytes))
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "invalid request body")
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			app.respondWithLimitError(ctx, w, http.StatusRequestEntityTooLarge, "request body too large", "max_body_bytes")
+			span.SetAttributes(attribute.String("error", "body_too_large"))
+			return
+		}
+		app.respondWithError(ctx, w, http.StatusBadRequest, "invalid request body")
 		span.SetAttributes(attribute.String("error", "invalid_body"))
 		return
 	}
 
 	var req CepRequest
 	if err := json.Unmarshal(body, &req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "invalid request format")
+		app.respondWithError(ctx, w, http.StatusBadRequest, "invalid request format")
 		span.SetAttributes(attribute.String("error", "invalid_format"))
 		return
 	}
 
-	cep := req.Cep
-	span.SetAttributes(attribute.String("cep", cep))
+	span.SetAttributes(attribute.String("cep", req.Cep))
 
-	// Validate CEP
-	if !isValidCEP(cep) {
-		respondWithError(w, http.StatusUnprocessableEntity, "invalid zipcode")
+	// Validate CEP, accepting the usual 00000-000 form
+	cep, err := validation.NormalizeCEP(req.Cep)
+	if err != nil {
+		app.respondWithProblem(ctx, w, validation.CEPProblem(err))
 		span.SetAttributes(attribute.String("error", "invalid_zipcode"))
 		return
 	}
 
-	// Create a context with timeout
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, app.config.Timeout)
-	defer cancel()
+	ctx = withRequestBaggage(ctx, r, cep)
+	app.forwardToServiceB(ctx, w, span, start, serviceBRequest{
+		Cep:            cep,
+		Units:          requestedUnits(r, req.Units),
+		Resolve:        r.URL.Query().Get("resolve"),
+		IncludeAddress: r.URL.Query().Get("include_address"),
+		APIKey:         r.Header.Get(apiKeyHeader),
+	})
+}
 
-	// Call service B
-	response, statusCode, err := app.callServiceB(ctxWithTimeout, cep)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error calling service B: %v", err))
-		span.SetAttributes(attribute.String("error", "service_b_error"))
-		return
+// requestedUnits is ?units=, or else the body's units. Service B validates
+// them, so unknown units get its answer.
+func requestedUnits(r *http.Request, bodyUnits string) string {
+	if units := r.URL.Query().Get("units"); units != "" {
+		return units
 	}
-
-	// Return service B's response
-	w.WriteHeader(statusCode)
-	w.Write(response)
+	return bodyUnits
 }
 
-// isValidCEP validates a Brazilian zipcode
-func isValidCEP(cep string) bool {
-	// Check if CEP is an 8-digit string
-	if len(cep) != 8 {
-		return false
+// HandleBatchRequest handles POST /weather/batch, a passthrough to service B,
+// which validates and resolves each CEP
+func (app *App) HandleBatchRequest(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ctx, span := app.tracer.Start(r.Context(), "HandleBatchRequest")
+	defer span.End()
+
+	if r.Method != http.MethodPost {
+		app.respondWithError(ctx, w, http.StatusMethodNotAllowed, "only POST method is allowed")
+		span.SetAttributes(attribute.String("error", "method_not_allowed"))
+		return
 	}
 
-	// Check if it contains only digits
-	for _, c := range cep {
-		if c < '0' || c > '9' {
-			return false
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, app.config.Limits.MaxBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			app.respondWithLimitError(ctx, w, http.StatusRequestEntityTooLarge, "request body too large", "max_body_bytes")
+			span.SetAttributes(attribute.String("error", "body_too_large"))
+			return
 		}
+		app.respondWithError(ctx, w, http.StatusBadRequest, "invalid request body")
+		span.SetAttributes(attribute.String("error", "invalid_body"))
+		return
 	}
 
-	return true
-}
+	var req BatchRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.CEPs == nil {
+		app.respondWithError(ctx, w, http.StatusBadRequest, "invalid request format")
+		span.SetAttributes(attribute.String("error", "invalid_format"))
+		return
+	}
+	span.SetAttributes(attribute.Int("batch.size", len(req.CEPs)))
+	if len(req.CEPs) > app.config.Limits.MaxBatchCEPs {
+		app.respondWithLimitError(ctx, w, http.StatusRequestEntityTooLarge, "too many ceps", "max_batch_ceps")
+		span.SetAttributes(attribute.String("error", "batch_too_large"))
+		return
+	}
 
-// callServiceB calls the service B API
-func (app *App) callServiceB(ctx context.Context, cep string) ([]byte, int, error) {
-	ctx, span := app.tracer.Start(ctx, "CallServiceB")
-	defer span.End()
+	ctx = withRequestBaggage(ctx, r, "")
+	app.forwardToServiceB(ctx, w, span, start, serviceBRequest{
+		CEPs:           req.CEPs,
+		Units:          requestedUnits(r, req.Units),
+		Resolve:        r.URL.Query().Get("resolve"),
+		IncludeAddress: r.URL.Query().Get("include_address"),
+		APIKey:         r.Header.Get(apiKeyHeader),
+	})
+}
 
-	span.SetAttributes(attribute.String("cep", cep))
+// forwardToServiceB calls service B and answers its response to the client
+func (app *App) forwardToServiceB(ctx context.Context, w http.ResponseWriter, span trace.Span, start time.Time, request serviceBRequest) {
+	// Create a context with timeout
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, time.Duration(app.timeout.Load()))
+	defer cancel()
 
-	reqData := CepRequest{Cep: cep}
-	reqBody, err := json.Marshal(reqData)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to marshal request: %w", err)
+	// Call service B
+	callStart := time.Now()
+	response, attempts, err := app.serviceB.FetchWeather(ctxWithTimeout, request)
+	roundTrip := time.Since(callStart)
+	if errors.Is(err, errServiceBSignatureInvalid) {
+		slog.WarnContext(ctx, "Rejected service B response", "error", err)
+		app.respondWithErrorMeta(ctx, w, http.StatusBadGateway, "service B response signature invalid",
+			app.responseMeta(span, start, roundTrip, "", attempts))
+		span.SetAttributes(attribute.String("error", "service_b_signature_invalid"))
+		return
+	}
+	if errors.Is(err, errServiceBResponseTooLarge) {
+		app.respondWithErrorMeta(ctx, w, http.StatusBadGateway, "service B response too large",
+			app.responseMeta(span, start, roundTrip, "", attempts))
+		span.SetAttributes(attribute.String("error", "service_b_response_too_large"))
+		return
 	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, app.config.ServiceBURL, strings.NewReader(string(reqBody)))
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+		setOutcome(ctx, outcomeFromError(err))
+		app.respondWithErrorMeta(ctx, w, http.StatusInternalServerError, fmt.Sprintf("error calling service B: %v", err),
+			app.responseMeta(span, start, roundTrip, "", attempts))
+		span.SetAttributes(attribute.String("error", "service_b_error"))
+		return
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	// Create HTTP client with timeouts and instrumentation
-	client := &http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
-		Timeout:   app.config.Timeout,
+	// Attach the meta block to errors, slow responses and retried calls
+	respBody := response.Body
+	if response.StatusCode >= http.StatusBadRequest || time.Since(start) > app.config.SlowThreshold || attempts > 1 {
+		respBody = withMeta(respBody, *app.responseMeta(span, start, roundTrip, response.ServerTiming, attempts))
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, 0, fmt.Errorf("request failed: %w", err)
+	// Failures inside service B are upstream errors from this service's view,
+	// unless it is down for planned maintenance
+	if response.Maintenance {
+		setOutcome(ctx, outcomeMaintenance)
+		w.Header().Set(maintenanceHeader, "true")
+	}
+	if response.StatusCode >= http.StatusInternalServerError {
+		setOutcome(ctx, outcomeUpstreamError)
+	}
+	if response.RetryAfter != "" {
+		w.Header().Set("Retry-After", response.RetryAfter)
+	}
+	if response.CEPFlags != "" {
+		w.Header().Set(cepFlagsHeader, response.CEPFlags)
+	}
+	if response.ContentType == validation.ProblemContentType {
+		w.Header().Set("Content-Type", validation.ProblemContentType)
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to read response: %w", err)
+	// Return service B's response
+	w.WriteHeader(response.StatusCode)
+	w.Write(respBody)
+}
+
+// responseMeta builds the meta block for the current request and records the
+// latency breakdown on the span
+func (app *App) responseMeta(span trace.Span, start time.Time, roundTrip time.Duration, serverTiming string, attempts int) *ResponseMeta {
+	breakdown := buildLatencyBreakdown(time.Since(start), roundTrip, serverTiming)
+	span.SetAttributes(
+		attribute.Float64("latency.total_ms", breakdown.TotalMs),
+		attribute.Float64("latency.svc_a_ms", breakdown.SvcAMs),
+		attribute.Float64("latency.network_ms", breakdown.NetworkMs),
+		attribute.Float64("latency.svc_b_ms", breakdown.SvcBMs),
+		attribute.Float64("latency.external_ms", breakdown.ExternalMs),
+	)
+	return &ResponseMeta{Latency: breakdown, Attempts: attempts}
+}
+
+// HandleLimits reports the server limits so clients can size their requests
+func (app *App) HandleLimits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.respondWithError(r.Context(), w, http.StatusMethodNotAllowed, "only GET method is allowed")
+		return
 	}
 
-	span.SetAttributes(attribute.Int("status_code", resp.StatusCode))
+	response := LimitsResponse{Limits: app.config.Limits}
+	response.RateLimitGlobal, response.RateLimitPerIP = app.rateLimiter.limits()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
 
-	return respBody, resp.StatusCode, nil
+// clientEndpoint instruments a client-facing handler with otelhttp, behind
+// the outcome, rate limiting and maintenance middlewares. Requests spend cost
+// rate limit tokens.
+func (app *App) clientEndpoint(operation string, handle http.HandlerFunc, cost requestCost) http.Handler {
+	return otelhttp.NewHandler(
+		app.outcomeMiddleware(app.rateLimiter.middleware(app.maintenance.middleware(handle), cost)),
+		operation,
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			return fmt.Sprintf("%s %s", r.Method, r.URL.Path)
+		}),
+		otelhttp.WithTracerProvider(app.providers.Tracers()),
+		otelhttp.WithMeterProvider(app.providers.Meters()),
+	)
 }
 
 // setupRoutes configures the HTTP routes
@@ -250,46 +631,114 @@ func (app *App) setupRoutes() http.Handler {
 	mux := http.NewServeMux()
 
 	// Add otelhttp instrumentation to the handler
-	handler := otelhttp.NewHandler(
-		http.HandlerFunc(app.HandleWeatherRequest),
-		"WeatherEndpoint",
-		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
-			return fmt.Sprintf("%s %s", r.Method, r.URL.Path)
-		}),
-	)
+	handler := app.clientEndpoint("WeatherEndpoint", app.HandleWeatherRequest, singleRequest)
 
-	mux.Handle("/weather", handler)
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"ok"}`))
-	})
+	if app.capture != nil {
+		// Record sanitized traffic for replay against candidate builds
+		handler = app.capture.Middleware(handler)
+	}
 
-	return mux
+	mux.Handle("/weather", handler)
+	mux.Handle("/weather/batch", app.clientEndpoint("WeatherBatchEndpoint", app.HandleBatchRequest, batchCost(app.config.Limits)))
+	mux.HandleFunc("/limits", app.HandleLimits)
+	mux.HandleFunc("/internal/effective-config", handleEffectiveConfig(app.effectiveConfig))
+	if app.samplingAudit != nil {
+		mux.HandleFunc("/internal/sampling-audit", app.samplingAudit.handleQuery)
+	}
+	// Operators switch maintenance mode at runtime with the admin token
+	if app.config.AdminToken != "" {
+		mux.HandleFunc("/admin/maintenance", app.maintenance.handleAdmin(app.config.AdminToken))
+	}
+	// /health is kept for the probes configured before /healthz
+	mux.HandleFunc("/health", health.Liveness())
+	mux.HandleFunc("/healthz", health.Liveness())
+	mux.HandleFunc("/readyz", app.health.Readiness())
+
+	var root http.Handler = negotiation.Negotiate(mux)
+	if app.shadow != nil {
+		// Copy a sample of real-world traffic to the debug sink
+		root = app.shadow.Middleware(root)
+	}
+	if app.config.CompressionMinBytes > 0 {
+		root = negotiation.Compress(app.config.CompressionMinBytes)(root)
+	}
+	return withRequestID(root)
 }
 
 func main() {
-	// Configure structured logging
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	log.Println("Starting service...")
+	// Load configuration, failing fast on anything invalid
+	src, err := settings.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	config, err := LoadConfig(src)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Configure structured logging, correlated with the traces, at a level
+	// a reload may change
+	level, err := telemetry.ParseLogLevel(config.LogLevel)
+	if err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	var logLevel slog.LevelVar
+	logLevel.Set(level)
+	logger, err := telemetry.NewLeveledLogger(os.Stderr, config.LogFormat, &logLevel)
+	if err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	// Exported through OTLP too once telemetry is initialized, with LOGS_EXPORTER
+	logger = telemetry.WithOTelLogs(logger, config.ServiceName)
+	slog.SetDefault(telemetry.WithBaggage(logger, baggageKeys).With("service", config.ServiceName))
+	for _, legacy := range config.LegacyEnv {
+		if legacy.InUse {
+			slog.Warn("Deprecated environment variable, use the new name", "old", legacy.Old, "new", legacy.New,
+				"removed_in", legacy.RemovedIn, "ignored", legacy.Ignored)
+		}
+	}
+	slog.Info("Starting service")
 
-	// Load configuration
-	config := LoadConfig()
+	// Initialize the sampling decision audit, if enabled
+	audit, err := newSamplingAudit(config.SamplingAudit)
+	if err != nil {
+		fatal("Failed to initialize sampling audit", err)
+	}
 
-	// Initialize the tracer
-	tp, err := initTracer(config)
+	// Initialize tracing and metrics
+	sampler, err := telemetry.NewRatioSampler(config.TraceSampleRatio)
 	if err != nil {
-		log.Fatalf("Failed to initialize tracer: %v", err)
+		fatal("Failed to initialize telemetry", err)
+	}
+	shutdownTelemetry, err := initTelemetry(config, sampler, audit)
+	if err != nil {
+		fatal("Failed to initialize telemetry", err)
 	}
 	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := tp.Shutdown(ctx); err != nil {
-			log.Printf("Error shutting down tracer provider: %v", err)
+		shutdownTelemetry()
+		if err := audit.Close(); err != nil {
+			slog.Error("Error closing sampling audit", "error", err)
 		}
 	}()
 
 	// Create and configure the application
-	app := NewApp(config)
+	app, err := NewApp(config, audit, Providers{
+		TracerProvider: otel.GetTracerProvider(),
+		MeterProvider:  otel.GetMeterProvider(),
+	})
+	if err != nil {
+		fatal("Failed to create application", err)
+	}
+
+	defer func() {
+		if err := app.Close(); err != nil {
+			slog.Error("Error closing application", "error", err)
+		}
+	}()
+
+	if err := logStartupBanner(app.effectiveConfig(), config.EffectiveConfigFile); err != nil {
+		slog.Error("Error reporting effective configuration", "error", err)
+	}
 
 	// Configure server
 	server := &http.Server{
@@ -300,9 +749,35 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 	}
 
-	// Start the server
-	log.Printf("Service-A starting on port %s", config.Port)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Failed to start server: %v", err)
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		fatal("Failed to start server", err)
 	}
+
+	// Serve until SIGINT or SIGTERM, then drain in-flight requests; the
+	// deferred calls close the app and flush telemetry afterwards
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Apply the reloadable settings on SIGHUP
+	reloader := newConfigReloader(config, func() (Config, error) {
+		src, err := settings.Load(os.Args[1:], os.Getenv)
+		if err != nil {
+			return Config{}, err
+		}
+		return LoadConfig(src)
+	}, app, &logLevel, sampler)
+	go reloader.watch(ctx)
+
+	slog.Info("Service-A starting", "port", config.Port)
+	if err := serveUntilDone(ctx, server, listener, config.ShutdownTimeout); err != nil {
+		slog.Error("Server shutdown", "error", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs msg with err and exits, as log.Fatalf does for plain logs
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg/telemetry/telemetrytest"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestMain installs the global propagator once, before any test runs, so
+// parallel tests never swap it out from under each other. Tracer and meter
+// providers are injected per App instead; -otel.export prints their spans.
+func TestMain(m *testing.M) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	os.Exit(telemetrytest.Main(m))
+}
+
+// fakeServiceBClient returns a canned service B result
+type fakeServiceBClient struct {
+	response *serviceBResponse
+	attempts int
+	err      error
+}
+
+func (f *fakeServiceBClient) FetchWeather(ctx context.Context, request serviceBRequest) (*serviceBResponse, int, error) {
+	return f.response, f.attempts, f.err
+}
+
+func testConfig(serviceBURL string) Config {
+	return Config{
+		ServiceBURL:         serviceBURL,
+		ServiceName:         "svc-a-test",
+		Timeout:             time.Second,
+		SlowThreshold:       time.Minute,
+		ServiceBMaxAttempts: 1,
+		Limits:              Limits{MaxBodyBytes: 4 << 10, MaxBatchCEPs: 20},
+		HealthTimeout:       time.Second,
+	}
+}
+
+func newTestApp(t *testing.T, config Config) *App {
+	t.Helper()
+	return newTestAppWithProviders(t, config, Providers{})
+}
+
+func newTestAppWithProviders(t *testing.T, config Config, providers Providers) *App {
+	t.Helper()
+	app, err := NewApp(config, nil, providers)
+	if err != nil {
+		t.Fatalf("failed to create app: %v", err)
+	}
+	return app
+}
+
+func TestHandleWeatherRequestValidation(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApp(t, testConfig("http://svc-b.invalid/weather"))
+	app.serviceB = &fakeServiceBClient{err: errors.New("service B must not be called")}
+
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Method not allowed",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   `{"error":"only POST method is allowed"}`,
+		},
+		{
+			name:           "Invalid JSON",
+			method:         http.MethodPost,
+			body:           `{"cep":`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid request format"}`,
+		},
+		{
+			name:           "Invalid CEP",
+			method:         http.MethodPost,
+			body:           `{"cep":"123"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"type":"about:blank","title":"Unprocessable Entity","status":422,"detail":"cep must have 8 digits","code":"cep_invalid_length","error":"invalid zipcode"}`,
+		},
+		{
+			name:           "CEP with letters",
+			method:         http.MethodPost,
+			body:           `{"cep":"2245000a"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"type":"about:blank","title":"Unprocessable Entity","status":422,"detail":"cep must only contain digits, optionally as 00000-000","code":"cep_invalid_characters","error":"invalid zipcode"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, "/weather", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			app.HandleWeatherRequest(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if gotBody := strings.TrimSpace(rr.Body.String()); gotBody != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v", gotBody, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestHandleWeatherRequestDownstreamMapping(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		client         *fakeServiceBClient
+		expectedStatus int
+		expectedError  string
+		expectMeta     bool
+	}{
+		{
+			name: "Success is forwarded without meta",
+			client: &fakeServiceBClient{
+				response: &serviceBResponse{StatusCode: http.StatusOK, Body: []byte(`{"city":"Rio de Janeiro","temp_C":25}`)},
+				attempts: 1,
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "Service B error is forwarded with meta",
+			client: &fakeServiceBClient{
+				response: &serviceBResponse{StatusCode: http.StatusNotFound, Body: []byte(`{"error":"can not find zipcode"}`)},
+				attempts: 1,
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "can not find zipcode",
+			expectMeta:     true,
+		},
+		{
+			name: "Retried success carries meta",
+			client: &fakeServiceBClient{
+				response: &serviceBResponse{StatusCode: http.StatusOK, Body: []byte(`{"city":"Rio de Janeiro","temp_C":25}`)},
+				attempts: 2,
+			},
+			expectedStatus: http.StatusOK,
+			expectMeta:     true,
+		},
+		{
+			name:           "Transport error",
+			client:         &fakeServiceBClient{err: errors.New("connection refused"), attempts: 3},
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  "error calling service B: connection refused",
+			expectMeta:     true,
+		},
+		{
+			name:           "Oversized response",
+			client:         &fakeServiceBClient{err: errServiceBResponseTooLarge, attempts: 1},
+			expectedStatus: http.StatusBadGateway,
+			expectedError:  "service B response too large",
+			expectMeta:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			app := newTestApp(t, testConfig("http://svc-b.invalid/weather"))
+			app.serviceB = tt.client
+
+			req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"22450000"}`))
+			rr := httptest.NewRecorder()
+
+			app.HandleWeatherRequest(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+
+			var body struct {
+				Error string        `json:"error"`
+				Meta  *ResponseMeta `json:"meta"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response is not valid JSON: %v", err)
+			}
+			if body.Error != tt.expectedError {
+				t.Errorf("handler returned unexpected error: got %q want %q", body.Error, tt.expectedError)
+			}
+			if (body.Meta != nil) != tt.expectMeta {
+				t.Errorf("unexpected meta block presence: got %+v, want present=%v", body.Meta, tt.expectMeta)
+			}
+			if body.Meta != nil && body.Meta.Attempts != tt.client.attempts {
+				t.Errorf("meta reports %d attempts, want %d", body.Meta.Attempts, tt.client.attempts)
+			}
+		})
+	}
+}
+
+func TestHandleWeatherRequestTimeout(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	serviceB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer serviceB.Close()
+	defer close(release)
+
+	config := testConfig(serviceB.URL + "/weather")
+	config.Timeout = 50 * time.Millisecond
+	config.ServiceBMaxAttempts = 3
+	app := newTestApp(t, config)
+
+	req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"22450000"}`))
+	rr := httptest.NewRecorder()
+
+	start := time.Now()
+	app.HandleWeatherRequest(rr, req)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("handler took %v, expected it to give up after the configured timeout", elapsed)
+	}
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+
+	var body ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+	if body.Meta == nil || body.Meta.Attempts != 1 {
+		t.Errorf("timeouts must not be retried, got meta %+v", body.Meta)
+	}
+}
+
+func TestHandleWeatherRequestForwardsTraceContext(t *testing.T) {
+	t.Parallel()
+
+	forwarded := make(chan string, 1)
+	serviceB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded <- r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"city":"Rio de Janeiro","temp_C":25,"temp_F":77,"temp_K":298.15}`))
+	}))
+	defer serviceB.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	providers := Providers{TracerProvider: telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))}
+	app := newTestAppWithProviders(t, testConfig(serviceB.URL+"/weather"), providers)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"22450000"}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+
+	app.setupRoutes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	traceparent := <-forwarded
+	if !strings.Contains(traceparent, traceID) {
+		t.Errorf("service B received traceparent %q, want it to continue trace %s", traceparent, traceID)
+	}
+
+	// The spans land in the injected provider, not the global one
+	spans := recorder.Ended()
+	if len(spans) == 0 {
+		t.Fatal("expected spans to be recorded by the injected tracer provider")
+	}
+	for _, span := range spans {
+		if span.SpanContext().TraceID().String() != traceID {
+			t.Errorf("span %q belongs to trace %s, want %s", span.Name(), span.SpanContext().TraceID(), traceID)
+		}
+	}
+}
+
+func TestErrorResponsesLinkToTraceInDevProfile(t *testing.T) {
+	t.Parallel()
+
+	for _, environment := range []string{"development", "production"} {
+		t.Run(environment, func(t *testing.T) {
+			t.Parallel()
+
+			config := testConfig("http://svc-b.invalid/weather")
+			config.Environment = environment
+			config.ZipkinUIURL = "http://localhost:9411/zipkin"
+			app := newTestAppWithProviders(t, config, Providers{TracerProvider: telemetrytest.NewTracerProvider(t)})
+
+			const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+			req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"123"}`))
+			req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+			rr := httptest.NewRecorder()
+
+			app.setupRoutes().ServeHTTP(rr, req)
+
+			var body ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response is not valid JSON: %v", err)
+			}
+
+			expected := ""
+			if environment == "development" {
+				expected = "http://localhost:9411/zipkin/traces/" + traceID
+			}
+			if body.TraceURL != expected {
+				t.Errorf("trace_url = %q, want %q", body.TraceURL, expected)
+			}
+		})
+	}
+}
+
+func TestHandleBatchRequestForwardsToServiceB(t *testing.T) {
+	t.Parallel()
+
+	const batch = `{"results":[{"cep":"22450000","status":200,"result":{"city":"Rio de Janeiro"}},{"cep":"123","status":422,"error":"invalid zipcode"}]}`
+	serviceB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/weather/batch" || r.URL.Query().Get("resolve") != "city" || string(body) != `{"ceps":["22450000","123"]}` {
+			t.Errorf("service B got %s %s with %s", r.Method, r.URL, body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(batch))
+	}))
+	t.Cleanup(serviceB.Close)
+
+	app := newTestApp(t, testConfig(serviceB.URL+"/weather"))
+	routes := app.setupRoutes()
+
+	tests := []struct {
+		name           string
+		accept         string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Forwards the batch", "", `{"ceps":["22450000","123"]}`, http.StatusOK, batch},
+		{"Rejects malformed bodies", "", `{"cep":"22450000"}`, http.StatusBadRequest, `{"error":"invalid request format"}`},
+		{"Rejects batches over the limit", "", `{"ceps":[` + strings.TrimSuffix(strings.Repeat(`"22450000",`, 21), ",") + `]}`, http.StatusRequestEntityTooLarge, `{"error":"too many ceps","limit":"max_batch_ceps"}`},
+		{"Serves XML on request", "application/xml", `{"ceps":["22450000","123"]}`, http.StatusOK, `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+			`<response><results><item><cep>22450000</cep><status>200</status><result><city>Rio de Janeiro</city></result></item>` +
+			`<item><cep>123</cep><status>422</status><error>invalid zipcode</error></item></results></response>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodPost, "/weather/batch?resolve=city", strings.NewReader(tt.body))
+			req.Header.Set("Accept", tt.accept)
+			rr := httptest.NewRecorder()
+			routes.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+			if body := strings.TrimSpace(rr.Body.String()); body != tt.expectedBody {
+				t.Errorf("body = %s, want %s", body, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestHandleLimits(t *testing.T) {
+	t.Parallel()
+
+	config := testConfig("http://svc-b.invalid/weather")
+	app := newTestApp(t, config)
+	limits := func() string {
+		rr := httptest.NewRecorder()
+		app.HandleLimits(rr, httptest.NewRequest(http.MethodGet, "/limits", nil))
+		return strings.TrimSpace(rr.Body.String())
+	}
+
+	if got, want := limits(), `{"max_body_bytes":4096,"max_batch_ceps":20}`; got != want {
+		t.Errorf("limits without rate limiting = %s, want %s", got, want)
+	}
+
+	limiter, err := newRateLimiter(RateLimitConfig{GlobalRPS: 10, PerIPRPS: 1, PerIPBurst: 2}, app.providers.Meters().Meter("test"), newFakeClock())
+	if err != nil {
+		t.Fatalf("failed to create rate limiter: %v", err)
+	}
+	app.rateLimiter = limiter
+	if got, want := limits(), `{"max_body_bytes":4096,"max_batch_ceps":20,"rate_limit_global":{"rps":10,"burst":10},"rate_limit_per_ip":{"rps":1,"burst":2}}`; got != want {
+		t.Errorf("limits = %s, want %s", got, want)
+	}
+
+	// Reloaded rates are reported as applied
+	limiter.update(RateLimitConfig{PerIPRPS: 5})
+	if got, want := limits(), `{"max_body_bytes":4096,"max_batch_ceps":20,"rate_limit_per_ip":{"rps":5,"burst":5}}`; got != want {
+		t.Errorf("limits after a reload = %s, want %s", got, want)
+	}
+}
+
+func TestHandleWeatherRequestForwardsIncludeAddress(t *testing.T) {
+	t.Parallel()
+
+	forwarded := make(chan string, 1)
+	serviceB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded <- r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"city":"Curvelo","address":{"city":"Curvelo","state":"MG"}}`))
+	}))
+	t.Cleanup(serviceB.Close)
+
+	app := newTestApp(t, testConfig(serviceB.URL+"/weather"))
+	rr := httptest.NewRecorder()
+	app.setupRoutes().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/weather?resolve=city&include_address=true", strings.NewReader(`{"cep":"35780000"}`)))
+
+	if got := <-forwarded; got != "include_address=true&resolve=city" {
+		t.Errorf("service B got query %q, want include_address=true&resolve=city", got)
+	}
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"city":"Curvelo","address":{"city":"Curvelo","state":"MG"}}` {
+		t.Errorf("body = %s, want service B's address", body)
+	}
+}
+
+func TestHandleWeatherRequestForwardsUnits(t *testing.T) {
+	t.Parallel()
+
+	forwarded := make(chan string, 1)
+	serviceB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded <- string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"city":"Rio de Janeiro","temp_K":298.15}`))
+	}))
+	t.Cleanup(serviceB.Close)
+
+	app := newTestApp(t, testConfig(serviceB.URL+"/weather"))
+	routes := app.setupRoutes()
+
+	tests := []struct {
+		name     string
+		query    string
+		body     string
+		expected string
+	}{
+		{"From the body", "", `{"cep":"22450-000","units":"kelvin"}`, `{"cep":"22450000","units":"kelvin"}`},
+		{"From the query", "?units=celsius", `{"cep":"22450000","units":"kelvin"}`, `{"cep":"22450000","units":"celsius"}`},
+		{"None", "", `{"cep":"22450000"}`, `{"cep":"22450000"}`},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/weather"+tt.query, strings.NewReader(tt.body)))
+
+		if got := <-forwarded; got != tt.expected {
+			t.Errorf("%s: service B got %s, want %s", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestWithMetaKeepsServiceBMeta(t *testing.T) {
+	t.Parallel()
+
+	body := withMeta([]byte(`{"city":"Manaus","meta":{"weather_provider":"openweathermap"}}`), ResponseMeta{Attempts: 2})
+
+	var decoded struct {
+		Meta map[string]any `json:"meta"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+	if decoded.Meta["weather_provider"] != "openweathermap" || decoded.Meta["attempts"] != float64(2) {
+		t.Errorf("meta = %v, want service B's weather_provider alongside the attempts", decoded.Meta)
+	}
+}
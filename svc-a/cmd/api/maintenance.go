@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maintenanceHeader marks a 503 as planned maintenance, on svc-a's responses
+// and on the ones it receives from service B
+const maintenanceHeader = "X-Maintenance"
+
+// maintenanceState is the maintenance switch as set from the environment or
+// PUT /admin/maintenance
+type maintenanceState struct {
+	Enabled bool `json:"enabled"`
+	// Message tells clients what is going on, e.g. the planned end
+	Message string `json:"message,omitempty"`
+	// RetryAfterSeconds is sent as Retry-After on every rejected request
+	RetryAfterSeconds int `json:"retry_after_seconds,omitempty"`
+	// Since is when maintenance was turned on
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// maintenanceResponse is the body of requests rejected during maintenance,
+// matching service B's
+type maintenanceResponse struct {
+	Error             string     `json:"error"`
+	Message           string     `json:"message,omitempty"`
+	RetryAfterSeconds int        `json:"retry_after_seconds,omitempty"`
+	Since             *time.Time `json:"since,omitempty"`
+}
+
+// maintenanceMode answers /weather with 503 while enabled, for planned
+// upstream outages
+type maintenanceMode struct {
+	mu    sync.RWMutex
+	state maintenanceState
+}
+
+func newMaintenanceMode(config Config) *maintenanceMode {
+	m := &maintenanceMode{}
+	m.set(maintenanceState{
+		Enabled:           config.MaintenanceMode,
+		Message:           config.MaintenanceMessage,
+		RetryAfterSeconds: config.MaintenanceRetrySeconds,
+	})
+	return m
+}
+
+func (m *maintenanceMode) current() maintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// set replaces the state, keeping Since while maintenance stays on
+func (m *maintenanceMode) set(state maintenanceState) maintenanceState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state.Since = nil
+	if state.Enabled {
+		state.Since = m.state.Since
+		if state.Since == nil {
+			now := time.Now().UTC()
+			state.Since = &now
+		}
+	}
+	m.state = state
+	return state
+}
+
+// middleware rejects requests while maintenance is on. It runs inside the
+// outcome middleware, so rejected requests are still traced and counted.
+func (m *maintenanceMode) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := m.current()
+		if !state.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		setOutcome(ctx, outcomeMaintenance)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("maintenance", true))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(maintenanceHeader, "true")
+		if state.RetryAfterSeconds > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(state.RetryAfterSeconds))
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(maintenanceResponse{
+			Error:             "service under maintenance",
+			Message:           state.Message,
+			RetryAfterSeconds: state.RetryAfterSeconds,
+			Since:             state.Since,
+		})
+	})
+}
+
+// handleAdmin serves GET and PUT /admin/maintenance, authenticated by the
+// admin token
+func (m *maintenanceMode) handleAdmin(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			slog.WarnContext(r.Context(), "Maintenance change denied", "remote_addr", r.RemoteAddr)
+			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, m.current())
+		case http.MethodPut:
+			var req maintenanceState
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil || req.RetryAfterSeconds < 0 {
+				writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid maintenance request"})
+				return
+			}
+			state := m.set(req)
+			slog.InfoContext(r.Context(), "Maintenance mode changed", "remote_addr", r.RemoteAddr,
+				"enabled", state.Enabled, "message", state.Message, "retry_after_seconds", state.RetryAfterSeconds)
+			writeJSON(w, http.StatusOK, state)
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "only GET and PUT methods are allowed"})
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	t.Parallel()
+
+	config := testConfig("http://svc-b.invalid/weather")
+	config.MaintenanceMode = true
+	config.MaintenanceRetrySeconds = 600
+	config.AdminToken = "admin-token"
+	app := newTestApp(t, config)
+	app.serviceB = &fakeServiceBClient{response: &serviceBResponse{StatusCode: http.StatusOK, Body: []byte(`{}`)}, attempts: 1}
+	routes := app.setupRoutes()
+
+	weather := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"01001000"}`)))
+		return rr
+	}
+	admin := func(token, body string) int {
+		req := httptest.NewRequest(http.MethodPut, "/admin/maintenance", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	rr := weather()
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "600" || rr.Header().Get(maintenanceHeader) != "true" {
+		t.Fatalf("during maintenance: status %d, headers %v; want 503 with Retry-After 600", rr.Code, rr.Header())
+	}
+
+	health := httptest.NewRecorder()
+	routes.ServeHTTP(health, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if health.Code != http.StatusOK {
+		t.Errorf("/health during maintenance = %d, want 200", health.Code)
+	}
+
+	if code := admin("guess", `{"enabled":false}`); code != http.StatusUnauthorized {
+		t.Errorf("PUT with a wrong token = %d, want 401", code)
+	}
+	if code := admin("admin-token", `{"enabled":false}`); code != http.StatusOK {
+		t.Fatalf("PUT = %d, want 200", code)
+	}
+	if rr := weather(); rr.Code != http.StatusOK {
+		t.Errorf("after maintenance: status %d, want 200", rr.Code)
+	}
+}
+
+func TestServiceBMaintenanceIsForwarded(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApp(t, testConfig("http://svc-b.invalid/weather"))
+	app.serviceB = &fakeServiceBClient{response: &serviceBResponse{
+		StatusCode:  http.StatusServiceUnavailable,
+		Body:        []byte(`{"error":"service under maintenance"}`),
+		RetryAfter:  "120",
+		Maintenance: true,
+	}, attempts: 1}
+
+	rr := httptest.NewRecorder()
+	app.setupRoutes().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"01001000"}`)))
+
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "120" || rr.Header().Get(maintenanceHeader) != "true" {
+		t.Errorf("status %d, headers %v; want service B's 503 with its Retry-After", rr.Code, rr.Header())
+	}
+}
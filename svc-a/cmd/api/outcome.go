@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// outcome is the canonical classification of how a request ended. The values
+// match svc-b's observability.Outcome so dashboards across services agree.
+type outcome string
+
+const (
+	outcomeSuccess         outcome = "success"
+	outcomeClientError     outcome = "client_error"
+	outcomeValidationError outcome = "validation_error"
+	outcomeUpstreamTimeout outcome = "upstream_timeout"
+	outcomeUpstreamError   outcome = "upstream_error"
+	outcomeThrottled       outcome = "throttled"
+	outcomeCancelled       outcome = "cancelled"
+	outcomeInternal        outcome = "internal"
+	outcomeMaintenance     outcome = "maintenance"
+)
+
+// outcomeAttribute is the span attribute carrying the request outcome
+const outcomeAttribute = "request.outcome"
+
+type outcomeKey struct{}
+
+// outcomeHolder lets the handler classify a request the middleware observes
+type outcomeHolder struct {
+	mu      sync.Mutex
+	outcome outcome
+}
+
+// setOutcome classifies the request explicitly; the first classification wins
+func setOutcome(ctx context.Context, o outcome) {
+	holder, ok := ctx.Value(outcomeKey{}).(*outcomeHolder)
+	if !ok {
+		return
+	}
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+	if holder.outcome == "" {
+		holder.outcome = o
+	}
+}
+
+func (h *outcomeHolder) resolve(ctx context.Context, status int) outcome {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.outcome != "" {
+		return h.outcome
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return outcomeCancelled
+	}
+	return outcomeFromStatus(status)
+}
+
+// outcomeFromStatus derives the outcome from a response status code
+func outcomeFromStatus(status int) outcome {
+	switch {
+	case status < http.StatusBadRequest:
+		return outcomeSuccess
+	case status == http.StatusBadRequest,
+		status == http.StatusRequestEntityTooLarge,
+		status == http.StatusUnprocessableEntity:
+		return outcomeValidationError
+	case status == http.StatusTooManyRequests:
+		return outcomeThrottled
+	case status == 499:
+		return outcomeCancelled
+	case status == http.StatusBadGateway:
+		return outcomeUpstreamError
+	case status == http.StatusGatewayTimeout:
+		return outcomeUpstreamTimeout
+	case status < http.StatusInternalServerError:
+		return outcomeClientError
+	default:
+		return outcomeInternal
+	}
+}
+
+// outcomeFromError classifies an error returned by the call to service B
+func outcomeFromError(err error) outcome {
+	if errors.Is(err, context.Canceled) {
+		return outcomeCancelled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return outcomeUpstreamTimeout
+	}
+	var timeoutErr interface{ Timeout() bool }
+	if errors.As(err, &timeoutErr) && timeoutErr.Timeout() {
+		return outcomeUpstreamTimeout
+	}
+	return outcomeUpstreamError
+}
+
+// outcomeRecorder captures the status code written by the wrapped handler
+type outcomeRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *outcomeRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// outcomeMiddleware classifies every request once, recording the outcome on
+// the server span, the request metrics and, for failures, the log
+func (app *App) outcomeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		holder := &outcomeHolder{}
+		ctx := context.WithValue(r.Context(), outcomeKey{}, holder)
+		recorder := &outcomeRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		o := holder.resolve(ctx, recorder.status)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String(outcomeAttribute, string(o)))
+		if o != outcomeSuccess {
+			slog.WarnContext(ctx, "Request finished", "method", r.Method, "path", r.URL.Path, "outcome", o, "status", recorder.status)
+		}
+		attrs := metric.WithAttributes(
+			attribute.String("route", r.URL.Path),
+			attribute.Int("status_code", recorder.status),
+			attribute.String("outcome", string(o)),
+		)
+		app.requests.Add(ctx, 1, attrs)
+		app.durations.Record(ctx, float64(time.Since(start).Microseconds())/1000, attrs)
+	})
+}
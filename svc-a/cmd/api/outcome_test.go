@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pkg/telemetry/telemetrytest"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRequestOutcomeClassification(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		body     string
+		client   *fakeServiceBClient
+		expected outcome
+	}{
+		{
+			name: "Success",
+			body: `{"cep":"22450000"}`,
+			client: &fakeServiceBClient{
+				response: &serviceBResponse{StatusCode: http.StatusOK, Body: []byte(`{"city":"Rio de Janeiro"}`)},
+				attempts: 1,
+			},
+			expected: outcomeSuccess,
+		},
+		{
+			name:     "Invalid CEP",
+			body:     `{"cep":"123"}`,
+			client:   &fakeServiceBClient{},
+			expected: outcomeValidationError,
+		},
+		{
+			name: "Not found in service B",
+			body: `{"cep":"99999999"}`,
+			client: &fakeServiceBClient{
+				response: &serviceBResponse{StatusCode: http.StatusNotFound, Body: []byte(`{"error":"can not find zipcode"}`)},
+				attempts: 1,
+			},
+			expected: outcomeClientError,
+		},
+		{
+			name: "Service B failure",
+			body: `{"cep":"22450000"}`,
+			client: &fakeServiceBClient{
+				response: &serviceBResponse{StatusCode: http.StatusInternalServerError, Body: []byte(`{"error":"internal server error"}`)},
+				attempts: 1,
+			},
+			expected: outcomeUpstreamError,
+		},
+		{
+			name:     "Service B timeout",
+			body:     `{"cep":"22450000"}`,
+			client:   &fakeServiceBClient{err: fmt.Errorf("request failed: %w", context.DeadlineExceeded), attempts: 1},
+			expected: outcomeUpstreamTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := tracetest.NewSpanRecorder()
+			providers := Providers{TracerProvider: telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))}
+			app := newTestAppWithProviders(t, testConfig("http://svc-b.invalid/weather"), providers)
+			app.serviceB = tt.client
+
+			req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(tt.body))
+			app.setupRoutes().ServeHTTP(httptest.NewRecorder(), req)
+
+			var got string
+			for _, span := range recorder.Ended() {
+				for _, attr := range span.Attributes() {
+					if string(attr.Key) == outcomeAttribute {
+						got = attr.Value.AsString()
+					}
+				}
+			}
+			if got != string(tt.expected) {
+				t.Errorf("%s = %q, want %q", outcomeAttribute, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRequestMetricsByStatusCode(t *testing.T) {
+	t.Parallel()
+
+	reader := sdkmetric.NewManualReader()
+	providers := Providers{MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))}
+	app := newTestAppWithProviders(t, testConfig("http://svc-b.invalid/weather"), providers)
+	app.serviceB = &fakeServiceBClient{}
+
+	req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"123"}`))
+	app.setupRoutes().ServeHTTP(httptest.NewRecorder(), req)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+
+	var found bool
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			histogram, ok := m.Data.(metricdata.Histogram[float64])
+			if m.Name != "svc_a.request.duration" || !ok {
+				continue
+			}
+			found = true
+			status, _ := histogram.DataPoints[0].Attributes.Value("status_code")
+			if status.AsInt64() != http.StatusUnprocessableEntity {
+				t.Errorf("status_code = %d, want %d", status.AsInt64(), http.StatusUnprocessableEntity)
+			}
+		}
+	}
+	if !found {
+		t.Error("svc_a.request.duration was not recorded")
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/settings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Rate limit scopes, reported in the limit member of 429 bodies, the
+// rejection metric and span events
+const (
+	rateLimitGlobal = "rate_limit_global"
+	rateLimitPerIP  = "rate_limit_per_ip"
+)
+
+// clientBucketIdle is how often idle client buckets are dropped; a bucket
+// idle long enough to refill is the same as a new one
+const clientBucketIdle = time.Minute
+
+// maxClientBuckets bounds the client buckets held in memory. Past it the
+// least recently seen client is forgotten, and starts over with a full bucket.
+const maxClientBuckets = 10000
+
+// RateLimitConfig holds the token buckets guarding /weather. A zero rate
+// disables its bucket; a zero burst allows one second of the rate.
+type RateLimitConfig struct {
+	GlobalRPS   float64
+	GlobalBurst int
+	PerIPRPS    float64
+	PerIPBurst  int
+	// ClientIPHeader names the header carrying the client address when svc-a
+	// runs behind a proxy that sets it, e.g. X-Forwarded-For. It is only read
+	// on requests from TrustedProxies.
+	ClientIPHeader string
+	TrustedProxies []netip.Prefix
+}
+
+// enabled reports whether either bucket is on
+func (c RateLimitConfig) enabled() bool {
+	return c.GlobalRPS > 0 || c.PerIPRPS > 0
+}
+
+// trustedProxies reads key's comma-separated CIDRs, taking bare addresses as
+// single hosts
+func trustedProxies(src *settings.Source, key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, item := range src.List(key, nil) {
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(item)
+			if addrErr != nil {
+				src.Invalid(key, item, errors.New("want a CIDR, e.g. 10.0.0.0/8, or an address"))
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// formatPrefixes lists prefixes as trustedProxies reads them
+func formatPrefixes(prefixes []netip.Prefix) string {
+	items := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		items[i] = prefix.String()
+	}
+	return strings.Join(items, ",")
+}
+
+// tokenBucket holds up to burst tokens, refilled at rate per second
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket up to now and spends n tokens, or reports how long
+// until they are available. A request costing more than the burst goes
+// through on a full bucket and leaves it in debt, so it is still paid for in
+// full before the next one.
+func (b *tokenBucket) take(now time.Time, n int, rate float64, burst int) (bool, time.Duration) {
+	b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	need := float64(min(n, burst))
+	if b.tokens >= need {
+		b.tokens -= float64(n)
+		return true, 0
+	}
+	return false, time.Duration((need - b.tokens) / rate * float64(time.Second))
+}
+
+// clientBucket is a client's bucket, in the least recently seen order
+type clientBucket struct {
+	tokenBucket
+	client string
+}
+
+// rateLimiter rejects /weather requests above the global rate or a client's
+// rate with 429, so a public svc-a can't be used to flood service B and the
+// providers behind it
+type rateLimiter struct {
+	mu      sync.Mutex
+	config  RateLimitConfig
+	clock   Clock
+	global  *tokenBucket
+	clients map[string]*list.Element
+	// order holds the client buckets, most recently seen first
+	order     *list.List
+	lastPrune time.Time
+	rejected  metric.Int64Counter
+}
+
+// newRateLimiter returns nil when both rates are zero
+func newRateLimiter(config RateLimitConfig, meter metric.Meter, clock Clock) (*rateLimiter, error) {
+	if !config.enabled() {
+		return nil, nil
+	}
+	config = withDefaultBursts(config)
+
+	now := clock.Now()
+	l := &rateLimiter{
+		config:    config,
+		clock:     clock,
+		clients:   make(map[string]*list.Element),
+		order:     list.New(),
+		lastPrune: now,
+	}
+	if config.GlobalRPS > 0 {
+		l.global = &tokenBucket{tokens: float64(config.GlobalBurst), last: now}
+	}
+
+	var err error
+	l.rejected, err = meter.Int64Counter("svc_a.rate_limit.rejections",
+		metric.WithDescription("Requests rejected by the rate limiter, by scope"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rate limit counter: %w", err)
+	}
+
+	available, err := meter.Float64ObservableGauge("svc_a.rate_limit.global.available",
+		metric.WithDescription("Tokens left in the global rate limit bucket"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rate limit gauge: %w", err)
+	}
+	clients, err := meter.Int64ObservableGauge("svc_a.rate_limit.clients",
+		metric.WithDescription("Clients with a rate limit bucket in memory"),
+		metric.WithUnit("{client}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rate limit gauge: %w", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.global != nil {
+			o.ObserveFloat64(available, min(float64(l.config.GlobalBurst), l.global.tokens+l.clock.Now().Sub(l.global.last).Seconds()*l.config.GlobalRPS))
+		}
+		o.ObserveInt64(clients, int64(len(l.clients)))
+		return nil
+	}, available, clients)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register rate limit gauges: %w", err)
+	}
+	return l, nil
+}
+
+// withDefaultBursts gives the buckets without a burst one second of their rate
+func withDefaultBursts(config RateLimitConfig) RateLimitConfig {
+	if config.GlobalBurst <= 0 {
+		config.GlobalBurst = int(math.Ceil(config.GlobalRPS))
+	}
+	if config.PerIPBurst <= 0 {
+		config.PerIPBurst = int(math.Ceil(config.PerIPRPS))
+	}
+	return config
+}
+
+// update applies reloaded limits. Buckets keep their tokens, capped at the
+// new bursts as they refill; a bucket whose rate drops to zero goes away, and
+// one whose rate becomes non-zero starts full, so the limiter can be turned
+// off live. A nil rateLimiter stays off, as turning the limiter on takes a
+// restart.
+func (l *rateLimiter) update(config RateLimitConfig) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	config = withDefaultBursts(config)
+	now := l.clock.Now()
+	switch {
+	case config.GlobalRPS <= 0:
+		l.global = nil
+	case l.global == nil:
+		l.global = &tokenBucket{tokens: float64(config.GlobalBurst), last: now}
+	}
+	if config.PerIPRPS <= 0 {
+		clear(l.clients)
+		l.order.Init()
+	}
+	l.config = config
+}
+
+// limits reports the rates and bursts in effect, nil for the buckets off
+func (l *rateLimiter) limits() (global, perIP *RateLimit) {
+	if l == nil {
+		return nil, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.config.GlobalRPS > 0 {
+		global = &RateLimit{RPS: l.config.GlobalRPS, Burst: l.config.GlobalBurst}
+	}
+	if l.config.PerIPRPS > 0 {
+		perIP = &RateLimit{RPS: l.config.PerIPRPS, Burst: l.config.PerIPBurst}
+	}
+	return global, perIP
+}
+
+// allow spends cost tokens from the client's bucket and the global one, in
+// that order so a single client can't drain the global bucket once limited
+func (l *rateLimiter) allow(client string, cost int) (bool, string, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	if l.config.PerIPRPS > 0 {
+		l.prune(now)
+		if ok, retryAfter := l.bucket(client, now).take(now, cost, l.config.PerIPRPS, l.config.PerIPBurst); !ok {
+			return false, rateLimitPerIP, retryAfter
+		}
+	}
+	if l.global != nil {
+		if ok, retryAfter := l.global.take(now, cost, l.config.GlobalRPS, l.config.GlobalBurst); !ok {
+			return false, rateLimitGlobal, retryAfter
+		}
+	}
+	return true, "", 0
+}
+
+// bucket returns the client's bucket, creating a full one for a new client
+// and forgetting the least recently seen client past maxClientBuckets
+func (l *rateLimiter) bucket(client string, now time.Time) *clientBucket {
+	if elem, ok := l.clients[client]; ok {
+		l.order.MoveToFront(elem)
+		return elem.Value.(*clientBucket)
+	}
+	if l.order.Len() >= maxClientBuckets {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.clients, oldest.Value.(*clientBucket).client)
+	}
+	bucket := &clientBucket{tokenBucket: tokenBucket{tokens: float64(l.config.PerIPBurst), last: now}, client: client}
+	l.clients[client] = l.order.PushFront(bucket)
+	return bucket
+}
+
+// prune drops the client buckets that have refilled since their last request
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < clientBucketIdle {
+		return
+	}
+	l.lastPrune = now
+	refill := time.Duration(float64(l.config.PerIPBurst) / l.config.PerIPRPS * float64(time.Second))
+	// The least recently seen buckets are at the back
+	for elem := l.order.Back(); elem != nil; elem = l.order.Back() {
+		bucket := elem.Value.(*clientBucket)
+		if now.Sub(bucket.last) < refill {
+			break
+		}
+		l.order.Remove(elem)
+		delete(l.clients, bucket.client)
+	}
+}
+
+// clientIP is the address requests are limited by: the peer's, unless it is
+// a trusted proxy, in which case the rightmost address in ClientIPHeader that
+// isn't one of the trusted proxies. Addresses left of it were supplied by the
+// client and could be anything.
+func (l *rateLimiter) clientIP(r *http.Request) string {
+	l.mu.Lock()
+	header, trusted := l.config.ClientIPHeader, l.config.TrustedProxies
+	l.mu.Unlock()
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if header == "" || err != nil || !isTrusted(peer, trusted) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values(header), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// A proxy we trust wrote something else than an address
+			return host
+		}
+		if !isTrusted(hop, trusted) {
+			return hop.Unmap().String()
+		}
+		host = hop.Unmap().String()
+	}
+	// Every hop is a trusted proxy, so the request started in one
+	return host
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestCost is how many tokens a request spends
+type requestCost func(r *http.Request) int
+
+// singleRequest costs every request one token
+func singleRequest(*http.Request) int {
+	return 1
+}
+
+// batchCost costs a batch one token per CEP, so a batch can't look up more
+// CEPs than the same client could one by one. The body is read ahead, up to
+// the body limit, and handed on untouched; a batch the handler will reject
+// costs one token.
+func batchCost(limits Limits) requestCost {
+	return func(r *http.Request) int {
+		head, err := io.ReadAll(io.LimitReader(r.Body, limits.MaxBodyBytes+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+		if err != nil || int64(len(head)) > limits.MaxBodyBytes {
+			return 1
+		}
+
+		var batch BatchRequest
+		if json.Unmarshal(head, &batch) != nil || len(batch.CEPs) > limits.MaxBatchCEPs {
+			return 1
+		}
+		return max(len(batch.CEPs), 1)
+	}
+}
+
+// middleware answers 429 with Retry-After to requests over a limit, each
+// spending cost tokens. It runs inside the outcome middleware, so rejected
+// requests are still traced and counted, as throttled. A nil rateLimiter lets
+// every request through.
+func (l *rateLimiter) middleware(next http.Handler, cost requestCost) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, scope, retryAfter := l.allow(l.clientIP(r), cost(r))
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		setOutcome(ctx, outcomeThrottled)
+		l.rejected.Add(ctx, 1, metric.WithAttributes(attribute.String("scope", scope)))
+		trace.SpanFromContext(ctx).AddEvent("rate_limit.rejected", trace.WithAttributes(
+			attribute.String("rate_limit.scope", scope),
+			attribute.Int("rate_limit.retry_after_seconds", seconds),
+		))
+
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		writeJSON(w, http.StatusTooManyRequests, ErrorResponse{Error: "rate limit exceeded", Limit: scope})
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg/telemetry/telemetrytest"
+
+	"go.opentelemetry.io/otel/metric/noop"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	config := testConfig("http://svc-b.invalid/weather")
+	config.RateLimit = RateLimitConfig{
+		GlobalRPS: 10, GlobalBurst: 3, PerIPRPS: 1, PerIPBurst: 2,
+		ClientIPHeader: "X-Forwarded-For",
+		// httptest's remote address and the proxy in front of it
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("192.0.2.1/32"), netip.MustParsePrefix("10.0.0.0/8")},
+	}
+	app := newTestAppWithProviders(t, config, Providers{TracerProvider: telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))})
+	app.serviceB = &fakeServiceBClient{response: &serviceBResponse{StatusCode: http.StatusOK, Body: []byte(`{}`)}, attempts: 1}
+
+	clock := newFakeClock()
+	limiter, err := newRateLimiter(config.RateLimit, app.providers.Meters().Meter("test"), clock)
+	if err != nil {
+		t.Fatalf("failed to create rate limiter: %v", err)
+	}
+	app.rateLimiter = limiter
+	routes := app.setupRoutes()
+
+	weather := func(client string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"01001000"}`))
+		req.Header.Set("X-Forwarded-For", client+", 10.0.0.254")
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+		return rr
+	}
+	rejectedBy := func(rr *httptest.ResponseRecorder) string {
+		var body ErrorResponse
+		json.NewDecoder(rr.Body).Decode(&body)
+		return body.Limit
+	}
+
+	for i := range 2 {
+		if rr := weather("203.0.113.1"); rr.Code != http.StatusOK {
+			t.Fatalf("request %d within the client's burst = %d, want 200", i+1, rr.Code)
+		}
+	}
+	rr := weather("203.0.113.1")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" || rejectedBy(rr) != rateLimitPerIP {
+		t.Fatalf("request over the client's burst: status %d, Retry-After %q; want 429 from %s with Retry-After 1", rr.Code, rr.Header().Get("Retry-After"), rateLimitPerIP)
+	}
+
+	if rr := weather("203.0.113.2"); rr.Code != http.StatusOK {
+		t.Fatalf("another client = %d, want 200", rr.Code)
+	}
+	if rr := weather("203.0.113.3"); rr.Code != http.StatusTooManyRequests || rejectedBy(rr) != rateLimitGlobal {
+		t.Fatalf("request over the global burst = %d, want 429 from %s", rr.Code, rateLimitGlobal)
+	}
+
+	clock.Sleep(context.Background(), time.Second)
+	if rr := weather("203.0.113.1"); rr.Code != http.StatusOK {
+		t.Errorf("client after refilling = %d, want 200", rr.Code)
+	}
+
+	events := 0
+	for _, span := range recorder.Ended() {
+		for _, event := range span.Events() {
+			if event.Name == "rate_limit.rejected" {
+				events++
+			}
+		}
+	}
+	if events != 2 {
+		t.Errorf("got %d rate_limit.rejected span events, want 2", events)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		trusted    []netip.Prefix
+		expected   string
+	}{
+		{"No proxy", "203.0.113.1:1234", nil, trusted, "203.0.113.1"},
+		{"Untrusted peer", "203.0.113.1:1234", []string{"198.51.100.7"}, trusted, "203.0.113.1"},
+		{"No trusted proxies", "10.0.0.1:1234", []string{"198.51.100.7"}, nil, "10.0.0.1"},
+		{"Trusted peer", "10.0.0.1:1234", []string{"198.51.100.7"}, trusted, "198.51.100.7"},
+		{"Spoofed hop", "10.0.0.1:1234", []string{"192.0.2.99, 198.51.100.7"}, trusted, "198.51.100.7"},
+		{"Chained proxies", "10.0.0.1:1234", []string{"192.0.2.99, 198.51.100.7, 10.0.0.2"}, trusted, "198.51.100.7"},
+		{"Repeated header", "10.0.0.1:1234", []string{"192.0.2.99", "198.51.100.7, 10.0.0.2"}, trusted, "198.51.100.7"},
+		{"Only proxies", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, trusted, "10.0.0.3"},
+		{"Garbage hop", "10.0.0.1:1234", []string{"198.51.100.7, unknown"}, trusted, "10.0.0.1"},
+		{"IPv6", "[2001:db8::1]:1234", []string{"2001:db8:ffff::1, 2001:db9::7"}, trusted, "2001:db9::7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			limiter, err := newRateLimiter(RateLimitConfig{PerIPRPS: 1, ClientIPHeader: "X-Forwarded-For", TrustedProxies: tt.trusted},
+				noop.NewMeterProvider().Meter("test"), newFakeClock())
+			if err != nil {
+				t.Fatalf("failed to create rate limiter: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/weather", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if got := limiter.clientIP(req); got != tt.expected {
+				t.Errorf("clientIP() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRateLimiterBoundsClients(t *testing.T) {
+	t.Parallel()
+
+	clock := newFakeClock()
+	limiter, err := newRateLimiter(RateLimitConfig{PerIPRPS: 1, PerIPBurst: 1}, noop.NewMeterProvider().Meter("test"), clock)
+	if err != nil {
+		t.Fatalf("failed to create rate limiter: %v", err)
+	}
+
+	limiter.allow("first", 1)
+	for i := range maxClientBuckets {
+		limiter.allow(fmt.Sprintf("client-%d", i), 1)
+	}
+	if len(limiter.clients) != maxClientBuckets || limiter.order.Len() != maxClientBuckets {
+		t.Fatalf("holding %d buckets, want at most %d", len(limiter.clients), maxClientBuckets)
+	}
+	if _, ok := limiter.clients["first"]; ok {
+		t.Error("the least recently seen client was kept")
+	}
+	if ok, _, _ := limiter.allow("client-0", 1); ok {
+		t.Error("a recently seen client got a fresh bucket")
+	}
+}
+
+func TestRateLimiterChargesBatchesPerCEP(t *testing.T) {
+	t.Parallel()
+
+	config := testConfig("http://svc-b.invalid/weather")
+	config.RateLimit = RateLimitConfig{PerIPRPS: 1, PerIPBurst: 3}
+	app := newTestApp(t, config)
+	app.serviceB = &fakeServiceBClient{response: &serviceBResponse{StatusCode: http.StatusOK, Body: []byte(`{"results":[]}`)}, attempts: 1}
+
+	clock := newFakeClock()
+	limiter, err := newRateLimiter(config.RateLimit, app.providers.Meters().Meter("test"), clock)
+	if err != nil {
+		t.Fatalf("failed to create rate limiter: %v", err)
+	}
+	app.rateLimiter = limiter
+	routes := app.setupRoutes()
+
+	batch := func(ceps ...string) int {
+		body, _ := json.Marshal(BatchRequest{CEPs: ceps})
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/weather/batch", bytes.NewReader(body)))
+		return rr.Code
+	}
+
+	if code := batch("01001000", "22450000"); code != http.StatusOK {
+		t.Fatalf("batch within the burst = %d, want 200", code)
+	}
+	if code := batch("01001000", "22450000"); code != http.StatusTooManyRequests {
+		t.Fatalf("batch over the tokens left = %d, want 429", code)
+	}
+	if code := batch("01001000"); code != http.StatusOK {
+		t.Fatalf("batch of the last token = %d, want 200 with its body intact", code)
+	}
+
+	// A batch larger than the burst waits for a full bucket and is paid in full
+	clock.Sleep(context.Background(), 3*time.Second)
+	if code := batch("01001000", "22450000", "69005000", "40010000", "50010000"); code != http.StatusOK {
+		t.Fatalf("batch over the burst on a full bucket = %d, want 200", code)
+	}
+	clock.Sleep(context.Background(), time.Second)
+	if code := batch("01001000"); code != http.StatusTooManyRequests {
+		t.Errorf("request while the bucket is in debt = %d, want 429", code)
+	}
+}
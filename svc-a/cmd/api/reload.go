@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"pkg/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// reloadableKeys are the settings a reload applies while svc-a serves; the
+// others take a restart
+var reloadableKeys = []string{
+	"LOG_LEVEL",
+	"TRACE_SAMPLE_RATIO",
+	"TIMEOUT_SECONDS",
+	"RATE_LIMIT_GLOBAL_RPS",
+	"RATE_LIMIT_GLOBAL_BURST",
+	"RATE_LIMIT_PER_IP_RPS",
+	"RATE_LIMIT_PER_IP_BURST",
+	"RATE_LIMIT_IP_HEADER",
+	"RATE_LIMIT_TRUSTED_PROXIES",
+}
+
+// configReloader loads the configuration again on SIGHUP, e.g. after the
+// config file was edited, and applies the reloadable settings that changed
+type configReloader struct {
+	// current is guarded by the app's configMu, with the effective
+	// configuration it reports
+	current Config
+	load    func() (Config, error)
+	app     *App
+	level   *slog.LevelVar
+	sampler *telemetry.RatioSampler
+}
+
+func newConfigReloader(current Config, load func() (Config, error), app *App, level *slog.LevelVar, sampler *telemetry.RatioSampler) *configReloader {
+	return &configReloader{current: current, load: load, app: app, level: level, sampler: sampler}
+}
+
+// watch reloads on every SIGHUP until ctx is done
+func (r *configReloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reload(context.Background())
+		}
+	}
+}
+
+// reload applies the reloadable settings of the loaded configuration,
+// returning the keys it changed. A configuration that fails to load or
+// apply leaves the current one in place. The reload is traced with a
+// config.changed event listing the keys changed and those awaiting a restart.
+func (r *configReloader) reload(ctx context.Context) ([]string, error) {
+	ctx, span := r.app.tracer.Start(ctx, "config.reload")
+	defer span.End()
+
+	next, err := r.load()
+	if err == nil {
+		err = r.apply(next)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Configuration reload failed, keeping the current one", "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	r.app.configMu.Lock()
+	changed, restart := diffConfig(r.current, next)
+	if r.app.rateLimiter == nil && next.RateLimit.enabled() {
+		// The limiter is only set up at startup, so until then the rate
+		// limits stay off
+		changed, restart = awaitRestart(changed, restart, "RATE_LIMIT_")
+		next.RateLimit = r.current.RateLimit
+	}
+	r.current.LogLevel = next.LogLevel
+	r.current.TraceSampleRatio = next.TraceSampleRatio
+	r.current.Timeout = next.Timeout
+	r.current.RateLimit = next.RateLimit
+	effective := newEffectiveConfig(r.current)
+	effective.StartedAt = r.app.effective.StartedAt
+	r.app.effective = effective
+	r.app.configMu.Unlock()
+
+	span.AddEvent("config.changed", trace.WithAttributes(
+		attribute.StringSlice("config.changed_keys", changed),
+		attribute.StringSlice("config.restart_keys", restart),
+	))
+	slog.InfoContext(ctx, "Configuration reloaded", "changed", changed)
+	if len(restart) > 0 {
+		slog.WarnContext(ctx, "Configuration changes awaiting a restart", "keys", restart)
+	}
+	return changed, nil
+}
+
+// apply hands the reloadable settings to the logger, sampler, rate limiter
+// and service B calls, once they are all known to be valid
+func (r *configReloader) apply(next Config) error {
+	level, err := telemetry.ParseLogLevel(next.LogLevel)
+	if err != nil {
+		return err
+	}
+	if next.Timeout <= 0 {
+		return fmt.Errorf("invalid TIMEOUT_SECONDS %d: want a positive number", next.Timeout/time.Second)
+	}
+	if err := r.sampler.SetRatio(next.TraceSampleRatio); err != nil {
+		return err
+	}
+
+	r.level.Set(level)
+	r.app.timeout.Store(int64(next.Timeout))
+	r.app.rateLimiter.update(next.RateLimit)
+	return nil
+}
+
+// diffConfig lists the keys whose effective values differ, split between
+// those a reload applies and those awaiting a restart, sorted
+func diffConfig(current, next Config) (changed, restart []string) {
+	before, after := current.Effective(), next.Effective()
+	for key, value := range after {
+		if before[key] == value {
+			continue
+		}
+		if slices.Contains(reloadableKeys, key) {
+			changed = append(changed, key)
+		} else {
+			restart = append(restart, key)
+		}
+	}
+	slices.Sort(changed)
+	slices.Sort(restart)
+	return changed, restart
+}
+
+// awaitRestart moves the changed keys starting with prefix to restart, sorted
+func awaitRestart(changed, restart []string, prefix string) ([]string, []string) {
+	var applied []string
+	for _, key := range changed {
+		if strings.HasPrefix(key, prefix) {
+			restart = append(restart, key)
+		} else {
+			applied = append(applied, key)
+		}
+	}
+	slices.Sort(restart)
+	return applied, restart
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"pkg/telemetry"
+	"pkg/telemetry/telemetrytest"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestConfigReloaderAppliesReloadableKeys(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	config := testConfig("http://svc-b.invalid/weather")
+	config.LogLevel = "info"
+	config.TraceSampleRatio = 1
+	config.RateLimit = RateLimitConfig{GlobalRPS: 10}
+	app := newTestAppWithProviders(t, config, Providers{TracerProvider: telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))})
+
+	var level slog.LevelVar
+	sampler, err := telemetry.NewRatioSampler(config.TraceSampleRatio)
+	if err != nil {
+		t.Fatalf("NewRatioSampler() error = %v", err)
+	}
+
+	next := config
+	next.LogLevel = "debug"
+	next.TraceSampleRatio = 0.25
+	next.Timeout = 3 * time.Second
+	next.RateLimit = RateLimitConfig{GlobalRPS: 5, GlobalBurst: 2}
+	next.Port = "9090"
+	reloader := newConfigReloader(config, func() (Config, error) { return next, nil }, app, &level, sampler)
+
+	changed, err := reloader.reload(context.Background())
+	if err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+
+	expected := []string{"LOG_LEVEL", "RATE_LIMIT_GLOBAL_BURST", "RATE_LIMIT_GLOBAL_RPS", "TIMEOUT_SECONDS", "TRACE_SAMPLE_RATIO"}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Errorf("changed = %v, want %v", changed, expected)
+	}
+	if level.Level() != slog.LevelDebug {
+		t.Errorf("log level = %v, want debug", level.Level())
+	}
+	if sampler.Ratio() != 0.25 {
+		t.Errorf("sample ratio = %v, want 0.25", sampler.Ratio())
+	}
+	if got := time.Duration(app.timeout.Load()); got != 3*time.Second {
+		t.Errorf("timeout = %v, want 3s", got)
+	}
+	if got := app.rateLimiter.config; got.GlobalRPS != 5 || got.GlobalBurst != 2 {
+		t.Errorf("rate limits = %+v, want the reloaded ones", got)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "config.reload" || len(spans[0].Events()) != 1 {
+		t.Fatalf("expected a config.reload span with a config.changed event, got %v", spans)
+	}
+	attrs := make(map[string][]string)
+	for _, attr := range spans[0].Events()[0].Attributes {
+		attrs[string(attr.Key)] = attr.Value.AsStringSlice()
+	}
+	if !reflect.DeepEqual(attrs["config.changed_keys"], expected) || !reflect.DeepEqual(attrs["config.restart_keys"], []string{"PORT"}) {
+		t.Errorf("config.changed attributes = %v, want the changed keys and PORT awaiting a restart", attrs)
+	}
+}
+
+func TestConfigReloaderUpdatesEffectiveConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		bootRateLimit   RateLimitConfig
+		reloaded        RateLimitConfig
+		expectedChanged []string
+		expectedRestart []string
+	}{
+		// The limiter is only set up at startup
+		{"Turning the limiter on", RateLimitConfig{}, RateLimitConfig{PerIPRPS: 2}, []string{"LOG_LEVEL"}, []string{"PORT", "RATE_LIMIT_PER_IP_RPS"}},
+		{"Turning the limiter off", RateLimitConfig{PerIPRPS: 2}, RateLimitConfig{}, []string{"LOG_LEVEL", "RATE_LIMIT_PER_IP_RPS"}, []string{"PORT"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := tracetest.NewSpanRecorder()
+			config := testConfig("http://svc-b.invalid/weather")
+			config.LogLevel = "info"
+			config.TraceSampleRatio = 1
+			config.RateLimit = tt.bootRateLimit
+			app := newTestAppWithProviders(t, config, Providers{TracerProvider: telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))})
+			routes := app.setupRoutes()
+			sampler, err := telemetry.NewRatioSampler(config.TraceSampleRatio)
+			if err != nil {
+				t.Fatalf("NewRatioSampler() error = %v", err)
+			}
+
+			next := config
+			next.LogLevel = "debug"
+			next.RateLimit = tt.reloaded
+			next.Port = "9090"
+			reloader := newConfigReloader(config, func() (Config, error) { return next, nil }, app, &slog.LevelVar{}, sampler)
+			startedAt := app.effectiveConfig().StartedAt
+			changed, err := reloader.reload(context.Background())
+			if err != nil {
+				t.Fatalf("reload() error = %v", err)
+			}
+			if !reflect.DeepEqual(changed, tt.expectedChanged) {
+				t.Errorf("changed = %v, want %v", changed, tt.expectedChanged)
+			}
+			spans := recorder.Ended()
+			if len(spans) != 1 || len(spans[0].Events()) != 1 {
+				t.Fatalf("expected a config.reload span with a config.changed event, got %v", spans)
+			}
+			for _, attr := range spans[0].Events()[0].Attributes {
+				if attr.Key == "config.restart_keys" && !reflect.DeepEqual(attr.Value.AsStringSlice(), tt.expectedRestart) {
+					t.Errorf("config.restart_keys = %v, want %v", attr.Value.AsStringSlice(), tt.expectedRestart)
+				}
+			}
+
+			rr := httptest.NewRecorder()
+			routes.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/internal/effective-config", nil))
+			var effective EffectiveConfig
+			if err := json.NewDecoder(rr.Body).Decode(&effective); err != nil {
+				t.Fatalf("failed to decode effective config: %v", err)
+			}
+
+			expected := map[string]string{
+				"LOG_LEVEL": "debug",
+				// Off either way: never started, or turned off
+				"RATE_LIMIT_PER_IP_RPS": "0",
+				// Awaiting a restart, so not in effect
+				"PORT": config.Port,
+			}
+			for key, value := range expected {
+				if effective.Config[key] != value {
+					t.Errorf("%s = %q, want %q", key, effective.Config[key], value)
+				}
+			}
+			if effective.Subsystems["rate_limit"] {
+				t.Error("rate_limit subsystem = true, want it reported off as no limit is enforced")
+			}
+			if global, perIP := app.rateLimiter.limits(); global != nil || perIP != nil {
+				t.Errorf("limits() = %+v, %+v; want none enforced", global, perIP)
+			}
+			if !effective.StartedAt.Equal(startedAt) {
+				t.Errorf("started_at = %v, want the boot time %v", effective.StartedAt, startedAt)
+			}
+		})
+	}
+}
+
+func TestConfigReloaderKeepsCurrentConfigOnError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		next Config
+		err  error
+	}{
+		{name: "Load fails", err: errors.New("unknown key PROT in svc-a.yaml")},
+		{name: "Unknown log level", next: Config{LogLevel: "verbose", TraceSampleRatio: 0.5, Timeout: time.Second}},
+		{name: "Invalid sample ratio", next: Config{LogLevel: "debug", TraceSampleRatio: 2, Timeout: time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := testConfig("http://svc-b.invalid/weather")
+			config.LogLevel = "info"
+			app := newTestApp(t, config)
+			var level slog.LevelVar
+			sampler, err := telemetry.NewRatioSampler(1)
+			if err != nil {
+				t.Fatalf("NewRatioSampler() error = %v", err)
+			}
+			reloader := newConfigReloader(config, func() (Config, error) { return tt.next, tt.err }, app, &level, sampler)
+
+			if _, err := reloader.reload(context.Background()); err == nil {
+				t.Fatal("reload() error = nil, want one")
+			}
+			if level.Level() != slog.LevelInfo || sampler.Ratio() != 1 || time.Duration(app.timeout.Load()) != config.Timeout {
+				t.Errorf("reload changed settings: level %v, ratio %v, timeout %v", level.Level(), sampler.Ratio(), time.Duration(app.timeout.Load()))
+			}
+		})
+	}
+}
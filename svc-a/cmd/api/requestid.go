@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+
+	"pkg/telemetry"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// withRequestID gives every request an ID, the client's X-Request-ID when it
+// is a valid one, and returns it to the client. The ID travels to service B
+// as the request_id baggage member and is logged with every line of the request.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := telemetry.RequestIDFromHeader(r)
+		w.Header().Set(telemetry.RequestIDHeader, id)
+
+		// Baggage from clients isn't trusted. Dropping it here, before otelhttp
+		// extracts it, keeps the request ID in the context all the way down.
+		r.Header.Del("baggage")
+		ctx := telemetry.ContextWithRequestID(baggage.ContextWithoutBaggage(r.Context()), id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pkg/telemetry"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+func TestRequestIDIsReturnedAndPropagated(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		requestID string
+		expectID  string
+	}{
+		{"Client request ID is honored", "support-ticket-123", "support-ticket-123"},
+		{"Missing request ID is generated", "", ""},
+		{"Invalid request ID is replaced", "a b", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			forwarded := make(chan string, 1)
+			serviceB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded <- r.Header.Get("baggage")
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"city":"Rio de Janeiro","temp_C":25,"temp_F":77,"temp_K":298.15}`))
+			}))
+			defer serviceB.Close()
+
+			app := newTestApp(t, testConfig(serviceB.URL+"/weather"))
+			req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"22450-000"}`))
+			req.Header.Set("baggage", "request_id=spoofed")
+			if tt.requestID != "" {
+				req.Header.Set(telemetry.RequestIDHeader, tt.requestID)
+			}
+			rr := httptest.NewRecorder()
+			app.setupRoutes().ServeHTTP(rr, req)
+
+			returned := rr.Header().Get(telemetry.RequestIDHeader)
+			if tt.expectID != "" && returned != tt.expectID {
+				t.Errorf("%s = %q, want %q", telemetry.RequestIDHeader, returned, tt.expectID)
+			}
+			if tt.expectID == "" && len(returned) != 32 {
+				t.Errorf("%s = %q, want a new 32-digit ID", telemetry.RequestIDHeader, returned)
+			}
+			bag, err := baggage.Parse(<-forwarded)
+			if err != nil {
+				t.Fatalf("service B received invalid baggage: %v", err)
+			}
+			if got := bag.Member(baggageRequestID).Value(); got != returned {
+				t.Errorf("request_id sent to service B = %q, want the returned %q", got, returned)
+			}
+		})
+	}
+}
+
+func TestRequestIDOnRejectedRequests(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApp(t, testConfig("http://svc-b.invalid/weather"))
+	req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"123"}`))
+	req.Header.Set(telemetry.RequestIDHeader, "support-ticket-123")
+	rr := httptest.NewRecorder()
+	app.setupRoutes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity || rr.Header().Get(telemetry.RequestIDHeader) != "support-ticket-123" {
+		t.Errorf("got status %d and %s %q, want 422 with the client's ID", rr.Code, telemetry.RequestIDHeader, rr.Header().Get(telemetry.RequestIDHeader))
+	}
+}
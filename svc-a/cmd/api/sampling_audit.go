@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// samplingAuditFileQueue bounds the records waiting to be written to the audit
+// file; records beyond it are dropped rather than slowing requests down
+const samplingAuditFileQueue = 1024
+
+// SamplingAuditConfig controls the sampling decision audit stream
+type SamplingAuditConfig struct {
+	// Size is how many decisions are kept in memory; 0 disables the audit
+	Size int
+	// File optionally appends every decision as a JSON line
+	File string
+}
+
+// SamplingDecisionRecord describes the sampling decision taken for a request
+type SamplingDecisionRecord struct {
+	Time     time.Time `json:"time"`
+	TraceID  string    `json:"trace_id"`
+	SpanName string    `json:"span_name"`
+	Decision string    `json:"decision"`
+	Reason   string    `json:"reason"`
+	Rule     string    `json:"rule"`
+}
+
+// samplingAudit keeps the most recent decisions in a ring buffer and streams
+// them to an optional file
+type samplingAudit struct {
+	mu      sync.Mutex
+	records []SamplingDecisionRecord
+	next    int
+	full    bool
+
+	file    *os.File
+	queue   chan SamplingDecisionRecord
+	done    chan struct{}
+	dropped int64
+
+	clock Clock
+}
+
+// newSamplingAudit returns nil when the audit is disabled
+func newSamplingAudit(config SamplingAuditConfig) (*samplingAudit, error) {
+	if config.Size <= 0 {
+		return nil, nil
+	}
+
+	audit := &samplingAudit{
+		records: make([]SamplingDecisionRecord, config.Size),
+		clock:   realClock{},
+	}
+	if config.File == "" {
+		return audit, nil
+	}
+
+	file, err := os.OpenFile(config.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sampling audit file: %w", err)
+	}
+	audit.file = file
+	audit.queue = make(chan SamplingDecisionRecord, samplingAuditFileQueue)
+	audit.done = make(chan struct{})
+	go audit.writeFile()
+
+	return audit, nil
+}
+
+func (a *samplingAudit) record(rec SamplingDecisionRecord) {
+	a.mu.Lock()
+	a.records[a.next] = rec
+	a.next = (a.next + 1) % len(a.records)
+	if a.next == 0 {
+		a.full = true
+	}
+	a.mu.Unlock()
+
+	if a.queue == nil {
+		return
+	}
+	select {
+	case a.queue <- rec:
+	default:
+		a.mu.Lock()
+		a.dropped++
+		a.mu.Unlock()
+	}
+}
+
+// writeFile appends queued records to the audit file until Close is called
+func (a *samplingAudit) writeFile() {
+	defer close(a.done)
+
+	writer := bufio.NewWriter(a.file)
+	encoder := json.NewEncoder(writer)
+	for rec := range a.queue {
+		if err := encoder.Encode(rec); err != nil {
+			slog.Error("Failed to write sampling audit record", "error", err)
+		}
+		// Flush once the queue drains so the file stays close to real time
+		if len(a.queue) == 0 {
+			writer.Flush()
+		}
+	}
+	writer.Flush()
+}
+
+// query returns the recorded decisions, newest first, optionally filtered by trace id
+func (a *samplingAudit) query(traceID string, limit int) []SamplingDecisionRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	count := a.next
+	if a.full {
+		count = len(a.records)
+	}
+
+	result := make([]SamplingDecisionRecord, 0, count)
+	for i := 0; i < count && (limit <= 0 || len(result) < limit); i++ {
+		idx := (a.next - 1 - i + len(a.records)) % len(a.records)
+		rec := a.records[idx]
+		if traceID != "" && rec.TraceID != traceID {
+			continue
+		}
+		result = append(result, rec)
+	}
+	return result
+}
+
+// Close flushes and closes the audit file, if any
+func (a *samplingAudit) Close() error {
+	if a == nil || a.file == nil {
+		return nil
+	}
+	close(a.queue)
+	<-a.done
+	return a.file.Close()
+}
+
+// handleQuery serves recorded decisions, filtered by the trace_id and limit query parameters
+func (a *samplingAudit) handleQuery(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	a.mu.Lock()
+	dropped := a.dropped
+	a.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Records []SamplingDecisionRecord `json:"records"`
+		Dropped int64                    `json:"dropped_from_file"`
+	}{
+		Records: a.query(r.URL.Query().Get("trace_id"), limit),
+		Dropped: dropped,
+	})
+}
+
+// auditingSampler records the decisions of the wrapped sampler for the spans
+// that start a request in this service
+type auditingSampler struct {
+	next  sdktrace.Sampler
+	audit *samplingAudit
+}
+
+func (s auditingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := s.next.ShouldSample(p)
+
+	// Only the first span of a request in this service is audited; its local
+	// children inherit the decision
+	parent := trace.SpanContextFromContext(p.ParentContext)
+	if parent.IsValid() && !parent.IsRemote() {
+		return result
+	}
+
+	reason := "root"
+	if parent.IsValid() {
+		reason = "remote_parent"
+	}
+
+	s.audit.record(SamplingDecisionRecord{
+		Time:     s.audit.clock.Now().UTC(),
+		TraceID:  p.TraceID.String(),
+		SpanName: p.Name,
+		Decision: samplingDecisionName(result.Decision),
+		Reason:   reason,
+		Rule:     s.next.Description(),
+	})
+	return result
+}
+
+func (s auditingSampler) Description() string {
+	return "Auditing{" + s.next.Description() + "}"
+}
+
+func samplingDecisionName(decision sdktrace.SamplingDecision) string {
+	switch decision {
+	case sdktrace.RecordAndSample:
+		return "sampled"
+	case sdktrace.RecordOnly:
+		return "record_only"
+	default:
+		return "dropped"
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"pkg/telemetry/telemetrytest"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestAuditingSamplerRecordsRootDecisions(t *testing.T) {
+	t.Parallel()
+
+	audit, err := newSamplingAudit(SamplingAuditConfig{Size: 2})
+	if err != nil {
+		t.Fatalf("failed to create audit: %v", err)
+	}
+	clock := newFakeClock()
+	audit.clock = clock
+
+	tp := telemetrytest.NewTracerProvider(t, sdktrace.WithSampler(
+		auditingSampler{next: sdktrace.AlwaysSample(), audit: audit},
+	))
+	tracer := tp.Tracer("test")
+
+	var traceIDs []trace.TraceID
+	for i := 0; i < 3; i++ {
+		ctx, root := tracer.Start(context.Background(), "POST /weather")
+		_, child := tracer.Start(ctx, "CallServiceB")
+		child.End()
+		root.End()
+		traceIDs = append(traceIDs, root.SpanContext().TraceID())
+	}
+
+	records := audit.query("", 0)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want the ring buffer size (2)", len(records))
+	}
+	if records[0].TraceID != traceIDs[2].String() || records[1].TraceID != traceIDs[1].String() {
+		t.Errorf("expected the two most recent root spans, newest first, got %+v", records)
+	}
+	for _, rec := range records {
+		if rec.Decision != "sampled" || rec.Reason != "root" || rec.SpanName != "POST /weather" || !rec.Time.Equal(clock.Now()) {
+			t.Errorf("unexpected record %+v", rec)
+		}
+	}
+
+	if filtered := audit.query(traceIDs[1].String(), 0); len(filtered) != 1 {
+		t.Errorf("got %d records for trace %s, want 1", len(filtered), traceIDs[1])
+	}
+}
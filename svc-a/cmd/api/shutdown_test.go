@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServeUntilDoneDrainsInFlightRequests(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	started := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"status":"ok"}`))
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serveUntilDone(ctx, server, listener, 5*time.Second)
+	}()
+
+	url := "http://" + listener.Addr().String()
+	response := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Errorf("in-flight request failed: %v", err)
+			response <- ""
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		response <- string(body)
+	}()
+
+	<-started
+	cancel()
+
+	if body := <-response; body != `{"status":"ok"}` {
+		t.Errorf("in-flight request got %q, want it to complete", body)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serveUntilDone() error = %v", err)
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Error("server still accepts requests after shutdown")
+	}
+}
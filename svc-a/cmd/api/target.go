@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// serviceBWeatherRoute is svc-b's weather route, which SERVICE_B_URL points to
+const serviceBWeatherRoute = "/weather"
+
+// serviceBTarget is where svc-b is reached: its base URL, with any path prefix
+// an ingress routes it under (e.g. /api/weather-backend). Every endpoint is
+// joined to it, rather than concatenated to SERVICE_B_URL.
+type serviceBTarget struct {
+	base *url.URL
+}
+
+// parseServiceBTarget validates SERVICE_B_URL at startup: an http(s) URL of
+// svc-b's /weather route, behind an optional path prefix, without a query
+func parseServiceBTarget(raw string) (serviceBTarget, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return serviceBTarget{}, err
+	}
+	switch {
+	case parsed.Scheme != "http" && parsed.Scheme != "https":
+		return serviceBTarget{}, fmt.Errorf("%q is not an http(s) URL", parsed.Redacted())
+	case parsed.Host == "":
+		return serviceBTarget{}, fmt.Errorf("%q has no host", parsed.Redacted())
+	case parsed.RawQuery != "" || parsed.Fragment != "":
+		return serviceBTarget{}, errors.New("a query or fragment can't be joined to svc-b's endpoints")
+	}
+
+	path := strings.TrimSuffix(parsed.Path, "/")
+	if !strings.HasSuffix(path, serviceBWeatherRoute) {
+		return serviceBTarget{}, fmt.Errorf("path %q doesn't end in svc-b's %s route", parsed.Path, serviceBWeatherRoute)
+	}
+	parsed.Path = strings.TrimSuffix(path, serviceBWeatherRoute)
+	parsed.RawPath = ""
+	return serviceBTarget{base: parsed}, nil
+}
+
+// endpoint is the URL of one of svc-b's routes, e.g. endpoint("weather", "batch")
+func (t serviceBTarget) endpoint(elem ...string) string {
+	return t.base.JoinPath(elem...).String()
+}
+
+// String is the base URL without credentials, as recorded in telemetry
+func (t serviceBTarget) String() string {
+	return t.base.Redacted()
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// devEnvironments are the ENVIRONMENT values that get trace deep-links
+var devEnvironments = map[string]bool{"dev": true, "development": true, "local": true}
+
+// traceLinker builds Zipkin UI links to the current trace. It is only
+// enabled in the dev profile, so production responses never carry them.
+type traceLinker struct {
+	baseURL string
+}
+
+// newTraceLinker returns a linker for ZIPKIN_UI_URL, or a disabled one
+// outside the dev profile
+func newTraceLinker(config Config) traceLinker {
+	if !devEnvironments[strings.ToLower(config.Environment)] || config.ZipkinUIURL == "" {
+		return traceLinker{}
+	}
+	return traceLinker{baseURL: strings.TrimRight(config.ZipkinUIURL, "/")}
+}
+
+// url returns the Zipkin UI link to the trace in ctx, or "" when disabled
+func (l traceLinker) url(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if l.baseURL == "" || !spanContext.HasTraceID() {
+		return ""
+	}
+	return l.baseURL + "/traces/" + spanContext.TraceID().String()
+}
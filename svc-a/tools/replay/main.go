@@ -0,0 +1,119 @@
+// Command replay sends requests captured with CAPTURE_FILE to a candidate
+// build and reports where its status codes or payload shapes differ
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"svc-a/capture"
+)
+
+// mismatch describes a replayed request whose response differs from the capture
+type mismatch struct {
+	record   capture.Record
+	status   int
+	shape    string
+	expected string
+	err      error
+}
+
+func main() {
+	in := flag.String("in", "capture.jsonl", "capture file to replay")
+	target := flag.String("target", "http://localhost:8080", "base URL of the candidate build")
+	ignore := flag.String("ignore", "meta,trace_url", "comma-separated response fields left out of shape comparison")
+	timeout := flag.Duration("timeout", 15*time.Second, "timeout per replayed request")
+	maxReported := flag.Int("report", 20, "maximum number of mismatches listed in the report")
+	flag.Parse()
+
+	file, err := os.Open(*in)
+	if err != nil {
+		log.Fatalf("Failed to open capture: %v", err)
+	}
+	records, err := capture.ReadRecords(file)
+	file.Close()
+	if err != nil {
+		log.Fatalf("Failed to read capture: %v", err)
+	}
+
+	ignored := strings.Split(*ignore, ",")
+	client := &http.Client{Timeout: *timeout}
+	baseURL := strings.TrimRight(*target, "/")
+
+	var mismatches []mismatch
+	for _, rec := range records {
+		if m, ok := replay(client, baseURL, rec, ignored); !ok {
+			mismatches = append(mismatches, m)
+		}
+	}
+
+	fmt.Printf("Replayed %d requests against %s: %d matched, %d differed\n",
+		len(records), baseURL, len(records)-len(mismatches), len(mismatches))
+	for i, m := range mismatches {
+		if i == *maxReported {
+			fmt.Printf("  ... and %d more\n", len(mismatches)-i)
+			break
+		}
+		fmt.Printf("  %s %s\n", m.record.Method, requestURI(m.record))
+		if m.err != nil {
+			fmt.Printf("    error: %v\n", m.err)
+			continue
+		}
+		if m.status != m.record.Status {
+			fmt.Printf("    status: captured %d, got %d\n", m.record.Status, m.status)
+		}
+		if m.shape != m.expected {
+			fmt.Printf("    shape:  captured %s\n            got      %s\n", m.expected, m.shape)
+		}
+	}
+
+	if len(mismatches) > 0 {
+		os.Exit(1)
+	}
+}
+
+// replay sends one captured request and compares the response with the capture
+func replay(client *http.Client, baseURL string, rec capture.Record, ignored []string) (mismatch, bool) {
+	m := mismatch{record: rec, expected: capture.Shape([]byte(rec.Response), ignored...)}
+
+	// Captures keep only the region prefix of CEPs
+	rec = capture.Unmask(rec)
+	req, err := http.NewRequest(rec.Method, baseURL+requestURI(rec), strings.NewReader(rec.Body))
+	if err != nil {
+		m.err = err
+		return m, false
+	}
+	for name, value := range rec.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		m.err = err
+		return m, false
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		m.err = err
+		return m, false
+	}
+
+	m.status = resp.StatusCode
+	m.shape = capture.Shape(body, ignored...)
+	return m, m.status == rec.Status && m.shape == m.expected
+}
+
+func requestURI(rec capture.Record) string {
+	if rec.Query == "" {
+		return rec.Path
+	}
+	return rec.Path + "?" + rec.Query
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"svc-a/capture"
+)
+
+// weatherHandler answers like svc-a's /weather, with the response body of
+// reply, and records the CEPs it was asked for
+func weatherHandler(t *testing.T, reply string, ceps chan<- string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Cep string `json:"cep"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		ceps <- req.Cep
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(reply))
+	})
+}
+
+func TestReplayRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	recorder, err := capture.NewRecorder(path)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+
+	captured := make(chan string, 1)
+	handler := recorder.Middleware(weatherHandler(t, `{"city":"Rio de Janeiro","temp_C":25}`, captured))
+	req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"22450-123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	<-captured
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("failed to close recorder: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open capture: %v", err)
+	}
+	defer file.Close()
+	records, err := capture.ReadRecords(file)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("ReadRecords() = %d records, %v; want 1", len(records), err)
+	}
+
+	tests := []struct {
+		name     string
+		reply    string
+		expected bool
+	}{
+		{"Same shape", `{"city":"Recife","temp_C":31,"trace_url":"http://zipkin"}`, true},
+		{"Changed shape", `{"city":"Recife","temperature":31}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			replayed := make(chan string, 1)
+			candidate := httptest.NewServer(weatherHandler(t, tt.reply, replayed))
+			t.Cleanup(candidate.Close)
+
+			m, ok := replay(candidate.Client(), candidate.URL, records[0], []string{"meta", "trace_url"})
+			if m.err != nil {
+				t.Fatalf("replay failed: %v", m.err)
+			}
+			if ok != tt.expected {
+				t.Errorf("replay() matched = %v, want %v (captured %s, got %s)", ok, tt.expected, m.expected, m.shape)
+			}
+			if cep := <-replayed; cep != "22450000" {
+				t.Errorf("replayed CEP = %q, want the region's base CEP", cep)
+			}
+		})
+	}
+}
+
+func TestRequestURI(t *testing.T) {
+	t.Parallel()
+
+	rec := capture.Record{Path: "/weather", Query: "cep=22450%2A%2A%2A"}
+	if got := requestURI(capture.Unmask(rec)); got != "/weather?cep=22450000" {
+		t.Errorf("requestURI() = %q, want the unmasked CEP", got)
+	}
+	if got := requestURI(capture.Record{Path: "/limits"}); got != "/limits" {
+		t.Errorf("requestURI() = %q, want the bare path", got)
+	}
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPResponse is an upstream HTTP response kept by the caching proxy
+type HTTPResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	StoredAt   time.Time   `json:"stored_at"`
+	// ExpiresAt is when the response stops being fresh
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// FreshnessPolicy overrides the lifetime upstream responses declare
+type FreshnessPolicy struct {
+	// Default applies to responses declaring no lifetime
+	Default time.Duration
+	// Min and Max bound the declared lifetime; 0 leaves them unbounded
+	Min, Max time.Duration
+}
+
+// Freshness returns how long a response with header may be served by a shared
+// cache, following RFC 9111: no-store and private responses are not stored,
+// s-maxage takes precedence over max-age, then Expires, and the Age already
+// spent upstream is deducted. no-cache responses are not stored either, as
+// revalidation isn't implemented. 0 means the response is not stored.
+func (p FreshnessPolicy) Freshness(header http.Header, now time.Time) time.Duration {
+	directives := parseCacheControl(header.Values("Cache-Control"))
+	for _, directive := range []string{"no-store", "private", "no-cache"} {
+		if _, ok := directives[directive]; ok {
+			return 0
+		}
+	}
+
+	lifetime, declared := p.Default, false
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[directive]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				seconds = 0
+			}
+			lifetime, declared = time.Duration(seconds)*time.Second, true
+			break
+		}
+	}
+	if !declared && header.Get("Expires") != "" {
+		// An invalid Expires means already expired
+		lifetime = 0
+		if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+			date, err := http.ParseTime(header.Get("Date"))
+			if err != nil {
+				date = now
+			}
+			lifetime = expires.Sub(date)
+		}
+	}
+	if age, err := strconv.Atoi(header.Get("Age")); err == nil && age > 0 {
+		lifetime -= time.Duration(age) * time.Second
+	}
+
+	if lifetime < p.Min {
+		lifetime = p.Min
+	}
+	if p.Max > 0 && lifetime > p.Max {
+		lifetime = p.Max
+	}
+	if lifetime < 0 {
+		return 0
+	}
+	return lifetime
+}
+
+// parseCacheControl maps the Cache-Control directives to their values,
+// unquoted, with empty values for directives without one
+func parseCacheControl(values []string) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
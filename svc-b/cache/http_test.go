@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFreshness(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	policy := FreshnessPolicy{Default: 5 * time.Minute, Min: 30 * time.Second, Max: time.Hour}
+
+	tests := []struct {
+		name     string
+		header   map[string]string
+		expected time.Duration
+	}{
+		{"No lifetime declared", nil, 5 * time.Minute},
+		{"max-age", map[string]string{"Cache-Control": "public, max-age=120"}, 2 * time.Minute},
+		{"s-maxage wins", map[string]string{"Cache-Control": "max-age=120, s-maxage=600"}, 10 * time.Minute},
+		{"Age is deducted", map[string]string{"Cache-Control": "max-age=120", "Age": "60"}, time.Minute},
+		{"Raised to Min", map[string]string{"Cache-Control": "max-age=0"}, 30 * time.Second},
+		{"Capped at Max", map[string]string{"Cache-Control": "max-age=86400"}, time.Hour},
+		{"Expires", map[string]string{"Expires": "Mon, 01 Jan 2024 12:10:00 GMT", "Date": "Mon, 01 Jan 2024 12:00:00 GMT"}, 10 * time.Minute},
+		{"no-store", map[string]string{"Cache-Control": "no-store"}, 0},
+		{"private", map[string]string{"Cache-Control": "private, max-age=600"}, 0},
+		{"no-cache", map[string]string{"Cache-Control": "No-Cache"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			header := make(http.Header)
+			for name, value := range tt.header {
+				header.Set(name, value)
+			}
+			if got := policy.Freshness(header, now); got != tt.expected {
+				t.Errorf("Freshness() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
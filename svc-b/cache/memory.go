@@ -0,0 +1,262 @@
+// Package cache holds the cache backends used in front of the upstream providers
+package cache
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"math/rand/v2"
+	"svc-b/clock"
+	"svc-b/observability"
+	"sync"
+	"time"
+	"unsafe"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// entryOverheadBytes approximates the bookkeeping held per entry (list
+// element, map slot and timestamps) for the memory estimate
+const entryOverheadBytes = 128
+
+// Config bounds an in-memory cache
+type Config struct {
+	// TTL is how long an entry is served after being stored
+	TTL time.Duration
+	// MaxEntries caps the entry count; the least recently used entry is
+	// evicted to make room. 0 means unbounded.
+	MaxEntries int
+	// Beta scales probabilistic early expiration (XFetch); higher values
+	// refresh earlier. 0 disables it.
+	Beta float64
+}
+
+type entry[V any] struct {
+	key       string
+	value     V
+	storedAt  time.Time
+	expiresAt time.Time
+	// cost is how long the value took to compute, weighting early expiration
+	cost time.Duration
+	// refreshing is set while a caller refreshes the entry ahead of expiry
+	refreshing bool
+}
+
+// Memory is an in-memory TTL cache with LRU eviction
+type Memory[V any] struct {
+	mu      sync.Mutex
+	name    string
+	config  Config
+	clock   clock.Clock
+	entries map[string]*list.Element
+	// order holds the entries from most to least recently used
+	order *list.List
+	bytes int64
+
+	instruments *observability.CacheInstruments
+	attrs       metric.MeasurementOption
+	// hitAttrs and missAttrs label the lookup counter
+	hitAttrs  metric.MeasurementOption
+	missAttrs metric.MeasurementOption
+	// random returns a value in [0, 1) for the early expiration draw
+	random func() float64
+}
+
+// NewMemory creates a cache reporting its metrics under name. Nil instruments
+// disable the metrics.
+func NewMemory[V any](name string, config Config, clk clock.Clock, instruments *observability.CacheInstruments) *Memory[V] {
+	m := &Memory[V]{
+		name:        name,
+		config:      config,
+		clock:       clk,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+		instruments: instruments,
+		attrs:       metric.WithAttributes(attribute.String("cache", name)),
+		hitAttrs:    metric.WithAttributes(attribute.String("cache", name), attribute.String("result", "hit")),
+		missAttrs:   metric.WithAttributes(attribute.String("cache", name), attribute.String("result", "miss")),
+		random:      rand.Float64,
+	}
+	if instruments != nil {
+		instruments.Observe(name, m.Stats)
+	}
+	return m
+}
+
+// Get returns the live entry for key, removing it if it has expired
+func (m *Memory[V]) Get(ctx context.Context, key string) (V, bool) {
+	value, ok, _ := m.lookup(ctx, key, false)
+	return value, ok
+}
+
+// Lookup is Get with probabilistic early expiration: refresh is true for the
+// single caller elected to recompute a live entry shortly before its TTL. That
+// caller must Set the new value, or CancelRefresh on failure; everyone else
+// keeps being served the current value meanwhile.
+func (m *Memory[V]) Lookup(ctx context.Context, key string) (value V, ok, refresh bool) {
+	return m.lookup(ctx, key, m.config.Beta > 0)
+}
+
+func (m *Memory[V]) lookup(ctx context.Context, key string, early bool) (V, bool, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var zero V
+	elem, ok := m.entries[key]
+	if !ok {
+		m.countMiss(ctx)
+		return zero, false, false
+	}
+
+	e := elem.Value.(*entry[V])
+	now := m.clock.Now()
+	if !now.Before(e.expiresAt) {
+		m.remove(elem)
+		m.countExpiration(ctx)
+		m.countMiss(ctx)
+		return zero, false, false
+	}
+
+	m.order.MoveToFront(elem)
+	if m.instruments != nil {
+		m.instruments.Requests.Add(ctx, 1, m.hitAttrs)
+		m.instruments.CountLookup(m.name, true)
+		m.instruments.HitAge.Record(ctx, now.Sub(e.storedAt).Seconds(), m.attrs)
+	}
+
+	refresh := early && !e.refreshing && m.expiresEarly(e, now)
+	if refresh {
+		e.refreshing = true
+	}
+	return e.value, true, refresh
+}
+
+// expiresEarly draws whether the entry is treated as expired now (XFetch):
+// the expected cost of a recompute, scaled by Beta, is subtracted from the
+// remaining TTL with an exponentially distributed weight
+func (m *Memory[V]) expiresEarly(e *entry[V], now time.Time) bool {
+	gap := -float64(e.cost) * m.config.Beta * math.Log(1-m.random())
+	return !now.Add(time.Duration(gap)).Before(e.expiresAt)
+}
+
+// CancelRefresh releases an early refresh that failed, letting another caller try
+func (m *Memory[V]) CancelRefresh(_ context.Context, key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.entries[key]; ok {
+		elem.Value.(*entry[V]).refreshing = false
+	}
+}
+
+// Set stores value under key, evicting the least recently used entries if
+// the cache is full
+func (m *Memory[V]) Set(ctx context.Context, key string, value V) {
+	m.SetWithCost(ctx, key, value, 0)
+}
+
+// SetWithCost stores value along with how long it took to compute, which
+// weights its early expiration
+func (m *Memory[V]) SetWithCost(ctx context.Context, key string, value V, cost time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+	if elem, ok := m.entries[key]; ok {
+		e := elem.Value.(*entry[V])
+		e.value, e.storedAt, e.expiresAt, e.cost, e.refreshing = value, now, now.Add(m.config.TTL), cost, false
+		m.order.MoveToFront(elem)
+		return
+	}
+
+	e := &entry[V]{key: key, value: value, storedAt: now, expiresAt: now.Add(m.config.TTL), cost: cost}
+	m.entries[key] = m.order.PushFront(e)
+	m.bytes += entrySize(e)
+
+	for m.config.MaxEntries > 0 && m.order.Len() > m.config.MaxEntries {
+		oldest := m.order.Back()
+		expired := !now.Before(oldest.Value.(*entry[V]).expiresAt)
+		m.remove(oldest)
+		if expired {
+			m.countExpiration(ctx)
+		} else {
+			m.countEviction(ctx)
+		}
+	}
+}
+
+// Delete removes the entry for key, reporting whether there was one
+func (m *Memory[V]) Delete(_ context.Context, key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.entries[key]
+	if ok {
+		m.remove(elem)
+	}
+	return ok
+}
+
+// DeleteMatching removes every entry whose key matches, returning how many
+// were removed
+func (m *Memory[V]) DeleteMatching(_ context.Context, match func(key string) bool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := 0
+	for key, elem := range m.entries {
+		if match(key) {
+			m.remove(elem)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Flush removes every entry, returning how many were removed
+func (m *Memory[V]) Flush(ctx context.Context) int {
+	return m.DeleteMatching(ctx, func(string) bool { return true })
+}
+
+// Len returns the number of entries held, including expired ones not yet removed
+func (m *Memory[V]) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// Stats reports the cache size for the entry and memory gauges
+func (m *Memory[V]) Stats() observability.CacheStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return observability.CacheStats{Entries: m.order.Len(), Bytes: m.bytes}
+}
+
+func (m *Memory[V]) remove(elem *list.Element) {
+	e := m.order.Remove(elem).(*entry[V])
+	delete(m.entries, e.key)
+	m.bytes -= entrySize(e)
+}
+
+func (m *Memory[V]) countMiss(ctx context.Context) {
+	if m.instruments != nil {
+		m.instruments.Requests.Add(ctx, 1, m.missAttrs)
+		m.instruments.CountLookup(m.name, false)
+	}
+}
+
+func (m *Memory[V]) countEviction(ctx context.Context) {
+	if m.instruments != nil {
+		m.instruments.Evictions.Add(ctx, 1, m.attrs)
+	}
+}
+
+func (m *Memory[V]) countExpiration(ctx context.Context) {
+	if m.instruments != nil {
+		m.instruments.Expirations.Add(ctx, 1, m.attrs)
+	}
+}
+
+// entrySize estimates an entry's memory: the key, the value's fixed size and
+// the bookkeeping overhead. Memory referenced by the value isn't counted.
+func entrySize[V any](e *entry[V]) int64 {
+	return int64(len(e.key)) + int64(unsafe.Sizeof(e.value)) + entryOverheadBytes
+}
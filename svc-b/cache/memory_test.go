@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"context"
+	"svc-b/clock"
+	"svc-b/observability"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMemoryTTLAndLRU(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := NewMemory[int]("test", Config{TTL: time.Minute, MaxEntries: 2}, fake, nil)
+
+	cache.Set(ctx, "a", 1)
+	cache.Set(ctx, "b", 2)
+	if _, ok := cache.Get(ctx, "a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+
+	// b is now the least recently used entry
+	cache.Set(ctx, "c", 3)
+	if _, ok := cache.Get(ctx, "b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if v, ok := cache.Get(ctx, "a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %d, %v; want 1, true", v, ok)
+	}
+
+	fake.Advance(time.Minute)
+	if _, ok := cache.Get(ctx, "a"); ok {
+		t.Error("expected a to expire after the TTL")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Len() = %d, want 1 after removing the expired entry", cache.Len())
+	}
+}
+
+func TestMemoryMetrics(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	instruments, err := observability.NewCacheInstruments(meter)
+	if err != nil {
+		t.Fatalf("failed to create cache instruments: %v", err)
+	}
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := NewMemory[int]("weather", Config{TTL: time.Minute, MaxEntries: 2}, fake, instruments)
+
+	cache.Set(ctx, "a", 1)
+	fake.Advance(30 * time.Second)
+	cache.Get(ctx, "a")
+	cache.Set(ctx, "b", 2)
+	cache.Set(ctx, "c", 3) // evicts a
+	fake.Advance(time.Minute)
+	cache.Get(ctx, "b") // expired
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+
+	got := make(map[string]float64)
+	lookups := make(map[string]int64)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name == observability.CacheRequests.Name {
+				for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					result, _ := point.Attributes.Value("result")
+					lookups[result.AsString()] += point.Value
+				}
+				continue
+			}
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				got[m.Name] = float64(data.DataPoints[0].Value)
+			case metricdata.Gauge[int64]:
+				got[m.Name] = float64(data.DataPoints[0].Value)
+			case metricdata.Histogram[float64]:
+				got[m.Name] = data.DataPoints[0].Sum
+			}
+		}
+	}
+
+	expected := map[string]float64{
+		observability.CacheEntries.Name:     1,
+		observability.CacheEvictions.Name:   1,
+		observability.CacheExpirations.Name: 1,
+		observability.CacheHitAge.Name:      30,
+	}
+	for name, value := range expected {
+		if got[name] != value {
+			t.Errorf("%s = %v, want %v", name, got[name], value)
+		}
+	}
+	if lookups["hit"] != 1 || lookups["miss"] != 1 {
+		t.Errorf("%s = %v, want 1 hit and 1 miss", observability.CacheRequests.Name, lookups)
+	}
+	if got[observability.CacheMemory.Name] <= 0 {
+		t.Errorf("%s = %v, want a positive estimate", observability.CacheMemory.Name, got[observability.CacheMemory.Name])
+	}
+
+	summary := instruments.Summary()
+	if len(summary) != 1 || summary[0].Name != "weather" || summary[0].Entries != 1 ||
+		summary[0].Hits != 1 || summary[0].Misses != 1 || summary[0].HitRatio != 0.5 {
+		t.Errorf("Summary() = %+v, want the weather cache with 1 entry, 1 hit and 1 miss", summary)
+	}
+}
+
+func TestLookupElectsSingleEarlyRefresher(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := NewMemory[int]("test", Config{TTL: time.Minute, Beta: 1}, fake, nil)
+	// A draw close to 1 opens an early window of about 14 times the cost
+	cache.random = func() float64 { return 0.999999 }
+
+	cache.SetWithCost(ctx, "hot", 1, time.Second)
+	fake.Advance(50 * time.Second)
+
+	if _, ok, refresh := cache.Lookup(ctx, "hot"); !ok || !refresh {
+		t.Fatalf("Lookup() = ok %v, refresh %v; want the first caller elected", ok, refresh)
+	}
+	if v, ok, refresh := cache.Lookup(ctx, "hot"); !ok || refresh || v != 1 {
+		t.Errorf("Lookup() = %d, ok %v, refresh %v; want the current value without a second refresher", v, ok, refresh)
+	}
+
+	cache.CancelRefresh(ctx, "hot")
+	if _, _, refresh := cache.Lookup(ctx, "hot"); !refresh {
+		t.Error("expected a new refresher after the previous one gave up")
+	}
+
+	cache.SetWithCost(ctx, "hot", 2, time.Second)
+	if v, _, refresh := cache.Lookup(ctx, "hot"); v != 2 || refresh {
+		t.Errorf("Lookup() = %d, refresh %v; want the refreshed value with a fresh TTL", v, refresh)
+	}
+	fake.Advance(50 * time.Second)
+	if v, _, refresh := cache.Lookup(ctx, "hot"); v != 2 || !refresh {
+		t.Errorf("Lookup() = %d, refresh %v; want the election reset for the new value", v, refresh)
+	}
+}
+
+func TestLookupDoesNotRefreshEarlyWithoutCostOrBeta(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	noBeta := NewMemory[int]("test", Config{TTL: time.Minute}, fake, nil)
+	noBeta.random = func() float64 { return 0.999999 }
+	noBeta.SetWithCost(ctx, "hot", 1, time.Second)
+
+	noCost := NewMemory[int]("test", Config{TTL: time.Minute, Beta: 1}, fake, nil)
+	noCost.random = func() float64 { return 0.999999 }
+	noCost.Set(ctx, "hot", 1)
+
+	fake.Advance(59 * time.Second)
+	for name, cache := range map[string]*Memory[int]{"no beta": noBeta, "no cost": noCost} {
+		if _, ok, refresh := cache.Lookup(ctx, "hot"); !ok || refresh {
+			t.Errorf("%s: Lookup() = ok %v, refresh %v; want a plain hit", name, ok, refresh)
+		}
+	}
+}
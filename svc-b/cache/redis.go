@@ -0,0 +1,230 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"svc-b/clock"
+	"svc-b/codec"
+	"svc-b/observability"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redisKeyPrefix namespaces svc-b's keys on a shared Redis
+const redisKeyPrefix = "svc-b:"
+
+// redisRefreshPrefix namespaces the early refresh elections, apart from the
+// cache entries DeleteMatching scans
+const redisRefreshPrefix = redisKeyPrefix + "refresh:"
+
+// redisScanCount is the SCAN batch size used by DeleteMatching and Flush
+const redisScanCount = 500
+
+// redisEntry is a cached value as stored on Redis, with what early
+// expiration needs to know about it
+type redisEntry[V any] struct {
+	Value    V         `json:"value"`
+	StoredAt time.Time `json:"stored_at"`
+	// Cost is how long the value took to compute
+	Cost time.Duration `json:"cost,omitempty"`
+}
+
+// Redis is a TTL cache on Redis, shared by every svc-b instance. Values are
+// stored as JSON and expire through Redis. Redis errors are logged and treated
+// as misses, so an unavailable Redis only costs the cache.
+type Redis[V any] struct {
+	client redis.UniversalClient
+	name   string
+	// prefix holds every key of this cache, e.g. svc-b:weather:
+	prefix string
+	config Config
+	clock  clock.Clock
+
+	instruments *observability.CacheInstruments
+	attrs       metric.MeasurementOption
+	hitAttrs    metric.MeasurementOption
+	missAttrs   metric.MeasurementOption
+	// random returns a value in [0, 1) for the early expiration draw
+	random func() float64
+}
+
+// NewRedis creates a cache named name on client. Entries expire after the
+// config's TTL, and Beta enables early refresh as on Memory; MaxEntries is
+// left to Redis' own eviction policy. Nil instruments disable the metrics.
+func NewRedis[V any](name string, client redis.UniversalClient, config Config, clk clock.Clock, instruments *observability.CacheInstruments) *Redis[V] {
+	return &Redis[V]{
+		client:      client,
+		name:        name,
+		prefix:      redisKeyPrefix + name + ":",
+		config:      config,
+		clock:       clk,
+		instruments: instruments,
+		attrs:       metric.WithAttributes(attribute.String("cache", name)),
+		hitAttrs:    metric.WithAttributes(attribute.String("cache", name), attribute.String("result", "hit")),
+		missAttrs:   metric.WithAttributes(attribute.String("cache", name), attribute.String("result", "miss")),
+		random:      rand.Float64,
+	}
+}
+
+// Get returns the entry for key
+func (c *Redis[V]) Get(ctx context.Context, key string) (V, bool) {
+	value, ok, _ := c.lookup(ctx, key, false)
+	return value, ok
+}
+
+// Lookup is Get with probabilistic early expiration (XFetch), as on Memory:
+// refresh is true for the single caller, across every instance, elected to
+// recompute a live entry shortly before its TTL. That caller must Set the new
+// value, or CancelRefresh on failure.
+func (c *Redis[V]) Lookup(ctx context.Context, key string) (value V, ok, refresh bool) {
+	return c.lookup(ctx, key, c.config.Beta > 0)
+}
+
+func (c *Redis[V]) lookup(ctx context.Context, key string, early bool) (V, bool, bool) {
+	var zero V
+	raw, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			c.logError(ctx, "get", err)
+		}
+		c.countLookup(ctx, false)
+		return zero, false, false
+	}
+
+	var e redisEntry[V]
+	if err := codec.Unmarshal(raw, &e); err != nil || e.StoredAt.IsZero() {
+		// Entries written before early expiration was supported carry no
+		// metadata; they are misses until rewritten
+		if err != nil {
+			c.logError(ctx, "decode", err)
+		}
+		c.countLookup(ctx, false)
+		return zero, false, false
+	}
+
+	now := c.clock.Now()
+	c.countLookup(ctx, true)
+	if c.instruments != nil {
+		c.instruments.HitAge.Record(ctx, now.Sub(e.StoredAt).Seconds(), c.attrs)
+	}
+
+	refresh := early && c.expiresEarly(e, now) && c.elect(ctx, key, e.StoredAt.Add(c.config.TTL).Sub(now))
+	return e.Value, true, refresh
+}
+
+// expiresEarly draws whether the entry is treated as expired now (XFetch),
+// from its stored cost and expiry
+func (c *Redis[V]) expiresEarly(e redisEntry[V], now time.Time) bool {
+	gap := -float64(e.Cost) * c.config.Beta * math.Log(1-c.random())
+	return !now.Add(time.Duration(gap)).Before(e.StoredAt.Add(c.config.TTL))
+}
+
+// elect claims the refresh of key for the caller until the entry expires, so
+// a single instance recomputes it
+func (c *Redis[V]) elect(ctx context.Context, key string, remaining time.Duration) bool {
+	if remaining <= 0 {
+		return false
+	}
+	elected, err := c.client.SetNX(ctx, c.refreshKey(key), 1, remaining).Result()
+	if err != nil {
+		c.logError(ctx, "elect", err)
+		return false
+	}
+	return elected
+}
+
+// CancelRefresh releases an early refresh that failed, letting another caller try
+func (c *Redis[V]) CancelRefresh(ctx context.Context, key string) {
+	if err := c.client.Del(ctx, c.refreshKey(key)).Err(); err != nil {
+		c.logError(ctx, "cancel_refresh", err)
+	}
+}
+
+// Set stores value under key for the cache's TTL
+func (c *Redis[V]) Set(ctx context.Context, key string, value V) {
+	c.SetWithCost(ctx, key, value, 0)
+}
+
+// SetWithCost stores value along with how long it took to compute, which
+// weights its early expiration, and ends any refresh election for key
+func (c *Redis[V]) SetWithCost(ctx context.Context, key string, value V, cost time.Duration) {
+	raw, err := codec.Marshal(redisEntry[V]{Value: value, StoredAt: c.clock.Now(), Cost: cost})
+	if err != nil {
+		c.logError(ctx, "encode", err)
+		return
+	}
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, c.prefix+key, raw, c.config.TTL)
+		pipe.Del(ctx, c.refreshKey(key))
+		return nil
+	})
+	if err != nil {
+		c.logError(ctx, "set", err)
+	}
+}
+
+// Delete removes the entry for key, reporting whether there was one
+func (c *Redis[V]) Delete(ctx context.Context, key string) bool {
+	removed, err := c.client.Del(ctx, c.prefix+key).Result()
+	if err != nil {
+		c.logError(ctx, "delete", err)
+	}
+	return removed > 0
+}
+
+// DeleteMatching removes every entry whose key matches, returning how many
+// were removed. Keys are scanned in batches rather than with KEYS, which
+// would block a shared Redis.
+func (c *Redis[V]) DeleteMatching(ctx context.Context, match func(key string) bool) int {
+	removed := 0
+	iter := c.client.Scan(ctx, 0, c.prefix+"*", redisScanCount).Iterator()
+	for iter.Next(ctx) {
+		if !match(strings.TrimPrefix(iter.Val(), c.prefix)) {
+			continue
+		}
+		n, err := c.client.Del(ctx, iter.Val()).Result()
+		if err != nil {
+			c.logError(ctx, "delete", err)
+			continue
+		}
+		removed += int(n)
+	}
+	if err := iter.Err(); err != nil {
+		c.logError(ctx, "scan", err)
+	}
+	return removed
+}
+
+// Flush removes every entry of this cache, returning how many were removed
+func (c *Redis[V]) Flush(ctx context.Context) int {
+	return c.DeleteMatching(ctx, func(string) bool { return true })
+}
+
+func (c *Redis[V]) refreshKey(key string) string {
+	return redisRefreshPrefix + c.name + ":" + key
+}
+
+func (c *Redis[V]) countLookup(ctx context.Context, hit bool) {
+	if c.instruments == nil {
+		return
+	}
+	attrs := c.missAttrs
+	if hit {
+		attrs = c.hitAttrs
+	}
+	c.instruments.Requests.Add(ctx, 1, attrs)
+	c.instruments.CountLookup(c.name, hit)
+}
+
+func (c *Redis[V]) logError(ctx context.Context, op string, err error) {
+	trace.SpanFromContext(ctx).RecordError(err)
+	slog.WarnContext(ctx, "Erro no cache Redis", "cache", c.name, "op", op, "error", err)
+}
@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"context"
+	"svc-b/clock"
+	"svc-b/observability"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type temperature struct {
+	TempC float64 `json:"temp_C"`
+}
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+func TestRedisTTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	server, client := newTestRedis(t)
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := NewRedis[temperature]("weather", client, Config{TTL: 5 * time.Minute}, fake, nil)
+
+	if _, ok := cache.Get(ctx, "recife"); ok {
+		t.Fatal("Get() on an empty cache = hit, want miss")
+	}
+
+	cache.Set(ctx, "recife", temperature{TempC: 28.5})
+	if got, ok := cache.Get(ctx, "recife"); !ok || got.TempC != 28.5 {
+		t.Errorf("Get() = %+v, %v; want the stored value", got, ok)
+	}
+	if _, _, refresh := cache.Lookup(ctx, "recife"); refresh {
+		t.Error("Lookup() elected an early refresh, want none without Beta")
+	}
+	if ttl := server.TTL("svc-b:weather:recife"); ttl != 5*time.Minute {
+		t.Errorf("TTL = %v, want 5m under the cache's key prefix", ttl)
+	}
+
+	server.FastForward(5 * time.Minute)
+	if _, ok := cache.Get(ctx, "recife"); ok {
+		t.Error("Get() after the TTL = hit, want miss")
+	}
+
+	// Values written before entries carried their metadata are misses
+	server.Set("svc-b:weather:recife", `{"temp_C":28.5}`)
+	if _, ok := cache.Get(ctx, "recife"); ok {
+		t.Error("Get() on a bare value = hit, want miss")
+	}
+}
+
+func TestRedisInvalidation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	server, client := newTestRedis(t)
+	cache := NewRedis[temperature]("weather", client, Config{TTL: time.Minute}, clock.Real{}, nil)
+	// Another cache on the same Redis must be left alone
+	server.Set("svc-b:cep:01001000", `"São Paulo"`)
+
+	for _, city := range []string{"rio de janeiro", "rio branco", "recife"} {
+		cache.Set(ctx, city, temperature{TempC: 25})
+	}
+
+	if !cache.Delete(ctx, "recife") || cache.Delete(ctx, "recife") {
+		t.Error("Delete() should report the entry once")
+	}
+	if removed := cache.DeleteMatching(ctx, func(key string) bool { return key[:3] == "rio" }); removed != 2 {
+		t.Errorf("DeleteMatching(rio*) = %d, want 2", removed)
+	}
+
+	cache.Set(ctx, "manaus", temperature{TempC: 31})
+	if removed := cache.Flush(ctx); removed != 1 {
+		t.Errorf("Flush() = %d, want 1", removed)
+	}
+	if !server.Exists("svc-b:cep:01001000") {
+		t.Error("Flush() removed another cache's key")
+	}
+}
+
+func TestRedisUnavailableIsAMiss(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	server, client := newTestRedis(t)
+	cache := NewRedis[temperature]("weather", client, Config{TTL: time.Minute}, clock.Real{}, nil)
+	server.Close()
+
+	cache.Set(ctx, "recife", temperature{TempC: 28})
+	if _, ok := cache.Get(ctx, "recife"); ok {
+		t.Error("Get() with Redis down = hit, want miss")
+	}
+}
+
+func TestRedisLookupElectsSingleEarlyRefresher(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	server, client := newTestRedis(t)
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	config := Config{TTL: time.Minute, Beta: 1}
+	// Two instances sharing the Redis
+	first := NewRedis[temperature]("weather", client, config, fake, nil)
+	second := NewRedis[temperature]("weather", client, config, fake, nil)
+	for _, cache := range []*Redis[temperature]{first, second} {
+		// A draw close to 1 opens an early window of about 14 times the cost
+		cache.random = func() float64 { return 0.999999 }
+	}
+
+	first.SetWithCost(ctx, "recife", temperature{TempC: 28}, time.Second)
+	if _, ok, refresh := first.Lookup(ctx, "recife"); !ok || refresh {
+		t.Fatalf("Lookup() = ok %v, refresh %v; want a plain hit well before the TTL", ok, refresh)
+	}
+
+	fake.Advance(50 * time.Second)
+	if _, ok, refresh := first.Lookup(ctx, "recife"); !ok || !refresh {
+		t.Fatalf("Lookup() = ok %v, refresh %v; want the first caller elected", ok, refresh)
+	}
+	if got, ok, refresh := second.Lookup(ctx, "recife"); !ok || refresh || got.TempC != 28 {
+		t.Errorf("Lookup() on another instance = %+v, ok %v, refresh %v; want the current value without a second refresher", got, ok, refresh)
+	}
+	if ttl := server.TTL("svc-b:refresh:weather:recife"); ttl != 10*time.Second {
+		t.Errorf("election TTL = %v, want the entry's remaining 10s", ttl)
+	}
+
+	first.CancelRefresh(ctx, "recife")
+	if _, _, refresh := second.Lookup(ctx, "recife"); !refresh {
+		t.Error("expected a new refresher after the previous one gave up")
+	}
+
+	second.SetWithCost(ctx, "recife", temperature{TempC: 29}, time.Second)
+	if got, _, refresh := first.Lookup(ctx, "recife"); got.TempC != 29 || refresh {
+		t.Errorf("Lookup() = %+v, refresh %v; want the refreshed value with a fresh TTL", got, refresh)
+	}
+	fake.Advance(50 * time.Second)
+	if _, _, refresh := first.Lookup(ctx, "recife"); !refresh {
+		t.Error("expected the election reset for the new value")
+	}
+}
+
+func TestRedisMetrics(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	instruments, err := observability.NewCacheInstruments(meter)
+	if err != nil {
+		t.Fatalf("failed to create cache instruments: %v", err)
+	}
+
+	_, client := newTestRedis(t)
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := NewRedis[temperature]("weather", client, Config{TTL: time.Minute}, fake, instruments)
+
+	cache.Set(ctx, "recife", temperature{TempC: 28})
+	fake.Advance(30 * time.Second)
+	cache.Get(ctx, "recife")
+	cache.Get(ctx, "manaus")
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+
+	lookups := make(map[string]int64)
+	var hitAge float64
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			switch m.Name {
+			case observability.CacheRequests.Name:
+				for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					result, _ := point.Attributes.Value("result")
+					lookups[result.AsString()] += point.Value
+				}
+			case observability.CacheHitAge.Name:
+				hitAge = m.Data.(metricdata.Histogram[float64]).DataPoints[0].Sum
+			}
+		}
+	}
+
+	if lookups["hit"] != 1 || lookups["miss"] != 1 {
+		t.Errorf("%s = %v, want 1 hit and 1 miss", observability.CacheRequests.Name, lookups)
+	}
+	if hitAge != 30 {
+		t.Errorf("%s = %v, want 30", observability.CacheHitAge.Name, hitAge)
+	}
+}
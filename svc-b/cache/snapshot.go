@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotVersion is bumped whenever the snapshot layout changes
+const snapshotVersion = 1
+
+// snapshot is the on-disk form of a cache, entries ordered from most to
+// least recently used
+type snapshot[V any] struct {
+	Version int                `json:"version"`
+	Cache   string             `json:"cache"`
+	SavedAt time.Time          `json:"saved_at"`
+	Entries []snapshotEntry[V] `json:"entries"`
+}
+
+type snapshotEntry[V any] struct {
+	Key       string    `json:"key"`
+	Value     V         `json:"value"`
+	StoredAt  time.Time `json:"stored_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Cost keeps early expiration weighted after a restore
+	Cost time.Duration `json:"cost_ns,omitempty"`
+}
+
+// Snapshot writes the live entries, keeping their expiry and recency
+func (m *Memory[V]) Snapshot(w io.Writer) error {
+	m.mu.Lock()
+	now := m.clock.Now()
+	snap := snapshot[V]{Version: snapshotVersion, Cache: m.name, SavedAt: now}
+	for elem := m.order.Front(); elem != nil; elem = elem.Next() {
+		e := elem.Value.(*entry[V])
+		if !now.Before(e.expiresAt) {
+			continue
+		}
+		snap.Entries = append(snap.Entries, snapshotEntry[V]{
+			Key:       e.key,
+			Value:     e.value,
+			StoredAt:  e.storedAt,
+			ExpiresAt: e.expiresAt,
+			Cost:      e.cost,
+		})
+	}
+	m.mu.Unlock()
+
+	return json.NewEncoder(w).Encode(snap)
+}
+
+// Restore loads a snapshot written by Snapshot, skipping entries that expired
+// in the meantime and keeping at most MaxEntries of the most recent ones. It
+// returns the number of entries restored.
+func (m *Memory[V]) Restore(r io.Reader) (int, error) {
+	var snap snapshot[V]
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return 0, fmt.Errorf("failed to decode cache snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return 0, fmt.Errorf("unsupported cache snapshot version %d", snap.Version)
+	}
+	if snap.Cache != m.name {
+		return 0, fmt.Errorf("cache snapshot is for %q, not %q", snap.Cache, m.name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+	restored := 0
+	// Insert from least to most recently used so the LRU order is preserved
+	for i := len(snap.Entries) - 1; i >= 0; i-- {
+		s := snap.Entries[i]
+		if !now.Before(s.ExpiresAt) {
+			continue
+		}
+		if _, exists := m.entries[s.Key]; exists {
+			continue
+		}
+
+		e := &entry[V]{key: s.Key, value: s.Value, storedAt: s.StoredAt, expiresAt: s.ExpiresAt, cost: s.Cost}
+		m.entries[s.Key] = m.order.PushFront(e)
+		m.bytes += entrySize(e)
+		restored++
+	}
+
+	for m.config.MaxEntries > 0 && m.order.Len() > m.config.MaxEntries {
+		m.remove(m.order.Back())
+		restored--
+	}
+	return restored, nil
+}
+
+// SaveFile writes a snapshot to path, replacing it atomically
+func (m *Memory[V]) SaveFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cache snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := m.Snapshot(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace cache snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadFile restores the snapshot at path; a missing file restores nothing
+func (m *Memory[V]) LoadFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open cache snapshot: %w", err)
+	}
+	defer file.Close()
+
+	return m.Restore(file)
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"svc-b/clock"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestorePrunesExpiredEntries(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	source := NewMemory[int]("weather", Config{TTL: time.Minute, MaxEntries: 10}, fake, nil)
+
+	source.Set(ctx, "old", 1)
+	fake.Advance(40 * time.Second)
+	source.Set(ctx, "a", 2)
+	source.Set(ctx, "b", 3)
+	source.Get(ctx, "a") // a becomes the most recently used entry
+
+	var buf bytes.Buffer
+	if err := source.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	// The restarted instance comes up after "old" has expired
+	fake.Advance(30 * time.Second)
+	target := NewMemory[int]("weather", Config{TTL: time.Minute, MaxEntries: 1}, fake, nil)
+	restored, err := target.Restore(&buf)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	// MaxEntries keeps only the most recently used live entry
+	if restored != 1 || target.Len() != 1 {
+		t.Fatalf("restored %d entries (Len %d), want 1", restored, target.Len())
+	}
+	if v, ok := target.Get(ctx, "a"); !ok || v != 2 {
+		t.Errorf("Get(a) = %d, %v; want 2, true", v, ok)
+	}
+
+	// Restored entries keep their original expiry
+	fake.Advance(30 * time.Second)
+	if _, ok := target.Get(ctx, "a"); ok {
+		t.Error("expected a to expire at its original deadline")
+	}
+}
+
+func TestSnapshotFileRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	path := filepath.Join(t.TempDir(), "weather.json")
+
+	empty := NewMemory[string]("weather", Config{TTL: time.Minute}, fake, nil)
+	if restored, err := empty.LoadFile(path); err != nil || restored != 0 {
+		t.Fatalf("LoadFile on a missing snapshot = %d, %v; want 0, nil", restored, err)
+	}
+
+	source := NewMemory[string]("weather", Config{TTL: time.Minute}, fake, nil)
+	source.Set(ctx, "rio de janeiro", "25")
+	if err := source.SaveFile(path); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	target := NewMemory[string]("weather", Config{TTL: time.Minute}, fake, nil)
+	if restored, err := target.LoadFile(path); err != nil || restored != 1 {
+		t.Fatalf("LoadFile = %d, %v; want 1, nil", restored, err)
+	}
+
+	other := NewMemory[string]("cep", Config{TTL: time.Minute}, fake, nil)
+	if _, err := other.LoadFile(path); err == nil {
+		t.Error("expected a snapshot of another cache to be rejected")
+	}
+}
@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Backends selectable for the weather cache
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+	BackendNone   = "none"
+)
+
+// Store is the cache backend the cached services sit on
+type Store[V any] interface {
+	Get(ctx context.Context, key string) (V, bool)
+	// Lookup is Get, electing at most one caller to refresh an entry early on
+	// backends that support it
+	Lookup(ctx context.Context, key string) (value V, ok, refresh bool)
+	CancelRefresh(ctx context.Context, key string)
+	Set(ctx context.Context, key string, value V)
+	SetWithCost(ctx context.Context, key string, value V, cost time.Duration)
+	Delete(ctx context.Context, key string) bool
+	DeleteMatching(ctx context.Context, match func(key string) bool) int
+	Flush(ctx context.Context) int
+}
+
+var (
+	_ Store[int] = (*Memory[int])(nil)
+	_ Store[int] = (*Redis[int])(nil)
+)
@@ -2,121 +2,549 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"log/slog"
+	"maps"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"pkg/health"
+	"pkg/negotiation"
+	"pkg/settings"
+	"pkg/signing"
+	"pkg/telemetry"
+	"pkg/validation"
+	"slices"
+	"svc-b/cache"
+	"svc-b/clock"
+	"svc-b/config"
 	"svc-b/handlers"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/quota"
+	"svc-b/resilience"
 	"svc-b/services"
+	"svc-b/tlspolicy"
+	"svc-b/tuning"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/zipkin"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 )
 
-const (
-	defaultPort      = "8081"
-	defaultZipkinURL = "http://zipkin:9411/api/v2/spans"
-	serviceName      = "svc-b"
-)
+const serviceName = "svc-b"
+
+// quotaSaveInterval bounds how many quota counts a crash can lose
+const quotaSaveInterval = 30 * time.Second
 
-func initTracer() (*sdktrace.TracerProvider, error) {
-	zipkinURL := os.Getenv("ZIPKIN_URL")
-	if zipkinURL == "" {
-		zipkinURL = defaultZipkinURL
+func main() {
+	// Load configuration, failing fast on anything invalid, and report what
+	// the service is running with
+	src, err := settings.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	cfg, err := config.LoadConfig(src)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
 
-	exporter, err := zipkin.New(zipkinURL)
+	logger, err := telemetry.NewLogger(os.Stderr, cfg.LogFormat, cfg.LogLevel)
 	if err != nil {
-		return nil, err
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	// Exported through OTLP too once telemetry is initialized, with LOGS_EXPORTER
+	logger = telemetry.WithOTelLogs(logger, serviceName)
+	slog.SetDefault(telemetry.WithBaggage(logger, cfg.BaggageAttributes).With("service", serviceName))
+	for _, legacy := range cfg.LegacyEnv {
+		if legacy.InUse {
+			slog.Warn("Variável de ambiente obsoleta, use o novo nome", "old", legacy.Old, "new", legacy.New,
+				"removed_in", legacy.RemovedIn, "ignored", legacy.Ignored)
+		}
 	}
 
-	tracerProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String(serviceName),
-		)),
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-	)
+	// Size the scheduler and the collector to the container before anything
+	// starts or allocates much
+	cpu := tuning.ResolveMaxProcs(cfg.MaxProcs, tuning.DefaultCgroupRoot)
+	cpu.Apply()
+	memory := tuning.ResolveMemory(tuning.MemoryConfig{
+		GCPercent:   cfg.GCPercent,
+		MemoryLimit: cfg.MemoryLimitBytes,
+		LimitRatio:  cfg.MemoryLimitRatio,
+	}, tuning.DefaultCgroupRoot)
+	memory.Apply()
 
-	otel.SetTracerProvider(tracerProvider)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-		propagation.TraceContext{},
-		propagation.Baggage{},
-	))
+	effective := config.NewEffectiveConfig(serviceName, cfg)
+	effective.Runtime = memory.Effective()
+	maps.Copy(effective.Runtime, cpu.Effective())
+	if err := config.LogStartupBanner(effective, cfg.EffectiveConfigFile); err != nil {
+		slog.Error("Error reporting effective configuration", "error", err)
+	}
 
-	return tracerProvider, nil
-}
+	// Serve the metrics to Prometheus scrapers when enabled
+	var metricReaders []sdkmetric.Reader
+	var metricsHandler http.Handler
+	if cfg.PrometheusMetrics {
+		reader, handler, err := observability.NewPrometheusExporter()
+		if err != nil {
+			fatal("Failed to create Prometheus exporter", err)
+		}
+		metricReaders, metricsHandler = append(metricReaders, reader), handler
+	}
 
-func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	log.SetPrefix("[SVC-B] ")
+	// Initialize tracing, metrics and logs, keeping exported span payloads bounded
+	// whatever the code adds to spans
+	budget := telemetry.AttributeBudget{
+		MaxAttributes:  cfg.SpanMaxAttributes,
+		MaxValueLength: cfg.SpanMaxAttributeLength,
+	}
+	criticalPath := observability.NewCriticalPath()
+	shutdownTelemetry, err := telemetry.Init(context.Background(), telemetry.Config{
+		ServiceName:      serviceName,
+		Environment:      cfg.Environment,
+		SpanNamePrefixes: cfg.SpanNamePrefixes,
+		ExporterType:     cfg.ExporterType,
+		IDSeed:           cfg.TraceIDSeed,
+		ZipkinURL:        cfg.ZipkinURL,
+		MetricsExporter:  cfg.MetricsExporter,
+		LogsExporter:     cfg.LogsExporter,
+		MetricReaders:    metricReaders,
+		Attributes:       append(cpu.Attributes(), memory.Attributes()...),
+		WrapExporter: func(exporter sdktrace.SpanExporter) sdktrace.SpanExporter {
+			return telemetry.NewBudgetExporter(exporter, budget)
+		},
+		SpanProcessors: []sdktrace.SpanProcessor{criticalPath, telemetry.NewBaggageSpanProcessor(cfg.BaggageAttributes)},
+	})
+	if err != nil {
+		fatal("Failed to initialize telemetry", err)
+	}
+	defer shutdownTelemetry()
+
+	// Telemetry providers are passed explicitly to every component
+	providers := observability.Providers{
+		TracerProvider: otel.GetTracerProvider(),
+		MeterProvider:  otel.GetMeterProvider(),
+		Events:         observability.NewEventBus(),
+	}
 
-	// Initialize the tracer
-	tp, err := initTracer()
+	// Operational events become logs, metrics and, if configured, ops notifications
+	notifier, err := observability.NewEventNotifier(serviceName, providers.Meter(serviceName),
+		&http.Client{Timeout: 10 * time.Second}, cfg.EventsWebhookURL)
 	if err != nil {
-		log.Fatalf("Failed to initialize tracer: %v", err)
+		fatal("Failed to create event notifier", err)
 	}
-	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := tp.Shutdown(ctx); err != nil {
-			log.Printf("Error shutting down tracer provider: %v", err)
+	providers.Events.Subscribe(notifier.Handle)
+
+	// Create the metric instruments declared in the observability package
+	instruments, err := observability.NewInstruments(providers.Meter(serviceName))
+	if err != nil {
+		fatal("Failed to create metric instruments", err)
+	}
+	cacheInstruments, err := observability.NewCacheInstruments(providers.Meter(serviceName))
+	if err != nil {
+		fatal("Failed to create cache instruments", err)
+	}
+	upstreamInstruments, err := observability.NewUpstreamInstruments(providers.Meter(serviceName))
+	if err != nil {
+		fatal("Failed to create upstream instruments", err)
+	}
+	if err := criticalPath.RecordStages(providers.Meter(serviceName)); err != nil {
+		fatal("Failed to create stage instruments", err)
+	}
+
+	// Cap the calls to each provider so a spike can't run up the bill, keeping
+	// the counts across restarts
+	quotaLimits, err := quota.ParseLimits(cfg.UpstreamQuotas)
+	if err != nil {
+		fatal("Failed to load upstream quotas", err)
+	}
+	quotas := quota.NewLimiter(quotaLimits, clock.Real{})
+	if cfg.QuotaStateFile != "" {
+		if restored, err := quotas.LoadFile(cfg.QuotaStateFile); err != nil {
+			slog.Warn("Erro ao restaurar cotas", "error", err)
+		} else {
+			slog.Info("Cotas restauradas", "providers", restored)
 		}
-	}()
+	}
+
+	// WeatherAPI is reached through regional endpoints when configured,
+	// failing over between them
+	weatherEndpoints, err := services.ParseWeatherEndpoints(cfg.WeatherAPIEndpoints)
+	if err != nil {
+		fatal("Failed to load weather API endpoints", err)
+	}
+	endpointSelection := services.EndpointSelection(cfg.WeatherAPIEndpointSelection)
+	if endpointSelection != services.SelectOrdered && endpointSelection != services.SelectLatency {
+		fatal("Unknown WEATHERAPI_ENDPOINT_SELECTION", fmt.Errorf("%q: want ordered or latency", endpointSelection))
+	}
+	if len(weatherEndpoints) == 0 {
+		weatherEndpoints = []services.WeatherEndpoint{{Region: "default", URL: cfg.WeatherAPIURL}}
+	}
 
-	// Create shared HTTP client with timeout
+	// Create shared HTTP client with timeout. Only allowlisted context values
+	// are propagated to the external providers, every call is measured per
+	// provider and gets an HTTP client span with the API keys redacted, and
+	// calls over quota are refused before reaching it. The WeatherAPI key is
+	// set in a header innermost, so no URL logged or traced above carries it.
+	upstreamProviders := map[string]string{
+		hostname(cfg.ViaCEPURL):    services.CEPProviderViaCEP,
+		hostname(cfg.BrasilAPIURL): services.CEPProviderBrasilAPI,
+		hostname(cfg.OpenCEPURL):   services.CEPProviderOpenCEP,
+	}
+	for _, endpoint := range weatherEndpoints {
+		upstreamProviders[hostname(endpoint.URL)] = services.WeatherProviderWeatherAPI
+	}
+
+	// Outbound TLS follows a policy checked here, so a bad setting stops the
+	// service instead of weakening every call
+	pins := map[string]string{hostname(cfg.ViaCEPURL): cfg.TLSPinsViaCEP}
+	for _, endpoint := range weatherEndpoints {
+		pins[hostname(endpoint.URL)] = cfg.TLSPinsWeatherAPI
+	}
+	tlsPolicy, err := tlspolicy.Parse(cfg.TLSMinVersion, cfg.TLSCipherSuites, pins)
+	if err != nil {
+		fatal("Invalid outbound TLS policy", err)
+	}
+	upstreamProviders[hostname(cfg.OpenWeatherMapURL)] = services.WeatherProviderOpenWeatherMap
+	// WeatherAPI requests carry a correlation token, kept with their trace for
+	// support tickets with the provider
+	var correlations *observability.Correlations
+	transport := tlsPolicy.Transport(http.DefaultTransport.(*http.Transport))
+	if cfg.CorrelationTTLSeconds > 0 {
+		correlations = observability.NewCorrelations(time.Duration(cfg.CorrelationTTLSeconds)*time.Second, cfg.CorrelationMaxEntries, clock.Real{})
+		tagged := make(map[string]string)
+		for _, endpoint := range weatherEndpoints {
+			tagged[hostname(endpoint.URL)] = services.WeatherProviderWeatherAPI
+		}
+		transport = correlations.Transport(transport, tagged)
+	}
+	apiKeys := make(map[string]services.APIKey)
+	for _, endpoint := range weatherEndpoints {
+		apiKeys[hostname(endpoint.URL)] = services.APIKey{Header: services.WeatherAPIKeyHeader, Value: cfg.WeatherAPIKey}
+	}
+	transport = services.NewAPIKeyTransport(transport, apiKeys)
 	httpClient := &http.Client{
+		Transport: quotas.Transport(observability.NewUpstreamTransport(
+			observability.NewClientTransport(observability.NewPropagationTransport(transport, observability.PropagationPolicy{
+				InternalHosts:   cfg.PropagationInternalHosts,
+				ExternalBaggage: cfg.PropagationExternalBaggage,
+			}, otel.GetTextMapPropagator()), providers),
+			upstreamProviders, upstreamInstruments,
+		), upstreamProviders),
 		Timeout: 10 * time.Second,
 	}
 
 	// Initialize services with shared client
-	cepService := services.NewViaCEPService(httpClient)
-	weatherService := services.NewWeatherAPIService(httpClient)
+	breaker := resilience.BreakerConfig{
+		FailureThreshold: cfg.BreakerFailureThreshold,
+		OpenTimeout:      time.Duration(cfg.BreakerOpenSeconds) * time.Second,
+	}
+	retry := resilience.RetryPolicy{
+		MaxAttempts: cfg.RetryMaxAttempts,
+		BaseDelay:   time.Duration(cfg.RetryBaseDelayMS) * time.Millisecond,
+		MaxDelay:    time.Duration(cfg.RetryMaxDelayMS) * time.Millisecond,
+		Jitter:      cfg.RetryJitter,
+	}
+	cepService, err := newCEPService(cfg, httpClient, retry, breaker, providers)
+	if err != nil {
+		fatal("Failed to configure CEP providers", err)
+	}
+	// The provider list was validated by newCEPService
+	cepProviders, _ := services.ParseCEPProviders(cfg.CEPProviders)
+	weatherService, weatherProviders, err := newWeatherService(cfg, httpClient, weatherEndpoints, endpointSelection, retry, breaker, providers)
+	if err != nil {
+		fatal("Failed to configure weather providers", err)
+	}
+	dependencies := observability.NewDependencyHealth(providers.Events, append(cepProviders, weatherProviders...)...)
+	if cfg.SandboxMode {
+		slog.Warn("SANDBOX_MODE ativo: usando provedores falsos")
+		cepService = services.NewSandboxCEPService(providers)
+		weatherService = services.NewSandboxWeatherService(providers)
+	}
+
+	// Sandbox faults are injected per request, so the sandbox is never cached.
+	// Only the in-memory cache is snapshotted; Redis outlives the instance.
+	var weatherCache *cache.Memory[models.Temperature]
+	var weatherStore cache.Store[models.Temperature]
+	adminCaches := make(map[string]handlers.CacheInvalidator)
+	weatherTTL := time.Duration(cfg.WeatherCacheTTLSeconds) * time.Second
+	if weatherTTL > 0 && !cfg.SandboxMode {
+		switch cfg.CacheBackend {
+		case cache.BackendMemory:
+			weatherCache = cache.NewMemory[models.Temperature]("weather", cache.Config{
+				TTL:        weatherTTL,
+				MaxEntries: cfg.WeatherCacheMaxEntries,
+				Beta:       cfg.WeatherCacheBeta,
+			}, clock.Real{}, cacheInstruments)
+			weatherStore = weatherCache
+		case cache.BackendRedis:
+			redisClient, err := newRedisClient(cfg.RedisURL, providers)
+			if err != nil {
+				fatal("Failed to create Redis client", err)
+			}
+			defer redisClient.Close()
+			weatherStore = cache.NewRedis[models.Temperature]("weather", redisClient, cache.Config{
+				TTL:  weatherTTL,
+				Beta: cfg.WeatherCacheBeta,
+			}, clock.Real{}, cacheInstruments)
+		case cache.BackendNone:
+		default:
+			fatal("Unknown CACHE_BACKEND", fmt.Errorf("%q: want memory, redis or none", cfg.CacheBackend))
+		}
+	}
+	var cachedWeather *services.CachedWeatherService
+	if weatherStore != nil {
+		cachedWeather = services.NewCachedWeatherService(weatherService, weatherStore)
+		adminCaches["weather"] = cachedWeather
+		weatherService = cachedWeather
+	}
+
+	// Sensors push readings that answer for their CEPs ahead of the providers,
+	// and ahead of the cache, which would serve them to a whole city
+	var iot *services.IoTWeatherService
+	if cfg.IoTIngestToken != "" && !cfg.SandboxMode {
+		if cfg.IoTReadingMaxAgeSeconds <= 0 {
+			fatal("Invalid IOT_READING_MAX_AGE_SECONDS", fmt.Errorf("%d: want a positive age", cfg.IoTReadingMaxAgeSeconds))
+		}
+		iot = services.NewIoTWeatherService(weatherService, time.Duration(cfg.IoTReadingMaxAgeSeconds)*time.Second, providers)
+		weatherService = iot
+	}
+
+	var cepCache *cache.Memory[models.Address]
+	if cfg.CEPCacheTTLSeconds > 0 && !cfg.SandboxMode {
+		cepCache = cache.NewMemory[models.Address]("cep", cache.Config{
+			TTL:        time.Duration(cfg.CEPCacheTTLSeconds) * time.Second,
+			MaxEntries: cfg.CEPCacheMaxEntries,
+		}, clock.Real{}, cacheInstruments)
+		cachedCEP := services.NewCachedCEPService(cepService, cepCache)
+		adminCaches["cep"] = cachedCEP
+		cepService = cachedCEP
+	}
+
+	// Other teams can reach the weather providers through svc-b's cache,
+	// directly or by setting svc-b as their HTTP proxy
+	var weatherProxy *handlers.WeatherProxy
+	proxyHosts := make(map[string]string)
+	if cfg.ProxyMode && !cfg.SandboxMode {
+		if cfg.ProxyMaxTTLSeconds <= 0 {
+			fatal("Invalid PROXY_MAX_TTL_SECONDS", fmt.Errorf("%d: want a positive lifetime", cfg.ProxyMaxTTLSeconds))
+		}
+		maxTTL := time.Duration(cfg.ProxyMaxTTLSeconds) * time.Second
+		proxyCache := cache.NewMemory[cache.HTTPResponse]("proxy", cache.Config{
+			TTL:        maxTTL,
+			MaxEntries: cfg.ProxyCacheMaxEntries,
+		}, clock.Real{}, cacheInstruments)
+		weatherProxy = handlers.NewWeatherProxy(httpClient, map[string]handlers.ProxyTarget{
+			services.WeatherProviderWeatherAPI:     {URL: weatherEndpoints[0].URL, KeyParam: "key", KeyHeader: services.WeatherAPIKeyHeader},
+			services.WeatherProviderOpenWeatherMap: {URL: cfg.OpenWeatherMapURL, KeyParam: "appid"},
+		}, proxyCache, cache.FreshnessPolicy{
+			Default: time.Duration(cfg.ProxyDefaultTTLSeconds) * time.Second,
+			Min:     time.Duration(cfg.ProxyMinTTLSeconds) * time.Second,
+			Max:     maxTTL,
+		}, clock.Real{})
+		adminCaches["proxy"] = weatherProxy
+		for _, endpoint := range weatherEndpoints {
+			proxyHosts[hostname(endpoint.URL)] = services.WeatherProviderWeatherAPI
+		}
+		proxyHosts[hostname(cfg.OpenWeatherMapURL)] = services.WeatherProviderOpenWeatherMap
+	}
+
+	// Warm the caches from the previous instance to spare the providers a burst on deploy
+	weatherSnapshot, cepSnapshot := "", ""
+	if weatherCache != nil && cfg.CacheSnapshotDir != "" {
+		weatherSnapshot = filepath.Join(cfg.CacheSnapshotDir, "weather.json")
+		if restored, err := weatherCache.LoadFile(weatherSnapshot); err != nil {
+			slog.Warn("Erro ao restaurar cache de clima", "error", err)
+		} else {
+			slog.Info("Cache de clima restaurado", "entries", restored)
+		}
+	}
+	if cepCache != nil && cfg.CacheSnapshotDir != "" {
+		cepSnapshot = filepath.Join(cfg.CacheSnapshotDir, "cep.json")
+		if restored, err := cepCache.LoadFile(cepSnapshot); err != nil {
+			slog.Warn("Erro ao restaurar cache de CEP", "error", err)
+		} else {
+			slog.Info("Cache de CEP restaurado", "entries", restored)
+		}
+	}
+
+	// Load per-client response field mappings
+	profiles, err := handlers.LoadResponseProfiles(cfg.ResponseProfilesFile)
+	if err != nil {
+		fatal("Failed to load response profiles", err)
+	}
+
+	// Sign responses so svc-a can detect tampering where mTLS isn't available
+	signingKeys, err := signing.ParseKeys(cfg.ResponseSigningKeys)
+	if err != nil {
+		fatal("Failed to load response signing keys", err)
+	}
+	if signingKeys.Enabled() {
+		slog.Info("Assinatura de respostas ativa", "keys", signingKeys.IDs())
+	}
 
 	// Initialize handler
-	handler := handlers.NewWeatherHandler(cepService, weatherService)
+	cepValidator, err := validation.ParseCEPRules(cfg.CEPRules)
+	if err != nil {
+		fatal("Invalid CEP_RULES", err)
+	}
+	if cfg.TemperaturePrecision < 0 || cfg.TemperaturePrecision > handlers.MaxPrecision {
+		fatal("Invalid TEMPERATURE_PRECISION", fmt.Errorf("%d: want 0 to %d decimal places", cfg.TemperaturePrecision, handlers.MaxPrecision))
+	}
+	handler := handlers.NewWeatherHandler(cepService, weatherService, instruments, cfg.Limits, providers).
+		WithBatchConcurrency(cfg.BatchConcurrency).
+		WithCEPValidator(cepValidator).
+		WithTemperaturePrecision(cfg.TemperaturePrecision).
+		WithLongPollInterval(time.Duration(cfg.LongPollIntervalSeconds) * time.Second)
+	var analytics *observability.CEPAnalytics
+	if cfg.CEPAnalyticsHours > 0 {
+		analytics = observability.NewCEPAnalytics(time.Duration(cfg.CEPAnalyticsHours)*time.Hour, clock.Real{})
+		handler.WithAnalytics(analytics)
+	}
 
 	// Setup router
 	r := mux.NewRouter()
-	r.Use(otelmux.Middleware(serviceName))
+	r.Use(otelmux.Middleware(serviceName, otelmux.WithTracerProvider(providers.Tracers())))
+	r.Use(observability.RequestIDMiddleware())
+	r.Use(criticalPath.Middleware())
+	var recent *observability.RecentRequests
+	if cfg.RecentRequestsSize > 0 {
+		recent = observability.NewRecentRequests(cfg.RecentRequestsSize)
+		r.Use(recent.Middleware())
+	}
+	var red *observability.RED
+	if cfg.REDMetrics {
+		red = observability.NewRED(clock.Real{})
+		r.Use(red.Middleware())
+	}
+	r.Use(observability.Middleware(instruments))
+	if signingKeys.Enabled() {
+		r.Use(handlers.SigningMiddleware(signingKeys))
+	}
+	// Inside signing, so the signature covers the representation served
+	r.Use(negotiation.Negotiate)
+	maintenance := handlers.NewMaintenance(handlers.MaintenanceState{
+		Enabled:           cfg.MaintenanceMode,
+		Message:           cfg.MaintenanceMessage,
+		RetryAfterSeconds: cfg.MaintenanceRetrySeconds,
+	})
+	if cfg.MaintenanceMode {
+		slog.Warn("Modo de manutenção ativo")
+	}
+	r.Use(maintenance.Middleware())
+	r.Use(handlers.ResponseProfileMiddleware(profiles))
+	if linker := observability.NewTraceLinker(cfg.Environment, cfg.ZipkinUIURL); linker.Enabled() {
+		r.Use(linker.Middleware())
+	}
+	if cfg.SandboxMode {
+		r.Use(handlers.SimulationMiddleware())
+	}
 
 	r.HandleFunc("/weather/{cep}", handler.GetWeatherByCEP).Methods("GET")
 	r.HandleFunc("/weather", handler.GetWeatherByCEPPost).Methods("POST")
+	r.HandleFunc("/weather/batch", handler.GetWeatherBatch).Methods("POST")
+	r.HandleFunc("/weather/{cep}/wait-for-change", handler.WaitForChange).Methods("GET")
+	r.HandleFunc("/forecast/{cep}", handler.GetForecastByCEP).Methods("GET")
+	r.HandleFunc("/capabilities", handler.GetCapabilities).Methods("GET")
+	r.HandleFunc("/limits", handler.GetLimits).Methods("GET")
+	r.HandleFunc("/usage", quotas.Handler()).Methods("GET")
+	if weatherProxy != nil {
+		r.Handle("/proxy/{provider}/{path:.*}", weatherProxy).Methods("GET")
+	}
+	r.HandleFunc("/version", config.VersionHandler(effective)).Methods("GET")
+	r.HandleFunc("/internal/effective-config", config.EffectiveConfigHandler(effective)).Methods("GET")
 
-	// Add health check endpoint
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	}).Methods("GET")
+	// Liveness only says the process answers; readiness probes the providers.
+	// /health is kept for the probes configured before /healthz.
+	healthClient := &http.Client{Transport: tlsPolicy.Transport(http.DefaultTransport.(*http.Transport))}
+	r.HandleFunc("/health", health.Liveness()).Methods("GET")
+	r.HandleFunc("/healthz", health.Liveness()).Methods("GET")
+	r.HandleFunc("/readyz", newHealthChecker(cfg, healthClient, cepProviders, weatherProviders, weatherEndpoints).Readiness()).Methods("GET")
 
-	// Configure server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
+	// Operator endpoints are only exposed with a token to authenticate them
+	if cfg.AdminToken != "" {
+		admin := handlers.NewAdminHandler(cfg.AdminToken, adminCaches, providers).WithMaintenance(maintenance).WithDiagnostics(&handlers.Diagnostics{
+			Effective:    effective,
+			Recent:       recent,
+			Dependencies: dependencies,
+			ExportErrors: telemetry.RecentExportErrors,
+		})
+		if correlations != nil {
+			admin.WithCorrelations(correlations)
+			r.HandleFunc("/admin/correlations", admin.GetCorrelations).Methods("GET")
+			r.HandleFunc("/admin/correlations/{token}", admin.GetCorrelations).Methods("GET")
+		}
+		r.HandleFunc("/admin/cache/invalidate", admin.InvalidateCache).Methods("POST")
+		r.HandleFunc("/admin/maintenance", admin.GetMaintenance).Methods("GET")
+		r.HandleFunc("/admin/maintenance", admin.SetMaintenance).Methods("PUT")
+		r.HandleFunc("/admin/diagnostics", admin.GetDiagnostics).Methods("GET")
+		if cachedWeather != nil {
+			admin.WithCalibration(cepService, cachedWeather)
+			r.HandleFunc("/admin/calibrate/{cep}", admin.Calibrate).Methods("GET")
+		}
 	}
 
+	if iot != nil {
+		r.HandleFunc("/ingest/temperature", handlers.NewIngestHandler(cfg.IoTIngestToken, iot, providers).IngestTemperature).Methods("POST")
+	}
+
+	// Internal endpoints
+	r.HandleFunc("/internal/dashboards/grafana.json", observability.DashboardHandler(serviceName)).Methods("GET")
+	r.HandleFunc("/internal/telemetry/registry", observability.RegistryHandler(serviceName)).Methods("GET")
+	if metricsHandler != nil {
+		r.Handle("/metrics", metricsHandler).Methods("GET")
+	}
+	if recent != nil {
+		r.HandleFunc("/internal/recent", recent.Handler()).Methods("GET")
+	}
+	if red != nil {
+		r.HandleFunc("/internal/red", red.Handler()).Methods("GET")
+	}
+	if analytics != nil {
+		r.HandleFunc("/internal/analytics/ceps", analytics.Handler()).Methods("GET")
+	}
+	r.HandleFunc("/internal/cache", cacheInstruments.Handler()).Methods("GET")
+	if cfg.Dashboard {
+		r.HandleFunc("/dashboard", observability.DashboardPageHandler()).Methods("GET")
+	}
+
+	// Configure server
+	var root http.Handler = r
+	if weatherProxy != nil {
+		root = handlers.ForwardProxy(r, proxyHosts)
+	}
+	if cfg.CompressionMinBytes > 0 {
+		root = negotiation.Compress(cfg.CompressionMinBytes)(root)
+	}
+	port := cfg.Port
 	srv := &http.Server{
 		Addr:         ":" + port,
-		Handler:      r,
+		Handler:      root,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
+	persistCtx, stopPersisting := context.WithCancel(context.Background())
+	defer stopPersisting()
+	if cfg.QuotaStateFile != "" {
+		go persistQuotas(persistCtx, quotas, cfg.QuotaStateFile)
+	}
+
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Server starting on port %s", port)
+		slog.Info("Server starting", "port", port)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+			fatal("Server failed to start", err)
 		}
 	}()
 
@@ -124,14 +552,190 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		fatal("Server forced to shutdown", err)
+	}
+
+	if weatherSnapshot != "" {
+		if err := weatherCache.SaveFile(weatherSnapshot); err != nil {
+			slog.Error("Erro ao salvar cache de clima", "error", err)
+		}
+	}
+	if cepSnapshot != "" {
+		if err := cepCache.SaveFile(cepSnapshot); err != nil {
+			slog.Error("Erro ao salvar cache de CEP", "error", err)
+		}
+	}
+
+	stopPersisting()
+	if cfg.QuotaStateFile != "" {
+		if err := quotas.SaveFile(cfg.QuotaStateFile); err != nil {
+			slog.Error("Erro ao salvar cotas", "error", err)
+		}
+	}
+
+	slog.Info("Server exited properly")
+}
+
+// fatal logs msg with err and exits, as log.Fatalf does for plain logs
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// persistQuotas saves the quota counters every quotaSaveInterval until ctx is done
+func persistQuotas(ctx context.Context, quotas *quota.Limiter, path string) {
+	ticker := time.NewTicker(quotaSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := quotas.SaveFile(path); err != nil {
+				slog.Error("Erro ao salvar cotas", "error", err)
+			}
+		}
+	}
+}
+
+// redisPingTimeout bounds the startup check of the Redis cache
+const redisPingTimeout = 2 * time.Second
+
+// newRedisClient connects to the Redis at rawURL, e.g. redis://host:6379/0,
+// tracing every command. An unreachable Redis is only logged: the cache
+// treats its errors as misses.
+func newRedisClient(rawURL string, providers observability.Providers) (*redis.Client, error) {
+	options, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, err
 	}
+	client := redis.NewClient(options)
+	if err := redisotel.InstrumentTracing(client, redisotel.WithTracerProvider(providers.Tracers())); err != nil {
+		return nil, err
+	}
+	if err := redisotel.InstrumentMetrics(client, redisotel.WithMeterProvider(providers.Meters())); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisPingTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		slog.Warn("Redis indisponível, o cache de clima vai falhar até ele voltar", "addr", options.Addr, "error", err)
+	}
+	return client, nil
+}
 
-	log.Println("Server exited properly")
+// hostname returns the host name of a provider base URL
+func hostname(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// newCEPService creates the CEP providers in CEP_PROVIDERS order, chained so
+// each one falls back to the next
+func newCEPService(cfg config.Config, client services.HTTPClient, retry resilience.RetryPolicy, breaker resilience.BreakerConfig, providers observability.Providers) (services.CEPService, error) {
+	names, err := services.ParseCEPProviders(cfg.CEPProviders)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := make([]services.NamedCEPService, 0, len(names))
+	for _, name := range names {
+		var service services.CEPService
+		switch name {
+		case services.CEPProviderViaCEP:
+			service = services.NewViaCEPService(client, cfg.ViaCEPURL, providers).WithRetry(retry).WithBreaker(breaker)
+		case services.CEPProviderBrasilAPI:
+			service = services.NewBrasilAPIService(client, cfg.BrasilAPIURL, providers).WithRetry(retry).WithBreaker(breaker)
+		case services.CEPProviderOpenCEP:
+			service = services.NewOpenCEPService(client, cfg.OpenCEPURL, providers).WithRetry(retry).WithBreaker(breaker)
+		}
+		chain = append(chain, services.NamedCEPService{Name: name, Service: service})
+	}
+	if len(chain) == 1 {
+		return chain[0].Service, nil
+	}
+	return services.NewCEPServiceChain(chain, providers), nil
+}
+
+// newWeatherService creates the default weather provider and those
+// WEATHER_PROVIDER_RULES routes states to, behind a router picking between
+// them per UF. The names of the providers in use are returned too.
+func newWeatherService(cfg config.Config, client services.HTTPClient, endpoints []services.WeatherEndpoint, selection services.EndpointSelection, retry resilience.RetryPolicy, breaker resilience.BreakerConfig, providers observability.Providers) (services.WeatherService, []string, error) {
+	if cfg.WeatherProvider != services.WeatherProviderWeatherAPI && cfg.WeatherProvider != services.WeatherProviderOpenWeatherMap {
+		return nil, nil, fmt.Errorf("unknown WEATHER_PROVIDER %q: want weatherapi or openweathermap", cfg.WeatherProvider)
+	}
+	routes, err := services.ParseWeatherRoutes(cfg.WeatherProviderRules)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := []string{cfg.WeatherProvider}
+	for _, name := range slices.Sorted(maps.Values(routes)) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	weatherServices := make(map[string]services.WeatherService, len(names))
+	for _, name := range names {
+		switch name {
+		case services.WeatherProviderWeatherAPI:
+			weatherServices[name] = services.NewRegionalWeatherAPIService(client, endpoints, selection, cfg.WeatherAPIKey, providers).WithRetry(retry).WithBreaker(breaker)
+		case services.WeatherProviderOpenWeatherMap:
+			weatherServices[name] = services.NewOpenWeatherMapService(client, cfg.OpenWeatherMapURL, cfg.OpenWeatherMapAPIKey, providers).WithRetry(retry).WithBreaker(breaker)
+		}
+	}
+	return services.NewWeatherRouter(weatherServices, routes, cfg.WeatherProvider, providers), names, nil
+}
+
+// newHealthChecker probes the providers in use and their credentials. The CEP
+// and weather providers only degrade readiness when unreachable: every
+// replica shares them, so failing readiness would take the whole service out
+// instead of answering from the caches and fallbacks. A missing key can't
+// recover on its own and fails it.
+func newHealthChecker(cfg config.Config, client *http.Client, cepProviders, weatherProviders []string, weatherEndpoints []services.WeatherEndpoint) *health.Checker {
+	timeout := time.Duration(cfg.HealthTimeoutMS) * time.Millisecond
+	cacheFor := time.Duration(cfg.HealthCacheSeconds) * time.Second
+	if cfg.SandboxMode {
+		return health.NewChecker(timeout, cacheFor)
+	}
+
+	cepURLs := map[string]string{
+		services.CEPProviderViaCEP:    cfg.ViaCEPURL,
+		services.CEPProviderBrasilAPI: cfg.BrasilAPIURL,
+		services.CEPProviderOpenCEP:   cfg.OpenCEPURL,
+	}
+	var checks []health.Check
+	for _, name := range cepProviders {
+		checks = append(checks, health.Check{Name: name, Probe: health.Reachable(client, cepURLs[name])})
+	}
+
+	for _, provider := range weatherProviders {
+		switch provider {
+		case services.WeatherProviderWeatherAPI:
+			for _, endpoint := range weatherEndpoints {
+				name := services.WeatherProviderWeatherAPI
+				if len(weatherEndpoints) > 1 {
+					name += "/" + endpoint.Region
+				}
+				checks = append(checks, health.Check{Name: name, Probe: health.Reachable(client, endpoint.URL)})
+			}
+			checks = append(checks, health.Check{Name: "weatherapi_api_key", Critical: true, Probe: health.Configured(cfg.WeatherAPIKey)})
+		case services.WeatherProviderOpenWeatherMap:
+			checks = append(checks,
+				health.Check{Name: services.WeatherProviderOpenWeatherMap, Probe: health.Reachable(client, cfg.OpenWeatherMapURL)},
+				health.Check{Name: "openweathermap_api_key", Critical: true, Probe: health.Configured(cfg.OpenWeatherMapAPIKey)},
+			)
+		}
+	}
+	return health.NewChecker(timeout, cacheFor, checks...)
 }
@@ -0,0 +1,347 @@
+// Command fakeproviders serves ViaCEP-, BrasilAPI-, OpenCEP-, WeatherAPI- and
+// OpenWeatherMap-compatible endpoints
+// from seed data, so the docker-compose stack and load tests can run without
+// reaching the real providers
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// seedData is the data served by the fake providers
+type seedData struct {
+	// Addresses maps CEPs (digits only) to their ViaCEP address
+	Addresses map[string]address `json:"addresses"`
+	// Temperatures maps city names to their current temperature in Celsius;
+	// other cities get a temperature derived from the seed
+	Temperatures map[string]float64 `json:"temperatures"`
+}
+
+type address struct {
+	Logradouro string `json:"logradouro"`
+	Bairro     string `json:"bairro"`
+	Localidade string `json:"localidade"`
+	UF         string `json:"uf"`
+}
+
+// defaultSeedData is served when no seed file is given
+var defaultSeedData = seedData{
+	Addresses: map[string]address{
+		"22450000": {Logradouro: "Rua Marquês de São Vicente", Bairro: "Gávea", Localidade: "Rio de Janeiro", UF: "RJ"},
+		"01001000": {Logradouro: "Praça da Sé", Bairro: "Sé", Localidade: "São Paulo", UF: "SP"},
+		"30130000": {Logradouro: "Avenida Afonso Pena", Bairro: "Centro", Localidade: "Belo Horizonte", UF: "MG"},
+		"35780000": {Localidade: "Curvelo", UF: "MG"},
+		"70040000": {Logradouro: "Esplanada dos Ministérios", Bairro: "Zona Cívico-Administrativa", Localidade: "Brasília", UF: "DF"},
+	},
+	Temperatures: map[string]float64{
+		"Rio de Janeiro": 28.5,
+		"São Paulo":      22.0,
+	},
+}
+
+// fakeProviders serves the fake ViaCEP and WeatherAPI endpoints
+type fakeProviders struct {
+	data    seedData
+	seed    int64
+	latency time.Duration
+	jitter  time.Duration
+
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+func main() {
+	port := flag.String("port", getEnv("PORT", "8090"), "port to listen on")
+	seedFile := flag.String("seed-file", os.Getenv("SEED_FILE"), "JSON file with addresses and temperatures to serve")
+	seed := flag.Int64("seed", 1, "seed for temperatures of unlisted cities and for latency jitter")
+	latency := flag.Duration("latency", 0, "base latency added to every response")
+	jitter := flag.Duration("jitter", 0, "random latency added on top of -latency")
+	flag.Parse()
+
+	log.SetPrefix("[FAKE-PROVIDERS] ")
+
+	data := defaultSeedData
+	if *seedFile != "" {
+		raw, err := os.ReadFile(*seedFile)
+		if err != nil {
+			log.Fatalf("Failed to read seed file: %v", err)
+		}
+		if err := json.Unmarshal(raw, &data); err != nil {
+			log.Fatalf("Failed to parse seed file: %v", err)
+		}
+	}
+
+	fake := &fakeProviders{
+		data:    data,
+		seed:    *seed,
+		latency: *latency,
+		jitter:  *jitter,
+		random:  rand.New(rand.NewSource(*seed)),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ws/{cep}/json/", fake.viaCEP)
+	mux.HandleFunc("GET /api/cep/v1/{cep}", fake.brasilAPI)
+	mux.HandleFunc("GET /v1/{file}", fake.openCEP)
+	mux.HandleFunc("GET /v1/current.json", fake.weatherAPI)
+	mux.HandleFunc("GET /v1/forecast.json", fake.weatherAPIForecast)
+	mux.HandleFunc("GET /data/2.5/weather", fake.openWeatherMap)
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	log.Printf("Serving %d addresses on port %s (latency %v, jitter %v)", len(data.Addresses), *port, *latency, *jitter)
+	if err := http.ListenAndServe(":"+*port, mux); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+// viaCEP mimics https://viacep.com.br/ws/{cep}/json/
+func (f *fakeProviders) viaCEP(w http.ResponseWriter, r *http.Request) {
+	f.delay()
+
+	cep := r.PathValue("cep")
+	if len(cep) != 8 || strings.Trim(cep, "0123456789") != "" {
+		// ViaCEP answers malformed CEPs with a 400 HTML page
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	addr, ok := f.data.Addresses[cep]
+	if !ok {
+		writeJSON(w, http.StatusOK, map[string]bool{"erro": true})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"cep":         cep[:5] + "-" + cep[5:],
+		"logradouro":  addr.Logradouro,
+		"complemento": "",
+		"bairro":      addr.Bairro,
+		"localidade":  addr.Localidade,
+		"uf":          addr.UF,
+	})
+}
+
+// brasilAPI mimics https://brasilapi.com.br/api/cep/v1/{cep}
+func (f *fakeProviders) brasilAPI(w http.ResponseWriter, r *http.Request) {
+	f.delay()
+
+	cep := r.PathValue("cep")
+	addr, ok := f.data.Addresses[cep]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"name":    "CepPromiseError",
+			"message": "Todos os serviços de CEP retornaram erro.",
+			"type":    "service_error",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"cep":          cep,
+		"state":        addr.UF,
+		"city":         addr.Localidade,
+		"neighborhood": addr.Bairro,
+		"street":       addr.Logradouro,
+		"service":      "fakeproviders",
+	})
+}
+
+// openCEP mimics https://opencep.com/v1/{cep}.json
+func (f *fakeProviders) openCEP(w http.ResponseWriter, r *http.Request) {
+	f.delay()
+
+	cep, ok := strings.CutSuffix(r.PathValue("file"), ".json")
+	addr, found := f.data.Addresses[cep]
+	if !ok || !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"cep":        cep[:5] + "-" + cep[5:],
+		"logradouro": addr.Logradouro,
+		"bairro":     addr.Bairro,
+		"localidade": addr.Localidade,
+		"uf":         addr.UF,
+	})
+}
+
+// weatherAPI mimics https://api.weatherapi.com/v1/current.json
+func (f *fakeProviders) weatherAPI(w http.ResponseWriter, r *http.Request) {
+	f.delay()
+
+	query := r.URL.Query()
+	if weatherAPIKey(r) == "" {
+		writeWeatherAPIError(w, http.StatusUnauthorized, 1002, "API key is invalid or not provided.")
+		return
+	}
+
+	city, region := weatherAPILocation(query.Get("q"))
+	if city == "" {
+		writeWeatherAPIError(w, http.StatusBadRequest, 1003, "Parameter q is missing.")
+		return
+	}
+
+	tempC, ok := f.data.Temperatures[city]
+	if !ok {
+		tempC = f.derivedTemperature(city)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"location": map[string]string{"name": city, "region": region, "country": "Brazil"},
+		"current": map[string]float64{
+			"temp_c": tempC,
+			"temp_f": math.Round((tempC*1.8+32)*10) / 10,
+		},
+	})
+}
+
+// weatherAPIKey returns the API key of a WeatherAPI request, sent in the key
+// header or query parameter
+func weatherAPIKey(r *http.Request) string {
+	if key := r.Header.Get("key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("key")
+}
+
+// weatherAPILocation splits a "city, region, country" query into the city and
+// region matched, as svc-b qualifies its cities
+func weatherAPILocation(q string) (city, region string) {
+	parts := strings.Split(q, ",")
+	city = strings.TrimSpace(parts[0])
+	if len(parts) > 2 {
+		region = strings.TrimSpace(parts[1])
+	}
+	return city, region
+}
+
+// weatherAPIForecast mimics https://api.weatherapi.com/v1/forecast.json, with
+// the city's current temperature as the average of every day
+func (f *fakeProviders) weatherAPIForecast(w http.ResponseWriter, r *http.Request) {
+	f.delay()
+
+	query := r.URL.Query()
+	if weatherAPIKey(r) == "" {
+		writeWeatherAPIError(w, http.StatusUnauthorized, 1002, "API key is invalid or not provided.")
+		return
+	}
+
+	city, region := weatherAPILocation(query.Get("q"))
+	if city == "" {
+		writeWeatherAPIError(w, http.StatusBadRequest, 1003, "Parameter q is missing.")
+		return
+	}
+
+	tempC, ok := f.data.Temperatures[city]
+	if !ok {
+		tempC = f.derivedTemperature(city)
+	}
+
+	days, err := strconv.Atoi(query.Get("days"))
+	if err != nil || days < 1 {
+		days = 1
+	}
+	today := time.Now()
+	forecastDays := make([]map[string]interface{}, min(days, 14))
+	for i := range forecastDays {
+		forecastDays[i] = map[string]interface{}{
+			"date": today.AddDate(0, 0, i).Format(time.DateOnly),
+			"day": map[string]interface{}{
+				"mintemp_c": tempC - 4,
+				"maxtemp_c": tempC + 4,
+				"avgtemp_c": tempC,
+				"condition": map[string]int{"code": 1000},
+			},
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"location": map[string]string{"name": city, "region": region, "country": "Brazil"},
+		"forecast": map[string]interface{}{"forecastday": forecastDays},
+	})
+}
+
+// openWeatherMap mimics https://api.openweathermap.org/data/2.5/weather with
+// units=metric
+func (f *fakeProviders) openWeatherMap(w http.ResponseWriter, r *http.Request) {
+	f.delay()
+
+	query := r.URL.Query()
+	if query.Get("appid") == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"cod": 401, "message": "Invalid API key."})
+		return
+	}
+
+	city, _, _ := strings.Cut(query.Get("q"), ",")
+	if city == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"cod": "400", "message": "Nothing to geocode"})
+		return
+	}
+
+	tempC, ok := f.data.Temperatures[city]
+	if !ok {
+		tempC = f.derivedTemperature(city)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name": city,
+		"main": map[string]float64{"temp": tempC},
+		"cod":  200,
+	})
+}
+
+// derivedTemperature gives unlisted cities a stable temperature between 10
+// and 35°C that only changes with the seed
+func (f *fakeProviders) derivedTemperature(city string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(city))
+	r := rand.New(rand.NewSource(f.seed ^ int64(h.Sum64())))
+	return math.Round((10+r.Float64()*25)*10) / 10
+}
+
+// delay applies the configured latency and jitter
+func (f *fakeProviders) delay() {
+	d := f.latency
+	if f.jitter > 0 {
+		f.mu.Lock()
+		d += time.Duration(f.random.Int63n(int64(f.jitter)))
+		f.mu.Unlock()
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+func writeWeatherAPIError(w http.ResponseWriter, code, apiCode int, message string) {
+	writeJSON(w, code, map[string]interface{}{
+		"error": map[string]interface{}{"code": apiCode, "message": message},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(payload)
+}
+
+// getEnv retrieves an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,37 @@
+// Package codec is the JSON encoding used on svc-b's hot paths. It defaults to
+// encoding/json; building with -tags jsoniter swaps in json-iterator, whose
+// output the conformance tests hold identical to encoding/json's.
+package codec
+
+import "io"
+
+// Codec encodes and decodes JSON
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Decoder reads successive JSON values from a stream
+type Decoder interface {
+	Decode(v any) error
+}
+
+// Default is the codec selected at build time
+var Default Codec = defaultCodec
+
+// Marshal encodes v with the default codec
+func Marshal(v any) ([]byte, error) {
+	return Default.Marshal(v)
+}
+
+// Unmarshal decodes data into v with the default codec
+func Unmarshal(data []byte, v any) error {
+	return Default.Unmarshal(data, v)
+}
+
+// NewDecoder returns a default codec decoder reading from r
+func NewDecoder(r io.Reader) Decoder {
+	return Default.NewDecoder(r)
+}
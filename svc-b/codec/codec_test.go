@@ -0,0 +1,120 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+// weatherPayload mirrors the hot-path response shapes
+type weatherPayload struct {
+	City  string  `json:"city"`
+	TempC float64 `json:"temp_C"`
+	TempF float64 `json:"temp_F"`
+	TempK float64 `json:"temp_K"`
+}
+
+type errorPayload struct {
+	Error    string `json:"error"`
+	Limit    string `json:"limit,omitempty"`
+	TraceURL string `json:"trace_url,omitempty"`
+}
+
+// conformanceCases covers the values whose encoding most often differs
+// between JSON libraries: floats, escaping, map ordering and raw messages
+var conformanceCases = map[string]any{
+	"weather":          weatherPayload{City: "São Paulo", TempC: 25.35, TempF: 77.63, TempK: 298.5},
+	"whole floats":     weatherPayload{City: "Rio de Janeiro", TempC: 25, TempF: 77, TempK: 298.15},
+	"extreme floats":   []float64{1e21, 1e-7, 0.000001, 123456789.123, -0.5},
+	"html escaping":    errorPayload{Error: "<script>alert('x')</script> & more", TraceURL: "http://localhost:9411/zipkin/traces/abc?a=1&b=2"},
+	"omitempty":        errorPayload{Error: "invalid zipcode"},
+	"unicode":          map[string]string{"city": "Florianópolis", "emoji": "☀  "},
+	"sorted map keys":  map[string]int{"temp_K": 3, "city": 1, "temp_C": 2},
+	"raw message map":  map[string]json.RawMessage{"temp_C": json.RawMessage(`25.5`), "city": json.RawMessage(`"Rio"`)},
+	"nil slice":        struct{ Items []string }{},
+	"nested interface": map[string]any{"meta": map[string]any{"attempts": 2, "ok": true, "none": nil}},
+}
+
+func TestDefaultCodecMatchesEncodingJSON(t *testing.T) {
+	t.Parallel()
+
+	for name, value := range conformanceCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			expected, err := json.Marshal(value)
+			if err != nil {
+				t.Fatalf("encoding/json failed: %v", err)
+			}
+			got, err := Marshal(value)
+			if err != nil {
+				t.Fatalf("%s failed: %v", Default.Name(), err)
+			}
+			if !bytes.Equal(got, expected) {
+				t.Errorf("%s encoded %s, encoding/json %s", Default.Name(), got, expected)
+			}
+		})
+	}
+}
+
+func TestDefaultCodecRejectsUnsupportedFloats(t *testing.T) {
+	t.Parallel()
+
+	if _, err := Marshal(weatherPayload{TempC: math.NaN()}); err == nil {
+		t.Errorf("%s encoded NaN, encoding/json rejects it", Default.Name())
+	}
+}
+
+func TestDefaultCodecDecodesLikeEncodingJSON(t *testing.T) {
+	t.Parallel()
+
+	const input = `{"city":"São Paulo","temp_C":25.35,"temp_F":77.63,"temp_K":298.5,"unknown":[1,2]}`
+
+	var expected, got weatherPayload
+	if err := json.Unmarshal([]byte(input), &expected); err != nil {
+		t.Fatalf("encoding/json failed: %v", err)
+	}
+	if err := NewDecoder(strings.NewReader(input)).Decode(&got); err != nil {
+		t.Fatalf("%s failed: %v", Default.Name(), err)
+	}
+	if got != expected {
+		t.Errorf("%s decoded %+v, encoding/json %+v", Default.Name(), got, expected)
+	}
+
+	if err := Unmarshal([]byte(`{"city":`), &got); err == nil {
+		t.Errorf("%s accepted truncated JSON", Default.Name())
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	payload := weatherPayload{City: "Rio de Janeiro", TempC: 25.35, TempF: 77.63, TempK: 298.5}
+
+	for _, c := range []Codec{Stdlib{}, Default} {
+		b.Run(c.Name(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Marshal(payload); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	data := []byte(`{"current":{"temp_c":25.35,"temp_f":77.63},"location":{"name":"Rio de Janeiro","region":"Rio de Janeiro","country":"Brazil"}}`)
+
+	for _, c := range []Codec{Stdlib{}, Default} {
+		b.Run(c.Name(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var v map[string]any
+				if err := c.Unmarshal(data, &v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !jsoniter
+
+package codec
+
+var defaultCodec Codec = Stdlib{}
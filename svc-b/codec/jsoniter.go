@@ -0,0 +1,72 @@
+//go:build jsoniter
+
+package codec
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unsafe"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var defaultCodec Codec = JSONIter{}
+
+// compatible matches encoding/json's output: sorted map keys and HTML escaping.
+// Floats get encoding/json's formatting through the encoders registered below.
+var compatible = jsoniter.ConfigCompatibleWithStandardLibrary
+
+func init() {
+	jsoniter.RegisterTypeEncoderFunc("float64", func(ptr unsafe.Pointer, stream *jsoniter.Stream) {
+		writeFloat(stream, *(*float64)(ptr), 64)
+	}, nil)
+	jsoniter.RegisterTypeEncoderFunc("float32", func(ptr unsafe.Pointer, stream *jsoniter.Stream) {
+		writeFloat(stream, float64(*(*float32)(ptr)), 32)
+	}, nil)
+}
+
+// writeFloat formats f like encoding/json: exponent notation only for very
+// small or large magnitudes, with a minimal exponent (1e-7 rather than 1e-07)
+func writeFloat(stream *jsoniter.Stream, f float64, bits int) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		stream.Error = fmt.Errorf("json: unsupported value: %s", strconv.FormatFloat(f, 'g', -1, bits))
+		return
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+
+	b := strconv.AppendFloat(nil, f, format, -1, bits)
+	if format == 'e' {
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	stream.Write(b)
+}
+
+// JSONIter is the json-iterator codec, selected with -tags jsoniter
+type JSONIter struct{}
+
+func (JSONIter) Name() string {
+	return "json-iterator"
+}
+
+func (JSONIter) Marshal(v any) ([]byte, error) {
+	return compatible.Marshal(v)
+}
+
+func (JSONIter) Unmarshal(data []byte, v any) error {
+	return compatible.Unmarshal(data, v)
+}
+
+func (JSONIter) NewDecoder(r io.Reader) Decoder {
+	return compatible.NewDecoder(r)
+}
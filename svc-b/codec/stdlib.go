@@ -0,0 +1,25 @@
+package codec
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Stdlib is the encoding/json codec
+type Stdlib struct{}
+
+func (Stdlib) Name() string {
+	return "encoding/json"
+}
+
+func (Stdlib) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (Stdlib) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (Stdlib) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
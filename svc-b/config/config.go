@@ -0,0 +1,355 @@
+package config
+
+import (
+	"errors"
+	"math"
+	"pkg/settings"
+	"strconv"
+	"strings"
+)
+
+// Config holds all application configuration
+type Config struct {
+	Port      string
+	ZipkinURL string
+	// ExporterType selects the span exporter: zipkin, otlp-grpc, otlp-http or stdout
+	ExporterType string
+	// TraceIDSeed, when not 0, makes trace and span IDs repeat across runs
+	TraceIDSeed int64
+	// MetricsExporter selects the metric exporter: none, otlp-grpc, otlp-http or stdout
+	MetricsExporter string
+	// LogsExporter exports the logs through OpenTelemetry too: none, otlp-grpc, otlp-http or stdout
+	LogsExporter string
+	// LogLevel (debug, info, warn, error) and LogFormat (json, text) shape the logs
+	LogLevel      string
+	LogFormat     string
+	WeatherAPIKey string
+	// WeatherProvider selects the weather provider: weatherapi or
+	// openweathermap, which uses OpenWeatherMapAPIKey and OpenWeatherMapURL
+	WeatherProvider string
+	// WeatherProviderRules routes the states with better coverage on another
+	// provider to it, as UF=provider pairs, e.g. AM=openweathermap; other
+	// states use WeatherProvider
+	WeatherProviderRules string
+	OpenWeatherMapAPIKey string
+	OpenWeatherMapURL    string
+	// ViaCEPURL, BrasilAPIURL, OpenCEPURL and WeatherAPIURL are the provider
+	// base URLs, overridable to point at cmd/fakeproviders
+	ViaCEPURL     string
+	BrasilAPIURL  string
+	OpenCEPURL    string
+	WeatherAPIURL string
+	// CEPProviders is the order CEP providers are tried in, falling back to
+	// the next one when a provider fails or doesn't know the CEP
+	CEPProviders string
+	// CEPRules enables CEP validation rules as name=action pairs, e.g.
+	// reserved_ranges=flag; actions are reject and flag
+	CEPRules string
+	// TemperaturePrecision is how many decimal places (0-6) temperatures are
+	// answered with, unless a request asks for its own ?precision=
+	TemperaturePrecision int
+	// WeatherAPIEndpoints, as region=url pairs, replaces WeatherAPIURL with
+	// regional endpoints chosen by WeatherAPIEndpointSelection (ordered or
+	// latency), failing over between them
+	WeatherAPIEndpoints         string
+	WeatherAPIEndpointSelection string
+	// BreakerFailureThreshold consecutive failures open a provider's circuit
+	// breaker, failing its calls fast for BreakerOpenSeconds before a probe
+	BreakerFailureThreshold int
+	BreakerOpenSeconds      int
+	// RetryMaxAttempts bounds the attempts per provider call; retries back off
+	// exponentially from RetryBaseDelayMS up to RetryMaxDelayMS, shortened by
+	// up to RetryJitter of the delay
+	RetryMaxAttempts int
+	RetryBaseDelayMS int
+	RetryMaxDelayMS  int
+	RetryJitter      float64
+	// Environment selects the deployment profile, e.g. production or development
+	Environment string
+	// SpanNamePrefixes, as environment=prefix pairs, prefixes the exported
+	// span names in environments sharing a Zipkin with others
+	SpanNamePrefixes string
+	// ZipkinUIURL is the Zipkin UI base used for trace links in the dev profile
+	ZipkinUIURL string
+	Limits      Limits
+	// ResponseProfilesFile points to the per-API-key response field mappings
+	ResponseProfilesFile string
+	// EffectiveConfigFile optionally receives the effective configuration dump on boot
+	EffectiveConfigFile string
+	// ConfigFile is the YAML or JSON file loaded under the environment, named
+	// by CONFIG_FILE or --config-file
+	ConfigFile string
+	// SandboxMode replaces the external providers with canned fakes that honour
+	// ?simulate= failure scenarios
+	SandboxMode bool
+	// SpanMaxAttributes and SpanMaxAttributeLength bound the attributes
+	// exported per span; 0 disables the bound
+	SpanMaxAttributes      int
+	SpanMaxAttributeLength int
+	// PropagationInternalHosts receive full trace context and baggage on
+	// outbound calls; every other host is treated as an external provider
+	PropagationInternalHosts []string
+	// PropagationExternalBaggage lists the baggage members forwarded to
+	// external providers as X- headers
+	PropagationExternalBaggage []string
+	// BaggageAttributes lists the baggage members received from callers (svc-a
+	// sets client_id, request_id and cep) recorded on every span and log line
+	BaggageAttributes []string
+	// CacheBackend selects where the weather cache lives: memory, redis (at
+	// RedisURL, shared by every instance) or none
+	CacheBackend string
+	RedisURL     string
+	// WeatherCacheTTLSeconds enables the weather cache when positive, holding
+	// up to WeatherCacheMaxEntries cities in memory
+	WeatherCacheTTLSeconds int
+	WeatherCacheMaxEntries int
+	// WeatherCacheBeta tunes early refresh of hot entries; 0 disables it
+	WeatherCacheBeta float64
+	// CEPCacheTTLSeconds enables the CEP cache when positive, holding up to
+	// CEPCacheMaxEntries CEPs
+	CEPCacheTTLSeconds int
+	CEPCacheMaxEntries int
+	// CacheSnapshotDir, when set, persists the in-memory caches across restarts
+	CacheSnapshotDir string
+	// GCPercent (GOGC) and MemoryLimitBytes (GOMEMLIMIT) tune the garbage
+	// collector; -1 turns GOGC off and 0 derives the memory limit from the
+	// container as MemoryLimitRatio of its cgroup limit
+	GCPercent        int
+	MemoryLimitBytes int64
+	MemoryLimitRatio float64
+	// ResponseSigningKeys, as id:secret pairs with the current key first and
+	// optionally the previous one, enables HMAC signing of every response
+	ResponseSigningKeys string
+	// RecentRequestsSize is how many sanitized requests /internal/recent
+	// keeps; 0 turns the buffer off
+	RecentRequestsSize int
+	// CEPAnalyticsHours is how many hours of lookups by UF and city
+	// /internal/analytics/ceps keeps in memory; 0 turns it off
+	CEPAnalyticsHours int
+	// REDMetrics enables the in-process per-route summary on /internal/red
+	REDMetrics bool
+	// Dashboard serves the single-page dashboard on /dashboard
+	Dashboard bool
+	// BatchConcurrency is how many CEPs of a batch are resolved at once
+	BatchConcurrency int
+	// LongPollIntervalSeconds is how often a request waiting for a temperature
+	// change re-reads the temperature, through the weather cache
+	LongPollIntervalSeconds int
+	// AdminToken authenticates the /admin endpoints, which are disabled without it
+	AdminToken string
+	// IoTIngestToken authenticates the sensors pushing readings to
+	// /ingest/temperature, which is disabled without it. A CEP's latest
+	// reading answers for it for IoTReadingMaxAgeSeconds.
+	IoTIngestToken          string
+	IoTReadingMaxAgeSeconds int
+	// MaintenanceMode starts the service answering clients with 503, with
+	// MaintenanceMessage and Retry-After MaintenanceRetrySeconds; it can
+	// be switched at runtime through /admin/maintenance
+	MaintenanceMode         bool
+	MaintenanceMessage      string
+	MaintenanceRetrySeconds int
+	// HealthTimeoutMS bounds each /readyz check and HealthCacheSeconds how
+	// long their results are reused, sparing the providers a probe per call
+	HealthTimeoutMS    int
+	HealthCacheSeconds int
+	// CompressionMinBytes is the smallest response compressed for clients
+	// accepting gzip or deflate; 0 turns compression off
+	CompressionMinBytes int
+	// CorrelationTTLSeconds is how long the tokens tagged on WeatherAPI
+	// requests are kept for support tickets, up to CorrelationMaxEntries; 0
+	// turns tagging off
+	CorrelationTTLSeconds int
+	CorrelationMaxEntries int
+	// TLSMinVersion (1.2 or 1.3) and TLSCipherSuites, a comma-separated
+	// allow-list of crypto/tls suite names, apply to every outbound call.
+	// TLSPinsViaCEP and TLSPinsWeatherAPI optionally pin the providers'
+	// certificates, as comma-separated base64 SHA-256 public key hashes
+	TLSMinVersion     string
+	TLSCipherSuites   string
+	TLSPinsViaCEP     string
+	TLSPinsWeatherAPI string
+	// ProxyMode serves the weather providers through a caching proxy at
+	// /proxy/{provider}/, also reachable with svc-b as an HTTP forward proxy.
+	// Responses are kept as their Cache-Control allows, ProxyDefaultTTL when
+	// they declare no lifetime, bounded by ProxyMinTTL and ProxyMaxTTL
+	ProxyMode              bool
+	ProxyDefaultTTLSeconds int
+	ProxyMinTTLSeconds     int
+	ProxyMaxTTLSeconds     int
+	ProxyCacheMaxEntries   int
+	// EventsWebhookURL, when set, receives operational events (breaker
+	// opened, API key rejected) for the ops channel
+	EventsWebhookURL string
+	// MaxProcs (GOMAXPROCS) overrides the value derived from the container
+	// CPU quota when positive
+	MaxProcs int
+	// UpstreamQuotas caps the calls to each provider, as provider:max/window
+	// entries, e.g. weatherapi:1000/day,viacep:60/minute
+	UpstreamQuotas string
+	// QuotaStateFile, when set, persists the quota counters across restarts
+	QuotaStateFile string
+	// PrometheusMetrics exposes every metric, with the Go runtime and process
+	// stats, on /metrics for Prometheus to scrape
+	PrometheusMetrics bool
+	// LegacyEnv lists the renamed variables and which old names were used
+	LegacyEnv []LegacyEnvVar
+}
+
+// Limits holds the server limits enforced on requests and reported to clients
+type Limits struct {
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+	// MaxBatchCEPs bounds the CEPs of a POST /weather/batch
+	MaxBatchCEPs int `json:"max_batch_ceps"`
+	// MaxLongPollSeconds bounds the timeout of a wait for a temperature change
+	MaxLongPollSeconds int `json:"max_long_poll_seconds"`
+	// MaxLongPollWaiters bounds the requests waiting for a change at once
+	MaxLongPollWaiters int `json:"max_long_poll_waiters"`
+}
+
+// LoadConfig loads configuration from src (flags, environment variables and
+// the config file, over defaults), after copying the legacy variable names to
+// the new ones. It fails on values that don't parse, on unknown flags or file
+// keys and on configurations Validate rejects.
+func LoadConfig(src *settings.Source) (Config, error) {
+	legacy := migrateLegacyEnv()
+	cfg := Config{
+		Port:                        src.String("PORT", "8081"),
+		ZipkinURL:                   src.String("ZIPKIN_URL", "http://zipkin:9411/api/v2/spans"),
+		ExporterType:                src.String("TRACES_EXPORTER", "zipkin"),
+		TraceIDSeed:                 int64(src.Int("TRACE_ID_SEED", 0)),
+		MetricsExporter:             src.String("METRICS_EXPORTER", "none"),
+		LogsExporter:                src.String("LOGS_EXPORTER", "none"),
+		LogLevel:                    src.String("LOG_LEVEL", "info"),
+		LogFormat:                   src.String("LOG_FORMAT", "json"),
+		WeatherAPIKey:               src.String("WEATHERAPI_API_KEY", ""),
+		WeatherProvider:             src.String("WEATHER_PROVIDER", "weatherapi"),
+		WeatherProviderRules:        src.String("WEATHER_PROVIDER_RULES", ""),
+		OpenWeatherMapAPIKey:        src.String("OPENWEATHERMAP_API_KEY", ""),
+		OpenWeatherMapURL:           src.String("OPENWEATHERMAP_URL", "https://api.openweathermap.org"),
+		ViaCEPURL:                   src.String("VIACEP_URL", "https://viacep.com.br"),
+		BrasilAPIURL:                src.String("BRASILAPI_URL", "https://brasilapi.com.br"),
+		OpenCEPURL:                  src.String("OPENCEP_URL", "https://opencep.com"),
+		CEPProviders:                src.String("CEP_PROVIDERS", "viacep,brasilapi,opencep"),
+		CEPRules:                    src.String("CEP_RULES", ""),
+		TemperaturePrecision:        src.Int("TEMPERATURE_PRECISION", 2),
+		WeatherAPIURL:               src.String("WEATHERAPI_URL", "https://api.weatherapi.com"),
+		WeatherAPIEndpoints:         src.String("WEATHERAPI_ENDPOINTS", ""),
+		WeatherAPIEndpointSelection: src.String("WEATHERAPI_ENDPOINT_SELECTION", "ordered"),
+		BreakerFailureThreshold:     src.Int("BREAKER_FAILURE_THRESHOLD", 5),
+		BreakerOpenSeconds:          src.Int("BREAKER_OPEN_SECONDS", 30),
+		RetryMaxAttempts:            src.Int("UPSTREAM_RETRY_MAX_ATTEMPTS", 3),
+		RetryBaseDelayMS:            src.Int("UPSTREAM_RETRY_BASE_DELAY_MS", 100),
+		RetryMaxDelayMS:             src.Int("UPSTREAM_RETRY_MAX_DELAY_MS", 2000),
+		RetryJitter:                 src.Float("UPSTREAM_RETRY_JITTER", 0.2),
+		Environment:                 src.String("ENVIRONMENT", "production"),
+		SpanNamePrefixes:            src.String("SPAN_NAME_PREFIXES", ""),
+		ZipkinUIURL:                 src.String("ZIPKIN_UI_URL", ""),
+		Limits: Limits{
+			MaxBodyBytes:       int64(src.Int("MAX_BODY_BYTES", 4<<10)),
+			MaxBatchCEPs:       src.Int("BATCH_MAX_CEPS", 20),
+			MaxLongPollSeconds: src.Int("LONG_POLL_MAX_SECONDS", 120),
+			MaxLongPollWaiters: src.Int("LONG_POLL_MAX_WAITERS", 100),
+		},
+		ResponseProfilesFile:       src.String("RESPONSE_PROFILES_FILE", ""),
+		EffectiveConfigFile:        src.String("EFFECTIVE_CONFIG_FILE", ""),
+		SandboxMode:                src.Bool("SANDBOX_MODE", false),
+		SpanMaxAttributes:          src.Int("SPAN_MAX_ATTRIBUTES", 64),
+		SpanMaxAttributeLength:     src.Int("SPAN_MAX_ATTRIBUTE_LENGTH", 1024),
+		PropagationInternalHosts:   src.List("PROPAGATION_INTERNAL_HOSTS", nil),
+		PropagationExternalBaggage: src.List("PROPAGATION_EXTERNAL_BAGGAGE", []string{"request_id"}),
+		BaggageAttributes:          src.List("BAGGAGE_ATTRIBUTES", []string{"client_id", "request_id", "cep"}),
+		CacheBackend:               src.String("CACHE_BACKEND", "memory"),
+		RedisURL:                   src.String("REDIS_URL", "redis://localhost:6379/0"),
+		WeatherCacheTTLSeconds:     src.Int("WEATHER_CACHE_TTL_SECONDS", 300),
+		WeatherCacheMaxEntries:     src.Int("WEATHER_CACHE_MAX_ENTRIES", 1000),
+		WeatherCacheBeta:           src.Float("WEATHER_CACHE_BETA", 1),
+		CEPCacheTTLSeconds:         src.Int("CEP_CACHE_TTL_SECONDS", 86400),
+		CEPCacheMaxEntries:         src.Int("CEP_CACHE_MAX_ENTRIES", 10000),
+		CacheSnapshotDir:           src.String("CACHE_SNAPSHOT_DIR", ""),
+		ResponseSigningKeys:        src.String("RESPONSE_SIGNING_KEYS", ""),
+		RecentRequestsSize:         src.Int("RECENT_REQUESTS_SIZE", 100),
+		CEPAnalyticsHours:          src.Int("CEP_ANALYTICS_HOURS", 168),
+		REDMetrics:                 src.Bool("RED_METRICS", true),
+		Dashboard:                  src.Bool("DASHBOARD", true),
+		BatchConcurrency:           src.Int("BATCH_CONCURRENCY", 4),
+		LongPollIntervalSeconds:    src.Int("LONG_POLL_INTERVAL_SECONDS", 15),
+		AdminToken:                 src.String("ADMIN_TOKEN", ""),
+		IoTIngestToken:             src.String("IOT_INGEST_TOKEN", ""),
+		IoTReadingMaxAgeSeconds:    src.Int("IOT_READING_MAX_AGE_SECONDS", 900),
+		MaintenanceMode:            src.Bool("MAINTENANCE_MODE", false),
+		MaintenanceMessage:         src.String("MAINTENANCE_MESSAGE", ""),
+		MaintenanceRetrySeconds:    src.Int("MAINTENANCE_RETRY_SECONDS", 300),
+		HealthTimeoutMS:            src.Int("HEALTH_TIMEOUT_MS", 2000),
+		HealthCacheSeconds:         src.Int("HEALTH_CACHE_SECONDS", 10),
+		CompressionMinBytes:        src.Int("COMPRESSION_MIN_BYTES", 1024),
+		CorrelationTTLSeconds:      src.Int("CORRELATION_TTL_SECONDS", 259200),
+		CorrelationMaxEntries:      src.Int("CORRELATION_MAX_ENTRIES", 100000),
+		TLSMinVersion:              src.String("TLS_MIN_VERSION", "1.2"),
+		TLSCipherSuites:            src.String("TLS_CIPHER_SUITES", ""),
+		TLSPinsViaCEP:              src.String("TLS_PINS_VIACEP", ""),
+		TLSPinsWeatherAPI:          src.String("TLS_PINS_WEATHERAPI", ""),
+		ProxyMode:                  src.Bool("PROXY_MODE", false),
+		ProxyDefaultTTLSeconds:     src.Int("PROXY_DEFAULT_TTL_SECONDS", 300),
+		ProxyMinTTLSeconds:         src.Int("PROXY_MIN_TTL_SECONDS", 0),
+		ProxyMaxTTLSeconds:         src.Int("PROXY_MAX_TTL_SECONDS", 3600),
+		ProxyCacheMaxEntries:       src.Int("PROXY_CACHE_MAX_ENTRIES", 10000),
+		EventsWebhookURL:           src.String("EVENTS_WEBHOOK_URL", ""),
+		GCPercent:                  gcPercent(src, "GOGC", 100),
+		MemoryLimitBytes:           byteSize(src, "GOMEMLIMIT", 0),
+		MemoryLimitRatio:           src.Float("MEMORY_LIMIT_RATIO", 0.9),
+		MaxProcs:                   src.Int("GOMAXPROCS", 0),
+		UpstreamQuotas:             src.String("UPSTREAM_QUOTAS", ""),
+		QuotaStateFile:             src.String("QUOTA_STATE_FILE", ""),
+		PrometheusMetrics:          src.Bool("PROMETHEUS_METRICS", true),
+		ConfigFile:                 src.File(),
+		LegacyEnv:                  legacy,
+	}
+	return cfg, errors.Join(src.Err(), cfg.Validate())
+}
+
+// gcPercent reads a GOGC-style percentage, where "off" is -1
+func gcPercent(src *settings.Source, key string, defaultValue int) int {
+	if value, _ := src.Lookup(key); strings.EqualFold(value, "off") {
+		return -1
+	}
+	return src.Int(key, defaultValue)
+}
+
+// byteUnits are the GOMEMLIMIT size suffixes
+var byteUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"TiB", 1 << 40},
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"B", 1},
+}
+
+// byteSize reads a GOMEMLIMIT-style size (e.g. 512MiB) in bytes, where "off"
+// is 0
+func byteSize(src *settings.Source, key string, defaultValue int64) int64 {
+	raw, ok := src.Lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	value := strings.TrimSpace(raw)
+	if strings.EqualFold(value, "off") {
+		return 0
+	}
+
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, multiplier = strings.TrimSuffix(value, unit.suffix), unit.multiplier
+			break
+		}
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 || size > math.MaxInt64/multiplier {
+		src.Invalid(key, raw, errors.New("want a size in bytes, e.g. 512MiB, or off"))
+		return defaultValue
+	}
+	return size * multiplier
+}
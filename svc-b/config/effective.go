@@ -0,0 +1,255 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// EffectiveConfig is the machine-readable dump of the configuration a service
+// is actually running with, keyed by environment variable name
+type EffectiveConfig struct {
+	Service    string            `json:"service"`
+	StartedAt  time.Time         `json:"started_at"`
+	GoVersion  string            `json:"go_version"`
+	Config     map[string]string `json:"config"`
+	Subsystems map[string]bool   `json:"subsystems"`
+	// Runtime holds the Go runtime settings in effect after container-aware
+	// defaults were applied, keyed like their environment variables
+	Runtime map[string]string `json:"runtime,omitempty"`
+	// LegacyEnv maps the renamed variables to their new names, flagging the
+	// old names this deployment still uses
+	LegacyEnv []LegacyEnvVar `json:"legacy_env"`
+}
+
+// Effective renders the configuration keyed by the environment variables it
+// is loaded from, with secrets redacted, so it can be diffed against the
+// desired deployment state
+func (c Config) Effective() map[string]string {
+	return map[string]string{
+		"PORT":                          c.Port,
+		"ZIPKIN_URL":                    redactURL(c.ZipkinURL),
+		"TRACES_EXPORTER":               c.ExporterType,
+		"TRACE_ID_SEED":                 strconv.FormatInt(c.TraceIDSeed, 10),
+		"METRICS_EXPORTER":              c.MetricsExporter,
+		"LOGS_EXPORTER":                 c.LogsExporter,
+		"LOG_LEVEL":                     c.LogLevel,
+		"LOG_FORMAT":                    c.LogFormat,
+		"WEATHERAPI_API_KEY":            redactSecret(c.WeatherAPIKey),
+		"WEATHER_PROVIDER":              c.WeatherProvider,
+		"WEATHER_PROVIDER_RULES":        c.WeatherProviderRules,
+		"OPENWEATHERMAP_API_KEY":        redactSecret(c.OpenWeatherMapAPIKey),
+		"OPENWEATHERMAP_URL":            redactURL(c.OpenWeatherMapURL),
+		"VIACEP_URL":                    redactURL(c.ViaCEPURL),
+		"BRASILAPI_URL":                 redactURL(c.BrasilAPIURL),
+		"OPENCEP_URL":                   redactURL(c.OpenCEPURL),
+		"CEP_PROVIDERS":                 c.CEPProviders,
+		"CEP_RULES":                     c.CEPRules,
+		"TEMPERATURE_PRECISION":         strconv.Itoa(c.TemperaturePrecision),
+		"WEATHERAPI_URL":                redactURL(c.WeatherAPIURL),
+		"WEATHERAPI_ENDPOINTS":          redactEndpoints(c.WeatherAPIEndpoints),
+		"WEATHERAPI_ENDPOINT_SELECTION": c.WeatherAPIEndpointSelection,
+		"BREAKER_FAILURE_THRESHOLD":     strconv.Itoa(c.BreakerFailureThreshold),
+		"BREAKER_OPEN_SECONDS":          strconv.Itoa(c.BreakerOpenSeconds),
+		"UPSTREAM_RETRY_MAX_ATTEMPTS":   strconv.Itoa(c.RetryMaxAttempts),
+		"UPSTREAM_RETRY_BASE_DELAY_MS":  strconv.Itoa(c.RetryBaseDelayMS),
+		"UPSTREAM_RETRY_MAX_DELAY_MS":   strconv.Itoa(c.RetryMaxDelayMS),
+		"UPSTREAM_RETRY_JITTER":         strconv.FormatFloat(c.RetryJitter, 'g', -1, 64),
+		"ENVIRONMENT":                   c.Environment,
+		"SPAN_NAME_PREFIXES":            c.SpanNamePrefixes,
+		"ZIPKIN_UI_URL":                 redactURL(c.ZipkinUIURL),
+		"MAX_BODY_BYTES":                strconv.FormatInt(c.Limits.MaxBodyBytes, 10),
+		"BATCH_MAX_CEPS":                strconv.Itoa(c.Limits.MaxBatchCEPs),
+		"BATCH_CONCURRENCY":             strconv.Itoa(c.BatchConcurrency),
+		"LONG_POLL_INTERVAL_SECONDS":    strconv.Itoa(c.LongPollIntervalSeconds),
+		"LONG_POLL_MAX_SECONDS":         strconv.Itoa(c.Limits.MaxLongPollSeconds),
+		"LONG_POLL_MAX_WAITERS":         strconv.Itoa(c.Limits.MaxLongPollWaiters),
+		"RESPONSE_PROFILES_FILE":        c.ResponseProfilesFile,
+		"EFFECTIVE_CONFIG_FILE":         c.EffectiveConfigFile,
+		"CONFIG_FILE":                   c.ConfigFile,
+		"SANDBOX_MODE":                  strconv.FormatBool(c.SandboxMode),
+		"SPAN_MAX_ATTRIBUTES":           strconv.Itoa(c.SpanMaxAttributes),
+		"SPAN_MAX_ATTRIBUTE_LENGTH":     strconv.Itoa(c.SpanMaxAttributeLength),
+		"PROPAGATION_INTERNAL_HOSTS":    strings.Join(c.PropagationInternalHosts, ","),
+		"PROPAGATION_EXTERNAL_BAGGAGE":  strings.Join(c.PropagationExternalBaggage, ","),
+		"BAGGAGE_ATTRIBUTES":            strings.Join(c.BaggageAttributes, ","),
+		"CACHE_BACKEND":                 c.CacheBackend,
+		"REDIS_URL":                     redactURL(c.RedisURL),
+		"WEATHER_CACHE_TTL_SECONDS":     strconv.Itoa(c.WeatherCacheTTLSeconds),
+		"WEATHER_CACHE_MAX_ENTRIES":     strconv.Itoa(c.WeatherCacheMaxEntries),
+		"WEATHER_CACHE_BETA":            strconv.FormatFloat(c.WeatherCacheBeta, 'g', -1, 64),
+		"CEP_CACHE_TTL_SECONDS":         strconv.Itoa(c.CEPCacheTTLSeconds),
+		"CEP_CACHE_MAX_ENTRIES":         strconv.Itoa(c.CEPCacheMaxEntries),
+		"CACHE_SNAPSHOT_DIR":            c.CacheSnapshotDir,
+		"RESPONSE_SIGNING_KEYS":         redactSecret(c.ResponseSigningKeys),
+		"RECENT_REQUESTS_SIZE":          strconv.Itoa(c.RecentRequestsSize),
+		"CEP_ANALYTICS_HOURS":           strconv.Itoa(c.CEPAnalyticsHours),
+		"RED_METRICS":                   strconv.FormatBool(c.REDMetrics),
+		"DASHBOARD":                     strconv.FormatBool(c.Dashboard),
+		"ADMIN_TOKEN":                   redactSecret(c.AdminToken),
+		"IOT_INGEST_TOKEN":              redactSecret(c.IoTIngestToken),
+		"IOT_READING_MAX_AGE_SECONDS":   strconv.Itoa(c.IoTReadingMaxAgeSeconds),
+		"MAINTENANCE_MODE":              strconv.FormatBool(c.MaintenanceMode),
+		"MAINTENANCE_MESSAGE":           c.MaintenanceMessage,
+		"MAINTENANCE_RETRY_SECONDS":     strconv.Itoa(c.MaintenanceRetrySeconds),
+		"HEALTH_TIMEOUT_MS":             strconv.Itoa(c.HealthTimeoutMS),
+		"HEALTH_CACHE_SECONDS":          strconv.Itoa(c.HealthCacheSeconds),
+		"COMPRESSION_MIN_BYTES":         strconv.Itoa(c.CompressionMinBytes),
+		"CORRELATION_TTL_SECONDS":       strconv.Itoa(c.CorrelationTTLSeconds),
+		"CORRELATION_MAX_ENTRIES":       strconv.Itoa(c.CorrelationMaxEntries),
+		"TLS_MIN_VERSION":               c.TLSMinVersion,
+		"TLS_CIPHER_SUITES":             c.TLSCipherSuites,
+		"TLS_PINS_VIACEP":               c.TLSPinsViaCEP,
+		"TLS_PINS_WEATHERAPI":           c.TLSPinsWeatherAPI,
+		"PROXY_MODE":                    strconv.FormatBool(c.ProxyMode),
+		"PROXY_DEFAULT_TTL_SECONDS":     strconv.Itoa(c.ProxyDefaultTTLSeconds),
+		"PROXY_MIN_TTL_SECONDS":         strconv.Itoa(c.ProxyMinTTLSeconds),
+		"PROXY_MAX_TTL_SECONDS":         strconv.Itoa(c.ProxyMaxTTLSeconds),
+		"PROXY_CACHE_MAX_ENTRIES":       strconv.Itoa(c.ProxyCacheMaxEntries),
+		"EVENTS_WEBHOOK_URL":            redactSecret(c.EventsWebhookURL),
+		"GOGC":                          strconv.Itoa(c.GCPercent),
+		"GOMEMLIMIT":                    strconv.FormatInt(c.MemoryLimitBytes, 10),
+		"MEMORY_LIMIT_RATIO":            strconv.FormatFloat(c.MemoryLimitRatio, 'g', -1, 64),
+		"GOMAXPROCS":                    strconv.Itoa(c.MaxProcs),
+		"UPSTREAM_QUOTAS":               c.UpstreamQuotas,
+		"QUOTA_STATE_FILE":              c.QuotaStateFile,
+		"PROMETHEUS_METRICS":            strconv.FormatBool(c.PrometheusMetrics),
+	}
+}
+
+// NewEffectiveConfig captures the effective configuration and enabled subsystems
+func NewEffectiveConfig(service string, c Config) EffectiveConfig {
+	return EffectiveConfig{
+		Service:   service,
+		StartedAt: time.Now().UTC(),
+		GoVersion: runtime.Version(),
+		Config:    c.Effective(),
+		LegacyEnv: c.LegacyEnv,
+		Subsystems: map[string]bool{
+			"tracing":           true,
+			"metrics":           true,
+			"prometheus":        c.PrometheusMetrics,
+			"metrics_export":    c.MetricsExporter != "" && c.MetricsExporter != "none",
+			"logs_export":       c.LogsExporter != "" && c.LogsExporter != "none",
+			"weather_api":       c.usesWeatherProvider("weatherapi") && c.WeatherAPIKey != "" && !c.SandboxMode,
+			"openweathermap":    c.usesWeatherProvider("openweathermap") && c.OpenWeatherMapAPIKey != "" && !c.SandboxMode,
+			"weather_routing":   c.WeatherProviderRules != "" && !c.SandboxMode,
+			"response_profiles": c.ResponseProfilesFile != "",
+			"sandbox":           c.SandboxMode,
+			"weather_cache":     c.weatherCacheEnabled(),
+			"redis_cache":       c.weatherCacheEnabled() && c.CacheBackend == "redis",
+			"cep_cache":         c.CEPCacheTTLSeconds > 0 && !c.SandboxMode,
+			"cep_fallback":      strings.Contains(c.CEPProviders, ",") && !c.SandboxMode,
+			"cep_rules":         c.CEPRules != "",
+			"cache_snapshot":    c.CacheSnapshotDir != "" && !c.SandboxMode && (c.CEPCacheTTLSeconds > 0 || c.weatherCacheEnabled() && c.CacheBackend == "memory"),
+			"events_webhook":    c.EventsWebhookURL != "",
+			"admin":             c.AdminToken != "",
+			"iot_ingest":        c.IoTIngestToken != "" && !c.SandboxMode,
+			"maintenance":       c.MaintenanceMode,
+			"correlation":       c.CorrelationTTLSeconds > 0 && !c.SandboxMode,
+			"proxy":             c.ProxyMode && !c.SandboxMode,
+			"tls_pinning":       (c.TLSPinsViaCEP != "" || c.TLSPinsWeatherAPI != "") && !c.SandboxMode,
+			"recent_requests":   c.RecentRequestsSize > 0,
+			"cep_analytics":     c.CEPAnalyticsHours > 0,
+			"red_metrics":       c.REDMetrics,
+			"dashboard":         c.Dashboard,
+			"response_signing":  c.ResponseSigningKeys != "",
+			"weather_regions":   c.WeatherAPIEndpoints != "" && !c.SandboxMode,
+			"upstream_quotas":   c.UpstreamQuotas != "" && !c.SandboxMode,
+			"quota_state":       c.UpstreamQuotas != "" && !c.SandboxMode && c.QuotaStateFile != "",
+			"compression":       c.CompressionMinBytes > 0,
+		},
+	}
+}
+
+// weatherCacheEnabled reports whether temperatures are cached. Sandbox faults
+// are injected per request, so the sandbox is never cached.
+func (c Config) weatherCacheEnabled() bool {
+	return c.WeatherCacheTTLSeconds > 0 && c.CacheBackend != "none" && !c.SandboxMode
+}
+
+// usesWeatherProvider reports whether provider is the default weather
+// provider or a WeatherProviderRules target
+func (c Config) usesWeatherProvider(provider string) bool {
+	rules := strings.ReplaceAll(strings.ToLower(c.WeatherProviderRules), " ", "")
+	return c.WeatherProvider == provider || strings.Contains(rules, "="+provider)
+}
+
+// LogStartupBanner prints the effective configuration and, if configured,
+// writes it to EffectiveConfigFile
+func LogStartupBanner(effective EffectiveConfig, path string) error {
+	dump, err := json.Marshal(effective)
+	if err != nil {
+		return fmt.Errorf("failed to encode effective config: %w", err)
+	}
+
+	slog.Info("Effective configuration", "effective", json.RawMessage(dump))
+
+	if path == "" {
+		return nil
+	}
+	if err := os.WriteFile(path, append(dump, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write effective config: %w", err)
+	}
+	return nil
+}
+
+// EffectiveConfigHandler serves the effective configuration for drift detection
+func EffectiveConfigHandler(effective EffectiveConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(effective)
+	}
+}
+
+// VersionHandler serves the build and runtime details of the running instance
+func VersionHandler(effective EffectiveConfig) http.HandlerFunc {
+	version := struct {
+		Service   string            `json:"service"`
+		GoVersion string            `json:"go_version"`
+		StartedAt time.Time         `json:"started_at"`
+		Runtime   map[string]string `json:"runtime"`
+	}{effective.Service, effective.GoVersion, effective.StartedAt, effective.Runtime}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(version)
+	}
+}
+
+// redactSecret reports whether a secret is set without revealing it
+func redactSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
+
+// redactURL masks any password embedded in a URL
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	return parsed.Redacted()
+}
+
+// redactEndpoints redacts the URL of every region=url pair
+func redactEndpoints(raw string) string {
+	entries := strings.Split(raw, ",")
+	for i, entry := range entries {
+		if region, endpoint, ok := strings.Cut(strings.TrimSpace(entry), "="); ok {
+			entries[i] = region + "=" + redactURL(endpoint)
+		}
+	}
+	return strings.Join(entries, ",")
+}
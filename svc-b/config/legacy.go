@@ -0,0 +1,47 @@
+package config
+
+import "os"
+
+// legacyEnvRemoval is the release that stops reading the legacy names
+const legacyEnvRemoval = "v2.0.0"
+
+// LegacyEnvVar is an environment variable renamed in the config refactor. The
+// old name is still honored until RemovedIn.
+type LegacyEnvVar struct {
+	Old       string `json:"old"`
+	New       string `json:"new"`
+	RemovedIn string `json:"removed_in"`
+	// InUse reports the old name being set in this deployment
+	InUse bool `json:"in_use"`
+	// Ignored reports the old name being set next to the new one, which wins
+	Ignored bool `json:"ignored,omitempty"`
+}
+
+// legacyEnvNames maps the renamed variables to their new names
+var legacyEnvNames = []struct{ old, new string }{
+	{"EXPORTER_TYPE", "TRACES_EXPORTER"},
+	{"WEATHER_API_KEY", "WEATHERAPI_API_KEY"},
+	{"WEATHER_API_URL", "WEATHERAPI_URL"},
+	{"WEATHER_API_ENDPOINTS", "WEATHERAPI_ENDPOINTS"},
+	{"WEATHER_API_ENDPOINT_SELECTION", "WEATHERAPI_ENDPOINT_SELECTION"},
+}
+
+// migrateLegacyEnv copies each legacy variable that is set to its new name,
+// unless the new name is set too, so the rest of the configuration only reads
+// new names. It returns the whole mapping, flagging the names in use.
+func migrateLegacyEnv() []LegacyEnvVar {
+	mapping := make([]LegacyEnvVar, 0, len(legacyEnvNames))
+	for _, name := range legacyEnvNames {
+		v := LegacyEnvVar{Old: name.old, New: name.new, RemovedIn: legacyEnvRemoval}
+		if value := os.Getenv(name.old); value != "" {
+			v.InUse = true
+			if os.Getenv(name.new) == "" {
+				os.Setenv(name.new, value)
+			} else {
+				v.Ignored = true
+			}
+		}
+		mapping = append(mapping, v)
+	}
+	return mapping
+}
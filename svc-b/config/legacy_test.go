@@ -0,0 +1,42 @@
+package config
+
+import (
+	"os"
+	"pkg/settings"
+	"testing"
+)
+
+// TestLoadConfigMigratesLegacyEnv sets environment variables, so it doesn't
+// run in parallel
+func TestLoadConfigMigratesLegacyEnv(t *testing.T) {
+	t.Setenv("WEATHER_API_KEY", "legacy-key")
+	t.Setenv("WEATHERAPI_API_KEY", "")
+	t.Setenv("EXPORTER_TYPE", "stdout")
+	t.Setenv("TRACES_EXPORTER", "otlp-grpc")
+
+	cfg, err := LoadConfig(settings.FromEnv(os.Getenv))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if cfg.WeatherAPIKey != "legacy-key" {
+		t.Errorf("WeatherAPIKey = %q, want the value of the legacy name", cfg.WeatherAPIKey)
+	}
+	if cfg.ExporterType != "otlp-grpc" {
+		t.Errorf("ExporterType = %q, want the new name to win", cfg.ExporterType)
+	}
+
+	legacy := make(map[string]LegacyEnvVar)
+	for _, v := range NewEffectiveConfig("svc-b", cfg).LegacyEnv {
+		legacy[v.Old] = v
+	}
+	if v := legacy["WEATHER_API_KEY"]; v.New != "WEATHERAPI_API_KEY" || !v.InUse || v.Ignored || v.RemovedIn == "" {
+		t.Errorf("WEATHER_API_KEY mapping = %+v, want it in use towards WEATHERAPI_API_KEY", v)
+	}
+	if v := legacy["EXPORTER_TYPE"]; !v.InUse || !v.Ignored {
+		t.Errorf("EXPORTER_TYPE mapping = %+v, want it in use but ignored", v)
+	}
+	if v := legacy["WEATHER_API_URL"]; v.InUse {
+		t.Errorf("WEATHER_API_URL mapping = %+v, want it unused", v)
+	}
+}
@@ -0,0 +1,18 @@
+package config
+
+import "errors"
+
+// Validate rejects configurations svc-b can't serve with, so a deployment
+// fails at startup rather than once running, in readiness
+func (c Config) Validate() error {
+	var errs []error
+	if !c.SandboxMode {
+		if c.usesWeatherProvider("weatherapi") && c.WeatherAPIKey == "" {
+			errs = append(errs, errors.New("WEATHERAPI_API_KEY is required by the weatherapi weather provider"))
+		}
+		if c.usesWeatherProvider("openweathermap") && c.OpenWeatherMapAPIKey == "" {
+			errs = append(errs, errors.New("OPENWEATHERMAP_API_KEY is required by the openweathermap weather provider"))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,33 @@
+package config
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		cfg       Config
+		expectErr bool
+	}{
+		{"WeatherAPI with its key", Config{WeatherProvider: "weatherapi", WeatherAPIKey: "key"}, false},
+		{"WeatherAPI without its key", Config{WeatherProvider: "weatherapi"}, true},
+		{"Sandbox needs no key", Config{WeatherProvider: "weatherapi", SandboxMode: true}, false},
+		{"OpenWeatherMap without its key", Config{WeatherProvider: "openweathermap", WeatherAPIKey: "key"}, true},
+		{
+			"Routed provider without its key",
+			Config{WeatherProvider: "weatherapi", WeatherAPIKey: "key", WeatherProviderRules: "AM=openweathermap"},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.Validate(); (err != nil) != tt.expectErr {
+				t.Errorf("Validate() error = %v, expectErr %v", err, tt.expectErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// Package deadline splits a request's time budget between its stages. A stage
+// gets a share of the time its parent has left rather than a fixed timeout, so
+// it can't outlive the request nor starve the stages after it, such as
+// encoding the response.
+package deadline
+
+import (
+	"context"
+	"time"
+)
+
+// Remaining returns the time left before ctx's deadline; ok is false when ctx
+// has none
+func Remaining(ctx context.Context) (remaining time.Duration, ok bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// Child returns a context for a stage allowed fraction of the time ctx has
+// left, keeping the rest for the stages after it. A fraction of 1 or more
+// gives the stage all of it. Without a deadline on ctx there is no budget to
+// split, and the stage is only bounded by ctx's cancellation.
+func Child(ctx context.Context, fraction float64) (context.Context, context.CancelFunc) {
+	remaining, ok := Remaining(ctx)
+	if !ok || fraction >= 1 {
+		return context.WithCancel(ctx)
+	}
+	if fraction < 0 {
+		fraction = 0
+	}
+	return context.WithTimeout(ctx, time.Duration(float64(remaining)*fraction))
+}
+
+// Share is the fraction for the first of n stages splitting the time left
+// evenly, e.g. the providers of a fallback chain: each one is given its share
+// of what the previous ones left
+func Share(n int) float64 {
+	if n <= 1 {
+		return 1
+	}
+	return 1 / float64(n)
+}
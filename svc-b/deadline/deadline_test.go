@@ -0,0 +1,70 @@
+package deadline
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestChild(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		budget   time.Duration
+		fraction float64
+		expected time.Duration
+	}{
+		{"Half the budget", 10 * time.Second, 0.5, 5 * time.Second},
+		{"Reserving time for encoding", 10 * time.Second, 0.9, 9 * time.Second},
+		{"The whole budget", 10 * time.Second, 1, 10 * time.Second},
+		{"Never beyond the parent", 10 * time.Second, 2, 10 * time.Second},
+		{"A negative fraction leaves no time", 10 * time.Second, -1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			parent, cancel := context.WithTimeout(context.Background(), tt.budget)
+			defer cancel()
+			parentDeadline, _ := parent.Deadline()
+
+			child, cancel := Child(parent, tt.fraction)
+			defer cancel()
+			childDeadline, ok := child.Deadline()
+			if !ok {
+				t.Fatal("child has no deadline")
+			}
+			if childDeadline.After(parentDeadline) {
+				t.Errorf("child deadline %v is after the parent's %v", childDeadline, parentDeadline)
+			}
+			if remaining := time.Until(childDeadline); remaining > tt.expected || remaining < tt.expected-time.Second {
+				t.Errorf("child has %v left, want about %v", remaining, tt.expected)
+			}
+		})
+	}
+}
+
+func TestChildWithoutDeadline(t *testing.T) {
+	t.Parallel()
+
+	child, cancel := Child(context.Background(), 0.5)
+	if _, ok := child.Deadline(); ok {
+		t.Error("child of a context without deadline has one")
+	}
+	cancel()
+	if child.Err() == nil {
+		t.Error("cancel didn't cancel the child")
+	}
+}
+
+func TestShare(t *testing.T) {
+	t.Parallel()
+
+	for n, expected := range map[int]float64{0: 1, 1: 1, 2: 0.5, 4: 0.25} {
+		if got := Share(n); got != expected {
+			t.Errorf("Share(%d) = %v, want %v", n, got, expected)
+		}
+	}
+}
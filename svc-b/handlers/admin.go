@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"svc-b/observability"
+	"svc-b/services"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	errAdminUnauthorized    = errors.New("unauthorized")
+	errInvalidInvalidation  = errors.New("invalid invalidation request: set either keys or pattern")
+	errUnknownCache         = errors.New("unknown cache")
+	errInvalidCachePattern  = errors.New("invalid cache pattern")
+	errInvalidationTooLarge = errors.New("invalidation request too large")
+	errInvalidMaintenance   = errors.New("invalid maintenance request")
+	errNoMaintenance        = errors.New("maintenance mode not available")
+	errNoCorrelations       = errors.New("request correlation not enabled")
+	errCorrelationNotFound  = errors.New("correlation token not found or expired")
+	errMissingTraceID       = errors.New("set a token or the trace_id parameter")
+	errNoDiagnostics        = errors.New("diagnostics not available")
+	errDiagnosticsFailed    = errors.New("failed to build diagnostics bundle")
+)
+
+// maxAdminBodyBytes bounds the admin request bodies
+const maxAdminBodyBytes = 64 << 10
+
+// CacheInvalidator is a cache layer the admin endpoint can invalidate, keyed
+// the way its callers see it (e.g. by city) rather than by internal cache keys
+type CacheInvalidator interface {
+	Invalidate(ctx context.Context, key string) bool
+	InvalidateMatching(ctx context.Context, pattern string) (int, error)
+	Flush(ctx context.Context) int
+}
+
+// InvalidateCacheRequest selects what to invalidate. An empty Cache targets
+// every cache; with neither Keys nor Pattern the targeted caches are flushed.
+type InvalidateCacheRequest struct {
+	Cache   string   `json:"cache,omitempty"`
+	Keys    []string `json:"keys,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+}
+
+// InvalidateCacheResponse reports how many entries were removed per cache
+type InvalidateCacheResponse struct {
+	Removed map[string]int `json:"removed"`
+}
+
+// CorrelationsResponse lists the tagged provider requests found
+type CorrelationsResponse struct {
+	Requests []observability.CorrelationRecord `json:"requests"`
+}
+
+// AdminHandler serves the operator endpoints, authenticated by a shared token
+type AdminHandler struct {
+	token       string
+	caches      map[string]CacheInvalidator
+	maintenance *Maintenance
+	// correlations holds the provider requests tagged for support tickets
+	correlations *observability.Correlations
+	// diagnostics are the sources of post-mortem bundles
+	diagnostics *Diagnostics
+	// calibrationCEP and calibrator compare cached temperatures with live ones
+	calibrationCEP services.CEPService
+	calibrator     Calibrator
+	events         *observability.EventBus
+	tracer         trace.Tracer
+}
+
+func NewAdminHandler(token string, caches map[string]CacheInvalidator, providers observability.Providers) *AdminHandler {
+	return &AdminHandler{
+		token:  token,
+		caches: caches,
+		events: providers.Events,
+		tracer: providers.Tracer("admin-handler"),
+	}
+}
+
+// WithMaintenance lets operators switch maintenance mode
+func (h *AdminHandler) WithMaintenance(m *Maintenance) *AdminHandler {
+	h.maintenance = m
+	return h
+}
+
+// WithCorrelations lets operators look up tagged provider requests
+func (h *AdminHandler) WithCorrelations(c *observability.Correlations) *AdminHandler {
+	h.correlations = c
+	return h
+}
+
+// authorized checks the bearer token in constant time
+func (h *AdminHandler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && h.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// InvalidateCache handles POST /admin/cache/invalidate, for upstream data
+// corrections that must take effect before the entries expire
+func (h *AdminHandler) InvalidateCache(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), observability.SpanAdminInvalidateCache.Name)
+	defer span.End()
+
+	if !h.authorized(r) {
+		slog.WarnContext(ctx, "Auditoria: invalidação de cache negada", "remote_addr", r.RemoteAddr)
+		span.SetStatus(codes.Error, errAdminUnauthorized.Error())
+		writeJSONError(w, http.StatusUnauthorized, errAdminUnauthorized)
+		return
+	}
+
+	var req InvalidateCacheRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, errInvalidationTooLarge)
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, errInvalidInvalidation)
+		return
+	}
+	if len(req.Keys) > 0 && req.Pattern != "" {
+		writeJSONError(w, http.StatusBadRequest, errInvalidInvalidation)
+		return
+	}
+
+	targets := h.caches
+	if req.Cache != "" {
+		cache, ok := h.caches[req.Cache]
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, errUnknownCache)
+			return
+		}
+		targets = map[string]CacheInvalidator{req.Cache: cache}
+	}
+
+	scope := "all"
+	switch {
+	case len(req.Keys) > 0:
+		scope = "keys"
+	case req.Pattern != "":
+		scope = "pattern"
+	}
+
+	removed := make(map[string]int, len(targets))
+	names := make([]string, 0, len(targets))
+	for name, cache := range targets {
+		names = append(names, name)
+		switch scope {
+		case "keys":
+			for _, key := range req.Keys {
+				if cache.Invalidate(ctx, key) {
+					removed[name]++
+				}
+			}
+		case "pattern":
+			n, err := cache.InvalidateMatching(ctx, req.Pattern)
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				writeJSONError(w, http.StatusBadRequest, errInvalidCachePattern)
+				return
+			}
+			removed[name] = n
+		default:
+			removed[name] = cache.Flush(ctx)
+		}
+	}
+	sort.Strings(names)
+
+	total := 0
+	for _, n := range removed {
+		total += n
+	}
+	span.SetAttributes(
+		attribute.StringSlice("cache.names", names),
+		attribute.String("cache.invalidation.scope", scope),
+		attribute.Int("cache.invalidation.removed", total),
+	)
+
+	slog.InfoContext(ctx, "Auditoria: invalidação de cache", "remote_addr", r.RemoteAddr,
+		"caches", names, "scope", scope, "keys", req.Keys, "pattern", req.Pattern, "removed", total)
+	h.events.Publish(ctx, observability.Event{
+		Kind:    observability.EventCacheInvalidated,
+		Source:  "admin",
+		Message: "cache invalidated by an operator",
+		Attributes: map[string]string{
+			"caches":  strings.Join(names, ","),
+			"scope":   scope,
+			"removed": strconv.Itoa(total),
+			"remote":  r.RemoteAddr,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(InvalidateCacheResponse{Removed: removed})
+}
+
+// GetMaintenance handles GET /admin/maintenance
+func (h *AdminHandler) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		writeJSONError(w, http.StatusUnauthorized, errAdminUnauthorized)
+		return
+	}
+	if h.maintenance == nil {
+		writeJSONError(w, http.StatusNotFound, errNoMaintenance)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.maintenance.State())
+}
+
+// SetMaintenance handles PUT /admin/maintenance, turning maintenance mode on
+// or off ahead of a planned upstream outage
+func (h *AdminHandler) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), observability.SpanAdminSetMaintenance.Name)
+	defer span.End()
+
+	if !h.authorized(r) {
+		slog.WarnContext(ctx, "Auditoria: alteração de manutenção negada", "remote_addr", r.RemoteAddr)
+		span.SetStatus(codes.Error, errAdminUnauthorized.Error())
+		writeJSONError(w, http.StatusUnauthorized, errAdminUnauthorized)
+		return
+	}
+	if h.maintenance == nil {
+		writeJSONError(w, http.StatusNotFound, errNoMaintenance)
+		return
+	}
+
+	var req MaintenanceState
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(&req); err != nil || req.RetryAfterSeconds < 0 {
+		writeJSONError(w, http.StatusBadRequest, errInvalidMaintenance)
+		return
+	}
+
+	previous := h.maintenance.State()
+	state := h.maintenance.Set(req)
+	span.SetAttributes(attribute.Bool("maintenance.enabled", state.Enabled))
+
+	slog.InfoContext(ctx, "Auditoria: modo de manutenção alterado", "remote_addr", r.RemoteAddr,
+		"enabled", state.Enabled, "message", state.Message, "retry_after_seconds", state.RetryAfterSeconds)
+	if previous.Enabled != state.Enabled {
+		h.events.Publish(ctx, observability.Event{
+			Kind:    observability.EventMaintenanceChanged,
+			Source:  "admin",
+			Message: "maintenance mode changed by an operator",
+			Attributes: map[string]string{
+				"enabled": strconv.FormatBool(state.Enabled),
+				"remote":  r.RemoteAddr,
+			},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// GetCorrelations handles GET /admin/correlations/{token} and
+// GET /admin/correlations?trace_id=, returning the evidence about tagged
+// provider requests to hand to the provider's support
+func (h *AdminHandler) GetCorrelations(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		writeJSONError(w, http.StatusUnauthorized, errAdminUnauthorized)
+		return
+	}
+	if h.correlations == nil {
+		writeJSONError(w, http.StatusNotFound, errNoCorrelations)
+		return
+	}
+
+	records := []observability.CorrelationRecord{}
+	if token := mux.Vars(r)["token"]; token != "" {
+		record, ok := h.correlations.Lookup(token)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, errCorrelationNotFound)
+			return
+		}
+		records = []observability.CorrelationRecord{record}
+	} else if traceID := r.URL.Query().Get("trace_id"); traceID != "" {
+		records = h.correlations.ByTrace(traceID)
+	} else {
+		writeJSONError(w, http.StatusBadRequest, errMissingTraceID)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Auditoria: consulta de correlação", "remote_addr", r.RemoteAddr, "records", len(records))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CorrelationsResponse{Requests: records})
+}
+
+func writeJSONError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+}
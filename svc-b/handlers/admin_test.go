@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"svc-b/cache"
+	"svc-b/clock"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/services"
+	"testing"
+	"time"
+)
+
+func TestInvalidateCache(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		token         string
+		body          string
+		expectedCode  int
+		expectRemoved map[string]int
+		expectLeft    int
+	}{
+		{"Missing token", "", `{}`, http.StatusUnauthorized, nil, 3},
+		{"Wrong token", "guess", `{}`, http.StatusUnauthorized, nil, 3},
+		{"Flush every cache", "admin-token", `{}`, http.StatusOK, map[string]int{"weather": 3}, 0},
+		{"Keys are normalized like lookups", "admin-token", `{"cache":"weather","keys":[" São Paulo ","Recife"]}`, http.StatusOK, map[string]int{"weather": 1}, 2},
+		{"Pattern", "admin-token", `{"pattern":"rio*"}`, http.StatusOK, map[string]int{"weather": 2}, 1},
+		{"Unknown cache", "admin-token", `{"cache":"cep"}`, http.StatusNotFound, nil, 3},
+		{"Keys and pattern", "admin-token", `{"keys":["rio"],"pattern":"rio*"}`, http.StatusBadRequest, nil, 3},
+		{"Malformed pattern", "admin-token", `{"pattern":"[rio"}`, http.StatusBadRequest, nil, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			memory := cache.NewMemory[models.Temperature]("weather", cache.Config{TTL: time.Minute}, clock.NewFake(time.Now()), nil)
+			weather := services.NewCachedWeatherService(&MockWeatherService{}, memory)
+			for _, city := range []string{"rio de janeiro", "rio branco", "são paulo"} {
+				memory.Set(ctx, city, models.Temperature{TempC: 25})
+			}
+
+			bus := observability.NewEventBus()
+			var audited []observability.Event
+			bus.Subscribe(func(ctx context.Context, event observability.Event) {
+				audited = append(audited, event)
+			})
+			handler := NewAdminHandler("admin-token", map[string]CacheInvalidator{"weather": weather}, observability.Providers{Events: bus})
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/cache/invalidate", strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			handler.InvalidateCache(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.expectedCode, rr.Body)
+			}
+			if memory.Len() != tt.expectLeft {
+				t.Errorf("%d entries left, want %d", memory.Len(), tt.expectLeft)
+			}
+			if tt.expectRemoved == nil {
+				if len(audited) != 0 {
+					t.Errorf("rejected request published %v", audited)
+				}
+				return
+			}
+
+			var resp InvalidateCacheResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(resp.Removed, tt.expectRemoved) {
+				t.Errorf("removed = %v, want %v", resp.Removed, tt.expectRemoved)
+			}
+			if len(audited) != 1 || audited[0].Kind != observability.EventCacheInvalidated {
+				t.Errorf("published %v, want a single cache_invalidated event", audited)
+			}
+		})
+	}
+}
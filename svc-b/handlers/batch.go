@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"pkg/validation"
+	"svc-b/codec"
+	"svc-b/deadline"
+	"svc-b/observability"
+	"svc-b/quota"
+	"svc-b/resilience"
+	"svc-b/services"
+	"svc-b/usecase"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BatchRequest lists the CEPs of a POST /weather/batch
+type BatchRequest struct {
+	CEPs []string `json:"ceps"`
+	// Units, as in ?units=, limits the temperatures of every result
+	Units string `json:"units,omitempty"`
+}
+
+// BatchResult answers one CEP of a batch, as given in the request. Status is
+// the one a request for that CEP alone would have got. Result holds its body
+// on success; Error, and Code for validation failures, tell what went wrong.
+type BatchResult struct {
+	CEP    string `json:"cep"`
+	Status int    `json:"status"`
+	Result any    `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Code   string `json:"code,omitempty"`
+	// Flags are the codes of the CEP rules flagging the CEP
+	Flags []string `json:"flags,omitempty"`
+}
+
+// BatchResponse holds a result per CEP, in the request's order
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// WithBatchConcurrency resolves up to n CEPs of a batch at once
+func (h *WeatherHandler) WithBatchConcurrency(n int) *WeatherHandler {
+	h.batchConcurrency = n
+	return h
+}
+
+// GetWeatherBatch handles POST /weather/batch, resolving up to
+// Limits.MaxBatchCEPs CEPs with a bounded pool of workers. It answers 200
+// with a result per CEP, so one failing CEP doesn't fail the others.
+func (h *WeatherHandler) GetWeatherBatch(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, observability.SpanGetWeatherBatch.Name)
+	defer span.End()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	resolve, err := usecase.ParseResolve(r.URL.Query().Get("resolve"))
+	if err != nil {
+		h.respondWithError(ctx, w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	includeAddress, err := parseIncludeAddress(r.URL.Query().Get("include_address"))
+	if err != nil {
+		h.respondWithError(ctx, w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.limits.MaxBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.respondWithLimitError(ctx, w, http.StatusRequestEntityTooLarge, "request body too large", "max_body_bytes")
+			return
+		}
+		h.respondWithError(ctx, w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var req BatchRequest
+	if err := codec.Unmarshal(body, &req); err != nil {
+		h.respondWithError(ctx, w, http.StatusBadRequest, "invalid request format")
+		return
+	}
+	if len(req.CEPs) == 0 {
+		h.respondWithError(ctx, w, http.StatusBadRequest, "ceps must list at least one cep")
+		return
+	}
+	if len(req.CEPs) > h.limits.MaxBatchCEPs {
+		h.respondWithLimitError(ctx, w, http.StatusRequestEntityTooLarge, "too many ceps", "max_batch_ceps")
+		return
+	}
+	// Response options shape each result rather than the batch
+	pipeline, err := parseResponsePipeline(r.URL.Query(), req.Units)
+	if err != nil {
+		h.respondWithError(ctx, w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	workers := min(max(h.batchConcurrency, 1), len(req.CEPs))
+	span.SetAttributes(
+		attribute.Int("batch.size", len(req.CEPs)),
+		attribute.Int("batch.workers", workers),
+		attribute.String("resolve", string(resolve)),
+	)
+	slog.InfoContext(ctx, "Recebido lote de CEPs", "size", len(req.CEPs))
+
+	// The CEPs share the pipeline's budget, as they are resolved side by side
+	pipelineCtx, cancelPipeline := deadline.Child(ctx, pipelineShare)
+	results := make([]BatchResult, len(req.CEPs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = h.resolveBatchItem(pipelineCtx, i, req.CEPs[i], resolve, includeAddress, pipeline)
+			}
+		}()
+	}
+	for i := range req.CEPs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	cancelPipeline()
+
+	failed := 0
+	for _, result := range results {
+		if result.Status != http.StatusOK {
+			failed++
+		}
+	}
+	span.SetAttributes(attribute.Int("batch.failed", failed))
+
+	// The client's response profile was applied to each result, and doesn't
+	// rename the batch envelope
+	h.respondWithJSON(withoutResponseProfile(ctx), w, http.StatusOK, BatchResponse{Results: results})
+}
+
+// resolveBatchItem resolves one CEP of a batch under its own span, so the
+// fan-out shows in the trace. Its result is shaped by pipeline, then renamed
+// by the client's response profile, as a request for the CEP alone would be.
+func (h *WeatherHandler) resolveBatchItem(ctx context.Context, index int, raw string, resolve usecase.Resolve, includeAddress bool, pipeline ResponsePipeline) BatchResult {
+	ctx, span := h.tracer.Start(ctx, observability.SpanResolveBatchItem.Name, trace.WithAttributes(attribute.Int("batch.index", index)))
+	defer span.End()
+
+	if profile := responseProfileFromContext(ctx); profile != nil {
+		// The workers share pipeline, so it is copied rather than appended to
+		pipeline = append(pipeline[:len(pipeline):len(pipeline)], Rename(profile))
+	}
+
+	item := BatchResult{CEP: raw}
+	cep, flags, err := h.cepValidator.Validate(raw)
+	item.Flags = flags
+	if len(flags) > 0 {
+		span.SetAttributes(attribute.StringSlice("cep.flags", flags))
+	}
+	if err != nil {
+		problem := validation.CEPProblem(err)
+		item.Status, item.Error, item.Code = problem.Status, problem.Error, problem.Code
+	} else {
+		span.SetAttributes(attribute.String("cep", cep))
+		result, err := h.weather.GetWeatherByCEP(ctx, usecase.WeatherQuery{CEP: cep, Resolve: resolve})
+		if err != nil {
+			item.Status, item.Error = batchItemError(result.FailedStage(), err)
+			slog.WarnContext(ctx, "Erro ao resolver CEP do lote", "cep", cep, "status", item.Status, "error", err)
+		} else {
+			if uf, ok := services.UFByCEP(cep); ok {
+				h.analytics.Record(uf, result.City)
+			}
+			item.Status, item.Result = http.StatusOK, h.weatherBody(resolve, includeAddress, result)
+			if item.Result, err = pipeline.applyTo(item.Status, item.Result); err != nil {
+				item.Status, item.Result, item.Error = http.StatusInternalServerError, nil, "internal server error"
+				slog.ErrorContext(ctx, "Erro ao pós-processar resultado do lote", "cep", cep, "error", err)
+			}
+		}
+	}
+
+	span.SetAttributes(attribute.Int("http.status_code", item.Status))
+	if item.Status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, item.Error)
+	}
+	return item
+}
+
+// batchItemError maps the error of a stage to the status and message a
+// request for the CEP alone would have been answered with
+func batchItemError(stage string, err error) (int, string) {
+	var exhausted *quota.ExhaustedError
+	switch {
+	case errors.As(err, &exhausted):
+		return http.StatusServiceUnavailable, "upstream quota exhausted"
+	case errors.Is(err, resilience.ErrBreakerOpen):
+		return http.StatusServiceUnavailable, "upstream unavailable"
+	case errors.Is(err, services.ErrUpstreamResponseTooLarge):
+		return http.StatusBadGateway, "upstream response too large"
+	}
+
+	if stage == usecase.StageWeather {
+		switch {
+		case errors.Is(err, services.ErrAPIKeyNotConfigured):
+			return http.StatusInternalServerError, "weather service configuration error"
+		case errors.Is(err, services.ErrCityNotFound):
+			return http.StatusNotFound, "city not found in weather service"
+		default:
+			return http.StatusInternalServerError, "failed to get weather data"
+		}
+	}
+	switch {
+	case errors.Is(err, services.ErrInvalidZipCode):
+		return http.StatusUnprocessableEntity, "invalid zipcode"
+	case errors.Is(err, services.ErrZipCodeNotFound):
+		return http.StatusNotFound, "can not find zipcode"
+	default:
+		return http.StatusInternalServerError, "internal server error"
+	}
+}
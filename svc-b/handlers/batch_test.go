@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pkg/telemetry/telemetrytest"
+	"strings"
+	"svc-b/observability"
+	"testing"
+
+	"github.com/gorilla/mux"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestGetWeatherBatch(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	providers := observability.Providers{TracerProvider: telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))}
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), testLimits, providers).WithBatchConcurrency(2)
+
+	req := httptest.NewRequest(http.MethodPost, "/weather/batch", strings.NewReader(`{"ceps":["22450-000","99999999","2245000a","02002000"]}`))
+	rr := httptest.NewRecorder()
+	handler.GetWeatherBatch(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rr.Code)
+	}
+	var response struct {
+		Results []struct {
+			CEP    string          `json:"cep"`
+			Status int             `json:"status"`
+			Result json.RawMessage `json:"result"`
+			Error  string          `json:"error"`
+			Code   string          `json:"code"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	expected := []struct {
+		cep    string
+		status int
+		result string
+		error  string
+		code   string
+	}{
+		{"22450-000", http.StatusOK, `{"city":"Rio de Janeiro","temp_C":25,"temp_F":77,"temp_K":298.15}`, "", ""},
+		{"99999999", http.StatusNotFound, "", "can not find zipcode", ""},
+		{"2245000a", http.StatusUnprocessableEntity, "", "invalid zipcode", "cep_invalid_characters"},
+		{"02002000", http.StatusServiceUnavailable, "", "upstream unavailable", ""},
+	}
+	if len(response.Results) != len(expected) {
+		t.Fatalf("got %d results, want %d", len(response.Results), len(expected))
+	}
+	for i, want := range expected {
+		got := response.Results[i]
+		if got.CEP != want.cep || got.Status != want.status || string(got.Result) != want.result || got.Error != want.error || got.Code != want.code {
+			t.Errorf("result %d = %+v (result %s), want %+v", i, got, got.Result, want)
+		}
+	}
+
+	var batch sdktrace.ReadOnlySpan
+	items := 0
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case observability.SpanGetWeatherBatch.Name:
+			batch = span
+		case observability.SpanResolveBatchItem.Name:
+			items++
+		}
+	}
+	if batch == nil {
+		t.Fatal("no batch span recorded")
+	}
+	for _, span := range recorder.Ended() {
+		if span.Name() == observability.SpanResolveBatchItem.Name && span.Parent().SpanID() != batch.SpanContext().SpanID() {
+			t.Errorf("item span isn't a child of the batch span")
+		}
+	}
+	if items != len(expected) {
+		t.Errorf("got %d item spans, want one per CEP", items)
+	}
+}
+
+func TestGetWeatherBatchAppliesResponseProfile(t *testing.T) {
+	t.Parallel()
+
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), testLimits, observability.Providers{})
+	router := mux.NewRouter()
+	// results is renamed too, to show the envelope is left alone
+	router.Use(ResponseProfileMiddleware(ResponseProfiles{"k": {"city": "cidade", "results": "resultados"}}))
+	router.HandleFunc("/weather/batch", handler.GetWeatherBatch)
+
+	tests := []struct {
+		name         string
+		apiKey       string
+		expectedBody string
+	}{
+		{"Client with profile", "k", `{"results":[{"cep":"22450000","status":200,"result":{"cidade":"Rio de Janeiro","temp_C":25}}]}`},
+		{"Client without profile", "other-key", `{"results":[{"cep":"22450000","status":200,"result":{"city":"Rio de Janeiro","temp_C":25}}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Fields are selected by their canonical names, before the renaming
+			req := httptest.NewRequest(http.MethodPost, "/weather/batch?fields=city,temp_C", strings.NewReader(`{"ceps":["22450000"]}`))
+			req.Header.Set(APIKeyHeader, tt.apiKey)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if body := strings.TrimSpace(rr.Body.String()); rr.Code != http.StatusOK || body != tt.expectedBody {
+				t.Errorf("response = %d %s, want 200 %s", rr.Code, body, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestGetWeatherBatchRejectsInvalidBatches(t *testing.T) {
+	t.Parallel()
+
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), testLimits, observability.Providers{})
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Empty batch", `{"ceps":[]}`, http.StatusBadRequest, `{"error":"ceps must list at least one cep"}`},
+		{"Malformed body", `{"ceps":`, http.StatusBadRequest, `{"error":"invalid request format"}`},
+		{"Too many CEPs", `{"ceps":["1","2","3","4","5"]}`, http.StatusRequestEntityTooLarge, `{"error":"too many ceps","limit":"max_batch_ceps"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rr := httptest.NewRecorder()
+			handler.GetWeatherBatch(rr, httptest.NewRequest(http.MethodPost, "/weather/batch", strings.NewReader(tt.body)))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+			if body := strings.TrimSpace(rr.Body.String()); body != tt.expectedBody {
+				t.Errorf("body = %s, want %s", body, tt.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"pkg/validation"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/services"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var (
+	errNoCalibration     = errors.New("calibration not available: the weather cache is off")
+	errCalibrationFailed = errors.New("failed to fetch a live temperature")
+)
+
+// Calibrator reads a location's cached temperature alongside a live one
+type Calibrator interface {
+	Calibrate(ctx context.Context, location models.Location) (services.Calibration, error)
+}
+
+// CalibrationResponse compares the cached and live temperatures of a CEP's
+// city. Cached and DeltaC are null when the city isn't cached.
+type CalibrationResponse struct {
+	CEP    string              `json:"cep"`
+	City   string              `json:"city"`
+	Cached *models.Temperature `json:"cached"`
+	Live   models.Temperature  `json:"live"`
+	// DeltaC is the live temperature minus the cached one, in Celsius
+	DeltaC *float64 `json:"delta_C"`
+}
+
+// WithCalibration lets operators compare cached temperatures with live ones
+func (h *AdminHandler) WithCalibration(cep services.CEPService, weather Calibrator) *AdminHandler {
+	h.calibrationCEP = cep
+	h.calibrator = weather
+	return h
+}
+
+// Calibrate handles GET /admin/calibrate/{cep}, fetching a live temperature
+// for the CEP's city past the cache and answering it next to the cached one,
+// to check the weather cache TTL against how fast temperatures actually move
+func (h *AdminHandler) Calibrate(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), observability.SpanAdminCalibrate.Name)
+	defer span.End()
+
+	if !h.authorized(r) {
+		slog.WarnContext(ctx, "Auditoria: calibração negada", "remote_addr", r.RemoteAddr)
+		span.SetStatus(codes.Error, errAdminUnauthorized.Error())
+		writeJSONError(w, http.StatusUnauthorized, errAdminUnauthorized)
+		return
+	}
+	if h.calibrator == nil {
+		writeJSONError(w, http.StatusNotFound, errNoCalibration)
+		return
+	}
+
+	cep, err := validation.NormalizeCEP(mux.Vars(r)["cep"])
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	address, err := h.calibrationCEP.GetAddressByCEP(ctx, cep)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		switch {
+		case errors.Is(err, services.ErrZipCodeNotFound):
+			writeJSONError(w, http.StatusNotFound, err)
+		case errors.Is(err, services.ErrInvalidZipCode):
+			writeJSONError(w, http.StatusBadRequest, err)
+		default:
+			writeJSONError(w, http.StatusBadGateway, err)
+		}
+		return
+	}
+
+	calibration, err := h.calibrator.Calibrate(ctx, address.Location())
+	if err != nil {
+		slog.ErrorContext(ctx, "Erro ao calibrar o cache de clima", "cep", cep, "city", address.City, "error", err)
+		span.SetStatus(codes.Error, err.Error())
+		writeJSONError(w, http.StatusBadGateway, errCalibrationFailed)
+		return
+	}
+
+	resp := CalibrationResponse{
+		CEP:  cep,
+		City: address.City,
+		Live: calibration.Live.Rounded(models.DefaultPrecision),
+	}
+	span.SetAttributes(
+		attribute.String("cep", cep),
+		attribute.Bool("weather.cache_hit", calibration.Cached != nil),
+	)
+	if calibration.Cached == nil {
+		slog.InfoContext(ctx, "Calibração do cache de clima sem valor em cache", "remote_addr", r.RemoteAddr,
+			"cep", cep, "city", address.City)
+	} else {
+		cached := calibration.Cached.Rounded(models.DefaultPrecision)
+		delta := models.Round(calibration.Live.TempC-calibration.Cached.TempC, models.DefaultPrecision)
+		resp.Cached, resp.DeltaC = &cached, &delta
+		span.SetAttributes(attribute.Float64("calibration.delta_c", delta))
+		slog.InfoContext(ctx, "Calibração do cache de clima", "remote_addr", r.RemoteAddr,
+			"cep", cep, "city", address.City, "delta_C", delta)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"svc-b/cache"
+	"svc-b/clock"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/services"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCalibrate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		token         string
+		cep           string
+		cached        *models.Temperature
+		expectedCode  int
+		expectedDelta float64
+	}{
+		{"Missing token", "", "22450000", nil, http.StatusUnauthorized, 0},
+		{"Cached", "admin-token", "22450-000", &models.Temperature{TempC: 23.5, TempF: 74.3, TempK: 296.65}, http.StatusOK, 1.5},
+		{"Not cached", "admin-token", "22450000", nil, http.StatusOK, 0},
+		{"Invalid CEP", "admin-token", "2245", nil, http.StatusBadRequest, 0},
+		{"CEP not found", "admin-token", "99999999", nil, http.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			memory := cache.NewMemory[models.Temperature]("weather", cache.Config{TTL: time.Minute}, clock.NewFake(time.Now()), nil)
+			if tt.cached != nil {
+				memory.Set(context.Background(), "rio de janeiro, rj", *tt.cached)
+			}
+			weather := services.NewCachedWeatherService(&MockWeatherService{}, memory)
+			handler := NewAdminHandler("admin-token", nil, observability.Providers{}).WithCalibration(&MockCEPService{}, weather)
+
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/admin/calibrate/"+tt.cep, nil), map[string]string{"cep": tt.cep})
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			handler.Calibrate(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.expectedCode, rr.Body)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var resp CalibrationResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.CEP != "22450000" || resp.City != "Rio de Janeiro" || resp.Live.TempC != 25 {
+				t.Errorf("response = %+v, want the live temperature of Rio de Janeiro", resp)
+			}
+			if (resp.Cached == nil) != (tt.cached == nil) {
+				t.Errorf("cached = %v, want %v", resp.Cached, tt.cached)
+			}
+			if tt.cached == nil {
+				if resp.DeltaC != nil {
+					t.Errorf("delta_C = %v, want null without a cached temperature", *resp.DeltaC)
+				}
+				return
+			}
+			if resp.DeltaC == nil || *resp.DeltaC != tt.expectedDelta {
+				t.Errorf("delta_C = %v, want %v", resp.DeltaC, tt.expectedDelta)
+			}
+			if temp, _ := memory.Get(context.Background(), "rio de janeiro, rj"); temp != *tt.cached {
+				t.Errorf("cached temperature = %+v after calibrating, want it untouched", temp)
+			}
+		})
+	}
+}
+
+func TestCalibrateWithoutWeatherCache(t *testing.T) {
+	t.Parallel()
+
+	handler := NewAdminHandler("admin-token", nil, observability.Providers{})
+	req := httptest.NewRequest(http.MethodGet, "/admin/calibrate/22450000", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rr := httptest.NewRecorder()
+	handler.Calibrate(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rr.Code)
+	}
+}
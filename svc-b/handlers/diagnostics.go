@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"pkg/telemetry"
+	"runtime"
+	"runtime/pprof"
+	"svc-b/config"
+	"svc-b/observability"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Diagnostics holds the sources captured in a post-mortem bundle. Unset
+// sources are left out of the bundle.
+type Diagnostics struct {
+	Effective    config.EffectiveConfig
+	Recent       *observability.RecentRequests
+	Dependencies *observability.DependencyHealth
+	ExportErrors func() []telemetry.ExportError
+}
+
+// DiagnosticsManifest describes a bundle, as manifest.json
+type DiagnosticsManifest struct {
+	Service     string    `json:"service"`
+	GeneratedAt time.Time `json:"generated_at"`
+	StartedAt   time.Time `json:"started_at"`
+	GoVersion   string    `json:"go_version"`
+	Goroutines  int       `json:"goroutines"`
+	Files       []string  `json:"files"`
+}
+
+// bundleFile is a file of the bundle and its content
+type bundleFile struct {
+	name    string
+	content []byte
+}
+
+// WithDiagnostics lets operators download post-mortem bundles
+func (h *AdminHandler) WithDiagnostics(d *Diagnostics) *AdminHandler {
+	h.diagnostics = d
+	return h
+}
+
+// GetDiagnostics handles GET /admin/diagnostics, answering a tar.gz of the
+// instance's state at the time of an incident to attach to its report: the
+// recent requests, a goroutine dump, the effective configuration, the
+// dependencies' health and the last telemetry export errors
+func (h *AdminHandler) GetDiagnostics(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), observability.SpanAdminDiagnostics.Name)
+	defer span.End()
+
+	if !h.authorized(r) {
+		slog.WarnContext(ctx, "Auditoria: pacote de diagnóstico negado", "remote_addr", r.RemoteAddr)
+		span.SetStatus(codes.Error, errAdminUnauthorized.Error())
+		writeJSONError(w, http.StatusUnauthorized, errAdminUnauthorized)
+		return
+	}
+	if h.diagnostics == nil {
+		writeJSONError(w, http.StatusNotFound, errNoDiagnostics)
+		return
+	}
+
+	now := time.Now().UTC()
+	bundle, err := h.diagnostics.bundle(now)
+	if err != nil {
+		slog.ErrorContext(ctx, "Erro ao gerar pacote de diagnóstico", "error", err)
+		span.SetStatus(codes.Error, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, errDiagnosticsFailed)
+		return
+	}
+	span.SetAttributes(attribute.Int("diagnostics.bytes", len(bundle)))
+	slog.InfoContext(ctx, "Auditoria: pacote de diagnóstico gerado", "remote_addr", r.RemoteAddr, "bytes", len(bundle))
+
+	name := fmt.Sprintf("%s-diagnostics-%s.tar.gz", h.diagnostics.Effective.Service, now.Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Write(bundle)
+}
+
+// bundle collects the sources and archives them. It's built in memory so a
+// failure is answered with an error rather than a truncated download.
+func (d *Diagnostics) bundle(now time.Time) ([]byte, error) {
+	var goroutines bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&goroutines, 2); err != nil {
+		return nil, fmt.Errorf("failed to dump goroutines: %w", err)
+	}
+	files := []bundleFile{{name: "goroutines.txt", content: goroutines.Bytes()}}
+
+	add := func(name string, value any) error {
+		content, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		files = append(files, bundleFile{name: name, content: content})
+		return nil
+	}
+	if err := add("effective-config.json", d.Effective); err != nil {
+		return nil, err
+	}
+	if d.Recent != nil {
+		if err := add("recent-requests.json", d.Recent.Snapshot()); err != nil {
+			return nil, err
+		}
+	}
+	if d.Dependencies != nil {
+		if err := add("dependencies.json", d.Dependencies.Snapshot()); err != nil {
+			return nil, err
+		}
+	}
+	if d.ExportErrors != nil {
+		if err := add("export-errors.json", d.ExportErrors()); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest := DiagnosticsManifest{
+		Service:     d.Effective.Service,
+		GeneratedAt: now,
+		StartedAt:   d.Effective.StartedAt,
+		GoVersion:   runtime.Version(),
+		Goroutines:  runtime.NumGoroutine(),
+	}
+	for _, file := range files {
+		manifest.Files = append(manifest.Files, file.name)
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	files = append([]bundleFile{{name: "manifest.json", content: content}}, files...)
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Mode: 0o600, Size: int64(len(file.content)), ModTime: now}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to archive %s: %w", file.name, err)
+		}
+		if _, err := tw.Write(file.content); err != nil {
+			return nil, fmt.Errorf("failed to archive %s: %w", file.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress archive: %w", err)
+	}
+	return archive.Bytes(), nil
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pkg/telemetry"
+	"strings"
+	"svc-b/config"
+	"svc-b/observability"
+	"testing"
+	"time"
+)
+
+func TestGetDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	bus := observability.NewEventBus()
+	dependencies := observability.NewDependencyHealth(bus, "viacep", "weatherapi")
+	bus.Publish(context.Background(), observability.Event{Kind: observability.EventBreakerOpened, Source: "viacep", Message: "ViaCEP circuit breaker opened"})
+	recent := observability.NewRecentRequests(10)
+	recent.Add(observability.RecentRequest{Method: http.MethodGet, Route: "/weather/{cep}", Status: http.StatusBadGateway})
+
+	handler := NewAdminHandler("admin-token", nil, observability.Providers{Events: bus}).WithDiagnostics(&Diagnostics{
+		Effective:    config.EffectiveConfig{Service: "svc-b", Config: map[string]string{"ADMIN_TOKEN": "[REDACTED]"}},
+		Recent:       recent,
+		Dependencies: dependencies,
+		ExportErrors: func() []telemetry.ExportError {
+			return []telemetry.ExportError{{Time: time.Now(), Error: "zipkin: connection refused"}}
+		},
+	})
+
+	denied := httptest.NewRecorder()
+	handler.GetDiagnostics(denied, httptest.NewRequest(http.MethodGet, "/admin/diagnostics", nil))
+	if denied.Code != http.StatusUnauthorized {
+		t.Fatalf("without a token: status %d, want 401", denied.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/diagnostics", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rr := httptest.NewRecorder()
+	handler.GetDiagnostics(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("status %d, Content-Type %q; want a 200 gzip download", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if disposition := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, `attachment; filename="svc-b-diagnostics-`) {
+		t.Errorf("Content-Disposition = %q, want a named attachment", disposition)
+	}
+
+	gz, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("bundle is not gzipped: %v", err)
+	}
+	files := make(map[string]string)
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("bundle is not a tar archive: %v", err)
+		}
+		content, _ := io.ReadAll(archive)
+		files[header.Name] = string(content)
+	}
+
+	for name, want := range map[string]string{
+		"effective-config.json": `"ADMIN_TOKEN": "[REDACTED]"`,
+		"recent-requests.json":  `"/weather/{cep}"`,
+		"goroutines.txt":        "goroutine ",
+		"dependencies.json":     `"state": "breaker_open"`,
+		"export-errors.json":    "zipkin: connection refused",
+	} {
+		if !strings.Contains(files[name], want) {
+			t.Errorf("%s = %q, want it to contain %s", name, files[name], want)
+		}
+	}
+
+	var manifest DiagnosticsManifest
+	if err := json.Unmarshal([]byte(files["manifest.json"]), &manifest); err != nil {
+		t.Fatalf("invalid manifest.json: %v", err)
+	}
+	if manifest.Service != "svc-b" || len(manifest.Files) != 5 {
+		t.Errorf("manifest = %+v, want svc-b listing the 5 other files", manifest)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"pkg/validation"
+	"strconv"
+	"svc-b/deadline"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/services"
+	"svc-b/usecase"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultForecastDays is how many days are forecast without ?days=
+const defaultForecastDays = 3
+
+var ErrInvalidForecastDays = fmt.Errorf("days must be between 1 and %d", services.MaxForecastDays)
+
+// ForecastResponse is the daily forecast for a CEP's city, from today on
+type ForecastResponse struct {
+	City string                 `json:"city"`
+	Days []models.DailyForecast `json:"days"`
+}
+
+// GetForecastByCEP answers the daily forecast for the city of a CEP, for
+// ?days= days (default 3). Providers without the forecast capability get 501.
+func (h *WeatherHandler) GetForecastByCEP(w http.ResponseWriter, r *http.Request) {
+	timing := newServerTiming()
+	w = &timingResponseWriter{ResponseWriter: w, timing: timing}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, observability.SpanGetForecastByCEP.Name)
+	defer span.End()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	cep, err := h.validateCEP(ctx, w, mux.Vars(r)["cep"])
+	if err != nil {
+		h.respondWithProblem(ctx, w, validation.CEPProblem(err))
+		return
+	}
+
+	days, err := parseForecastDays(r.URL.Query().Get("days"))
+	if err != nil {
+		h.respondWithError(ctx, w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !h.requireCapability(ctx, w, services.CapabilityForecast) {
+		return
+	}
+
+	slog.InfoContext(ctx, "Recebida requisição de previsão", "cep", cep, "days", days)
+	span.SetAttributes(attribute.String("cep", cep), attribute.Int("forecast.days", days))
+
+	pipelineCtx, cancel := deadline.Child(ctx, pipelineShare)
+	result, err := h.weather.GetForecastByCEP(pipelineCtx, usecase.ForecastQuery{CEP: cep, Days: days})
+	cancel()
+	for _, stage := range result.Stages {
+		timing.add(stage.Name, stage.Duration)
+	}
+	if err != nil {
+		if result.FailedStage() == usecase.StageWeather || errors.Is(err, services.ErrForecastUnsupported) {
+			h.handleWeatherError(ctx, w, err)
+		} else {
+			h.handleCEPError(ctx, w, err)
+		}
+		return
+	}
+
+	forecast := make([]models.DailyForecast, len(result.Days))
+	for i, day := range result.Days {
+		forecast[i] = day.Rounded(h.precision)
+	}
+	h.respondWithJSON(ctx, w, http.StatusOK, ForecastResponse{City: result.City, Days: forecast})
+}
+
+// parseForecastDays parses ?days=, defaulting to defaultForecastDays
+func parseForecastDays(raw string) (int, error) {
+	if raw == "" {
+		return defaultForecastDays, nil
+	}
+	days, err := strconv.Atoi(raw)
+	if err != nil || days < 1 || days > services.MaxForecastDays {
+		return 0, ErrInvalidForecastDays
+	}
+	return days, nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"svc-b/observability"
+	"svc-b/services"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestGetForecastByCEP(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		weather        services.WeatherService
+		path           string
+		expectedStatus int
+		expectedBody   string
+		expectedDays   int
+	}{
+		{
+			name:           "Default days",
+			weather:        &MockForecastService{},
+			path:           "/forecast/22450000",
+			expectedStatus: http.StatusOK,
+			expectedDays:   defaultForecastDays,
+		},
+		{
+			name:           "One day",
+			weather:        &MockForecastService{},
+			path:           "/forecast/22450-000?days=1",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"city":"Rio de Janeiro","days":[{"date":"2024-01-01","min":{"temp_C":21.12,"temp_F":70.02,"temp_K":294.27},"max":{"temp_C":30,"temp_F":86,"temp_K":303.15},"avg":{"temp_C":25.5,"temp_F":77.9,"temp_K":298.65},"condition_code":1000}]}`,
+		},
+		{
+			name:           "Too many days",
+			weather:        &MockForecastService{},
+			path:           "/forecast/22450000?days=15",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"days must be between 1 and 14"}`,
+		},
+		{
+			name:           "CEP not found",
+			weather:        &MockForecastService{},
+			path:           "/forecast/99999999",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"can not find zipcode"}`,
+		},
+		{
+			name:           "Provider without forecast",
+			weather:        &MockWeatherService{},
+			path:           "/forecast/22450000",
+			expectedStatus: http.StatusNotImplemented,
+			expectedBody:   `{"error":"forecast is not supported by weather provider unknown"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := NewWeatherHandler(&MockCEPService{}, tt.weather, newTestInstruments(t), testLimits, observability.Providers{})
+			router := mux.NewRouter()
+			router.HandleFunc("/forecast/{cep}", handler.GetForecastByCEP)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rr.Code, tt.expectedStatus, rr.Body)
+			}
+			body := strings.TrimSpace(rr.Body.String())
+			if tt.expectedBody != "" && body != tt.expectedBody {
+				t.Errorf("body = %s, want %s", body, tt.expectedBody)
+			}
+			if tt.expectedDays > 0 && strings.Count(body, `"date"`) != tt.expectedDays {
+				t.Errorf("body = %s, want %d days", body, tt.expectedDays)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"svc-b/observability"
+	"svc-b/services"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	errIngestUnauthorized = errors.New("unauthorized")
+	errInvalidReading     = errors.New("invalid sensor reading")
+	errReadingTooLarge    = errors.New("sensor reading too large")
+)
+
+// maxReadingBodyBytes bounds the sensor reading bodies
+const maxReadingBodyBytes = 4 << 10
+
+// TemperatureIngester stores the sensor readings pushed to svc-b
+type TemperatureIngester interface {
+	Ingest(ctx context.Context, reading services.SensorReading) error
+}
+
+// IngestHandler serves the endpoint sensors push their readings to,
+// authenticated by a token shared with them
+type IngestHandler struct {
+	token    string
+	ingester TemperatureIngester
+	tracer   trace.Tracer
+}
+
+func NewIngestHandler(token string, ingester TemperatureIngester, providers observability.Providers) *IngestHandler {
+	return &IngestHandler{
+		token:    token,
+		ingester: ingester,
+		tracer:   providers.Tracer("ingest-handler"),
+	}
+}
+
+// authorized checks the bearer token in constant time
+func (h *IngestHandler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && h.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// IngestTemperature handles POST /ingest/temperature, storing a sensor's
+// reading, e.g. {"cep":"01001-000","sensor":"roof-1","temp_C":23.4}, as the
+// temperature of its CEP. Stored and superseded readings are answered 204.
+func (h *IngestHandler) IngestTemperature(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), observability.SpanIngestTemperature.Name)
+	defer span.End()
+
+	if !h.authorized(r) {
+		slog.WarnContext(ctx, "Leitura de sensor negada", "remote_addr", r.RemoteAddr)
+		span.SetStatus(codes.Error, errIngestUnauthorized.Error())
+		writeJSONError(w, http.StatusUnauthorized, errIngestUnauthorized)
+		return
+	}
+
+	var reading services.SensorReading
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReadingBodyBytes)).Decode(&reading); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, errReadingTooLarge)
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, errInvalidReading)
+		return
+	}
+
+	if err := h.ingester.Ingest(ctx, reading); err != nil {
+		slog.WarnContext(ctx, "Leitura de sensor rejeitada", "cep", reading.CEP, "sensor", reading.Sensor, "error", err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, services.ErrInvalidReading) {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"svc-b/observability"
+	"svc-b/services"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestIngestTemperature(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		token         string
+		body          string
+		expectedCode  int
+		expectedTempC float64
+	}{
+		{"Reading answers for its CEP", "sensor-token", `{"cep":"22450-000","sensor":"roof-1","temp_C":19.5}`, http.StatusNoContent, 19.5},
+		{"Missing token", "", `{"cep":"22450000","temp_C":19.5}`, http.StatusUnauthorized, 25},
+		{"Wrong token", "admin-token", `{"cep":"22450000","temp_C":19.5}`, http.StatusUnauthorized, 25},
+		{"Malformed body", "sensor-token", `{"cep":`, http.StatusBadRequest, 25},
+		{"Invalid reading", "sensor-token", `{"cep":"22450000","temp_C":150}`, http.StatusBadRequest, 25},
+		{"Body too large", "sensor-token", `{"cep":"22450000","sensor":"` + strings.Repeat("x", maxReadingBodyBytes) + `"}`, http.StatusRequestEntityTooLarge, 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			iot := services.NewIoTWeatherService(&MockWeatherService{}, time.Hour, observability.Providers{})
+			ingest := NewIngestHandler("sensor-token", iot, observability.Providers{})
+
+			req := httptest.NewRequest(http.MethodPost, "/ingest/temperature", strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			ingest.IngestTemperature(rr, req)
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.expectedCode, rr.Body)
+			}
+
+			// The weather API answers the reading in place of the provider's 25°C
+			handler := NewWeatherHandler(&MockCEPService{}, iot, newTestInstruments(t), testLimits, observability.Providers{})
+			rr = httptest.NewRecorder()
+			handler.GetWeatherByCEP(rr, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/weather/22450000", nil), map[string]string{"cep": "22450000"}))
+			var resp WeatherResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode weather response: %v", err)
+			}
+			if resp.TempC != tt.expectedTempC {
+				t.Errorf("temp_C = %v, want %v", resp.TempC, tt.expectedTempC)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	"os"
+	"pkg/telemetry/telemetrytest"
+	"testing"
+)
+
+// TestMain exports the spans tests record when run with -otel.export
+func TestMain(m *testing.M) {
+	os.Exit(telemetrytest.Main(m))
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"svc-b/observability"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MaintenanceHeader marks a 503 as planned maintenance, so svc-a can tell it
+// apart from an outage
+const MaintenanceHeader = "X-Maintenance"
+
+// maintenanceExemptPrefixes keep answering during maintenance: health checks
+// must stay accurate, operators still need the telemetry, the dashboard and
+// the admin APIs, and sensor readings don't depend on the providers
+var maintenanceExemptPrefixes = []string{"/health", "/readyz", "/metrics", "/version", "/internal/", "/admin/", "/dashboard", "/ingest/"}
+
+// MaintenanceState is the maintenance switch as set from the environment or
+// PUT /admin/maintenance
+type MaintenanceState struct {
+	Enabled bool `json:"enabled"`
+	// Message tells clients what is going on, e.g. the planned end
+	Message string `json:"message,omitempty"`
+	// RetryAfterSeconds is sent as Retry-After on every rejected request
+	RetryAfterSeconds int `json:"retry_after_seconds,omitempty"`
+	// Since is when maintenance was turned on
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// MaintenanceResponse is the body of requests rejected during maintenance
+type MaintenanceResponse struct {
+	Error             string     `json:"error"`
+	Message           string     `json:"message,omitempty"`
+	RetryAfterSeconds int        `json:"retry_after_seconds,omitempty"`
+	Since             *time.Time `json:"since,omitempty"`
+}
+
+// Maintenance answers client requests with 503 while enabled, for planned
+// upstream outages
+type Maintenance struct {
+	mu    sync.RWMutex
+	state MaintenanceState
+}
+
+func NewMaintenance(state MaintenanceState) *Maintenance {
+	m := &Maintenance{}
+	m.Set(state)
+	return m
+}
+
+// State returns the current maintenance state
+func (m *Maintenance) State() MaintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Set replaces the maintenance state, keeping Since while maintenance stays
+// on, and returns the new state
+func (m *Maintenance) Set(state MaintenanceState) MaintenanceState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state.Since = nil
+	if state.Enabled {
+		state.Since = m.state.Since
+		if state.Since == nil {
+			now := time.Now().UTC()
+			state.Since = &now
+		}
+	}
+	m.state = state
+	return state
+}
+
+// Middleware rejects client requests while maintenance is on. It must run
+// inside the observability middleware, so rejected requests are still traced
+// and counted, with the maintenance outcome.
+func (m *Maintenance) Middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state := m.State()
+			if !state.Enabled || maintenanceExempt(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			observability.SetOutcome(ctx, observability.OutcomeMaintenance)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("maintenance", true))
+			slog.DebugContext(ctx, "Requisição recusada em manutenção", "path", r.URL.Path)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set(MaintenanceHeader, "true")
+			if state.RetryAfterSeconds > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(state.RetryAfterSeconds))
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(MaintenanceResponse{
+				Error:             "service under maintenance",
+				Message:           state.Message,
+				RetryAfterSeconds: state.RetryAfterSeconds,
+				Since:             state.Since,
+			})
+		})
+	}
+}
+
+func maintenanceExempt(path string) bool {
+	for _, prefix := range maintenanceExemptPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
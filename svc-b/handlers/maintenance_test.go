@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"svc-b/observability"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMaintenanceMiddleware(t *testing.T) {
+	t.Parallel()
+
+	maintenance := NewMaintenance(MaintenanceState{Enabled: true, Message: "ViaCEP window until 03:00", RetryAfterSeconds: 600})
+
+	r := mux.NewRouter()
+	r.Use(maintenance.Middleware())
+	for _, path := range []string{"/weather/{cep}", "/health", "/readyz", "/internal/red", "/admin/maintenance", "/ingest/temperature"} {
+		r.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		expectedCode int
+	}{
+		{"Client requests are turned away", "/weather/01001000", http.StatusServiceUnavailable},
+		{"Health stays accurate", "/health", http.StatusOK},
+		{"Readiness stays accurate", "/readyz", http.StatusOK},
+		{"Telemetry keeps flowing", "/internal/red", http.StatusOK},
+		{"Operators can switch it off", "/admin/maintenance", http.StatusOK},
+		{"Sensors keep pushing readings", "/ingest/temperature", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.expectedCode)
+			}
+			if tt.expectedCode != http.StatusServiceUnavailable {
+				return
+			}
+			if got := rr.Header().Get("Retry-After"); got != "600" {
+				t.Errorf("Retry-After = %q, want 600", got)
+			}
+			if rr.Header().Get(MaintenanceHeader) != "true" {
+				t.Errorf("%s header missing", MaintenanceHeader)
+			}
+			var resp MaintenanceResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Message != "ViaCEP window until 03:00" || resp.RetryAfterSeconds != 600 || resp.Since == nil {
+				t.Errorf("response = %+v, want the maintenance message, retry delay and start", resp)
+			}
+		})
+	}
+}
+
+func TestSetMaintenance(t *testing.T) {
+	t.Parallel()
+
+	bus := observability.NewEventBus()
+	var audited []observability.Event
+	bus.Subscribe(func(ctx context.Context, event observability.Event) {
+		audited = append(audited, event)
+	})
+	maintenance := NewMaintenance(MaintenanceState{})
+	handler := NewAdminHandler("admin-token", nil, observability.Providers{Events: bus}).WithMaintenance(maintenance)
+
+	put := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/admin/maintenance", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.SetMaintenance(rr, req)
+		return rr
+	}
+
+	if rr := put("guess", `{"enabled":true}`); rr.Code != http.StatusUnauthorized || maintenance.State().Enabled {
+		t.Fatalf("unauthorized request: status %d, enabled %v", rr.Code, maintenance.State().Enabled)
+	}
+	if rr := put("admin-token", `{"enabled":true,"retry_after_seconds":-1}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("negative Retry-After: status %d, want 400", rr.Code)
+	}
+
+	if rr := put("admin-token", `{"enabled":true,"message":"planned"}`); rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rr.Code, rr.Body)
+	}
+	since := maintenance.State().Since
+	if since == nil {
+		t.Fatal("Since not set when maintenance was turned on")
+	}
+	// Updating the message keeps the start of the maintenance window
+	put("admin-token", `{"enabled":true,"message":"extended"}`)
+	if state := maintenance.State(); state.Message != "extended" || !state.Since.Equal(*since) {
+		t.Errorf("state = %+v, want the new message since %v", state, since)
+	}
+
+	put("admin-token", `{"enabled":false}`)
+	if state := maintenance.State(); state.Enabled || state.Since != nil {
+		t.Errorf("state = %+v, want maintenance off", state)
+	}
+	if len(audited) != 2 || audited[0].Kind != observability.EventMaintenanceChanged || audited[1].Attributes["enabled"] != "false" {
+		t.Errorf("published %v, want maintenance turned on then off", audited)
+	}
+}
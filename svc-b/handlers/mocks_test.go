@@ -1,33 +1,91 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
+	"svc-b/config"
 	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/quota"
+	"svc-b/resilience"
+	"svc-b/services"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/metric/noop"
 )
 
+// testLimits pins the server limits so tests don't depend on the environment
+var testLimits = config.Limits{MaxBodyBytes: 4096, MaxBatchCEPs: 4}
+
+// The mocks are stateless so they can be shared by parallel tests
 type MockCEPService struct{}
 type MockWeatherService struct{}
 
-func (m *MockCEPService) GetCityByCEP(cep string) (string, error) {
+func (m *MockCEPService) GetAddressByCEP(ctx context.Context, cep string) (*models.Address, error) {
 	switch cep {
 	case "22450000":
-		return "Rio de Janeiro", nil
+		return &models.Address{Street: "Rua Marquês de São Vicente", Neighborhood: "Gávea", City: "Rio de Janeiro", State: "RJ"}, nil
 	case "123":
-		return "", fmt.Errorf("invalid zipcode")
+		return nil, services.ErrInvalidZipCode
 	case "99999999":
-		return "", fmt.Errorf("can not find zipcode")
+		return nil, services.ErrZipCodeNotFound
+	case "01001000":
+		return nil, fmt.Errorf("failed to send request: %w", &quota.ExhaustedError{Provider: "viacep", RetryAfter: 1500 * time.Millisecond})
+	case "02002000":
+		return nil, fmt.Errorf("failed to send request: %w", resilience.ErrBreakerOpen)
 	default:
-		return "", fmt.Errorf("unexpected error")
+		return nil, services.ErrInternalServer
 	}
 }
 
-func (m *MockWeatherService) GetTemperature(city string) (*models.Temperature, error) {
-	if city == "Rio de Janeiro" {
+func (m *MockWeatherService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	if location.City == "Rio de Janeiro" {
 		return &models.Temperature{
 			TempC: 25.0,
 			TempF: 77.0,
 			TempK: 298.15,
 		}, nil
 	}
-	return nil, fmt.Errorf("city not found")
+	return nil, services.ErrCityNotFound
+}
+
+// MockForecastService is a weather provider with the forecast capability
+type MockForecastService struct {
+	MockWeatherService
+}
+
+func (m *MockForecastService) Name() string {
+	return "mock"
+}
+
+func (m *MockForecastService) Capabilities() services.Capabilities {
+	return services.Capabilities{Forecast: true}
+}
+
+func (m *MockForecastService) GetForecast(ctx context.Context, location models.Location, days int) ([]models.DailyForecast, error) {
+	if location.City != "Rio de Janeiro" {
+		return nil, services.ErrCityNotFound
+	}
+	forecast := make([]models.DailyForecast, days)
+	for i := range forecast {
+		forecast[i] = models.DailyForecast{
+			Date:          fmt.Sprintf("2024-01-%02d", i+1),
+			Min:           models.FromCelsius(21.123),
+			Max:           models.FromCelsius(30),
+			Avg:           models.FromCelsius(25.5),
+			ConditionCode: 1000,
+		}
+	}
+	return forecast, nil
+}
+
+// newTestInstruments creates instruments backed by a no-op meter
+func newTestInstruments(t *testing.T) *observability.Instruments {
+	t.Helper()
+	instruments, err := observability.NewInstruments(noop.NewMeterProvider().Meter("test"))
+	if err != nil {
+		t.Fatalf("failed to create instruments: %v", err)
+	}
+	return instruments
 }
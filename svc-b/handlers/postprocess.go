@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"svc-b/codec"
+	"svc-b/models"
+)
+
+// MaxPrecision bounds the decimal places a client or deployment may ask for
+const MaxPrecision = 6
+
+var (
+	errInvalidResponseOptions = errors.New("invalid response options")
+	errRenameTaken            = errors.New("field renamed onto a name already in the response")
+)
+
+// ResponseProcessor transforms the top-level fields of a JSON response object.
+// It receives the status code so client-facing shaping can leave errors alone.
+type ResponseProcessor func(code int, fields ResponseFields) (ResponseFields, error)
+
+// ResponsePipeline runs its processors in order over an encoded response
+type ResponsePipeline []ResponseProcessor
+
+// ResponseFields are the top-level fields of a JSON response object, kept in
+// the order they were encoded in so shaping never reorders a response
+type ResponseFields struct {
+	names  []string
+	values map[string]json.RawMessage
+}
+
+// Names lists the fields in order
+func (f ResponseFields) Names() []string {
+	return f.names
+}
+
+// Get returns the encoded value of a field
+func (f ResponseFields) Get(name string) (json.RawMessage, bool) {
+	value, ok := f.values[name]
+	return value, ok
+}
+
+// Set replaces a field's value in place, or adds the field last
+func (f *ResponseFields) Set(name string, value json.RawMessage) {
+	if f.values == nil {
+		f.values = make(map[string]json.RawMessage)
+	}
+	if _, ok := f.values[name]; !ok {
+		f.names = append(f.names, name)
+	}
+	f.values[name] = value
+}
+
+// Delete removes a field
+func (f *ResponseFields) Delete(name string) {
+	if _, ok := f.values[name]; !ok {
+		return
+	}
+	delete(f.values, name)
+	f.names = slices.DeleteFunc(f.names, func(n string) bool { return n == name })
+}
+
+// UnmarshalJSON reads a JSON object, remembering the order of its fields. A
+// repeated field keeps its first position and its last value, as
+// encoding/json would.
+func (f *ResponseFields) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return errors.New("response is not a JSON object")
+	}
+
+	fields := ResponseFields{values: make(map[string]json.RawMessage)}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		fields.Set(token.(string), value)
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	*f = fields
+	return nil
+}
+
+// MarshalJSON writes the fields as a JSON object, in order
+func (f ResponseFields) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range f.names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encoded, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encoded)
+		buf.WriteByte(':')
+		buf.Write(f.values[name])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type responsePipelineKey struct{}
+
+// withResponsePipeline attaches the request's post-processing steps to ctx
+func withResponsePipeline(ctx context.Context, pipeline ResponsePipeline) context.Context {
+	if len(pipeline) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, responsePipelineKey{}, pipeline)
+}
+
+func responsePipelineFromContext(ctx context.Context) ResponsePipeline {
+	pipeline, _ := ctx.Value(responsePipelineKey{}).(ResponsePipeline)
+	return pipeline
+}
+
+// Apply runs the pipeline over an encoded JSON object. Anything that is not an
+// object, and an empty pipeline, leaves the response untouched.
+func (p ResponsePipeline) Apply(code int, encoded []byte) ([]byte, error) {
+	if len(p) == 0 {
+		return encoded, nil
+	}
+
+	var fields ResponseFields
+	if err := codec.Unmarshal(encoded, &fields); err != nil || fields.values == nil {
+		return encoded, nil
+	}
+
+	for _, process := range p {
+		var err error
+		if fields, err = process(code, fields); err != nil {
+			return nil, err
+		}
+	}
+	return codec.Marshal(fields)
+}
+
+// applyTo runs the pipeline over a response body yet to be encoded, as the
+// results of a batch are
+func (p ResponsePipeline) applyTo(code int, body any) (any, error) {
+	if len(p) == 0 {
+		return body, nil
+	}
+	encoded, err := codec.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	shaped, err := p.Apply(code, encoded)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(shaped), nil
+}
+
+// successOnly skips the wrapped processor for error responses
+func successOnly(process ResponseProcessor) ResponseProcessor {
+	return func(code int, fields ResponseFields) (ResponseFields, error) {
+		if code >= http.StatusBadRequest {
+			return fields, nil
+		}
+		return process(code, fields)
+	}
+}
+
+// Precision rounds every numeric field to the given number of decimal places
+func Precision(places int) ResponseProcessor {
+	return successOnly(func(code int, fields ResponseFields) (ResponseFields, error) {
+		for _, name := range fields.Names() {
+			value, _ := fields.Get(name)
+			number, ok := numberField(value)
+			if !ok {
+				continue
+			}
+			fields.Set(name, json.RawMessage(strconv.FormatFloat(models.Round(number, places), 'f', -1, 64)))
+		}
+		return fields, nil
+	})
+}
+
+// Units keeps only the temperature fields for the given units
+func Units(units ...models.Unit) ResponseProcessor {
+	keep := make(map[models.Unit]bool, len(units))
+	for _, unit := range units {
+		keep[unit] = true
+	}
+
+	return successOnly(func(code int, fields ResponseFields) (ResponseFields, error) {
+		for _, unit := range models.AllUnits {
+			if !keep[unit] {
+				fields.Delete(unit.Field())
+			}
+		}
+		return fields, nil
+	})
+}
+
+// SelectFields keeps only the named top-level fields, in the response's order
+func SelectFields(names ...string) ResponseProcessor {
+	return successOnly(func(code int, fields ResponseFields) (ResponseFields, error) {
+		var selected ResponseFields
+		for _, name := range fields.Names() {
+			if slices.Contains(names, name) {
+				value, _ := fields.Get(name)
+				selected.Set(name, value)
+			}
+		}
+		if selected.values == nil {
+			selected.values = make(map[string]json.RawMessage)
+		}
+		return selected, nil
+	})
+}
+
+// DecimalComma renders numeric fields as strings with a decimal comma, as
+// expected by pt-BR clients
+func DecimalComma() ResponseProcessor {
+	return successOnly(func(code int, fields ResponseFields) (ResponseFields, error) {
+		for _, name := range fields.Names() {
+			value, _ := fields.Get(name)
+			if _, ok := numberField(value); !ok {
+				continue
+			}
+			formatted, err := json.Marshal(strings.Replace(string(value), ".", ",", 1))
+			if err != nil {
+				return ResponseFields{}, err
+			}
+			fields.Set(name, formatted)
+		}
+		return fields, nil
+	})
+}
+
+// Rename renames top-level fields, each in its place, and applies to every
+// response, errors included. Renaming onto a name the response already uses,
+// or two fields onto one name, fails with errRenameTaken rather than drop a
+// field.
+func Rename(names map[string]string) ResponseProcessor {
+	return func(code int, fields ResponseFields) (ResponseFields, error) {
+		var renamed ResponseFields
+		for _, name := range fields.Names() {
+			value, _ := fields.Get(name)
+			to, ok := names[name]
+			if !ok {
+				to = name
+			}
+			if _, taken := renamed.Get(to); taken {
+				return ResponseFields{}, fmt.Errorf("%w: %s", errRenameTaken, to)
+			}
+			renamed.Set(to, value)
+		}
+		return renamed, nil
+	}
+}
+
+// numberField reports whether a raw JSON value is a number, returning it
+func numberField(value json.RawMessage) (float64, bool) {
+	var number float64
+	if len(value) == 0 || (value[0] != '-' && (value[0] < '0' || value[0] > '9')) {
+		return 0, false
+	}
+	if err := json.Unmarshal(value, &number); err != nil {
+		return 0, false
+	}
+	return number, true
+}
+
+// parseResponsePipeline builds the post-processing steps requested through
+// the precision, units, fields and locale query parameters. units, which
+// request bodies may also carry, is taken from the body when the query has none.
+func parseResponsePipeline(query url.Values, bodyUnits string) (ResponsePipeline, error) {
+	var pipeline ResponsePipeline
+
+	if raw := query.Get("units"); raw != "" || bodyUnits != "" {
+		if raw == "" {
+			raw = bodyUnits
+		}
+		units, err := models.ParseUnits(raw)
+		if err != nil {
+			return nil, errInvalidResponseOptions
+		}
+		pipeline = append(pipeline, Units(units...))
+	}
+
+	if raw := query.Get("fields"); raw != "" {
+		pipeline = append(pipeline, SelectFields(splitList(raw)...))
+	}
+
+	if raw := query.Get("precision"); raw != "" {
+		places, err := strconv.Atoi(raw)
+		if err != nil || places < 0 || places > MaxPrecision {
+			return nil, errInvalidResponseOptions
+		}
+		pipeline = append(pipeline, Precision(places))
+	}
+
+	// Locale formatting runs last since it turns numbers into strings
+	switch locale := query.Get("locale"); locale {
+	case "", "en-US":
+	case "pt-BR":
+		pipeline = append(pipeline, DecimalComma())
+	default:
+		return nil, errInvalidResponseOptions
+	}
+
+	return pipeline, nil
+}
+
+func splitList(raw string) []string {
+	var list []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"svc-b/observability"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestResponsePipelineSteps(t *testing.T) {
+	t.Parallel()
+
+	const weather = `{"city":"Rio de Janeiro","temp_C":25.456,"temp_F":77.82,"temp_K":298.606}`
+
+	tests := []struct {
+		name     string
+		pipeline ResponsePipeline
+		code     int
+		input    string
+		expected string
+	}{
+		{
+			name:     "Empty pipeline leaves the response untouched",
+			code:     http.StatusOK,
+			input:    weather,
+			expected: weather,
+		},
+		{
+			name:     "Precision",
+			pipeline: ResponsePipeline{Precision(1)},
+			code:     http.StatusOK,
+			input:    weather,
+			expected: `{"city":"Rio de Janeiro","temp_C":25.5,"temp_F":77.8,"temp_K":298.6}`,
+		},
+		{
+			name:     "Units",
+			pipeline: ResponsePipeline{Units("C", "K")},
+			code:     http.StatusOK,
+			input:    weather,
+			expected: `{"city":"Rio de Janeiro","temp_C":25.456,"temp_K":298.606}`,
+		},
+		{
+			name:     "Field selection",
+			pipeline: ResponsePipeline{SelectFields("temp_C", "missing")},
+			code:     http.StatusOK,
+			input:    weather,
+			expected: `{"temp_C":25.456}`,
+		},
+		{
+			name:     "Decimal comma",
+			pipeline: ResponsePipeline{Units("C"), Precision(1), DecimalComma()},
+			code:     http.StatusOK,
+			input:    weather,
+			expected: `{"city":"Rio de Janeiro","temp_C":"25,5"}`,
+		},
+		{
+			name:     "Rename runs after shaping",
+			pipeline: ResponsePipeline{Units("C"), Rename(map[string]string{"temp_C": "temperatura_c"})},
+			code:     http.StatusOK,
+			input:    weather,
+			expected: `{"city":"Rio de Janeiro","temperatura_c":25.456}`,
+		},
+		{
+			name:     "Errors are only renamed",
+			pipeline: ResponsePipeline{SelectFields("temp_C"), Precision(0), Rename(map[string]string{"error": "erro"})},
+			code:     http.StatusNotFound,
+			input:    `{"error":"can not find zipcode"}`,
+			expected: `{"erro":"can not find zipcode"}`,
+		},
+		{
+			name:     "Field order is kept",
+			pipeline: ResponsePipeline{SelectFields("city", "temp_C"), Rename(map[string]string{"city": "zcidade"})},
+			code:     http.StatusOK,
+			input:    `{"temp_K":298.606,"city":"Rio de Janeiro","temp_C":25.456}`,
+			expected: `{"zcidade":"Rio de Janeiro","temp_C":25.456}`,
+		},
+		{
+			name:     "Fields can swap names",
+			pipeline: ResponsePipeline{Rename(map[string]string{"temp_C": "temp_F", "temp_F": "temp_C"})},
+			code:     http.StatusOK,
+			input:    `{"temp_C":25,"temp_F":77}`,
+			expected: `{"temp_F":25,"temp_C":77}`,
+		},
+		{
+			name:     "Non-object responses are untouched",
+			pipeline: ResponsePipeline{SelectFields("city")},
+			code:     http.StatusOK,
+			input:    `[1.234]`,
+			expected: `[1.234]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tt.pipeline.Apply(tt.code, []byte(tt.input))
+			if err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("Apply() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenameRejectsTakenNames(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		names map[string]string
+		input string
+	}{
+		{"Onto a later field", map[string]string{"city": "temp_C"}, `{"city":"Rio de Janeiro","temp_C":25}`},
+		{"Onto an earlier field", map[string]string{"temp_C": "city"}, `{"city":"Rio de Janeiro","temp_C":25}`},
+		{"Two fields onto one name", map[string]string{"temp_C": "temp", "temp_F": "temp"}, `{"temp_C":25,"temp_F":77}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ResponsePipeline{Rename(tt.names)}.Apply(http.StatusOK, []byte(tt.input))
+			if !errors.Is(err, errRenameTaken) {
+				t.Errorf("Apply() = %s, %v; want errRenameTaken", got, err)
+			}
+		})
+	}
+}
+
+func TestGetWeatherByCEPResponseOptions(t *testing.T) {
+	t.Parallel()
+
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), testLimits, observability.Providers{})
+	router := mux.NewRouter()
+	router.HandleFunc("/weather/{cep}", handler.GetWeatherByCEP)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Units and precision",
+			query:          "?units=K&precision=0",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"city":"Rio de Janeiro","temp_K":298}`,
+		},
+		{
+			name:           "Units by name",
+			query:          "?units=celsius,Kelvin",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"city":"Rio de Janeiro","temp_C":25,"temp_K":298.15}`,
+		},
+		{
+			name:           "All units",
+			query:          "?units=all",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"city":"Rio de Janeiro","temp_C":25,"temp_F":77,"temp_K":298.15}`,
+		},
+		{
+			name:           "pt-BR locale",
+			query:          "?fields=temp_K&locale=pt-BR",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"temp_K":"298,15"}`,
+		},
+		{
+			name:           "Unknown unit",
+			query:          "?units=R",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid response options"}`,
+		},
+		{
+			name:           "Precision out of range",
+			query:          "?precision=12",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid response options"}`,
+		},
+		{
+			name:           "Unknown locale",
+			query:          "?locale=fr-FR",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid response options"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/weather/22450000"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if gotBody := strings.TrimSpace(rr.Body.String()); gotBody != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v", gotBody, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestWeatherUnitsInBody(t *testing.T) {
+	t.Parallel()
+
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), testLimits, observability.Providers{}).
+		WithTemperaturePrecision(0)
+	router := mux.NewRouter()
+	router.HandleFunc("/weather", handler.GetWeatherByCEPPost).Methods("POST")
+	router.HandleFunc("/weather/batch", handler.GetWeatherBatch).Methods("POST")
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Units", "/weather", `{"cep":"22450000","units":"fahrenheit,kelvin"}`, http.StatusOK, `{"city":"Rio de Janeiro","temp_F":77,"temp_K":298}`},
+		{"Query wins", "/weather?units=C", `{"cep":"22450000","units":"kelvin"}`, http.StatusOK, `{"city":"Rio de Janeiro","temp_C":25}`},
+		{"Unknown unit", "/weather", `{"cep":"22450000","units":"rankine"}`, http.StatusBadRequest, `{"error":"invalid response options"}`},
+		{"Batch", "/weather/batch", `{"ceps":["22450000"],"units":"kelvin"}`, http.StatusOK, `{"results":[{"cep":"22450000","status":200,"result":{"city":"Rio de Janeiro","temp_K":298}}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if gotBody := strings.TrimSpace(rr.Body.String()); gotBody != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v", gotBody, tt.expectedBody)
+			}
+		})
+	}
+}
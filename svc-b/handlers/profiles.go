@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/gorilla/mux"
+)
+
+// APIKeyHeader carries the client's API key, used to select its response profile
+const APIKeyHeader = "X-API-Key"
+
+// responseFields are the top-level fields of the responses profiles rename
+var responseFields = []string{
+	"city", "temp_C", "temp_F", "temp_K", "address", "resolved_location", "meta",
+	"days", "changed", "previous_temp_C", "error", "limit", "trace_url",
+}
+
+// ResponseProfile renames top-level response fields, e.g. {"temp_C": "temperatura_c"}
+type ResponseProfile map[string]string
+
+// validate rejects a profile that renames two fields onto the same name, or
+// a field onto one the responses already use and the profile keeps, either of
+// which would fail every response it applies to
+func (p ResponseProfile) validate() error {
+	targets := make(map[string]string, len(p))
+	for from, to := range p {
+		if other, ok := targets[to]; ok {
+			return fmt.Errorf("%s and %s are both renamed to %s", min(from, other), max(from, other), to)
+		}
+		targets[to] = from
+		if _, renamed := p[to]; to != from && !renamed && slices.Contains(responseFields, to) {
+			return fmt.Errorf("%s is renamed to %s, which responses already use", from, to)
+		}
+	}
+	return nil
+}
+
+// ResponseProfiles maps API keys to their response profile
+type ResponseProfiles map[string]ResponseProfile
+
+type responseProfileKey struct{}
+
+// LoadResponseProfiles reads the per-API-key profiles from a JSON file; an
+// empty path means no client has a custom profile
+func LoadResponseProfiles(path string) (ResponseProfiles, error) {
+	if path == "" {
+		return ResponseProfiles{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response profiles: %w", err)
+	}
+
+	var profiles ResponseProfiles
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse response profiles: %w", err)
+	}
+	for key, profile := range profiles {
+		if err := profile.validate(); err != nil {
+			return nil, fmt.Errorf("invalid response profile for key %s: %w", keyFingerprint(key), err)
+		}
+	}
+	return profiles, nil
+}
+
+// keyFingerprint names an API key in errors and logs without revealing it
+func keyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:4])
+}
+
+// ResponseProfileMiddleware attaches the calling client's response profile to
+// the request context so the rendering layer can apply it
+func ResponseProfileMiddleware(profiles ResponseProfiles) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if profile, ok := profiles[r.Header.Get(APIKeyHeader)]; ok {
+				r = r.WithContext(context.WithValue(r.Context(), responseProfileKey{}, profile))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// withoutResponseProfile leaves the rest of a response unrenamed, for bodies
+// whose parts were renamed already
+func withoutResponseProfile(ctx context.Context) context.Context {
+	return context.WithValue(ctx, responseProfileKey{}, ResponseProfile(nil))
+}
+
+func responseProfileFromContext(ctx context.Context) ResponseProfile {
+	profile, _ := ctx.Value(responseProfileKey{}).(ResponseProfile)
+	return profile
+}
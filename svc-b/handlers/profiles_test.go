@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadResponseProfiles(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		content   string
+		expectErr bool
+	}{
+		{"Distinct names", `{"key-1":{"temp_C":"temperatura_c","city":"cidade"}}`, false},
+		{"Swapped names", `{"key-1":{"temp_C":"temp_F","temp_F":"temp_C"}}`, false},
+		{"Two fields onto one name", `{"key-1":{"temp_C":"temp","temp_F":"temp"}}`, true},
+		{"Onto a response field", `{"key-1":{"city":"temp_C"}}`, true},
+		{"Onto the error field", `{"key-1":{"limit":"error"}}`, true},
+		{"Onto a field renamed away", `{"key-1":{"city":"temp_C","temp_C":"temperatura_c"}}`, false},
+		{"Onto itself", `{"key-1":{"city":"city"}}`, false},
+		{"Malformed", `{"key-1":`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "profiles.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("failed to write profiles: %v", err)
+			}
+			if _, err := LoadResponseProfiles(path); (err != nil) != tt.expectErr {
+				t.Errorf("LoadResponseProfiles() error = %v, expectErr %v", err, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestLoadResponseProfilesKeepsKeysOutOfErrors(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	if err := os.WriteFile(path, []byte(`{"secret-customer-key":{"city":"temp_C"}}`), 0o600); err != nil {
+		t.Fatalf("failed to write profiles: %v", err)
+	}
+	_, err := LoadResponseProfiles(path)
+	if err == nil || strings.Contains(err.Error(), "secret-customer-key") || !strings.Contains(err.Error(), keyFingerprint("secret-customer-key")) {
+		t.Errorf("LoadResponseProfiles() error = %v, want the key named by its fingerprint", err)
+	}
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"pkg/telemetry"
+	"strconv"
+	"strings"
+	"svc-b/cache"
+	"svc-b/clock"
+	"svc-b/observability"
+	"svc-b/services"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ProxyCacheHeader tells proxy clients whether the response came from the
+// cache (HIT) or the provider (MISS)
+const ProxyCacheHeader = "X-Cache"
+
+// maxProxyBodyBytes bounds the provider responses the proxy relays
+const maxProxyBodyBytes = 1 << 20
+
+// proxiedHeaders are the provider response headers relayed to proxy clients
+var proxiedHeaders = []string{"Content-Type", "Cache-Control", "Expires", "Last-Modified", "ETag"}
+
+var (
+	errUnknownProxyTarget = errors.New("unknown proxy target")
+	errProxyHost          = errors.New("host is not proxied; only the weather providers are")
+	errProxyTunnel        = errors.New("HTTPS tunnels are not supported; request http:// URLs from the proxy")
+	errProxyKeyRequired   = errors.New("the provider's API key is required; svc-b's own key is not lent to proxy clients")
+)
+
+// ProxyTarget is a weather provider reachable through the caching proxy
+type ProxyTarget struct {
+	URL string
+	// KeyParam is the query parameter carrying the client's API key
+	KeyParam string
+	// KeyHeader, when set, is the header the key is moved into, so it stays
+	// out of the provider URL. Clients may also send their key in it.
+	KeyHeader string
+}
+
+// WeatherProxy relays GET requests to the weather providers, caching their
+// responses as their Cache-Control headers allow, bounded by a
+// FreshnessPolicy. Clients must bring their own API key, which is left out
+// of the cache key, so clients share the cache whichever key they use.
+type WeatherProxy struct {
+	client  services.HTTPClient
+	targets map[string]ProxyTarget
+	cache   cache.Store[cache.HTTPResponse]
+	policy  cache.FreshnessPolicy
+	clock   clock.Clock
+}
+
+func NewWeatherProxy(client services.HTTPClient, targets map[string]ProxyTarget, store cache.Store[cache.HTTPResponse], policy cache.FreshnessPolicy, clk clock.Clock) *WeatherProxy {
+	return &WeatherProxy{client: client, targets: targets, cache: store, policy: policy, clock: clk}
+}
+
+// ServeHTTP serves /proxy/{provider}/{path}, e.g.
+// /proxy/weatherapi/v1/current.json?q=Recife
+func (p *WeatherProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	vars := mux.Vars(r)
+	provider := vars["provider"]
+	target, ok := p.targets[provider]
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("%w: %s", errUnknownProxyTarget, provider))
+		return
+	}
+
+	query := r.URL.Query()
+	key := query.Get(target.KeyParam)
+	query.Del(target.KeyParam)
+	if key == "" && target.KeyHeader != "" {
+		key = r.Header.Get(target.KeyHeader)
+	}
+	// Without a key of their own, clients would spend svc-b's quota, which
+	// the API key transport fills in on the way out
+	if key == "" {
+		writeJSONError(w, http.StatusUnauthorized, errProxyKeyRequired)
+		return
+	}
+	cacheKey := provider + "/" + vars["path"]
+	if len(query) > 0 {
+		cacheKey += "?" + query.Encode()
+	}
+	span.SetAttributes(attribute.String("proxy.provider", provider))
+
+	// A client's no-cache skips the lookup; the fresh response is still stored
+	now := p.clock.Now()
+	if !strings.Contains(strings.ToLower(r.Header.Get("Cache-Control")), "no-cache") {
+		if cached, ok := p.cache.Get(ctx, cacheKey); ok && now.Before(cached.ExpiresAt) {
+			span.SetAttributes(attribute.String("proxy.cache", "hit"))
+			w.Header().Set("Age", strconv.Itoa(int(now.Sub(cached.StoredAt).Seconds())))
+			p.write(ctx, w, "HIT", cached)
+			return
+		}
+	}
+	span.SetAttributes(attribute.String("proxy.cache", "miss"))
+
+	header := make(http.Header)
+	switch {
+	case target.KeyHeader != "":
+		header.Set(target.KeyHeader, key)
+	default:
+		query.Set(target.KeyParam, key)
+	}
+	response, err := p.fetch(ctx, target.URL+"/"+vars["path"]+"?"+query.Encode(), header)
+	if err != nil {
+		slog.WarnContext(ctx, "Erro ao consultar provedor pelo proxy", "provider", provider, "error", err)
+		observability.SetOutcome(ctx, observability.OutcomeUpstreamError)
+		writeJSONError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	// Errors other than a not-found depend on the key, so they aren't shared
+	if response.StatusCode == http.StatusOK || response.StatusCode == http.StatusNotFound {
+		if ttl := p.policy.Freshness(response.Header, now); ttl > 0 {
+			response.StoredAt, response.ExpiresAt = now, now.Add(ttl)
+			p.cache.Set(ctx, cacheKey, response)
+			span.SetAttributes(attribute.Int("proxy.ttl_seconds", int(ttl.Seconds())))
+		}
+	}
+	p.write(ctx, w, "MISS", response)
+}
+
+func (p *WeatherProxy) fetch(ctx context.Context, rawURL string, reqHeader http.Header) (cache.HTTPResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return cache.HTTPResponse{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = reqHeader
+	resp, err := p.client.Do(req)
+	if err != nil {
+		// The URL may carry a client's key, quoted by the error
+		return cache.HTTPResponse{}, telemetry.SanitizeError(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProxyBodyBytes+1))
+	if err != nil {
+		return cache.HTTPResponse{}, err
+	}
+	if len(body) > maxProxyBodyBytes {
+		return cache.HTTPResponse{}, services.ErrUpstreamResponseTooLarge
+	}
+
+	header := make(http.Header)
+	for _, name := range proxiedHeaders {
+		if values := resp.Header.Values(name); len(values) > 0 {
+			header[name] = values
+		}
+	}
+	return cache.HTTPResponse{StatusCode: resp.StatusCode, Header: header, Body: body}, nil
+}
+
+func (p *WeatherProxy) write(ctx context.Context, w http.ResponseWriter, status string, response cache.HTTPResponse) {
+	for name, values := range response.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(ProxyCacheHeader, status)
+	if err := writeResponse(w, response.StatusCode, response.Body); err != nil {
+		slog.WarnContext(ctx, "Erro ao escrever resposta do proxy", "error", err)
+	}
+}
+
+// Invalidate drops the cached response for a cache key, e.g.
+// weatherapi/v1/current.json?q=Recife
+func (p *WeatherProxy) Invalidate(ctx context.Context, key string) bool {
+	return p.cache.Delete(ctx, key)
+}
+
+// InvalidateMatching drops the cached responses whose key matches the glob
+// pattern (path.Match syntax)
+func (p *WeatherProxy) InvalidateMatching(ctx context.Context, pattern string) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, err
+	}
+	return p.cache.DeleteMatching(ctx, func(key string) bool {
+		matched, _ := path.Match(pattern, key)
+		return matched
+	}), nil
+}
+
+// Flush drops every cached response
+func (p *WeatherProxy) Flush(ctx context.Context) int {
+	return p.cache.Flush(ctx)
+}
+
+// ForwardProxy lets clients configured with svc-b as their HTTP proxy reach
+// the weather providers through the caching proxy: absolute-form requests for
+// a host in hosts, mapped to its proxy target, are routed to
+// /proxy/{provider}. Requests for other hosts are refused so svc-b is no open
+// proxy, and so are CONNECT tunnels, whose traffic the cache can't see.
+func ForwardProxy(next http.Handler, hosts map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			writeJSONError(w, http.StatusMethodNotAllowed, errProxyTunnel)
+			return
+		}
+		if !r.URL.IsAbs() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		provider, ok := hosts[r.URL.Hostname()]
+		if !ok {
+			writeJSONError(w, http.StatusForbidden, fmt.Errorf("%w: %s", errProxyHost, r.URL.Hostname()))
+			return
+		}
+		r = r.Clone(r.Context())
+		r.URL = &url.URL{Path: "/proxy/" + provider + r.URL.Path, RawQuery: r.URL.RawQuery}
+		r.RequestURI = r.URL.RequestURI()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"svc-b/cache"
+	"svc-b/clock"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// countingHTTPClient answers like WeatherAPI, recording the URLs requested
+// and the keys sent in the key header
+type countingHTTPClient struct {
+	requested []string
+	keys      []string
+}
+
+func (c *countingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.requested = append(c.requested, req.URL.String())
+	c.keys = append(c.keys, req.Header.Get("key"))
+	header := http.Header{"Content-Type": {"application/json"}, "Cache-Control": {"public, max-age=60"}, "Set-Cookie": {"session=1"}}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(`{"current":{"temp_c":25}}`))}, nil
+}
+
+func TestWeatherProxy(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	client := &countingHTTPClient{}
+	store := cache.NewMemory[cache.HTTPResponse]("proxy", cache.Config{TTL: time.Hour}, fake, nil)
+	proxy := NewWeatherProxy(client, map[string]ProxyTarget{
+		"weatherapi": {URL: "https://api.weatherapi.com", KeyParam: "key"},
+	}, store, cache.FreshnessPolicy{Max: time.Hour}, fake)
+
+	r := mux.NewRouter()
+	r.Handle("/proxy/{provider}/{path:.*}", proxy).Methods("GET")
+	handler := ForwardProxy(r, map[string]string{"api.weatherapi.com": "weatherapi"})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	// svc-b's own key is never lent out, not even through the forward proxy
+	for _, target := range []string{"/proxy/weatherapi/v1/current.json?q=Recife", "http://api.weatherapi.com/v1/current.json?q=Recife"} {
+		if rec := get(target); rec.Code != http.StatusUnauthorized {
+			t.Errorf("keyless request for %s = %d, want %d", target, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	if len(client.requested) != 0 {
+		t.Fatalf("requested %v, want no provider call without a key", client.requested)
+	}
+
+	rec := get("/proxy/weatherapi/v1/current.json?q=Recife&key=their-key")
+	if rec.Code != http.StatusOK || rec.Header().Get(ProxyCacheHeader) != "MISS" || rec.Body.String() != `{"current":{"temp_c":25}}` {
+		t.Fatalf("first request = %d %s %q, want a relayed MISS", rec.Code, rec.Header().Get(ProxyCacheHeader), rec.Body.String())
+	}
+	if rec.Header().Get("Set-Cookie") != "" {
+		t.Error("provider cookies were relayed")
+	}
+	if len(client.requested) != 1 || client.requested[0] != "https://api.weatherapi.com/v1/current.json?key=their-key&q=Recife" {
+		t.Fatalf("requested %v, want the provider URL with the client's key", client.requested)
+	}
+
+	// The forward-proxy form and another client's key share the entry
+	rec = get("http://api.weatherapi.com/v1/current.json?q=Recife&key=other-key")
+	if rec.Header().Get(ProxyCacheHeader) != "HIT" || len(client.requested) != 1 {
+		t.Errorf("forward-proxy request = %s after %d provider calls, want a HIT", rec.Header().Get(ProxyCacheHeader), len(client.requested))
+	}
+
+	// The provider's max-age bounds the entry
+	fake.Advance(time.Minute)
+	if rec = get("/proxy/weatherapi/v1/current.json?q=Recife&key=their-key"); rec.Header().Get(ProxyCacheHeader) != "MISS" {
+		t.Errorf("request after max-age = %s, want a MISS", rec.Header().Get(ProxyCacheHeader))
+	}
+	if last := client.requested[len(client.requested)-1]; !strings.Contains(last, "key=their-key") {
+		t.Errorf("requested %s, want the client's key", last)
+	}
+
+	if rec = get("http://example.com/"); rec.Code != http.StatusForbidden {
+		t.Errorf("request for another host = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec = get("/proxy/unknown/v1/current.json"); rec.Code != http.StatusNotFound {
+		t.Errorf("request for an unknown provider = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestWeatherProxyKeyHeader(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		target      string
+		header      string
+		expectedKey string
+	}{
+		{"Key in the query", "/proxy/weatherapi/v1/current.json?q=Recife&key=their-key", "", "their-key"},
+		{"Key in the header", "/proxy/weatherapi/v1/current.json?q=Recife", "their-key", "their-key"},
+		{"Query over header", "/proxy/weatherapi/v1/current.json?q=Recife&key=their-key", "other-key", "their-key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+			client := &countingHTTPClient{}
+			store := cache.NewMemory[cache.HTTPResponse]("proxy", cache.Config{TTL: time.Hour}, fake, nil)
+			proxy := NewWeatherProxy(client, map[string]ProxyTarget{
+				"weatherapi": {URL: "https://api.weatherapi.com", KeyParam: "key", KeyHeader: "key"},
+			}, store, cache.FreshnessPolicy{Max: time.Hour}, fake)
+			r := mux.NewRouter()
+			r.Handle("/proxy/{provider}/{path:.*}", proxy).Methods("GET")
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("key", tt.header)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			if len(client.requested) != 1 || client.requested[0] != "https://api.weatherapi.com/v1/current.json?q=Recife" {
+				t.Fatalf("requested %v, want the provider URL without a key", client.requested)
+			}
+			if client.keys[0] != tt.expectedKey {
+				t.Errorf("key header = %q, want %q", client.keys[0], tt.expectedKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// responseWriteTimeout bounds how long a client may take to read a response
+	responseWriteTimeout = 5 * time.Second
+
+	// responseChunkBytes is how much of the body is written between flushes
+	responseChunkBytes = 32 << 10
+)
+
+var errSlowClient = errors.New("client did not read the response before the write deadline")
+
+// writeResponse writes the body in flushed chunks under a write deadline, so a
+// slow client fails fast instead of holding the handler until WriteTimeout
+func writeResponse(w http.ResponseWriter, code int, body []byte) error {
+	rc := http.NewResponseController(w)
+
+	// Not every ResponseWriter supports deadlines or flushing (e.g. test recorders)
+	if err := rc.SetWriteDeadline(time.Now().Add(responseWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	defer rc.SetWriteDeadline(time.Time{})
+
+	w.WriteHeader(code)
+
+	for len(body) > 0 {
+		chunk := body
+		if len(chunk) > responseChunkBytes {
+			chunk = chunk[:responseChunkBytes]
+		}
+
+		if _, err := w.Write(chunk); err != nil {
+			return classifyWriteError(err)
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return classifyWriteError(err)
+		}
+
+		body = body[len(chunk):]
+	}
+
+	return nil
+}
+
+func classifyWriteError(err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return errSlowClient
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"svc-b/observability"
+	"syscall"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestWriteResponseChunksLargeBodies(t *testing.T) {
+	t.Parallel()
+
+	body := bytes.Repeat([]byte("a"), 3*responseChunkBytes+17)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Wrap like the handlers do to make sure deadlines reach the connection
+		tw := &timingResponseWriter{ResponseWriter: w, timing: newServerTiming()}
+		if err := writeResponse(tw, http.StatusOK, body); err != nil {
+			t.Errorf("writeResponse failed: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("got %d bytes, want %d", len(got), len(body))
+	}
+	if resp.Header.Get("Server-Timing") == "" {
+		t.Error("expected the Server-Timing header to be set")
+	}
+}
+
+// stallingWriter is a ResponseWriter whose client takes stall to read each
+// write. Writes fail like a connection past its write deadline when the stall
+// outlasts it, without the test waiting for it.
+type stallingWriter struct {
+	header   http.Header
+	stall    time.Duration
+	err      error
+	deadline time.Time
+}
+
+func (w *stallingWriter) Header() http.Header { return w.header }
+
+func (w *stallingWriter) WriteHeader(int) {}
+
+func (w *stallingWriter) SetWriteDeadline(deadline time.Time) error {
+	w.deadline = deadline
+	return nil
+}
+
+func (w *stallingWriter) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if !w.deadline.IsZero() && time.Now().Add(w.stall).After(w.deadline) {
+		return 0, &net.OpError{Op: "write", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	}
+	return len(b), nil
+}
+
+func TestWriteResponseSlowClient(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		writer         *stallingWriter
+		expectedErr    error
+		expectedReason string
+	}{
+		{"Stalls past the deadline", &stallingWriter{stall: 2 * responseWriteTimeout}, errSlowClient, "write_deadline"},
+		{"Reads in time", &stallingWriter{stall: time.Millisecond}, nil, ""},
+		{"Connection reset", &stallingWriter{err: syscall.ECONNRESET}, syscall.ECONNRESET, "write_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tt.writer.header = make(http.Header)
+			if err := writeResponse(tt.writer, http.StatusOK, []byte(`{"temp_C":25}`)); !errors.Is(err, tt.expectedErr) {
+				t.Errorf("writeResponse() error = %v, want %v", err, tt.expectedErr)
+			}
+
+			ctx := context.Background()
+			reader := sdkmetric.NewManualReader()
+			instruments, err := observability.NewInstruments(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+			if err != nil {
+				t.Fatalf("failed to create instruments: %v", err)
+			}
+			handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, instruments, testLimits, observability.Providers{})
+			tt.writer.header = make(http.Header)
+			handler.respondWithJSON(ctx, tt.writer, http.StatusOK, map[string]float64{"temp_C": 25})
+
+			var rm metricdata.ResourceMetrics
+			if err := reader.Collect(ctx, &rm); err != nil {
+				t.Fatalf("failed to collect metrics: %v", err)
+			}
+			counted := make(map[string]int64)
+			for _, scope := range rm.ScopeMetrics {
+				for _, m := range scope.Metrics {
+					if m.Name != observability.HTTPServerSlowClients.Name {
+						continue
+					}
+					for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+						reason, _ := point.Attributes.Value("reason")
+						counted[reason.AsString()] += point.Value
+					}
+				}
+			}
+			expected := map[string]int64{}
+			if tt.expectedReason != "" {
+				expected[tt.expectedReason] = 1
+			}
+			if len(counted) != len(expected) || counted[tt.expectedReason] != expected[tt.expectedReason] {
+				t.Errorf("%s = %v, want %v", observability.HTTPServerSlowClients.Name, counted, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"pkg/signing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// signingResponseWriter buffers the response so it can be signed whole
+type signingResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *signingResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *signingResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *signingResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(p)
+}
+
+// SigningMiddleware signs every response with the keyring's current key,
+// adding the signature, key ID and timestamp headers svc-a verifies. The
+// signature covers the request's method, path and query. Responses are
+// buffered, so the handlers' chunked writes only reach the client once signed.
+func SigningMiddleware(keys signing.Keyring) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			buffered := &signingResponseWriter{header: w.Header()}
+			next.ServeHTTP(buffered, r)
+			if buffered.status == 0 {
+				buffered.status = http.StatusOK
+			}
+
+			signed := keys.Sign(signing.Message{
+				Method: r.Method,
+				Path:   r.URL.Path,
+				Query:  r.URL.RawQuery,
+				Status: buffered.status,
+				Body:   buffered.body.Bytes(),
+			}, time.Now())
+			for name, values := range signed {
+				w.Header()[name] = values
+			}
+			if err := writeResponse(w, buffered.status, buffered.body.Bytes()); err != nil {
+				slog.WarnContext(r.Context(), "Erro ao enviar resposta assinada", "error", err)
+			}
+		})
+	}
+}
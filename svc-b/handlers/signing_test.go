@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"pkg/signing"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSigningMiddleware(t *testing.T) {
+	t.Parallel()
+
+	keys := signing.Keyring{Current: signing.Key{ID: "k1", Secret: []byte("secret")}}
+	router := mux.NewRouter()
+	router.Use(SigningMiddleware(keys))
+	router.HandleFunc("/weather/{cep}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		writeResponse(w, http.StatusNotFound, []byte(`{"error":"can not find zipcode"}`))
+	})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/weather/99999999?units=C", nil))
+
+	if rr.Code != http.StatusNotFound || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got status %d and content type %q, want the handler's", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if got := rr.Header().Get(signing.KeyIDHeader); got != "k1" {
+		t.Errorf("%s = %q, want k1", signing.KeyIDHeader, got)
+	}
+	msg := signing.Message{Method: http.MethodGet, Path: "/weather/99999999", Query: "units=C", Status: rr.Code, Body: rr.Body.Bytes()}
+	if err := keys.Verify(rr.Header(), msg, time.Now()); err != nil {
+		t.Errorf("signature doesn't verify: %v", err)
+	}
+	msg.Path = "/weather/22450000"
+	if err := keys.Verify(rr.Header(), msg, time.Now()); err == nil {
+		t.Error("signature verifies for another request")
+	}
+}
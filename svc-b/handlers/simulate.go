@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"svc-b/services"
+
+	"github.com/gorilla/mux"
+)
+
+// SimulateHeader selects a sandbox failure scenario, like the simulate query parameter
+const SimulateHeader = "X-Simulate"
+
+// SimulationMiddleware attaches the failure scenario requested through
+// ?simulate= or the X-Simulate header to the request context, where the
+// sandbox providers pick it up. It must only be installed in sandbox mode.
+func SimulationMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value := r.URL.Query().Get("simulate")
+			if value == "" {
+				value = r.Header.Get(SimulateHeader)
+			}
+			if value == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			sim, err := services.ParseSimulation(value)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(services.WithSimulation(r.Context(), sim)))
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"svc-b/observability"
+	"svc-b/services"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSimulationMiddlewareErrorBranches(t *testing.T) {
+	t.Parallel()
+
+	handler := NewWeatherHandler(services.NewSandboxCEPService(observability.Providers{}), services.NewSandboxWeatherService(observability.Providers{}), newTestInstruments(t), testLimits, observability.Providers{})
+
+	router := mux.NewRouter()
+	router.Use(SimulationMiddleware())
+	router.HandleFunc("/weather/{cep}", handler.GetWeatherByCEP)
+
+	tests := []struct {
+		name           string
+		query          string
+		header         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "No scenario",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"city":"Rio de Janeiro","temp_C":25,"temp_F":77,"temp_K":298.15}`,
+		},
+		{
+			name:           "Weather provider error",
+			query:          "?simulate=500",
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"failed to get weather data"}`,
+		},
+		{
+			name:           "City not found",
+			query:          "?simulate=1006",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"city not found in weather service"}`,
+		},
+		{
+			name:           "CEP not found via header",
+			header:         "404",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"can not find zipcode"}`,
+		},
+		{
+			name:           "CEP provider error",
+			query:          "?simulate=cep:500",
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"internal server error"}`,
+		},
+		{
+			name:           "Oversized upstream response",
+			query:          "?simulate=too_large",
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   `{"error":"upstream response too large"}`,
+		},
+		{
+			name:           "Unknown scenario",
+			query:          "?simulate=explode",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid simulate scenario: unknown fault \"explode\""}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("GET", "/weather/22450000"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set(SimulateHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if gotBody := strings.TrimSpace(rr.Body.String()); gotBody != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v", gotBody, tt.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// serverTiming collects per-stage durations and reports them through the
+// Server-Timing header so callers can attribute latency to upstream providers
+type serverTiming struct {
+	start   time.Time
+	metrics []timingMetric
+}
+
+type timingMetric struct {
+	name     string
+	duration time.Duration
+}
+
+func newServerTiming() *serverTiming {
+	return &serverTiming{start: time.Now()}
+}
+
+// track records the time elapsed since stageStart under the given name
+func (t *serverTiming) track(name string, stageStart time.Time) {
+	t.add(name, time.Since(stageStart))
+}
+
+// add records an already measured stage duration
+func (t *serverTiming) add(name string, d time.Duration) {
+	t.metrics = append(t.metrics, timingMetric{name: name, duration: d})
+}
+
+// String renders the header value, always ending with the total time so far
+func (t *serverTiming) String() string {
+	parts := make([]string, 0, len(t.metrics)+1)
+	for _, m := range t.metrics {
+		parts = append(parts, formatTimingMetric(m.name, m.duration))
+	}
+	parts = append(parts, formatTimingMetric("total", time.Since(t.start)))
+	return strings.Join(parts, ", ")
+}
+
+func formatTimingMetric(name string, d time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.2f", name, float64(d)/float64(time.Millisecond))
+}
+
+// timingResponseWriter sets the Server-Timing header right before the status
+// line is written, whichever code path ends up responding
+type timingResponseWriter struct {
+	http.ResponseWriter
+	timing      *serverTiming
+	wroteHeader bool
+}
+
+func (w *timingResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set("Server-Timing", w.timing.String())
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timingResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *timingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestServerTimingString(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		stages   []timingMetric
+		expected string
+	}{
+		{"Total only", nil, `^total;dur=\d+\.\d{2}$`},
+		{"Stages in order", []timingMetric{{"cep", 12500 * time.Microsecond}, {"weather", 80 * time.Millisecond}}, `^cep;dur=12\.50, weather;dur=80\.00, total;dur=\d+\.\d{2}$`},
+		{"Repeated stage kept", []timingMetric{{"weather", time.Millisecond}, {"weather", 2 * time.Millisecond}}, `^weather;dur=1\.00, weather;dur=2\.00, total;dur=\d+\.\d{2}$`},
+		{"Sub-millisecond stage", []timingMetric{{"cep", 1234 * time.Microsecond}}, `^cep;dur=1\.23, total;dur=\d+\.\d{2}$`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			timing := newServerTiming()
+			for _, stage := range tt.stages {
+				timing.add(stage.name, stage.duration)
+			}
+			if got := timing.String(); !regexp.MustCompile(tt.expected).MatchString(got) {
+				t.Errorf("String() = %q, want a match for %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTimingResponseWriter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		respond      func(w http.ResponseWriter)
+		expectedCode int
+	}{
+		{"Explicit status", func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) }, http.StatusNotFound},
+		{"Implicit status on write", func(w http.ResponseWriter) { w.Write([]byte("{}")) }, http.StatusOK},
+		{"Status written twice", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusBadGateway)
+			w.WriteHeader(http.StatusOK)
+		}, http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			timing := newServerTiming()
+			timing.add("cep", 5*time.Millisecond)
+			rr := httptest.NewRecorder()
+			tt.respond(&timingResponseWriter{ResponseWriter: rr, timing: timing})
+
+			// Stages added after the status line don't reach the header
+			timing.add("weather", time.Millisecond)
+			if rr.Code != tt.expectedCode {
+				t.Errorf("status = %d, want %d", rr.Code, tt.expectedCode)
+			}
+			header := rr.Header().Values("Server-Timing")
+			if len(header) != 1 || !regexp.MustCompile(`^cep;dur=5\.00, total;dur=\d+\.\d{2}$`).MatchString(header[0]) {
+				t.Errorf("Server-Timing = %q, want the stages up to the status line", header)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"pkg/validation"
+	"strconv"
+	"svc-b/observability"
+	"svc-b/usecase"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// defaultLongPollInterval is how often waiters re-read the temperature
+	defaultLongPollInterval = 15 * time.Second
+
+	// defaultWaitThreshold, in degrees Celsius, and defaultWaitTimeout apply
+	// when a wait doesn't set ?threshold= or ?timeout=
+	defaultWaitThreshold = 0.5
+	defaultWaitTimeout   = 60 * time.Second
+)
+
+var ErrInvalidThreshold = errors.New("threshold must be a positive number of degrees Celsius")
+
+// ChangeResponse answers a wait for a temperature change with the latest
+// temperature. Changed is false when the timeout elapsed first.
+type ChangeResponse struct {
+	WeatherResponse
+	Changed bool `json:"changed"`
+	// PreviousTempC is the temperature the change was measured from
+	PreviousTempC float64 `json:"previous_temp_C"`
+}
+
+// WithLongPollInterval sets how often waiters re-read the temperature
+func (h *WeatherHandler) WithLongPollInterval(interval time.Duration) *WeatherHandler {
+	h.longPollInterval = interval
+	return h
+}
+
+// WaitForChange handles GET /weather/{cep}/wait-for-change, holding the
+// request until the temperature moves by ?threshold= degrees Celsius (default
+// 0.5) from the one it arrived to, or ?timeout= (default 60s) elapses. The
+// temperature is re-read every poll interval through the weather cache, so
+// waiters on the same city share its upstream lookups. Up to
+// Limits.MaxLongPollWaiters requests wait at once; the others get 503.
+func (h *WeatherHandler) WaitForChange(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), observability.SpanWaitForChange.Name)
+	defer span.End()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	cep, err := h.validateCEP(ctx, w, mux.Vars(r)["cep"])
+	if err != nil {
+		h.respondWithProblem(ctx, w, validation.CEPProblem(err))
+		return
+	}
+
+	threshold, timeout, err := h.parseWait(r)
+	if err != nil {
+		h.respondWithError(ctx, w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	select {
+	case h.waiters <- struct{}{}:
+		defer func() { <-h.waiters }()
+	default:
+		observability.SetOutcome(ctx, observability.OutcomeThrottled)
+		w.Header().Set("Retry-After", strconv.Itoa(max(int(h.longPollInterval.Seconds()), 1)))
+		h.respondWithLimitError(ctx, w, http.StatusServiceUnavailable, "too many waiting requests", "max_long_poll_waiters")
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("cep", cep),
+		attribute.Float64("wait.threshold", threshold),
+		attribute.Int64("wait.timeout_ms", timeout.Milliseconds()),
+	)
+
+	query := usecase.WeatherQuery{CEP: cep, Resolve: usecase.ResolveWeather}
+	base, err := h.fetchWeather(ctx, query)
+	if err != nil {
+		if base.FailedStage() == usecase.StageWeather {
+			h.handleWeatherError(ctx, w, err)
+		} else {
+			h.handleCEPError(ctx, w, err)
+		}
+		return
+	}
+
+	latest, polls := base, 0
+	deadline := h.clock.Now().Add(timeout)
+	for math.Abs(latest.Temperature.TempC-base.Temperature.TempC) < threshold {
+		remaining := deadline.Sub(h.clock.Now())
+		if remaining <= 0 {
+			break
+		}
+		if err := h.clock.Sleep(ctx, min(h.longPollInterval, remaining)); err != nil {
+			// The client went away; there is nobody left to answer
+			slog.InfoContext(ctx, "Espera por mudança cancelada", "cep", cep, "polls", polls, "error", err)
+			return
+		}
+
+		polls++
+		result, err := h.fetchWeather(ctx, query)
+		if err != nil {
+			// A failed poll doesn't end the wait, the next one may succeed
+			slog.WarnContext(ctx, "Erro ao consultar temperatura durante a espera", "cep", cep, "error", err)
+			continue
+		}
+		latest = result
+	}
+
+	changed := math.Abs(latest.Temperature.TempC-base.Temperature.TempC) >= threshold
+	span.SetAttributes(attribute.Int("wait.polls", polls), attribute.Bool("wait.changed", changed))
+
+	temperature := latest.Temperature.Rounded(h.precision)
+	h.respondWithJSON(ctx, w, http.StatusOK, ChangeResponse{
+		WeatherResponse: WeatherResponse{
+			City:             latest.City,
+			TempC:            temperature.TempC,
+			TempF:            temperature.TempF,
+			TempK:            temperature.TempK,
+			ResolvedLocation: temperature.Location,
+			Meta:             weatherMeta(temperature),
+		},
+		Changed:       changed,
+		PreviousTempC: base.Temperature.Rounded(h.precision).TempC,
+	})
+}
+
+// parseWait parses ?threshold= and ?timeout=, which is bounded by
+// Limits.MaxLongPollSeconds
+func (h *WeatherHandler) parseWait(r *http.Request) (float64, time.Duration, error) {
+	threshold, timeout := defaultWaitThreshold, defaultWaitTimeout
+	maxTimeout := time.Duration(h.limits.MaxLongPollSeconds) * time.Second
+
+	if raw := r.URL.Query().Get("threshold"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || !(parsed > 0) || math.IsInf(parsed, 1) {
+			return 0, 0, ErrInvalidThreshold
+		}
+		threshold = parsed
+	}
+	if raw := r.URL.Query().Get("timeout"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 || parsed > maxTimeout {
+			return 0, 0, fmt.Errorf("timeout must be a duration up to %s, e.g. 60s", maxTimeout)
+		}
+		timeout = parsed
+	}
+	return threshold, min(timeout, maxTimeout), nil
+}
+
+// fetchWeather reads the temperature at the CEP, each read getting the time
+// budget of a regular request
+func (h *WeatherHandler) fetchWeather(ctx context.Context, query usecase.WeatherQuery) (usecase.WeatherResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	return h.weather.GetWeatherByCEP(ctx, query)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"svc-b/clock"
+	"svc-b/config"
+	"svc-b/models"
+	"svc-b/observability"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// driftingWeatherService answers the temperatures in turn, repeating the last
+type driftingWeatherService struct {
+	mu    sync.Mutex
+	temps []float64
+}
+
+func (s *driftingWeatherService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	temp := models.FromCelsius(s.temps[0])
+	if len(s.temps) > 1 {
+		s.temps = s.temps[1:]
+	}
+	return &temp, nil
+}
+
+func TestWaitForChange(t *testing.T) {
+	t.Parallel()
+
+	limits := config.Limits{MaxLongPollSeconds: 120, MaxLongPollWaiters: 1}
+	tests := []struct {
+		name           string
+		temps          []float64
+		query          string
+		expectedStatus int
+		expectedBody   string
+		expectedSleeps []time.Duration
+	}{
+		{
+			name:           "Changes by the threshold",
+			temps:          []float64{25, 25.2, 25.6},
+			query:          "?threshold=0.5&timeout=60s",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"city":"Rio de Janeiro","temp_C":25.6,"temp_F":78.08,"temp_K":298.75,"changed":true,"previous_temp_C":25}`,
+			expectedSleeps: []time.Duration{10 * time.Second, 10 * time.Second},
+		},
+		{
+			name:           "Times out unchanged",
+			temps:          []float64{25, 25.2},
+			query:          "?timeout=25s",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"city":"Rio de Janeiro","temp_C":25.2,"temp_F":77.36,"temp_K":298.35,"changed":false,"previous_temp_C":25}`,
+			expectedSleeps: []time.Duration{10 * time.Second, 10 * time.Second, 5 * time.Second},
+		},
+		{
+			name:           "Timeout over the limit",
+			temps:          []float64{25},
+			query:          "?timeout=10m",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"timeout must be a duration up to 2m0s, e.g. 60s"}`,
+		},
+		{
+			name:           "Invalid threshold",
+			temps:          []float64{25},
+			query:          "?threshold=-1",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"threshold must be a positive number of degrees Celsius"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			handler := NewWeatherHandler(&MockCEPService{}, &driftingWeatherService{temps: tt.temps}, newTestInstruments(t), limits, observability.Providers{}).
+				WithLongPollInterval(10 * time.Second)
+			handler.clock = fake
+			router := mux.NewRouter()
+			router.HandleFunc("/weather/{cep}/wait-for-change", handler.WaitForChange)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/weather/22450000/wait-for-change"+tt.query, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rr.Code, tt.expectedStatus, rr.Body)
+			}
+			if body := strings.TrimSpace(rr.Body.String()); body != tt.expectedBody {
+				t.Errorf("body = %s, want %s", body, tt.expectedBody)
+			}
+			if got := fake.Sleeps(); !reflect.DeepEqual(got, tt.expectedSleeps) {
+				t.Errorf("slept %v, want %v", got, tt.expectedSleeps)
+			}
+		})
+	}
+}
+
+func TestWaitForChangeLimitsWaiters(t *testing.T) {
+	t.Parallel()
+
+	limits := config.Limits{MaxLongPollSeconds: 120, MaxLongPollWaiters: 1}
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), limits, observability.Providers{})
+	handler.waiters <- struct{}{}
+	router := mux.NewRouter()
+	router.HandleFunc("/weather/{cep}/wait-for-change", handler.WaitForChange)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/weather/22450000/wait-for-change", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "15" {
+		t.Errorf("Retry-After = %q, want 15", got)
+	}
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"error":"too many waiting requests","limit":"max_long_poll_waiters"}` {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestWaitForChangeStopsWhenClientLeaves(t *testing.T) {
+	t.Parallel()
+
+	limits := config.Limits{MaxLongPollSeconds: 120, MaxLongPollWaiters: 1}
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), limits, observability.Providers{})
+	router := mux.NewRouter()
+	router.HandleFunc("/weather/{cep}/wait-for-change", handler.WaitForChange)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/weather/22450000/wait-for-change", nil).WithContext(ctx))
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler kept waiting after the client left")
+	}
+	if len(handler.waiters) != 0 {
+		t.Errorf("%d waiter slots held, want the slot released", len(handler.waiters))
+	}
+}
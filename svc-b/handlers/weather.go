@@ -2,29 +2,68 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"pkg/validation"
+	"strconv"
 	"strings"
+	"svc-b/clock"
+	"svc-b/codec"
+	"svc-b/config"
+	"svc-b/deadline"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/quota"
+	"svc-b/resilience"
 	"svc-b/services"
+	"svc-b/usecase"
 	"time"
 
 	"github.com/gorilla/mux"
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// requestTimeout is a request's time budget, of which pipelineShare goes to
+// the providers, keeping the rest to encode the response
+const (
+	requestTimeout = 15 * time.Second
+	pipelineShare  = 0.9
+)
+
+// cepFlagsHeader lists the CEP rules flagging the requested CEP
+const cepFlagsHeader = "X-CEP-Flags"
+
+var ErrInvalidIncludeAddress = errors.New("include_address must be true or false")
+
 type WeatherHandler struct {
-	cepService     services.CEPService
+	weather        *usecase.Weather
 	weatherService services.WeatherService
+	instruments    *observability.Instruments
+	limits         config.Limits
 	tracer         trace.Tracer
+	analytics      *observability.CEPAnalytics
+	// batchConcurrency is how many CEPs of a batch are resolved at once
+	batchConcurrency int
+	cepValidator     *validation.CEPValidator
+	// precision is how many decimal places temperatures are answered with
+	precision int
+	// longPollInterval is how often waiters re-read the temperature, and
+	// waiters holds a slot per request waiting, up to Limits.MaxLongPollWaiters
+	longPollInterval time.Duration
+	waiters          chan struct{}
+	clock            clock.Clock
 }
 
 type CepRequest struct {
 	Cep string `json:"cep"`
+	// Units, as in ?units=, limits the temperatures answered
+	Units string `json:"units,omitempty"`
 }
 
 type WeatherResponse struct {
@@ -32,144 +71,427 @@ type WeatherResponse struct {
 	TempC float64 `json:"temp_C"`
 	TempF float64 `json:"temp_F"`
 	TempK float64 `json:"temp_K"`
+	// Address is the CEP's full address, with ?include_address=true
+	Address *models.Address `json:"address,omitempty"`
+	// ResolvedLocation is where the weather provider matched the city, for
+	// providers reporting it
+	ResolvedLocation *models.ResolvedLocation `json:"resolved_location,omitempty"`
+	Meta             *WeatherMeta             `json:"meta,omitempty"`
+}
+
+// WeatherMeta describes how a temperature was obtained
+type WeatherMeta struct {
+	// WeatherProvider is the provider the lookup was routed to
+	WeatherProvider string `json:"weather_provider"`
+}
+
+// weatherMeta is the meta of a temperature, or nil when there's nothing to
+// report on it
+func weatherMeta(temperature models.Temperature) *WeatherMeta {
+	if temperature.Provider == "" {
+		return nil
+	}
+	return &WeatherMeta{WeatherProvider: temperature.Provider}
+}
+
+// CityResponse is returned when only CEP→city resolution is requested
+type CityResponse struct {
+	City    string          `json:"city"`
+	Address *models.Address `json:"address,omitempty"`
+}
+
+// CapabilitiesResponse reports the configured weather provider and its features
+type CapabilitiesResponse struct {
+	Provider     string                `json:"provider"`
+	Capabilities services.Capabilities `json:"capabilities"`
+}
+
+// LimitsResponse reports every limit enforced on requests: the configured
+// ones and the longest forecast
+type LimitsResponse struct {
+	config.Limits
+	MaxForecastDays int `json:"max_forecast_days"`
 }
 
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// Limit names the server limit a request exceeded, as reported by /limits
+	Limit string `json:"limit,omitempty"`
+	// TraceURL links to the request's trace in the Zipkin UI, in the dev profile only
+	TraceURL string `json:"trace_url,omitempty"`
 }
 
-func NewWeatherHandler(cep services.CEPService, weather services.WeatherService) *WeatherHandler {
+func NewWeatherHandler(cep services.CEPService, weather services.WeatherService, instruments *observability.Instruments, limits config.Limits, providers observability.Providers) *WeatherHandler {
 	return &WeatherHandler{
-		cepService:     cep,
-		weatherService: weather,
-		tracer:         otel.Tracer("weather-handler"),
+		weather:          usecase.NewWeather(cep, weather, providers),
+		weatherService:   weather,
+		instruments:      instruments,
+		limits:           limits,
+		tracer:           providers.Tracer("weather-handler"),
+		precision:        models.DefaultPrecision,
+		longPollInterval: defaultLongPollInterval,
+		waiters:          make(chan struct{}, max(limits.MaxLongPollWaiters, 0)),
+		clock:            clock.Real{},
 	}
 }
 
+// WithTemperaturePrecision answers temperatures rounded to places decimal
+// places, unless a request asks for its own precision
+func (h *WeatherHandler) WithTemperaturePrecision(places int) *WeatherHandler {
+	h.precision = places
+	return h
+}
+
+// WithCEPValidator runs the deployment's CEP rules after normalizing CEPs
+func (h *WeatherHandler) WithCEPValidator(v *validation.CEPValidator) *WeatherHandler {
+	h.cepValidator = v
+	return h
+}
+
+// WithAnalytics counts the successful lookups by UF and city in a
+func (h *WeatherHandler) WithAnalytics(a *observability.CEPAnalytics) *WeatherHandler {
+	h.analytics = a
+	return h
+}
+
 func (h *WeatherHandler) GetWeatherByCEP(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	timing := newServerTiming()
+	w = &timingResponseWriter{ResponseWriter: w, timing: timing}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
 	defer cancel()
 
-	ctx, span := h.tracer.Start(ctx, "GetWeatherByCEP")
+	ctx, span := h.tracer.Start(ctx, observability.SpanGetWeatherByCEP.Name)
 	defer span.End()
 
 	w.Header().Set("Content-Type", "application/json")
 
-	vars := mux.Vars(r)
-	cep := vars["cep"]
+	cep, err := h.validateCEP(ctx, w, mux.Vars(r)["cep"])
+	if err != nil {
+		h.respondWithProblem(ctx, w, validation.CEPProblem(err))
+		return
+	}
+
+	resolve, err := usecase.ParseResolve(r.URL.Query().Get("resolve"))
+	if err != nil {
+		h.respondWithError(ctx, w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	// Normalize CEP by removing non-numeric characters
-	cep = strings.ReplaceAll(cep, "-", "")
-	cep = strings.ReplaceAll(cep, ".", "")
+	includeAddress, err := parseIncludeAddress(r.URL.Query().Get("include_address"))
+	if err != nil {
+		h.respondWithError(ctx, w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	log.Printf("Recebida requisição para CEP: %s", cep)
-	span.SetAttributes(attribute.String("cep", cep))
+	pipeline, err := parseResponsePipeline(r.URL.Query(), "")
+	if err != nil {
+		h.respondWithError(ctx, w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx = withResponsePipeline(ctx, pipeline)
+
+	slog.InfoContext(ctx, "Recebida requisição", "cep", cep)
+	span.SetAttributes(attribute.String("cep", cep), attribute.String("resolve", string(resolve)))
 
-	h.processWeatherRequest(ctx, w, cep)
+	h.processWeatherRequest(ctx, w, timing, usecase.WeatherQuery{CEP: cep, Resolve: resolve}, includeAddress)
 }
 
 func (h *WeatherHandler) GetWeatherByCEPPost(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	timing := newServerTiming()
+	w = &timingResponseWriter{ResponseWriter: w, timing: timing}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
 	defer cancel()
 
-	ctx, span := h.tracer.Start(ctx, "GetWeatherByCEPPost")
+	ctx, span := h.tracer.Start(ctx, observability.SpanGetWeatherByCEPPost.Name)
 	defer span.End()
 
 	w.Header().Set("Content-Type", "application/json")
 
+	resolve, err := usecase.ParseResolve(r.URL.Query().Get("resolve"))
+	if err != nil {
+		h.respondWithError(ctx, w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	includeAddress, err := parseIncludeAddress(r.URL.Query().Get("include_address"))
+	if err != nil {
+		h.respondWithError(ctx, w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	var req CepRequest
-	body, err := io.ReadAll(r.Body)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.limits.MaxBodyBytes))
 	if err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "invalid request body")
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.respondWithLimitError(ctx, w, http.StatusRequestEntityTooLarge, "request body too large", "max_body_bytes")
+			return
+		}
+		h.respondWithError(ctx, w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	if err := json.Unmarshal(body, &req); err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "invalid request format")
+	if err := codec.Unmarshal(body, &req); err != nil {
+		h.respondWithError(ctx, w, http.StatusBadRequest, "invalid request format")
 		return
 	}
 
-	// Normalize CEP by removing non-numeric characters
-	req.Cep = strings.ReplaceAll(req.Cep, "-", "")
-	req.Cep = strings.ReplaceAll(req.Cep, ".", "")
+	if req.Cep, err = h.validateCEP(ctx, w, req.Cep); err != nil {
+		h.respondWithProblem(ctx, w, validation.CEPProblem(err))
+		return
+	}
 
-	log.Printf("Recebida requisição POST para CEP: %s", req.Cep)
-	span.SetAttributes(attribute.String("cep", req.Cep))
+	pipeline, err := parseResponsePipeline(r.URL.Query(), req.Units)
+	if err != nil {
+		h.respondWithError(ctx, w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx = withResponsePipeline(ctx, pipeline)
 
-	h.processWeatherRequest(ctx, w, req.Cep)
-}
+	slog.InfoContext(ctx, "Recebida requisição POST", "cep", req.Cep)
+	span.SetAttributes(attribute.String("cep", req.Cep), attribute.String("resolve", string(resolve)))
 
-func (h *WeatherHandler) processWeatherRequest(ctx context.Context, w http.ResponseWriter, cep string) {
-	ctx, span := h.tracer.Start(ctx, "processWeatherRequest")
-	defer span.End()
+	h.processWeatherRequest(ctx, w, timing, usecase.WeatherQuery{CEP: req.Cep, Resolve: resolve}, includeAddress)
+}
 
-	if len(cep) != 8 {
-		h.respondWithError(w, http.StatusUnprocessableEntity, "invalid zipcode")
-		return
+// validateCEP normalizes a CEP and runs the CEP rules on it. The codes of the
+// rules flagging it are answered in X-CEP-Flags and recorded on the span.
+func (h *WeatherHandler) validateCEP(ctx context.Context, w http.ResponseWriter, raw string) (string, error) {
+	cep, flags, err := h.cepValidator.Validate(raw)
+	if len(flags) > 0 {
+		w.Header().Set(cepFlagsHeader, strings.Join(flags, ","))
+		trace.SpanFromContext(ctx).SetAttributes(attribute.StringSlice("cep.flags", flags))
 	}
+	return cep, err
+}
 
-	// Get city by CEP
-	city, err := h.cepService.GetCityByCEP(ctx, cep)
+// parseIncludeAddress parses ?include_address=, off by default
+func parseIncludeAddress(raw string) (bool, error) {
+	if raw == "" {
+		return false, nil
+	}
+	include, err := strconv.ParseBool(raw)
 	if err != nil {
-		h.handleCEPError(w, err)
-		return
+		return false, ErrInvalidIncludeAddress
 	}
+	return include, nil
+}
 
-	// Get temperature for city
-	temp, err := h.weatherService.GetTemperature(ctx, city)
+// processWeatherRequest runs the weather use case and renders its result
+func (h *WeatherHandler) processWeatherRequest(ctx context.Context, w http.ResponseWriter, timing *serverTiming, query usecase.WeatherQuery, includeAddress bool) {
+	pipelineCtx, cancel := deadline.Child(ctx, pipelineShare)
+	result, err := h.weather.GetWeatherByCEP(pipelineCtx, query)
+	cancel()
+	for _, stage := range result.Stages {
+		timing.add(stage.Name, stage.Duration)
+	}
 	if err != nil {
-		h.handleWeatherError(w, err)
+		if result.FailedStage() == usecase.StageWeather {
+			h.handleWeatherError(ctx, w, err)
+		} else {
+			h.handleCEPError(ctx, w, err)
+		}
 		return
 	}
+	if uf, ok := services.UFByCEP(usecase.NormalizeCEP(query.CEP)); ok {
+		h.analytics.Record(uf, result.City)
+	}
+
+	h.respondWithJSON(ctx, w, http.StatusOK, h.weatherBody(query.Resolve, includeAddress, result))
+}
+
+// weatherBody is the success body for a resolved query. Providers answer
+// temperatures as measured; they are rounded here, at the configured precision.
+func (h *WeatherHandler) weatherBody(resolve usecase.Resolve, includeAddress bool, result usecase.WeatherResult) any {
+	var address *models.Address
+	if includeAddress {
+		address = result.Address
+	}
+	if resolve == usecase.ResolveCity {
+		return CityResponse{City: result.City, Address: address}
+	}
+	temperature := result.Temperature.Rounded(h.precision)
+	return WeatherResponse{
+		City:             result.City,
+		TempC:            temperature.TempC,
+		TempF:            temperature.TempF,
+		TempK:            temperature.TempK,
+		Address:          address,
+		ResolvedLocation: temperature.Location,
+		Meta:             weatherMeta(temperature),
+	}
+}
+
+// GetLimits reports the server limits so clients can size their requests
+func (h *WeatherHandler) GetLimits(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	h.respondWithJSON(r.Context(), w, http.StatusOK, LimitsResponse{Limits: h.limits, MaxForecastDays: services.MaxForecastDays})
+}
+
+// GetCapabilities reports which optional features the weather provider supports
+func (h *WeatherHandler) GetCapabilities(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	// Return successful response
-	response := WeatherResponse{
-		City:  city,
-		TempC: temp.TempC,
-		TempF: temp.TempF,
-		TempK: temp.TempK,
+	name, capabilities := h.providerCapabilities()
+	h.respondWithJSON(r.Context(), w, http.StatusOK, CapabilitiesResponse{
+		Provider:     name,
+		Capabilities: capabilities,
+	})
+}
+
+// providerCapabilities returns the weather provider's capabilities, treating
+// services that don't describe themselves as supporting no optional features
+func (h *WeatherHandler) providerCapabilities() (string, services.Capabilities) {
+	provider, ok := h.weatherService.(services.WeatherProvider)
+	if !ok {
+		return "unknown", services.Capabilities{}
+	}
+	return provider.Name(), provider.Capabilities()
+}
+
+// requireCapability responds with 501 when the weather provider lacks the
+// given capability, returning whether the request may proceed
+func (h *WeatherHandler) requireCapability(ctx context.Context, w http.ResponseWriter, capability services.Capability) bool {
+	name, capabilities := h.providerCapabilities()
+	if capabilities.Supports(capability) {
+		return true
 	}
 
-	h.respondWithJSON(w, http.StatusOK, response)
+	h.respondWithError(ctx, w, http.StatusNotImplemented,
+		fmt.Sprintf("%s is not supported by weather provider %s", capability, name))
+	return false
 }
 
-func (h *WeatherHandler) handleCEPError(w http.ResponseWriter, err error) {
+func (h *WeatherHandler) handleCEPError(ctx context.Context, w http.ResponseWriter, err error) {
+	if h.handleQuotaError(ctx, w, err) || h.handleBreakerOpen(ctx, w, err) {
+		return
+	}
+
 	switch {
 	case errors.Is(err, services.ErrInvalidZipCode):
-		h.respondWithError(w, http.StatusUnprocessableEntity, "invalid zipcode")
+		h.respondWithProblem(ctx, w, validation.CEPProblem(err))
 	case errors.Is(err, services.ErrZipCodeNotFound):
-		h.respondWithError(w, http.StatusNotFound, "can not find zipcode")
+		h.respondWithError(ctx, w, http.StatusNotFound, "can not find zipcode")
+	case errors.Is(err, services.ErrUpstreamResponseTooLarge):
+		slog.ErrorContext(ctx, "CEP Service error", "error", err)
+		h.respondWithError(ctx, w, http.StatusBadGateway, "upstream response too large")
 	default:
-		log.Printf("CEP Service error: %v", err)
-		h.respondWithError(w, http.StatusInternalServerError, "internal server error")
+		slog.ErrorContext(ctx, "CEP Service error", "error", err)
+		observability.SetOutcome(ctx, observability.OutcomeFromError(err))
+		h.respondWithError(ctx, w, http.StatusInternalServerError, "internal server error")
 	}
 }
 
-func (h *WeatherHandler) handleWeatherError(w http.ResponseWriter, err error) {
+func (h *WeatherHandler) handleWeatherError(ctx context.Context, w http.ResponseWriter, err error) {
+	if h.handleQuotaError(ctx, w, err) || h.handleBreakerOpen(ctx, w, err) {
+		return
+	}
+
 	switch {
 	case errors.Is(err, services.ErrAPIKeyNotConfigured):
-		h.respondWithError(w, http.StatusInternalServerError, "weather service configuration error")
+		h.respondWithError(ctx, w, http.StatusInternalServerError, "weather service configuration error")
 	case errors.Is(err, services.ErrCityNotFound):
-		h.respondWithError(w, http.StatusNotFound, "city not found in weather service")
+		h.respondWithError(ctx, w, http.StatusNotFound, "city not found in weather service")
+	case errors.Is(err, services.ErrForecastUnsupported):
+		h.respondWithError(ctx, w, http.StatusNotImplemented, "forecast is not supported by the weather provider")
+	case errors.Is(err, services.ErrUpstreamResponseTooLarge):
+		slog.ErrorContext(ctx, "Weather Service error", "error", err)
+		h.respondWithError(ctx, w, http.StatusBadGateway, "upstream response too large")
 	default:
-		log.Printf("Weather Service error: %v", err)
-		h.respondWithError(w, http.StatusInternalServerError, "failed to get weather data")
+		slog.ErrorContext(ctx, "Weather Service error", "error", err)
+		observability.SetOutcome(ctx, observability.OutcomeFromError(err))
+		h.respondWithError(ctx, w, http.StatusInternalServerError, "failed to get weather data")
 	}
 }
 
-func (h *WeatherHandler) respondWithError(w http.ResponseWriter, code int, message string) {
-	h.respondWithJSON(w, code, ErrorResponse{Error: message})
+// handleQuotaError answers 503 with Retry-After when a provider's quota is
+// spent, returning whether err was a quota error
+func (h *WeatherHandler) handleQuotaError(ctx context.Context, w http.ResponseWriter, err error) bool {
+	var exhausted *quota.ExhaustedError
+	if !errors.As(err, &exhausted) {
+		return false
+	}
+
+	slog.WarnContext(ctx, "Cota esgotada", "provider", exhausted.Provider, "retry_after", exhausted.RetryAfter, "error", err)
+	observability.SetOutcome(ctx, observability.OutcomeThrottled)
+	retryAfter := int(math.Ceil(exhausted.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	h.respondWithError(ctx, w, http.StatusServiceUnavailable, "upstream quota exhausted")
+	return true
+}
+
+// handleBreakerOpen answers 503 when a provider's circuit breaker is open,
+// failing fast during an outage, returning whether err was a breaker rejection
+func (h *WeatherHandler) handleBreakerOpen(ctx context.Context, w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, resilience.ErrBreakerOpen) {
+		return false
+	}
+
+	slog.WarnContext(ctx, "Circuit breaker aberto", "error", err)
+	observability.SetOutcome(ctx, observability.OutcomeUpstreamError)
+	h.respondWithError(ctx, w, http.StatusServiceUnavailable, "upstream unavailable")
+	return true
+}
+
+func (h *WeatherHandler) respondWithError(ctx context.Context, w http.ResponseWriter, code int, message string) {
+	h.respondWithLimitError(ctx, w, code, message, "")
 }
 
-func (h *WeatherHandler) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
-	response, err := json.Marshal(payload)
+// respondWithLimitError reports a request rejected for exceeding a named server limit
+func (h *WeatherHandler) respondWithLimitError(ctx context.Context, w http.ResponseWriter, code int, message, limit string) {
+	traceURL := observability.TraceURL(ctx)
+	if traceURL != "" {
+		slog.InfoContext(ctx, "Resposta de erro", "status", code, "error", message, "trace_url", traceURL)
+	}
+	h.respondWithJSON(ctx, w, code, ErrorResponse{Error: message, Limit: limit, TraceURL: traceURL})
+}
+
+// respondWithProblem reports a request rejected by validation as an RFC 7807
+// problem
+func (h *WeatherHandler) respondWithProblem(ctx context.Context, w http.ResponseWriter, problem validation.Problem) {
+	if problem.TraceURL = observability.TraceURL(ctx); problem.TraceURL != "" {
+		slog.InfoContext(ctx, "Resposta de erro", "status", problem.Status, "error", problem.Detail, "trace_url", problem.TraceURL)
+	}
+	w.Header().Set("Content-Type", validation.ProblemContentType)
+	h.respondWithJSON(ctx, w, problem.Status, problem)
+}
+
+func (h *WeatherHandler) respondWithJSON(ctx context.Context, w http.ResponseWriter, code int, payload interface{}) {
+	ctx, span := h.tracer.Start(ctx, observability.SpanEncodeResponse.Name)
+	defer span.End()
+
+	response, err := codec.Marshal(payload)
 	if err != nil {
-		log.Printf("Error marshaling JSON response: %v", err)
+		slog.ErrorContext(ctx, "Error marshaling JSON response", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(`{"error":"internal server error"}`))
 		return
 	}
 
-	w.WriteHeader(code)
-	w.Write(response)
+	// Client-requested shaping runs on canonical field names, before the
+	// client's response profile renames them
+	pipeline := responsePipelineFromContext(ctx)
+	if profile := responseProfileFromContext(ctx); profile != nil {
+		pipeline = append(pipeline[:len(pipeline):len(pipeline)], Rename(profile))
+	}
+	if len(pipeline) > 0 {
+		if response, err = pipeline.Apply(code, response); err != nil {
+			slog.ErrorContext(ctx, "Error post-processing response", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"internal server error"}`))
+			return
+		}
+	}
+
+	if err := writeResponse(w, code, response); err != nil {
+		reason := "write_error"
+		if errors.Is(err, errSlowClient) {
+			reason = "write_deadline"
+		}
+		slog.WarnContext(ctx, "Aborted response to slow client", "reason", reason, "error", err)
+		h.instruments.SlowClients.Add(ctx, 1,
+			metric.WithAttributes(attribute.String("reason", reason)))
+	}
 }
@@ -1,17 +1,31 @@
 package handlers
 
 import (
+	"context"
 	"github.com/gorilla/mux"
 	"net/http"
 	"net/http/httptest"
+	"pkg/telemetry/telemetrytest"
+	"pkg/validation"
 	"strings"
+	"svc-b/config"
+	"svc-b/deadline"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/services"
 	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestGetWeatherByCEP(t *testing.T) {
+	t.Parallel()
+
 	mockCEP := &MockCEPService{}
 	mockWeather := &MockWeatherService{}
-	handler := NewWeatherHandler(mockCEP, mockWeather)
+	handler := NewWeatherHandler(mockCEP, mockWeather, newTestInstruments(t), testLimits, observability.Providers{})
 
 	tests := []struct {
 		name           string
@@ -23,13 +37,37 @@ func TestGetWeatherByCEP(t *testing.T) {
 			name:           "Valid CEP",
 			cep:            "22450000",
 			expectedStatus: http.StatusOK,
-			expectedBody:   `{"temp_C":25,"temp_F":77,"temp_K":298.15}`,
+			expectedBody:   `{"city":"Rio de Janeiro","temp_C":25,"temp_F":77,"temp_K":298.15}`,
+		},
+		{
+			name:           "With the address",
+			cep:            "22450000?include_address=true",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"city":"Rio de Janeiro","temp_C":25,"temp_F":77,"temp_K":298.15,"address":{"street":"Rua Marquês de São Vicente","neighborhood":"Gávea","city":"Rio de Janeiro","state":"RJ"}}`,
+		},
+		{
+			name:           "City with the address",
+			cep:            "22450000?resolve=city&include_address=1",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"city":"Rio de Janeiro","address":{"street":"Rua Marquês de São Vicente","neighborhood":"Gávea","city":"Rio de Janeiro","state":"RJ"}}`,
+		},
+		{
+			name:           "Invalid include_address",
+			cep:            "22450000?include_address=maybe",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"include_address must be true or false"}`,
 		},
 		{
 			name:           "Invalid CEP Format",
 			cep:            "123",
 			expectedStatus: http.StatusUnprocessableEntity,
-			expectedBody:   `{"error":"invalid zipcode"}`,
+			expectedBody:   `{"type":"about:blank","title":"Unprocessable Entity","status":422,"detail":"cep must have 8 digits","code":"cep_invalid_length","error":"invalid zipcode"}`,
+		},
+		{
+			name:           "CEP with letters",
+			cep:            "2245000a",
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"type":"about:blank","title":"Unprocessable Entity","status":422,"detail":"cep must only contain digits, optionally as 00000-000","code":"cep_invalid_characters","error":"invalid zipcode"}`,
 		},
 		{
 			name:           "Non-existent CEP",
@@ -41,6 +79,8 @@ func TestGetWeatherByCEP(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
 			req := httptest.NewRequest("GET", "/weather/"+tt.cep, nil)
 			rr := httptest.NewRecorder()
 
@@ -63,3 +103,343 @@ func TestGetWeatherByCEP(t *testing.T) {
 		})
 	}
 }
+
+func TestGetWeatherByCEPQuotaExhausted(t *testing.T) {
+	t.Parallel()
+
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), testLimits, observability.Providers{})
+	router := mux.NewRouter()
+	router.HandleFunc("/weather/{cep}", handler.GetWeatherByCEP)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/weather/01001000", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+	if got := strings.TrimSpace(rr.Body.String()); got != `{"error":"upstream quota exhausted"}` {
+		t.Errorf("body = %s", got)
+	}
+}
+
+func TestGetWeatherByCEPBreakerOpen(t *testing.T) {
+	t.Parallel()
+
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), testLimits, observability.Providers{})
+	router := mux.NewRouter()
+	router.HandleFunc("/weather/{cep}", handler.GetWeatherByCEP)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/weather/02002000", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	if got := strings.TrimSpace(rr.Body.String()); got != `{"error":"upstream unavailable"}` {
+		t.Errorf("body = %s", got)
+	}
+}
+
+func TestGetWeatherByCEPResolveCity(t *testing.T) {
+	t.Parallel()
+
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), testLimits, observability.Providers{})
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "City only",
+			query:          "?resolve=city",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"city":"Rio de Janeiro"}`,
+		},
+		{
+			name:           "Invalid resolve mode",
+			query:          "?resolve=state",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid resolve mode"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("GET", "/weather/22450000"+tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			router := mux.NewRouter()
+			router.HandleFunc("/weather/{cep}", handler.GetWeatherByCEP)
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+
+			if gotBody := strings.TrimSpace(rr.Body.String()); gotBody != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					gotBody, tt.expectedBody)
+			}
+		})
+	}
+}
+
+// budgetWeatherService records the time the weather stage had left
+type budgetWeatherService struct {
+	MockWeatherService
+	remaining chan time.Duration
+}
+
+func (s *budgetWeatherService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	remaining, _ := deadline.Remaining(ctx)
+	s.remaining <- remaining
+	return s.MockWeatherService.GetTemperature(ctx, location)
+}
+
+func TestGetWeatherByCEPReservesEncodingTime(t *testing.T) {
+	t.Parallel()
+
+	weather := &budgetWeatherService{remaining: make(chan time.Duration, 1)}
+	handler := NewWeatherHandler(&MockCEPService{}, weather, newTestInstruments(t), testLimits, observability.Providers{})
+	router := mux.NewRouter()
+	router.HandleFunc("/weather/{cep}", handler.GetWeatherByCEP)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/weather/22450000", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rr.Code)
+	}
+
+	// The weather stage comes last, so it has the whole pipeline share
+	expected := time.Duration(float64(requestTimeout) * pipelineShare)
+	if got := <-weather.remaining; got > expected || got < expected-time.Second {
+		t.Errorf("weather stage had %v left, want about %v and never more", got, expected)
+	}
+}
+
+// locatingWeatherService resolves every location to a fixed place in its state
+type locatingWeatherService struct {
+	MockWeatherService
+}
+
+func (s *locatingWeatherService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	temp, err := s.MockWeatherService.GetTemperature(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	temp.Location = &models.ResolvedLocation{Name: location.City, Region: models.StateName(location.State), Country: "Brazil"}
+	return temp, nil
+}
+
+func TestGetWeatherByCEPResolvedLocation(t *testing.T) {
+	t.Parallel()
+
+	handler := NewWeatherHandler(&MockCEPService{}, &locatingWeatherService{}, newTestInstruments(t), testLimits, observability.Providers{})
+	router := mux.NewRouter()
+	router.HandleFunc("/weather/{cep}", handler.GetWeatherByCEP)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/weather/22450000", nil))
+
+	expected := `{"city":"Rio de Janeiro","temp_C":25,"temp_F":77,"temp_K":298.15,"resolved_location":{"name":"Rio de Janeiro","region":"Rio de Janeiro","country":"Brazil"}}`
+	if body := strings.TrimSpace(rr.Body.String()); body != expected {
+		t.Errorf("body = %s, want %s", body, expected)
+	}
+}
+
+func TestGetWeatherByCEPReportsProvider(t *testing.T) {
+	t.Parallel()
+
+	weather := services.NewWeatherRouter(map[string]services.WeatherService{
+		services.WeatherProviderWeatherAPI:     &MockWeatherService{},
+		services.WeatherProviderOpenWeatherMap: &MockWeatherService{},
+	}, map[string]string{"RJ": services.WeatherProviderOpenWeatherMap}, services.WeatherProviderWeatherAPI, observability.Providers{})
+	handler := NewWeatherHandler(&MockCEPService{}, weather, newTestInstruments(t), testLimits, observability.Providers{})
+	router := mux.NewRouter()
+	router.HandleFunc("/weather/{cep}", handler.GetWeatherByCEP)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/weather/22450000", nil))
+
+	expected := `{"city":"Rio de Janeiro","temp_C":25,"temp_F":77,"temp_K":298.15,"meta":{"weather_provider":"openweathermap"}}`
+	if body := strings.TrimSpace(rr.Body.String()); body != expected {
+		t.Errorf("body = %s, want %s", body, expected)
+	}
+}
+
+func TestGetWeatherByCEPRules(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		action         string
+		expectedStatus int
+		expectedFlags  string
+		expectedBody   string
+	}{
+		// The mock CEP service doesn't know the flagged CEP, which goes on to fail there
+		{"Flagged", validation.ActionFlag, http.StatusInternalServerError, validation.CodeCEPLargeCustomer, `{"error":"internal server error"}`},
+		{"Rejected", validation.ActionReject, http.StatusUnprocessableEntity, "", `{"type":"about:blank","title":"Unprocessable Entity","status":422,"detail":"cep is reserved for a large customer","code":"cep_reserved_large_customer","error":"invalid zipcode"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			validator := validation.NewCEPValidator().Register("reserved_ranges", validation.ReservedRanges, tt.action)
+			handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), testLimits, observability.Providers{}).WithCEPValidator(validator)
+			router := mux.NewRouter()
+			router.HandleFunc("/weather/{cep}", handler.GetWeatherByCEP)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/weather/01310-900", nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+			if flags := rr.Header().Get(cepFlagsHeader); flags != tt.expectedFlags {
+				t.Errorf("%s = %q, want %q", cepFlagsHeader, flags, tt.expectedFlags)
+			}
+			if body := strings.TrimSpace(rr.Body.String()); body != tt.expectedBody {
+				t.Errorf("body = %s, want %s", body, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestRequireCapability(t *testing.T) {
+	t.Parallel()
+
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), testLimits, observability.Providers{})
+
+	rr := httptest.NewRecorder()
+	if handler.requireCapability(context.Background(), rr, services.CapabilityForecast) {
+		t.Fatal("expected forecast to be unsupported by a provider without capabilities")
+	}
+
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotImplemented)
+	}
+
+	expectedBody := `{"error":"forecast is not supported by weather provider unknown"}`
+	if gotBody := strings.TrimSpace(rr.Body.String()); gotBody != expectedBody {
+		t.Errorf("handler returned unexpected body: got %v want %v", gotBody, expectedBody)
+	}
+}
+
+func TestGetWeatherByCEPPostBodyLimit(t *testing.T) {
+	t.Parallel()
+
+	limits := config.Limits{MaxBodyBytes: 32}
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), limits, observability.Providers{})
+
+	body := `{"cep":"22450000","padding":"` + strings.Repeat("x", 64) + `"}`
+	req := httptest.NewRequest("POST", "/weather", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	handler.GetWeatherByCEPPost(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	expectedBody := `{"error":"request body too large","limit":"max_body_bytes"}`
+	if gotBody := strings.TrimSpace(rr.Body.String()); gotBody != expectedBody {
+		t.Errorf("handler returned unexpected body: got %v want %v", gotBody, expectedBody)
+	}
+}
+
+func TestGetLimits(t *testing.T) {
+	t.Parallel()
+
+	limits := config.Limits{MaxBodyBytes: 4096, MaxBatchCEPs: 20, MaxLongPollSeconds: 120, MaxLongPollWaiters: 100}
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), limits, observability.Providers{})
+
+	rr := httptest.NewRecorder()
+	handler.GetLimits(rr, httptest.NewRequest(http.MethodGet, "/limits", nil))
+
+	expectedBody := `{"max_body_bytes":4096,"max_batch_ceps":20,"max_long_poll_seconds":120,"max_long_poll_waiters":100,"max_forecast_days":14}`
+	if gotBody := strings.TrimSpace(rr.Body.String()); gotBody != expectedBody {
+		t.Errorf("handler returned unexpected body: got %v want %v", gotBody, expectedBody)
+	}
+}
+
+func TestResponseProfileMapping(t *testing.T) {
+	t.Parallel()
+
+	handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), testLimits, observability.Providers{})
+	profiles := ResponseProfiles{
+		"enterprise-key": {"city": "cidade", "temp_C": "temperatura_c"},
+	}
+
+	router := mux.NewRouter()
+	router.Use(ResponseProfileMiddleware(profiles))
+	router.HandleFunc("/weather/{cep}", handler.GetWeatherByCEP)
+
+	tests := []struct {
+		name         string
+		apiKey       string
+		expectedBody string
+	}{
+		{
+			name:         "Client with profile",
+			apiKey:       "enterprise-key",
+			expectedBody: `{"cidade":"Rio de Janeiro","temperatura_c":25,"temp_F":77,"temp_K":298.15}`,
+		},
+		{
+			name:         "Client without profile",
+			apiKey:       "other-key",
+			expectedBody: `{"city":"Rio de Janeiro","temp_C":25,"temp_F":77,"temp_K":298.15}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("GET", "/weather/22450000", nil)
+			req.Header.Set(APIKeyHeader, tt.apiKey)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if gotBody := strings.TrimSpace(rr.Body.String()); gotBody != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v", gotBody, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestHandlersRecordToInjectedProviders(t *testing.T) {
+	t.Parallel()
+
+	recorders := []*tracetest.SpanRecorder{tracetest.NewSpanRecorder(), tracetest.NewSpanRecorder()}
+	for i, recorder := range recorders {
+		providers := observability.Providers{
+			TracerProvider: telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder)),
+		}
+		handler := NewWeatherHandler(&MockCEPService{}, &MockWeatherService{}, newTestInstruments(t), testLimits, providers)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/weather/{cep}", handler.GetWeatherByCEP)
+		for j := 0; j <= i; j++ {
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/weather/22450000", nil))
+		}
+	}
+
+	// Each instance only sees its own requests: one handler, one processing and
+	// one encoding span per request
+	for i, recorder := range recorders {
+		if got, want := len(recorder.Ended()), 3*(i+1); got != want {
+			t.Errorf("instance %d recorded %d spans, want %d", i, got, want)
+		}
+	}
+}
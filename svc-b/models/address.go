@@ -0,0 +1,54 @@
+package models
+
+import "strings"
+
+// Address is what a CEP provider knows of a CEP. City is always set; the
+// others are empty for CEPs that cover a whole city.
+type Address struct {
+	Street       string `json:"street,omitempty"`
+	Neighborhood string `json:"neighborhood,omitempty"`
+	City         string `json:"city"`
+	State        string `json:"state,omitempty"`
+}
+
+// Location is the place a temperature is asked for: a city and, when the CEP
+// provider reports it, its state (UF), as cities like São Francisco exist in
+// several states
+type Location struct {
+	City  string
+	State string
+	// CEP is the CEP the location was resolved from, for the sources that
+	// measure per site rather than per city; providers and caches ignore it
+	CEP string
+}
+
+// Location is the address's city and state
+func (a Address) Location() Location {
+	return Location{City: a.City, State: a.State}
+}
+
+// String is the city followed by its UF, e.g. "Sorocaba, SP", or the city alone
+func (l Location) String() string {
+	if l.State == "" {
+		return l.City
+	}
+	return l.City + ", " + l.State
+}
+
+// ResolvedLocation is the place a weather provider matched a Location to
+type ResolvedLocation struct {
+	Name    string `json:"name"`
+	Region  string `json:"region,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+// String joins the resolved place's parts, e.g. "Sorocaba, Sao Paulo, Brazil"
+func (l ResolvedLocation) String() string {
+	parts := []string{l.Name}
+	for _, part := range []string{l.Region, l.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,20 @@
+package models
+
+// DailyForecast is a day's forecast, with the provider's condition code (e.g.
+// WeatherAPI's 1000 for sunny)
+type DailyForecast struct {
+	Date          string      `json:"date"`
+	Min           Temperature `json:"min"`
+	Max           Temperature `json:"max"`
+	Avg           Temperature `json:"avg"`
+	ConditionCode int         `json:"condition_code"`
+}
+
+// Rounded returns the forecast with its temperatures rounded to places
+// decimal places
+func (f DailyForecast) Rounded(places int) DailyForecast {
+	f.Min = f.Min.Rounded(places)
+	f.Max = f.Max.Rounded(places)
+	f.Avg = f.Avg.Rounded(places)
+	return f
+}
@@ -0,0 +1,40 @@
+package models
+
+import "strings"
+
+// stateNames maps the UFs to their states' names, unaccented as WeatherAPI
+// spells its regions
+var stateNames = map[string]string{
+	"AC": "Acre",
+	"AL": "Alagoas",
+	"AM": "Amazonas",
+	"AP": "Amapa",
+	"BA": "Bahia",
+	"CE": "Ceara",
+	"DF": "Distrito Federal",
+	"ES": "Espirito Santo",
+	"GO": "Goias",
+	"MA": "Maranhao",
+	"MG": "Minas Gerais",
+	"MS": "Mato Grosso do Sul",
+	"MT": "Mato Grosso",
+	"PA": "Para",
+	"PB": "Paraiba",
+	"PE": "Pernambuco",
+	"PI": "Piaui",
+	"PR": "Parana",
+	"RJ": "Rio de Janeiro",
+	"RN": "Rio Grande do Norte",
+	"RO": "Rondonia",
+	"RR": "Roraima",
+	"RS": "Rio Grande do Sul",
+	"SC": "Santa Catarina",
+	"SE": "Sergipe",
+	"SP": "Sao Paulo",
+	"TO": "Tocantins",
+}
+
+// StateName is the name of the state with the UF, or "" for an unknown UF
+func StateName(uf string) string {
+	return stateNames[strings.ToUpper(strings.TrimSpace(uf))]
+}
@@ -1,7 +1,99 @@
 package models
 
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// DefaultPrecision is how many decimal places temperatures are answered with
+const DefaultPrecision = 2
+
 type Temperature struct {
 	TempC float64 `json:"temp_C"`
 	TempF float64 `json:"temp_F"`
 	TempK float64 `json:"temp_K"`
+	// Location is where the provider measured it, for providers reporting it
+	Location *ResolvedLocation `json:"location,omitempty"`
+	// Provider names the weather provider it was routed to
+	Provider string `json:"provider,omitempty"`
+}
+
+// FromCelsius converts a Celsius temperature to every unit
+func FromCelsius(tempC float64) Temperature {
+	return Temperature{TempC: tempC, TempF: tempC*1.8 + 32, TempK: tempC + 273.15}
+}
+
+// Rounded returns the temperature rounded to places decimal places
+func (t Temperature) Rounded(places int) Temperature {
+	return Temperature{
+		TempC:    Round(t.TempC, places),
+		TempF:    Round(t.TempF, places),
+		TempK:    Round(t.TempK, places),
+		Location: t.Location,
+		Provider: t.Provider,
+	}
+}
+
+// Round rounds half away from zero, so -1.005 and 1.005 round alike
+func Round(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
+
+// Unit is a temperature unit, named as in the response fields (temp_C)
+type Unit string
+
+const (
+	Celsius    Unit = "C"
+	Fahrenheit Unit = "F"
+	Kelvin     Unit = "K"
+)
+
+// AllUnits lists the units in response order
+var AllUnits = []Unit{Celsius, Fahrenheit, Kelvin}
+
+var ErrUnknownUnit = errors.New("unknown temperature unit")
+
+// unitNames maps the names accepted by ParseUnits, lowercased, to units
+var unitNames = map[string][]Unit{
+	"c":          {Celsius},
+	"celsius":    {Celsius},
+	"f":          {Fahrenheit},
+	"fahrenheit": {Fahrenheit},
+	"k":          {Kelvin},
+	"kelvin":     {Kelvin},
+	"all":        AllUnits,
+}
+
+// ParseUnits parses a comma-separated list of units, by name (celsius,
+// fahrenheit, kelvin), by letter (C, F, K) or as all. Each unit is listed once.
+func ParseUnits(raw string) ([]Unit, error) {
+	var units []Unit
+	seen := make(map[Unit]bool, len(AllUnits))
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		named, ok := unitNames[name]
+		if !ok {
+			return nil, ErrUnknownUnit
+		}
+		for _, unit := range named {
+			if !seen[unit] {
+				seen[unit] = true
+				units = append(units, unit)
+			}
+		}
+	}
+	if len(units) == 0 {
+		return nil, ErrUnknownUnit
+	}
+	return units, nil
+}
+
+// Field is the response field holding a temperature in the unit
+func (u Unit) Field() string {
+	return "temp_" + string(u)
 }
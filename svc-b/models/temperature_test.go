@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRound(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value    float64
+		places   int
+		expected float64
+	}{
+		{25.456, 2, 25.46},
+		{-1.236, 2, -1.24},
+		{-0.5, 0, -1},
+		{-12.34, 1, -12.3},
+		{298.15, 0, 298},
+		{77.82, 4, 77.82},
+	}
+
+	for _, tt := range tests {
+		if got := Round(tt.value, tt.places); got != tt.expected {
+			t.Errorf("Round(%v, %d) = %v, want %v", tt.value, tt.places, got, tt.expected)
+		}
+	}
+}
+
+func TestParseUnits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw         string
+		expected    []Unit
+		expectedErr error
+	}{
+		{"celsius", []Unit{Celsius}, nil},
+		{"Kelvin, fahrenheit", []Unit{Kelvin, Fahrenheit}, nil},
+		{"C,K", []Unit{Celsius, Kelvin}, nil},
+		{"all", AllUnits, nil},
+		{"celsius,all,c", AllUnits, nil},
+		{"rankine", nil, ErrUnknownUnit},
+		{" , ", nil, ErrUnknownUnit},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseUnits(tt.raw)
+		if !errors.Is(err, tt.expectedErr) || !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ParseUnits(%q) = %v, %v; want %v, %v", tt.raw, got, err, tt.expected, tt.expectedErr)
+		}
+	}
+}
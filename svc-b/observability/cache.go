@@ -0,0 +1,180 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"sort"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// CacheStats is the point-in-time size of a cache
+type CacheStats struct {
+	Entries int
+	Bytes   int64
+}
+
+// CacheInstruments holds the instruments shared by every cache backend. The
+// size gauges are observed from the caches registered with Observe.
+type CacheInstruments struct {
+	Requests    metric.Int64Counter
+	Evictions   metric.Int64Counter
+	Expirations metric.Int64Counter
+	HitAge      metric.Float64Histogram
+
+	mu      sync.Mutex
+	sources map[string]func() CacheStats
+	// lookups tallies each cache's hits and misses since startup, for
+	// Summary. Caches count them holding their own lock, so lookupsMu is
+	// never held while calling into a cache.
+	lookupsMu sync.Mutex
+	lookups   map[string]*cacheLookups
+}
+
+type cacheLookups struct {
+	hits, misses int64
+}
+
+// CacheSummary is a cache's size and hit ratio since startup, as served by
+// /internal/cache
+type CacheSummary struct {
+	Name     string  `json:"name"`
+	Entries  int     `json:"entries"`
+	Bytes    int64   `json:"bytes"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// NewCacheInstruments creates the declared cache instruments on the given meter
+func NewCacheInstruments(meter metric.Meter) (*CacheInstruments, error) {
+	instruments := &CacheInstruments{
+		sources: make(map[string]func() CacheStats),
+		lookups: make(map[string]*cacheLookups),
+	}
+
+	entries, err := meter.Int64ObservableGauge(CacheEntries.Name,
+		metric.WithDescription(CacheEntries.Description),
+		metric.WithUnit(CacheEntries.Unit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", CacheEntries.Name, err)
+	}
+
+	memory, err := meter.Int64ObservableGauge(CacheMemory.Name,
+		metric.WithDescription(CacheMemory.Description),
+		metric.WithUnit(CacheMemory.Unit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", CacheMemory.Name, err)
+	}
+
+	if instruments.Requests, err = meter.Int64Counter(CacheRequests.Name,
+		metric.WithDescription(CacheRequests.Description),
+		metric.WithUnit(CacheRequests.Unit),
+	); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", CacheRequests.Name, err)
+	}
+
+	if instruments.Evictions, err = meter.Int64Counter(CacheEvictions.Name,
+		metric.WithDescription(CacheEvictions.Description),
+		metric.WithUnit(CacheEvictions.Unit),
+	); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", CacheEvictions.Name, err)
+	}
+
+	if instruments.Expirations, err = meter.Int64Counter(CacheExpirations.Name,
+		metric.WithDescription(CacheExpirations.Description),
+		metric.WithUnit(CacheExpirations.Unit),
+	); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", CacheExpirations.Name, err)
+	}
+
+	if instruments.HitAge, err = meter.Float64Histogram(CacheHitAge.Name,
+		metric.WithDescription(CacheHitAge.Description),
+		metric.WithUnit(CacheHitAge.Unit),
+	); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", CacheHitAge.Name, err)
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		instruments.mu.Lock()
+		defer instruments.mu.Unlock()
+		for name, stats := range instruments.sources {
+			current := stats()
+			attrs := metric.WithAttributes(attribute.String("cache", name))
+			o.ObserveInt64(entries, int64(current.Entries), attrs)
+			o.ObserveInt64(memory, current.Bytes, attrs)
+		}
+		return nil
+	}, entries, memory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register cache size callback: %w", err)
+	}
+
+	return instruments, nil
+}
+
+// Observe reports the named cache's size through the entry and memory gauges
+func (c *CacheInstruments) Observe(name string, stats func() CacheStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sources[name] = stats
+}
+
+// CountLookup tallies a hit or miss of the named cache for Summary; the
+// requests counter is recorded separately, with the caller's attributes
+func (c *CacheInstruments) CountLookup(name string, hit bool) {
+	c.lookupsMu.Lock()
+	defer c.lookupsMu.Unlock()
+	lookups, ok := c.lookups[name]
+	if !ok {
+		lookups = &cacheLookups{}
+		c.lookups[name] = lookups
+	}
+	if hit {
+		lookups.hits++
+	} else {
+		lookups.misses++
+	}
+}
+
+// Summary reports every observed cache's size and hit ratio, ordered by name
+func (c *CacheInstruments) Summary() []CacheSummary {
+	c.mu.Lock()
+	sources := maps.Clone(c.sources)
+	c.mu.Unlock()
+
+	summaries := make([]CacheSummary, 0, len(sources))
+	for name, stats := range sources {
+		current := stats()
+		summary := CacheSummary{Name: name, Entries: current.Entries, Bytes: current.Bytes}
+		c.lookupsMu.Lock()
+		if lookups, ok := c.lookups[name]; ok {
+			summary.Hits, summary.Misses = lookups.hits, lookups.misses
+			if total := lookups.hits + lookups.misses; total > 0 {
+				summary.HitRatio = float64(lookups.hits) / float64(total)
+			}
+		}
+		c.lookupsMu.Unlock()
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries
+}
+
+// Handler serves Summary as JSON on /internal/cache
+func (c *CacheInstruments) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(struct {
+			Caches []CacheSummary `json:"caches"`
+		}{c.Summary()})
+	}
+}
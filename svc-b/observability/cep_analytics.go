@@ -0,0 +1,173 @@
+package observability
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"svc-b/clock"
+	"sync"
+	"time"
+)
+
+// analyticsBucket is the span of time CEP lookups are counted in
+const analyticsBucket = time.Hour
+
+var ErrInvalidAnalyticsWindow = errors.New("invalid analytics window")
+
+// CEPLookupCount is the number of lookups of a UF or city in a window
+type CEPLookupCount struct {
+	Name    string           `json:"name"`
+	Lookups int              `json:"lookups"`
+	Cities  []CEPLookupCount `json:"cities,omitempty"`
+}
+
+// CEPAnalyticsSummary summarizes the lookups of a window by UF, then city
+type CEPAnalyticsSummary struct {
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Lookups int              `json:"lookups"`
+	UFs     []CEPLookupCount `json:"ufs"`
+}
+
+// cepBucket counts the lookups of an hour, by UF then city
+type cepBucket struct {
+	start  time.Time
+	counts map[string]map[string]int
+}
+
+// CEPAnalytics counts successful CEP lookups by UF and city in hourly
+// buckets, keeping the last retention hours in memory, so regional usage can
+// be read without an analytics pipeline. Counts start over on restart.
+type CEPAnalytics struct {
+	mu    sync.Mutex
+	clock clock.Clock
+	// buckets is a ring indexed by the hour since the epoch
+	buckets []cepBucket
+}
+
+// NewCEPAnalytics keeps counts for retention, rounded up to whole hours
+func NewCEPAnalytics(retention time.Duration, clk clock.Clock) *CEPAnalytics {
+	hours := int((retention + analyticsBucket - 1) / analyticsBucket)
+	return &CEPAnalytics{clock: clk, buckets: make([]cepBucket, max(hours, 1))}
+}
+
+// bucket returns the bucket of the hour starting at start, resetting it when
+// it still holds an older hour
+func (a *CEPAnalytics) bucket(start time.Time) *cepBucket {
+	b := &a.buckets[int(start.Unix()/int64(analyticsBucket.Seconds()))%len(a.buckets)]
+	if !b.start.Equal(start) {
+		*b = cepBucket{start: start, counts: make(map[string]map[string]int)}
+	}
+	return b
+}
+
+// Record counts a lookup. A nil CEPAnalytics records nothing.
+func (a *CEPAnalytics) Record(uf, city string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	b := a.bucket(a.clock.Now().UTC().Truncate(analyticsBucket))
+	if b.counts[uf] == nil {
+		b.counts[uf] = make(map[string]int)
+	}
+	b.counts[uf][city]++
+}
+
+// Retention is how far back counts are kept
+func (a *CEPAnalytics) Retention() time.Duration {
+	return time.Duration(len(a.buckets)) * analyticsBucket
+}
+
+// Summary adds up the lookups of the window ending now, in whole hours
+// including the current one, listing the top cities of each UF
+func (a *CEPAnalytics) Summary(window time.Duration, topCities int) CEPAnalyticsSummary {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clock.Now().UTC()
+	hours := min(int((window+analyticsBucket-1)/analyticsBucket), len(a.buckets))
+	summary := CEPAnalyticsSummary{
+		From: now.Truncate(analyticsBucket).Add(-time.Duration(hours-1) * analyticsBucket),
+		To:   now,
+		UFs:  []CEPLookupCount{},
+	}
+
+	totals := make(map[string]map[string]int)
+	for start := summary.From; !start.After(now); start = start.Add(analyticsBucket) {
+		for uf, cities := range a.bucket(start).counts {
+			if totals[uf] == nil {
+				totals[uf] = make(map[string]int)
+			}
+			for city, count := range cities {
+				totals[uf][city] += count
+			}
+		}
+	}
+
+	for uf, cities := range totals {
+		count := CEPLookupCount{Name: uf}
+		for city, lookups := range cities {
+			count.Lookups += lookups
+			count.Cities = append(count.Cities, CEPLookupCount{Name: city, Lookups: lookups})
+		}
+		sortCounts(count.Cities)
+		if topCities > 0 && len(count.Cities) > topCities {
+			count.Cities = count.Cities[:topCities]
+		}
+		summary.Lookups += count.Lookups
+		summary.UFs = append(summary.UFs, count)
+	}
+	sortCounts(summary.UFs)
+	return summary
+}
+
+// sortCounts orders counts by lookups, most first, then by name
+func sortCounts(counts []CEPLookupCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Lookups != counts[j].Lookups {
+			return counts[i].Lookups > counts[j].Lookups
+		}
+		return counts[i].Name < counts[j].Name
+	})
+}
+
+// Handler serves the summary of ?window= (a duration, default 24h, up to the
+// retention), listing the ?top= cities of each UF (default 10, 0 for all)
+func (a *CEPAnalytics) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		window, top, err := a.parseQuery(r)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.Summary(window, top))
+	}
+}
+
+func (a *CEPAnalytics) parseQuery(r *http.Request) (time.Duration, int, error) {
+	window, top := 24*time.Hour, 10
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 || parsed > a.Retention() {
+			return 0, 0, fmt.Errorf("%w: %q, want a positive duration up to %s", ErrInvalidAnalyticsWindow, raw, a.Retention())
+		}
+		window = parsed
+	}
+	if raw := r.URL.Query().Get("top"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("invalid top %q: want a count", raw)
+		}
+		top = parsed
+	}
+	return window, top, nil
+}
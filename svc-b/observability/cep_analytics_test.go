@@ -0,0 +1,84 @@
+package observability
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"svc-b/clock"
+	"testing"
+	"time"
+)
+
+func TestCEPAnalytics(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC))
+	analytics := NewCEPAnalytics(3*time.Hour, fake)
+
+	analytics.Record("SP", "Campinas")
+	fake.Advance(time.Hour)
+	analytics.Record("SP", "São Paulo")
+	analytics.Record("SP", "São Paulo")
+	analytics.Record("PE", "Recife")
+	fake.Advance(time.Hour)
+	analytics.Record("SP", "Campinas")
+
+	summary := analytics.Summary(2*time.Hour, 1)
+	expected := []CEPLookupCount{
+		{Name: "SP", Lookups: 3, Cities: []CEPLookupCount{{Name: "São Paulo", Lookups: 2}}},
+		{Name: "PE", Lookups: 1, Cities: []CEPLookupCount{{Name: "Recife", Lookups: 1}}},
+	}
+	if summary.Lookups != 4 || !reflect.DeepEqual(summary.UFs, expected) {
+		t.Errorf("Summary(2h) = %+v, want %+v", summary, expected)
+	}
+	if !summary.From.Equal(time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("Summary(2h).From = %v, want the start of the previous hour", summary.From)
+	}
+
+	// The oldest hour falls out of the retention as time goes on
+	if got := analytics.Summary(3*time.Hour, 0).Lookups; got != 5 {
+		t.Errorf("Summary(3h).Lookups = %d, want 5", got)
+	}
+	fake.Advance(time.Hour)
+	if got := analytics.Summary(3*time.Hour, 0).Lookups; got != 4 {
+		t.Errorf("Summary(3h).Lookups an hour later = %d, want 4", got)
+	}
+}
+
+func TestCEPAnalyticsHandler(t *testing.T) {
+	t.Parallel()
+
+	analytics := NewCEPAnalytics(24*time.Hour, clock.Real{})
+	analytics.Record("RJ", "Niterói")
+
+	tests := []struct {
+		query        string
+		expectedCode int
+	}{
+		{"", http.StatusOK},
+		{"?window=1h&top=0", http.StatusOK},
+		{"?window=48h", http.StatusBadRequest},
+		{"?window=week", http.StatusBadRequest},
+		{"?top=-1", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			analytics.Handler()(rec, httptest.NewRequest(http.MethodGet, "/internal/analytics/ceps"+tt.query, nil))
+			if rec.Code != tt.expectedCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.expectedCode, rec.Body.String())
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var summary CEPAnalyticsSummary
+			if err := json.NewDecoder(rec.Body).Decode(&summary); err != nil || summary.Lookups != 1 || summary.UFs[0].Name != "RJ" {
+				t.Errorf("summary = %+v, %v; want the RJ lookup", summary, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package observability
+
+import (
+	"net/http"
+	"pkg/telemetry"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewClientTransport wraps next so every outbound request gets an HTTP client
+// span following the semantic conventions: http.method, http.url,
+// http.status_code and net.peer.name. http.url is sanitized with
+// telemetry.SanitizeURL, so API keys never reach the span. Propagation is
+// left to a PropagationTransport inside next, which sees the client span as
+// the request's parent.
+func NewClientTransport(next http.RoundTripper, providers Providers) http.RoundTripper {
+	return otelhttp.NewTransport(sanitizingTransport{next: next},
+		otelhttp.WithTracerProvider(providers.Tracers()),
+		otelhttp.WithMeterProvider(providers.Meters()),
+		otelhttp.WithPropagators(propagation.NewCompositeTextMapPropagator()),
+	)
+}
+
+// sanitizingTransport replaces the http.url otelhttp set on the client span
+// with one without the secrets, before the request leaves
+type sanitizingTransport struct {
+	next http.RoundTripper
+}
+
+func (t sanitizingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	raw := req.URL.String()
+	if sanitized := telemetry.SanitizeURL(raw); sanitized != raw {
+		trace.SpanFromContext(req.Context()).SetAttributes(attribute.String(string(semconv.HTTPURLKey), sanitized))
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,96 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"pkg/telemetry/telemetrytest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestClientTransport(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		path        string
+		status      int
+		expectedURL string
+	}{
+		{"API key redacted", "/v1/current.json?q=Recife&key=super-secret-key", http.StatusOK, "/v1/current.json?key=REDACTED&q=Recife"},
+		{"OpenWeatherMap key redacted", "/data/2.5/weather?appid=super-secret-key&q=Recife", http.StatusUnauthorized, "/data/2.5/weather?appid=REDACTED&q=Recife"},
+		{"Keyless URL kept", "/ws/01001000/json/", http.StatusOK, "/ws/01001000/json/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			received := make(chan http.Header, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received <- r.Header
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			recorder := tracetest.NewSpanRecorder()
+			providers := Providers{TracerProvider: telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))}
+			propagator := propagation.TraceContext{}
+			client := &http.Client{Transport: NewClientTransport(
+				NewPropagationTransport(http.DefaultTransport, PropagationPolicy{InternalHosts: []string{"127.0.0.1"}}, propagator),
+				providers,
+			)}
+
+			ctx, parent := providers.Tracer("test").Start(context.Background(), "WeatherAPI.GetTemperature")
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+tt.path, nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+			parent.End()
+
+			spans := recorder.Ended()
+			if len(spans) != 2 || spans[0].SpanKind() != trace.SpanKindClient {
+				t.Fatalf("recorded %d spans, want a client span and its parent", len(spans))
+			}
+			span := spans[0]
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Errorf("client span parent = %s, want %s", span.Parent().SpanID(), parent.SpanContext().SpanID())
+			}
+
+			attrs := make(map[attribute.Key]attribute.Value)
+			for _, attr := range span.Attributes() {
+				attrs[attr.Key] = attr.Value
+				if strings.Contains(attr.Value.Emit(), "super-secret-key") {
+					t.Errorf("attribute %s leaks the API key: %s", attr.Key, attr.Value.Emit())
+				}
+			}
+			expected := map[attribute.Key]string{
+				"http.method":      http.MethodGet,
+				"http.url":         server.URL + tt.expectedURL,
+				"http.status_code": attribute.IntValue(tt.status).Emit(),
+				"net.peer.name":    "127.0.0.1",
+			}
+			for key, value := range expected {
+				if got := attrs[key].Emit(); got != value {
+					t.Errorf("%s = %q, want %q", key, got, value)
+				}
+			}
+
+			// The propagation transport injects the client span as the parent
+			carrier := propagation.HeaderCarrier(<-received)
+			remote := trace.SpanContextFromContext(propagator.Extract(context.Background(), carrier))
+			if remote.SpanID() != span.SpanContext().SpanID() {
+				t.Errorf("propagated span = %s, want the client span %s", remote.SpanID(), span.SpanContext().SpanID())
+			}
+		})
+	}
+}
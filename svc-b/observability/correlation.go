@@ -0,0 +1,172 @@
+package observability
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptrace"
+	"svc-b/clock"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CorrelationHeader carries the token identifying an outbound request to a
+// provider, so its support can find the request on their side
+const CorrelationHeader = "X-Correlation-Token"
+
+// CorrelationAttribute is the span attribute carrying the token
+const CorrelationAttribute = "upstream.correlation_token"
+
+// CorrelationRecord is the evidence kept about a tagged provider request: what
+// was sent, when, from which address, and the trace it belongs to
+type CorrelationRecord struct {
+	Token    string `json:"token"`
+	TraceID  string `json:"trace_id"`
+	SpanID   string `json:"span_id"`
+	Provider string `json:"provider"`
+	Method   string `json:"method"`
+	Host     string `json:"host"`
+	// Path leaves out the query, which carries the API key
+	Path       string    `json:"path"`
+	SentAt     time.Time `json:"sent_at"`
+	DurationMS float64   `json:"duration_ms"`
+	// SourceAddr and RemoteAddr are the local and provider ends of the
+	// connection the request went out on
+	SourceAddr string `json:"source_addr,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Correlations keeps the token to trace mapping of tagged provider requests
+// for a while, for support tickets with the provider. Records expire after
+// the TTL and the oldest are dropped beyond maxEntries.
+type Correlations struct {
+	mu         sync.Mutex
+	clock      clock.Clock
+	ttl        time.Duration
+	maxEntries int
+	byToken    map[string]CorrelationRecord
+	// order holds the tokens oldest first
+	order []string
+}
+
+func NewCorrelations(ttl time.Duration, maxEntries int, clk clock.Clock) *Correlations {
+	return &Correlations{clock: clk, ttl: ttl, maxEntries: maxEntries, byToken: make(map[string]CorrelationRecord)}
+}
+
+func (c *Correlations) add(record CorrelationRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.byToken[record.Token] = record
+	c.order = append(c.order, record.Token)
+	c.expire()
+}
+
+// expire drops expired records and the oldest beyond maxEntries; the caller
+// holds the lock
+func (c *Correlations) expire() {
+	cutoff := c.clock.Now().Add(-c.ttl)
+	drop := 0
+	for drop < len(c.order) {
+		record := c.byToken[c.order[drop]]
+		if len(c.order)-drop <= c.maxEntries && record.SentAt.After(cutoff) {
+			break
+		}
+		delete(c.byToken, c.order[drop])
+		drop++
+	}
+	c.order = c.order[drop:]
+}
+
+// Lookup returns the record for token
+func (c *Correlations) Lookup(token string) (CorrelationRecord, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire()
+	record, ok := c.byToken[token]
+	return record, ok
+}
+
+// ByTrace returns the records of a trace, oldest first
+func (c *Correlations) ByTrace(traceID string) []CorrelationRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire()
+	records := []CorrelationRecord{}
+	for _, token := range c.order {
+		if record := c.byToken[token]; record.TraceID == traceID {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// correlationTransport tags the requests to some providers with a token and
+// records them
+type correlationTransport struct {
+	next         http.RoundTripper
+	correlations *Correlations
+	providers    map[string]string
+}
+
+// Transport wraps next so requests to the hosts in providers, mapped to their
+// provider label, carry CorrelationHeader and are recorded. Other requests
+// pass through untouched.
+func (c *Correlations) Transport(next http.RoundTripper, providers map[string]string) http.RoundTripper {
+	return &correlationTransport{next: next, correlations: c, providers: providers}
+}
+
+func (t *correlationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	provider, ok := t.providers[req.URL.Hostname()]
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	spanCtx := trace.SpanContextFromContext(ctx)
+	record := CorrelationRecord{
+		Token:    newCorrelationToken(),
+		TraceID:  spanCtx.TraceID().String(),
+		SpanID:   spanCtx.SpanID().String(),
+		Provider: provider,
+		Method:   req.Method,
+		Host:     req.URL.Host,
+		Path:     req.URL.Path,
+		SentAt:   t.correlations.clock.Now().UTC(),
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String(CorrelationAttribute, record.Token))
+
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			record.SourceAddr = info.Conn.LocalAddr().String()
+			record.RemoteAddr = info.Conn.RemoteAddr().String()
+		},
+	}))
+	req.Header.Set(CorrelationHeader, record.Token)
+
+	resp, err := t.next.RoundTrip(req)
+	record.DurationMS = float64(t.correlations.clock.Now().Sub(record.SentAt).Microseconds()) / 1000
+	if err != nil {
+		record.Error = err.Error()
+	} else {
+		record.StatusCode = resp.StatusCode
+	}
+	t.correlations.add(record)
+	return resp, err
+}
+
+// newCorrelationToken returns a random token, unrelated to the trace so the
+// provider learns nothing about it
+func newCorrelationToken() string {
+	var token [12]byte
+	rand.Read(token[:])
+	return hex.EncodeToString(token[:])
+}
@@ -0,0 +1,71 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"pkg/telemetry/telemetrytest"
+	"svc-b/clock"
+	"testing"
+	"time"
+)
+
+func TestCorrelationTransport(t *testing.T) {
+	t.Parallel()
+
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get(CorrelationHeader))
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+	host, _ := url.Parse(server.URL)
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	correlations := NewCorrelations(time.Hour, 2, fake)
+	client := &http.Client{Transport: correlations.Transport(http.DefaultTransport, map[string]string{host.Hostname(): "weatherapi"})}
+
+	ctx, span := telemetrytest.NewTracerProvider(t).Tracer("test").Start(context.Background(), "WeatherAPI.GetTemperature")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v1/current.json?key=secret&q=Recife", nil)
+	resp, err := client.Do(req)
+	span.End()
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(received) != 1 || received[0] == "" {
+		t.Fatalf("provider received tokens %q, want one", received)
+	}
+	if req.Header.Get(CorrelationHeader) != "" {
+		t.Error("transport modified the caller's request")
+	}
+
+	record, ok := correlations.Lookup(received[0])
+	if !ok {
+		t.Fatal("Lookup() found no record for the token sent")
+	}
+	if record.TraceID != span.SpanContext().TraceID().String() || record.Provider != "weatherapi" ||
+		record.Path != "/v1/current.json" || record.StatusCode != http.StatusTeapot || record.SourceAddr == "" {
+		t.Errorf("record = %+v, want the trace, provider, path without query, status and source address", record)
+	}
+	if got := correlations.ByTrace(record.TraceID); len(got) != 1 || got[0].Token != record.Token {
+		t.Errorf("ByTrace() = %+v, want the record", got)
+	}
+
+	// Records expire after the TTL, and the oldest go beyond maxEntries
+	fake.Advance(time.Hour)
+	if _, ok := correlations.Lookup(record.Token); ok {
+		t.Error("Lookup() after the TTL found the record")
+	}
+	for _, token := range []string{"a", "b", "c"} {
+		correlations.add(CorrelationRecord{Token: token, SentAt: fake.Now()})
+	}
+	if _, ok := correlations.Lookup("a"); ok {
+		t.Error("the oldest record was kept beyond maxEntries")
+	}
+	if _, ok := correlations.Lookup("c"); !ok {
+		t.Error("the newest record was dropped")
+	}
+}
@@ -0,0 +1,194 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CriticalPathAttribute is the server span attribute naming the component that
+// took the most time, e.g. critical_path=weather_api
+const CriticalPathAttribute = "critical_path"
+
+// Critical path components
+const (
+	ComponentCEPAPI     = "cep_api"
+	ComponentWeatherAPI = "weather_api"
+	ComponentEncode     = "encode"
+)
+
+// criticalPathComponents maps the spans that count towards a component
+var criticalPathComponents = map[string]string{
+	SpanViaCEPGetCityByCEP.Name:           ComponentCEPAPI,
+	SpanBrasilAPIGetCityByCEP.Name:        ComponentCEPAPI,
+	SpanOpenCEPGetCityByCEP.Name:          ComponentCEPAPI,
+	SpanSandboxGetCityByCEP.Name:          ComponentCEPAPI,
+	SpanWeatherAPIGetTemperature.Name:     ComponentWeatherAPI,
+	SpanWeatherAPIGetForecast.Name:        ComponentWeatherAPI,
+	SpanOpenWeatherMapGetTemperature.Name: ComponentWeatherAPI,
+	SpanSandboxGetTemperature.Name:        ComponentWeatherAPI,
+	SpanIoTGetTemperature.Name:            ComponentWeatherAPI,
+	SpanEncodeResponse.Name:               ComponentEncode,
+}
+
+// stageMetrics maps each component to the histogram of its pipeline stage
+var stageMetrics = map[string]MetricDefinition{
+	ComponentCEPAPI:     StageCEPResolution,
+	ComponentWeatherAPI: StageWeatherFetch,
+	ComponentEncode:     StageRender,
+}
+
+// CriticalPath is a span processor that adds up, per request, the time spent
+// in each component's spans, so its middleware can name the dominant one on
+// the server span before it ends. Aggregating on the attribute answers "what's
+// slow" without reading traces one by one.
+type CriticalPath struct {
+	mu sync.Mutex
+	// requests holds the time per component of every request in flight, keyed
+	// by its server span
+	requests map[trace.SpanID]map[string]time.Duration
+	// owners maps the spans started under a request to its server span
+	owners map[trace.SpanID]trace.SpanID
+	// stages holds the stage histograms per component, once RecordStages is called
+	stages map[string]metric.Float64Histogram
+}
+
+var _ sdktrace.SpanProcessor = (*CriticalPath)(nil)
+
+func NewCriticalPath() *CriticalPath {
+	return &CriticalPath{
+		requests: make(map[trace.SpanID]map[string]time.Duration),
+		owners:   make(map[trace.SpanID]trace.SpanID),
+	}
+}
+
+// RecordStages makes the middleware also record the time each request spent
+// in every component it reached on that component's stage histogram, by
+// route. It must be called before serving.
+func (c *CriticalPath) RecordStages(meter metric.Meter) error {
+	stages := make(map[string]metric.Float64Histogram, len(stageMetrics))
+	for component, definition := range stageMetrics {
+		histogram, err := meter.Float64Histogram(definition.Name,
+			metric.WithDescription(definition.Description),
+			metric.WithUnit(definition.Unit),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", definition.Name, err)
+		}
+		stages[component] = histogram
+	}
+	c.stages = stages
+	return nil
+}
+
+// Middleware annotates the server span with the request's critical path. It
+// must run inside the middleware that starts the server span.
+func (c *CriticalPath) Middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span := trace.SpanFromContext(r.Context())
+			root := span.SpanContext().SpanID()
+			if !root.IsValid() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			c.begin(root)
+			next.ServeHTTP(w, r)
+			durations := c.end(root)
+			if component, ok := dominantComponent(durations); ok {
+				span.SetAttributes(
+					attribute.String(CriticalPathAttribute, component),
+					attribute.Float64(CriticalPathAttribute+".duration_ms", milliseconds(durations[component])),
+				)
+			}
+			if c.stages != nil {
+				route := metric.WithAttributes(attribute.String("route", routeTemplate(r)))
+				for component, d := range durations {
+					c.stages[component].Record(r.Context(), milliseconds(d), route)
+				}
+			}
+		})
+	}
+}
+
+func (c *CriticalPath) begin(root trace.SpanID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests[root] = make(map[string]time.Duration)
+	c.owners[root] = root
+}
+
+// end stops tracking the request and returns the time spent per component
+func (c *CriticalPath) end(root trace.SpanID) map[string]time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	durations := c.requests[root]
+	delete(c.requests, root)
+	delete(c.owners, root)
+	return durations
+}
+
+// dominantComponent returns the component that took the most time, if any component
+// span ended under the request. Ties go to the first component by name.
+func dominantComponent(durations map[string]time.Duration) (string, bool) {
+	components := make([]string, 0, len(durations))
+	for component := range durations {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+
+	var dominant string
+	for _, component := range components {
+		if dominant == "" || durations[component] > durations[dominant] {
+			dominant = component
+		}
+	}
+	return dominant, dominant != ""
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// OnStart ties spans started under a tracked request to its server span
+func (c *CriticalPath) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	parentID := s.Parent().SpanID()
+	if !parentID.IsValid() || s.Parent().IsRemote() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if root, ok := c.owners[parentID]; ok {
+		c.owners[s.SpanContext().SpanID()] = root
+	}
+}
+
+// OnEnd adds a component span's duration to its request
+func (c *CriticalPath) OnEnd(s sdktrace.ReadOnlySpan) {
+	id := s.SpanContext().SpanID()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	root, ok := c.owners[id]
+	if !ok || root == id {
+		return
+	}
+	delete(c.owners, id)
+	if component, ok := criticalPathComponents[s.Name()]; ok {
+		if durations, ok := c.requests[root]; ok {
+			durations[component] += s.EndTime().Sub(s.StartTime())
+		}
+	}
+}
+
+func (c *CriticalPath) Shutdown(context.Context) error   { return nil }
+func (c *CriticalPath) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,144 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"pkg/telemetry/telemetrytest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCriticalPath(t *testing.T) {
+	t.Parallel()
+
+	// span is a child span the handler starts, taking d under its parent
+	type span struct {
+		name   string
+		d      time.Duration
+		nested bool
+	}
+
+	tests := []struct {
+		name     string
+		spans    []span
+		expected string
+		// stages are the stage histogram sums, in milliseconds
+		stages map[string]float64
+	}{
+		{"Weather dominates", []span{
+			{SpanViaCEPGetCityByCEP.Name, 20 * time.Millisecond, false},
+			{SpanWeatherAPIGetTemperature.Name, 80 * time.Millisecond, false},
+			{SpanEncodeResponse.Name, time.Millisecond, false},
+		}, ComponentWeatherAPI, map[string]float64{
+			StageCEPResolution.Name: 20, StageWeatherFetch.Name: 80, StageRender.Name: 1,
+		}},
+		{"Nested component spans count", []span{
+			{SpanViaCEPGetCityByCEP.Name, 90 * time.Millisecond, true},
+			{SpanWeatherAPIGetTemperature.Name, 30 * time.Millisecond, true},
+		}, ComponentCEPAPI, map[string]float64{
+			StageCEPResolution.Name: 90, StageWeatherFetch.Name: 30,
+		}},
+		{"Retried calls add up", []span{
+			{SpanWeatherAPIGetTemperature.Name, 30 * time.Millisecond, false},
+			{SpanViaCEPGetCityByCEP.Name, 50 * time.Millisecond, false},
+			{SpanWeatherAPIGetTemperature.Name, 30 * time.Millisecond, false},
+		}, ComponentWeatherAPI, map[string]float64{
+			StageCEPResolution.Name: 50, StageWeatherFetch.Name: 60,
+		}},
+		{"Other spans are ignored", []span{
+			{SpanProcessWeatherRequest.Name, time.Second, false},
+		}, "", map[string]float64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			criticalPath := NewCriticalPath()
+			reader := sdkmetric.NewManualReader()
+			if err := criticalPath.RecordStages(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")); err != nil {
+				t.Fatalf("failed to create stage instruments: %v", err)
+			}
+			exporter := tracetest.NewInMemoryExporter()
+			provider := telemetrytest.NewTracerProvider(t,
+				sdktrace.WithSpanProcessor(criticalPath),
+				sdktrace.WithSyncer(exporter),
+			)
+			tracer := provider.Tracer("test")
+
+			r := mux.NewRouter()
+			r.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					ctx, server := tracer.Start(r.Context(), "server", trace.WithSpanKind(trace.SpanKindServer))
+					defer server.End()
+					next.ServeHTTP(w, r.WithContext(ctx))
+				})
+			})
+			r.Use(criticalPath.Middleware())
+			r.HandleFunc("/weather/{cep}", func(w http.ResponseWriter, r *http.Request) {
+				ctx := r.Context()
+				if tt.spans[0].nested {
+					var parent trace.Span
+					ctx, parent = tracer.Start(ctx, SpanProcessWeatherRequest.Name)
+					defer parent.End()
+				}
+				start := time.Now()
+				for _, s := range tt.spans {
+					_, child := tracer.Start(ctx, s.name, trace.WithTimestamp(start))
+					start = start.Add(s.d)
+					child.End(trace.WithTimestamp(start))
+				}
+			})
+
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/weather/01001000", nil))
+
+			var got string
+			for _, s := range exporter.GetSpans() {
+				if s.Name != "server" {
+					continue
+				}
+				for _, attr := range s.Attributes {
+					if attr.Key == attribute.Key(CriticalPathAttribute) {
+						got = attr.Value.AsString()
+					}
+				}
+			}
+			if got != tt.expected {
+				t.Errorf("%s = %q, want %q", CriticalPathAttribute, got, tt.expected)
+			}
+
+			var rm metricdata.ResourceMetrics
+			if err := reader.Collect(context.Background(), &rm); err != nil {
+				t.Fatalf("failed to collect metrics: %v", err)
+			}
+			stages := make(map[string]float64)
+			for _, scope := range rm.ScopeMetrics {
+				for _, m := range scope.Metrics {
+					point := m.Data.(metricdata.Histogram[float64]).DataPoints[0]
+					if route, _ := point.Attributes.Value("route"); route.AsString() != "/weather/{cep}" {
+						t.Errorf("%s route = %q, want the route template", m.Name, route.AsString())
+					}
+					stages[m.Name] = point.Sum
+				}
+			}
+			if !reflect.DeepEqual(stages, tt.stages) {
+				t.Errorf("stage durations = %v, want %v", stages, tt.stages)
+			}
+
+			if len(criticalPath.requests) != 0 || len(criticalPath.owners) != 0 {
+				t.Errorf("tracked %d requests and %d spans after the request, want none",
+					len(criticalPath.requests), len(criticalPath.owners))
+			}
+		})
+	}
+}
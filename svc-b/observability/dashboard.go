@@ -0,0 +1,210 @@
+package observability
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Grafana dashboard model, limited to the fields the generator fills in
+type grafanaDashboard struct {
+	UID           string            `json:"uid"`
+	Title         string            `json:"title"`
+	Tags          []string          `json:"tags"`
+	SchemaVersion int               `json:"schemaVersion"`
+	Time          grafanaTimeRange  `json:"time"`
+	Templating    grafanaTemplating `json:"templating"`
+	Panels        []grafanaPanel    `json:"panels"`
+}
+
+type grafanaTimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type grafanaTemplating struct {
+	List []grafanaVariable `json:"list"`
+}
+
+type grafanaVariable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+type grafanaPanel struct {
+	ID          int                `json:"id"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	Type        string             `json:"type"`
+	Datasource  grafanaDatasource  `json:"datasource"`
+	GridPos     grafanaGridPos     `json:"gridPos"`
+	FieldConfig grafanaFieldConfig `json:"fieldConfig"`
+	Targets     []grafanaTarget    `json:"targets"`
+}
+
+type grafanaDatasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaFieldConfig struct {
+	Defaults grafanaFieldDefaults `json:"defaults"`
+}
+
+type grafanaFieldDefaults struct {
+	Unit string `json:"unit"`
+}
+
+type grafanaTarget struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+}
+
+const (
+	panelHeight = 8
+	panelWidth  = 12
+)
+
+// histogramQuantiles are plotted for every histogram metric
+var histogramQuantiles = []struct {
+	value  string
+	legend string
+}{
+	{value: "0.5", legend: "p50"},
+	{value: "0.95", legend: "p95"},
+	{value: "0.99", legend: "p99"},
+}
+
+// grafanaUnits maps UCUM units to Grafana field units
+var grafanaUnits = map[string]string{
+	"ms": "ms",
+	"s":  "s",
+	"By": "bytes",
+	"1":  "percentunit",
+}
+
+// GrafanaDashboard renders a Grafana dashboard with one panel per declared
+// metric, querying the series names produced by the Prometheus exporter
+func GrafanaDashboard(service string, metrics []MetricDefinition) ([]byte, error) {
+	dashboard := grafanaDashboard{
+		UID:           service + "-generated",
+		Title:         service + " (generated)",
+		Tags:          []string{service, "generated"},
+		SchemaVersion: 39,
+		Time:          grafanaTimeRange{From: "now-1h", To: "now"},
+		Templating: grafanaTemplating{List: []grafanaVariable{{
+			Name:  "datasource",
+			Label: "Data source",
+			Type:  "datasource",
+			Query: "prometheus",
+		}}},
+	}
+
+	for i, def := range metrics {
+		panel, err := metricPanel(def)
+		if err != nil {
+			return nil, err
+		}
+		panel.ID = i + 1
+		panel.GridPos = grafanaGridPos{
+			H: panelHeight,
+			W: panelWidth,
+			X: (i % 2) * panelWidth,
+			Y: (i / 2) * panelHeight,
+		}
+		dashboard.Panels = append(dashboard.Panels, panel)
+	}
+
+	return json.MarshalIndent(dashboard, "", "  ")
+}
+
+func metricPanel(def MetricDefinition) (grafanaPanel, error) {
+	panel := grafanaPanel{
+		Title:       def.Name,
+		Description: def.Description,
+		Type:        "timeseries",
+		Datasource:  grafanaDatasource{Type: "prometheus", UID: "${datasource}"},
+	}
+
+	series := def.PrometheusName()
+	labels := strings.Join(def.Labels, ", ")
+	legend := legendFormat(def.Labels)
+
+	switch def.Kind {
+	case KindCounter:
+		panel.FieldConfig.Defaults.Unit = "ops"
+		if def.Unit == "{request}" {
+			panel.FieldConfig.Defaults.Unit = "reqps"
+		}
+		panel.Targets = []grafanaTarget{{
+			RefID:        "A",
+			Expr:         fmt.Sprintf("sum by (%s) (rate(%s[$__rate_interval]))", labels, series),
+			LegendFormat: legend,
+		}}
+	case KindHistogram:
+		panel.FieldConfig.Defaults.Unit = grafanaUnits[def.Unit]
+		bucketLabels := strings.Join(append([]string{"le"}, def.Labels...), ", ")
+		for i, quantile := range histogramQuantiles {
+			panel.Targets = append(panel.Targets, grafanaTarget{
+				RefID: string(rune('A' + i)),
+				Expr: fmt.Sprintf("histogram_quantile(%s, sum by (%s) (rate(%s_bucket[$__rate_interval])))",
+					quantile.value, bucketLabels, series),
+				LegendFormat: quantile.legend + " " + legend,
+			})
+		}
+	case KindGauge:
+		panel.FieldConfig.Defaults.Unit = grafanaUnits[def.Unit]
+		panel.Targets = []grafanaTarget{{
+			RefID:        "A",
+			Expr:         fmt.Sprintf("sum by (%s) (%s)", labels, series),
+			LegendFormat: legend,
+		}}
+	default:
+		return grafanaPanel{}, fmt.Errorf("unsupported instrument kind %q for %s", def.Kind, def.Name)
+	}
+
+	return panel, nil
+}
+
+func legendFormat(labels []string) string {
+	parts := make([]string, len(labels))
+	for i, label := range labels {
+		parts[i] = "{{" + label + "}}"
+	}
+	return strings.Join(parts, " ")
+}
+
+// DashboardHandler serves the generated Grafana dashboard for the declared metrics
+func DashboardHandler(service string) http.HandlerFunc {
+	// The metric definitions are static, so the dashboard is generated once on first use
+	var (
+		once      sync.Once
+		dashboard []byte
+		err       error
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			dashboard, err = GrafanaDashboard(service, Metrics)
+		})
+		if err != nil {
+			http.Error(w, `{"error":"failed to generate dashboard"}`, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(dashboard)
+	}
+}
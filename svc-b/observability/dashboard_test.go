@@ -0,0 +1,55 @@
+package observability
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGrafanaDashboardCoversDeclaredMetrics(t *testing.T) {
+	t.Parallel()
+
+	raw, err := GrafanaDashboard("svc-b", Metrics)
+	if err != nil {
+		t.Fatalf("failed to generate dashboard: %v", err)
+	}
+
+	var dashboard grafanaDashboard
+	if err := json.Unmarshal(raw, &dashboard); err != nil {
+		t.Fatalf("dashboard is not valid JSON: %v", err)
+	}
+
+	if len(dashboard.Panels) != len(Metrics) {
+		t.Fatalf("got %d panels, want one per metric (%d)", len(dashboard.Panels), len(Metrics))
+	}
+
+	for i, def := range Metrics {
+		panel := dashboard.Panels[i]
+		if panel.Title != def.Name {
+			t.Errorf("panel %d titled %q, want %q", i, panel.Title, def.Name)
+		}
+		for _, target := range panel.Targets {
+			if !strings.Contains(target.Expr, def.PrometheusName()) {
+				t.Errorf("panel %q queries %q, which doesn't reference %s", panel.Title, target.Expr, def.PrometheusName())
+			}
+		}
+	}
+}
+
+func TestPrometheusName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		def  MetricDefinition
+		want string
+	}{
+		{def: HTTPServerRequests, want: "svc_b_http_server_requests_total"},
+		{def: HTTPServerDuration, want: "svc_b_http_server_duration_milliseconds"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.def.PrometheusName(); got != tt.want {
+			t.Errorf("PrometheusName(%s) = %q, want %q", tt.def.Name, got, tt.want)
+		}
+	}
+}
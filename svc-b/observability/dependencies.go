@@ -0,0 +1,74 @@
+package observability
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Dependency states tracked from the event bus
+const (
+	DependencyHealthy  = "healthy"
+	DependencyOpen     = "breaker_open"
+	DependencyRejected = "credentials_rejected"
+)
+
+// DependencyStatus is the last known state of an upstream provider
+type DependencyStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	// Since is when the state was entered, unset while no event was seen
+	Since   *time.Time `json:"since,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+// DependencyHealth follows the providers' breaker and credential events, so
+// the state of every dependency can be read at once
+type DependencyHealth struct {
+	mu           sync.Mutex
+	dependencies map[string]DependencyStatus
+}
+
+// NewDependencyHealth tracks the named providers, healthy until an event says
+// otherwise, and any other source publishing provider events on bus
+func NewDependencyHealth(bus *EventBus, names ...string) *DependencyHealth {
+	h := &DependencyHealth{dependencies: make(map[string]DependencyStatus)}
+	for _, name := range names {
+		h.dependencies[name] = DependencyStatus{Name: name, State: DependencyHealthy}
+	}
+	bus.Subscribe(h.handle)
+	return h
+}
+
+func (h *DependencyHealth) handle(_ context.Context, event Event) {
+	var state string
+	switch event.Kind {
+	case EventBreakerOpened:
+		state = DependencyOpen
+	case EventBreakerClosed:
+		state = DependencyHealthy
+	case EventAPIKeyInvalid:
+		state = DependencyRejected
+	default:
+		return
+	}
+
+	since := event.Time
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dependencies[event.Source] = DependencyStatus{Name: event.Source, State: state, Since: &since, Message: event.Message}
+}
+
+// Snapshot returns the dependencies ordered by name
+func (h *DependencyHealth) Snapshot() []DependencyStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := make([]DependencyStatus, 0, len(h.dependencies))
+	for _, status := range h.dependencies {
+		snapshot = append(snapshot, status)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Name < snapshot[j].Name })
+	return snapshot
+}
@@ -0,0 +1,91 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// webhookTimeout bounds each notification to the ops webhook
+const webhookTimeout = 5 * time.Second
+
+// EventNotifier turns bus events into logs, the events counter and, when a
+// webhook is configured, notifications to the ops channel
+type EventNotifier struct {
+	service    string
+	events     metric.Int64Counter
+	client     *http.Client
+	webhookURL string
+}
+
+// NewEventNotifier creates the notifier; an empty webhookURL disables the webhook
+func NewEventNotifier(service string, meter metric.Meter, client *http.Client, webhookURL string) (*EventNotifier, error) {
+	events, err := meter.Int64Counter(Events.Name,
+		metric.WithDescription(Events.Description),
+		metric.WithUnit(Events.Unit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", Events.Name, err)
+	}
+	return &EventNotifier{service: service, events: events, client: client, webhookURL: webhookURL}, nil
+}
+
+// Handle is the EventHandler to subscribe to the bus
+func (n *EventNotifier) Handle(ctx context.Context, event Event) {
+	slog.InfoContext(ctx, "Evento operacional", "kind", event.Kind, "source", event.Source, "message", event.Message, "attributes", event.Attributes)
+	n.events.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("kind", string(event.Kind)),
+		attribute.String("source", event.Source),
+	))
+
+	if n.webhookURL != "" {
+		// Delivery outlives the request that triggered the event
+		go n.notify(context.WithoutCancel(ctx), event)
+	}
+}
+
+// webhookPayload is the body posted to the ops webhook
+type webhookPayload struct {
+	Service string `json:"service"`
+	Text    string `json:"text"`
+	Event   Event  `json:"event"`
+}
+
+func (n *EventNotifier) notify(ctx context.Context, event Event) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	body, err := json.Marshal(webhookPayload{
+		Service: n.service,
+		Text:    fmt.Sprintf("[%s] %s: %s", n.service, event.Kind, event.Message),
+		Event:   event,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Erro ao codificar evento", "kind", event.Kind, "error", err)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		slog.ErrorContext(ctx, "Erro ao criar notificação do evento", "kind", event.Kind, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "Erro ao notificar evento", "kind", event.Kind, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		slog.WarnContext(ctx, "Webhook recusou o evento", "kind", event.Kind, "status", resp.StatusCode)
+	}
+}
@@ -0,0 +1,75 @@
+package observability
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EventKind names a significant operational event
+type EventKind string
+
+const (
+	// EventBreakerOpened is published when a provider's circuit breaker trips
+	EventBreakerOpened EventKind = "breaker_opened"
+	// EventBreakerClosed is published when a tripped breaker recovers
+	EventBreakerClosed EventKind = "breaker_closed"
+	// EventAPIKeyInvalid is published when a provider rejects our credentials
+	EventAPIKeyInvalid EventKind = "api_key_invalid"
+	// EventCacheInvalidated is published when an operator invalidates a cache
+	EventCacheInvalidated EventKind = "cache_invalidated"
+	// EventMaintenanceChanged is published when an operator turns maintenance
+	// mode on or off
+	EventMaintenanceChanged EventKind = "maintenance_changed"
+)
+
+// Event is something operators should hear about, published by the component
+// that noticed it
+type Event struct {
+	Kind EventKind `json:"kind"`
+	// Source is the component publishing the event, e.g. weatherapi
+	Source     string            `json:"source"`
+	Message    string            `json:"message"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Time       time.Time         `json:"time"`
+}
+
+// EventHandler receives published events. It runs on the publisher's
+// goroutine, so slow work (e.g. network calls) must be handed off.
+type EventHandler func(ctx context.Context, event Event)
+
+// EventBus fans events out to its subscribers in process. A nil bus drops
+// every event, so components can publish unconditionally.
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers []EventHandler
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe registers a handler for every event published afterwards
+func (b *EventBus) Subscribe(handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish delivers the event to every subscriber, stamping its time if unset
+func (b *EventBus) Publish(ctx context.Context, event Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, handle := range handlers {
+		handle(ctx, event)
+	}
+}
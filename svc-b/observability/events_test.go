@@ -0,0 +1,69 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestEventBusFansOut(t *testing.T) {
+	t.Parallel()
+
+	bus := NewEventBus()
+	var got []EventKind
+	for range 2 {
+		bus.Subscribe(func(ctx context.Context, event Event) {
+			if event.Time.IsZero() {
+				t.Error("published event has no time")
+			}
+			got = append(got, event.Kind)
+		})
+	}
+
+	bus.Publish(context.Background(), Event{Kind: EventBreakerOpened, Source: "weatherapi"})
+	if len(got) != 2 || got[0] != EventBreakerOpened {
+		t.Errorf("subscribers received %v, want the event twice", got)
+	}
+
+	// A nil bus drops events so components can publish unconditionally
+	var nilBus *EventBus
+	nilBus.Publish(context.Background(), Event{Kind: EventBreakerOpened})
+}
+
+func TestEventNotifierWebhook(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan webhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode webhook payload: %v", err)
+		}
+		received <- payload
+	}))
+	defer server.Close()
+
+	notifier, err := NewEventNotifier("svc-b", noop.NewMeterProvider().Meter("test"), server.Client(), server.URL)
+	if err != nil {
+		t.Fatalf("failed to create notifier: %v", err)
+	}
+
+	notifier.Handle(context.Background(), Event{Kind: EventAPIKeyInvalid, Source: "weatherapi", Message: "API key is invalid."})
+
+	select {
+	case payload := <-received:
+		if payload.Service != "svc-b" || payload.Event.Kind != EventAPIKeyInvalid {
+			t.Errorf("webhook payload = %+v, want svc-b's api_key_invalid event", payload)
+		}
+		if payload.Text != "[svc-b] api_key_invalid: API key is invalid." {
+			t.Errorf("webhook text = %q", payload.Text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not notified")
+	}
+}
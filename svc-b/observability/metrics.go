@@ -0,0 +1,248 @@
+package observability
+
+import (
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// InstrumentKind identifies the OpenTelemetry instrument type of a metric
+type InstrumentKind string
+
+const (
+	KindCounter   InstrumentKind = "counter"
+	KindHistogram InstrumentKind = "histogram"
+	KindGauge     InstrumentKind = "gauge"
+)
+
+// MetricDefinition declares a metric emitted by svc-b. Instruments are created
+// from these definitions so dashboards generated from them can't drift.
+type MetricDefinition struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Unit        string         `json:"unit"`
+	Kind        InstrumentKind `json:"kind"`
+	Labels      []string       `json:"labels"`
+}
+
+var (
+	HTTPServerRequests = MetricDefinition{
+		Name:        "svc_b.http.server.requests",
+		Description: "Number of HTTP requests handled",
+		Unit:        "{request}",
+		Kind:        KindCounter,
+		Labels:      []string{"route", "method", "status_code", "outcome"},
+	}
+	HTTPServerDuration = MetricDefinition{
+		Name:        "svc_b.http.server.duration",
+		Description: "Duration of HTTP requests handled",
+		Unit:        "ms",
+		Kind:        KindHistogram,
+		Labels:      []string{"route", "method", "status_code", "outcome"},
+	}
+	HTTPServerSlowClients = MetricDefinition{
+		Name:        "svc_b.http.server.slow_clients",
+		Description: "Responses aborted because the client didn't read them in time",
+		Unit:        "{response}",
+		Kind:        KindCounter,
+		Labels:      []string{"reason"},
+	}
+	CacheRequests = MetricDefinition{
+		Name:        "svc_b.cache.requests",
+		Description: "Cache lookups, by whether a live entry was found",
+		Unit:        "{lookup}",
+		Kind:        KindCounter,
+		Labels:      []string{"cache", "result"},
+	}
+	CacheEntries = MetricDefinition{
+		Name:        "svc_b.cache.entries",
+		Description: "Entries currently held by each cache",
+		Unit:        "{entry}",
+		Kind:        KindGauge,
+		Labels:      []string{"cache"},
+	}
+	CacheMemory = MetricDefinition{
+		Name:        "svc_b.cache.memory",
+		Description: "Estimated memory held by each cache's entries",
+		Unit:        "By",
+		Kind:        KindGauge,
+		Labels:      []string{"cache"},
+	}
+	CacheEvictions = MetricDefinition{
+		Name:        "svc_b.cache.evictions",
+		Description: "Live entries evicted to make room for new ones",
+		Unit:        "{entry}",
+		Kind:        KindCounter,
+		Labels:      []string{"cache"},
+	}
+	CacheExpirations = MetricDefinition{
+		Name:        "svc_b.cache.expirations",
+		Description: "Entries removed after their TTL elapsed",
+		Unit:        "{entry}",
+		Kind:        KindCounter,
+		Labels:      []string{"cache"},
+	}
+	CacheHitAge = MetricDefinition{
+		Name:        "svc_b.cache.hit_age",
+		Description: "Age of cache entries when they are served",
+		Unit:        "s",
+		Kind:        KindHistogram,
+		Labels:      []string{"cache"},
+	}
+	UpstreamDuration = MetricDefinition{
+		Name:        "svc_b.upstream.duration",
+		Description: "Duration of calls to the upstream providers",
+		Unit:        "ms",
+		Kind:        KindHistogram,
+		Labels:      []string{"provider", "outcome"},
+	}
+	UpstreamErrors = MetricDefinition{
+		Name:        "svc_b.upstream.errors",
+		Description: "Failed calls to the upstream providers",
+		Unit:        "{call}",
+		Kind:        KindCounter,
+		Labels:      []string{"provider", "reason"},
+	}
+	// WeatherLookupDuration is recorded by the use case through a
+	// telemetry.Recorder rather than a declared instrument
+	WeatherLookupDuration = MetricDefinition{
+		Name:        "svc_b.weather.lookup.duration",
+		Description: "Duration of CEP lookups in the use case, providers and caches included",
+		Unit:        "ms",
+		Kind:        KindHistogram,
+		Labels:      []string{"resolve", "result"},
+	}
+	// WeatherProviderLookups is recorded by services.WeatherRouter through
+	// a telemetry.Recorder, per provider and the UF routed on
+	WeatherProviderLookups = MetricDefinition{
+		Name:        "svc_b.weather.provider.lookups",
+		Description: "Weather lookups sent to each provider, by the UF they were routed on",
+		Unit:        "{lookup}",
+		Kind:        KindCounter,
+		Labels:      []string{"provider", "uf", "result"},
+	}
+	// The stage durations are the time spent in each stage's spans, derived
+	// by CriticalPath at the end of each request that reached the stage
+	StageCEPResolution = MetricDefinition{
+		Name:        "svc_b.stage.cep_resolution.duration",
+		Description: "Time a request spent in the CEP providers' spans",
+		Unit:        "ms",
+		Kind:        KindHistogram,
+		Labels:      []string{"route"},
+	}
+	StageWeatherFetch = MetricDefinition{
+		Name:        "svc_b.stage.weather_fetch.duration",
+		Description: "Time a request spent in the weather providers' spans",
+		Unit:        "ms",
+		Kind:        KindHistogram,
+		Labels:      []string{"route"},
+	}
+	StageRender = MetricDefinition{
+		Name:        "svc_b.stage.render.duration",
+		Description: "Time a request spent encoding and writing its response",
+		Unit:        "ms",
+		Kind:        KindHistogram,
+		Labels:      []string{"route"},
+	}
+	// IoTReadings is recorded by services.IoTWeatherService through a
+	// telemetry.Recorder, per ingested sensor reading
+	IoTReadings = MetricDefinition{
+		Name:        "svc_b.iot.readings",
+		Description: "Sensor readings pushed to /ingest/temperature, by whether they were stored",
+		Unit:        "{reading}",
+		Kind:        KindCounter,
+		Labels:      []string{"result"},
+	}
+	Events = MetricDefinition{
+		Name:        "svc_b.events",
+		Description: "Operational events published on the event bus",
+		Unit:        "{event}",
+		Kind:        KindCounter,
+		Labels:      []string{"kind", "source"},
+	}
+)
+
+// Metrics lists every metric svc-b registers
+var Metrics = []MetricDefinition{
+	HTTPServerRequests,
+	HTTPServerDuration,
+	HTTPServerSlowClients,
+	CacheRequests,
+	CacheEntries,
+	CacheMemory,
+	CacheEvictions,
+	CacheExpirations,
+	CacheHitAge,
+	UpstreamDuration,
+	UpstreamErrors,
+	WeatherLookupDuration,
+	WeatherProviderLookups,
+	StageCEPResolution,
+	StageWeatherFetch,
+	StageRender,
+	IoTReadings,
+	Events,
+}
+
+// Instruments holds the created instruments for the declared metrics
+type Instruments struct {
+	ServerRequests metric.Int64Counter
+	ServerDuration metric.Float64Histogram
+	SlowClients    metric.Int64Counter
+}
+
+// NewInstruments creates every declared instrument on the given meter
+func NewInstruments(meter metric.Meter) (*Instruments, error) {
+	requests, err := meter.Int64Counter(HTTPServerRequests.Name,
+		metric.WithDescription(HTTPServerRequests.Description),
+		metric.WithUnit(HTTPServerRequests.Unit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", HTTPServerRequests.Name, err)
+	}
+
+	duration, err := meter.Float64Histogram(HTTPServerDuration.Name,
+		metric.WithDescription(HTTPServerDuration.Description),
+		metric.WithUnit(HTTPServerDuration.Unit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", HTTPServerDuration.Name, err)
+	}
+
+	slowClients, err := meter.Int64Counter(HTTPServerSlowClients.Name,
+		metric.WithDescription(HTTPServerSlowClients.Description),
+		metric.WithUnit(HTTPServerSlowClients.Unit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", HTTPServerSlowClients.Name, err)
+	}
+
+	return &Instruments{
+		ServerRequests: requests,
+		ServerDuration: duration,
+		SlowClients:    slowClients,
+	}, nil
+}
+
+// prometheusUnitSuffixes maps UCUM units to the suffixes added by the
+// OpenTelemetry Prometheus exporter
+var prometheusUnitSuffixes = map[string]string{
+	"ms": "milliseconds",
+	"s":  "seconds",
+	"By": "bytes",
+	"1":  "ratio",
+}
+
+// PrometheusName returns the series name a metric is exposed under when
+// exported to Prometheus
+func (d MetricDefinition) PrometheusName() string {
+	name := strings.NewReplacer(".", "_", "-", "_").Replace(d.Name)
+	if suffix, ok := prometheusUnitSuffixes[d.Unit]; ok {
+		name += "_" + suffix
+	}
+	if d.Kind == KindCounter {
+		name += "_total"
+	}
+	return name
+}
@@ -0,0 +1,73 @@
+package observability
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// statusRecorder captures the status code written by the wrapped handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware records request count and duration for every routed request,
+// labelled by the route template rather than the raw path, and classifies its
+// outcome once for metrics, logs and the server span
+func Middleware(instruments *Instruments) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			ctx, holder := withOutcome(r.Context())
+			r = r.WithContext(ctx)
+
+			next.ServeHTTP(recorder, r)
+
+			outcome := holder.resolve(ctx, recorder.status)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String(OutcomeAttribute, string(outcome)))
+			if outcome != OutcomeSuccess {
+				slog.WarnContext(ctx, "Requisição finalizada", "method", r.Method, "path", r.URL.Path, "outcome", outcome, "status", recorder.status)
+			}
+
+			attrs := metric.WithAttributes(
+				attribute.String("route", routeTemplate(r)),
+				attribute.String("method", r.Method),
+				attribute.String("status_code", strconv.Itoa(recorder.status)),
+				attribute.String("outcome", string(outcome)),
+			)
+			instruments.ServerRequests.Add(r.Context(), 1, attrs)
+			instruments.ServerDuration.Record(r.Context(),
+				float64(time.Since(start))/float64(time.Millisecond), attrs)
+		})
+	}
+}
+
+// routeTemplate returns the matched route template, e.g. /weather/{cep}, so
+// labels and records don't carry raw path values
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
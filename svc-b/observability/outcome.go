@@ -0,0 +1,115 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// Outcome is the canonical classification of how a request ended, shared by
+// svc-a and svc-b so their dashboards agree
+type Outcome string
+
+const (
+	OutcomeSuccess         Outcome = "success"
+	OutcomeClientError     Outcome = "client_error"
+	OutcomeValidationError Outcome = "validation_error"
+	OutcomeUpstreamTimeout Outcome = "upstream_timeout"
+	OutcomeUpstreamError   Outcome = "upstream_error"
+	OutcomeThrottled       Outcome = "throttled"
+	OutcomeCancelled       Outcome = "cancelled"
+	OutcomeInternal        Outcome = "internal"
+	// OutcomeMaintenance is a request turned away during planned maintenance
+	OutcomeMaintenance Outcome = "maintenance"
+)
+
+// OutcomeAttribute is the span attribute carrying the request outcome; the
+// metric label is simply "outcome"
+const OutcomeAttribute = "request.outcome"
+
+type outcomeKey struct{}
+
+// outcomeHolder lets handlers classify a request the middleware observes
+type outcomeHolder struct {
+	mu      sync.Mutex
+	outcome Outcome
+}
+
+// withOutcome prepares ctx to receive the request's outcome, sharing the
+// holder of an outer middleware that already did
+func withOutcome(ctx context.Context) (context.Context, *outcomeHolder) {
+	if holder, ok := ctx.Value(outcomeKey{}).(*outcomeHolder); ok {
+		return ctx, holder
+	}
+	holder := &outcomeHolder{}
+	return context.WithValue(ctx, outcomeKey{}, holder), holder
+}
+
+// SetOutcome classifies the request explicitly, for outcomes the status code
+// can't tell apart (e.g. an upstream timeout answered with 500). The first
+// classification wins.
+func SetOutcome(ctx context.Context, outcome Outcome) {
+	holder, ok := ctx.Value(outcomeKey{}).(*outcomeHolder)
+	if !ok {
+		return
+	}
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+	if holder.outcome == "" {
+		holder.outcome = outcome
+	}
+}
+
+// resolve returns the explicit outcome, falling back to one derived from the
+// response status and whether the client went away
+func (h *outcomeHolder) resolve(ctx context.Context, status int) Outcome {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.outcome != "" {
+		return h.outcome
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return OutcomeCancelled
+	}
+	return OutcomeFromStatus(status)
+}
+
+// OutcomeFromStatus derives the outcome from a response status code
+func OutcomeFromStatus(status int) Outcome {
+	switch {
+	case status < http.StatusBadRequest:
+		return OutcomeSuccess
+	case status == http.StatusBadRequest,
+		status == http.StatusRequestEntityTooLarge,
+		status == http.StatusUnprocessableEntity:
+		return OutcomeValidationError
+	case status == http.StatusTooManyRequests:
+		return OutcomeThrottled
+	case status == 499:
+		return OutcomeCancelled
+	case status == http.StatusBadGateway:
+		return OutcomeUpstreamError
+	case status == http.StatusGatewayTimeout:
+		return OutcomeUpstreamTimeout
+	case status < http.StatusInternalServerError:
+		return OutcomeClientError
+	default:
+		return OutcomeInternal
+	}
+}
+
+// OutcomeFromError classifies an error returned by an upstream call
+func OutcomeFromError(err error) Outcome {
+	if errors.Is(err, context.Canceled) {
+		return OutcomeCancelled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return OutcomeUpstreamTimeout
+	}
+	var timeoutErr interface{ Timeout() bool }
+	if errors.As(err, &timeoutErr) && timeoutErr.Timeout() {
+		return OutcomeUpstreamTimeout
+	}
+	return OutcomeUpstreamError
+}
@@ -0,0 +1,126 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"pkg/telemetry/telemetrytest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestOutcomeFromStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := map[int]Outcome{
+		http.StatusOK:                    OutcomeSuccess,
+		http.StatusBadRequest:            OutcomeValidationError,
+		http.StatusRequestEntityTooLarge: OutcomeValidationError,
+		http.StatusUnprocessableEntity:   OutcomeValidationError,
+		http.StatusNotFound:              OutcomeClientError,
+		http.StatusTooManyRequests:       OutcomeThrottled,
+		499:                              OutcomeCancelled,
+		http.StatusInternalServerError:   OutcomeInternal,
+		http.StatusBadGateway:            OutcomeUpstreamError,
+		http.StatusGatewayTimeout:        OutcomeUpstreamTimeout,
+	}
+
+	for status, expected := range tests {
+		if got := OutcomeFromStatus(status); got != expected {
+			t.Errorf("OutcomeFromStatus(%d) = %s, want %s", status, got, expected)
+		}
+	}
+}
+
+func TestOutcomeFromError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err      error
+		expected Outcome
+	}{
+		{fmt.Errorf("lookup failed: %w", context.DeadlineExceeded), OutcomeUpstreamTimeout},
+		{os.ErrDeadlineExceeded, OutcomeUpstreamTimeout},
+		{fmt.Errorf("lookup failed: %w", context.Canceled), OutcomeCancelled},
+		{errors.New("connection refused"), OutcomeUpstreamError},
+	}
+
+	for _, tt := range tests {
+		if got := OutcomeFromError(tt.err); got != tt.expected {
+			t.Errorf("OutcomeFromError(%v) = %s, want %s", tt.err, got, tt.expected)
+		}
+	}
+}
+
+func TestMiddlewareRecordsOutcomeOnServerSpan(t *testing.T) {
+	t.Parallel()
+
+	instruments, err := NewInstruments(noop.NewMeterProvider().Meter("test"))
+	if err != nil {
+		t.Fatalf("failed to create instruments: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		expected Outcome
+	}{
+		{
+			name:     "Derived from status",
+			handler:  func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnprocessableEntity) },
+			expected: OutcomeValidationError,
+		},
+		{
+			name: "First explicit outcome wins",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				SetOutcome(r.Context(), OutcomeUpstreamTimeout)
+				SetOutcome(r.Context(), OutcomeInternal)
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			expected: OutcomeUpstreamTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := tracetest.NewSpanRecorder()
+			tracer := telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			router := mux.NewRouter()
+			router.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					ctx, span := tracer.Start(r.Context(), "server")
+					defer span.End()
+					next.ServeHTTP(w, r.WithContext(ctx))
+				})
+			})
+			router.Use(Middleware(instruments))
+			router.HandleFunc("/weather/{cep}", tt.handler)
+
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/weather/22450000", nil))
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			var got string
+			for _, attr := range spans[0].Attributes() {
+				if string(attr.Key) == OutcomeAttribute {
+					got = attr.Value.AsString()
+				}
+			}
+			if got != string(tt.expected) {
+				t.Errorf("%s = %q, want %q", OutcomeAttribute, got, tt.expected)
+			}
+		})
+	}
+}
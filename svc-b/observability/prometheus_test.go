@@ -0,0 +1,62 @@
+package observability
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// TestPrometheusExporterNames checks every declared metric is scraped under
+// the name the generated dashboards query
+func TestPrometheusExporterNames(t *testing.T) {
+	t.Parallel()
+
+	reader, handler, err := NewPrometheusExporter()
+	if err != nil {
+		t.Fatalf("NewPrometheusExporter() error = %v", err)
+	}
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+	ctx := context.Background()
+	for _, def := range Metrics {
+		switch def.Kind {
+		case KindCounter:
+			counter, err := meter.Int64Counter(def.Name, metric.WithUnit(def.Unit))
+			if err != nil {
+				t.Fatalf("failed to create %s: %v", def.Name, err)
+			}
+			counter.Add(ctx, 1)
+		case KindHistogram:
+			histogram, err := meter.Float64Histogram(def.Name, metric.WithUnit(def.Unit))
+			if err != nil {
+				t.Fatalf("failed to create %s: %v", def.Name, err)
+			}
+			histogram.Record(ctx, 1)
+		case KindGauge:
+			gauge, err := meter.Int64Gauge(def.Name, metric.WithUnit(def.Unit))
+			if err != nil {
+				t.Fatalf("failed to create %s: %v", def.Name, err)
+			}
+			gauge.Record(ctx, 1)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rr.Body)
+
+	for _, def := range Metrics {
+		if !strings.Contains(string(body), "\n"+def.PrometheusName()) {
+			t.Errorf("scrape is missing %s (%s)", def.PrometheusName(), def.Name)
+		}
+	}
+	if !strings.Contains(string(body), "\ngo_goroutines ") {
+		t.Error("scrape is missing the Go runtime metrics")
+	}
+}
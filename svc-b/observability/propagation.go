@@ -0,0 +1,75 @@
+package observability
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// PropagationPolicy decides which context values become headers on outbound
+// requests. Internal destinations get the full trace context and baggage;
+// external providers only get the allowlisted baggage members, each as its
+// own header (request_id becomes X-Request-Id).
+type PropagationPolicy struct {
+	// InternalHosts lists the host names that receive full propagation
+	InternalHosts []string
+	// ExternalBaggage lists the baggage members forwarded to external hosts
+	ExternalBaggage []string
+}
+
+func (p PropagationPolicy) isInternal(host string) bool {
+	for _, internal := range p.InternalHosts {
+		if strings.EqualFold(host, internal) {
+			return true
+		}
+	}
+	return false
+}
+
+// propagationTransport applies a PropagationPolicy to every outbound request
+type propagationTransport struct {
+	next       http.RoundTripper
+	policy     PropagationPolicy
+	propagator propagation.TextMapPropagator
+}
+
+// NewPropagationTransport wraps next so outbound requests carry only the
+// context values the policy allows for their destination
+func NewPropagationTransport(next http.RoundTripper, policy PropagationPolicy, propagator propagation.TextMapPropagator) http.RoundTripper {
+	return &propagationTransport{next: next, policy: policy, propagator: propagator}
+}
+
+func (t *propagationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(ctx)
+
+	if t.policy.isInternal(req.URL.Hostname()) {
+		t.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+		return t.next.RoundTrip(req)
+	}
+
+	// Drop any propagation headers set upstream so nothing leaks by accident
+	for _, field := range t.propagator.Fields() {
+		req.Header.Del(field)
+	}
+
+	bag := baggage.FromContext(ctx)
+	for _, key := range t.policy.ExternalBaggage {
+		if member := bag.Member(key); member.Key() != "" {
+			req.Header.Set(baggageHeader(key), member.Value())
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// baggageHeader names the header carrying a baggage member, e.g. request_id -> X-Request-Id
+func baggageHeader(key string) string {
+	parts := strings.FieldsFunc(key, func(r rune) bool { return r == '_' || r == '-' || r == '.' })
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(part[:1]) + strings.ToLower(part[1:])
+	}
+	return "X-" + strings.Join(parts, "-")
+}
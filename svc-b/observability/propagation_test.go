@@ -0,0 +1,85 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPropagationTransport(t *testing.T) {
+	t.Parallel()
+
+	requestID, _ := baggage.NewMember("request_id", "req-42")
+	userEmail, _ := baggage.NewMember("user_email", "someone@example.com")
+	bag, _ := baggage.New(requestID, userEmail)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+	ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+	tests := []struct {
+		name          string
+		internalHosts []string
+		expected      map[string]string
+	}{
+		{
+			name: "External provider",
+			expected: map[string]string{
+				"X-Request-Id": "req-42",
+				"Traceparent":  "",
+				"Baggage":      "",
+			},
+		},
+		{
+			name:          "Internal service",
+			internalHosts: []string{"127.0.0.1"},
+			expected: map[string]string{
+				"X-Request-Id": "",
+				"Traceparent":  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			received := make(chan http.Header, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received <- r.Header.Clone()
+			}))
+			defer server.Close()
+
+			policy := PropagationPolicy{InternalHosts: tt.internalHosts, ExternalBaggage: []string{"request_id"}}
+			client := &http.Client{Transport: NewPropagationTransport(http.DefaultTransport, policy, propagator)}
+
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+			// Headers set by the caller must not bypass the policy
+			req.Header.Set("Baggage", "user_email=someone@example.com")
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			headers := <-received
+			for name, want := range tt.expected {
+				if got := headers.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package observability
+
+import (
+	"pkg/telemetry"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Providers carries the telemetry providers a component records to, so
+// several instances can run side by side in one process. Unset providers
+// fall back to the global ones.
+type Providers struct {
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+	// Events receives operational events; nil drops them
+	Events *EventBus
+}
+
+// Tracers returns the injected tracer provider, or the global one
+func (p Providers) Tracers() trace.TracerProvider {
+	if p.TracerProvider != nil {
+		return p.TracerProvider
+	}
+	return otel.GetTracerProvider()
+}
+
+// Meters returns the injected meter provider, or the global one
+func (p Providers) Meters() metric.MeterProvider {
+	if p.MeterProvider != nil {
+		return p.MeterProvider
+	}
+	return otel.GetMeterProvider()
+}
+
+// Tracer returns a named tracer from the effective tracer provider, following
+// the semantic conventions schema
+func (p Providers) Tracer(name string) trace.Tracer {
+	return p.Tracers().Tracer(name, telemetry.TracerOptions()...)
+}
+
+// Meter returns a named meter from the effective meter provider, following
+// the semantic conventions schema
+func (p Providers) Meter(name string) metric.Meter {
+	return p.Meters().Meter(name, telemetry.MeterOptions()...)
+}
+
+// Recorder returns a telemetry.Recorder on the effective meter provider, for
+// metrics recorded by name rather than through declared instruments
+func (p Providers) Recorder() *telemetry.Recorder {
+	return telemetry.NewRecorder(p.Meters())
+}
@@ -0,0 +1,106 @@
+package observability
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RecentRequest is the sanitized record of a handled request: the route
+// template rather than the path, and no headers, query or body
+type RecentRequest struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Route      string    `json:"route"`
+	Status     int       `json:"status"`
+	Outcome    Outcome   `json:"outcome"`
+	DurationMS float64   `json:"duration_ms"`
+	TraceID    string    `json:"trace_id,omitempty"`
+}
+
+// RecentRequests keeps the last requests in a fixed-size ring buffer for
+// triage without log access
+type RecentRequests struct {
+	mu      sync.Mutex
+	entries []RecentRequest
+	// next is the slot the next record is written to
+	next int
+	full bool
+}
+
+// NewRecentRequests creates a buffer holding the last size requests
+func NewRecentRequests(size int) *RecentRequests {
+	return &RecentRequests{entries: make([]RecentRequest, size)}
+}
+
+// Add records a request, overwriting the oldest once the buffer is full
+func (b *RecentRequests) Add(req RecentRequest) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) == 0 {
+		return
+	}
+	b.entries[b.next] = req
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Snapshot returns the buffered requests, newest first
+func (b *RecentRequests) Snapshot() []RecentRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count := b.next
+	if b.full {
+		count = len(b.entries)
+	}
+	snapshot := make([]RecentRequest, 0, count)
+	for i := 1; i <= count; i++ {
+		snapshot = append(snapshot, b.entries[(b.next-i+len(b.entries))%len(b.entries)])
+	}
+	return snapshot
+}
+
+// Middleware records every routed request. It must run inside the tracing
+// middleware to pick up the trace ID, and outside Middleware, whose outcome
+// classification it shares.
+func (b *RecentRequests) Middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			ctx, holder := withOutcome(r.Context())
+			r = r.WithContext(ctx)
+
+			next.ServeHTTP(recorder, r)
+
+			req := RecentRequest{
+				Time:       start.UTC(),
+				Method:     r.Method,
+				Route:      routeTemplate(r),
+				Status:     recorder.status,
+				Outcome:    holder.resolve(ctx, recorder.status),
+				DurationMS: float64(time.Since(start)) / float64(time.Millisecond),
+			}
+			if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+				req.TraceID = sc.TraceID().String()
+			}
+			b.Add(req)
+		})
+	}
+}
+
+// Handler serves the buffered requests, newest first
+func (b *RecentRequests) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(b.Snapshot())
+	}
+}
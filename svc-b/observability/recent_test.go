@@ -0,0 +1,93 @@
+package observability
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pkg/telemetry/telemetrytest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRecentRequestsRing(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		size     int
+		added    int
+		expected []int
+	}{
+		{"Empty", 3, 0, []int{}},
+		{"Partially filled", 3, 2, []int{201, 200}},
+		{"Wrapped keeps the newest", 3, 5, []int{204, 203, 202}},
+		{"Disabled", 0, 2, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			buffer := NewRecentRequests(tt.size)
+			for i := range tt.added {
+				buffer.Add(RecentRequest{Status: 200 + i})
+			}
+
+			got := []int{}
+			for _, req := range buffer.Snapshot() {
+				got = append(got, req.Status)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Errorf("Snapshot() statuses = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRecentRequestsMiddlewareSanitizes(t *testing.T) {
+	t.Parallel()
+
+	tracer := telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(tracetest.NewSpanRecorder())).Tracer("test")
+	buffer := NewRecentRequests(10)
+	instruments, err := NewInstruments(noop.NewMeterProvider().Meter("test"))
+	if err != nil {
+		t.Fatalf("failed to create instruments: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := tracer.Start(r.Context(), "server")
+			defer span.End()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	router.Use(buffer.Middleware())
+	router.Use(Middleware(instruments))
+	router.HandleFunc("/weather/{cep}", func(w http.ResponseWriter, r *http.Request) {
+		SetOutcome(r.Context(), OutcomeUpstreamTimeout)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/weather/22450000?key=secret", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	recent := buffer.Snapshot()
+	if len(recent) != 1 {
+		t.Fatalf("recorded %d requests, want 1", len(recent))
+	}
+	got := recent[0]
+	if got.Route != "/weather/{cep}" || got.Status != http.StatusInternalServerError {
+		t.Errorf("recorded %s with status %d, want the route template and 500", got.Route, got.Status)
+	}
+	if got.Outcome != OutcomeUpstreamTimeout {
+		t.Errorf("outcome = %s, want the handler's explicit %s", got.Outcome, OutcomeUpstreamTimeout)
+	}
+	if len(got.TraceID) != 32 {
+		t.Errorf("trace_id = %q, want the server span's trace ID", got.TraceID)
+	}
+}
@@ -0,0 +1,225 @@
+package observability
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"svc-b/clock"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// REDWindows are the windows /internal/red summarizes
+var REDWindows = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"15m", 15 * time.Minute},
+}
+
+const (
+	// redBucketWidth is the resolution of the windows
+	redBucketWidth = 10 * time.Second
+	// redBuckets covers the longest window
+	redBuckets = int(15 * time.Minute / redBucketWidth)
+)
+
+// redLatencyBoundsMS are the upper bounds of the latency buckets the
+// percentiles are estimated from
+var redLatencyBoundsMS = [...]float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// redBucket aggregates the requests of one redBucketWidth interval
+type redBucket struct {
+	// slot is the interval, in bucket widths since the epoch
+	slot     int64
+	requests int64
+	errors   int64
+	duration time.Duration
+	// latency counts requests per redLatencyBoundsMS bucket, plus overflow
+	latency [len(redLatencyBoundsMS) + 1]int64
+}
+
+// redSeries is the ring of buckets of one route
+type redSeries struct {
+	method  string
+	route   string
+	buckets [redBuckets]redBucket
+}
+
+// REDSummary is the Rate/Errors/Duration summary of every route seen
+type REDSummary struct {
+	GeneratedAt time.Time  `json:"generated_at"`
+	Routes      []REDRoute `json:"routes"`
+}
+
+// REDRoute summarizes a route over each window, keyed by window name
+type REDRoute struct {
+	Method  string               `json:"method"`
+	Route   string               `json:"route"`
+	Windows map[string]REDWindow `json:"windows"`
+}
+
+// REDWindow is a route's traffic over one window. Errors are the requests the
+// service failed (upstream failures, throttling, internal errors), not client
+// mistakes. Percentiles are the upper bound of their latency bucket.
+type REDWindow struct {
+	Requests   int64   `json:"requests"`
+	Rate       float64 `json:"rate_per_second"`
+	Errors     int64   `json:"errors"`
+	ErrorRatio float64 `json:"error_ratio"`
+	AvgMS      float64 `json:"avg_ms"`
+	P50MS      float64 `json:"p50_ms"`
+	P95MS      float64 `json:"p95_ms"`
+	P99MS      float64 `json:"p99_ms"`
+}
+
+// RED computes RED metrics per route in process, for deployments without a
+// metrics backend
+type RED struct {
+	mu     sync.Mutex
+	clock  clock.Clock
+	series map[string]*redSeries
+}
+
+func NewRED(clk clock.Clock) *RED {
+	return &RED{clock: clk, series: make(map[string]*redSeries)}
+}
+
+// Record counts a request to route that took d
+func (m *RED) Record(method, route string, d time.Duration, failed bool) {
+	slot := m.clock.Now().UnixNano() / int64(redBucketWidth)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := method + " " + route
+	series, ok := m.series[key]
+	if !ok {
+		series = &redSeries{method: method, route: route}
+		m.series[key] = series
+	}
+
+	bucket := &series.buckets[slot%int64(redBuckets)]
+	if bucket.slot != slot {
+		*bucket = redBucket{slot: slot}
+	}
+	bucket.requests++
+	if failed {
+		bucket.errors++
+	}
+	bucket.duration += d
+	bucket.latency[sort.SearchFloat64s(redLatencyBoundsMS[:], float64(d)/float64(time.Millisecond))]++
+}
+
+// Summary summarizes every route over REDWindows, ordered by route
+func (m *RED) Summary() REDSummary {
+	now := m.clock.Now()
+	current := now.UnixNano() / int64(redBucketWidth)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	summary := REDSummary{GeneratedAt: now.UTC(), Routes: make([]REDRoute, 0, len(m.series))}
+	for _, series := range m.series {
+		route := REDRoute{Method: series.method, Route: series.route, Windows: make(map[string]REDWindow)}
+		for _, window := range REDWindows {
+			route.Windows[window.Name] = series.summarize(current, window.Duration)
+		}
+		summary.Routes = append(summary.Routes, route)
+	}
+	sort.Slice(summary.Routes, func(i, j int) bool {
+		if summary.Routes[i].Route != summary.Routes[j].Route {
+			return summary.Routes[i].Route < summary.Routes[j].Route
+		}
+		return summary.Routes[i].Method < summary.Routes[j].Method
+	})
+	return summary
+}
+
+// summarize aggregates the buckets of the window ending at the current slot
+func (s *redSeries) summarize(current int64, window time.Duration) REDWindow {
+	var total redBucket
+	oldest := current - int64(window/redBucketWidth)
+	for _, bucket := range s.buckets {
+		if bucket.slot <= oldest || bucket.slot > current {
+			continue
+		}
+		total.requests += bucket.requests
+		total.errors += bucket.errors
+		total.duration += bucket.duration
+		for i, count := range bucket.latency {
+			total.latency[i] += count
+		}
+	}
+
+	summary := REDWindow{
+		Requests: total.requests,
+		Rate:     float64(total.requests) / window.Seconds(),
+		Errors:   total.errors,
+	}
+	if total.requests > 0 {
+		summary.ErrorRatio = float64(total.errors) / float64(total.requests)
+		summary.AvgMS = float64(total.duration) / float64(time.Millisecond) / float64(total.requests)
+		summary.P50MS = total.percentile(0.50)
+		summary.P95MS = total.percentile(0.95)
+		summary.P99MS = total.percentile(0.99)
+	}
+	return summary
+}
+
+// percentile returns the upper bound of the latency bucket holding the q
+// quantile. Requests slower than the last bound are reported at it.
+func (b redBucket) percentile(q float64) float64 {
+	rank := int64(math.Ceil(q * float64(b.requests)))
+	var seen int64
+	for i, bound := range redLatencyBoundsMS {
+		seen += b.latency[i]
+		if seen >= rank {
+			return bound
+		}
+	}
+	return redLatencyBoundsMS[len(redLatencyBoundsMS)-1]
+}
+
+// failed reports whether the outcome is a failure of the service rather than
+// of the client
+func (o Outcome) failed() bool {
+	switch o {
+	case OutcomeSuccess, OutcomeClientError, OutcomeValidationError, OutcomeCancelled, OutcomeMaintenance:
+		return false
+	default:
+		return true
+	}
+}
+
+// Middleware records every routed request. It must run outside Middleware,
+// whose outcome classification it shares.
+func (m *RED) Middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			ctx, holder := withOutcome(r.Context())
+			r = r.WithContext(ctx)
+
+			next.ServeHTTP(recorder, r)
+
+			outcome := holder.resolve(ctx, recorder.status)
+			m.Record(r.Method, routeTemplate(r), time.Since(start), outcome.failed())
+		})
+	}
+}
+
+// Handler serves the RED summary
+func (m *RED) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.Summary())
+	}
+}
@@ -0,0 +1,111 @@
+package observability
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"svc-b/clock"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestREDWindows(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	red := NewRED(fake)
+
+	// 10 minutes ago: 30 fast requests, 10 of them failed
+	for i := range 30 {
+		red.Record(http.MethodGet, "/weather/{cep}", 20*time.Millisecond, i < 10)
+	}
+	fake.Advance(7 * time.Minute)
+	// 3 minutes ago: 60 successful requests, one of them slow
+	for i := range 60 {
+		d := 40 * time.Millisecond
+		if i == 0 {
+			d = 2 * time.Second
+		}
+		red.Record(http.MethodGet, "/weather/{cep}", d, false)
+	}
+	fake.Advance(2*time.Minute + 30*time.Second)
+	// Just now: 6 requests to another route
+	for range 6 {
+		red.Record(http.MethodPost, "/weather", 8*time.Millisecond, false)
+	}
+	fake.Advance(30 * time.Second)
+
+	summary := red.Summary()
+	if len(summary.Routes) != 2 || summary.Routes[0].Route != "/weather" || summary.Routes[1].Route != "/weather/{cep}" {
+		t.Fatalf("Summary() routes = %+v, want /weather and /weather/{cep} in order", summary.Routes)
+	}
+
+	tests := []struct {
+		name     string
+		route    int
+		window   string
+		expected REDWindow
+	}{
+		{"Recent route in 1m", 0, "1m", REDWindow{Requests: 6, Rate: 0.1, AvgMS: 8, P50MS: 10, P95MS: 10, P99MS: 10}},
+		{"Older traffic leaves the 1m window", 1, "1m", REDWindow{}},
+		{"5m window", 1, "5m", REDWindow{Requests: 60, Rate: 0.2, AvgMS: (59*40 + 2000) / 60.0, P50MS: 50, P95MS: 50, P99MS: 2500}},
+		{"15m window", 1, "15m", REDWindow{Requests: 90, Rate: 0.1, Errors: 10, ErrorRatio: 10 / 90.0, AvgMS: (30*20 + 59*40 + 2000) / 90.0, P50MS: 50, P95MS: 50, P99MS: 2500}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := summary.Routes[tt.route].Windows[tt.window]
+			if !closeEnough(got, tt.expected) {
+				t.Errorf("window %s = %+v, want %+v", tt.window, got, tt.expected)
+			}
+		})
+	}
+}
+
+// closeEnough compares windows, allowing for float rounding in the ratios
+func closeEnough(a, b REDWindow) bool {
+	near := func(x, y float64) bool { return x-y < 1e-9 && y-x < 1e-9 }
+	return a.Requests == b.Requests && a.Errors == b.Errors &&
+		near(a.Rate, b.Rate) && near(a.ErrorRatio, b.ErrorRatio) && near(a.AvgMS, b.AvgMS) &&
+		a.P50MS == b.P50MS && a.P95MS == b.P95MS && a.P99MS == b.P99MS
+}
+
+func TestREDMiddlewareCountsServiceFailures(t *testing.T) {
+	t.Parallel()
+
+	red := NewRED(clock.Real{})
+	instruments, err := NewInstruments(noop.NewMeterProvider().Meter("test"))
+	if err != nil {
+		t.Fatalf("failed to create instruments: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.Use(red.Middleware())
+	router.Use(Middleware(instruments))
+	router.HandleFunc("/weather/{cep}", func(w http.ResponseWriter, r *http.Request) {
+		switch mux.Vars(r)["cep"] {
+		case "123":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		case "00000000":
+			SetOutcome(r.Context(), OutcomeUpstreamError)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	})
+
+	for _, cep := range []string{"22450000", "123", "00000000"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/weather/"+cep, nil))
+	}
+
+	summary := red.Summary()
+	if len(summary.Routes) != 1 {
+		t.Fatalf("Summary() has %d routes, want the single route template", len(summary.Routes))
+	}
+	got := summary.Routes[0].Windows["1m"]
+	if got.Requests != 3 || got.Errors != 1 {
+		t.Errorf("1m window = %d requests, %d errors; want 3 requests and only the upstream failure as an error", got.Requests, got.Errors)
+	}
+}
@@ -0,0 +1,213 @@
+package observability
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// SpanDefinition declares a span started by svc-b code
+type SpanDefinition struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+var (
+	SpanGetWeatherByCEP = SpanDefinition{
+		Name:        "WeatherHandler.GetWeatherByCEP",
+		Description: "Handles GET /weather/{cep}",
+	}
+	SpanGetWeatherByCEPPost = SpanDefinition{
+		Name:        "WeatherHandler.GetWeatherByCEPPost",
+		Description: "Handles POST /weather",
+	}
+	SpanProcessWeatherRequest = SpanDefinition{
+		Name:        "WeatherHandler.ProcessWeatherRequest",
+		Description: "Resolves the CEP and fetches the temperature for its city",
+	}
+	SpanWaitForChange = SpanDefinition{
+		Name:        "WeatherHandler.WaitForChange",
+		Description: "Handles GET /weather/{cep}/wait-for-change",
+	}
+	SpanGetForecastByCEP = SpanDefinition{
+		Name:        "WeatherHandler.GetForecastByCEP",
+		Description: "Handles GET /forecast/{cep}",
+	}
+	SpanGetWeatherBatch = SpanDefinition{
+		Name:        "WeatherHandler.GetWeatherBatch",
+		Description: "Handles POST /weather/batch",
+	}
+	SpanResolveBatchItem = SpanDefinition{
+		Name:        "WeatherHandler.ResolveBatchItem",
+		Description: "Resolves one CEP of a batch",
+	}
+	SpanEncodeResponse = SpanDefinition{
+		Name:        "WeatherHandler.EncodeResponse",
+		Description: "Encodes, post-processes and writes a response body",
+	}
+	SpanViaCEPGetCityByCEP = SpanDefinition{
+		Name:        "ViaCEP.GetCityByCEP",
+		Description: "Looks up the city for a CEP on ViaCEP",
+	}
+	SpanBrasilAPIGetCityByCEP = SpanDefinition{
+		Name:        "BrasilAPI.GetCityByCEP",
+		Description: "Looks up the city for a CEP on BrasilAPI",
+	}
+	SpanOpenCEPGetCityByCEP = SpanDefinition{
+		Name:        "OpenCEP.GetCityByCEP",
+		Description: "Looks up the city for a CEP on OpenCEP",
+	}
+	SpanCEPChainGetCityByCEP = SpanDefinition{
+		Name:        "CEPChain.GetCityByCEP",
+		Description: "Tries the CEP providers in order until one finds the CEP",
+	}
+	SpanWeatherAPIGetTemperature = SpanDefinition{
+		Name:        "WeatherAPI.GetTemperature",
+		Description: "Fetches the current temperature for a city on WeatherAPI",
+	}
+	SpanWeatherAPIGetForecast = SpanDefinition{
+		Name:        "WeatherAPI.GetForecast",
+		Description: "Fetches the daily forecast for a city on WeatherAPI",
+	}
+	SpanOpenWeatherMapGetTemperature = SpanDefinition{
+		Name:        "OpenWeatherMap.GetTemperature",
+		Description: "Fetches the current temperature for a city on OpenWeatherMap",
+	}
+	SpanSandboxGetCityByCEP = SpanDefinition{
+		Name:        "Sandbox.GetCityByCEP",
+		Description: "Looks up the city for a CEP on the sandbox provider",
+	}
+	SpanSandboxGetTemperature = SpanDefinition{
+		Name:        "Sandbox.GetTemperature",
+		Description: "Returns a canned temperature from the sandbox provider",
+	}
+	SpanAdminInvalidateCache = SpanDefinition{
+		Name:        "AdminHandler.InvalidateCache",
+		Description: "Handles POST /admin/cache/invalidate",
+	}
+	SpanAdminSetMaintenance = SpanDefinition{
+		Name:        "AdminHandler.SetMaintenance",
+		Description: "Handles PUT /admin/maintenance",
+	}
+	SpanAdminDiagnostics = SpanDefinition{
+		Name:        "AdminHandler.GetDiagnostics",
+		Description: "Builds the post-mortem bundle served by GET /admin/diagnostics",
+	}
+	SpanAdminCalibrate = SpanDefinition{
+		Name:        "AdminHandler.Calibrate",
+		Description: "Handles GET /admin/calibrate/{cep}",
+	}
+	SpanIoTGetTemperature = SpanDefinition{
+		Name:        "IoT.GetTemperature",
+		Description: "Answers a CEP's temperature from the latest reading of its sensors",
+	}
+	SpanIngestTemperature = SpanDefinition{
+		Name:        "IngestHandler.IngestTemperature",
+		Description: "Handles POST /ingest/temperature",
+	}
+)
+
+// Spans lists every span name svc-b starts
+var Spans = []SpanDefinition{
+	SpanGetWeatherByCEP,
+	SpanGetWeatherByCEPPost,
+	SpanProcessWeatherRequest,
+	SpanWaitForChange,
+	SpanGetForecastByCEP,
+	SpanGetWeatherBatch,
+	SpanResolveBatchItem,
+	SpanEncodeResponse,
+	SpanViaCEPGetCityByCEP,
+	SpanBrasilAPIGetCityByCEP,
+	SpanOpenCEPGetCityByCEP,
+	SpanCEPChainGetCityByCEP,
+	SpanWeatherAPIGetTemperature,
+	SpanWeatherAPIGetForecast,
+	SpanOpenWeatherMapGetTemperature,
+	SpanSandboxGetCityByCEP,
+	SpanSandboxGetTemperature,
+	SpanAdminInvalidateCache,
+	SpanAdminSetMaintenance,
+	SpanAdminDiagnostics,
+	SpanAdminCalibrate,
+	SpanIoTGetTemperature,
+	SpanIngestTemperature,
+}
+
+var (
+	// metricNamePattern requires lowercase dot-separated segments under the service prefix
+	metricNamePattern = regexp.MustCompile(`^svc_b(\.[a-z][a-z0-9_]*)+$`)
+
+	// spanNamePattern requires Component.Operation in camel case
+	spanNamePattern = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*\.[A-Z][A-Za-z0-9]*$`)
+
+	// labelPattern requires snake_case attribute keys
+	labelPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
+// Registry is the documentation view of every declared metric and span
+type Registry struct {
+	Service string             `json:"service"`
+	Metrics []MetricDefinition `json:"metrics"`
+	Spans   []SpanDefinition   `json:"spans"`
+}
+
+// Validate reports duplicate and non-conforming metric and span declarations
+func Validate(metrics []MetricDefinition, spans []SpanDefinition) error {
+	var errs []error
+
+	seenMetrics := make(map[string]bool)
+	for _, m := range metrics {
+		if seenMetrics[m.Name] {
+			errs = append(errs, fmt.Errorf("duplicate metric %q", m.Name))
+		}
+		seenMetrics[m.Name] = true
+
+		if !metricNamePattern.MatchString(m.Name) {
+			errs = append(errs, fmt.Errorf("metric %q doesn't match %s", m.Name, metricNamePattern))
+		}
+		if strings.TrimSpace(m.Description) == "" {
+			errs = append(errs, fmt.Errorf("metric %q has no description", m.Name))
+		}
+		if m.Unit == "" {
+			errs = append(errs, fmt.Errorf("metric %q has no unit", m.Name))
+		}
+		for _, label := range m.Labels {
+			if !labelPattern.MatchString(label) {
+				errs = append(errs, fmt.Errorf("metric %q label %q doesn't match %s", m.Name, label, labelPattern))
+			}
+		}
+	}
+
+	seenSpans := make(map[string]bool)
+	for _, s := range spans {
+		if seenSpans[s.Name] {
+			errs = append(errs, fmt.Errorf("duplicate span %q", s.Name))
+		}
+		seenSpans[s.Name] = true
+
+		if !spanNamePattern.MatchString(s.Name) {
+			errs = append(errs, fmt.Errorf("span %q doesn't match %s", s.Name, spanNamePattern))
+		}
+		if strings.TrimSpace(s.Description) == "" {
+			errs = append(errs, fmt.Errorf("span %q has no description", s.Name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RegistryHandler serves the declared metrics and spans for documentation tooling
+func RegistryHandler(service string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Registry{
+			Service: service,
+			Metrics: Metrics,
+			Spans:   Spans,
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package observability
+
+import "testing"
+
+func TestRegistryIsValid(t *testing.T) {
+	t.Parallel()
+
+	if err := Validate(Metrics, Spans); err != nil {
+		t.Fatalf("telemetry registry is invalid:\n%v", err)
+	}
+}
+
+func TestValidateRejectsConflicts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		metrics []MetricDefinition
+		spans   []SpanDefinition
+	}{
+		{
+			name:    "Duplicate metric",
+			metrics: []MetricDefinition{HTTPServerRequests, HTTPServerRequests},
+		},
+		{
+			name: "Non-conforming metric name",
+			metrics: []MetricDefinition{{
+				Name: "HTTPRequests", Description: "requests", Unit: "{request}", Kind: KindCounter,
+			}},
+		},
+		{
+			name: "Non-conforming label",
+			metrics: []MetricDefinition{{
+				Name: "svc_b.requests", Description: "requests", Unit: "{request}", Kind: KindCounter,
+				Labels: []string{"statusCode"},
+			}},
+		},
+		{
+			name:  "Duplicate span",
+			spans: []SpanDefinition{SpanViaCEPGetCityByCEP, SpanViaCEPGetCityByCEP},
+		},
+		{
+			name:  "Non-conforming span name",
+			spans: []SpanDefinition{{Name: "ViaCEP-GetCityByCEP", Description: "lookup"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := Validate(tt.metrics, tt.spans); err == nil {
+				t.Error("expected a validation error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package observability
+
+import (
+	"net/http"
+	"pkg/telemetry"
+
+	"github.com/gorilla/mux"
+)
+
+// RequestIDMiddleware gives every request an ID and returns it as
+// X-Request-ID: the request_id baggage member svc-a sends, else the client's
+// X-Request-ID when valid, else a new one. The ID is recorded on the server
+// span and kept in the baggage, so logs and the providers' X-Request-Id carry
+// it too.
+func RequestIDMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := telemetry.RequestID(r.Context())
+			if id == "" {
+				id = telemetry.RequestIDFromHeader(r)
+			}
+			w.Header().Set(telemetry.RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(telemetry.ContextWithRequestID(r.Context(), id)))
+		})
+	}
+}
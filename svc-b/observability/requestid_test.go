@@ -0,0 +1,79 @@
+package observability
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"pkg/telemetry"
+	"pkg/telemetry/telemetrytest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		baggage  string
+		header   string
+		expectID string
+	}{
+		{"Request ID from svc-a", "request_id=from-svc-a", "from-client", "from-svc-a"},
+		{"Direct client request ID", "", "support-ticket-123", "support-ticket-123"},
+		{"Generated request ID", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := tracetest.NewSpanRecorder()
+			var seen string
+			r := mux.NewRouter()
+			r.Use(otelmux.Middleware("svc-b",
+				otelmux.WithTracerProvider(telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))),
+				otelmux.WithPropagators(propagation.Baggage{}),
+			))
+			r.Use(RequestIDMiddleware())
+			r.HandleFunc("/weather/{cep}", func(w http.ResponseWriter, r *http.Request) {
+				seen = baggage.FromContext(r.Context()).Member(telemetry.RequestIDKey).Value()
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/weather/01001000", nil)
+			if tt.baggage != "" {
+				req.Header.Set("baggage", tt.baggage)
+			}
+			if tt.header != "" {
+				req.Header.Set(telemetry.RequestIDHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			returned := rr.Header().Get(telemetry.RequestIDHeader)
+			if tt.expectID != "" && returned != tt.expectID {
+				t.Errorf("%s = %q, want %q", telemetry.RequestIDHeader, returned, tt.expectID)
+			}
+			if tt.expectID == "" && len(returned) != 32 {
+				t.Errorf("%s = %q, want a new 32-digit ID", telemetry.RequestIDHeader, returned)
+			}
+			if seen != returned {
+				t.Errorf("handler saw request_id %q, want %q", seen, returned)
+			}
+			var recorded string
+			for _, attr := range recorder.Ended()[0].Attributes() {
+				if attr.Key == "baggage.request_id" {
+					recorded = attr.Value.AsString()
+				}
+			}
+			if recorded != returned {
+				t.Errorf("span baggage.request_id = %q, want %q", recorded, returned)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// devEnvironments are the ENVIRONMENT values that get trace deep-links
+var devEnvironments = map[string]bool{"dev": true, "development": true, "local": true}
+
+// TraceLinker builds Zipkin UI links to the current trace. It is only
+// enabled in the dev profile, so production responses never carry them.
+type TraceLinker struct {
+	baseURL string
+}
+
+type traceLinkerKey struct{}
+
+// NewTraceLinker returns a linker for zipkinUIURL (e.g. http://localhost:9411/zipkin),
+// or a disabled one outside the dev profile
+func NewTraceLinker(environment, zipkinUIURL string) TraceLinker {
+	if !devEnvironments[strings.ToLower(environment)] || zipkinUIURL == "" {
+		return TraceLinker{}
+	}
+	return TraceLinker{baseURL: strings.TrimRight(zipkinUIURL, "/")}
+}
+
+// Enabled reports whether trace links are generated
+func (l TraceLinker) Enabled() bool {
+	return l.baseURL != ""
+}
+
+// URL returns the Zipkin UI link to the trace in ctx, or "" when disabled
+func (l TraceLinker) URL(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !l.Enabled() || !spanContext.HasTraceID() {
+		return ""
+	}
+	return l.baseURL + "/traces/" + spanContext.TraceID().String()
+}
+
+// Middleware makes the linker available to the rendering layer through TraceURL
+func (l TraceLinker) Middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), traceLinkerKey{}, l)))
+		})
+	}
+}
+
+// TraceURL returns the Zipkin UI link to the trace in ctx, or "" when no
+// enabled linker was installed by Middleware
+func TraceURL(ctx context.Context) string {
+	linker, _ := ctx.Value(traceLinkerKey{}).(TraceLinker)
+	return linker.URL(ctx)
+}
@@ -0,0 +1,57 @@
+package observability
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceLinker(t *testing.T) {
+	t.Parallel()
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+
+	tests := []struct {
+		name        string
+		environment string
+		uiURL       string
+		expected    string
+	}{
+		{
+			name:        "Dev profile",
+			environment: "development",
+			uiURL:       "http://localhost:9411/zipkin/",
+			expected:    "http://localhost:9411/zipkin/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:        "Production profile",
+			environment: "production",
+			uiURL:       "http://localhost:9411/zipkin",
+		},
+		{
+			name:        "UI URL not configured",
+			environment: "dev",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			linker := NewTraceLinker(tt.environment, tt.uiURL)
+			if got := linker.URL(ctx); got != tt.expected {
+				t.Errorf("URL() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+
+	if got := TraceURL(ctx); got != "" {
+		t.Errorf("TraceURL() without a linker in the context = %q, want empty", got)
+	}
+}
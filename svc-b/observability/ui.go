@@ -0,0 +1,21 @@
+package observability
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// dashboardPage is the single-page dashboard, polling /readyz and the
+// internal endpoints from the browser
+//
+//go:embed ui/index.html
+var dashboardPage []byte
+
+// DashboardPageHandler serves the dashboard on /dashboard, for small
+// deployments without Grafana
+func DashboardPageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboardPage)
+	}
+}
@@ -0,0 +1,25 @@
+package observability
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboardPageHandler(t *testing.T) {
+	t.Parallel()
+
+	rr := httptest.NewRecorder()
+	DashboardPageHandler()(rr, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("status %d, Content-Type %q, want an HTML page", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	// The page polls the endpoints by relative path, so it works behind a prefix
+	for _, endpoint := range []string{`"readyz"`, `"internal/cache"`, `"internal/red"`, `"internal/recent"`} {
+		if !strings.Contains(rr.Body.String(), endpoint) {
+			t.Errorf("page doesn't load %s", endpoint)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// UpstreamInstruments measures the calls made to the upstream providers
+type UpstreamInstruments struct {
+	Duration metric.Float64Histogram
+	Errors   metric.Int64Counter
+}
+
+// NewUpstreamInstruments creates the declared upstream instruments on the given meter
+func NewUpstreamInstruments(meter metric.Meter) (*UpstreamInstruments, error) {
+	duration, err := meter.Float64Histogram(UpstreamDuration.Name,
+		metric.WithDescription(UpstreamDuration.Description),
+		metric.WithUnit(UpstreamDuration.Unit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", UpstreamDuration.Name, err)
+	}
+
+	errorCount, err := meter.Int64Counter(UpstreamErrors.Name,
+		metric.WithDescription(UpstreamErrors.Description),
+		metric.WithUnit(UpstreamErrors.Unit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", UpstreamErrors.Name, err)
+	}
+
+	return &UpstreamInstruments{Duration: duration, Errors: errorCount}, nil
+}
+
+// upstreamTransport records the duration and failures of outbound requests,
+// labelled with the provider owning the destination host
+type upstreamTransport struct {
+	next        http.RoundTripper
+	providers   map[string]string
+	instruments *UpstreamInstruments
+}
+
+// NewUpstreamTransport wraps next so every outbound request is measured.
+// providers maps host names to the provider label; other hosts are "other".
+func NewUpstreamTransport(next http.RoundTripper, providers map[string]string, instruments *UpstreamInstruments) http.RoundTripper {
+	return &upstreamTransport{next: next, providers: providers, instruments: instruments}
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := float64(time.Since(start).Microseconds()) / 1000
+
+	provider, ok := t.providers[req.URL.Hostname()]
+	if !ok {
+		provider = "other"
+	}
+
+	outcome, reason := "success", ""
+	switch {
+	case err != nil:
+		outcome, reason = "error", upstreamErrorReason(req.Context(), err)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		outcome, reason = "error", strconv.Itoa(resp.StatusCode)
+	case resp.StatusCode >= http.StatusBadRequest:
+		outcome = "rejected"
+	}
+
+	ctx := req.Context()
+	t.instruments.Duration.Record(ctx, elapsed, metric.WithAttributes(
+		attribute.String("provider", provider),
+		attribute.String("outcome", outcome),
+	))
+	if reason != "" {
+		t.instruments.Errors.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("provider", provider),
+			attribute.String("reason", reason),
+		))
+	}
+	return resp, err
+}
+
+// upstreamErrorReason classifies a transport error for the error counter
+func upstreamErrorReason(ctx context.Context, err error) string {
+	switch {
+	case errors.Is(err, context.Canceled) && ctx.Err() != nil:
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	var timeoutErr interface{ Timeout() bool }
+	if errors.As(err, &timeoutErr) && timeoutErr.Timeout() {
+		return "timeout"
+	}
+	return "connection"
+}
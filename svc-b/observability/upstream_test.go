@@ -0,0 +1,86 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestUpstreamTransport(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		status          int
+		closed          bool
+		expectedOutcome string
+		expectedReason  string
+	}{
+		{name: "Success", status: http.StatusOK, expectedOutcome: "success"},
+		{name: "Rejected", status: http.StatusNotFound, expectedOutcome: "rejected"},
+		{name: "Server error", status: http.StatusBadGateway, expectedOutcome: "error", expectedReason: "502"},
+		{name: "Connection error", closed: true, expectedOutcome: "error", expectedReason: "connection"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+			if tt.closed {
+				server.Close()
+			}
+
+			reader := sdkmetric.NewManualReader()
+			instruments, err := NewUpstreamInstruments(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+			if err != nil {
+				t.Fatalf("failed to create instruments: %v", err)
+			}
+
+			host, _ := url.Parse(server.URL)
+			client := &http.Client{Transport: NewUpstreamTransport(http.DefaultTransport,
+				map[string]string{host.Hostname(): "viacep"}, instruments)}
+			if resp, err := client.Get(server.URL); err == nil {
+				resp.Body.Close()
+			}
+
+			var rm metricdata.ResourceMetrics
+			if err := reader.Collect(context.Background(), &rm); err != nil {
+				t.Fatalf("failed to collect metrics: %v", err)
+			}
+
+			var outcome, reason string
+			for _, scope := range rm.ScopeMetrics {
+				for _, m := range scope.Metrics {
+					switch data := m.Data.(type) {
+					case metricdata.Histogram[float64]:
+						attrs := data.DataPoints[0].Attributes
+						if provider, _ := attrs.Value("provider"); provider.AsString() != "viacep" {
+							t.Errorf("provider = %q, want viacep", provider.AsString())
+						}
+						value, _ := attrs.Value("outcome")
+						outcome = value.AsString()
+					case metricdata.Sum[int64]:
+						value, _ := data.DataPoints[0].Attributes.Value("reason")
+						reason = value.AsString()
+					}
+				}
+			}
+
+			if outcome != tt.expectedOutcome {
+				t.Errorf("outcome = %q, want %q", outcome, tt.expectedOutcome)
+			}
+			if reason != tt.expectedReason {
+				t.Errorf("reason = %q, want %q", reason, tt.expectedReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+// Package quota caps the calls made to each upstream provider per time
+// window, so a traffic spike or a retry storm can't run up the provider bill
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"svc-b/clock"
+	"svc-b/resilience"
+	"sync"
+	"time"
+)
+
+var ErrExhausted = errors.New("upstream quota exhausted")
+
+// windowNames are the named windows accepted by ParseLimits
+var windowNames = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+}
+
+// Limit caps the calls to a provider within each window. Windows are aligned
+// to UTC, so a daily quota resets at midnight UTC.
+type Limit struct {
+	Provider string
+	Max      int64
+	Window   time.Duration
+}
+
+// ExhaustedError reports a call refused because the provider's quota is spent
+type ExhaustedError struct {
+	Provider string
+	// RetryAfter is how long until the window resets
+	RetryAfter time.Duration
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("%s quota exhausted, resets in %s", e.Provider, e.RetryAfter.Round(time.Second))
+}
+
+// Unwrap makes the error match ErrExhausted and, since no call was made,
+// resilience.ErrNotAttempted so it is neither retried nor counted by breakers
+func (e *ExhaustedError) Unwrap() []error {
+	return []error{ErrExhausted, resilience.ErrNotAttempted}
+}
+
+// ParseLimits parses comma-separated provider:max/window entries, e.g.
+// "weatherapi:1000/day,viacep:60/minute". The window is second, minute, hour,
+// day or a Go duration such as 15m.
+func ParseLimits(raw string) ([]Limit, error) {
+	var limits []Limit
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		provider, rest, ok := strings.Cut(entry, ":")
+		count, window, ok2 := strings.Cut(rest, "/")
+		if !ok || !ok2 || provider == "" {
+			return nil, fmt.Errorf("invalid quota %q: want provider:max/window", entry)
+		}
+		if seen[provider] {
+			return nil, fmt.Errorf("duplicate quota for %q", provider)
+		}
+		seen[provider] = true
+
+		max, err := strconv.ParseInt(count, 10, 64)
+		if err != nil || max < 0 {
+			return nil, fmt.Errorf("invalid quota %q: max must be a non-negative integer", entry)
+		}
+		duration, ok := windowNames[window]
+		if !ok {
+			if duration, err = time.ParseDuration(window); err != nil || duration <= 0 {
+				return nil, fmt.Errorf("invalid quota %q: unknown window %q", entry, window)
+			}
+		}
+
+		limits = append(limits, Limit{Provider: provider, Max: max, Window: duration})
+	}
+	return limits, nil
+}
+
+// counter tracks the calls made in the current window of a limit
+type counter struct {
+	limit       Limit
+	windowStart time.Time
+	used        int64
+}
+
+// Usage is the quota consumption of a provider in the current window
+type Usage struct {
+	Provider  string    `json:"provider"`
+	Limit     int64     `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	Window    string    `json:"window"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// Limiter enforces the quotas of every limited provider
+type Limiter struct {
+	mu       sync.Mutex
+	clock    clock.Clock
+	counters map[string]*counter
+}
+
+// NewLimiter creates a limiter for the given limits; providers without a
+// limit are never refused
+func NewLimiter(limits []Limit, clk clock.Clock) *Limiter {
+	l := &Limiter{clock: clk, counters: make(map[string]*counter, len(limits))}
+	for _, limit := range limits {
+		l.counters[limit.Provider] = &counter{limit: limit}
+	}
+	return l
+}
+
+// Take consumes one call from the provider's quota, returning an
+// *ExhaustedError once the current window's quota is spent
+func (l *Limiter) Take(provider string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.counters[provider]
+	if !ok {
+		return nil
+	}
+
+	now := l.clock.Now()
+	l.roll(c, now)
+	if c.used >= c.limit.Max {
+		return &ExhaustedError{Provider: provider, RetryAfter: c.windowStart.Add(c.limit.Window).Sub(now)}
+	}
+	c.used++
+	return nil
+}
+
+// Usage reports every limited provider's consumption, ordered by provider
+func (l *Limiter) Usage() []Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	usage := make([]Usage, 0, len(l.counters))
+	for provider, c := range l.counters {
+		l.roll(c, now)
+		usage = append(usage, Usage{
+			Provider:  provider,
+			Limit:     c.limit.Max,
+			Used:      c.used,
+			Remaining: max(c.limit.Max-c.used, 0),
+			Window:    windowName(c.limit.Window),
+			ResetsAt:  c.windowStart.Add(c.limit.Window).UTC(),
+		})
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Provider < usage[j].Provider })
+	return usage
+}
+
+// roll starts a new window once the current one has elapsed
+func (l *Limiter) roll(c *counter, now time.Time) {
+	if start := now.UTC().Truncate(c.limit.Window); !start.Equal(c.windowStart) {
+		c.windowStart, c.used = start, 0
+	}
+}
+
+func windowName(window time.Duration) string {
+	for name, duration := range windowNames {
+		if duration == window {
+			return name
+		}
+	}
+	return window.String()
+}
+
+// transport refuses outbound requests to providers whose quota is spent
+type transport struct {
+	next      http.RoundTripper
+	providers map[string]string
+	limiter   *Limiter
+}
+
+// Transport wraps next so every request to a limited provider consumes its
+// quota. providers maps host names to provider names.
+func (l *Limiter) Transport(next http.RoundTripper, providers map[string]string) http.RoundTripper {
+	return &transport{next: next, providers: providers, limiter: l}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if provider, ok := t.providers[req.URL.Hostname()]; ok {
+		if err := t.limiter.Take(provider); err != nil {
+			return nil, err
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// UsageResponse is served by the usage endpoint
+type UsageResponse struct {
+	Quotas []Usage `json:"quotas"`
+}
+
+// Handler serves the remaining quota of every limited provider
+func (l *Limiter) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(UsageResponse{Quotas: l.Usage()})
+	}
+}
@@ -0,0 +1,159 @@
+package quota
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"svc-b/clock"
+	"svc-b/resilience"
+	"testing"
+	"time"
+)
+
+func TestParseLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		raw       string
+		expected  []Limit
+		expectErr bool
+	}{
+		{name: "Empty", raw: ""},
+		{
+			name: "Named windows",
+			raw:  "weatherapi:1000/day, viacep:60/minute",
+			expected: []Limit{
+				{Provider: "weatherapi", Max: 1000, Window: 24 * time.Hour},
+				{Provider: "viacep", Max: 60, Window: time.Minute},
+			},
+		},
+		{
+			name:     "Duration window",
+			raw:      "viacep:100/15m",
+			expected: []Limit{{Provider: "viacep", Max: 100, Window: 15 * time.Minute}},
+		},
+		{name: "Missing window", raw: "viacep:60", expectErr: true},
+		{name: "Unknown window", raw: "viacep:60/week", expectErr: true},
+		{name: "Negative max", raw: "viacep:-1/day", expectErr: true},
+		{name: "Duplicate provider", raw: "viacep:1/day,viacep:2/day", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			limits, err := ParseLimits(tt.raw)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseLimits(%q) error = %v, expectErr %v", tt.raw, err, tt.expectErr)
+			}
+			if len(limits) != len(tt.expected) {
+				t.Fatalf("ParseLimits(%q) = %v, want %v", tt.raw, limits, tt.expected)
+			}
+			for i := range limits {
+				if limits[i] != tt.expected[i] {
+					t.Errorf("limit %d = %v, want %v", i, limits[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterTakeResetsWithWindow(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC))
+	limiter := NewLimiter([]Limit{{Provider: "viacep", Max: 2, Window: time.Minute}}, fake)
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.Take("viacep"); err != nil {
+			t.Fatalf("call %d refused: %v", i+1, err)
+		}
+	}
+
+	err := limiter.Take("viacep")
+	var exhausted *ExhaustedError
+	if !errors.As(err, &exhausted) || exhausted.RetryAfter != 30*time.Second {
+		t.Fatalf("third call got %v, want ExhaustedError retrying after 30s", err)
+	}
+	if !errors.Is(err, ErrExhausted) || !errors.Is(err, resilience.ErrNotAttempted) {
+		t.Errorf("%v must match ErrExhausted and resilience.ErrNotAttempted", err)
+	}
+	if err := limiter.Take("weatherapi"); err != nil {
+		t.Errorf("unlimited provider refused: %v", err)
+	}
+
+	usage := limiter.Usage()
+	if len(usage) != 1 || usage[0].Used != 2 || usage[0].Remaining != 0 || usage[0].Window != "minute" {
+		t.Errorf("Usage() = %+v, want viacep with 2 used and none remaining per minute", usage)
+	}
+
+	fake.Advance(30 * time.Second)
+	if err := limiter.Take("viacep"); err != nil {
+		t.Errorf("call in the next window refused: %v", err)
+	}
+}
+
+func TestTransportRefusesExhaustedProvider(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer server.Close()
+
+	host, _ := url.Parse(server.URL)
+	limiter := NewLimiter([]Limit{{Provider: "weatherapi", Max: 1, Window: 24 * time.Hour}}, clock.Real{})
+	client := &http.Client{Transport: limiter.Transport(http.DefaultTransport, map[string]string{host.Hostname(): "weatherapi"})}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("first request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrExhausted) {
+		t.Errorf("second request got %v, want ErrExhausted", err)
+	}
+	if calls != 1 {
+		t.Errorf("upstream received %d calls, want 1", calls)
+	}
+}
+
+func TestSnapshotRestoresCurrentWindow(t *testing.T) {
+	t.Parallel()
+
+	limits := []Limit{
+		{Provider: "weatherapi", Max: 10, Window: 24 * time.Hour},
+		{Provider: "viacep", Max: 10, Window: time.Minute},
+	}
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	saved := NewLimiter(limits, fake)
+	saved.Take("weatherapi")
+	saved.Take("weatherapi")
+	saved.Take("viacep")
+
+	var buf bytes.Buffer
+	if err := saved.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	// The minute window has rolled over by the restart, the day window hasn't
+	fake.Advance(2 * time.Minute)
+	restored := NewLimiter(limits, fake)
+	count, err := restored.Restore(&buf)
+	if err != nil || count != 1 {
+		t.Fatalf("Restore() = %d, %v; want 1 counter restored", count, err)
+	}
+
+	used := make(map[string]int64)
+	for _, u := range restored.Usage() {
+		used[u.Provider] = u.Used
+	}
+	if used["weatherapi"] != 2 || used["viacep"] != 0 {
+		t.Errorf("restored usage = %v, want weatherapi 2 and viacep 0", used)
+	}
+}
@@ -0,0 +1,115 @@
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotVersion is bumped whenever the snapshot layout changes
+const snapshotVersion = 1
+
+// snapshot is the on-disk form of the quota counters
+type snapshot struct {
+	Version  int               `json:"version"`
+	SavedAt  time.Time         `json:"saved_at"`
+	Counters []snapshotCounter `json:"counters"`
+}
+
+type snapshotCounter struct {
+	Provider    string        `json:"provider"`
+	Window      time.Duration `json:"window_ns"`
+	WindowStart time.Time     `json:"window_start"`
+	Used        int64         `json:"used"`
+}
+
+// Snapshot writes the counters of the current windows
+func (l *Limiter) Snapshot(w io.Writer) error {
+	l.mu.Lock()
+	now := l.clock.Now()
+	snap := snapshot{Version: snapshotVersion, SavedAt: now}
+	for provider, c := range l.counters {
+		l.roll(c, now)
+		snap.Counters = append(snap.Counters, snapshotCounter{
+			Provider:    provider,
+			Window:      c.limit.Window,
+			WindowStart: c.windowStart,
+			Used:        c.used,
+		})
+	}
+	l.mu.Unlock()
+
+	return json.NewEncoder(w).Encode(snap)
+}
+
+// Restore loads a snapshot written by Snapshot. Counters are only restored
+// into the same, still current window of a provider that is still limited;
+// the higher of the saved and current counts wins. It returns the number of
+// counters restored.
+func (l *Limiter) Restore(r io.Reader) (int, error) {
+	var snap snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return 0, fmt.Errorf("failed to decode quota snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return 0, fmt.Errorf("unsupported quota snapshot version %d", snap.Version)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	restored := 0
+	for _, s := range snap.Counters {
+		c, ok := l.counters[s.Provider]
+		if !ok || c.limit.Window != s.Window {
+			continue
+		}
+		l.roll(c, now)
+		if !c.windowStart.Equal(s.WindowStart) {
+			continue
+		}
+		c.used = max(c.used, s.Used)
+		restored++
+	}
+	return restored, nil
+}
+
+// SaveFile writes a snapshot to path, replacing it atomically
+func (l *Limiter) SaveFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create quota snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := l.Snapshot(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write quota snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write quota snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace quota snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadFile restores the snapshot at path; a missing file restores nothing
+func (l *Limiter) LoadFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open quota snapshot: %w", err)
+	}
+	defer file.Close()
+
+	return l.Restore(file)
+}
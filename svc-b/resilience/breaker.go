@@ -0,0 +1,176 @@
+// Package resilience holds the circuit breaker and retry layers used around
+// upstream provider calls, and the coordination between them
+package resilience
+
+import (
+	"errors"
+	"svc-b/clock"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBreakerOpen = errors.New("circuit breaker is open")
+	// ErrNotAttempted marks a failure raised before the upstream was called,
+	// e.g. an exhausted quota: Do neither retries it nor counts it as a failure
+	ErrNotAttempted = errors.New("call not attempted")
+)
+
+// State is the circuit breaker state
+type State int
+
+const (
+	// StateClosed lets every call through, counting consecutive failures
+	StateClosed State = iota
+	// StateHalfOpen lets a single probe through to test the upstream
+	StateHalfOpen
+	// StateOpen rejects every call until the open timeout elapses
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return "open"
+	}
+}
+
+// BreakerConfig controls when a breaker trips and how long it stays open
+type BreakerConfig struct {
+	// FailureThreshold is how many consecutive failures open the breaker
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before probing
+	OpenTimeout time.Duration
+}
+
+// Breaker is a consecutive-failure circuit breaker
+type Breaker struct {
+	mu       sync.Mutex
+	config   BreakerConfig
+	clock    clock.Clock
+	state    State
+	failures int
+	openedAt time.Time
+	// generation counts state transitions and half-open probes, so results
+	// of calls admitted before the latest one are told apart and dropped
+	generation uint64
+	// probing is set while the half-open probe is in flight
+	probing bool
+	// onChange is told about transitions made by Record
+	onChange func(from, to State)
+}
+
+// Ticket is handed out by Allow for an admitted call, and handed back to
+// Record or Release with its result
+type Ticket struct {
+	// State is the state the call was admitted in
+	State      State
+	generation uint64
+}
+
+func NewBreaker(config BreakerConfig, clk clock.Clock) *Breaker {
+	return &Breaker{config: config, clock: clk}
+}
+
+// OnStateChange registers fn to be called, outside the breaker's lock, when a
+// recorded result moves the breaker to another state
+func (b *Breaker) OnStateChange(fn func(from, to State)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onChange = fn
+}
+
+// State returns the current state, moving an expired open breaker to half-open
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState()
+}
+
+func (b *Breaker) currentState() State {
+	if b.state == StateOpen && b.clock.Since(b.openedAt) >= b.config.OpenTimeout {
+		b.transition(StateHalfOpen)
+	}
+	return b.state
+}
+
+// transition moves the breaker to state, starting a new generation
+func (b *Breaker) transition(state State) {
+	b.state = state
+	b.generation++
+	b.probing = false
+	if state == StateOpen {
+		b.openedAt = b.clock.Now()
+	}
+}
+
+// Allow reports whether a call may proceed, with the ticket its result is
+// recorded with. In the half-open state only the first caller gets through,
+// as the probe.
+func (b *Breaker) Allow() (Ticket, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.currentState()
+	switch state {
+	case StateClosed:
+		return Ticket{State: state, generation: b.generation}, nil
+	case StateHalfOpen:
+		if b.probing {
+			return Ticket{State: state}, ErrBreakerOpen
+		}
+		// Each probe gets a generation of its own, so only its result counts
+		b.probing = true
+		b.generation++
+		return Ticket{State: state, generation: b.generation}, nil
+	default:
+		return Ticket{State: state}, ErrBreakerOpen
+	}
+}
+
+// Release gives back an allowed call that was never made, so a half-open
+// breaker lets another caller probe
+func (b *Breaker) Release(ticket Ticket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ticket.generation == b.generation {
+		b.probing = false
+	}
+}
+
+// Record reports the result of an allowed call. Results of calls admitted
+// before the breaker last changed state are dropped: a call started while
+// closed neither closes an open breaker nor decides a half-open one, which
+// only its probe does.
+func (b *Breaker) Record(ticket Ticket, err error) {
+	b.mu.Lock()
+	from := b.state
+	if ticket.generation == b.generation {
+		b.record(err)
+	}
+	to, onChange := b.state, b.onChange
+	b.mu.Unlock()
+
+	if onChange != nil && from != to {
+		onChange(from, to)
+	}
+}
+
+func (b *Breaker) record(err error) {
+	if err == nil {
+		b.failures = 0
+		if b.state != StateClosed {
+			b.transition(StateClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.config.FailureThreshold {
+		b.transition(StateOpen)
+	}
+}
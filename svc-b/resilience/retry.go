@@ -0,0 +1,150 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"svc-b/clock"
+	"time"
+)
+
+// RetryPolicy bounds how a failed call is retried
+type RetryPolicy struct {
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubling before each
+	// following one
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between retries; 0 leaves it uncapped
+	MaxDelay time.Duration
+	// Jitter shortens each delay by a random fraction of up to Jitter, so
+	// callers failing together don't retry in lockstep. 0 disables it.
+	Jitter float64
+	// Retryable reports whether a failure may be retried; nil uses IsRetryable
+	Retryable func(error) bool
+	// OnRetry, when set, is called with the failed attempt, counting from 1,
+	// and its error before waiting delay to retry it
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// jitter returns a value in [0, 1) for the delay randomization
+var jitter = rand.Float64
+
+// Delay returns how long to wait after the given failed attempt, counting
+// from 1
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if p.MaxDelay > 0 && (delay > p.MaxDelay || delay < p.BaseDelay) {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(float64(delay) * p.Jitter * jitter())
+	}
+	return delay
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// StatusError is an upstream answer whose status code makes it a failure
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("upstream answered status %d", e.Code)
+}
+
+// RetryableStatus reports whether an answer with the status code may succeed
+// if retried: timeouts, throttling and transient server errors
+func RetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsRetryable is the default retry classification: transport errors and
+// retryable status codes are retried, while cancellation, expired deadlines
+// and other status codes are not
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return RetryableStatus(status.Code)
+	}
+	return true
+}
+
+// Do calls fn under the retry policy, consulting the breaker before every
+// attempt so the two layers agree:
+//   - closed: retryable failures are retried up to MaxAttempts with
+//     exponential backoff, stopping early if the failures trip the breaker
+//   - half-open: fn is called exactly once, as the probe, without retries
+//   - open: Do fails immediately with ErrBreakerOpen without calling fn
+//
+// Errors wrapping ErrNotAttempted end Do at once without reaching the breaker,
+// as do failures caused by ctx being canceled or expiring: the caller gave up,
+// which says nothing about the upstream's health.
+//
+// A nil breaker leaves only the retry policy in place. Do returns the number
+// of attempts made.
+// callerGaveUp reports whether err is ctx's own cancellation or expiry, as
+// opposed to a timeout of the call itself
+func callerGaveUp(ctx context.Context, err error) bool {
+	return ctx.Err() != nil && errors.Is(err, ctx.Err())
+}
+
+func Do(ctx context.Context, clk clock.Clock, policy RetryPolicy, breaker *Breaker, fn func(ctx context.Context) error) (int, error) {
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		ticket := Ticket{State: StateClosed}
+		if breaker != nil {
+			var err error
+			if ticket, err = breaker.Allow(); err != nil {
+				if lastErr != nil {
+					return attempt - 1, fmt.Errorf("%w after %d attempt(s): %w", err, attempt-1, lastErr)
+				}
+				return 0, err
+			}
+		}
+
+		lastErr = fn(ctx)
+		if errors.Is(lastErr, ErrNotAttempted) {
+			if breaker != nil {
+				breaker.Release(ticket)
+			}
+			return attempt - 1, lastErr
+		}
+		if callerGaveUp(ctx, lastErr) {
+			if breaker != nil {
+				breaker.Release(ticket)
+			}
+			return attempt, lastErr
+		}
+		if breaker != nil {
+			breaker.Record(ticket, lastErr)
+		}
+		if lastErr == nil || ticket.State == StateHalfOpen || attempt >= policy.MaxAttempts || !policy.retryable(lastErr) {
+			return attempt, lastErr
+		}
+
+		delay := policy.Delay(attempt)
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, delay, lastErr)
+		}
+		if err := clk.Sleep(ctx, delay); err != nil {
+			return attempt, lastErr
+		}
+	}
+}
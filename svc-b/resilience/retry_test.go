@@ -0,0 +1,404 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"svc-b/clock"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errUpstream = errors.New("connection refused")
+
+// recordFailures records n failed calls on breaker, each admitted by Allow
+func recordFailures(breaker *Breaker, n int) {
+	for range n {
+		ticket, _ := breaker.Allow()
+		breaker.Record(ticket, errUpstream)
+	}
+}
+
+// failing returns fn that fails the first failures calls, counting every call
+func failing(failures int, calls *int) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		*calls++
+		if *calls <= failures {
+			return errUpstream
+		}
+		return nil
+	}
+}
+
+func TestDoBreakerRetryInteraction(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond}
+	config := BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}
+
+	tests := []struct {
+		name            string
+		state           State
+		failures        int
+		expectedCalls   int
+		expectedErr     error
+		expectedBreaker State
+	}{
+		{
+			name:            "Closed, first try succeeds",
+			state:           StateClosed,
+			expectedCalls:   1,
+			expectedBreaker: StateClosed,
+		},
+		{
+			name:            "Closed, retried success",
+			state:           StateClosed,
+			failures:        1,
+			expectedCalls:   2,
+			expectedBreaker: StateClosed,
+		},
+		{
+			name:            "Closed, failures trip the breaker mid-retry",
+			state:           StateClosed,
+			failures:        3,
+			expectedCalls:   2,
+			expectedErr:     ErrBreakerOpen,
+			expectedBreaker: StateOpen,
+		},
+		{
+			name:            "Open fails fast",
+			state:           StateOpen,
+			expectedCalls:   0,
+			expectedErr:     ErrBreakerOpen,
+			expectedBreaker: StateOpen,
+		},
+		{
+			name:            "Half-open probe succeeds",
+			state:           StateHalfOpen,
+			expectedCalls:   1,
+			expectedBreaker: StateClosed,
+		},
+		{
+			name:            "Half-open probe fails without retries",
+			state:           StateHalfOpen,
+			failures:        1,
+			expectedCalls:   1,
+			expectedErr:     errUpstream,
+			expectedBreaker: StateOpen,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			breaker := NewBreaker(config, fake)
+			switch tt.state {
+			case StateOpen:
+				recordFailures(breaker, 2)
+			case StateHalfOpen:
+				recordFailures(breaker, 2)
+				fake.Advance(config.OpenTimeout)
+			}
+			if got := breaker.State(); got != tt.state {
+				t.Fatalf("breaker set up in %s, want %s", got, tt.state)
+			}
+
+			calls := 0
+			attempts, err := Do(context.Background(), fake, policy, breaker, failing(tt.failures, &calls))
+
+			if !errors.Is(err, tt.expectedErr) || (tt.expectedErr == nil && err != nil) {
+				t.Errorf("Do() error = %v, want %v", err, tt.expectedErr)
+			}
+			if calls != tt.expectedCalls || attempts != tt.expectedCalls {
+				t.Errorf("made %d calls and reported %d attempts, want %d", calls, attempts, tt.expectedCalls)
+			}
+			if got := breaker.State(); got != tt.expectedBreaker {
+				t.Errorf("breaker ended %s, want %s", got, tt.expectedBreaker)
+			}
+		})
+	}
+}
+
+func TestDoWithoutBreakerRetriesUpToPolicy(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	calls := 0
+	var retried []string
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, OnRetry: func(attempt int, delay time.Duration, err error) {
+		retried = append(retried, fmt.Sprintf("%d after %v: %v", attempt, delay, err))
+	}}
+	attempts, err := Do(context.Background(), fake, policy, nil, failing(5, &calls))
+
+	if !errors.Is(err, errUpstream) || attempts != 3 {
+		t.Errorf("Do() = %d, %v; want 3 attempts failing with %v", attempts, err, errUpstream)
+	}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}
+	if sleeps := fake.Sleeps(); len(sleeps) != len(expected) || sleeps[0] != expected[0] || sleeps[1] != expected[1] {
+		t.Errorf("slept %v, want %v", sleeps, expected)
+	}
+	expectedRetries := []string{"1 after 100ms: " + errUpstream.Error(), "2 after 200ms: " + errUpstream.Error()}
+	if !reflect.DeepEqual(retried, expectedRetries) {
+		t.Errorf("OnRetry calls = %v, want %v", retried, expectedRetries)
+	}
+}
+
+func TestDoStopsOnNotAttempted(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	breaker := NewBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, fake)
+	recordFailures(breaker, 1)
+	fake.Advance(time.Minute)
+
+	notAttempted := fmt.Errorf("quota exhausted: %w", ErrNotAttempted)
+	calls := 0
+	attempts, err := Do(context.Background(), fake, RetryPolicy{MaxAttempts: 3}, breaker, func(ctx context.Context) error {
+		calls++
+		return notAttempted
+	})
+	if !errors.Is(err, ErrNotAttempted) || calls != 1 || attempts != 0 {
+		t.Errorf("Do() = %d, %v after %d calls; want 0 attempts failing with ErrNotAttempted after 1 call", attempts, err, calls)
+	}
+
+	// The half-open probe was given back, so the next caller may probe
+	calls = 0
+	if _, err := Do(context.Background(), fake, RetryPolicy{MaxAttempts: 3}, breaker, failing(0, &calls)); err != nil || calls != 1 {
+		t.Errorf("next probe got %v after %d calls, want success after 1 call", err, calls)
+	}
+}
+
+func TestHalfOpenAllowsSingleConcurrentProbe(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	breaker := NewBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, fake)
+	recordFailures(breaker, 1)
+	fake.Advance(time.Minute)
+
+	release := make(chan struct{})
+	probeStarted := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		Do(context.Background(), fake, RetryPolicy{MaxAttempts: 3}, breaker, func(ctx context.Context) error {
+			close(probeStarted)
+			<-release
+			return nil
+		})
+	}()
+	<-probeStarted
+
+	calls := 0
+	if _, err := Do(context.Background(), fake, RetryPolicy{MaxAttempts: 3}, breaker, failing(0, &calls)); !errors.Is(err, ErrBreakerOpen) || calls != 0 {
+		t.Errorf("second caller during the probe got %v after %d calls, want ErrBreakerOpen without calling", err, calls)
+	}
+
+	close(release)
+	wg.Wait()
+	if got := breaker.State(); got != StateClosed {
+		t.Errorf("breaker ended %s after a successful probe, want closed", got)
+	}
+}
+
+func TestBreakerReportsStateChanges(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	breaker := NewBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}, fake)
+	var changes []string
+	breaker.OnStateChange(func(from, to State) {
+		changes = append(changes, from.String()+"->"+to.String())
+	})
+
+	recordFailures(breaker, 2)
+	fake.Advance(time.Minute)
+	probe, _ := breaker.Allow()
+	breaker.Record(probe, errUpstream)
+	fake.Advance(time.Minute)
+	probe, _ = breaker.Allow()
+	breaker.Record(probe, nil)
+
+	want := []string{"closed->open", "half_open->open", "half_open->closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("state changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("state changes = %v, want %v", changes, want)
+			break
+		}
+	}
+}
+
+func TestBreakerDropsStaleResults(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Stale success while open", func(t *testing.T) {
+		t.Parallel()
+
+		fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		breaker := NewBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}, fake)
+		slow, _ := breaker.Allow()
+		recordFailures(breaker, 2)
+
+		breaker.Record(slow, nil)
+		if got := breaker.State(); got != StateOpen {
+			t.Errorf("breaker = %s after a call admitted before it opened succeeded, want open", got)
+		}
+	})
+
+	t.Run("Stale failure while half-open", func(t *testing.T) {
+		t.Parallel()
+
+		fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		breaker := NewBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}, fake)
+		slow, _ := breaker.Allow()
+		recordFailures(breaker, 2)
+		fake.Advance(time.Minute)
+		probe, err := breaker.Allow()
+		if err != nil || probe.State != StateHalfOpen {
+			t.Fatalf("Allow() = %s, %v; want the half-open probe", probe.State, err)
+		}
+
+		breaker.Record(slow, errUpstream)
+		if got := breaker.State(); got != StateHalfOpen {
+			t.Errorf("breaker = %s after a call admitted before it opened failed, want half_open", got)
+		}
+		breaker.Record(probe, nil)
+		if got := breaker.State(); got != StateClosed {
+			t.Errorf("breaker = %s after the probe succeeded, want closed", got)
+		}
+	})
+
+	t.Run("Released probe", func(t *testing.T) {
+		t.Parallel()
+
+		fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		breaker := NewBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, fake)
+		recordFailures(breaker, 1)
+		fake.Advance(time.Minute)
+		released, _ := breaker.Allow()
+		breaker.Release(released)
+		probe, _ := breaker.Allow()
+
+		breaker.Record(released, errUpstream)
+		breaker.Release(released)
+		if got := breaker.State(); got != StateHalfOpen {
+			t.Errorf("breaker = %s after a released probe failed, want half_open", got)
+		}
+		if _, err := breaker.Allow(); !errors.Is(err, ErrBreakerOpen) {
+			t.Errorf("Allow() during the second probe = %v, want ErrBreakerOpen", err)
+		}
+		breaker.Record(probe, errUpstream)
+		if got := breaker.State(); got != StateOpen {
+			t.Errorf("breaker = %s after the probe failed, want open", got)
+		}
+	})
+}
+
+func TestDoDoesNotBlameTheUpstreamForCancellation(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	breaker := NewBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts, err := Do(ctx, fake, RetryPolicy{MaxAttempts: 3}, breaker, func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) || attempts != 1 {
+		t.Errorf("Do() = %d, %v; want 1 attempt failing with context.Canceled", attempts, err)
+	}
+	if got := breaker.State(); got != StateClosed {
+		t.Errorf("breaker = %s after the caller canceled, want closed", got)
+	}
+
+	// A timeout of the call itself, with the caller still waiting, is a failure
+	timeout := fmt.Errorf("client timeout: %w", context.DeadlineExceeded)
+	Do(context.Background(), fake, RetryPolicy{MaxAttempts: 1}, breaker, func(ctx context.Context) error { return timeout })
+	if got := breaker.State(); got != StateOpen {
+		t.Errorf("breaker = %s after the call timed out, want open", got)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		expected []time.Duration
+	}{
+		{"Doubles", RetryPolicy{BaseDelay: 100 * time.Millisecond}, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond}},
+		{"Capped", RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}},
+		{"Capped on overflow", RetryPolicy{BaseDelay: time.Hour, MaxDelay: 2 * time.Hour}, []time.Duration{time.Hour, 2 * time.Hour, 2 * time.Hour, 2 * time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			for i, want := range tt.expected {
+				if got := tt.policy.Delay(i + 1); got != want {
+					t.Errorf("Delay(%d) = %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("Jitter shortens within bounds", func(t *testing.T) {
+		t.Parallel()
+
+		policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, Jitter: 0.5}
+		seen := make(map[time.Duration]bool)
+		for range 100 {
+			got := policy.Delay(2)
+			if got <= 100*time.Millisecond || got > 200*time.Millisecond {
+				t.Fatalf("Delay(2) = %v, want within (100ms, 200ms]", got)
+			}
+			seen[got] = true
+		}
+		if len(seen) < 2 {
+			t.Error("Delay() never varied, want jittered delays")
+		}
+	})
+}
+
+func TestDoRetriesOnlyRetryableFailures(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		err           error
+		expectedCalls int
+	}{
+		{"Transport error", errUpstream, 3},
+		{"Retryable status", &StatusError{Code: 503}, 3},
+		{"Non-retryable status", &StatusError{Code: 501}, 1},
+		{"Canceled", fmt.Errorf("request failed: %w", context.Canceled), 1},
+		{"Deadline exceeded", context.DeadlineExceeded, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			calls := 0
+			_, err := Do(context.Background(), fake, RetryPolicy{MaxAttempts: 3}, nil, func(ctx context.Context) error {
+				calls++
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) || calls != tt.expectedCalls {
+				t.Errorf("Do() = %v after %d calls, want %v after %d", err, calls, tt.err, tt.expectedCalls)
+			}
+		})
+	}
+}
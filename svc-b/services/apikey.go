@@ -0,0 +1,38 @@
+package services
+
+import "net/http"
+
+// WeatherAPIKeyHeader is the header WeatherAPI reads the API key from, kept
+// out of the query string so the key never shows up in a logged or traced URL
+const WeatherAPIKeyHeader = "key"
+
+// APIKey is the key a provider authenticates requests with, sent in Header
+type APIKey struct {
+	Header string
+	Value  string
+}
+
+// apiKeyTransport sets the API key of the hosts it knows on their requests
+type apiKeyTransport struct {
+	next http.RoundTripper
+	keys map[string]APIKey
+}
+
+// NewAPIKeyTransport wraps next so requests to the hosts in keys carry their
+// API key in its header, unless the request already sets one. Requests to
+// other hosts, and keys without a value, pass through untouched.
+func NewAPIKeyTransport(next http.RoundTripper, keys map[string]APIKey) http.RoundTripper {
+	return &apiKeyTransport{next: next, keys: keys}
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, ok := t.keys[req.URL.Hostname()]
+	if !ok || key.Value == "" || req.Header.Get(key.Header) != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set(key.Header, key.Value)
+	return t.next.RoundTrip(req)
+}
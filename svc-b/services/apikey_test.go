@@ -0,0 +1,164 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"pkg/telemetry/telemetrytest"
+	"strings"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/resilience"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestAPIKeyTransport(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		host        string
+		header      string
+		expectedKey string
+	}{
+		{"Known host gets its key", "api.weatherapi.com", "", "svc-b-key"},
+		{"Key already set kept", "api.weatherapi.com", "their-key", "their-key"},
+		{"Other host untouched", "viacep.com.br", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var sent *http.Request
+			transport := NewAPIKeyTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				sent = req
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			}), map[string]APIKey{"api.weatherapi.com": {Header: WeatherAPIKeyHeader, Value: "svc-b-key"}})
+
+			req, _ := http.NewRequest(http.MethodGet, "https://"+tt.host+"/v1/current.json?q=Recife", nil)
+			if tt.header != "" {
+				req.Header.Set(WeatherAPIKeyHeader, tt.header)
+			}
+			if _, err := transport.RoundTrip(req); err != nil {
+				t.Fatalf("RoundTrip failed: %v", err)
+			}
+			if got := sent.Header.Get(WeatherAPIKeyHeader); got != tt.expectedKey {
+				t.Errorf("key header = %q, want %q", got, tt.expectedKey)
+			}
+			if tt.header == "" && req.Header.Get(WeatherAPIKeyHeader) != "" {
+				t.Error("the caller's request was modified")
+			}
+			if sent.URL.Query().Has("key") {
+				t.Errorf("key sent in the query: %s", sent.URL)
+			}
+		})
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// TestWeatherAPIKeyNeverLeaks calls WeatherAPI through the client transports
+// svc-b sets up and checks the key reaches no span and no log line. It
+// replaces the default logger, so it doesn't run in parallel.
+func TestWeatherAPIKeyNeverLeaks(t *testing.T) {
+	const apiKey = "weatherapi-secret-key"
+
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		down      bool
+		expectErr bool
+	}{
+		{
+			name: "Answered",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get(WeatherAPIKeyHeader) != apiKey || r.URL.Query().Has("key") {
+					w.WriteHeader(http.StatusUnauthorized)
+					w.Write([]byte(`{"error":{"code":1002,"message":"API key is invalid or not provided."}}`))
+					return
+				}
+				w.Write([]byte(`{"current":{"temp_c":25,"temp_f":77}}`))
+			},
+		},
+		{
+			name: "Key rejected",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":{"code":2006,"message":"API key is invalid."}}`))
+			},
+			expectErr: true,
+		},
+		{
+			name:      "Provider down",
+			handler:   func(w http.ResponseWriter, r *http.Request) {},
+			down:      true,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			previous := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+			defer slog.SetDefault(previous)
+
+			server := httptest.NewServer(tt.handler)
+			if tt.down {
+				server.Close()
+			}
+			defer server.Close()
+
+			recorder := tracetest.NewSpanRecorder()
+			providers := observability.Providers{TracerProvider: telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))}
+			keys := map[string]APIKey{"127.0.0.1": {Header: WeatherAPIKeyHeader, Value: apiKey}}
+			client := &http.Client{Transport: observability.NewClientTransport(NewAPIKeyTransport(http.DefaultTransport, keys), providers)}
+			service := NewWeatherAPIService(client, server.URL, apiKey, providers).
+				WithRetry(resilience.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond})
+
+			temp, err := service.GetTemperature(context.Background(), models.Location{City: "Recife", State: "PE"})
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.expectErr && temp.TempC != 25 {
+				t.Errorf("got temp_C %v, want 25", temp.TempC)
+			}
+
+			spans := recorder.Ended()
+			if len(spans) == 0 {
+				t.Fatal("no spans recorded")
+			}
+			for _, span := range spans {
+				attrs := span.Attributes()
+				for _, event := range span.Events() {
+					attrs = append(attrs, event.Attributes...)
+				}
+				for _, attr := range attrs {
+					if strings.Contains(attr.Value.Emit(), apiKey) {
+						t.Errorf("span %s: attribute %s leaks the API key: %s", span.Name(), attr.Key, attr.Value.Emit())
+					}
+				}
+				if strings.Contains(span.Status().Description, apiKey) {
+					t.Errorf("span %s: status leaks the API key: %s", span.Name(), span.Status().Description)
+				}
+			}
+			if strings.Contains(logs.String(), apiKey) {
+				t.Errorf("logs leak the API key:\n%s", logs.String())
+			}
+			if err != nil && strings.Contains(err.Error(), apiKey) {
+				t.Errorf("error leaks the API key: %v", err)
+			}
+		})
+	}
+}
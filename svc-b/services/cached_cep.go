@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"path"
+	"svc-b/cache"
+	"svc-b/models"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CachedCEPService serves addresses from a cache in front of a CEP provider,
+// keyed by the normalized CEP. CEP data rarely changes, so a long TTL spares
+// most repeated lookups the call to the provider.
+type CachedCEPService struct {
+	next  CEPService
+	cache *cache.Memory[models.Address]
+}
+
+func NewCachedCEPService(next CEPService, cache *cache.Memory[models.Address]) *CachedCEPService {
+	return &CachedCEPService{next: next, cache: cache}
+}
+
+// GetAddressByCEP serves cached addresses, caching only successful lookups so
+// a CEP added upstream is found as soon as it exists
+func (s *CachedCEPService) GetAddressByCEP(ctx context.Context, cep string) (*models.Address, error) {
+	key := normalizeCEP(cep)
+
+	address, hit := s.cache.Get(ctx, key)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cep.cache_hit", hit))
+	if hit {
+		return &address, nil
+	}
+
+	fetched, err := s.next.GetAddressByCEP(ctx, cep)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Set(ctx, key, *fetched)
+	return fetched, nil
+}
+
+// Invalidate drops the cached address for cep
+func (s *CachedCEPService) Invalidate(ctx context.Context, cep string) bool {
+	return s.cache.Delete(ctx, normalizeCEP(cep))
+}
+
+// InvalidateMatching drops the cached addresses of every CEP matching the glob
+// pattern (path.Match syntax), e.g. 01* for a whole region
+func (s *CachedCEPService) InvalidateMatching(ctx context.Context, pattern string) (int, error) {
+	pattern = normalizeCEP(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, err
+	}
+	return s.cache.DeleteMatching(ctx, func(key string) bool {
+		matched, _ := path.Match(pattern, key)
+		return matched
+	}), nil
+}
+
+// Flush drops every cached address
+func (s *CachedCEPService) Flush(ctx context.Context) int {
+	return s.cache.Flush(ctx)
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"svc-b/cache"
+	"svc-b/clock"
+	"svc-b/models"
+	"testing"
+	"time"
+)
+
+// countingCEPService fails for unknown CEPs and counts its calls
+type countingCEPService struct {
+	calls int
+}
+
+func (s *countingCEPService) GetAddressByCEP(ctx context.Context, cep string) (*models.Address, error) {
+	s.calls++
+	if normalizeCEP(cep) == "99999999" {
+		return nil, ErrZipCodeNotFound
+	}
+	return &models.Address{Street: "Avenida Paulista", City: "São Paulo", State: "SP"}, nil
+}
+
+func TestCachedCEPService(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	next := &countingCEPService{}
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := NewCachedCEPService(next, cache.NewMemory[models.Address]("cep", cache.Config{TTL: time.Hour}, fake, nil))
+
+	for _, cep := range []string{"01310-100", "01310100", "01.310-100"} {
+		address, err := service.GetAddressByCEP(ctx, cep)
+		if err != nil || address.City != "São Paulo" || address.Street != "Avenida Paulista" {
+			t.Fatalf("GetAddressByCEP(%q) = %+v, %v", cep, address, err)
+		}
+	}
+	if next.calls != 1 {
+		t.Errorf("provider called %d times, want 1 for the same normalized CEP", next.calls)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.GetAddressByCEP(ctx, "99999-999"); !errors.Is(err, ErrZipCodeNotFound) {
+			t.Fatalf("GetAddressByCEP(99999-999) error = %v, want ErrZipCodeNotFound", err)
+		}
+	}
+	if next.calls != 3 {
+		t.Errorf("provider called %d times, want errors not to be cached", next.calls)
+	}
+
+	if !service.Invalidate(context.Background(), "01310-100") {
+		t.Error("Invalidate(01310-100) = false, want the cached entry removed")
+	}
+	service.GetAddressByCEP(ctx, "01310100")
+	fake.Advance(time.Hour)
+	service.GetAddressByCEP(ctx, "01310100")
+	if next.calls != 5 {
+		t.Errorf("provider called %d times, want a refetch after invalidation and after the TTL", next.calls)
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"path"
+	"strings"
+	"svc-b/cache"
+	"svc-b/models"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CachedWeatherService serves temperatures from a cache in front of a
+// weather provider, keyed by the normalized location, e.g. "sorocaba, sp"
+type CachedWeatherService struct {
+	next  WeatherService
+	cache cache.Store[models.Temperature]
+}
+
+func NewCachedWeatherService(next WeatherService, cache cache.Store[models.Temperature]) *CachedWeatherService {
+	return &CachedWeatherService{next: next, cache: cache}
+}
+
+// GetTemperature serves cached temperatures, letting a single caller refresh
+// a hot city shortly before its entry expires so its expiry doesn't send every
+// concurrent request to the provider at once
+func (s *CachedWeatherService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	key := weatherCacheKey(location.String())
+
+	temp, hit, refresh := s.cache.Lookup(ctx, key)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Bool("weather.cache_hit", hit),
+		attribute.Bool("weather.cache_early_refresh", refresh),
+	)
+	if hit && !refresh {
+		return &temp, nil
+	}
+
+	start := time.Now()
+	fetched, err := s.next.GetTemperature(ctx, location)
+	if err != nil {
+		if refresh {
+			// The cached value is still live, so a failed early refresh isn't fatal
+			s.cache.CancelRefresh(ctx, key)
+			return &temp, nil
+		}
+		return nil, err
+	}
+	s.cache.SetWithCost(ctx, key, *fetched, time.Since(start))
+	return fetched, nil
+}
+
+// GetForecast passes forecasts through uncached, as they are requested for
+// varying spans of days
+func (s *CachedWeatherService) GetForecast(ctx context.Context, location models.Location, days int) ([]models.DailyForecast, error) {
+	forecaster, ok := s.next.(ForecastService)
+	if !ok {
+		return nil, ErrForecastUnsupported
+	}
+	return forecaster.GetForecast(ctx, location, days)
+}
+
+// Calibration pairs the temperature cached for a location with a live one
+type Calibration struct {
+	// Cached is nil when the location isn't cached
+	Cached *models.Temperature
+	Live   models.Temperature
+}
+
+// Calibrate reads the cached temperature for location and fetches a live one
+// from the provider, leaving the cache untouched either way
+func (s *CachedWeatherService) Calibrate(ctx context.Context, location models.Location) (Calibration, error) {
+	var calibration Calibration
+	if temp, ok := s.cache.Get(ctx, weatherCacheKey(location.String())); ok {
+		calibration.Cached = &temp
+	}
+	live, err := s.next.GetTemperature(ctx, location)
+	if err != nil {
+		return Calibration{}, err
+	}
+	calibration.Live = *live
+	return calibration, nil
+}
+
+// Invalidate drops the cached temperature for a location, given as "City, UF"
+// (or City for cities looked up without a state)
+func (s *CachedWeatherService) Invalidate(ctx context.Context, location string) bool {
+	return s.cache.Delete(ctx, weatherCacheKey(location))
+}
+
+// InvalidateMatching drops the cached temperatures of every location matching the glob pattern (path.Match syntax), compared case-insensitively
+func (s *CachedWeatherService) InvalidateMatching(ctx context.Context, pattern string) (int, error) {
+	pattern = weatherCacheKey(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, err
+	}
+	return s.cache.DeleteMatching(ctx, func(key string) bool {
+		matched, _ := path.Match(pattern, key)
+		return matched
+	}), nil
+}
+
+// Flush drops every cached temperature
+func (s *CachedWeatherService) Flush(ctx context.Context) int {
+	return s.cache.Flush(ctx)
+}
+
+func weatherCacheKey(location string) string {
+	return strings.ToLower(strings.TrimSpace(location))
+}
+
+// Name reports the cached provider's name
+func (s *CachedWeatherService) Name() string {
+	if provider, ok := s.next.(WeatherProvider); ok {
+		return provider.Name()
+	}
+	return "unknown"
+}
+
+// Capabilities reports the cached provider's capabilities
+func (s *CachedWeatherService) Capabilities() Capabilities {
+	if provider, ok := s.next.(WeatherProvider); ok {
+		return provider.Capabilities()
+	}
+	return Capabilities{}
+}
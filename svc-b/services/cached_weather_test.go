@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"svc-b/cache"
+	"svc-b/clock"
+	"svc-b/models"
+	"testing"
+	"time"
+)
+
+// countingWeatherService fails for unknown cities and counts its calls
+type countingWeatherService struct {
+	calls int
+}
+
+func (s *countingWeatherService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	s.calls++
+	if location.City == "Atlantis" {
+		return nil, ErrCityNotFound
+	}
+	return &models.Temperature{TempC: 25, TempF: 77, TempK: 298.15}, nil
+}
+
+func TestCachedWeatherService(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	next := &countingWeatherService{}
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := NewCachedWeatherService(next, cache.NewMemory[models.Temperature]("weather", cache.Config{TTL: time.Minute}, fake, nil))
+
+	for _, city := range []string{"Rio de Janeiro", " rio de janeiro "} {
+		temp, err := service.GetTemperature(ctx, models.Location{City: city})
+		if err != nil || temp.TempC != 25 {
+			t.Fatalf("GetTemperature(%q) = %+v, %v", city, temp, err)
+		}
+	}
+	if next.calls != 1 {
+		t.Errorf("provider called %d times, want 1 for the same normalized city", next.calls)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.GetTemperature(ctx, models.Location{City: "Atlantis"}); !errors.Is(err, ErrCityNotFound) {
+			t.Fatalf("GetTemperature(Atlantis) error = %v, want ErrCityNotFound", err)
+		}
+	}
+	if next.calls != 3 {
+		t.Errorf("provider called %d times, want errors not to be cached", next.calls)
+	}
+
+	fake.Advance(time.Minute)
+	service.GetTemperature(ctx, models.Location{City: "Rio de Janeiro"})
+	if next.calls != 4 {
+		t.Errorf("provider called %d times, want a refetch after the TTL", next.calls)
+	}
+}
+
+func TestCachedWeatherServiceKeysByState(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	next := &countingWeatherService{}
+	memory := cache.NewMemory[models.Temperature]("weather", cache.Config{TTL: time.Minute}, clock.NewFake(time.Now()), nil)
+	service := NewCachedWeatherService(next, memory)
+
+	for _, state := range []string{"SP", "MG", "SP"} {
+		service.GetTemperature(ctx, models.Location{City: "São Francisco", State: state})
+	}
+	if next.calls != 2 {
+		t.Errorf("provider called %d times, want once per state", next.calls)
+	}
+	if !service.Invalidate(context.Background(), "São Francisco, MG") || memory.Len() != 1 {
+		t.Errorf("Invalidate(São Francisco, MG) left %d entries, want the SP one", memory.Len())
+	}
+}
+
+// flakyWeatherService fails once failing is set
+type flakyWeatherService struct {
+	failing bool
+}
+
+func (s *flakyWeatherService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	if s.failing {
+		return nil, ErrWeatherAPIFailed
+	}
+	return &models.Temperature{TempC: 25}, nil
+}
+
+func TestCachedWeatherServiceServesCurrentValueWhenEarlyRefreshFails(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	next := &flakyWeatherService{}
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	// Beta large enough that every lookup close to expiry refreshes early
+	service := NewCachedWeatherService(next, cache.NewMemory[models.Temperature]("weather", cache.Config{TTL: time.Minute, Beta: 1e12}, fake, nil))
+
+	if _, err := service.GetTemperature(ctx, models.Location{City: "Rio de Janeiro"}); err != nil {
+		t.Fatalf("GetTemperature failed: %v", err)
+	}
+
+	next.failing = true
+	fake.Advance(59 * time.Second)
+	temp, err := service.GetTemperature(ctx, models.Location{City: "Rio de Janeiro"})
+	if err != nil || temp.TempC != 25 {
+		t.Errorf("GetTemperature() = %+v, %v; want the still-live cached value", temp, err)
+	}
+}
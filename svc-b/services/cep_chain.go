@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"svc-b/deadline"
+	"svc-b/models"
+	"svc-b/observability"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NamedCEPService is a CEP provider in a CEPServiceChain
+type NamedCEPService struct {
+	Name    string
+	Service CEPService
+}
+
+// CEPServiceChain looks CEPs up on several providers in order, so an outage
+// of one doesn't take svc-b down. A provider's not-found is not trusted on its
+// own, as the providers' databases differ: the next provider is asked too.
+type CEPServiceChain struct {
+	providers []NamedCEPService
+	tracer    trace.Tracer
+}
+
+func NewCEPServiceChain(providers []NamedCEPService, telemetry observability.Providers) *CEPServiceChain {
+	return &CEPServiceChain{providers: providers, tracer: telemetry.Tracer("cep-chain")}
+}
+
+// GetAddressByCEP returns the address from the first provider that finds it. When
+// none does, the CEP is reported not found if any provider said so; otherwise
+// every provider failed and their errors are returned.
+func (c *CEPServiceChain) GetAddressByCEP(ctx context.Context, cep string) (*models.Address, error) {
+	ctx, span := c.tracer.Start(ctx, observability.SpanCEPChainGetCityByCEP.Name)
+	defer span.End()
+
+	var (
+		tried    []string
+		errs     []error
+		notFound bool
+	)
+	for i, provider := range c.providers {
+		tried = append(tried, provider.Name)
+		// Each provider gets an even share of what the previous ones left,
+		// so a slow one can't leave the next without time
+		providerCtx, cancel := deadline.Child(ctx, deadline.Share(len(c.providers)-i))
+		address, err := provider.Service.GetAddressByCEP(providerCtx, cep)
+		cancel()
+		if err == nil {
+			span.SetAttributes(
+				attribute.String("cep.provider", provider.Name),
+				attribute.StringSlice("cep.providers_tried", tried),
+			)
+			return address, nil
+		}
+		// Every provider would reject the CEP alike, and a cancelled request
+		// has nobody left to answer
+		if errors.Is(err, ErrInvalidZipCode) || ctx.Err() != nil {
+			span.SetAttributes(attribute.StringSlice("cep.providers_tried", tried))
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+
+		if errors.Is(err, ErrZipCodeNotFound) {
+			notFound = true
+		} else {
+			slog.WarnContext(ctx, "Provedor de CEP falhou, tentando o próximo", "provider", provider.Name, "error", err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name, err))
+	}
+
+	span.SetAttributes(attribute.StringSlice("cep.providers_tried", tried))
+	if notFound {
+		span.SetStatus(codes.Error, ErrZipCodeNotFound.Error())
+		return nil, ErrZipCodeNotFound
+	}
+	err := fmt.Errorf("all CEP providers failed: %w", errors.Join(errs...))
+	recordFailure(span, err)
+	return nil, err
+}
+
+// ParseCEPProviders parses CEP_PROVIDERS, a comma-separated provider order,
+// e.g. viacep,brasilapi,opencep
+func ParseCEPProviders(raw string) ([]string, error) {
+	known := map[string]bool{CEPProviderViaCEP: true, CEPProviderBrasilAPI: true, CEPProviderOpenCEP: true}
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("unknown CEP provider %q: want viacep, brasilapi or opencep", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("CEP provider %q listed twice", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no CEP provider configured")
+	}
+	return names, nil
+}
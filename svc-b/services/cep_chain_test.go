@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"svc-b/deadline"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/resilience"
+	"testing"
+	"time"
+)
+
+// stubCEPService answers every lookup alike, recording that it was asked
+type stubCEPService struct {
+	city  string
+	err   error
+	asked *[]string
+	name  string
+}
+
+func (s stubCEPService) GetAddressByCEP(ctx context.Context, cep string) (*models.Address, error) {
+	*s.asked = append(*s.asked, s.name)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.Address{City: s.city}, nil
+}
+
+func TestCEPServiceChain(t *testing.T) {
+	t.Parallel()
+
+	type answer struct {
+		city string
+		err  error
+	}
+	down := errors.New("connection refused")
+
+	tests := []struct {
+		name          string
+		answers       []answer
+		expectedCity  string
+		expectedErr   error
+		expectedAsked []string
+	}{
+		{"First provider answers", []answer{{"São Paulo", nil}, {"", down}}, "São Paulo", nil, []string{"viacep"}},
+		{"Falls back on an outage", []answer{{"", resilience.ErrBreakerOpen}, {"São Paulo", nil}}, "São Paulo", nil, []string{"viacep", "brasilapi"}},
+		{"A not-found is checked with the next provider", []answer{{"", ErrZipCodeNotFound}, {"", down}, {"Curvelo", nil}}, "Curvelo", nil, []string{"viacep", "brasilapi", "opencep"}},
+		{"Not found once nobody finds it", []answer{{"", down}, {"", ErrZipCodeNotFound}, {"", ErrZipCodeNotFound}}, "", ErrZipCodeNotFound, []string{"viacep", "brasilapi", "opencep"}},
+		{"Every provider down", []answer{{"", resilience.ErrBreakerOpen}, {"", down}, {"", down}}, "", resilience.ErrBreakerOpen, []string{"viacep", "brasilapi", "opencep"}},
+		{"Invalid CEPs stop the chain", []answer{{"", ErrInvalidZipCode}, {"São Paulo", nil}}, "", ErrInvalidZipCode, []string{"viacep"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var asked []string
+			var providers []NamedCEPService
+			for i, a := range tt.answers {
+				name := []string{CEPProviderViaCEP, CEPProviderBrasilAPI, CEPProviderOpenCEP}[i]
+				providers = append(providers, NamedCEPService{Name: name, Service: stubCEPService{city: a.city, err: a.err, asked: &asked, name: name}})
+			}
+			chain := NewCEPServiceChain(providers, observability.Providers{})
+
+			address, err := chain.GetAddressByCEP(context.Background(), "01001000")
+			var city string
+			if address != nil {
+				city = address.City
+			}
+			if city != tt.expectedCity || !errors.Is(err, tt.expectedErr) || (tt.expectedErr == nil) != (err == nil) {
+				t.Errorf("GetAddressByCEP() = %+v, %v; want %q, %v", address, err, tt.expectedCity, tt.expectedErr)
+			}
+			if !reflect.DeepEqual(asked, tt.expectedAsked) {
+				t.Errorf("asked %v, want %v", asked, tt.expectedAsked)
+			}
+		})
+	}
+}
+
+// timeoutCEPService fails as a provider that hangs, recording the time it had
+type timeoutCEPService struct {
+	budgets *[]time.Duration
+}
+
+func (s timeoutCEPService) GetAddressByCEP(ctx context.Context, cep string) (*models.Address, error) {
+	remaining, _ := deadline.Remaining(ctx)
+	*s.budgets = append(*s.budgets, remaining)
+	return nil, context.DeadlineExceeded
+}
+
+func TestCEPServiceChainSplitsBudget(t *testing.T) {
+	t.Parallel()
+
+	var budgets []time.Duration
+	var providers []NamedCEPService
+	for _, name := range []string{CEPProviderViaCEP, CEPProviderBrasilAPI, CEPProviderOpenCEP} {
+		providers = append(providers, NamedCEPService{Name: name, Service: timeoutCEPService{budgets: &budgets}})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 9*time.Second)
+	defer cancel()
+
+	if _, err := NewCEPServiceChain(providers, observability.Providers{}).GetAddressByCEP(ctx, "01001000"); err == nil {
+		t.Fatal("GetAddressByCEP() succeeded with every provider timing out")
+	}
+	if len(budgets) != len(providers) {
+		t.Fatalf("asked %d providers, want %d: a provider's timeout must not stop the chain", len(budgets), len(providers))
+	}
+	// Providers failing instantly leave their share to the next ones
+	expected := []time.Duration{3 * time.Second, 4500 * time.Millisecond, 9 * time.Second}
+	for i, got := range budgets {
+		if got > expected[i] || got < expected[i]-time.Second {
+			t.Errorf("provider %d had %v left, want about %v and never more", i+1, got, expected[i])
+		}
+	}
+}
+
+// pathHTTPClient answers each request path with a status and body
+type pathHTTPClient map[string]struct {
+	status int
+	body   string
+}
+
+func (c pathHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	answer, ok := c[req.URL.Path]
+	if !ok {
+		answer.status, answer.body = http.StatusNotFound, `{}`
+	}
+	return &http.Response{StatusCode: answer.status, Body: io.NopCloser(strings.NewReader(answer.body))}, nil
+}
+
+func TestSecondaryCEPProviders(t *testing.T) {
+	t.Parallel()
+
+	client := pathHTTPClient{
+		"/api/cep/v1/01001000": {http.StatusOK, `{"cep":"01001000","state":"SP","city":"São Paulo","neighborhood":"Sé","street":"Praça da Sé"}`},
+		"/v1/01001000.json":    {http.StatusOK, `{"cep":"01001-000","logradouro":"Praça da Sé","bairro":"Sé","localidade":"São Paulo","uf":"SP"}`},
+	}
+	single := resilience.RetryPolicy{MaxAttempts: 1}
+
+	tests := []struct {
+		name     string
+		provider CEPService
+	}{
+		{"BrasilAPI", NewBrasilAPIService(client, "https://brasilapi.com.br/", observability.Providers{}).WithRetry(single)},
+		{"OpenCEP", NewOpenCEPService(client, "https://opencep.com", observability.Providers{}).WithRetry(single)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			expected := models.Address{Street: "Praça da Sé", Neighborhood: "Sé", City: "São Paulo", State: "SP"}
+			if address, err := tt.provider.GetAddressByCEP(context.Background(), "01001-000"); err != nil || *address != expected {
+				t.Errorf("GetAddressByCEP(01001-000) = %+v, %v; want %+v", address, err, expected)
+			}
+			if _, err := tt.provider.GetAddressByCEP(context.Background(), "99999999"); !errors.Is(err, ErrZipCodeNotFound) {
+				t.Errorf("GetAddressByCEP(99999999) error = %v, want ErrZipCodeNotFound", err)
+			}
+		})
+	}
+}
+
+func TestParseCEPProviders(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw       string
+		expected  []string
+		expectErr bool
+	}{
+		{"viacep,brasilapi,opencep", []string{"viacep", "brasilapi", "opencep"}, false},
+		{" BrasilAPI , viacep ", []string{"brasilapi", "viacep"}, false},
+		{"viacep,correios", nil, true},
+		{"viacep,viacep", nil, true},
+		{"", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseCEPProviders(tt.raw)
+			if (err != nil) != tt.expectErr || !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseCEPProviders(%q) = %v, %v; want %v", tt.raw, got, err, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"svc-b/clock"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/resilience"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CEP provider names, as used in CEP_PROVIDERS, events and span attributes
+const (
+	CEPProviderViaCEP    = viaCEPProvider
+	CEPProviderBrasilAPI = "brasilapi"
+	CEPProviderOpenCEP   = "opencep"
+)
+
+// BrasilAPIResponse is the part of BrasilAPI's CEP v1 answer svc-b uses
+type BrasilAPIResponse struct {
+	Cep          string `json:"cep"`
+	State        string `json:"state"`
+	City         string `json:"city"`
+	Neighborhood string `json:"neighborhood"`
+	Street       string `json:"street"`
+}
+
+// OpenCEPResponse is the part of OpenCEP's answer svc-b uses; it follows
+// ViaCEP's format
+type OpenCEPResponse struct {
+	Cep        string `json:"cep"`
+	Logradouro string `json:"logradouro"`
+	Bairro     string `json:"bairro"`
+	Localidade string `json:"localidade"`
+	UF         string `json:"uf"`
+}
+
+// httpCEPProvider is the plumbing shared by the secondary CEP providers: a
+// GET per lookup under the retry policy and breaker, where 404 means the CEP
+// is unknown to the provider
+type httpCEPProvider struct {
+	name    string
+	span    observability.SpanDefinition
+	client  HTTPClient
+	url     string
+	clock   clock.Clock
+	tracer  trace.Tracer
+	retry   resilience.RetryPolicy
+	breaker *resilience.Breaker
+	events  *observability.EventBus
+	// address extracts the address from a 200 answer, with an empty city if
+	// the CEP is unknown
+	address func(body io.Reader) (models.Address, error)
+}
+
+func newHTTPCEPProvider(name, label string, span observability.SpanDefinition, client HTTPClient, url string, providers observability.Providers, address func(io.Reader) (models.Address, error)) httpCEPProvider {
+	p := httpCEPProvider{
+		name:    name,
+		span:    span,
+		client:  client,
+		url:     url,
+		clock:   clock.Real{},
+		tracer:  providers.Tracer(name + "-service"),
+		retry:   DefaultRetry,
+		events:  providers.Events,
+		address: address,
+	}
+	p.setBreaker(DefaultBreaker, label)
+	return p
+}
+
+func (p *httpCEPProvider) setBreaker(config resilience.BreakerConfig, label string) {
+	p.breaker = resilience.NewBreaker(config, p.clock)
+	p.breaker.OnStateChange(breakerEvents(p.events, p.name, label))
+}
+
+func (p *httpCEPProvider) GetAddressByCEP(ctx context.Context, cep string) (*models.Address, error) {
+	ctx, span := p.tracer.Start(ctx, p.span.Name)
+	defer span.End()
+
+	cep = normalizeCEP(cep)
+	span.SetAttributes(attribute.String("cep", cep), attribute.String("cep.provider", p.name))
+
+	if len(cep) != 8 {
+		span.SetStatus(codes.Error, "invalid zipcode format")
+		return nil, ErrInvalidZipCode
+	}
+
+	url := fmt.Sprintf(p.url, cep)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		recordFailure(span, err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, attempts, err := doUpstream(ctx, p.clock, p.retry, p.breaker, func(ctx context.Context) (*http.Response, error) {
+		return p.client.Do(req)
+	})
+	span.SetAttributes(
+		attribute.Int("attempts", attempts),
+		attribute.String("breaker.state", p.breaker.State().String()),
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "Erro ao consultar provedor de CEP", "provider", p.name, "error", err)
+		recordBreakerOpen(span, p.name, err)
+		recordFailure(span, err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.WarnContext(ctx, "Status code inválido do provedor de CEP", "provider", p.name, "status", resp.StatusCode)
+		recordFailure(span, fmt.Errorf("invalid status code: %d", resp.StatusCode))
+		return nil, ErrZipCodeNotFound
+	}
+
+	address, err := p.address(resp.Body)
+	if err != nil {
+		slog.ErrorContext(ctx, "Erro ao decodificar resposta do provedor de CEP", "provider", p.name, "error", err)
+		recordFailure(span, err)
+		if errors.Is(err, ErrUpstreamResponseTooLarge) {
+			return nil, err
+		}
+		return nil, ErrInternalServer
+	}
+	if address.City == "" {
+		span.SetStatus(codes.Error, "zipcode not found")
+		return nil, ErrZipCodeNotFound
+	}
+
+	span.SetAttributes(attribute.String("city", address.City))
+	return &address, nil
+}
+
+// BrasilAPIService looks CEPs up on BrasilAPI, which aggregates several CEP
+// sources
+type BrasilAPIService struct {
+	httpCEPProvider
+}
+
+// NewBrasilAPIService creates the BrasilAPI client for the API at baseURL, e.g. https://brasilapi.com.br
+func NewBrasilAPIService(client HTTPClient, baseURL string, providers observability.Providers) *BrasilAPIService {
+	return &BrasilAPIService{newHTTPCEPProvider(CEPProviderBrasilAPI, "BrasilAPI", observability.SpanBrasilAPIGetCityByCEP,
+		client, strings.TrimRight(baseURL, "/")+"/api/cep/v1/%s", providers,
+		func(body io.Reader) (models.Address, error) {
+			var resp BrasilAPIResponse
+			err := decodeUpstreamJSON(body, &resp)
+			return models.Address{Street: resp.Street, Neighborhood: resp.Neighborhood, City: resp.City, State: resp.State}, err
+		})}
+}
+
+// WithRetry replaces the retry policy
+func (s *BrasilAPIService) WithRetry(policy resilience.RetryPolicy) *BrasilAPIService {
+	s.retry = policy
+	return s
+}
+
+// WithBreaker replaces the circuit breaker with one using config
+func (s *BrasilAPIService) WithBreaker(config resilience.BreakerConfig) *BrasilAPIService {
+	s.setBreaker(config, "BrasilAPI")
+	return s
+}
+
+// OpenCEPService looks CEPs up on OpenCEP, an open mirror of the Correios data
+type OpenCEPService struct {
+	httpCEPProvider
+}
+
+// NewOpenCEPService creates the OpenCEP client for the API at baseURL, e.g. https://opencep.com
+func NewOpenCEPService(client HTTPClient, baseURL string, providers observability.Providers) *OpenCEPService {
+	return &OpenCEPService{newHTTPCEPProvider(CEPProviderOpenCEP, "OpenCEP", observability.SpanOpenCEPGetCityByCEP,
+		client, strings.TrimRight(baseURL, "/")+"/v1/%s.json", providers,
+		func(body io.Reader) (models.Address, error) {
+			var resp OpenCEPResponse
+			err := decodeUpstreamJSON(body, &resp)
+			return models.Address{Street: resp.Logradouro, Neighborhood: resp.Bairro, City: resp.Localidade, State: resp.UF}, err
+		})}
+}
+
+// WithRetry replaces the retry policy
+func (s *OpenCEPService) WithRetry(policy resilience.RetryPolicy) *OpenCEPService {
+	s.retry = policy
+	return s
+}
+
+// WithBreaker replaces the circuit breaker with one using config
+func (s *OpenCEPService) WithBreaker(config resilience.BreakerConfig) *OpenCEPService {
+	s.setBreaker(config, "OpenCEP")
+	return s
+}
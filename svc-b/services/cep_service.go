@@ -2,18 +2,19 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
-	"time"
+	"svc-b/clock"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/resilience"
 
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -32,101 +33,132 @@ type ViaCEPResponse struct {
 	Erro        bool   `json:"erro"`
 }
 
+// viaCEPProvider names ViaCEP in events and span attributes
+const viaCEPProvider = "viacep"
+
 type ViaCEPService struct {
 	client  HTTPClient
 	baseURL string
+	clock   clock.Clock
+	tracer  trace.Tracer
+	retry   resilience.RetryPolicy
+	breaker *resilience.Breaker
+	events  *observability.EventBus
 }
 
-func NewViaCEPService(client HTTPClient) *ViaCEPService {
-	return &ViaCEPService{
+// NewViaCEPService creates the ViaCEP client for the API at baseURL, e.g. https://viacep.com.br
+func NewViaCEPService(client HTTPClient, baseURL string, providers observability.Providers) *ViaCEPService {
+	s := &ViaCEPService{
 		client:  client,
-		baseURL: "https://viacep.com.br/ws/%s/json/",
+		baseURL: strings.TrimRight(baseURL, "/") + "/ws/%s/json/",
+		clock:   clock.Real{},
+		tracer:  providers.Tracer("viacep-service"),
+		retry:   DefaultRetry,
+		events:  providers.Events,
 	}
+	return s.WithBreaker(DefaultBreaker)
+}
+
+// WithRetry replaces the retry policy
+func (s *ViaCEPService) WithRetry(policy resilience.RetryPolicy) *ViaCEPService {
+	s.retry = policy
+	return s
+}
+
+// WithBreaker replaces the circuit breaker with one using config
+func (s *ViaCEPService) WithBreaker(config resilience.BreakerConfig) *ViaCEPService {
+	s.breaker = resilience.NewBreaker(config, s.clock)
+	s.breaker.OnStateChange(breakerEvents(s.events, viaCEPProvider, "ViaCEP"))
+	return s
 }
 
-func (s *ViaCEPService) GetCityByCEP(ctx context.Context, cep string) (string, error) {
-	tracer := otel.Tracer("viacep-service")
-	ctx, span := tracer.Start(ctx, "ViaCEP-GetCityByCEP")
+func (s *ViaCEPService) GetAddressByCEP(ctx context.Context, cep string) (*models.Address, error) {
+	ctx, span := s.tracer.Start(ctx, observability.SpanViaCEPGetCityByCEP.Name)
 	defer span.End()
 
-	// Normalize CEP by removing non-numeric characters
-	cep = strings.ReplaceAll(cep, "-", "")
-	cep = strings.ReplaceAll(cep, ".", "")
+	cep = normalizeCEP(cep)
 
-	log.Printf("Buscando CEP: %s", cep)
+	slog.InfoContext(ctx, "Buscando CEP", "cep", cep)
 	span.SetAttributes(attribute.String("cep", cep))
 
 	if len(cep) != 8 {
 		span.SetStatus(codes.Error, "invalid zipcode format")
-		return "", ErrInvalidZipCode
+		return nil, ErrInvalidZipCode
 	}
 
 	url := fmt.Sprintf(s.baseURL, cep)
-	log.Printf("Fazendo requisição para: %s", url)
-	span.SetAttributes(attribute.String("url", url))
-
-	// Create a context with timeout if not already set
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
+	slog.DebugContext(ctx, "Fazendo requisição para a ViaCEP", "url", url)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		log.Printf("Erro ao criar requisição: %v", err)
-		span.SetStatus(codes.Error, err.Error())
-		return "", fmt.Errorf("failed to create request: %w", err)
+		slog.ErrorContext(ctx, "Erro ao criar requisição", "error", err)
+		recordFailure(span, err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := s.client.Do(req)
+	// Failures are retried with backoff and count against the breaker, which
+	// fails calls fast while ViaCEP is down
+	resp, attempts, err := doUpstream(ctx, s.clock, s.retry, s.breaker, func(ctx context.Context) (*http.Response, error) {
+		return s.client.Do(req)
+	})
+	span.SetAttributes(
+		attribute.Int("attempts", attempts),
+		attribute.String("breaker.state", s.breaker.State().String()),
+	)
 	if err != nil {
-		log.Printf("Erro ao fazer requisição: %v", err)
-		span.SetStatus(codes.Error, err.Error())
-		return "", fmt.Errorf("failed to send request: %w", err)
+		slog.ErrorContext(ctx, "Erro ao fazer requisição", "error", err)
+		recordBreakerOpen(span, viaCEPProvider, err)
+		recordFailure(span, err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
-
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Status code inválido: %d", resp.StatusCode)
-		span.SetStatus(codes.Error, fmt.Sprintf("invalid status code: %d", resp.StatusCode))
-		return "", ErrZipCodeNotFound
+		slog.WarnContext(ctx, "Status code inválido da ViaCEP", "status", resp.StatusCode)
+		recordFailure(span, fmt.Errorf("invalid status code: %d", resp.StatusCode))
+		return nil, ErrZipCodeNotFound
 	}
 
-	// Read response body
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Erro ao ler corpo da resposta: %v", err)
-		span.SetStatus(codes.Error, err.Error())
-		return "", ErrInternalServer
+	// Parse response, bounded so a misbehaving upstream can't exhaust memory
+	var viacepResponse ViaCEPResponse
+	if err := decodeUpstreamJSON(resp.Body, &viacepResponse); err != nil {
+		slog.ErrorContext(ctx, "Erro ao decodificar resposta JSON", "error", err)
+		recordFailure(span, err)
+		if errors.Is(err, ErrUpstreamResponseTooLarge) {
+			return nil, err
+		}
+		return nil, ErrInternalServer
 	}
 
 	// Log response for debugging
-	bodyString := string(bodyBytes)
-	log.Printf("Resposta da API ViaCEP: %s", bodyString)
-
-	// Parse response
-	var viacepResponse ViaCEPResponse
-	if err := json.Unmarshal(bodyBytes, &viacepResponse); err != nil {
-		log.Printf("Erro ao decodificar resposta JSON: %v", err)
-		span.SetStatus(codes.Error, err.Error())
-		return "", ErrInternalServer
-	}
+	slog.DebugContext(ctx, "Resposta da API ViaCEP", "response", viacepResponse)
 
 	// Check for errors reported by the API
 	if viacepResponse.Erro {
-		log.Printf("CEP não encontrado: resposta indica erro")
+		slog.InfoContext(ctx, "CEP não encontrado: resposta indica erro", "cep", cep)
 		span.SetStatus(codes.Error, "zipcode not found")
-		return "", ErrZipCodeNotFound
+		return nil, ErrZipCodeNotFound
 	}
 
 	// Validate city field
 	if viacepResponse.Localidade == "" {
-		log.Printf("CEP sem localidade")
+		slog.WarnContext(ctx, "CEP sem localidade", "cep", cep)
 		span.SetStatus(codes.Error, "empty city in response")
-		return "", ErrZipCodeNotFound
+		return nil, ErrZipCodeNotFound
 	}
 
-	log.Printf("Cidade encontrada: %s", viacepResponse.Localidade)
+	slog.InfoContext(ctx, "Cidade encontrada", "city", viacepResponse.Localidade)
 	span.SetAttributes(attribute.String("city", viacepResponse.Localidade))
-	return viacepResponse.Localidade, nil
+	return &models.Address{
+		Street:       viacepResponse.Logradouro,
+		Neighborhood: viacepResponse.Bairro,
+		City:         viacepResponse.Localidade,
+		State:        viacepResponse.UF,
+	}, nil
+}
+
+// normalizeCEP removes the separators a CEP may be written with
+func normalizeCEP(cep string) string {
+	cep = strings.ReplaceAll(cep, "-", "")
+	return strings.ReplaceAll(cep, ".", "")
 }
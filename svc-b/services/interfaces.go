@@ -8,15 +8,63 @@ import (
 
 // CEPService defines the interface for CEP lookup operations
 type CEPService interface {
-	GetCityByCEP(ctx context.Context, cep string) (string, error)
+	GetAddressByCEP(ctx context.Context, cep string) (*models.Address, error)
 }
 
-// WeatherService defines the interface for weather data operations
+// WeatherService defines the interface for weather data operations. Providers
+// that can't qualify a city by its state look it up by City alone.
 type WeatherService interface {
-	GetTemperature(ctx context.Context, city string) (*models.Temperature, error)
+	GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error)
+}
+
+// MaxForecastDays is the longest forecast WeatherAPI answers
+const MaxForecastDays = 14
+
+// ForecastService is implemented by the weather providers with the forecast
+// capability
+type ForecastService interface {
+	GetForecast(ctx context.Context, location models.Location, days int) ([]models.DailyForecast, error)
 }
 
 // HTTPClient interface allows for mocking the HTTP client in tests
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
+
+// Capability names an optional feature a weather provider may support
+type Capability string
+
+const (
+	CapabilityForecast    Capability = "forecast"
+	CapabilityAirQuality  Capability = "air_quality"
+	CapabilityCoordinates Capability = "coordinates"
+)
+
+// Capabilities describes which optional features a weather provider supports
+type Capabilities struct {
+	Forecast    bool `json:"forecast"`
+	AirQuality  bool `json:"air_quality"`
+	Coordinates bool `json:"coordinates"`
+}
+
+// Supports reports whether the given capability is available
+func (c Capabilities) Supports(capability Capability) bool {
+	switch capability {
+	case CapabilityForecast:
+		return c.Forecast
+	case CapabilityAirQuality:
+		return c.AirQuality
+	case CapabilityCoordinates:
+		return c.Coordinates
+	default:
+		return false
+	}
+}
+
+// WeatherProvider is a WeatherService that reports its name and capabilities,
+// so handlers can reject unsupported features before calling the provider
+type WeatherProvider interface {
+	WeatherService
+	Name() string
+	Capabilities() Capabilities
+}
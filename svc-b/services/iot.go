@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"pkg/telemetry"
+	"strings"
+	"svc-b/clock"
+	"svc-b/models"
+	"svc-b/observability"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WeatherProviderIoT stamps the temperatures answered from sensor readings
+const WeatherProviderIoT = "iot"
+
+// ErrInvalidReading is returned, wrapped with the reason, for sensor readings
+// that can't be stored
+var ErrInvalidReading = errors.New("invalid sensor reading")
+
+// The coldest and hottest temperatures a reading may report, a margin past
+// the records measured on Earth, so a faulty sensor can't serve absurd values
+const (
+	minReadingC = -100.0
+	maxReadingC = 70.0
+)
+
+// maxReadingSkew is how far in the future a reading's time may be, for
+// sensors whose clocks run ahead
+const maxReadingSkew = time.Minute
+
+// SensorReading is a temperature measured on site, keyed by the CEP of the
+// site it was measured at
+type SensorReading struct {
+	CEP string `json:"cep"`
+	// Sensor optionally identifies the device, recorded on spans
+	Sensor string  `json:"sensor,omitempty"`
+	TempC  float64 `json:"temp_C"`
+	// MeasuredAt defaults to when the reading is received
+	MeasuredAt time.Time `json:"measured_at,omitempty"`
+}
+
+// IoTWeatherService answers temperatures from the sensor readings pushed to
+// it, for the CEPs with a reading at most maxAge old, and asks next for the
+// others. It sits in front of the weather cache, so readings are served as
+// soon as they arrive and never cached per city.
+type IoTWeatherService struct {
+	next    WeatherService
+	maxAge  time.Duration
+	clock   clock.Clock
+	tracer  trace.Tracer
+	metrics *telemetry.Recorder
+
+	mu       sync.RWMutex
+	readings map[string]SensorReading
+}
+
+func NewIoTWeatherService(next WeatherService, maxAge time.Duration, providers observability.Providers) *IoTWeatherService {
+	return &IoTWeatherService{
+		next:     next,
+		maxAge:   maxAge,
+		clock:    clock.Real{},
+		tracer:   providers.Tracer("iot-service"),
+		metrics:  providers.Recorder(),
+		readings: make(map[string]SensorReading),
+	}
+}
+
+// Ingest validates a reading and stores it as its CEP's latest, unless a
+// later one is stored already. The outcome is recorded on the span of ctx and
+// in the readings metric.
+func (s *IoTWeatherService) Ingest(ctx context.Context, reading SensorReading) error {
+	span := trace.SpanFromContext(ctx)
+	stored, err := s.ingest(reading)
+	result := "accepted"
+	switch {
+	case err != nil:
+		result = "rejected"
+	case !stored:
+		result = "superseded"
+	}
+	span.SetAttributes(
+		attribute.String("cep", normalizeCEP(reading.CEP)),
+		attribute.String("iot.sensor", reading.Sensor),
+		attribute.Float64("temp_c", reading.TempC),
+		attribute.String("iot.result", result),
+	)
+	s.metrics.Add(ctx, observability.IoTReadings.Name, 1, attribute.String("result", result))
+	return err
+}
+
+func (s *IoTWeatherService) ingest(reading SensorReading) (bool, error) {
+	now := s.clock.Now()
+	reading.CEP = normalizeCEP(reading.CEP)
+	if reading.MeasuredAt.IsZero() {
+		reading.MeasuredAt = now
+	}
+
+	switch {
+	case len(reading.CEP) != 8 || strings.Trim(reading.CEP, "0123456789") != "":
+		return false, fmt.Errorf("%w: cep %q is not 8 digits", ErrInvalidReading, reading.CEP)
+	case math.IsNaN(reading.TempC) || reading.TempC < minReadingC || reading.TempC > maxReadingC:
+		return false, fmt.Errorf("%w: temp_C %v out of range [%v, %v]", ErrInvalidReading, reading.TempC, minReadingC, maxReadingC)
+	case reading.MeasuredAt.After(now.Add(maxReadingSkew)):
+		return false, fmt.Errorf("%w: measured_at %s is in the future", ErrInvalidReading, reading.MeasuredAt.Format(time.RFC3339))
+	case now.Sub(reading.MeasuredAt) > s.maxAge:
+		return false, fmt.Errorf("%w: measured_at %s is older than %s", ErrInvalidReading, reading.MeasuredAt.Format(time.RFC3339), s.maxAge)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if latest, ok := s.readings[reading.CEP]; ok && latest.MeasuredAt.After(reading.MeasuredAt) {
+		return false, nil
+	}
+	s.readings[reading.CEP] = reading
+	return true, nil
+}
+
+// latest returns the CEP's reading while it is fresh, dropping it after
+func (s *IoTWeatherService) latest(cep string) (SensorReading, bool) {
+	s.mu.RLock()
+	reading, ok := s.readings[cep]
+	s.mu.RUnlock()
+	if !ok || s.clock.Now().Sub(reading.MeasuredAt) <= s.maxAge {
+		return reading, ok
+	}
+
+	s.mu.Lock()
+	if current := s.readings[cep]; current.MeasuredAt.Equal(reading.MeasuredAt) {
+		delete(s.readings, cep)
+	}
+	s.mu.Unlock()
+	return SensorReading{}, false
+}
+
+// GetTemperature answers the latest fresh reading for the location's CEP,
+// or asks the next provider
+func (s *IoTWeatherService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	reading, ok := s.latest(normalizeCEP(location.CEP))
+	if location.CEP == "" || !ok {
+		return s.next.GetTemperature(ctx, location)
+	}
+
+	_, span := s.tracer.Start(ctx, observability.SpanIoTGetTemperature.Name)
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("cep", reading.CEP),
+		attribute.String("iot.sensor", reading.Sensor),
+		attribute.Int64("iot.reading_age_ms", s.clock.Now().Sub(reading.MeasuredAt).Milliseconds()),
+		attribute.Float64("temp_c", reading.TempC),
+	)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("weather.provider", WeatherProviderIoT))
+
+	temp := models.FromCelsius(reading.TempC)
+	temp.Provider = WeatherProviderIoT
+	return &temp, nil
+}
+
+// GetForecast passes forecasts through, as sensors only measure the present
+func (s *IoTWeatherService) GetForecast(ctx context.Context, location models.Location, days int) ([]models.DailyForecast, error) {
+	forecaster, ok := s.next.(ForecastService)
+	if !ok {
+		return nil, ErrForecastUnsupported
+	}
+	return forecaster.GetForecast(ctx, location, days)
+}
+
+// Name reports the next provider's name
+func (s *IoTWeatherService) Name() string {
+	if provider, ok := s.next.(WeatherProvider); ok {
+		return provider.Name()
+	}
+	return "unknown"
+}
+
+// Capabilities reports the next provider's capabilities
+func (s *IoTWeatherService) Capabilities() Capabilities {
+	if provider, ok := s.next.(WeatherProvider); ok {
+		return provider.Capabilities()
+	}
+	return Capabilities{}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"svc-b/clock"
+	"svc-b/models"
+	"svc-b/observability"
+	"testing"
+	"time"
+)
+
+func TestIoTWeatherServiceIngest(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		reading   SensorReading
+		expectErr error
+	}{
+		{"Reading without a time", SensorReading{CEP: "01001-000", TempC: 23.4}, nil},
+		{"Recent reading", SensorReading{CEP: "01001000", TempC: -3, MeasuredAt: now.Add(-time.Minute)}, nil},
+		{"Clock slightly ahead", SensorReading{CEP: "01001000", TempC: 20, MeasuredAt: now.Add(30 * time.Second)}, nil},
+		{"Short CEP", SensorReading{CEP: "0100", TempC: 20}, ErrInvalidReading},
+		{"Site name instead of CEP", SensorReading{CEP: "roof-001", TempC: 20}, ErrInvalidReading},
+		{"Implausible temperature", SensorReading{CEP: "01001000", TempC: 150}, ErrInvalidReading},
+		{"Not a number", SensorReading{CEP: "01001000", TempC: math.NaN()}, ErrInvalidReading},
+		{"Future reading", SensorReading{CEP: "01001000", TempC: 20, MeasuredAt: now.Add(time.Hour)}, ErrInvalidReading},
+		{"Stale reading", SensorReading{CEP: "01001000", TempC: 20, MeasuredAt: now.Add(-time.Hour)}, ErrInvalidReading},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			service := NewIoTWeatherService(namedWeatherService{tempC: 30}, 15*time.Minute, observability.Providers{})
+			service.clock = clock.NewFake(now)
+
+			err := service.Ingest(context.Background(), tt.reading)
+			if !errors.Is(err, tt.expectErr) {
+				t.Fatalf("Ingest() error = %v, want %v", err, tt.expectErr)
+			}
+
+			temp, err := service.GetTemperature(context.Background(), models.Location{City: "São Paulo", State: "SP", CEP: "01001000"})
+			if err != nil {
+				t.Fatalf("GetTemperature() error = %v", err)
+			}
+			expected := models.FromCelsius(30)
+			if tt.expectErr == nil {
+				expected = models.FromCelsius(tt.reading.TempC)
+				expected.Provider = WeatherProviderIoT
+			}
+			if *temp != expected {
+				t.Errorf("GetTemperature() = %+v, want %+v", *temp, expected)
+			}
+		})
+	}
+}
+
+func TestIoTWeatherServiceGetTemperature(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	service := NewIoTWeatherService(namedWeatherService{tempC: 30}, 15*time.Minute, observability.Providers{})
+	service.clock = fake
+
+	for _, reading := range []SensorReading{
+		{CEP: "01001000", Sensor: "roof-1", TempC: 22, MeasuredAt: fake.Now().Add(-5 * time.Minute)},
+		{CEP: "01001000", Sensor: "roof-2", TempC: 24, MeasuredAt: fake.Now().Add(-time.Minute)},
+		// Superseded by the later reading of roof-2
+		{CEP: "01001000", Sensor: "roof-1", TempC: 21, MeasuredAt: fake.Now().Add(-3 * time.Minute)},
+	} {
+		if err := service.Ingest(ctx, reading); err != nil {
+			t.Fatalf("Ingest(%+v) error = %v", reading, err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		location      models.Location
+		advance       time.Duration
+		expectedTempC float64
+		expectedFrom  string
+	}{
+		{"Latest reading answers for its CEP", models.Location{City: "São Paulo", State: "SP", CEP: "01001-000"}, 0, 24, WeatherProviderIoT},
+		{"Other CEPs of the city go to the provider", models.Location{City: "São Paulo", State: "SP", CEP: "01310100"}, 0, 30, ""},
+		{"Locations without a CEP go to the provider", models.Location{City: "São Paulo", State: "SP"}, 0, 30, ""},
+		{"Stale readings go to the provider", models.Location{City: "São Paulo", State: "SP", CEP: "01001000"}, 15 * time.Minute, 30, ""},
+	}
+
+	// Run in order, as the last case ages the readings
+	for _, tt := range tests {
+		fake.Advance(tt.advance)
+		temp, err := service.GetTemperature(ctx, tt.location)
+		if err != nil {
+			t.Fatalf("%s: GetTemperature() error = %v", tt.name, err)
+		}
+		if temp.TempC != tt.expectedTempC || temp.Provider != tt.expectedFrom {
+			t.Errorf("%s: GetTemperature() = %+v, want %v°C from %q", tt.name, temp, tt.expectedTempC, tt.expectedFrom)
+		}
+	}
+
+	if _, err := service.GetForecast(ctx, models.Location{City: "São Paulo"}, 3); !errors.Is(err, ErrForecastUnsupported) {
+		t.Errorf("GetForecast() error = %v, want %v", err, ErrForecastUnsupported)
+	}
+}
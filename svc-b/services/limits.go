@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"svc-b/codec"
+)
+
+const (
+	// MaxUpstreamResponseBytes caps how much of an upstream response body is read
+	MaxUpstreamResponseBytes = 1 << 20 // 1 MiB
+
+	// MaxUpstreamTokenBytes caps the size of a single JSON token (string, number or literal)
+	MaxUpstreamTokenBytes = 4 << 10 // 4 KiB
+)
+
+var ErrUpstreamResponseTooLarge = errors.New("upstream response exceeds size limit")
+
+// limitedJSONReader wraps an upstream body and fails once either the total
+// size or the size of a single JSON token exceeds its limits, so a misbehaving
+// upstream can't make us buffer an unbounded payload.
+type limitedJSONReader struct {
+	r          io.Reader
+	remaining  int64
+	maxToken   int
+	tokenLen   int
+	inString   bool
+	escapeNext bool
+	// limitErr keeps the limit violation, as decoders don't all wrap reader errors
+	limitErr error
+}
+
+func newLimitedJSONReader(r io.Reader, maxBytes int64, maxToken int) *limitedJSONReader {
+	return &limitedJSONReader{r: r, remaining: maxBytes, maxToken: maxToken}
+}
+
+func (l *limitedJSONReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Peek one byte to tell an exact-size body from an oversized one
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			l.limitErr = fmt.Errorf("%w: more than %d bytes", ErrUpstreamResponseTooLarge, MaxUpstreamResponseBytes)
+			return 0, l.limitErr
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+
+	for _, c := range p[:n] {
+		if err := l.track(c); err != nil {
+			l.limitErr = err
+			return 0, err
+		}
+	}
+	return n, err
+}
+
+// track follows string boundaries and delimiters to measure the current token
+func (l *limitedJSONReader) track(c byte) error {
+	switch {
+	case l.inString:
+		switch {
+		case l.escapeNext:
+			l.escapeNext = false
+		case c == '\\':
+			l.escapeNext = true
+		case c == '"':
+			l.inString = false
+			l.tokenLen = 0
+			return nil
+		}
+	case c == '"':
+		l.inString = true
+		l.tokenLen = 0
+		return nil
+	case c == '{' || c == '}' || c == '[' || c == ']' || c == ',' || c == ':' ||
+		c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		l.tokenLen = 0
+		return nil
+	}
+
+	l.tokenLen++
+	if l.tokenLen > l.maxToken {
+		return fmt.Errorf("%w: token longer than %d bytes", ErrUpstreamResponseTooLarge, l.maxToken)
+	}
+	return nil
+}
+
+// decodeUpstreamJSON streams an upstream body into v, enforcing the response
+// and token size limits
+func decodeUpstreamJSON(body io.Reader, v interface{}) error {
+	reader := newLimitedJSONReader(body, MaxUpstreamResponseBytes, MaxUpstreamTokenBytes)
+	if err := codec.NewDecoder(reader).Decode(v); err != nil {
+		if reader.limitErr != nil {
+			return reader.limitErr
+		}
+		return fmt.Errorf("failed to decode upstream response: %w", err)
+	}
+	return nil
+}
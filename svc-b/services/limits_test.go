@@ -0,0 +1,44 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeUpstreamJSON(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		body        string
+		expectLimit bool
+	}{
+		{
+			name: "Within limits",
+			body: `{"cep":"22450000","localidade":"Rio de Janeiro"}`,
+		},
+		{
+			name:        "Oversized token",
+			body:        `{"localidade":"` + strings.Repeat("a", MaxUpstreamTokenBytes+1) + `"}`,
+			expectLimit: true,
+		},
+		{
+			name:        "Oversized body",
+			body:        `{"items":[` + strings.Repeat(`"a",`, MaxUpstreamResponseBytes/4) + `"a"]}`,
+			expectLimit: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var v map[string]interface{}
+			err := decodeUpstreamJSON(strings.NewReader(tt.body), &v)
+			if got := errors.Is(err, ErrUpstreamResponseTooLarge); got != tt.expectLimit {
+				t.Errorf("unexpected limit error: got %v, want limit hit %v", err, tt.expectLimit)
+			}
+		})
+	}
+}
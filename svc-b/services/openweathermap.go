@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"svc-b/clock"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/resilience"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Weather provider names, as used in WEATHER_PROVIDER
+const (
+	WeatherProviderWeatherAPI     = "weatherapi"
+	WeatherProviderOpenWeatherMap = "openweathermap"
+)
+
+// OpenWeatherMapResponse is the part of OpenWeatherMap's current weather
+// answer svc-b uses. Errors only carry a message.
+type OpenWeatherMapResponse struct {
+	Main struct {
+		Temp float64 `json:"temp"`
+	} `json:"main"`
+	Message string `json:"message,omitempty"`
+}
+
+// OpenWeatherMapService fetches current temperatures from OpenWeatherMap,
+// mapping its errors to the ones WeatherAPIService returns
+type OpenWeatherMapService struct {
+	client  HTTPClient
+	baseURL string
+	apiKey  string
+	clock   clock.Clock
+	tracer  trace.Tracer
+	retry   resilience.RetryPolicy
+	breaker *resilience.Breaker
+	events  *observability.EventBus
+	// keyRejected is set while OpenWeatherMap rejects the key, so the event
+	// is published once per outage rather than per request
+	keyRejected atomic.Bool
+}
+
+// NewOpenWeatherMapService creates the OpenWeatherMap client for the API at baseURL, e.g. https://api.openweathermap.org
+func NewOpenWeatherMapService(client HTTPClient, baseURL, apiKey string, providers observability.Providers) *OpenWeatherMapService {
+	s := &OpenWeatherMapService{
+		client:  client,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		clock:   clock.Real{},
+		tracer:  providers.Tracer("openweathermap-service"),
+		retry:   DefaultRetry,
+		events:  providers.Events,
+	}
+	return s.WithBreaker(DefaultBreaker)
+}
+
+// WithRetry replaces the retry policy
+func (s *OpenWeatherMapService) WithRetry(policy resilience.RetryPolicy) *OpenWeatherMapService {
+	s.retry = policy
+	return s
+}
+
+// WithBreaker replaces the circuit breaker with one using config
+func (s *OpenWeatherMapService) WithBreaker(config resilience.BreakerConfig) *OpenWeatherMapService {
+	s.breaker = resilience.NewBreaker(config, s.clock)
+	s.breaker.OnStateChange(breakerEvents(s.events, s.Name(), "OpenWeatherMap"))
+	return s
+}
+
+// Name identifies the provider in capability reports
+func (s *OpenWeatherMapService) Name() string {
+	return WeatherProviderOpenWeatherMap
+}
+
+// Capabilities reports the optional features implemented for OpenWeatherMap
+func (s *OpenWeatherMapService) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+// GetTemperature looks up location by city, as OpenWeatherMap only takes
+// states for US cities
+func (s *OpenWeatherMapService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	ctx, span := s.tracer.Start(ctx, observability.SpanOpenWeatherMapGetTemperature.Name)
+	defer span.End()
+
+	city := location.City
+	span.SetAttributes(attribute.String("city", city))
+
+	if s.apiKey == "" {
+		slog.ErrorContext(ctx, "OPENWEATHERMAP_API_KEY não configurada")
+		span.SetStatus(codes.Error, "API key not configured")
+		return nil, ErrAPIKeyNotConfigured
+	}
+
+	// Every CEP is Brazilian, so the country code disambiguates the city
+	query := url.Values{"q": {city + ",BR"}, "appid": {s.apiKey}, "units": {"metric"}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/data/2.5/weather?"+query, nil)
+	if err != nil {
+		recordFailure(span, err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, attempts, err := doUpstream(ctx, s.clock, s.retry, s.breaker, func(ctx context.Context) (*http.Response, error) {
+		return s.client.Do(req)
+	})
+	span.SetAttributes(
+		attribute.Int("attempts", attempts),
+		attribute.String("breaker.state", s.breaker.State().String()),
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "Erro ao fazer requisição para OpenWeatherMap", "error", err)
+		recordBreakerOpen(span, s.Name(), err)
+		recordFailure(span, err)
+		return nil, fmt.Errorf("all weather API requests failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var owmResp OpenWeatherMapResponse
+	if err := decodeUpstreamJSON(resp.Body, &owmResp); err != nil {
+		slog.ErrorContext(ctx, "Erro ao decodificar resposta da OpenWeatherMap", "error", err)
+		recordFailure(span, err)
+		if errors.Is(err, ErrUpstreamResponseTooLarge) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to decode API response: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		span.SetStatus(codes.Error, owmResp.Message)
+		return nil, ErrCityNotFound
+	case http.StatusUnauthorized:
+		slog.WarnContext(ctx, "Chave rejeitada pela OpenWeatherMap", "error", owmResp.Message)
+		recordFailure(span, fmt.Errorf("%w: %s", ErrWeatherAPIFailed, owmResp.Message))
+		if s.keyRejected.CompareAndSwap(false, true) {
+			s.events.Publish(ctx, observability.Event{
+				Kind:       observability.EventAPIKeyInvalid,
+				Source:     s.Name(),
+				Message:    owmResp.Message,
+				Attributes: map[string]string{"status": strconv.Itoa(resp.StatusCode)},
+			})
+		}
+		return nil, fmt.Errorf("%w: %s", ErrWeatherAPIFailed, owmResp.Message)
+	default:
+		slog.WarnContext(ctx, "Status code inválido da OpenWeatherMap", "status", resp.StatusCode, "error", owmResp.Message)
+		recordFailure(span, fmt.Errorf("%w: %s", ErrWeatherAPIFailed, owmResp.Message))
+		return nil, fmt.Errorf("%w: %s", ErrWeatherAPIFailed, owmResp.Message)
+	}
+
+	s.keyRejected.Store(false)
+
+	tempC := owmResp.Main.Temp
+	tempF := tempC*1.8 + 32
+	tempK := tempC + 273.15
+	span.SetAttributes(
+		attribute.Float64("temp_c", tempC),
+		attribute.Float64("temp_f", tempF),
+		attribute.Float64("temp_k", tempK),
+	)
+
+	return &models.Temperature{
+		TempC: tempC,
+		TempF: tempF,
+		TempK: tempK,
+	}, nil
+}
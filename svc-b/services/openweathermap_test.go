@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/resilience"
+	"testing"
+)
+
+// owmHTTPClient answers like OpenWeatherMap: São Paulo is found, other
+// cities are not, and the key "bad-key" is rejected
+type owmHTTPClient struct{}
+
+func (owmHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	status, body := http.StatusNotFound, `{"cod":"404","message":"city not found"}`
+	switch query := req.URL.Query(); {
+	case query.Get("appid") == "bad-key":
+		status, body = http.StatusUnauthorized, `{"cod":401,"message":"Invalid API key."}`
+	case query.Get("q") == "São Paulo,BR" && query.Get("units") == "metric":
+		status, body = http.StatusOK, `{"name":"São Paulo","main":{"temp":22.456},"cod":200}`
+	}
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func TestOpenWeatherMapGetTemperature(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		apiKey      string
+		city        string
+		expectedC   float64
+		expectedErr error
+	}{
+		{"Found", "key", "São Paulo", 22.46, nil},
+		{"City not found", "key", "Atlantis", 0, ErrCityNotFound},
+		{"Key rejected", "bad-key", "São Paulo", 0, ErrWeatherAPIFailed},
+		{"Key not configured", "", "São Paulo", 0, ErrAPIKeyNotConfigured},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			service := NewOpenWeatherMapService(owmHTTPClient{}, "https://api.openweathermap.org/", tt.apiKey, observability.Providers{}).
+				WithRetry(resilience.RetryPolicy{MaxAttempts: 1})
+
+			temp, err := service.GetTemperature(context.Background(), models.Location{City: tt.city})
+			if !errors.Is(err, tt.expectedErr) || (tt.expectedErr == nil) != (err == nil) {
+				t.Fatalf("GetTemperature() error = %v, want %v", err, tt.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+			// Temperatures are answered as measured and rounded by the handler
+			if rounded := temp.Rounded(2); rounded.TempC != tt.expectedC || rounded.TempF != 72.42 || rounded.TempK != 295.61 {
+				t.Errorf("GetTemperature() = %+v, want %v°C", temp, tt.expectedC)
+			}
+		})
+	}
+}
+
+func TestOpenWeatherMapPublishesKeyRejectionOnce(t *testing.T) {
+	t.Parallel()
+
+	bus := observability.NewEventBus()
+	var events []observability.Event
+	bus.Subscribe(func(ctx context.Context, event observability.Event) {
+		events = append(events, event)
+	})
+
+	service := NewOpenWeatherMapService(owmHTTPClient{}, "https://api.openweathermap.org", "bad-key", observability.Providers{Events: bus})
+	for range 3 {
+		if _, err := service.GetTemperature(context.Background(), models.Location{City: "São Paulo"}); !errors.Is(err, ErrWeatherAPIFailed) {
+			t.Fatalf("GetTemperature() error = %v, want ErrWeatherAPIFailed", err)
+		}
+	}
+
+	if len(events) != 1 || events[0].Kind != observability.EventAPIKeyInvalid || events[0].Source != WeatherProviderOpenWeatherMap {
+		t.Errorf("published %+v, want a single api_key_invalid event", events)
+	}
+}
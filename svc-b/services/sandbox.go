@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"svc-b/clock"
+	"svc-b/models"
+	"svc-b/observability"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sandboxProviderTimeout mirrors the request timeout of the real providers
+const sandboxProviderTimeout = 5 * time.Second
+
+// Simulation targets
+const (
+	SimulateCEP     = "cep"
+	SimulateWeather = "weather"
+)
+
+// Simulation faults
+const (
+	FaultTimeout      = "timeout"
+	FaultServerError  = "500"
+	FaultNotFound     = "404"
+	FaultCityNotFound = "1006"
+	FaultTooLarge     = "too_large"
+	FaultSlow         = "slow"
+)
+
+var ErrInvalidSimulation = errors.New("invalid simulate scenario")
+
+// sandboxAddresses holds the CEPs the sandbox CEP provider knows about
+var sandboxAddresses = map[string]models.Address{
+	"22450000": {Street: "Rua Marquês de São Vicente", Neighborhood: "Gávea", City: "Rio de Janeiro", State: "RJ"},
+	"01001000": {Street: "Praça da Sé", Neighborhood: "Sé", City: "São Paulo", State: "SP"},
+	"30130000": {Street: "Avenida Afonso Pena", Neighborhood: "Centro", City: "Belo Horizonte", State: "MG"},
+	"70040000": {Street: "Esplanada dos Ministérios", Neighborhood: "Zona Cívico-Administrativa", City: "Brasília", State: "DF"},
+}
+
+// Simulation is a failure scenario injected into a sandbox provider for one
+// request, written as [cep:|weather:]<fault>, e.g. "timeout", "cep:500" or "slow:2s"
+type Simulation struct {
+	Target string
+	Fault  string
+	// Delay is how long a slow provider takes to answer
+	Delay time.Duration
+}
+
+type simulationKey struct{}
+
+// ParseSimulation parses a simulate scenario. The target defaults to the
+// provider that can produce the fault, and to the weather provider otherwise.
+func ParseSimulation(value string) (Simulation, error) {
+	sim := Simulation{Target: SimulateWeather}
+
+	if target, rest, found := strings.Cut(value, ":"); found && (target == SimulateCEP || target == SimulateWeather) {
+		sim.Target = target
+		value = rest
+	} else if value == FaultNotFound {
+		sim.Target = SimulateCEP
+	}
+
+	fault, arg, _ := strings.Cut(value, ":")
+	sim.Fault = fault
+
+	switch fault {
+	case FaultTimeout, FaultServerError, FaultTooLarge:
+	case FaultNotFound:
+		if sim.Target != SimulateCEP {
+			return Simulation{}, fmt.Errorf("%w: %s only applies to the cep provider", ErrInvalidSimulation, fault)
+		}
+	case FaultCityNotFound:
+		if sim.Target != SimulateWeather {
+			return Simulation{}, fmt.Errorf("%w: %s only applies to the weather provider", ErrInvalidSimulation, fault)
+		}
+	case FaultSlow:
+		delay, err := time.ParseDuration(arg)
+		if err != nil || delay <= 0 {
+			return Simulation{}, fmt.Errorf("%w: slow needs a positive duration, e.g. slow:2s", ErrInvalidSimulation)
+		}
+		sim.Delay = delay
+	default:
+		return Simulation{}, fmt.Errorf("%w: unknown fault %q", ErrInvalidSimulation, fault)
+	}
+	return sim, nil
+}
+
+// WithSimulation attaches a failure scenario to the request context
+func WithSimulation(ctx context.Context, sim Simulation) context.Context {
+	return context.WithValue(ctx, simulationKey{}, sim)
+}
+
+// simulationFor returns the scenario aimed at target, if any
+func simulationFor(ctx context.Context, target string) (Simulation, bool) {
+	sim, ok := ctx.Value(simulationKey{}).(Simulation)
+	if !ok || sim.Target != target {
+		return Simulation{}, false
+	}
+	return sim, true
+}
+
+// simulate plays the scenario aimed at target, returning the error the real
+// provider would have produced, wrapped in providerErr where it has no
+// dedicated sentinel
+func simulate(ctx context.Context, clk clock.Clock, target string, providerErr error) error {
+	sim, ok := simulationFor(ctx, target)
+	if !ok {
+		return nil
+	}
+
+	switch sim.Fault {
+	case FaultTimeout:
+		// Hold the request for as long as the real provider would before giving up
+		if err := clk.Sleep(ctx, sandboxProviderTimeout); err != nil {
+			return fmt.Errorf("%w: %w", providerErr, err)
+		}
+		return fmt.Errorf("%w: %w", providerErr, context.DeadlineExceeded)
+	case FaultServerError:
+		return fmt.Errorf("%w: simulated HTTP 500", providerErr)
+	case FaultNotFound:
+		return ErrZipCodeNotFound
+	case FaultCityNotFound:
+		return ErrCityNotFound
+	case FaultTooLarge:
+		return ErrUpstreamResponseTooLarge
+	case FaultSlow:
+		if err := clk.Sleep(ctx, sim.Delay); err != nil {
+			return fmt.Errorf("%w: %w", providerErr, err)
+		}
+	}
+	return nil
+}
+
+// SandboxCEPService answers CEP lookups from a fixed table, without network access
+type SandboxCEPService struct {
+	clock  clock.Clock
+	tracer trace.Tracer
+}
+
+func NewSandboxCEPService(providers observability.Providers) *SandboxCEPService {
+	return &SandboxCEPService{
+		clock:  clock.Real{},
+		tracer: providers.Tracer("sandbox-service"),
+	}
+}
+
+func (s *SandboxCEPService) GetAddressByCEP(ctx context.Context, cep string) (*models.Address, error) {
+	ctx, span := s.tracer.Start(ctx, observability.SpanSandboxGetCityByCEP.Name)
+	defer span.End()
+
+	cep = strings.ReplaceAll(cep, "-", "")
+	cep = strings.ReplaceAll(cep, ".", "")
+	span.SetAttributes(attribute.String("cep", cep))
+
+	if len(cep) != 8 {
+		span.SetStatus(codes.Error, "invalid zipcode format")
+		return nil, ErrInvalidZipCode
+	}
+
+	if sim, ok := simulationFor(ctx, SimulateCEP); ok {
+		span.SetAttributes(attribute.String("sandbox.simulate", sim.Fault))
+	}
+	if err := simulate(ctx, s.clock, SimulateCEP, ErrInternalServer); err != nil {
+		slog.InfoContext(ctx, "Sandbox: falha simulada no CEP", "cep", cep, "error", err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	address, ok := sandboxAddresses[cep]
+	if !ok {
+		span.SetStatus(codes.Error, "zipcode not found")
+		return nil, ErrZipCodeNotFound
+	}
+
+	span.SetAttributes(attribute.String("city", address.City))
+	return &address, nil
+}
+
+// SandboxWeatherService returns a canned temperature for any city
+type SandboxWeatherService struct {
+	clock  clock.Clock
+	tracer trace.Tracer
+}
+
+func NewSandboxWeatherService(providers observability.Providers) *SandboxWeatherService {
+	return &SandboxWeatherService{
+		clock:  clock.Real{},
+		tracer: providers.Tracer("sandbox-service"),
+	}
+}
+
+// Name identifies the provider in capability reports
+func (s *SandboxWeatherService) Name() string {
+	return "sandbox"
+}
+
+// Capabilities reports the optional features implemented by the sandbox
+func (s *SandboxWeatherService) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+func (s *SandboxWeatherService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	ctx, span := s.tracer.Start(ctx, observability.SpanSandboxGetTemperature.Name)
+	defer span.End()
+
+	city := location.City
+	span.SetAttributes(attribute.String("city", city))
+
+	if sim, ok := simulationFor(ctx, SimulateWeather); ok {
+		span.SetAttributes(attribute.String("sandbox.simulate", sim.Fault))
+	}
+	if err := simulate(ctx, s.clock, SimulateWeather, ErrWeatherAPIFailed); err != nil {
+		slog.InfoContext(ctx, "Sandbox: falha simulada na temperatura", "city", city, "error", err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	tempC := 25.0
+	return &models.Temperature{
+		TempC: tempC,
+		TempF: tempC*1.8 + 32,
+		TempK: tempC + 273.15,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"svc-b/clock"
+	"svc-b/models"
+	"svc-b/observability"
+	"testing"
+	"time"
+)
+
+func TestParseSimulation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value     string
+		expected  Simulation
+		expectErr bool
+	}{
+		{value: "timeout", expected: Simulation{Target: SimulateWeather, Fault: FaultTimeout}},
+		{value: "500", expected: Simulation{Target: SimulateWeather, Fault: FaultServerError}},
+		{value: "cep:500", expected: Simulation{Target: SimulateCEP, Fault: FaultServerError}},
+		{value: "1006", expected: Simulation{Target: SimulateWeather, Fault: FaultCityNotFound}},
+		{value: "404", expected: Simulation{Target: SimulateCEP, Fault: FaultNotFound}},
+		{value: "slow:2s", expected: Simulation{Target: SimulateWeather, Fault: FaultSlow, Delay: 2 * time.Second}},
+		{value: "cep:slow:150ms", expected: Simulation{Target: SimulateCEP, Fault: FaultSlow, Delay: 150 * time.Millisecond}},
+		{value: "slow", expectErr: true},
+		{value: "slow:-1s", expectErr: true},
+		{value: "cep:1006", expectErr: true},
+		{value: "weather:404", expectErr: true},
+		{value: "explode", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+
+			sim, err := ParseSimulation(tt.value)
+			if tt.expectErr {
+				if !errors.Is(err, ErrInvalidSimulation) {
+					t.Errorf("expected ErrInvalidSimulation, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sim != tt.expected {
+				t.Errorf("got %+v, want %+v", sim, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSandboxWeatherServiceSimulatedDelays(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value          string
+		expectedErr    error
+		expectedSleeps []time.Duration
+	}{
+		{value: "slow:2s", expectedSleeps: []time.Duration{2 * time.Second}},
+		{value: "timeout", expectedErr: context.DeadlineExceeded, expectedSleeps: []time.Duration{sandboxProviderTimeout}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+
+			sim, err := ParseSimulation(tt.value)
+			if err != nil {
+				t.Fatalf("failed to parse scenario: %v", err)
+			}
+
+			fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			service := NewSandboxWeatherService(observability.Providers{})
+			service.clock = fake
+
+			_, err = service.GetTemperature(WithSimulation(context.Background(), sim), models.Location{City: "Rio de Janeiro"})
+			if tt.expectedErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expectedErr != nil && (!errors.Is(err, tt.expectedErr) || !errors.Is(err, ErrWeatherAPIFailed)) {
+				t.Errorf("got error %v, want one wrapping %v and ErrWeatherAPIFailed", err, tt.expectedErr)
+			}
+			if got := fake.Sleeps(); !reflect.DeepEqual(got, tt.expectedSleeps) {
+				t.Errorf("simulated delays = %v, want %v", got, tt.expectedSleeps)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// BenchmarkTracerAcquisition compares looking the tracer up on every call, from
+// the global provider and from a local one, with the constructor-injected
+// tracer the services use
+func BenchmarkTracerAcquisition(b *testing.B) {
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.AlwaysSample()))
+	defer tp.Shutdown(context.Background())
+	ctx := context.Background()
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(previous)
+
+	b.Run("global_per_call", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, span := otel.Tracer("weather-api-service").Start(ctx, "WeatherAPI.GetTemperature")
+			span.End()
+		}
+	})
+
+	b.Run("local_per_call", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, span := tp.Tracer("weather-api-service").Start(ctx, "WeatherAPI.GetTemperature")
+			span.End()
+		}
+	})
+
+	b.Run("constructor_injected", func(b *testing.B) {
+		tracer := tp.Tracer("weather-api-service")
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, span := tracer.Start(ctx, "WeatherAPI.GetTemperature")
+			span.End()
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ufRange assigns the CEPs whose five-digit prefix is at least from to a UF,
+// up to the next range
+type ufRange struct {
+	from int
+	uf   string
+}
+
+// ufRanges are the Correios CEP ranges of each UF, ordered by prefix
+var ufRanges = []ufRange{
+	{1000, "SP"}, {20000, "RJ"}, {29000, "ES"}, {30000, "MG"}, {40000, "BA"},
+	{49000, "SE"}, {50000, "PE"}, {57000, "AL"}, {58000, "PB"}, {59000, "RN"},
+	{60000, "CE"}, {64000, "PI"}, {65000, "MA"}, {66000, "PA"}, {68900, "AP"},
+	{69000, "AM"}, {69300, "RR"}, {69400, "AM"}, {69900, "AC"}, {70000, "DF"},
+	{72800, "GO"}, {73000, "DF"}, {73700, "GO"}, {76800, "RO"}, {77000, "TO"},
+	{78000, "MT"}, {78900, "RO"}, {79000, "MS"}, {80000, "PR"}, {88000, "SC"},
+	{90000, "RS"},
+}
+
+// UFByCEP returns the UF a CEP belongs to from its range, without asking a
+// provider. cep holds the eight digits.
+func UFByCEP(cep string) (string, bool) {
+	if len(cep) != 8 || strings.Trim(cep, "0123456789") != "" {
+		return "", false
+	}
+	prefix, _ := strconv.Atoi(cep[:5])
+	if prefix < ufRanges[0].from {
+		return "", false
+	}
+	i := sort.Search(len(ufRanges), func(i int) bool { return ufRanges[i].from > prefix })
+	return ufRanges[i-1].uf, true
+}
@@ -0,0 +1,35 @@
+package services
+
+import "testing"
+
+func TestUFByCEP(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		cep        string
+		expectedUF string
+		expectedOK bool
+	}{
+		{"01001000", "SP", true},
+		{"20040002", "RJ", true},
+		{"30130010", "MG", true},
+		{"50030230", "PE", true},
+		{"69900062", "AC", true},
+		{"70040010", "DF", true},
+		{"72800000", "GO", true},
+		{"99999999", "RS", true},
+		{"00999999", "", false},
+		{"0100100", "", false},
+		{"0100100a", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cep, func(t *testing.T) {
+			t.Parallel()
+
+			if uf, ok := UFByCEP(tt.cep); uf != tt.expectedUF || ok != tt.expectedOK {
+				t.Errorf("UFByCEP(%q) = %q, %v; want %q, %v", tt.cep, uf, ok, tt.expectedUF, tt.expectedOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"pkg/telemetry"
+	"strings"
+	"svc-b/clock"
+	"svc-b/observability"
+	"svc-b/resilience"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultRetry and DefaultBreaker are the retry policy and circuit breaker
+// configuration of every provider unless overridden with WithRetry and
+// WithBreaker
+var (
+	DefaultRetry = resilience.RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+		Jitter:      0.2,
+	}
+	DefaultBreaker = resilience.BreakerConfig{FailureThreshold: 5, OpenTimeout: 30 * time.Second}
+)
+
+// doUpstream sends a provider request under the retry policy and breaker.
+// Transport errors and server error or throttling answers are failures,
+// retried if the policy allows; once retries are spent, the last answer is
+// returned for the caller to handle like any other. The caller closes it.
+//
+// A call ctx was canceled or expired during is not held against the breaker.
+//
+// Each failed attempt, and each wait before a retry, is recorded as an event
+// on the span of ctx, so a failed call can be diagnosed from its trace.
+func doUpstream(ctx context.Context, clk clock.Clock, policy resilience.RetryPolicy, breaker *resilience.Breaker, send func(ctx context.Context) (*http.Response, error)) (*http.Response, int, error) {
+	span := trace.SpanFromContext(ctx)
+	policy.OnRetry = func(attempt int, delay time.Duration, _ error) {
+		span.AddEvent(upstreamBackoffEvent, trace.WithAttributes(
+			attribute.Int("retry.attempt", attempt),
+			attribute.Int64("retry.backoff_ms", delay.Milliseconds()),
+		))
+	}
+
+	var resp *http.Response
+	attempt := 0
+	attempts, err := resilience.Do(ctx, clk, policy, breaker, func(ctx context.Context) error {
+		attempt++
+		if resp != nil {
+			resp.Body.Close()
+		}
+		var err error
+		if resp, err = send(ctx); err != nil {
+			// Transport errors quote the URL, which may carry an API key
+			err = telemetry.SanitizeError(err)
+			resp = nil
+			recordAttempt(span, attempt, nil, err)
+			return err
+		}
+		if resp.StatusCode >= http.StatusBadRequest {
+			recordAttempt(span, attempt, resp, nil)
+		}
+		if resp.StatusCode >= http.StatusInternalServerError || resilience.RetryableStatus(resp.StatusCode) {
+			return &resilience.StatusError{Code: resp.StatusCode}
+		}
+		return nil
+	})
+
+	var status *resilience.StatusError
+	if err != nil && (!errors.As(err, &status) || errors.Is(err, resilience.ErrBreakerOpen)) {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, attempts, err
+	}
+	return resp, attempts, nil
+}
+
+// Span events recorded by doUpstream for failed attempts and the waits
+// before retrying them
+const (
+	upstreamAttemptEvent = "upstream.attempt"
+	upstreamBackoffEvent = "upstream.backoff"
+)
+
+// snippetLimit caps the bytes of an error answer recorded on its attempt event
+const snippetLimit = 256
+
+// recordAttempt adds the attempt event for a failed attempt to span: with the
+// transport error, or the provider's status and the start of its answer
+func recordAttempt(span trace.Span, attempt int, resp *http.Response, err error) {
+	attrs := []attribute.KeyValue{attribute.Int("retry.attempt", attempt)}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error.message", err.Error()))
+	}
+	if resp != nil {
+		attrs = append(attrs,
+			attribute.Int("http.response.status_code", resp.StatusCode),
+			attribute.String("upstream.response.snippet", peekBody(resp, snippetLimit)),
+		)
+	}
+	span.AddEvent(upstreamAttemptEvent, trace.WithAttributes(attrs...))
+}
+
+// peekBody returns up to limit bytes of resp's body, leaving the body whole
+// for the caller to read
+func peekBody(resp *http.Response, limit int64) string {
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, limit))
+	resp.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(head), resp.Body), Closer: resp.Body}
+	return strings.ToValidUTF8(string(head), "")
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// recordFailure records a failed provider call on span: the error, with the
+// stack it was recorded from, and the span's error status
+func recordFailure(span trace.Span, err error) {
+	span.RecordError(err, trace.WithStackTrace(true))
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// breakerOpenEvent is the span event recorded when a call is rejected by an
+// open breaker, without reaching the provider
+const breakerOpenEvent = "circuit_breaker.open"
+
+// breakerEvents reports a provider's breaker tripping and recovering on the
+// event bus; re-opening after a failed half-open probe is part of the same
+// outage
+func breakerEvents(events *observability.EventBus, provider, label string) func(from, to resilience.State) {
+	return func(from, to resilience.State) {
+		event := observability.Event{
+			Source:     provider,
+			Attributes: map[string]string{"from": from.String(), "to": to.String()},
+		}
+		switch {
+		case from == resilience.StateClosed && to == resilience.StateOpen:
+			event.Kind = observability.EventBreakerOpened
+			event.Message = label + " circuit breaker opened after consecutive failures"
+		case to == resilience.StateClosed:
+			event.Kind = observability.EventBreakerClosed
+			event.Message = label + " circuit breaker closed, calls are flowing again"
+		default:
+			return
+		}
+		events.Publish(context.Background(), event)
+	}
+}
+
+// recordBreakerOpen adds the breaker event to span if err is a rejection by
+// the provider's open breaker
+func recordBreakerOpen(span trace.Span, provider string, err error) {
+	if errors.Is(err, resilience.ErrBreakerOpen) {
+		span.AddEvent(breakerOpenEvent, trace.WithAttributes(attribute.String("provider", provider)))
+	}
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"pkg/telemetry/telemetrytest"
+	"reflect"
+	"strings"
+	"svc-b/clock"
+	"svc-b/observability"
+	"svc-b/resilience"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// statusHTTPClient answers every call with status, counting the calls
+type statusHTTPClient struct {
+	status int
+	calls  int
+}
+
+func (c *statusHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.calls++
+	return &http.Response{
+		StatusCode: c.status,
+		Body:       io.NopCloser(strings.NewReader(`{}`)),
+	}, nil
+}
+
+func TestViaCEPBreaker(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		status        int
+		expectedCalls int
+		expectOpen    bool
+	}{
+		{"Server errors open the breaker", http.StatusBadGateway, 2, true},
+		{"Client errors don't count", http.StatusNotFound, 4, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := tracetest.NewSpanRecorder()
+			providers := observability.Providers{TracerProvider: telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))}
+			client := &statusHTTPClient{status: tt.status}
+			service := NewViaCEPService(client, "https://viacep.com.br", providers).
+				WithRetry(resilience.RetryPolicy{MaxAttempts: 1}).
+				WithBreaker(resilience.BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute})
+
+			var err error
+			for range 4 {
+				_, err = service.GetAddressByCEP(context.Background(), "22450-000")
+			}
+
+			if client.calls != tt.expectedCalls {
+				t.Errorf("ViaCEP called %d times, want %d", client.calls, tt.expectedCalls)
+			}
+			if got := errors.Is(err, resilience.ErrBreakerOpen); got != tt.expectOpen {
+				t.Errorf("last error = %v, want breaker open %v", err, tt.expectOpen)
+			}
+			if !tt.expectOpen && !errors.Is(err, ErrZipCodeNotFound) {
+				t.Errorf("last error = %v, want ErrZipCodeNotFound", err)
+			}
+
+			events := 0
+			for _, span := range recorder.Ended() {
+				for _, event := range span.Events() {
+					if event.Name == breakerOpenEvent {
+						events++
+					}
+				}
+			}
+			if want := 4 - tt.expectedCalls; events != want {
+				t.Errorf("recorded %d %s events, want %d", events, breakerOpenEvent, want)
+			}
+		})
+	}
+}
+
+func TestDoUpstreamIgnoresCallerCancellation(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	breaker := resilience.NewBreaker(resilience.BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, fake)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	_, _, err := doUpstream(canceled, fake, resilience.RetryPolicy{MaxAttempts: 3}, breaker, func(ctx context.Context) (*http.Response, error) {
+		cancel()
+		return nil, &url.Error{Op: "Get", URL: "https://viacep.com.br/ws/22450000/json/", Err: ctx.Err()}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("doUpstream() error = %v, want context.Canceled", err)
+	}
+
+	expired, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-expired.Done()
+	_, _, err = doUpstream(expired, fake, resilience.RetryPolicy{MaxAttempts: 3}, breaker, func(ctx context.Context) (*http.Response, error) {
+		return nil, &url.Error{Op: "Get", URL: "https://viacep.com.br/ws/22450000/json/", Err: ctx.Err()}
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("doUpstream() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	if got := breaker.State(); got != resilience.StateClosed {
+		t.Errorf("breaker = %s after callers gave up, want closed", got)
+	}
+}
+
+// sequenceHTTPClient answers with statuses in turn, repeating the last one
+type sequenceHTTPClient struct {
+	statuses []int
+	calls    int
+}
+
+func (c *sequenceHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	status := c.statuses[min(c.calls, len(c.statuses)-1)]
+	c.calls++
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(`{"localidade":"Rio de Janeiro"}`)),
+	}, nil
+}
+
+func TestViaCEPRetry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		statuses       []int
+		expectedCalls  int
+		expectedSleeps []time.Duration
+		expectErr      error
+		expectedEvents []string
+	}{
+		{
+			"Unavailable then OK", []int{http.StatusServiceUnavailable, http.StatusOK}, 2, []time.Duration{100 * time.Millisecond}, nil,
+			[]string{"upstream.attempt #1 503", "upstream.backoff #1 100ms"},
+		},
+		{
+			"Throttled until retries run out", []int{http.StatusTooManyRequests}, 3, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, ErrZipCodeNotFound,
+			[]string{
+				"upstream.attempt #1 429", "upstream.backoff #1 100ms",
+				"upstream.attempt #2 429", "upstream.backoff #2 200ms",
+				"upstream.attempt #3 429", "exception",
+			},
+		},
+		{"Not found is not retried", []int{http.StatusNotFound}, 1, nil, ErrZipCodeNotFound, []string{"upstream.attempt #1 404", "exception"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			client := &sequenceHTTPClient{statuses: tt.statuses}
+			recorder := tracetest.NewSpanRecorder()
+			providers := observability.Providers{TracerProvider: telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))}
+			service := NewViaCEPService(client, "https://viacep.com.br", providers).
+				WithRetry(resilience.RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+			service.clock = fake
+
+			address, err := service.GetAddressByCEP(context.Background(), "22450-000")
+			if !errors.Is(err, tt.expectErr) {
+				t.Fatalf("GetAddressByCEP() error = %v, want %v", err, tt.expectErr)
+			}
+			if tt.expectErr == nil && address.City != "Rio de Janeiro" {
+				t.Errorf("GetAddressByCEP() = %+v, want Rio de Janeiro", address)
+			}
+			if client.calls != tt.expectedCalls {
+				t.Errorf("ViaCEP called %d times, want %d", client.calls, tt.expectedCalls)
+			}
+			if got := fake.Sleeps(); !reflect.DeepEqual(got, tt.expectedSleeps) {
+				t.Errorf("backoff schedule = %v, want %v", got, tt.expectedSleeps)
+			}
+
+			var events []string
+			for _, event := range recorder.Ended()[0].Events() {
+				events = append(events, eventSummary(event))
+				if event.Name == semconv.ExceptionEventName && !hasAttribute(event, semconv.ExceptionStacktraceKey) {
+					t.Errorf("exception event %+v has no stack trace", event)
+				}
+			}
+			if !reflect.DeepEqual(events, tt.expectedEvents) {
+				t.Errorf("span events = %q, want %q", events, tt.expectedEvents)
+			}
+		})
+	}
+}
+
+// eventSummary describes the events doUpstream records by their attempt and
+// status or backoff, and other events by name
+func eventSummary(event sdktrace.Event) string {
+	summary := event.Name
+	for _, attr := range event.Attributes {
+		switch attr.Key {
+		case "retry.attempt":
+			summary += fmt.Sprintf(" #%d", attr.Value.AsInt64())
+		case "http.response.status_code":
+			summary += fmt.Sprintf(" %d", attr.Value.AsInt64())
+		case "retry.backoff_ms":
+			summary += fmt.Sprintf(" %dms", attr.Value.AsInt64())
+		}
+	}
+	return summary
+}
+
+func hasAttribute(event sdktrace.Event, key attribute.Key) bool {
+	for _, attr := range event.Attributes {
+		if attr.Key == key && attr.Value.AsString() != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPeekBody(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		body            string
+		limit           int64
+		expectedSnippet string
+	}{
+		{"Short body", `{"erro":true}`, 256, `{"erro":true}`},
+		{"Truncated body", "service unavailable", 7, "service"},
+		{"Invalid UTF-8 dropped", "ok\xff", 256, "ok"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp := &http.Response{Body: io.NopCloser(strings.NewReader(tt.body))}
+			if snippet := peekBody(resp, tt.limit); snippet != tt.expectedSnippet {
+				t.Errorf("peekBody() = %q, want %q", snippet, tt.expectedSnippet)
+			}
+			if body, _ := io.ReadAll(resp.Body); string(body) != tt.body {
+				t.Errorf("body after peekBody() = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
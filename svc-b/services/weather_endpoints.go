@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"svc-b/clock"
+	"svc-b/resilience"
+	"sync"
+	"time"
+)
+
+var ErrNoHealthyEndpoint = errors.New("no healthy weather API endpoint")
+
+// EndpointSelection picks which healthy regional endpoint serves a call
+type EndpointSelection string
+
+const (
+	// SelectOrdered prefers the endpoints in the order they are configured
+	SelectOrdered EndpointSelection = "ordered"
+	// SelectLatency prefers the endpoint with the lowest recent latency
+	SelectLatency EndpointSelection = "latency"
+)
+
+// latencySmoothing weights the latest call in an endpoint's latency average
+const latencySmoothing = 0.3
+
+// weatherEndpointBreaker marks an endpoint unhealthy after consecutive
+// failures, probing it again once the timeout elapses
+var weatherEndpointBreaker = resilience.BreakerConfig{FailureThreshold: 3, OpenTimeout: 30 * time.Second}
+
+// WeatherEndpoint is a regional base URL of the weather API
+type WeatherEndpoint struct {
+	Region string
+	URL    string
+}
+
+// ParseWeatherEndpoints parses comma-separated region=url entries, e.g.
+// "sa-east=https://sa.example.com,us-east=https://us.example.com"
+func ParseWeatherEndpoints(raw string) ([]WeatherEndpoint, error) {
+	var endpoints []WeatherEndpoint
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		region, url, ok := strings.Cut(entry, "=")
+		if !ok || region == "" || url == "" {
+			return nil, fmt.Errorf("invalid weather endpoint %q: want region=url", entry)
+		}
+		endpoints = append(endpoints, WeatherEndpoint{Region: region, URL: url})
+	}
+	return endpoints, nil
+}
+
+// endpointState tracks the health and latency of one endpoint
+type endpointState struct {
+	WeatherEndpoint
+	breaker *resilience.Breaker
+	// latency is a moving average of successful calls; 0 until measured
+	latency time.Duration
+}
+
+// endpointPool chooses among regional endpoints, failing over to the next
+// one when an endpoint fails repeatedly
+type endpointPool struct {
+	mu        sync.Mutex
+	endpoints []*endpointState
+	selection EndpointSelection
+}
+
+func newEndpointPool(endpoints []WeatherEndpoint, selection EndpointSelection, clk clock.Clock) *endpointPool {
+	pool := &endpointPool{selection: selection}
+	for _, endpoint := range endpoints {
+		state := &endpointState{WeatherEndpoint: endpoint, breaker: resilience.NewBreaker(weatherEndpointBreaker, clk)}
+		state.breaker.OnStateChange(func(from, to resilience.State) {
+			slog.Warn("Mudança de estado do endpoint da WeatherAPI", "region", endpoint.Region, "from", from.String(), "to", to.String())
+		})
+		pool.endpoints = append(pool.endpoints, state)
+	}
+	return pool
+}
+
+// pick returns the endpoint for the next call, skipping the ones already tried
+// by the current request so retries fail over. The caller must report the
+// call with record, or give it back with release, along with its ticket.
+func (p *endpointPool) pick(tried map[string]bool) (*endpointState, resilience.Ticket, error) {
+	for _, endpoint := range p.candidates(tried) {
+		if ticket, err := endpoint.breaker.Allow(); err == nil {
+			return endpoint, ticket, nil
+		}
+	}
+	// Every untried endpoint is unhealthy; retry one already used rather than none
+	if len(tried) > 0 {
+		return p.pick(nil)
+	}
+	return nil, resilience.Ticket{}, ErrNoHealthyEndpoint
+}
+
+// candidates lists the untried endpoints in order of preference
+func (p *endpointPool) candidates(tried map[string]bool) []*endpointState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var candidates []*endpointState
+	for _, endpoint := range p.endpoints {
+		if !tried[endpoint.Region] {
+			candidates = append(candidates, endpoint)
+		}
+	}
+	if p.selection == SelectLatency {
+		// Unmeasured endpoints sort first so every region gets measured
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].latency < candidates[j].latency })
+	}
+	return candidates
+}
+
+// release gives back an endpoint picked for a call that was never made
+func (p *endpointPool) release(endpoint *endpointState, ticket resilience.Ticket) {
+	endpoint.breaker.Release(ticket)
+}
+
+// record reports the outcome of a call to endpoint
+func (p *endpointPool) record(endpoint *endpointState, ticket resilience.Ticket, elapsed time.Duration, err error) {
+	endpoint.breaker.Record(ticket, err)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if endpoint.latency == 0 {
+		endpoint.latency = elapsed
+		return
+	}
+	endpoint.latency += time.Duration(latencySmoothing * float64(elapsed-endpoint.latency))
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"svc-b/clock"
+	"svc-b/models"
+	"svc-b/observability"
+	"testing"
+	"time"
+)
+
+// regionalHTTPClient fails every call to the down hosts, recording the hosts called
+type regionalHTTPClient struct {
+	down  map[string]bool
+	hosts []string
+}
+
+func (c *regionalHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.hosts = append(c.hosts, req.URL.Host)
+	if c.down[req.URL.Host] {
+		return nil, errors.New("connection refused")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"current":{"temp_c":25,"temp_f":77}}`)),
+	}, nil
+}
+
+func TestParseWeatherEndpoints(t *testing.T) {
+	t.Parallel()
+
+	endpoints, err := ParseWeatherEndpoints("sa-east=https://sa.example.com, us-east=https://us.example.com")
+	expected := []WeatherEndpoint{
+		{Region: "sa-east", URL: "https://sa.example.com"},
+		{Region: "us-east", URL: "https://us.example.com"},
+	}
+	if err != nil || len(endpoints) != len(expected) || endpoints[0] != expected[0] || endpoints[1] != expected[1] {
+		t.Errorf("ParseWeatherEndpoints() = %v, %v; want %v", endpoints, err, expected)
+	}
+
+	if _, err := ParseWeatherEndpoints("https://sa.example.com"); err == nil {
+		t.Error("ParseWeatherEndpoints() accepted an entry without a region")
+	}
+}
+
+func TestGetTemperatureFailsOverBetweenRegions(t *testing.T) {
+	t.Parallel()
+
+	client := &regionalHTTPClient{down: map[string]bool{"sa.example.com": true}}
+	service := NewRegionalWeatherAPIService(client, []WeatherEndpoint{
+		{Region: "sa-east", URL: "https://sa.example.com"},
+		{Region: "us-east", URL: "https://us.example.com"},
+	}, SelectOrdered, "test-key", observability.Providers{})
+	service.clock = clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	// Each request tries the preferred region first until it is marked unhealthy
+	for i := 0; i < weatherEndpointBreaker.FailureThreshold+1; i++ {
+		temp, err := service.GetTemperature(context.Background(), models.Location{City: "Rio de Janeiro"})
+		if err != nil || temp.TempC != 25 {
+			t.Fatalf("request %d = %v, %v; want a failover to us-east", i+1, temp, err)
+		}
+	}
+
+	expected := []string{
+		"sa.example.com", "us.example.com",
+		"sa.example.com", "us.example.com",
+		"sa.example.com", "us.example.com",
+		"us.example.com",
+	}
+	if strings.Join(client.hosts, ",") != strings.Join(expected, ",") {
+		t.Errorf("called %v, want %v", client.hosts, expected)
+	}
+}
+
+func TestEndpointPoolLatencySelection(t *testing.T) {
+	t.Parallel()
+
+	pool := newEndpointPool([]WeatherEndpoint{
+		{Region: "sa-east", URL: "https://sa.example.com"},
+		{Region: "us-east", URL: "https://us.example.com"},
+		{Region: "eu-west", URL: "https://eu.example.com"},
+	}, SelectLatency, clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	latencies := map[string]time.Duration{"sa-east": 80 * time.Millisecond, "us-east": 20 * time.Millisecond}
+	for _, endpoint := range pool.endpoints {
+		if latency, ok := latencies[endpoint.Region]; ok {
+			ticket, _ := endpoint.breaker.Allow()
+			pool.record(endpoint, ticket, latency, nil)
+		}
+	}
+
+	// The unmeasured region is tried first, then the fastest one
+	for _, expected := range []string{"eu-west", "us-east"} {
+		endpoint, ticket, err := pool.pick(nil)
+		if err != nil || endpoint.Region != expected {
+			t.Fatalf("pick() = %v, %v; want %s", endpoint, err, expected)
+		}
+		pool.record(endpoint, ticket, 50*time.Millisecond, nil)
+	}
+
+	// us-east averaged 20ms and 50ms, still faster than eu-west's 50ms
+	if endpoint, _, _ := pool.pick(nil); endpoint.Region != "us-east" {
+		t.Errorf("pick() = %s, want us-east", endpoint.Region)
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"pkg/telemetry"
+	"strings"
+	"svc-b/models"
+	"svc-b/observability"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WeatherRouter sends each lookup to the weather provider routed for the
+// location's state (UF), after the CEP is resolved, or to the default one.
+// Temperatures are returned stamped with the provider that measured them.
+type WeatherRouter struct {
+	providers map[string]WeatherService
+	// routes maps UFs to provider names
+	routes   map[string]string
+	fallback string
+	metrics  *telemetry.Recorder
+}
+
+// NewWeatherRouter routes between providers, by name, as routes say. Every
+// route and the fallback must name one of the providers.
+func NewWeatherRouter(providers map[string]WeatherService, routes map[string]string, fallback string, telemetry observability.Providers) *WeatherRouter {
+	return &WeatherRouter{providers: providers, routes: routes, fallback: fallback, metrics: telemetry.Recorder()}
+}
+
+// ParseWeatherRoutes parses WEATHER_PROVIDER_RULES, comma-separated UF=provider
+// pairs, e.g. "AM=openweathermap,PA=openweathermap"
+func ParseWeatherRoutes(spec string) (map[string]string, error) {
+	routes := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		uf, provider, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		uf = strings.ToUpper(strings.TrimSpace(uf))
+		provider = strings.ToLower(strings.TrimSpace(provider))
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("invalid weather route %q, want UF=provider", pair)
+		case models.StateName(uf) == "":
+			return nil, fmt.Errorf("unknown UF %q in weather route %q", uf, pair)
+		case provider != WeatherProviderWeatherAPI && provider != WeatherProviderOpenWeatherMap:
+			return nil, fmt.Errorf("unknown weather provider %q for %s: want weatherapi or openweathermap", provider, uf)
+		}
+		if _, seen := routes[uf]; seen {
+			return nil, fmt.Errorf("UF %s routed twice", uf)
+		}
+		routes[uf] = provider
+	}
+	return routes, nil
+}
+
+// route picks the provider for location
+func (r *WeatherRouter) route(location models.Location) (string, WeatherService) {
+	name, ok := r.routes[strings.ToUpper(location.State)]
+	if !ok {
+		name = r.fallback
+	}
+	return name, r.providers[name]
+}
+
+// GetTemperature asks the provider routed for the location's UF, recording
+// the choice on the span and in the provider lookups metric
+func (r *WeatherRouter) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	name, provider := r.route(location)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("weather.provider", name))
+
+	temp, err := provider.GetTemperature(ctx, location)
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	r.metrics.Add(ctx, observability.WeatherProviderLookups.Name, 1,
+		attribute.String("provider", name),
+		attribute.String("uf", location.State),
+		attribute.String("result", result),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	stamped := *temp
+	stamped.Provider = name
+	return &stamped, nil
+}
+
+// GetForecast asks the provider routed for the location's UF, which may lack
+// the forecast the default provider has
+func (r *WeatherRouter) GetForecast(ctx context.Context, location models.Location, days int) ([]models.DailyForecast, error) {
+	name, provider := r.route(location)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("weather.provider", name))
+
+	forecaster, ok := provider.(ForecastService)
+	if !ok {
+		return nil, ErrForecastUnsupported
+	}
+	return forecaster.GetForecast(ctx, location, days)
+}
+
+// Name reports the default provider's name
+func (r *WeatherRouter) Name() string {
+	return r.fallback
+}
+
+// Capabilities reports the default provider's capabilities
+func (r *WeatherRouter) Capabilities() Capabilities {
+	if provider, ok := r.providers[r.fallback].(WeatherProvider); ok {
+		return provider.Capabilities()
+	}
+	return Capabilities{}
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"svc-b/models"
+	"svc-b/observability"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// namedWeatherService answers a temperature per provider, so the routing
+// shows in the answer
+type namedWeatherService struct {
+	tempC float64
+}
+
+func (s namedWeatherService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	if location.City == "Atlantis" {
+		return nil, ErrCityNotFound
+	}
+	temp := models.FromCelsius(s.tempC)
+	return &temp, nil
+}
+
+// forecastingWeatherService is a namedWeatherService with forecasts
+type forecastingWeatherService struct {
+	namedWeatherService
+}
+
+func (s forecastingWeatherService) GetForecast(ctx context.Context, location models.Location, days int) ([]models.DailyForecast, error) {
+	return make([]models.DailyForecast, days), nil
+}
+
+func TestParseWeatherRoutes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		spec      string
+		expected  map[string]string
+		expectErr bool
+	}{
+		{"Empty", "", map[string]string{}, false},
+		{"Routes", "AM=openweathermap, pa=OpenWeatherMap,SP=weatherapi", map[string]string{"AM": "openweathermap", "PA": "openweathermap", "SP": "weatherapi"}, false},
+		{"Malformed pair", "AM", nil, true},
+		{"Unknown UF", "XX=openweathermap", nil, true},
+		{"Unknown provider", "AM=climatempo", nil, true},
+		{"UF routed twice", "AM=openweathermap,AM=weatherapi", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			routes, err := ParseWeatherRoutes(tt.spec)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseWeatherRoutes(%q) error = %v, expectErr %v", tt.spec, err, tt.expectErr)
+			}
+			if err == nil && !reflect.DeepEqual(routes, tt.expected) {
+				t.Errorf("ParseWeatherRoutes(%q) = %v, want %v", tt.spec, routes, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWeatherRouter(t *testing.T) {
+	t.Parallel()
+
+	router := NewWeatherRouter(map[string]WeatherService{
+		WeatherProviderWeatherAPI:     forecastingWeatherService{namedWeatherService{tempC: 25}},
+		WeatherProviderOpenWeatherMap: namedWeatherService{tempC: 31},
+	}, map[string]string{"AM": WeatherProviderOpenWeatherMap}, WeatherProviderWeatherAPI, observability.Providers{})
+
+	tests := []struct {
+		name             string
+		location         models.Location
+		expectedProvider string
+		expectedC        float64
+		expectedErr      error
+	}{
+		{"Routed UF", models.Location{City: "Manaus", State: "AM"}, WeatherProviderOpenWeatherMap, 31, nil},
+		{"Lowercase UF", models.Location{City: "Manaus", State: "am"}, WeatherProviderOpenWeatherMap, 31, nil},
+		{"Other UF", models.Location{City: "Sorocaba", State: "SP"}, WeatherProviderWeatherAPI, 25, nil},
+		{"No UF", models.Location{City: "Sorocaba"}, WeatherProviderWeatherAPI, 25, nil},
+		{"Provider error", models.Location{City: "Atlantis", State: "AM"}, "", 0, ErrCityNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			temp, err := router.GetTemperature(context.Background(), tt.location)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("GetTemperature() error = %v, want %v", err, tt.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+			if temp.Provider != tt.expectedProvider || temp.TempC != tt.expectedC {
+				t.Errorf("GetTemperature() = %+v, want %v°C from %s", temp, tt.expectedC, tt.expectedProvider)
+			}
+		})
+	}
+
+	if _, err := router.GetForecast(context.Background(), models.Location{City: "Manaus", State: "AM"}, 3); !errors.Is(err, ErrForecastUnsupported) {
+		t.Errorf("GetForecast() routed to a provider without forecasts: error = %v, want ErrForecastUnsupported", err)
+	}
+	if days, err := router.GetForecast(context.Background(), models.Location{City: "Sorocaba", State: "SP"}, 3); err != nil || len(days) != 3 {
+		t.Errorf("GetForecast() = %d days, %v; want 3 from the default provider", len(days), err)
+	}
+}
+
+func TestWeatherRouterRecordsLookups(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	router := NewWeatherRouter(map[string]WeatherService{
+		WeatherProviderWeatherAPI:     namedWeatherService{tempC: 25},
+		WeatherProviderOpenWeatherMap: namedWeatherService{tempC: 31},
+	}, map[string]string{"AM": WeatherProviderOpenWeatherMap}, WeatherProviderWeatherAPI,
+		observability.Providers{MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))})
+
+	router.GetTemperature(ctx, models.Location{City: "Manaus", State: "AM"})
+	router.GetTemperature(ctx, models.Location{City: "Manaus", State: "AM"})
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name != observability.WeatherProviderLookups.Name {
+				continue
+			}
+			points := m.Data.(metricdata.Sum[int64]).DataPoints
+			provider, _ := points[0].Attributes.Value(attribute.Key("provider"))
+			if len(points) != 1 || points[0].Value != 2 || provider.AsString() != WeatherProviderOpenWeatherMap {
+				t.Errorf("%s = %+v, want 2 lookups on %s", m.Name, points, WeatherProviderOpenWeatherMap)
+			}
+			return
+		}
+	}
+	t.Errorf("%s not recorded on the injected meter provider", observability.WeatherProviderLookups.Name)
+}
@@ -2,124 +2,154 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
+	"pkg/telemetry"
+	"strconv"
+	"strings"
+	"svc-b/clock"
 	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/resilience"
+	"sync/atomic"
 	"time"
 
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	ErrAPIKeyNotConfigured = errors.New("weather API key not configured")
 	ErrWeatherAPIFailed    = errors.New("weather API request failed")
 	ErrCityNotFound        = errors.New("city not found")
+	ErrForecastUnsupported = errors.New("weather provider has no forecast")
 )
 
+// weatherAPIKeyErrorCodes are the WeatherAPI error codes for a missing,
+// invalid or disabled API key
+var weatherAPIKeyErrorCodes = map[int]bool{1002: true, 2006: true, 2008: true}
+
 type WeatherAPIService struct {
-	client  HTTPClient
-	baseURL string
+	client HTTPClient
+	// endpoints holds the regional base URLs, failing over between them
+	endpoints *endpointPool
+	apiKey    string
+	clock     clock.Clock
+	tracer    trace.Tracer
+	retry     resilience.RetryPolicy
+	breaker   *resilience.Breaker
+	events    *observability.EventBus
+	// keyRejected is set while WeatherAPI rejects the key, so the event is
+	// published once per outage rather than per request
+	keyRejected atomic.Bool
 }
 
 type WeatherAPIResponse struct {
-	Current struct {
+	Location models.ResolvedLocation `json:"location"`
+	Current  struct {
 		TempC float64 `json:"temp_c"`
 		TempF float64 `json:"temp_f"`
 	} `json:"current"`
-	Error struct {
-		Code    int    `json:"code"`
-		Message string `json:"message"`
-	} `json:"error,omitempty"`
+	Error WeatherAPIError `json:"error,omitempty"`
 }
 
-func NewWeatherAPIService(client HTTPClient) *WeatherAPIService {
-	return &WeatherAPIService{
-		client:  client,
-		baseURL: "https://api.weatherapi.com/v1/current.json",
-	}
+// WeatherAPIError is the error object WeatherAPI answers failed requests with
+type WeatherAPIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
-func (s *WeatherAPIService) GetTemperature(ctx context.Context, city string) (*models.Temperature, error) {
-	tracer := otel.Tracer("weather-api-service")
-	ctx, span := tracer.Start(ctx, "WeatherAPI-GetTemperature")
-	defer span.End()
+// WeatherAPIForecastResponse is the part of a forecast.json response used for
+// daily forecasts
+type WeatherAPIForecastResponse struct {
+	Forecast struct {
+		ForecastDay []struct {
+			Date string `json:"date"`
+			Day  struct {
+				MaxTempC  float64 `json:"maxtemp_c"`
+				MinTempC  float64 `json:"mintemp_c"`
+				AvgTempC  float64 `json:"avgtemp_c"`
+				Condition struct {
+					Code int `json:"code"`
+				} `json:"condition"`
+			} `json:"day"`
+		} `json:"forecastday"`
+	} `json:"forecast"`
+	Error WeatherAPIError `json:"error,omitempty"`
+}
 
-	span.SetAttributes(attribute.String("city", city))
+// NewWeatherAPIService creates the WeatherAPI client for the API at baseURL, e.g. https://api.weatherapi.com
+func NewWeatherAPIService(client HTTPClient, baseURL, apiKey string, providers observability.Providers) *WeatherAPIService {
+	return NewRegionalWeatherAPIService(client, []WeatherEndpoint{{Region: "default", URL: baseURL}}, SelectOrdered, apiKey, providers)
+}
 
-	apiKey := os.Getenv("WEATHER_API_KEY")
-	if apiKey == "" {
-		log.Printf("WEATHER_API_KEY não configurada")
-		span.SetStatus(codes.Error, "API key not configured")
-		return nil, ErrAPIKeyNotConfigured
+// NewRegionalWeatherAPIService creates the WeatherAPI client for several
+// regional endpoints, choosing among the healthy ones by selection. Retries
+// fail over to another endpoint.
+func NewRegionalWeatherAPIService(client HTTPClient, endpoints []WeatherEndpoint, selection EndpointSelection, apiKey string, providers observability.Providers) *WeatherAPIService {
+	s := &WeatherAPIService{
+		client:    client,
+		endpoints: newEndpointPool(endpoints, selection, clock.Real{}),
+		apiKey:    apiKey,
+		clock:     clock.Real{},
+		tracer:    providers.Tracer("weather-api-service"),
+		retry:     DefaultRetry,
+		events:    providers.Events,
 	}
+	return s.WithBreaker(DefaultBreaker)
+}
 
-	encodedCity := url.QueryEscape(city)
-	reqURL := fmt.Sprintf("%s?key=%s&q=%s", s.baseURL, apiKey, encodedCity)
-
-	span.SetAttributes(attribute.String("url", s.baseURL))
-
-	// Add timeout to context if not already set
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-
-	// Implement retry logic
-	var resp *http.Response
-	var err error
-	maxRetries := 3
+// WithRetry replaces the retry policy
+func (s *WeatherAPIService) WithRetry(policy resilience.RetryPolicy) *WeatherAPIService {
+	s.retry = policy
+	return s
+}
 
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
-		if err != nil {
-			log.Printf("Erro ao criar requisição para WeatherAPI (tentativa %d): %v", attempt, err)
-			time.Sleep(time.Duration(attempt*100) * time.Millisecond)
-			continue
-		}
+// WithBreaker replaces the circuit breaker with one using config
+func (s *WeatherAPIService) WithBreaker(config resilience.BreakerConfig) *WeatherAPIService {
+	s.breaker = resilience.NewBreaker(config, s.clock)
+	s.breaker.OnStateChange(breakerEvents(s.events, s.Name(), "WeatherAPI"))
+	return s
+}
 
-		resp, err = s.client.Do(req)
-		if err == nil {
-			break
-		}
+// Name identifies the provider in capability reports
+func (s *WeatherAPIService) Name() string {
+	return WeatherProviderWeatherAPI
+}
 
-		log.Printf("Erro ao fazer requisição para WeatherAPI (tentativa %d): %v", attempt, err)
-		if attempt < maxRetries {
-			time.Sleep(time.Duration(attempt*100) * time.Millisecond)
-		}
-	}
+// Capabilities reports the optional features implemented for WeatherAPI
+func (s *WeatherAPIService) Capabilities() Capabilities {
+	return Capabilities{Forecast: true}
+}
 
-	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		return nil, fmt.Errorf("all weather API requests failed: %w", err)
-	}
-	defer resp.Body.Close()
+// GetTemperature fetches the current temperature at location, qualified by
+// its state and country so WeatherAPI doesn't pick a namesake elsewhere. The
+// place WeatherAPI resolved it to is returned with the temperature.
+func (s *WeatherAPIService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	ctx, span := s.tracer.Start(ctx, observability.SpanWeatherAPIGetTemperature.Name)
+	defer span.End()
 
-	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	query := weatherAPIQuery(location)
+	span.SetAttributes(
+		attribute.String("city", location.City),
+		attribute.String("state", location.State),
+		attribute.String("weather.query", query),
+	)
 
 	var weatherResp WeatherAPIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&weatherResp); err != nil {
-		log.Printf("Erro ao decodificar resposta da WeatherAPI: %v", err)
-		span.SetStatus(codes.Error, err.Error())
-		return nil, fmt.Errorf("failed to decode API response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Status code inválido da WeatherAPI: %d, error: %s",
-			resp.StatusCode, weatherResp.Error.Message)
-		span.SetStatus(codes.Error, weatherResp.Error.Message)
-
-		// Check for city not found error (common error code: 1006)
-		if weatherResp.Error.Code == 1006 {
-			return nil, ErrCityNotFound
-		}
-
-		return nil, fmt.Errorf("%w: %s", ErrWeatherAPIFailed, weatherResp.Error.Message)
+	if err := s.call(ctx, span, "/v1/current.json", url.Values{"q": {query}}, &weatherResp, &weatherResp.Error); err != nil {
+		return nil, err
 	}
+	resolved := weatherResp.Location
+	span.SetAttributes(
+		attribute.String("weather.location.name", resolved.Name),
+		attribute.String("weather.location.region", resolved.Region),
+		attribute.String("weather.location.country", resolved.Country),
+	)
 
 	// Get and calculate temperatures
 	tempC := weatherResp.Current.TempC
@@ -140,17 +170,158 @@ func (s *WeatherAPIService) GetTemperature(ctx context.Context, city string) (*m
 		attribute.Float64("temp_k", tempK),
 	)
 
-	return &models.Temperature{
-		TempC: round(tempC, 2),
-		TempF: round(tempF, 2),
-		TempK: round(tempK, 2),
-	}, nil
+	temp := &models.Temperature{
+		TempC: tempC,
+		TempF: tempF,
+		TempK: tempK,
+	}
+	if resolved.Name != "" {
+		temp.Location = &resolved
+	}
+	return temp, nil
 }
 
-func round(num float64, places int) float64 {
-	factor := float64(1)
-	for i := 0; i < places; i++ {
-		factor *= 10
+// weatherAPIQuery qualifies the city with its state, when known, and country,
+// e.g. "Sorocaba, Sao Paulo, Brazil"
+func weatherAPIQuery(location models.Location) string {
+	if state := models.StateName(location.State); state != "" {
+		return location.City + ", " + state + ", Brazil"
 	}
-	return float64(int(num*factor+0.5)) / factor
+	return location.City + ", Brazil"
+}
+
+// GetForecast fetches the forecast for location's next days, today included.
+// Each day is recorded on the span as a forecast.day event.
+func (s *WeatherAPIService) GetForecast(ctx context.Context, location models.Location, days int) ([]models.DailyForecast, error) {
+	ctx, span := s.tracer.Start(ctx, observability.SpanWeatherAPIGetForecast.Name)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("city", location.City),
+		attribute.String("state", location.State),
+		attribute.Int("forecast.days", days),
+	)
+
+	var forecastResp WeatherAPIForecastResponse
+	query := url.Values{"q": {weatherAPIQuery(location)}, "days": {strconv.Itoa(days)}, "aqi": {"no"}, "alerts": {"no"}}
+	if err := s.call(ctx, span, "/v1/forecast.json", query, &forecastResp, &forecastResp.Error); err != nil {
+		return nil, err
+	}
+
+	forecast := make([]models.DailyForecast, 0, len(forecastResp.Forecast.ForecastDay))
+	for _, day := range forecastResp.Forecast.ForecastDay {
+		daily := models.DailyForecast{
+			Date:          day.Date,
+			Min:           models.FromCelsius(day.Day.MinTempC),
+			Max:           models.FromCelsius(day.Day.MaxTempC),
+			Avg:           models.FromCelsius(day.Day.AvgTempC),
+			ConditionCode: day.Day.Condition.Code,
+		}
+		span.AddEvent("forecast.day", trace.WithAttributes(
+			attribute.String("date", daily.Date),
+			attribute.Float64("min_temp_c", daily.Min.TempC),
+			attribute.Float64("max_temp_c", daily.Max.TempC),
+			attribute.Float64("avg_temp_c", daily.Avg.TempC),
+			attribute.Int("condition_code", daily.ConditionCode),
+		))
+		forecast = append(forecast, daily)
+	}
+	return forecast, nil
+}
+
+// call sends a GET for path to WeatherAPI, retrying and failing over between
+// endpoints, and decodes the response into out. apiErr is the error object
+// within out, read when WeatherAPI rejects the request.
+func (s *WeatherAPIService) call(ctx context.Context, span trace.Span, path string, query url.Values, out any, apiErr *WeatherAPIError) error {
+	if s.apiKey == "" {
+		slog.ErrorContext(ctx, "WEATHERAPI_API_KEY não configurada")
+		span.SetStatus(codes.Error, "API key not configured")
+		return ErrAPIKeyNotConfigured
+	}
+
+	// The key itself is sent in WeatherAPIKeyHeader by the transport set up
+	// with NewAPIKeyTransport, keeping it out of the URL
+	encoded := query.Encode()
+
+	// Retries stand down while the breaker is half-open, sending a single probe.
+	// Each attempt goes to an endpoint the request hasn't tried yet.
+	tried := make(map[string]bool)
+	resp, attempts, err := doUpstream(ctx, s.clock, s.retry, s.breaker, func(ctx context.Context) (*http.Response, error) {
+		endpoint, ticket, err := s.endpoints.pick(tried)
+		if err != nil {
+			return nil, err
+		}
+		tried[endpoint.Region] = true
+		span.SetAttributes(attribute.String("weather.endpoint.region", endpoint.Region))
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(endpoint.URL, "/")+path+"?"+encoded, nil)
+		if err != nil {
+			s.endpoints.release(endpoint, ticket)
+			return nil, err
+		}
+
+		start := time.Now()
+		resp, err := s.client.Do(req)
+		err = telemetry.SanitizeError(err)
+		switch {
+		case errors.Is(err, resilience.ErrNotAttempted), err != nil && ctx.Err() != nil:
+			// A request the caller gave up on says nothing about the endpoint
+			s.endpoints.release(endpoint, ticket)
+		case err != nil:
+			slog.ErrorContext(ctx, "Erro ao fazer requisição para WeatherAPI", "region", endpoint.Region, "error", err)
+			s.endpoints.record(endpoint, ticket, 0, err)
+		case resp.StatusCode >= http.StatusInternalServerError:
+			s.endpoints.record(endpoint, ticket, 0, fmt.Errorf("status %d", resp.StatusCode))
+		default:
+			s.endpoints.record(endpoint, ticket, time.Since(start), nil)
+		}
+		return resp, err
+	})
+	span.SetAttributes(
+		attribute.Int("attempts", attempts),
+		attribute.String("breaker.state", s.breaker.State().String()),
+	)
+
+	if err != nil {
+		recordBreakerOpen(span, s.Name(), err)
+		recordFailure(span, err)
+		return fmt.Errorf("all weather API requests failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := decodeUpstreamJSON(resp.Body, out); err != nil {
+		slog.ErrorContext(ctx, "Erro ao decodificar resposta da WeatherAPI", "error", err)
+		recordFailure(span, err)
+		if errors.Is(err, ErrUpstreamResponseTooLarge) {
+			return err
+		}
+		return fmt.Errorf("failed to decode API response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		slog.WarnContext(ctx, "Status code inválido da WeatherAPI",
+			"status", resp.StatusCode, "error_code", apiErr.Code, "error", apiErr.Message)
+
+		// Check for city not found error (common error code: 1006)
+		if apiErr.Code == 1006 {
+			span.SetStatus(codes.Error, apiErr.Message)
+			return ErrCityNotFound
+		}
+		err := fmt.Errorf("%w: %s", ErrWeatherAPIFailed, apiErr.Message)
+		recordFailure(span, err)
+
+		if weatherAPIKeyErrorCodes[apiErr.Code] && s.keyRejected.CompareAndSwap(false, true) {
+			s.events.Publish(ctx, observability.Event{
+				Kind:       observability.EventAPIKeyInvalid,
+				Source:     s.Name(),
+				Message:    apiErr.Message,
+				Attributes: map[string]string{"error_code": strconv.Itoa(apiErr.Code)},
+			})
+		}
+
+		return err
+	}
+
+	s.keyRejected.Store(false)
+	return nil
 }
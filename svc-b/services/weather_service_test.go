@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"pkg/telemetry/telemetrytest"
+	"reflect"
+	"strings"
+	"svc-b/clock"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/resilience"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// flakyHTTPClient fails the first failures calls, then returns body
+type flakyHTTPClient struct {
+	failures int
+	calls    int
+	body     string
+}
+
+func (c *flakyHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		return nil, errors.New("connection reset by peer")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(c.body)),
+	}, nil
+}
+
+func TestGetTemperatureRetryBackoff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		failures       int
+		expectedSleeps []time.Duration
+		expectErr      bool
+	}{
+		{
+			name:     "First try succeeds",
+			failures: 0,
+		},
+		{
+			name:           "Succeeds after retries",
+			failures:       2,
+			expectedSleeps: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond},
+		},
+		{
+			name:           "All attempts fail",
+			failures:       3,
+			expectedSleeps: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond},
+			expectErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			client := &flakyHTTPClient{failures: tt.failures, body: `{"current":{"temp_c":25,"temp_f":77}}`}
+			service := NewWeatherAPIService(client, "https://api.weatherapi.com", "test-key", observability.Providers{}).
+				WithRetry(resilience.RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond})
+			service.clock = fake
+
+			temp, err := service.GetTemperature(context.Background(), models.Location{City: "Rio de Janeiro"})
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.expectErr && temp.TempC != 25 {
+				t.Errorf("got temp_C %v, want 25", temp.TempC)
+			}
+			if got := fake.Sleeps(); !reflect.DeepEqual(got, tt.expectedSleeps) {
+				t.Errorf("backoff schedule = %v, want %v", got, tt.expectedSleeps)
+			}
+		})
+	}
+}
+
+// rejectingHTTPClient answers like WeatherAPI does for an invalid key
+type rejectingHTTPClient struct{}
+
+func (rejectingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusUnauthorized,
+		Body:       io.NopCloser(strings.NewReader(`{"error":{"code":2006,"message":"API key is invalid."}}`)),
+	}, nil
+}
+
+func TestGetTemperaturePublishesKeyRejectionOnce(t *testing.T) {
+	t.Parallel()
+
+	bus := observability.NewEventBus()
+	var events []observability.Event
+	bus.Subscribe(func(ctx context.Context, event observability.Event) {
+		events = append(events, event)
+	})
+
+	service := NewWeatherAPIService(rejectingHTTPClient{}, "https://api.weatherapi.com", "bad-key", observability.Providers{Events: bus})
+	for range 3 {
+		if _, err := service.GetTemperature(context.Background(), models.Location{City: "Rio de Janeiro"}); !errors.Is(err, ErrWeatherAPIFailed) {
+			t.Fatalf("GetTemperature() error = %v, want ErrWeatherAPIFailed", err)
+		}
+	}
+
+	if len(events) != 1 || events[0].Kind != observability.EventAPIKeyInvalid || events[0].Attributes["error_code"] != "2006" {
+		t.Errorf("published %+v, want a single api_key_invalid event", events)
+	}
+}
+
+// locationHTTPClient answers current.json requests with the location named
+// by the query's city, keeping the last request
+type locationHTTPClient struct {
+	request *http.Request
+}
+
+func (c *locationHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.request = req
+	city, _, _ := strings.Cut(req.URL.Query().Get("q"), ",")
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"location":{"name":"` + city + `","region":"Sao Paulo","country":"Brazil"},"current":{"temp_c":25}}`)),
+	}, nil
+}
+
+func TestGetTemperatureQualifiesCityWithState(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		location      models.Location
+		expectedQuery string
+	}{
+		{"Known UF", models.Location{City: "Sorocaba", State: "SP"}, "Sorocaba, Sao Paulo, Brazil"},
+		{"Lowercase UF", models.Location{City: "São Francisco", State: "mg"}, "São Francisco, Minas Gerais, Brazil"},
+		{"No UF", models.Location{City: "Sorocaba"}, "Sorocaba, Brazil"},
+		{"Unknown UF", models.Location{City: "Sorocaba", State: "XX"}, "Sorocaba, Brazil"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &locationHTTPClient{}
+			recorder := tracetest.NewSpanRecorder()
+			providers := observability.Providers{TracerProvider: telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))}
+			service := NewWeatherAPIService(client, "https://api.weatherapi.com", "test-key", providers)
+
+			temp, err := service.GetTemperature(context.Background(), tt.location)
+			if err != nil {
+				t.Fatalf("GetTemperature() error = %v", err)
+			}
+			if got := client.request.URL.Query().Get("q"); got != tt.expectedQuery {
+				t.Errorf("q = %q, want %q", got, tt.expectedQuery)
+			}
+			expected := &models.ResolvedLocation{Name: tt.location.City, Region: "Sao Paulo", Country: "Brazil"}
+			if !reflect.DeepEqual(temp.Location, expected) {
+				t.Errorf("resolved location = %+v, want %+v", temp.Location, expected)
+			}
+
+			var recorded string
+			for _, attr := range recorder.Ended()[0].Attributes() {
+				if attr.Key == "weather.location.region" {
+					recorded = attr.Value.AsString()
+				}
+			}
+			if recorded != "Sao Paulo" {
+				t.Errorf("weather.location.region = %q, want Sao Paulo", recorded)
+			}
+		})
+	}
+}
+
+// forecastHTTPClient answers forecast.json requests, keeping the last one
+type forecastHTTPClient struct {
+	request *http.Request
+}
+
+func (c *forecastHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.request = req
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body: io.NopCloser(strings.NewReader(`{"forecast":{"forecastday":[
+			{"date":"2024-01-01","day":{"maxtemp_c":31,"mintemp_c":22,"avgtemp_c":26.5,"condition":{"code":1000}}},
+			{"date":"2024-01-02","day":{"maxtemp_c":28,"mintemp_c":21,"avgtemp_c":24,"condition":{"code":1189}}}
+		]}}`)),
+	}, nil
+}
+
+func TestGetForecast(t *testing.T) {
+	t.Parallel()
+
+	client := &forecastHTTPClient{}
+	recorder := tracetest.NewSpanRecorder()
+	providers := observability.Providers{TracerProvider: telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder))}
+	service := NewWeatherAPIService(client, "https://api.weatherapi.com", "test-key", providers)
+
+	forecast, err := service.GetForecast(context.Background(), models.Location{City: "Rio de Janeiro"}, 2)
+	if err != nil {
+		t.Fatalf("GetForecast() error = %v", err)
+	}
+
+	if got := client.request.URL.Path; got != "/v1/forecast.json" {
+		t.Errorf("requested %s, want /v1/forecast.json", got)
+	}
+	if got := client.request.URL.Query().Get("days"); got != "2" {
+		t.Errorf("requested days = %q, want 2", got)
+	}
+	expected := []models.DailyForecast{
+		{Date: "2024-01-01", Min: models.FromCelsius(22), Max: models.FromCelsius(31), Avg: models.FromCelsius(26.5), ConditionCode: 1000},
+		{Date: "2024-01-02", Min: models.FromCelsius(21), Max: models.FromCelsius(28), Avg: models.FromCelsius(24), ConditionCode: 1189},
+	}
+	if !reflect.DeepEqual(forecast, expected) {
+		t.Errorf("GetForecast() = %+v, want %+v", forecast, expected)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != observability.SpanWeatherAPIGetForecast.Name {
+		t.Fatalf("recorded %d spans, want a single %s", len(spans), observability.SpanWeatherAPIGetForecast.Name)
+	}
+	if events := spans[0].Events(); len(events) != len(expected) || events[0].Name != "forecast.day" {
+		t.Errorf("recorded events %+v, want a forecast.day event per day", events)
+	}
+}
@@ -0,0 +1,188 @@
+// Package tlspolicy enforces the TLS settings of outbound calls: a minimum
+// version, an allow-list of cipher suites and optional pins on the
+// certificates presented by some hosts
+package tlspolicy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrInvalidPolicy = errors.New("invalid TLS policy")
+	ErrPinMismatch   = errors.New("no certificate in the chain matches the pinned keys")
+)
+
+// Policy is the TLS policy of outbound calls
+type Policy struct {
+	MinVersion uint16
+	// CipherSuites restricts the TLS 1.2 cipher suites; empty keeps Go's
+	// defaults. TLS 1.3 suites are not configurable.
+	CipherSuites []uint16
+	// Pins maps host names to the base64 SHA-256 hashes of the public keys
+	// accepted in their chain, so a pin can name the provider's CA or leaf
+	Pins map[string][]string
+}
+
+// Parse builds a Policy from its configuration: the minimum version (1.2 or
+// 1.3), a comma-separated list of cipher suite names as in crypto/tls and the
+// pins per host. Anything it can't enforce is an error, so a typo fails at
+// startup rather than silently weakening the policy.
+func Parse(minVersion, cipherSuites string, pins map[string]string) (Policy, error) {
+	var policy Policy
+	switch strings.TrimSpace(minVersion) {
+	case "1.2", "":
+		policy.MinVersion = tls.VersionTLS12
+	case "1.3":
+		policy.MinVersion = tls.VersionTLS13
+	default:
+		return Policy{}, fmt.Errorf("%w: minimum version %q, want 1.2 or 1.3", ErrInvalidPolicy, minVersion)
+	}
+
+	secure := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = suite.ID
+	}
+	insecure := make(map[string]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+	for _, name := range strings.Split(cipherSuites, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		id, ok := secure[name]
+		if !ok {
+			if insecure[name] {
+				return Policy{}, fmt.Errorf("%w: cipher suite %s is insecure", ErrInvalidPolicy, name)
+			}
+			return Policy{}, fmt.Errorf("%w: unknown cipher suite %q", ErrInvalidPolicy, name)
+		}
+		policy.CipherSuites = append(policy.CipherSuites, id)
+	}
+	if len(policy.CipherSuites) > 0 && policy.MinVersion == tls.VersionTLS13 {
+		return Policy{}, fmt.Errorf("%w: cipher suites only apply below TLS 1.3", ErrInvalidPolicy)
+	}
+
+	for host, raw := range pins {
+		for _, pin := range strings.Split(raw, ",") {
+			if pin = strings.TrimSpace(pin); pin == "" {
+				continue
+			}
+			if hash, err := base64.StdEncoding.DecodeString(pin); err != nil || len(hash) != sha256.Size {
+				return Policy{}, fmt.Errorf("%w: pin %q for %s is not a base64 SHA-256 hash", ErrInvalidPolicy, pin, host)
+			}
+			if policy.Pins == nil {
+				policy.Pins = make(map[string][]string)
+			}
+			policy.Pins[host] = append(policy.Pins[host], pin)
+		}
+	}
+	return policy, nil
+}
+
+// Apply returns a copy of config, which may be nil, enforcing the version
+// and cipher suites of the policy
+func (p Policy) Apply(config *tls.Config) *tls.Config {
+	if config = config.Clone(); config == nil {
+		config = &tls.Config{}
+	}
+	config.MinVersion = p.MinVersion
+	config.CipherSuites = p.CipherSuites
+	return config
+}
+
+// verifyPins checks the verified chain of a connection to host holds one of
+// pins, on top of the usual chain verification
+func verifyPins(host string, pins []string) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		for _, chain := range state.VerifiedChains {
+			for _, cert := range chain {
+				hash := PinOf(cert)
+				for _, pin := range pins {
+					if pin == hash {
+						return nil
+					}
+				}
+			}
+		}
+		return fmt.Errorf("%w: %s", ErrPinMismatch, host)
+	}
+}
+
+// PinOf returns the pin of a certificate, the base64 SHA-256 hash of its
+// public key
+func PinOf(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// Transport returns clones of base enforcing the policy, recording the
+// handshake of each connection on the span of the request that opened it.
+// Pinned hosts get their own connection pool, as the server name of a
+// connection isn't known when the host is an IP address.
+func (p Policy) Transport(base *http.Transport) http.RoundTripper {
+	t := &handshakeTransport{next: base.Clone(), pinned: make(map[string]http.RoundTripper)}
+	t.next.TLSClientConfig = p.Apply(base.TLSClientConfig)
+	for host, pins := range p.Pins {
+		pinned := base.Clone()
+		pinned.TLSClientConfig = p.Apply(base.TLSClientConfig)
+		pinned.TLSClientConfig.VerifyConnection = verifyPins(host, pins)
+		t.pinned[host] = pinned
+	}
+	return t
+}
+
+// handshakeTransport sends requests to pinned hosts through their transport,
+// recording TLS handshakes in spans
+type handshakeTransport struct {
+	next   *http.Transport
+	pinned map[string]http.RoundTripper
+}
+
+func (t *handshakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := http.RoundTripper(t.next)
+	if pinned, ok := t.pinned[req.URL.Hostname()]; ok {
+		next = pinned
+	}
+
+	ctx := req.Context()
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return next.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				span.SetAttributes(attribute.Bool("tls.established", false), attribute.String("tls.error", err.Error()))
+				return
+			}
+			span.SetAttributes(
+				attribute.Bool("tls.established", true),
+				attribute.String("tls.protocol.version", strings.TrimPrefix(tls.VersionName(state.Version), "TLS ")),
+				attribute.String("tls.cipher", tls.CipherSuiteName(state.CipherSuite)),
+				attribute.Bool("tls.resumed", state.DidResume),
+			)
+			if len(state.PeerCertificates) > 0 {
+				leaf := state.PeerCertificates[0]
+				span.SetAttributes(
+					attribute.String("tls.server.issuer", leaf.Issuer.String()),
+					attribute.String("tls.server.not_after", leaf.NotAfter.UTC().Format("2006-01-02T15:04:05Z")),
+				)
+			}
+		},
+	}))
+	return next.RoundTrip(req)
+}
@@ -0,0 +1,112 @@
+package tlspolicy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"pkg/telemetry/telemetrytest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	pin := "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	tests := []struct {
+		name       string
+		minVersion string
+		ciphers    string
+		pins       map[string]string
+		expectErr  bool
+	}{
+		{"Defaults", "", "", nil, false},
+		{"TLS 1.3", "1.3", "", nil, false},
+		{"Allow-listed suites", "1.2", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", nil, false},
+		{"Pins", "1.2", "", map[string]string{"viacep.com.br": pin + "," + pin}, false},
+		{"TLS 1.0", "1.0", "", nil, true},
+		{"Unknown suite", "1.2", "TLS_FAST", nil, true},
+		{"Insecure suite", "1.2", "TLS_RSA_WITH_RC4_128_SHA", nil, true},
+		{"Suites with TLS 1.3", "1.3", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", nil, true},
+		{"Malformed pin", "1.2", "", map[string]string{"viacep.com.br": "sha256/abc"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse(tt.minVersion, tt.ciphers, tt.pins)
+			if (err != nil) != tt.expectErr || (err != nil && !errors.Is(err, ErrInvalidPolicy)) {
+				t.Errorf("Parse() error = %v, expectErr %v", err, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+	host, _ := url.Parse(server.URL)
+	serverPin := PinOf(server.Certificate())
+	otherPin := "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	tests := []struct {
+		name        string
+		minVersion  string
+		pin         string
+		expectedErr error
+		expectedVer string
+	}{
+		{"Unpinned", "1.2", "", nil, "1.3"},
+		{"Pinned", "1.3", serverPin, nil, "1.3"},
+		{"Pin mismatch", "1.2", otherPin, ErrPinMismatch, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			policy, err := Parse(tt.minVersion, "", map[string]string{host.Hostname(): tt.pin})
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			// The test server's certificate is trusted by its own client
+			base := server.Client().Transport.(*http.Transport)
+			client := &http.Client{Transport: policy.Transport(base)}
+
+			recorder := tracetest.NewSpanRecorder()
+			ctx, span := telemetrytest.NewTracerProvider(t, sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "ViaCEP.GetCityByCEP")
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+			resp, err := client.Do(req)
+			span.End()
+			if err == nil {
+				resp.Body.Close()
+			}
+			if !errors.Is(err, tt.expectedErr) || (tt.expectedErr == nil) != (err == nil) {
+				t.Fatalf("Do() error = %v, want %v", err, tt.expectedErr)
+			}
+
+			attrs := make(map[string]string)
+			for _, kv := range recorder.Ended()[0].Attributes() {
+				attrs[string(kv.Key)] = kv.Value.Emit()
+			}
+			if tt.expectedErr != nil {
+				if attrs["tls.established"] != "false" || attrs["tls.error"] == "" {
+					t.Errorf("span attributes = %v, want the failed handshake", attrs)
+				}
+				return
+			}
+			if attrs["tls.established"] != "true" || attrs["tls.protocol.version"] != tt.expectedVer ||
+				attrs["tls.cipher"] != tls.CipherSuiteName(tls.TLS_AES_128_GCM_SHA256) || attrs["tls.server.issuer"] != "O=Acme Co" {
+				t.Errorf("span attributes = %v, want the handshake details", attrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+// Command dashboards emits the Grafana dashboard JSON derived from the metrics
+// svc-b declares in the observability package.
+//
+//	go run ./tools/dashboards > dashboards/svc-b.json
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"svc-b/observability"
+)
+
+func main() {
+	out := flag.String("out", "", "file to write the dashboard to (defaults to stdout)")
+	service := flag.String("service", "svc-b", "service name used for the dashboard title and uid")
+	flag.Parse()
+
+	dashboard, err := observability.GrafanaDashboard(*service, observability.Metrics)
+	if err != nil {
+		log.Fatalf("Failed to generate dashboard: %v", err)
+	}
+	dashboard = append(dashboard, '\n')
+
+	if *out == "" {
+		os.Stdout.Write(dashboard)
+		return
+	}
+
+	if err := os.WriteFile(*out, dashboard, 0o644); err != nil {
+		log.Fatalf("Failed to write dashboard: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package tuning
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// CPUSettings is the GOMAXPROCS in effect
+type CPUSettings struct {
+	MaxProcs int
+	// Source says where MaxProcs came from: env, cgroup or host
+	Source string
+	// Quota is the cgroup CPU quota in cores, 0 when there is none
+	Quota float64
+}
+
+// ResolveMaxProcs decides GOMAXPROCS: an explicit value wins, otherwise the
+// container CPU quota rounded down (at least 1) when it is below the host's
+// CPU count. A fractional limit such as 1.5 CPUs gives 1, so the scheduler
+// doesn't run more threads than the quota can serve and get throttled.
+func ResolveMaxProcs(explicit int, cgroupRoot string) CPUSettings {
+	host := runtime.NumCPU()
+	settings := CPUSettings{MaxProcs: host, Source: "host"}
+	if quota, ok := CgroupCPUQuota(cgroupRoot); ok {
+		settings.Quota = quota
+	}
+
+	switch {
+	case explicit > 0:
+		settings.MaxProcs = explicit
+		settings.Source = "env"
+	case settings.Quota > 0 && settings.Quota < float64(host):
+		settings.MaxProcs = max(1, int(math.Floor(settings.Quota)))
+		settings.Source = "cgroup"
+	}
+	return settings
+}
+
+// Apply installs the settings in the runtime
+func (s CPUSettings) Apply() {
+	runtime.GOMAXPROCS(s.MaxProcs)
+}
+
+// Attributes describes the settings as resource attributes
+func (s CPUSettings) Attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("go.maxprocs", s.MaxProcs),
+		attribute.String("go.maxprocs.source", s.Source),
+	}
+}
+
+// Effective reports the settings keyed like the environment variables
+func (s CPUSettings) Effective() map[string]string {
+	return map[string]string{
+		"GOMAXPROCS":        strconv.Itoa(s.MaxProcs),
+		"GOMAXPROCS_SOURCE": s.Source,
+	}
+}
+
+// CgroupCPUQuota reads the container CPU limit, in cores, from cgroup v2 or v1
+func CgroupCPUQuota(root string) (float64, bool) {
+	if raw, err := os.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		fields := strings.Fields(string(raw))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		return cpuQuota(fields[0], fields[1])
+	}
+
+	quota, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if err != nil {
+		return 0, false
+	}
+	period, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, false
+	}
+	return cpuQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+// cpuQuota divides a CFS quota by its period; a non-positive quota (-1 in
+// cgroup v1) means unlimited
+func cpuQuota(rawQuota, rawPeriod string) (float64, bool) {
+	quota, err := strconv.ParseInt(rawQuota, 10, 64)
+	if err != nil || quota <= 0 {
+		return 0, false
+	}
+	period, err := strconv.ParseInt(rawPeriod, 10, 64)
+	if err != nil || period <= 0 {
+		return 0, false
+	}
+	return float64(quota) / float64(period), true
+}
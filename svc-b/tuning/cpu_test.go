@@ -0,0 +1,66 @@
+package tuning
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestCgroupCPUQuota(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		files  map[string]string
+		want   float64
+		wantOK bool
+	}{
+		{"v2 fractional", map[string]string{"cpu.max": "150000 100000\n"}, 1.5, true},
+		{"v2 unlimited", map[string]string{"cpu.max": "max 100000\n"}, 0, false},
+		{"v1 quota", map[string]string{"cpu/cpu.cfs_quota_us": "200000\n", "cpu/cpu.cfs_period_us": "100000\n"}, 2, true},
+		{"v1 unlimited", map[string]string{"cpu/cpu.cfs_quota_us": "-1\n", "cpu/cpu.cfs_period_us": "100000\n"}, 0, false},
+		{"no cgroup", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := CgroupCPUQuota(writeCgroup(t, tt.files))
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("CgroupCPUQuota() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestResolveMaxProcs(t *testing.T) {
+	t.Parallel()
+
+	host := runtime.NumCPU()
+	type maxProcsCase struct {
+		name       string
+		explicit   int
+		files      map[string]string
+		want       int
+		wantSource string
+	}
+	tests := []maxProcsCase{
+		{"explicit wins", 3, map[string]string{"cpu.max": "50000 100000"}, 3, "env"},
+		{"below one core", 0, map[string]string{"cpu.max": "50000 100000"}, 1, "cgroup"},
+		{"no quota", 0, nil, host, "host"},
+		{"quota above host", 0, map[string]string{"cpu.max": "100000000 100000"}, host, "host"},
+	}
+	// Rounding down a fractional quota only shows on hosts with spare cores
+	if host > 2 {
+		tests = append(tests, maxProcsCase{"fractional rounds down", 0, map[string]string{"cpu.max": "250000 100000"}, 2, "cgroup"})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := ResolveMaxProcs(tt.explicit, writeCgroup(t, tt.files))
+			if got.MaxProcs != tt.want || got.Source != tt.wantSource {
+				t.Errorf("ResolveMaxProcs() = %d from %s, want %d from %s", got.MaxProcs, got.Source, tt.want, tt.wantSource)
+			}
+		})
+	}
+}
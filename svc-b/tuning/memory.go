@@ -0,0 +1,121 @@
+// Package tuning sizes the Go runtime to the container it runs in
+package tuning
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DefaultCgroupRoot is where the container's cgroup hierarchy is mounted
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// cgroupV1Unlimited is the smallest memory.limit_in_bytes treated as no
+// limit; cgroup v1 reports "unlimited" as a page-aligned MaxInt64
+const cgroupV1Unlimited = 1 << 60
+
+// MemoryConfig is the GC tuning requested through the environment
+type MemoryConfig struct {
+	// GCPercent is GOGC; -1 turns the collector off until the memory limit
+	GCPercent int
+	// MemoryLimit is GOMEMLIMIT in bytes; 0 derives it from the container limit
+	MemoryLimit int64
+	// LimitRatio is the share of the container memory limit used as the
+	// derived GOMEMLIMIT, leaving headroom for non-heap memory
+	LimitRatio float64
+}
+
+// MemorySettings are the GC settings in effect
+type MemorySettings struct {
+	GCPercent int
+	// MemoryLimit is the soft memory limit in bytes, math.MaxInt64 when unset
+	MemoryLimit int64
+	// Source says where MemoryLimit came from: env, cgroup or unlimited
+	Source string
+	// ContainerLimit is the cgroup memory limit, 0 when there is none
+	ContainerLimit int64
+}
+
+// ResolveMemory decides the GC settings: an explicit GOMEMLIMIT wins,
+// otherwise a share of the container memory limit is used when there is one
+func ResolveMemory(config MemoryConfig, cgroupRoot string) MemorySettings {
+	settings := MemorySettings{
+		GCPercent:   config.GCPercent,
+		MemoryLimit: math.MaxInt64,
+		Source:      "unlimited",
+	}
+	if limit, ok := CgroupMemoryLimit(cgroupRoot); ok {
+		settings.ContainerLimit = limit
+	}
+
+	switch {
+	case config.MemoryLimit > 0:
+		settings.MemoryLimit = config.MemoryLimit
+		settings.Source = "env"
+	case settings.ContainerLimit > 0 && config.LimitRatio > 0:
+		settings.MemoryLimit = int64(float64(settings.ContainerLimit) * config.LimitRatio)
+		settings.Source = "cgroup"
+	}
+	return settings
+}
+
+// Apply installs the settings in the runtime
+func (s MemorySettings) Apply() {
+	debug.SetGCPercent(s.GCPercent)
+	debug.SetMemoryLimit(s.MemoryLimit)
+}
+
+// Attributes describes the settings as resource attributes
+func (s MemorySettings) Attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("go.gc.percent", s.GCPercent),
+		attribute.Int64("go.memory.limit", s.MemoryLimit),
+		attribute.String("go.memory.limit.source", s.Source),
+	}
+}
+
+// Effective reports the settings keyed like the environment variables
+func (s MemorySettings) Effective() map[string]string {
+	effective := map[string]string{
+		"GOGC":              strconv.Itoa(s.GCPercent),
+		"GOMEMLIMIT":        strconv.FormatInt(s.MemoryLimit, 10),
+		"GOMEMLIMIT_SOURCE": s.Source,
+	}
+	if s.GCPercent < 0 {
+		effective["GOGC"] = "off"
+	}
+	if s.MemoryLimit == math.MaxInt64 {
+		effective["GOMEMLIMIT"] = "off"
+	}
+	return effective
+}
+
+// CgroupMemoryLimit reads the container memory limit from cgroup v2 or v1
+func CgroupMemoryLimit(root string) (int64, bool) {
+	if raw, err := os.ReadFile(filepath.Join(root, "memory.max")); err == nil {
+		value := strings.TrimSpace(string(raw))
+		if value == "max" {
+			return 0, false
+		}
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit <= 0 {
+			return 0, false
+		}
+		return limit, true
+	}
+
+	if raw, err := os.ReadFile(filepath.Join(root, "memory", "memory.limit_in_bytes")); err == nil {
+		limit, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+		if err != nil || limit <= 0 || limit >= cgroupV1Unlimited {
+			return 0, false
+		}
+		return limit, true
+	}
+
+	return 0, false
+}
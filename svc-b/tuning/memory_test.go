@@ -0,0 +1,91 @@
+package tuning
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCgroup lays out a fake cgroup hierarchy with the given files
+func writeCgroup(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestCgroupMemoryLimit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		files  map[string]string
+		want   int64
+		wantOK bool
+	}{
+		{"v2 limit", map[string]string{"memory.max": "536870912\n"}, 536870912, true},
+		{"v2 unlimited", map[string]string{"memory.max": "max\n"}, 0, false},
+		{"v1 limit", map[string]string{"memory/memory.limit_in_bytes": "268435456\n"}, 268435456, true},
+		{"v1 unlimited", map[string]string{"memory/memory.limit_in_bytes": "9223372036854771712\n"}, 0, false},
+		{"no cgroup", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := CgroupMemoryLimit(writeCgroup(t, tt.files))
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("CgroupMemoryLimit() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestResolveMemory(t *testing.T) {
+	t.Parallel()
+
+	limited := map[string]string{"memory.max": "1000000000"}
+	tests := []struct {
+		name       string
+		config     MemoryConfig
+		files      map[string]string
+		wantLimit  int64
+		wantSource string
+	}{
+		{"derived from cgroup", MemoryConfig{GCPercent: 100, LimitRatio: 0.9}, limited, 900000000, "cgroup"},
+		{"explicit limit wins", MemoryConfig{GCPercent: 100, MemoryLimit: 1 << 20, LimitRatio: 0.9}, limited, 1 << 20, "env"},
+		{"ratio disabled", MemoryConfig{GCPercent: 100}, limited, math.MaxInt64, "unlimited"},
+		{"no container limit", MemoryConfig{GCPercent: 100, LimitRatio: 0.9}, nil, math.MaxInt64, "unlimited"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := ResolveMemory(tt.config, writeCgroup(t, tt.files))
+			if got.MemoryLimit != tt.wantLimit || got.Source != tt.wantSource {
+				t.Errorf("ResolveMemory() = %d from %s, want %d from %s", got.MemoryLimit, got.Source, tt.wantLimit, tt.wantSource)
+			}
+			if got.GCPercent != tt.config.GCPercent {
+				t.Errorf("GCPercent = %d, want %d", got.GCPercent, tt.config.GCPercent)
+			}
+		})
+	}
+}
+
+func TestMemorySettingsEffective(t *testing.T) {
+	t.Parallel()
+
+	effective := MemorySettings{GCPercent: -1, MemoryLimit: math.MaxInt64, Source: "unlimited"}.Effective()
+	if effective["GOGC"] != "off" || effective["GOMEMLIMIT"] != "off" {
+		t.Errorf("Effective() = %v, want GOGC and GOMEMLIMIT off", effective)
+	}
+}
@@ -0,0 +1,221 @@
+// Package usecase holds svc-b's business logic, independent of the transport
+// that exposes it
+package usecase
+
+import (
+	"context"
+	"errors"
+	"pkg/telemetry"
+	"strings"
+	"svc-b/deadline"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/services"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Resolve selects how far a CEP is resolved
+type Resolve string
+
+const (
+	// ResolveWeather resolves the CEP to its city and fetches its temperature
+	ResolveWeather Resolve = "weather"
+	// ResolveCity only resolves the CEP to its city, skipping the weather provider
+	ResolveCity Resolve = "city"
+)
+
+// Stage names, as reported in WeatherResult.Stages
+const (
+	StageCEP     = "cep"
+	StageWeather = "weather"
+)
+
+// cepShare is the share of the time left the CEP stage gets when the weather
+// stage follows it, which gets the rest
+const cepShare = 0.5
+
+var ErrInvalidResolve = errors.New("invalid resolve mode")
+
+// ParseResolve parses a resolve mode, defaulting to ResolveWeather
+func ParseResolve(raw string) (Resolve, error) {
+	switch Resolve(raw) {
+	case "", ResolveWeather:
+		return ResolveWeather, nil
+	case ResolveCity:
+		return ResolveCity, nil
+	default:
+		return "", ErrInvalidResolve
+	}
+}
+
+// WeatherQuery asks for the weather at a CEP
+type WeatherQuery struct {
+	CEP     string
+	Resolve Resolve
+}
+
+// Stage is the time spent in one upstream provider
+type Stage struct {
+	Name     string
+	Duration time.Duration
+}
+
+// WeatherResult holds the resolved city, with the rest of the CEP's address,
+// and, unless only the city was asked for, its temperature. Stages are
+// reported even when an error is returned.
+type WeatherResult struct {
+	City        string
+	Address     *models.Address
+	Temperature *models.Temperature
+	Stages      []Stage
+}
+
+// FailedStage names the last stage reached, which is the one that failed when
+// GetWeatherByCEP returns an error; it is empty if no provider was called
+func (r WeatherResult) FailedStage() string {
+	return lastStage(r.Stages)
+}
+
+// ForecastQuery asks for the daily forecast at a CEP
+type ForecastQuery struct {
+	CEP  string
+	Days int
+}
+
+// ForecastResult holds the resolved city and its daily forecast. Stages are
+// reported even when an error is returned.
+type ForecastResult struct {
+	City   string
+	Days   []models.DailyForecast
+	Stages []Stage
+}
+
+// FailedStage names the stage that failed when GetForecastByCEP returns an
+// error, as WeatherResult.FailedStage does
+func (r ForecastResult) FailedStage() string {
+	return lastStage(r.Stages)
+}
+
+func lastStage(stages []Stage) string {
+	if len(stages) == 0 {
+		return ""
+	}
+	return stages[len(stages)-1].Name
+}
+
+// Weather resolves CEPs to their city's current temperature
+type Weather struct {
+	cepService     services.CEPService
+	weatherService services.WeatherService
+	tracer         trace.Tracer
+	metrics        *telemetry.Recorder
+}
+
+func NewWeather(cep services.CEPService, weather services.WeatherService, providers observability.Providers) *Weather {
+	return &Weather{
+		cepService:     cep,
+		weatherService: weather,
+		tracer:         providers.Tracer("weather-usecase"),
+		metrics:        providers.Recorder(),
+	}
+}
+
+// NormalizeCEP strips the punctuation clients commonly send with a CEP
+func NormalizeCEP(cep string) string {
+	cep = strings.ReplaceAll(cep, "-", "")
+	return strings.ReplaceAll(cep, ".", "")
+}
+
+// GetWeatherByCEP resolves the query's CEP and, for ResolveWeather, the
+// temperature of its city. Errors are the services' sentinel errors.
+func (u *Weather) GetWeatherByCEP(ctx context.Context, query WeatherQuery) (result WeatherResult, err error) {
+	ctx, span := u.tracer.Start(ctx, observability.SpanProcessWeatherRequest.Name)
+	defer span.End()
+
+	start := time.Now()
+	defer func() {
+		outcome := "success"
+		if err != nil {
+			outcome = "error"
+		}
+		u.metrics.ObserveDuration(ctx, observability.WeatherLookupDuration.Name, time.Since(start),
+			attribute.String("resolve", string(query.Resolve)), attribute.String("result", outcome))
+	}()
+
+	cep := NormalizeCEP(query.CEP)
+	span.SetAttributes(attribute.String("cep", cep), attribute.String("resolve", string(query.Resolve)))
+
+	if len(cep) != 8 {
+		return result, services.ErrInvalidZipCode
+	}
+
+	share := cepShare
+	if query.Resolve == ResolveCity {
+		share = 1
+	}
+	cepCtx, cancel := deadline.Child(ctx, share)
+	cepStart := time.Now()
+	address, err := u.cepService.GetAddressByCEP(cepCtx, cep)
+	cancel()
+	result.Stages = append(result.Stages, Stage{Name: StageCEP, Duration: time.Since(cepStart)})
+	if err != nil {
+		return result, err
+	}
+	result.City, result.Address = address.City, address
+
+	if query.Resolve == ResolveCity {
+		return result, nil
+	}
+
+	location := address.Location()
+	location.CEP = cep
+	weatherStart := time.Now()
+	temp, err := u.weatherService.GetTemperature(ctx, location)
+	result.Stages = append(result.Stages, Stage{Name: StageWeather, Duration: time.Since(weatherStart)})
+	if err != nil {
+		return result, err
+	}
+	result.Temperature = temp
+	if temp.Location != nil {
+		span.SetAttributes(attribute.String("weather.resolved_location", temp.Location.String()))
+	}
+
+	return result, nil
+}
+
+// GetForecastByCEP resolves the query's CEP and fetches the daily forecast of
+// its city, failing with services.ErrForecastUnsupported when the weather
+// provider has no forecast
+func (u *Weather) GetForecastByCEP(ctx context.Context, query ForecastQuery) (result ForecastResult, err error) {
+	cep := NormalizeCEP(query.CEP)
+	if len(cep) != 8 {
+		return result, services.ErrInvalidZipCode
+	}
+
+	cepCtx, cancel := deadline.Child(ctx, cepShare)
+	cepStart := time.Now()
+	address, err := u.cepService.GetAddressByCEP(cepCtx, cep)
+	cancel()
+	result.Stages = append(result.Stages, Stage{Name: StageCEP, Duration: time.Since(cepStart)})
+	if err != nil {
+		return result, err
+	}
+	result.City = address.City
+
+	forecaster, ok := u.weatherService.(services.ForecastService)
+	if !ok {
+		return result, services.ErrForecastUnsupported
+	}
+	weatherStart := time.Now()
+	days, err := forecaster.GetForecast(ctx, address.Location(), query.Days)
+	result.Stages = append(result.Stages, Stage{Name: StageWeather, Duration: time.Since(weatherStart)})
+	if err != nil {
+		return result, err
+	}
+	result.Days = days
+
+	return result, nil
+}
@@ -0,0 +1,176 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"svc-b/deadline"
+	"svc-b/models"
+	"svc-b/observability"
+	"svc-b/services"
+	"testing"
+	"time"
+)
+
+type stubCEPService struct {
+	cities map[string]string
+}
+
+func (s stubCEPService) GetAddressByCEP(ctx context.Context, cep string) (*models.Address, error) {
+	if city, ok := s.cities[cep]; ok {
+		return &models.Address{City: city}, nil
+	}
+	return nil, services.ErrZipCodeNotFound
+}
+
+type stubWeatherService struct {
+	calls *int
+}
+
+func (s stubWeatherService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	*s.calls++
+	if location.City != "Rio de Janeiro" {
+		return nil, services.ErrCityNotFound
+	}
+	return &models.Temperature{TempC: 25, TempF: 77, TempK: 298.15}, nil
+}
+
+// budgetService records the time left to each stage
+type budgetService struct {
+	budgets map[string]time.Duration
+}
+
+func (s budgetService) GetAddressByCEP(ctx context.Context, cep string) (*models.Address, error) {
+	s.budgets[StageCEP], _ = deadline.Remaining(ctx)
+	return &models.Address{City: "Rio de Janeiro"}, nil
+}
+
+func (s budgetService) GetTemperature(ctx context.Context, location models.Location) (*models.Temperature, error) {
+	s.budgets[StageWeather], _ = deadline.Remaining(ctx)
+	return &models.Temperature{TempC: 25}, nil
+}
+
+func TestStagesStayWithinBudget(t *testing.T) {
+	t.Parallel()
+
+	const budget = 10 * time.Second
+	tests := []struct {
+		resolve  Resolve
+		expected map[string]time.Duration
+	}{
+		{ResolveWeather, map[string]time.Duration{StageCEP: budget / 2, StageWeather: budget}},
+		{ResolveCity, map[string]time.Duration{StageCEP: budget}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.resolve), func(t *testing.T) {
+			t.Parallel()
+
+			service := budgetService{budgets: make(map[string]time.Duration)}
+			ctx, cancel := context.WithTimeout(context.Background(), budget)
+			defer cancel()
+
+			if _, err := NewWeather(service, service, observability.Providers{}).GetWeatherByCEP(ctx, WeatherQuery{CEP: "22450000", Resolve: tt.resolve}); err != nil {
+				t.Fatalf("GetWeatherByCEP() error = %v", err)
+			}
+			if len(service.budgets) != len(tt.expected) {
+				t.Fatalf("stages called: %v, want %v", service.budgets, tt.expected)
+			}
+			for stage, expected := range tt.expected {
+				if got := service.budgets[stage]; got > expected || got < expected-time.Second {
+					t.Errorf("%s stage had %v left, want about %v and never more", stage, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestGetWeatherByCEP(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		query         WeatherQuery
+		expectedCity  string
+		expectedTemp  bool
+		expectedErr   error
+		expectedStage string
+		weatherCalls  int
+	}{
+		{
+			name:          "Weather",
+			query:         WeatherQuery{CEP: "22450-000", Resolve: ResolveWeather},
+			expectedCity:  "Rio de Janeiro",
+			expectedTemp:  true,
+			expectedStage: StageWeather,
+			weatherCalls:  1,
+		},
+		{
+			name:          "City only",
+			query:         WeatherQuery{CEP: "22.450-000", Resolve: ResolveCity},
+			expectedCity:  "Rio de Janeiro",
+			expectedStage: StageCEP,
+		},
+		{
+			name:        "Invalid CEP",
+			query:       WeatherQuery{CEP: "123", Resolve: ResolveWeather},
+			expectedErr: services.ErrInvalidZipCode,
+		},
+		{
+			name:          "Unknown CEP",
+			query:         WeatherQuery{CEP: "99999999", Resolve: ResolveWeather},
+			expectedErr:   services.ErrZipCodeNotFound,
+			expectedStage: StageCEP,
+		},
+		{
+			name:          "Unknown city",
+			query:         WeatherQuery{CEP: "01001000", Resolve: ResolveWeather},
+			expectedCity:  "Atlantis",
+			expectedErr:   services.ErrCityNotFound,
+			expectedStage: StageWeather,
+			weatherCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			calls := 0
+			weather := NewWeather(
+				stubCEPService{cities: map[string]string{"22450000": "Rio de Janeiro", "01001000": "Atlantis"}},
+				stubWeatherService{calls: &calls},
+				observability.Providers{},
+			)
+
+			result, err := weather.GetWeatherByCEP(context.Background(), tt.query)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("GetWeatherByCEP() error = %v, want %v", err, tt.expectedErr)
+			}
+			if result.City != tt.expectedCity {
+				t.Errorf("City = %q, want %q", result.City, tt.expectedCity)
+			}
+			if (result.Temperature != nil) != tt.expectedTemp {
+				t.Errorf("Temperature = %+v, want present=%v", result.Temperature, tt.expectedTemp)
+			}
+			if stage := result.FailedStage(); stage != tt.expectedStage {
+				t.Errorf("last stage = %q, want %q", stage, tt.expectedStage)
+			}
+			if calls != tt.weatherCalls {
+				t.Errorf("weather provider called %d times, want %d", calls, tt.weatherCalls)
+			}
+		})
+	}
+}
+
+func TestParseResolve(t *testing.T) {
+	t.Parallel()
+
+	for raw, expected := range map[string]Resolve{"": ResolveWeather, "weather": ResolveWeather, "city": ResolveCity} {
+		if got, err := ParseResolve(raw); err != nil || got != expected {
+			t.Errorf("ParseResolve(%q) = %q, %v; want %q", raw, got, err, expected)
+		}
+	}
+	if _, err := ParseResolve("forecast"); !errors.Is(err, ErrInvalidResolve) {
+		t.Errorf("ParseResolve(\"forecast\") error = %v, want ErrInvalidResolve", err)
+	}
+}